@@ -15,8 +15,13 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
 	"os"
+	"runtime/debug"
 
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/awssession"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
@@ -36,6 +41,24 @@ const (
 
 	// Environment variable to disable the IPAMD introspection endpoint on 61679
 	envDisableIntrospection = "DISABLE_INTROSPECTION"
+
+	// Environment variable to disable reporting missing EC2 permissions as a node condition
+	envDisableIAMPermissionCheck = "DISABLE_IAM_PERMISSION_CHECK"
+
+	// Environment variable to release ENIs and IPs when the node gets a Spot interruption or Auto Scaling termination notice
+	envEnableNodeTerminationHandling = "ENABLE_NODE_TERMINATION_HANDLING"
+
+	// Environment variable to shed non-essential work when ipamd gets close to the memory or CPU limits of its cgroup
+	envEnableResourceBudget = "ENABLE_RESOURCE_BUDGET"
+
+	// Environment variable to export the VPC resources consumed by each namespace on the node
+	envEnableUsageAttribution = "ENABLE_USAGE_ATTRIBUTION"
+
+	// Environment variable to check the datastore against the pods of the node and their sandboxes
+	envEnableSandboxReconcile = "ENABLE_SANDBOX_RECONCILE"
+
+	// Environment variable to follow the pod sandboxes through the Node Resource Interface of containerd
+	envEnableNRIPlugin = "ENABLE_NRI_PLUGIN"
 )
 
 func main() {
@@ -46,6 +69,9 @@ func _main() int {
 	// Do not add anything before initializing logger
 	log := logger.Get()
 
+	validateConfig := flag.Bool("validate-config", false, "validate the configuration against the cluster and EC2, then exit")
+	flag.Parse()
+
 	log.Infof("Starting L-IPAMD %s  ...", version.Version)
 	version.RegisterMetric()
 
@@ -62,35 +88,118 @@ func _main() int {
 		return 1
 	}
 
+	if *validateConfig {
+		if err := ipamd.ValidateConfig(context.Background(), k8sClient); err != nil {
+			log.Errorf("%v", err)
+			return 1
+		}
+		log.Infof("Configuration is valid")
+		return 0
+	}
+
 	// Create EventRecorder for use by IPAMD
 	if err := eventrecorder.Init(k8sClient); err != nil {
 		log.Errorf("Failed to create event recorder: %s", err)
 		return 1
 	}
 
-	ipamContext, err := ipamd.New(k8sClient)
+	// Fail closed rather than fall back to the node instance role when only the IRSA credentials may be used
+	irsaOnly := awssession.IRSAOnly()
+	if irsaOnly {
+		if err := ipamd.CheckIRSACredentials(context.Background(), k8sClient); err != nil {
+			return 1
+		}
+	}
+
+	// ipamd leaves a snapshot of its state behind for post-mortem analysis when it fails to initialize or crashes
+	ipamContext, err := ipamd.New(k8sClient, version.Version)
 	if err != nil {
 		log.Errorf("Initialization failure: %v", err)
 		return 1
 	}
+	defer func() {
+		if r := recover(); r != nil {
+			ipamContext.WriteCrashSnapshot(version.Version, fmt.Sprintf("panic: %v", r), debug.Stack())
+			panic(r)
+		}
+	}()
 
 	// Pool manager
-	go ipamContext.StartNodeIPPoolManager()
+	ipamd.GoHandlingCrashes(ipamContext.StartNodeIPPoolManager)
 
 	if !utils.GetBoolAsStringEnvVar(envDisableMetrics, false) {
-		// Prometheus metrics
-		go metrics.ServeMetrics(metricsPort)
+		// Prometheus metrics, over TLS and with authentication if configured
+		metricsConfig, err := metrics.GetServerSecurityConfig()
+		if err != nil {
+			log.Errorf("Invalid metrics endpoint configuration: %v", err)
+			return 1
+		}
+		ipamd.GoHandlingCrashes(func() { metrics.ServeMetrics(metricsPort, metricsConfig) })
+	}
+
+	// Report missing EC2 permissions as a node condition
+	if !utils.GetBoolAsStringEnvVar(envDisableIAMPermissionCheck, false) {
+		ipamd.GoHandlingCrashes(ipamContext.MonitorIAMPermissions)
+	}
+
+	// Report an expired or missing IRSA token as a node condition
+	if irsaOnly {
+		ipamd.GoHandlingCrashes(ipamContext.MonitorIRSACredentials)
 	}
 
+	// Stop allocating IPs and release unused ENIs and IPs once the node is going away
+	if utils.GetBoolAsStringEnvVar(envEnableNodeTerminationHandling, false) {
+		ipamd.GoHandlingCrashes(ipamContext.MonitorNodeTermination)
+	}
+
+	// Shed non-essential work before ipamd gets OOM-killed or throttled
+	if utils.GetBoolAsStringEnvVar(envEnableResourceBudget, false) {
+		ipamd.GoHandlingCrashes(ipamContext.MonitorResourceBudget)
+	}
+
+	// Export the VPC resources consumed by each namespace, to charge them back to the tenants of the cluster
+	if utils.GetBoolAsStringEnvVar(envEnableUsageAttribution, false) {
+		ipamd.GoHandlingCrashes(ipamContext.MonitorUsageAttribution)
+	}
+
+	// Check the datastore against the pods of the node and their sandboxes
+	if utils.GetBoolAsStringEnvVar(envEnableSandboxReconcile, false) {
+		ipamd.GoHandlingCrashes(ipamContext.MonitorSandboxes)
+	}
+
+	// Release the IPs of the sandboxes that containerd removed without a CNI DEL
+	if utils.GetBoolAsStringEnvVar(envEnableNRIPlugin, false) {
+		ipamd.GoHandlingCrashes(ipamContext.MonitorNRI)
+	}
+
+	// Detect and repair external modifications of the CNI conflist
+	ipamd.GoHandlingCrashes(ipamContext.MonitorConflist)
+
+	// Apply the sysctl policy of the node, and set back the sysctls changed on the host
+	ipamd.GoHandlingCrashes(ipamContext.MonitorSysctls)
+
+	// Advertise the pod CIDRs to BGP routers through FRR, when a route advertisement of the CNIConfig matches the node
+	ipamd.GoHandlingCrashes(ipamContext.MonitorRouteAdvertisement)
+
+	// Set up the network of the secondary ENIs again when the host removes their routes and rules
+	ipamd.GoHandlingCrashes(ipamContext.MonitorENINetworks)
+
+	// Reconnect to the API server when its endpoint moves
+	ipamd.GoHandlingCrashes(ipamContext.MonitorAPIServer)
+
+	// Confirm and renew the IPs leased to the CNI plugin
+	ipamd.GoHandlingCrashes(ipamContext.MonitorIPLeases)
+
 	// CNI introspection endpoints
 	if !utils.GetBoolAsStringEnvVar(envDisableIntrospection, false) {
-		go ipamContext.ServeIntrospection()
+		ipamd.GoHandlingCrashes(ipamContext.ServeIntrospection)
 	}
 
 	// Start the RPC listener
 	err = ipamContext.RunRPCHandler(version.Version)
 	if err != nil {
 		log.Errorf("Failed to set up gRPC handler: %v", err)
+		ipamContext.WriteCrashSnapshot(version.Version, fmt.Sprintf("failed to set up gRPC handler: %v", err), nil)
 		return 1
 	}
 	return 0
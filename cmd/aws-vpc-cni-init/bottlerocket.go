@@ -0,0 +1,119 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper"
+)
+
+const (
+	// envBottlerocketMode sets the sysctls through the API of Bottlerocket, which keeps them across reboots, and skips
+	// the configuration of the network daemons that Bottlerocket generates itself
+	envBottlerocketMode        = "ENABLE_BOTTLEROCKET_MODE"
+	envBottlerocketAPISock     = "BOTTLEROCKET_API_SOCKET"
+	defaultBottlerocketMode    = false
+	defaultBottlerocketAPISock = "/host/run/api.sock"
+
+	// bottlerocketTx is the transaction of the API the settings of the init container are staged in
+	bottlerocketTx         = "aws-vpc-cni-init"
+	bottlerocketAPITimeout = 30 * time.Second
+)
+
+// bottlerocketProcSys reads the sysctls from /proc/sys and stages the changes, which commit applies through the API of
+// Bottlerocket
+type bottlerocketProcSys struct {
+	procSys procsyswrapper.ProcSys
+	staged  map[string]string
+}
+
+func newBottlerocketProcSys(procSys procsyswrapper.ProcSys) *bottlerocketProcSys {
+	return &bottlerocketProcSys{procSys: procSys, staged: make(map[string]string)}
+}
+
+// Get returns the staged value of the sysctl, or the one of /proc/sys
+func (b *bottlerocketProcSys) Get(key string) (string, error) {
+	if value, ok := b.staged[key]; ok {
+		return value, nil
+	}
+	return b.procSys.Get(key)
+}
+
+func (b *bottlerocketProcSys) Set(key, value string) error {
+	b.staged[key] = value
+	return nil
+}
+
+// commit sets the staged sysctls in the kernel settings of Bottlerocket and applies them
+func (b *bottlerocketProcSys) commit(socket string) error {
+	if len(b.staged) == 0 {
+		return nil
+	}
+	// The API takes the dotted names of sysctl(8)
+	sysctls := make(map[string]string, len(b.staged))
+	for key, value := range b.staged {
+		sysctls[strings.ReplaceAll(key, "/", ".")] = value
+	}
+	settings, err := json.Marshal(map[string]interface{}{"kernel": map[string]interface{}{"sysctl": sysctls}})
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{
+		Timeout: bottlerocketAPITimeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	if err := bottlerocketAPICall(client, http.MethodPatch, "/settings?tx="+bottlerocketTx, settings); err != nil {
+		return err
+	}
+	if err := bottlerocketAPICall(client, http.MethodPost, "/tx/commit_and_apply?tx="+bottlerocketTx, nil); err != nil {
+		return err
+	}
+	log.Infof("Applied %d sysctls through the Bottlerocket API", len(sysctls))
+	return nil
+}
+
+func bottlerocketAPICall(client *http.Client, method, path string, body []byte) error {
+	req, err := http.NewRequest(method, "http://localhost"+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "calling the Bottlerocket API %s %s", method, path)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("calling the Bottlerocket API %s %s: %s: %s", method, path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
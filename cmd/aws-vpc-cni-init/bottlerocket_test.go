@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	mock_procsyswrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper/mocks"
+)
+
+func TestBottlerocketProcSys(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	procSys := mock_procsyswrapper.NewMockProcSys(ctrl)
+	procSys.EXPECT().Get("net/ipv4/tcp_early_demux").Return("0", nil)
+
+	// The sysctls are staged instead of written
+	b := newBottlerocketProcSys(procSys)
+	assert.NoError(t, configureSystemParams(b))
+	value, err := b.Get("net/ipv4/tcp_early_demux")
+	assert.NoError(t, err)
+	assert.Equal(t, "1", value)
+	assert.NoError(t, b.Set("net/ipv4/conf/eth0/rp_filter", "2"))
+	value, err = b.Get("net/ipv4/conf/eth0/rp_filter")
+	assert.NoError(t, err)
+	assert.Equal(t, "2", value)
+
+	socket := filepath.Join(t.TempDir(), "api.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	var requests []string
+	var settings map[string]map[string]map[string]string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.String())
+		if r.Method == http.MethodPatch {
+			body, _ := io.ReadAll(r.Body)
+			assert.NoError(t, json.Unmarshal(body, &settings))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	assert.NoError(t, b.commit(socket))
+	assert.Equal(t, []string{"PATCH /settings?tx=aws-vpc-cni-init", "POST /tx/commit_and_apply?tx=aws-vpc-cni-init"}, requests)
+	assert.Equal(t, map[string]string{"net.ipv4.tcp_early_demux": "1", "net.ipv4.conf.eth0.rp_filter": "2"},
+		settings["kernel"]["sysctl"])
+
+	// Nothing is sent without a change
+	requests = nil
+	assert.NoError(t, newBottlerocketProcSys(procSys).commit(socket))
+	assert.Empty(t, requests)
+
+	// The errors of the API are returned
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid setting", http.StatusBadRequest)
+	})
+	assert.ErrorContains(t, b.commit(socket), "400 Bad Request: invalid setting")
+}
@@ -18,6 +18,7 @@ import (
 	"os"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
 	"github.com/aws/amazon-vpc-cni-k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/utils/cp"
 	"github.com/aws/amazon-vpc-cni-k8s/utils/imds"
@@ -34,24 +35,32 @@ const (
 	defaultDisableIPv4TcpEarlyDemux = false
 	defaultEnableIPv6               = false
 	defaultEnableIPv6Egress         = false
+	defaultNodePortSupport          = true
+	defaultStrictRPFSupport         = false
+	defaultConfigureNetworkDaemons  = true
 
 	envDisableIPv4TcpEarlyDemux = "DISABLE_TCP_EARLY_DEMUX"
 	envEnableIPv6               = "ENABLE_IPv6"
 	envHostCniBinPath           = "HOST_CNI_BIN_PATH"
 	envEgressV6                 = "ENABLE_V6_EGRESS"
+	envNodePortSupport          = "AWS_VPC_CNI_NODE_PORT_SUPPORT"
+	envStrictRPFSupport         = "AWS_VPC_CNI_STRICT_RPF_SUPPORT"
+	envConfigureNetworkDaemons  = "CONFIGURE_NETWORK_DAEMONS"
+	envVethPrefix               = "AWS_VPC_K8S_CNI_VETHPREFIX"
+	envHostRoot                 = "HOST_ROOT"
 )
 
-func getNodePrimaryIF() (string, error) {
+func getNodePrimaryIF() (string, string, error) {
 	var primaryIF string
 	primaryMAC, err := imds.GetMetaData("mac")
 	if err != nil {
-		return primaryIF, errors.Wrap(err, "Failed to get primary MAC from IMDS")
+		return primaryIF, primaryMAC, errors.Wrap(err, "Failed to get primary MAC from IMDS")
 	}
 	log.Infof("Found primaryMAC %s", primaryMAC)
 
 	links, err := netlink.LinkList()
 	if err != nil {
-		return primaryIF, errors.Wrap(err, "Failed to list links")
+		return primaryIF, primaryMAC, errors.Wrap(err, "Failed to list links")
 	}
 	for _, link := range links {
 		if link.Attrs().HardwareAddr.String() == primaryMAC {
@@ -61,25 +70,15 @@ func getNodePrimaryIF() (string, error) {
 	}
 
 	if primaryIF == "" {
-		return primaryIF, errors.Wrap(err, "Failed to retrieve primary IF")
+		return primaryIF, primaryMAC, errors.Wrap(err, "Failed to retrieve primary IF")
 	}
-	return primaryIF, nil
+	return primaryIF, primaryMAC, nil
 }
 
-func configureSystemParams(procSys procsyswrapper.ProcSys, primaryIF string) error {
-	var err error
-	// Configure rp_filter in loose mode
-	entry := "net/ipv4/conf/" + primaryIF + "/rp_filter"
-	err = procSys.Set(entry, "2")
-	if err != nil {
-		return errors.Wrapf(err, "Failed to set rp_filter for %s", primaryIF)
-	}
-	val, _ := procSys.Get(entry)
-	log.Infof("Updated %s to %s", entry, val)
-
+func configureSystemParams(procSys procsyswrapper.ProcSys) error {
 	// Enable or disable TCP early demux based on environment variable
 	// Note that older kernels may not support tcp_early_demux, so we must first check that it exists.
-	entry = "net/ipv4/tcp_early_demux"
+	entry := "net/ipv4/tcp_early_demux"
 	if _, err := procSys.Get(entry); err == nil {
 		disableIPv4EarlyDemux := utils.GetBoolAsStringEnvVar(envDisableIPv4TcpEarlyDemux, defaultDisableIPv4TcpEarlyDemux)
 		if disableIPv4EarlyDemux {
@@ -93,51 +92,27 @@ func configureSystemParams(procSys procsyswrapper.ProcSys, primaryIF string) err
 				return errors.Wrap(err, "Failed to enable tcp_early_demux")
 			}
 		}
-		val, _ = procSys.Get(entry)
+		val, _ := procSys.Get(entry)
 		log.Infof("Updated %s to %s", entry, val)
 	}
 	return nil
 }
 
-func configureIPv6Settings(procSys procsyswrapper.ProcSys, primaryIF string) error {
-	var err error
-	// Enable IPv6 when environment variable is set
+// configureInterfaceSysctls sets the default sysctls of the interfaces before ipamd starts, ipamd then reconciles them
+// with the sysctl policy of the node and reports the conflicts
+func configureInterfaceSysctls(procSys procsyswrapper.ProcSys, primaryIF string) {
 	// Note that IPv6 is not disabled when environment variable is unset. This is omitted to preserve default host semantics.
 	enableIPv6 := utils.GetBoolAsStringEnvVar(envEnableIPv6, defaultEnableIPv6)
-	if enableIPv6 {
-		entry := "net/ipv6/conf/all/disable_ipv6"
-		err = procSys.Set(entry, "0")
-		if err != nil {
-			return errors.Wrap(err, "Failed to set disable_ipv6 to 0")
-		}
-		val, _ := procSys.Get(entry)
-		log.Infof("Updated %s to %s", entry, val)
+	strictRPFSupport := utils.GetBoolAsStringEnvVar(envStrictRPFSupport, defaultStrictRPFSupport) &&
+		utils.GetBoolAsStringEnvVar(envNodePortSupport, defaultNodePortSupport)
+	settings := sysctlpolicy.Defaults(sysctlpolicy.Options{
+		IPv6Enabled:       enableIPv6,
+		IPv6EgressEnabled: utils.GetBoolAsStringEnvVar(envEgressV6, defaultEnableIPv6Egress),
+		StrictRPFSupport:  !enableIPv6 && strictRPFSupport,
+	})
+	for _, conflict := range sysctlpolicy.NewEngine(procSys).Apply(primaryIF, settings) {
+		log.Warnf("Failed to configure sysctl: %s", conflict)
 	}
-	// Check if IPv6 egress support is enabled in IPv4 cluster.
-	ipv6EgressEnabled := utils.GetBoolAsStringEnvVar(envEgressV6, defaultEnableIPv6Egress)
-	if enableIPv6 || ipv6EgressEnabled {
-		// Enable IPv6 forwarding on all interfaces by default
-		entry := "net/ipv6/conf/all/forwarding"
-		err = procSys.Set(entry, "1")
-		if err != nil {
-			return errors.Wrap(err, "Failed to enable IPv6 forwarding")
-		}
-		val, _ := procSys.Get(entry)
-		log.Infof("Updated %s to %s", entry, val)
-
-		// For the primary ENI in IPv6, sysctls are set to:
-		// 1. forwarding=1
-		// 2. accept_ra=2
-		// 3. accept_redirects=1
-		entry = "net/ipv6/conf/" + primaryIF + "/accept_ra"
-		err = procSys.Set(entry, "2")
-		if err != nil {
-			return errors.Wrap(err, "Failed to enable IPv6 accept_ra on primary ENI")
-		}
-		val, _ = procSys.Get(entry)
-		log.Infof("Updated %s to %s", entry, val)
-	}
-	return nil
 }
 
 func main() {
@@ -159,25 +134,51 @@ func _main() int {
 	}
 	log.Infof("Copied all CNI plugin binaries to %s", hostCNIBinPath)
 
-	var primaryIF string
-	primaryIF, err = getNodePrimaryIF()
+	var primaryIF, primaryMAC string
+	primaryIF, primaryMAC, err = getNodePrimaryIF()
 	if err != nil {
 		log.WithError(err).Errorf("Failed to get primary IF")
 		return 1
 	}
 	log.Infof("Found primaryIF %s", primaryIF)
 
-	procSys := procsyswrapper.NewProcSys()
-	err = configureSystemParams(procSys, primaryIF)
+	bottlerocket := utils.GetBoolAsStringEnvVar(envBottlerocketMode, defaultBottlerocketMode)
+	var procSys procsyswrapper.ProcSys = procsyswrapper.NewProcSys()
+	var bottlerocketSysctls *bottlerocketProcSys
+	if bottlerocket {
+		bottlerocketSysctls = newBottlerocketProcSys(procSys)
+		procSys = bottlerocketSysctls
+	}
+	err = configureSystemParams(procSys)
 	if err != nil {
 		log.WithError(err).Errorf("Failed to configure system parameters")
 		return 1
 	}
 
-	err = configureIPv6Settings(procSys, primaryIF)
-	if err != nil {
-		log.WithError(err).Errorf("Failed to configure IPv6 settings")
-		return 1
+	configureInterfaceSysctls(procSys, primaryIF)
+
+	if bottlerocket {
+		if err := bottlerocketSysctls.commit(utils.GetEnv(envBottlerocketAPISock, defaultBottlerocketAPISock)); err != nil {
+			log.WithError(err).Errorf("Failed to apply the sysctls through the Bottlerocket API")
+			return 1
+		}
+		// Bottlerocket generates the configuration of systemd-networkd for the primary interface only
+		log.Infof("Not configuring the network daemons, Bottlerocket leaves the interfaces of the CNI alone")
+	} else {
+		err = configureNetworkDaemons(utils.GetEnv(envHostRoot, defaultHostRoot), utils.GetEnv(envVethPrefix, defaultVethPrefix),
+			primaryMAC, utils.GetBoolAsStringEnvVar(envConfigureNetworkDaemons, defaultConfigureNetworkDaemons))
+		if err != nil {
+			log.WithError(err).Errorf("Failed to configure the network daemons of the host")
+			return 1
+		}
+	}
+
+	if utils.GetBoolAsStringEnvVar(envSELinuxRelabel, defaultSELinuxRelabel) {
+		paths := selinuxRelabelPaths(utils.GetEnv(envSELinuxRelabelPaths, defaultSELinuxRelabelPaths))
+		if err := relabelPaths(paths, containerFileLabel, setFileLabel); err != nil {
+			log.WithError(err).Errorf("Failed to relabel the directories of aws-node")
+			return 1
+		}
 	}
 
 	log.Infof("CNI init container done")
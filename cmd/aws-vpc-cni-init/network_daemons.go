@@ -0,0 +1,145 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHostRoot   = "/host"
+	defaultVethPrefix = "eni"
+	// vlanPrefix is the name prefix of the VLAN interfaces and of the host veths of the pods with security groups
+	vlanPrefix = "vlan"
+
+	// Drivers of the secondary ENIs
+	driverENA     = "ena"
+	driverIXGBEVF = "ixgbevf"
+
+	nmConfigPath             = "etc/NetworkManager/conf.d/99-aws-vpc-cni.conf"
+	networkdVethsPath        = "etc/systemd/network/01-aws-vpc-cni-veths.network"
+	networkdSecondaryENIPath = "etc/systemd/network/01-aws-vpc-cni-secondary-enis.network"
+	networkdConfigPath       = "etc/systemd/networkd.conf.d/80-aws-vpc-cni.conf"
+
+	fileHeader = "# Installed by aws-vpc-cni-init, do not edit\n"
+)
+
+// networkDaemon is a network daemon of the host that can strip the addresses and routes of the interfaces the CNI
+// creates or attaches
+type networkDaemon struct {
+	name string
+	// detect are paths of the host, one of them exists when the daemon is installed
+	detect []string
+	// files returns the unmanaged-device configuration of the daemon by path
+	files func(vethPrefix, primaryMAC string) map[string]string
+}
+
+var networkDaemons = []networkDaemon{
+	{
+		name:   "NetworkManager",
+		detect: []string{"run/NetworkManager", "etc/NetworkManager"},
+		files:  networkManagerFiles,
+	},
+	{
+		name: "systemd-networkd",
+		// netplan renders its configuration to systemd-networkd, in 10-netplan-* files the files of the CNI sort before
+		detect: []string{"run/systemd/netif", "etc/netplan"},
+		files:  networkdFiles,
+	},
+}
+
+func networkManagerFiles(vethPrefix, primaryMAC string) map[string]string {
+	devices := []string{
+		"interface-name:" + vethPrefix + "*",
+		"interface-name:" + vlanPrefix + "*",
+		"driver:" + driverENA,
+		"driver:" + driverIXGBEVF,
+		// Takes precedence over the matches above
+		"except:mac:" + primaryMAC,
+	}
+	return map[string]string{
+		nmConfigPath: fileHeader + "[keyfile]\nunmanaged-devices=" + strings.Join(devices, ";") + "\n",
+	}
+}
+
+func networkdFiles(vethPrefix, primaryMAC string) map[string]string {
+	return map[string]string{
+		networkdVethsPath: fileHeader + fmt.Sprintf("[Match]\nName=%s* %s*\n\n[Link]\nUnmanaged=yes\n", vethPrefix, vlanPrefix),
+		networkdSecondaryENIPath: fileHeader + fmt.Sprintf("[Match]\nDriver=%s %s\nMACAddress=!%s\n\n[Link]\nUnmanaged=yes\n",
+			driverENA, driverIXGBEVF, primaryMAC),
+		// Otherwise a restart of systemd-networkd removes the per-ENI route tables and rules of the CNI
+		networkdConfigPath: fileHeader + "[Network]\nManageForeignRoutingPolicyRules=no\nManageForeignRoutes=no\n",
+	}
+}
+
+// detected returns whether the daemon is installed on the host
+func (d networkDaemon) detected(hostRoot string) bool {
+	for _, path := range d.detect {
+		if _, err := os.Stat(filepath.Join(hostRoot, path)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// configureNetworkDaemons marks the interfaces the CNI creates or attaches unmanaged in the network daemons detected
+// on the host, or removes the configuration when disabled. The daemons read it when they restart or reload.
+func configureNetworkDaemons(hostRoot, vethPrefix, primaryMAC string, enabled bool) error {
+	for _, daemon := range networkDaemons {
+		for path, content := range daemon.files(vethPrefix, primaryMAC) {
+			path = filepath.Join(hostRoot, path)
+			if !enabled {
+				if err := os.Remove(path); err == nil {
+					log.Infof("Removed %s configuration %s", daemon.name, path)
+				} else if !os.IsNotExist(err) {
+					return errors.Wrapf(err, "failed to remove %s", path)
+				}
+				continue
+			}
+			if !daemon.detected(hostRoot) {
+				continue
+			}
+			changed, err := writeFileIfChanged(path, []byte(content))
+			if err != nil {
+				return errors.Wrapf(err, "failed to configure %s", daemon.name)
+			}
+			if changed {
+				log.Infof("Installed %s configuration %s, it takes effect on the next reload of %s", daemon.name, path, daemon.name)
+			}
+		}
+	}
+	return nil
+}
+
+func writeFileIfChanged(path string, content []byte) (bool, error) {
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, content) {
+		return false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return false, err
+	}
+	// Written to a temporary file and renamed, so that a daemon never reads a partial file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0644); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
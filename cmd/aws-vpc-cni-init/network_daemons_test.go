@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testPrimaryMAC = "02:11:22:33:44:55"
+
+func TestConfigureNetworkDaemons(t *testing.T) {
+	hostRoot := t.TempDir()
+
+	// Nothing is installed without a detected daemon
+	assert.NoError(t, configureNetworkDaemons(hostRoot, defaultVethPrefix, testPrimaryMAC, true))
+	_, err := os.Stat(filepath.Join(hostRoot, "etc"))
+	assert.True(t, os.IsNotExist(err))
+
+	// netplan renders to systemd-networkd
+	assert.NoError(t, os.MkdirAll(filepath.Join(hostRoot, "etc/netplan"), 0755))
+	assert.NoError(t, configureNetworkDaemons(hostRoot, defaultVethPrefix, testPrimaryMAC, true))
+	veths, err := os.ReadFile(filepath.Join(hostRoot, networkdVethsPath))
+	assert.NoError(t, err)
+	assert.Contains(t, string(veths), "Name=eni* vlan*\n")
+	secondaryENIs, err := os.ReadFile(filepath.Join(hostRoot, networkdSecondaryENIPath))
+	assert.NoError(t, err)
+	assert.Contains(t, string(secondaryENIs), "MACAddress=!"+testPrimaryMAC+"\n")
+	assert.FileExists(t, filepath.Join(hostRoot, networkdConfigPath))
+	assert.NoFileExists(t, filepath.Join(hostRoot, nmConfigPath))
+
+	assert.NoError(t, os.MkdirAll(filepath.Join(hostRoot, "run/NetworkManager"), 0755))
+	assert.NoError(t, configureNetworkDaemons(hostRoot, "cali", testPrimaryMAC, true))
+	nm, err := os.ReadFile(filepath.Join(hostRoot, nmConfigPath))
+	assert.NoError(t, err)
+	assert.Equal(t, fileHeader+"[keyfile]\nunmanaged-devices=interface-name:cali*;interface-name:vlan*;driver:ena;driver:ixgbevf;except:mac:"+
+		testPrimaryMAC+"\n", string(nm))
+	veths, err = os.ReadFile(filepath.Join(hostRoot, networkdVethsPath))
+	assert.NoError(t, err)
+	assert.Contains(t, string(veths), "Name=cali* vlan*\n")
+
+	// Disabling removes the configuration
+	assert.NoError(t, configureNetworkDaemons(hostRoot, "cali", testPrimaryMAC, false))
+	for _, path := range []string{nmConfigPath, networkdVethsPath, networkdSecondaryENIPath, networkdConfigPath} {
+		assert.NoFileExists(t, filepath.Join(hostRoot, path))
+	}
+}
+
+func TestWriteFileIfChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "conf.d", "test.conf")
+
+	changed, err := writeFileIfChanged(path, []byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	changed, err = writeFileIfChanged(path, []byte("a"))
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	changed, err = writeFileIfChanged(path, []byte("b"))
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	content, _ := os.ReadFile(path)
+	assert.Equal(t, "b", string(content))
+}
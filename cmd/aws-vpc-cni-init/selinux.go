@@ -0,0 +1,85 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// envSELinuxRelabel relabels the host directories that aws-node writes to, so that a container confined by SELinux
+	// can write them
+	envSELinuxRelabel          = "ENABLE_SELINUX_RELABEL"
+	envSELinuxRelabelPaths     = "SELINUX_RELABEL_PATHS"
+	defaultSELinuxRelabel      = false
+	defaultSELinuxRelabelPaths = "/host/var/log/aws-routed-eni,/host/var/run/aws-node"
+
+	// containerFileLabel is the label of the files that confined containers can read and write
+	containerFileLabel = "system_u:object_r:container_file_t:s0"
+	selinuxXattr       = "security.selinux"
+)
+
+// setFileLabel sets the SELinux label of a file, without following symlinks
+func setFileLabel(path, label string) error {
+	// The label is NUL terminated, as libselinux writes it
+	return unix.Lsetxattr(path, selinuxXattr, []byte(label+"\x00"), 0)
+}
+
+// relabelPaths gives the label to the paths and everything under them. Missing paths are skipped, the kubelet creates
+// the hostPath directories before the init container runs. It is a no-op on hosts without SELinux.
+func relabelPaths(paths []string, label string, setLabel func(path, label string) error) error {
+	for _, root := range paths {
+		if _, err := os.Lstat(root); os.IsNotExist(err) {
+			log.Infof("Not relabeling %s, it does not exist", root)
+			continue
+		}
+		relabeled := 0
+		err := filepath.WalkDir(root, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := setLabel(path, label); err != nil {
+				return err
+			}
+			relabeled++
+			return nil
+		})
+		if errors.Is(err, unix.ENOTSUP) {
+			log.Infof("Not relabeling, SELinux is not enabled on the host")
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "failed to relabel %s", root)
+		}
+		log.Infof("Relabeled %d files under %s to %s", relabeled, root, label)
+	}
+	return nil
+}
+
+func selinuxRelabelPaths(value string) []string {
+	var paths []string
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+func TestRelabelPaths(t *testing.T) {
+	logDir := t.TempDir()
+	runDir := t.TempDir()
+	assert.NoError(t, os.MkdirAll(filepath.Join(runDir, "del-spool"), 0700))
+	assert.NoError(t, os.WriteFile(filepath.Join(runDir, "ipam.json"), []byte("{}"), 0644))
+	assert.NoError(t, os.WriteFile(filepath.Join(logDir, "ipamd.log"), nil, 0644))
+
+	labels := make(map[string]string)
+	setLabel := func(path, label string) error {
+		labels[path] = label
+		return nil
+	}
+	missing := filepath.Join(t.TempDir(), "missing")
+	assert.NoError(t, relabelPaths([]string{logDir, runDir, missing}, containerFileLabel, setLabel))
+	assert.Equal(t, map[string]string{
+		logDir:                             containerFileLabel,
+		filepath.Join(logDir, "ipamd.log"): containerFileLabel,
+		runDir:                             containerFileLabel,
+		filepath.Join(runDir, "del-spool"): containerFileLabel,
+		filepath.Join(runDir, "ipam.json"): containerFileLabel,
+	}, labels)
+
+	// Hosts without SELinux do not support the label
+	assert.NoError(t, relabelPaths([]string{logDir}, containerFileLabel, func(string, string) error { return unix.ENOTSUP }))
+	assert.Error(t, relabelPaths([]string{logDir}, containerFileLabel, func(string, string) error { return unix.EPERM }))
+}
+
+func TestSELinuxRelabelPaths(t *testing.T) {
+	assert.Equal(t, []string{"/host/var/log/aws-routed-eni", "/host/var/run/aws-node"},
+		selinuxRelabelPaths(defaultSELinuxRelabelPaths))
+	assert.Equal(t, []string{"/a", "/b"}, selinuxRelabelPaths(" /a,, /b "))
+}
@@ -0,0 +1,58 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// The aws-node network helper binary. It is the only aws-node container holding NET_ADMIN when ipamd runs with
+// ENABLE_NETWORK_HELPER, and programs routes, rules and iptables on behalf of ipamd.
+package main
+
+import (
+	"os"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkhelper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/version"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	// Environment variable for the unix socket to listen on
+	envNetworkHelperSocket = "NETWORK_HELPER_SOCKET"
+
+	// Environment variable for the UID that ipamd runs as. Connections from other UIDs are rejected.
+	envNetworkHelperClientUID = "NETWORK_HELPER_CLIENT_UID"
+)
+
+func main() {
+	os.Exit(_main())
+}
+
+func _main() int {
+	// Do not add anything before initializing logger
+	log := logger.Get()
+
+	log.Infof("Starting network helper %s ...", version.Version)
+
+	clientUID, err, input := utils.GetIntFromStringEnvVar(envNetworkHelperClientUID, 0)
+	if err != nil || clientUID < 0 {
+		log.Errorf("Invalid %s: %s", envNetworkHelperClientUID, input)
+		return 1
+	}
+	socketPath := utils.GetEnv(envNetworkHelperSocket, networkhelper.DefaultSocketPath)
+
+	if err := networkhelper.Serve(socketPath, uint32(clientUID), networkutils.New()); err != nil {
+		log.Errorf("%v", err)
+		return 1
+	}
+	return 0
+}
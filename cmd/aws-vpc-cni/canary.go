@@ -0,0 +1,246 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/cp"
+)
+
+const (
+	pluginBin       = "aws-cni"
+	canaryPluginBin = "aws-cni-canary"
+
+	defaultEnableCNICanary          = false
+	defaultCNICanaryAdds            = 5
+	defaultCNICanaryTimeoutSeconds  = 600
+	defaultIntrospectionBindAddress = "127.0.0.1:61679"
+	canaryPollInterval              = 5 * time.Second
+
+	envEnableCNICanary          = "ENABLE_CNI_CANARY_ROLLOUT"
+	envCNICanaryAdds            = "CNI_CANARY_SUCCESSFUL_ADDS"
+	envCNICanaryTimeoutSeconds  = "CNI_CANARY_TIMEOUT_SECONDS"
+	envIntrospectionBindAddress = "INTROSPECTION_BIND_ADDRESS"
+	envDisableIntrospection     = "DISABLE_INTROSPECTION"
+	envIntrospectionTokenFile   = "INTROSPECTION_BEARER_TOKEN_FILE"
+	envPreviousPluginVersion    = "AWS_VPC_K8S_CNI_PREVIOUS_PLUGIN_VERSION"
+
+	// pluginAboutPrefix prefixes the version the aws-cni binary prints when it is run without a CNI command
+	pluginAboutPrefix = "AWS CNI "
+)
+
+// cniAddStats mirrors the response of the ipamd /v1/cni-add-stats introspection endpoint. Only the ADDs of the plugin
+// of the same version as ipamd are used, ipamd keeps serving the previous aws-cni binary while the canary is verified.
+type cniAddStats struct {
+	CurrentPluginSucceeded int64 `json:"currentPluginSucceeded"`
+	CurrentPluginFailed    int64 `json:"currentPluginFailed"`
+}
+
+// canaryEnabled returns true when the new plugin binary should be rolled out as a canary. A canary is only
+// needed when a previous plugin binary is installed on the host to fall back to.
+func canaryEnabled(hostCNIBinPath string) bool {
+	if !utils.GetBoolAsStringEnvVar(envEnableCNICanary, defaultEnableCNICanary) {
+		return false
+	}
+	if _, err := os.Stat(hostCNIBinPath + "/" + pluginBin); err != nil {
+		log.Infof("No %s binary installed on the host, skipping canary rollout", pluginBin)
+		return false
+	}
+	return true
+}
+
+// getPluginVersion returns the version of the plugin binary at path
+func getPluginVersion(path string) (string, error) {
+	cmd := exec.Command(path)
+	cmd.Env = []string{}
+	// The binary exits with an error since no CNI command is set, but still prints its version
+	output, _ := cmd.CombinedOutput()
+	for _, line := range strings.Split(string(output), "\n") {
+		if strings.HasPrefix(line, pluginAboutPrefix) {
+			return strings.TrimSpace(strings.TrimPrefix(line, pluginAboutPrefix)), nil
+		}
+	}
+	return "", fmt.Errorf("failed to find version of %s in %q", path, output)
+}
+
+// setPluginType rewrites the type of the plugin named pluginName in the conflist at path, and updates its checksum.
+// The conflist is handled as generic JSON so that fields unknown to NetConf are preserved.
+func setPluginType(path, pluginName, pluginType string) error {
+	byteValue, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var conflist map[string]interface{}
+	if err := json.Unmarshal(byteValue, &conflist); err != nil {
+		return err
+	}
+	plugins, _ := conflist["plugins"].([]interface{})
+	found := false
+	for _, p := range plugins {
+		plugin, ok := p.(map[string]interface{})
+		if ok && plugin["name"] == pluginName {
+			plugin["type"] = pluginType
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("plugin %s not found in %s", pluginName, path)
+	}
+	byteValue, err = json.Marshal(conflist)
+	if err != nil {
+		return err
+	}
+	// The checksum has to be updated along with the plugin type
+	byteValue, err = cniutils.AddConflistChecksum(byteValue)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, byteValue, 0644)
+}
+
+// installConflist points the aws-cni plugin entry of the generated conflist at pluginType and atomically
+// replaces the conflist on the host with it
+func installConflist(tmpConflist, hostConflist, pluginType string) error {
+	if err := setPluginType(tmpConflist, pluginBin, pluginType); err != nil {
+		return errors.Wrapf(err, "failed to set plugin type to %s", pluginType)
+	}
+	return cp.CopyFile(tmpConflist, hostConflist)
+}
+
+// introspectionClient returns an HTTP client and base URL for the ipamd introspection endpoint
+func introspectionClient() (*http.Client, string) {
+	addr := utils.GetEnv(envIntrospectionBindAddress, defaultIntrospectionBindAddress)
+	client := &http.Client{Timeout: 5 * time.Second}
+	if strings.HasPrefix(addr, "unix:") {
+		socket := strings.TrimPrefix(addr, "unix:")
+		client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		}
+		return client, "http://localhost"
+	}
+	return client, "http://" + addr
+}
+
+// getCNIAddStats reads the CNI ADD counters from ipamd
+func getCNIAddStats() (*cniAddStats, error) {
+	client, baseURL := introspectionClient()
+	req, err := http.NewRequest(http.MethodGet, baseURL+"/v1/cni-add-stats", nil)
+	if err != nil {
+		return nil, err
+	}
+	if tokenFile := os.Getenv(envIntrospectionTokenFile); tokenFile != "" {
+		token, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the introspection bearer token file")
+		}
+		req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	stats := &cniAddStats{}
+	if err := json.NewDecoder(resp.Body).Decode(stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// verifyCanary waits until requiredAdds ADDs of the canary binary have succeeded since baseline was taken. It returns
+// an error as soon as an ADD of the canary fails, or when not enough ADDs succeeded before the timeout.
+func verifyCanary(getStats func() (*cniAddStats, error), baseline *cniAddStats, requiredAdds int64, timeout, interval time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		stats, err := getStats()
+		if err != nil {
+			log.WithError(err).Warn("Failed to get CNI ADD stats from ipamd")
+		} else {
+			if failed := stats.CurrentPluginFailed - baseline.CurrentPluginFailed; failed > 0 {
+				return fmt.Errorf("%d ADDs failed", failed)
+			}
+			if succeeded := stats.CurrentPluginSucceeded - baseline.CurrentPluginSucceeded; succeeded >= requiredAdds {
+				log.Infof("Canary %s binary completed %d successful ADDs", pluginBin, succeeded)
+				return nil
+			}
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for %d successful ADDs", requiredAdds)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// removeStaleCanary removes the canary binary left on the host by an aws-node that stopped before it promoted or rolled
+// back the canary. It is only called once the conflist no longer points at the canary binary.
+func removeStaleCanary(hostCNIBinPath string) {
+	canaryPath := hostCNIBinPath + "/" + canaryPluginBin
+	if err := os.Remove(canaryPath); err == nil {
+		log.Infof("Removed stale %s", canaryPath)
+	} else if !os.IsNotExist(err) {
+		log.WithError(err).Warnf("Failed to remove stale %s", canaryPath)
+	}
+}
+
+// runCanary verifies the canary plugin binary, then either promotes it to the aws-cni binary or rolls the conflist
+// back to the previously installed aws-cni binary. The canary binary is removed in both cases.
+func runCanary(hostCNIBinPath, tmpConflist, hostConflist string, baseline *cniAddStats) {
+	requiredAdds, err, _ := utils.GetIntFromStringEnvVar(envCNICanaryAdds, defaultCNICanaryAdds)
+	if err != nil {
+		requiredAdds = defaultCNICanaryAdds
+	}
+	timeoutSeconds, err, _ := utils.GetIntFromStringEnvVar(envCNICanaryTimeoutSeconds, defaultCNICanaryTimeoutSeconds)
+	if err != nil {
+		timeoutSeconds = defaultCNICanaryTimeoutSeconds
+	}
+
+	canaryPath := hostCNIBinPath + "/" + canaryPluginBin
+	err = verifyCanary(getCNIAddStats, baseline, int64(requiredAdds), time.Duration(timeoutSeconds)*time.Second, canaryPollInterval)
+	if err != nil {
+		log.WithError(err).Errorf("Canary %s binary failed verification, rolling back", pluginBin)
+	} else if err = cp.CopyFile(canaryPath, hostCNIBinPath+"/"+pluginBin); err != nil {
+		log.WithError(err).Errorf("Failed to promote canary %s binary, rolling back", pluginBin)
+	} else {
+		log.Infof("Promoted canary %s binary", pluginBin)
+	}
+
+	// Whether promoted or rolled back, the conflist goes back to the aws-cni binary
+	if err := installConflist(tmpConflist, hostConflist, pluginBin); err != nil {
+		log.WithError(err).Errorf("Failed to restore %s", hostConflist)
+		return
+	}
+	if err := os.Remove(canaryPath); err != nil {
+		log.WithError(err).Warnf("Failed to remove %s", canaryPath)
+	}
+}
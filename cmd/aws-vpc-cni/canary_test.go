@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
+)
+
+func TestSetPluginType(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "10-aws.conflist")
+	conflist := `{"cniVersion":"0.4.0","plugins":[{"name":"aws-cni","type":"aws-cni","mtu":"9001"},{"type":"portmap","snat":true}]}`
+	assert.NoError(t, os.WriteFile(path, []byte(conflist), 0644))
+
+	assert.NoError(t, setPluginType(path, pluginBin, canaryPluginBin))
+	byteValue, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var data map[string]interface{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	plugins := data["plugins"].([]interface{})
+	assert.Equal(t, canaryPluginBin, plugins[0].(map[string]interface{})["type"])
+	assert.Equal(t, "9001", plugins[0].(map[string]interface{})["mtu"])
+	// Fields unknown to NetConf are kept
+	assert.Equal(t, true, plugins[1].(map[string]interface{})["snat"])
+	assert.NoError(t, cniutils.VerifyConflistChecksum(byteValue))
+
+	assert.Error(t, setPluginType(path, "missing", canaryPluginBin))
+}
+
+func TestVerifyCanary(t *testing.T) {
+	baseline := &cniAddStats{CurrentPluginSucceeded: 10, CurrentPluginFailed: 1}
+	statsSequence := func(stats ...*cniAddStats) func() (*cniAddStats, error) {
+		i := 0
+		return func() (*cniAddStats, error) {
+			if i >= len(stats) {
+				return stats[len(stats)-1], nil
+			}
+			i++
+			if stats[i-1] == nil {
+				return nil, errors.New("introspection unavailable")
+			}
+			return stats[i-1], nil
+		}
+	}
+
+	// Enough ADDs succeed, including after a failure to reach ipamd
+	getStats := statsSequence(nil, &cniAddStats{CurrentPluginSucceeded: 11, CurrentPluginFailed: 1}, &cniAddStats{CurrentPluginSucceeded: 13, CurrentPluginFailed: 1})
+	assert.NoError(t, verifyCanary(getStats, baseline, 3, time.Second, time.Millisecond))
+
+	// An ADD fails
+	getStats = statsSequence(&cniAddStats{CurrentPluginSucceeded: 11, CurrentPluginFailed: 1}, &cniAddStats{CurrentPluginSucceeded: 12, CurrentPluginFailed: 2})
+	assert.Error(t, verifyCanary(getStats, baseline, 3, time.Second, time.Millisecond))
+
+	// Not enough ADDs before the timeout
+	getStats = statsSequence(&cniAddStats{CurrentPluginSucceeded: 11, CurrentPluginFailed: 1})
+	assert.Error(t, verifyCanary(getStats, baseline, 3, 10*time.Millisecond, time.Millisecond))
+}
+
+func TestRemoveStaleCanary(t *testing.T) {
+	dir := t.TempDir()
+	canaryPath := filepath.Join(dir, canaryPluginBin)
+	assert.NoError(t, os.WriteFile(canaryPath, []byte("binary"), 0755))
+
+	removeStaleCanary(dir)
+	_, err := os.Stat(canaryPath)
+	assert.True(t, os.IsNotExist(err))
+
+	// Nothing to remove
+	removeStaleCanary(dir)
+}
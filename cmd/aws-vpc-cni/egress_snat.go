@@ -0,0 +1,96 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	defaultV4EgressSNATSource = "primary"
+	envV4EgressSNATSource     = "V4_EGRESS_SNAT_SOURCE"
+
+	egressSNATIPRetries       = 10
+	egressSNATIPRetryInterval = time.Second
+)
+
+// egressSNATIP mirrors the response of the ipamd /v1/egress-snat-ip introspection endpoint
+type egressSNATIP struct {
+	IP     string `json:"ip"`
+	Source string `json:"source"`
+}
+
+// validEgressSNATSource returns whether source is one of the SNAT sources ipamd supports
+func validEgressSNATSource(source string) bool {
+	return source == "primary" || source == "secondary" || source == "eip"
+}
+
+// getEgressSNATIP reads the IPv4 address that ipamd picked for the egress-cni plugin to translate IPv4 egress to.
+// ipamd serves introspection alongside gRPC, so the endpoint may not be up yet when ipamd reports healthy.
+func getEgressSNATIP() (*egressSNATIP, error) {
+	client, baseURL := introspectionClient()
+	var err error
+	for i := 0; i < egressSNATIPRetries; i++ {
+		if i > 0 {
+			time.Sleep(egressSNATIPRetryInterval)
+		}
+		var resp *http.Response
+		resp, err = client.Get(baseURL + "/v1/egress-snat-ip")
+		if err != nil {
+			continue
+		}
+		snatIP := &egressSNATIP{}
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status %s", resp.Status)
+		} else {
+			err = json.NewDecoder(resp.Body).Decode(snatIP)
+		}
+		resp.Body.Close()
+		if err == nil {
+			return snatIP, nil
+		}
+	}
+	return nil, err
+}
+
+// egressNodeIPGetter returns the function generateJSON gets the node IPs of the egress-cni plugin from. With a SNAT
+// source other than the primary IP, the IPv4 address comes from ipamd, which picks it when it starts.
+func egressNodeIPGetter(getPrimaryIP func(ipv4 bool) (string, error), getEgressSNATIP func() (*egressSNATIP, error)) func(ipv4 bool) (string, error) {
+	if utils.GetEnv(envV4EgressSNATSource, defaultV4EgressSNATSource) == defaultV4EgressSNATSource {
+		return getPrimaryIP
+	}
+	return func(ipv4 bool) (string, error) {
+		if !ipv4 {
+			return getPrimaryIP(ipv4)
+		}
+		snatIP, err := getEgressSNATIP()
+		if err != nil {
+			log.WithError(err).Errorf("Failed to get the egress SNAT IP from ipamd")
+			return "", err
+		}
+		// ipamd falls back to the primary IP where the setting does not apply
+		if snatIP.IP == "" {
+			return getPrimaryIP(ipv4)
+		}
+		log.Infof("IPv4 egress is translated to %s (%s)", snatIP.IP, snatIP.Source)
+		return snatIP.IP, nil
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetEgressSNATIP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/egress-snat-ip", r.URL.Path)
+		_, _ = w.Write([]byte(`{"ip":"10.0.0.20","source":"secondary"}`))
+	}))
+	defer server.Close()
+	t.Setenv(envIntrospectionBindAddress, strings.TrimPrefix(server.URL, "http://"))
+
+	snatIP, err := getEgressSNATIP()
+	assert.NoError(t, err)
+	assert.Equal(t, &egressSNATIP{IP: "10.0.0.20", Source: "secondary"}, snatIP)
+}
+
+// Validate that the egress-cni plugin translates IPv4 egress to the address ipamd picked
+func TestGenerateJSONEgressSNATSource(t *testing.T) {
+	t.Setenv(envEnIPv6, "true")
+	snatIP := &egressSNATIP{IP: "10.0.0.20", Source: "secondary"}
+	getSNATIP := func() (*egressSNATIP, error) { return snatIP, nil }
+
+	// The primary IP is used by default, without asking ipamd
+	egressConf := generateEgressPluginConf(t, egressNodeIPGetter(getPrimaryIPMock, func() (*egressSNATIP, error) {
+		return nil, errors.New("introspection unavailable")
+	}))
+	assert.Equal(t, nodeIP, egressConf.V4Egress.NodeIP)
+
+	t.Setenv(envV4EgressSNATSource, "secondary")
+	egressConf = generateEgressPluginConf(t, egressNodeIPGetter(getPrimaryIPMock, getSNATIP))
+	assert.Equal(t, "10.0.0.20", egressConf.V4Egress.NodeIP)
+
+	// ipamd falls back to the primary IP when the setting does not apply
+	snatIP = &egressSNATIP{Source: "primary"}
+	egressConf = generateEgressPluginConf(t, egressNodeIPGetter(getPrimaryIPMock, getSNATIP))
+	assert.Equal(t, nodeIP, egressConf.V4Egress.NodeIP)
+}
+
+func TestValidateEgressSNATSource(t *testing.T) {
+	t.Setenv(envV4EgressSNATSource, "elastic")
+	assert.False(t, validateEnvVars())
+
+	t.Setenv(envV4EgressSNATSource, "eip")
+	assert.True(t, validateEnvVars())
+	t.Setenv(envDisableIntrospection, "true")
+	assert.False(t, validateEnvVars())
+}
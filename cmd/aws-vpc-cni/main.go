@@ -37,16 +37,22 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	log "github.com/sirupsen/logrus"
 
 	"github.com/containernetworking/cni/pkg/types"
 
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/featuregate"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
 	"github.com/aws/amazon-vpc-cni-k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/utils/cp"
@@ -59,10 +65,11 @@ const (
 	egressPluginIpamDstV6        = "::/0"
 	egressPluginIpamDataDirV4    = "/run/cni/v6pd/egress-v4-ipam"
 	egressPluginIpamDataDirV6    = "/run/cni/v4pd/egress-v6-ipam"
+	egressPluginNAT64Prefix      = "64:ff9b::/96"
 	defaultHostCniBinPath        = "/host/opt/cni/bin"
 	defaultHostCniConfDirPath    = "/host/etc/cni/net.d"
 	defaultAWSconflistFile       = "/app/10-aws.conflist"
-	tmpAWSconflistFile           = "/tmp/10-aws.conflist"
+	defaultConflistStagingDir    = "/tmp"
 	defaultVethPrefix            = "eni"
 	defaultMTU                   = 9001
 	minMTUv4                     = 576
@@ -73,9 +80,13 @@ const (
 	defaultEgressV4PluginLogFile = "/var/log/aws-routed-eni/egress-v4-plugin.log"
 	defaultEgressV6PluginLogFile = "/var/log/aws-routed-eni/egress-v6-plugin.log"
 	defaultPluginLogLevel        = "Debug"
+	defaultPluginLogMaxSize      = 100
+	defaultPluginLogMaxBackups   = 5
+	defaultPluginLogMaxAge       = 30
 	defaultEnableIPv6            = false
 	defaultEnableIPv6Egress      = false
 	defaultEnableIPv4Egress      = true
+	defaultEnableIPv4EgressNAT64 = false
 	defaultRandomizeSNAT         = "prng"
 	awsConflistFile              = "/10-aws.conflist"
 	vpcCniInitDonePath           = "/vpc-cni-init/done"
@@ -83,9 +94,12 @@ const (
 	defaultEnPrefixDelegation    = false
 	defaultIPCooldownPeriod      = 30
 	defaultDisablePodV6          = false
+	defaultEnPodRouteTables      = false
+	gwlbMaxMTU                   = 8500
 
 	envHostCniBinPath        = "HOST_CNI_BIN_PATH"
 	envHostCniConfDirPath    = "HOST_CNI_CONFDIR_PATH"
+	envConflistStagingDir    = "CNI_CONFLIST_STAGING_DIR"
 	envVethPrefix            = "AWS_VPC_K8S_CNI_VETHPREFIX"
 	envEniMTU                = "AWS_VPC_ENI_MTU"
 	envPodMTU                = "POD_MTU"
@@ -93,6 +107,9 @@ const (
 	envPodSGEnforcingMode    = "POD_SECURITY_GROUP_ENFORCING_MODE"
 	envPluginLogFile         = "AWS_VPC_K8S_PLUGIN_LOG_FILE"
 	envPluginLogLevel        = "AWS_VPC_K8S_PLUGIN_LOG_LEVEL"
+	envPluginLogMaxSize      = "AWS_VPC_K8S_PLUGIN_LOG_MAX_SIZE"
+	envPluginLogMaxBackups   = "AWS_VPC_K8S_PLUGIN_LOG_MAX_BACKUPS"
+	envPluginLogMaxAge       = "AWS_VPC_K8S_PLUGIN_LOG_MAX_AGE"
 	envEgressV4PluginLogFile = "AWS_VPC_K8S_EGRESS_V4_PLUGIN_LOG_FILE"
 	envEgressV6PluginLogFile = "AWS_VPC_K8S_EGRESS_V6_PLUGIN_LOG_FILE"
 	envEnPrefixDelegation    = "ENABLE_PREFIX_DELEGATION"
@@ -103,9 +120,12 @@ const (
 	envEnIPv6                = "ENABLE_IPv6"
 	envEnIPv6Egress          = "ENABLE_V6_EGRESS"
 	envEnIPv4Egress          = "ENABLE_V4_EGRESS"
+	envEnIPv4EgressNAT64     = "ENABLE_V4_EGRESS_NAT64"
 	envRandomizeSNAT         = "AWS_VPC_K8S_CNI_RANDOMIZESNAT"
 	envIPCooldownPeriod      = "IP_COOLDOWN_PERIOD"
 	envDisablePodV6          = "DISABLE_POD_V6"
+	envEnPodRouteTables      = "ENABLE_POD_ROUTE_TABLES"
+	envGWLBApplianceMode     = "ENABLE_GWLB_APPLIANCE_MODE"
 )
 
 // NetConfList describes an ordered list of networks.
@@ -139,6 +159,13 @@ type NetConf struct {
 	// IP to use as SNAT target
 	NodeIP net.IP `json:"nodeIP,omitempty"`
 
+	// NAT64 prefix that IPv4 egress goes through instead of SNAT to the node IP
+	NAT64Prefix string `json:"nat64Prefix,omitempty"`
+
+	// Egress of IPv6 pods to IPv4 endpoints and of IPv4 pods to IPv6 endpoints
+	V4Egress *EgressConf `json:"v4Egress,omitempty"`
+	V6Egress *EgressConf `json:"v6Egress,omitempty"`
+
 	VethPrefix string `json:"vethPrefix,omitempty"`
 
 	PodSGEnforcingMode string `json:"podSGEnforcingMode,omitempty"`
@@ -151,6 +178,29 @@ type NetConf struct {
 	PluginLogFile string `json:"pluginLogFile,omitempty"`
 
 	PluginLogLevel string `json:"pluginLogLevel,omitempty"`
+
+	PluginLogMaxSize string `json:"pluginLogMaxSize,omitempty"`
+
+	PluginLogMaxBackups string `json:"pluginLogMaxBackups,omitempty"`
+
+	PluginLogMaxAge string `json:"pluginLogMaxAge,omitempty"`
+
+	PodRouteTables string `json:"podRouteTables,omitempty"`
+
+	FeatureGates string `json:"featureGates,omitempty"`
+}
+
+// EgressConf stores the egress config of one IP family for the egress-cni plugin
+type EgressConf struct {
+	Enabled string `json:"enabled"`
+
+	// IP to use as SNAT target
+	NodeIP string `json:"nodeIP"`
+
+	// NAT64 prefix that IPv4 egress goes through instead of SNAT to the node IP
+	NAT64Prefix string `json:"nat64Prefix,omitempty"`
+
+	IPAM *IPAMConfig `json:"ipam,omitempty"`
 }
 
 // IPAMConfig references containernetworking structure defined at https://github.com/containernetworking/plugins/blob/main/plugins/ipam/host-local/backend/allocator/config.go
@@ -196,16 +246,31 @@ func getPrimaryIP(ipv4 bool) (string, error) {
 
 	hostIP, err = cniutils.GetNodeMetadata(imdsKey)
 	if err != nil {
-		if ipv4 {
+		// Nodes in IPv6-only subnets have no local-ipv4
+		if ipv4 && !isNotFound(err) {
 			log.WithError(err).Fatalf("failed to retrieve local-ipv4 address in imds metadata")
-		} else {
-			log.WithError(err).Debugf("failed to retrieve ipv6 address in imds metadata")
 		}
+		log.WithError(err).Debugf("failed to retrieve %s address in imds metadata", imdsKey)
 		return "", err
 	}
 	return hostIP, nil
 }
 
+// isNotFound returns whether instance metadata has no value for the key
+func isNotFound(err error) bool {
+	var reqErr awserr.RequestFailure
+	return errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound
+}
+
+// replaceSingleEgressPlaceholders replaces the placeholders of an egress-cni plugin entry configuring a single egress
+func replaceSingleEgressPlaceholders(netconf string, enabled bool, ipamSubnet, ipamDst, ipamDataDir, nodeIP string) string {
+	netconf = strings.Replace(netconf, "__EGRESSPLUGINENABLED__", strconv.FormatBool(enabled), -1)
+	netconf = strings.Replace(netconf, "__EGRESSPLUGINIPAMSUBNET__", ipamSubnet, -1)
+	netconf = strings.Replace(netconf, "__EGRESSPLUGINIPAMDST__", ipamDst, -1)
+	netconf = strings.Replace(netconf, "__EGRESSPLUGINIPAMDATADIR__", ipamDataDir, -1)
+	return strings.Replace(netconf, "__NODEIP__", nodeIP, -1)
+}
+
 func isValidJSON(inFile string) error {
 	var result map[string]interface{}
 	return json.Unmarshal([]byte(inFile), &result)
@@ -219,41 +284,42 @@ func generateJSON(jsonFile string, outFile string, getPrimaryIP func(ipv4 bool)
 	// enabledIPv6 is to determine if EKS cluster is IPv4 or IPv6 cluster
 	// if this EKS cluster is IPv6 cluster, egress-cni-plugin will enable IPv4 egress by default
 	// if this EKS cluster is IPv4 cluster, egress-cni-plugin will only enable IPv6 egress if env var "ENABLE_V6_EGRESS" is "true"
+	// Both egresses are configured in the same plugin entry, each with its own enabled flag
 	enabledIPv6 := utils.GetBoolAsStringEnvVar(envEnIPv6, defaultEnableIPv6)
-	var egressIPAMSubnet string
-	var egressIPAMDst string
-	var egressIPAMDataDir string
-	var egressEnabled bool
+	var egressV4Enabled, egressV6Enabled bool
 	var egressPluginLogFile string
-	var nodeIP = ""
+	var nodeIPv4, nodeIPv6, nat64Prefix string
 	if enabledIPv6 {
 		// EKS IPv6 cluster
-		egressIPAMSubnet = egressPluginIpamSubnetV4
-		egressIPAMDst = egressPluginIpamDstV4
-		egressIPAMDataDir = egressPluginIpamDataDirV4
 		// Enable IPv4 egress when "ENABLE_V4_EGRESS" is "true" (default)
-		egressEnabled = utils.GetBoolAsStringEnvVar(envEnIPv4Egress, defaultEnableIPv4Egress)
+		egressV4Enabled = utils.GetBoolAsStringEnvVar(envEnIPv4Egress, defaultEnableIPv4Egress)
 		egressPluginLogFile = utils.GetEnv(envEgressV4PluginLogFile, defaultEgressV4PluginLogFile)
-		nodeIP, err = getPrimaryIP(true)
-		// Node should have a IPv4 address even in IPv6 cluster
-		if err != nil {
-			log.Errorf("Failed to get Node IP, error: %v", err)
-			return err
+		if utils.GetBoolAsStringEnvVar(envEnIPv4EgressNAT64, defaultEnableIPv4EgressNAT64) {
+			// With NAT64, pods reach IPv4 endpoints over IPv6 through the NAT gateway of the subnet, so the node
+			// IPv4 address is not needed
+			nat64Prefix = egressPluginNAT64Prefix
+		} else {
+			nodeIPv4, err = getPrimaryIP(true)
+			if isNotFound(err) {
+				// Nodes in IPv6-only subnets have no IPv4 address to SNAT to, so IPv4 egress goes through NAT64
+				log.Warnf("The node has no IPv4 address, pods reach IPv4 endpoints through NAT64")
+				nat64Prefix = egressPluginNAT64Prefix
+			} else if err != nil {
+				log.Errorf("Failed to get Node IP, error: %v", err)
+				return err
+			}
 		}
 	} else {
 		// EKS IPv4 cluster
-		egressIPAMSubnet = egressPluginIpamSubnetV6
-		egressIPAMDst = egressPluginIpamDstV6
-		egressIPAMDataDir = egressPluginIpamDataDirV6
 		egressPluginLogFile = utils.GetEnv(envEgressV6PluginLogFile, defaultEgressV6PluginLogFile)
-		egressEnabled = utils.GetBoolAsStringEnvVar(envEnIPv6Egress, defaultEnableIPv6Egress)
-		if egressEnabled {
-			nodeIP, err = getPrimaryIP(false)
+		egressV6Enabled = utils.GetBoolAsStringEnvVar(envEnIPv6Egress, defaultEnableIPv6Egress)
+		if egressV6Enabled {
+			nodeIPv6, err = getPrimaryIP(false)
 			if err != nil {
 				// When ENABLE_V6_EGRESS is set, but the node is lacking an IPv6 address, log a warning and disable the egress-v6-cni plugin.
 				// This allows IPv4-only nodes to function while still alerting the customer to the possibility of a misconfiguration.
 				log.Warnf("To support IPv6 egress, node primary ENI must have a global IPv6 address, error: %v", err)
-				egressEnabled = false
+				egressV6Enabled = false
 			}
 		}
 	}
@@ -262,10 +328,23 @@ func generateJSON(jsonFile string, outFile string, getPrimaryIP func(ipv4 bool)
 	eniMTU := utils.GetEnv(envEniMTU, strconv.Itoa(defaultMTU))
 	// If pod MTU environment variable is set, overwrite ENI MTU.
 	podMTU := utils.GetEnv(envPodMTU, eniMTU)
+	if mtu, err := strconv.Atoi(podMTU); err == nil && mtu > gwlbMaxMTU && utils.GetBoolAsStringEnvVar(envGWLBApplianceMode, false) {
+		log.Infof("Capping the pod MTU %d to %d, the MTU of Gateway Load Balancers", mtu, gwlbMaxMTU)
+		podMTU = strconv.Itoa(gwlbMaxMTU)
+	}
 	podSGEnforcingMode := utils.GetEnv(envPodSGEnforcingMode, defaultPodSGEnforcingMode)
 	pluginLogFile := utils.GetEnv(envPluginLogFile, defaultPluginLogFile)
 	pluginLogLevel := utils.GetEnv(envPluginLogLevel, defaultPluginLogLevel)
+	pluginLogMaxSize := utils.GetEnv(envPluginLogMaxSize, strconv.Itoa(defaultPluginLogMaxSize))
+	pluginLogMaxBackups := utils.GetEnv(envPluginLogMaxBackups, strconv.Itoa(defaultPluginLogMaxBackups))
+	pluginLogMaxAge := utils.GetEnv(envPluginLogMaxAge, strconv.Itoa(defaultPluginLogMaxAge))
 	randomizeSNAT := utils.GetEnv(envRandomizeSNAT, defaultRandomizeSNAT)
+	podRouteTables := utils.GetBoolAsStringEnvVar(envEnPodRouteTables, defaultEnPodRouteTables)
+	// The plugins only get the valid gates, the others are reported once here
+	featureGates, errs := featuregate.FromEnv()
+	for _, err := range errs {
+		log.Warnf("%v", err)
+	}
 
 	netconf := string(byteValue)
 	netconf = strings.Replace(netconf, "__VETHPREFIX__", vethPrefix, -1)
@@ -273,13 +352,24 @@ func generateJSON(jsonFile string, outFile string, getPrimaryIP func(ipv4 bool)
 	netconf = strings.Replace(netconf, "__PODSGENFORCINGMODE__", podSGEnforcingMode, -1)
 	netconf = strings.Replace(netconf, "__PLUGINLOGFILE__", pluginLogFile, -1)
 	netconf = strings.Replace(netconf, "__PLUGINLOGLEVEL__", pluginLogLevel, -1)
+	netconf = strings.Replace(netconf, "__PLUGINLOGMAXSIZE__", pluginLogMaxSize, -1)
+	netconf = strings.Replace(netconf, "__PLUGINLOGMAXBACKUPS__", pluginLogMaxBackups, -1)
+	netconf = strings.Replace(netconf, "__PLUGINLOGMAXAGE__", pluginLogMaxAge, -1)
+	netconf = strings.Replace(netconf, "__PODROUTETABLES__", strconv.FormatBool(podRouteTables), -1)
+	netconf = strings.Replace(netconf, "__FEATUREGATES__", featureGates.String(), -1)
 	netconf = strings.Replace(netconf, "__EGRESSPLUGINLOGFILE__", egressPluginLogFile, -1)
-	netconf = strings.Replace(netconf, "__EGRESSPLUGINENABLED__", strconv.FormatBool(egressEnabled), -1)
-	netconf = strings.Replace(netconf, "__EGRESSPLUGINIPAMSUBNET__", egressIPAMSubnet, -1)
-	netconf = strings.Replace(netconf, "__EGRESSPLUGINIPAMDST__", egressIPAMDst, -1)
-	netconf = strings.Replace(netconf, "__EGRESSPLUGINIPAMDATADIR__", egressIPAMDataDir, -1)
+	netconf = strings.Replace(netconf, "__EGRESSPLUGINV4ENABLED__", strconv.FormatBool(egressV4Enabled), -1)
+	netconf = strings.Replace(netconf, "__EGRESSPLUGINV6ENABLED__", strconv.FormatBool(egressV6Enabled), -1)
 	netconf = strings.Replace(netconf, "__RANDOMIZESNAT__", randomizeSNAT, -1)
-	netconf = strings.Replace(netconf, "__NODEIP__", nodeIP, -1)
+	netconf = strings.Replace(netconf, "__NODEIPV4__", nodeIPv4, -1)
+	netconf = strings.Replace(netconf, "__NODEIPV6__", nodeIPv6, -1)
+	netconf = strings.Replace(netconf, "__EGRESSPLUGINNAT64PREFIX__", nat64Prefix, -1)
+	// Custom conflist templates may still configure the egress of the cluster IP family only
+	if enabledIPv6 {
+		netconf = replaceSingleEgressPlaceholders(netconf, egressV4Enabled, egressPluginIpamSubnetV4, egressPluginIpamDstV4, egressPluginIpamDataDirV4, nodeIPv4)
+	} else {
+		netconf = replaceSingleEgressPlaceholders(netconf, egressV6Enabled, egressPluginIpamSubnetV6, egressPluginIpamDstV6, egressPluginIpamDataDirV6, nodeIPv6)
+	}
 
 	byteValue = []byte(netconf)
 
@@ -328,6 +418,12 @@ func generateJSON(jsonFile string, outFile string, getPrimaryIP func(ipv4 bool)
 		log.Fatalf("%s is not a valid json object, error: %s", netconf, err)
 	}
 
+	// Embed a checksum so that ipamd can detect external modifications of the conflist
+	byteValue, err = cniutils.AddConflistChecksum(byteValue)
+	if err != nil {
+		return err
+	}
+
 	err = os.WriteFile(outFile, byteValue, 0644)
 	return err
 }
@@ -368,6 +464,53 @@ func validateEnvVars() bool {
 		return false
 	}
 
+	// Validate that the plugin log rotation settings are valid integers
+	for env, defaultValue := range map[string]int{
+		envPluginLogMaxSize:    defaultPluginLogMaxSize,
+		envPluginLogMaxBackups: defaultPluginLogMaxBackups,
+		envPluginLogMaxAge:     defaultPluginLogMaxAge,
+	} {
+		value, err, input := utils.GetIntFromStringEnvVar(env, defaultValue)
+		if err != nil || value < 0 {
+			log.Errorf("%s MUST be a valid non-negative integer. %s is invalid", env, input)
+			return false
+		}
+		// 0 keeps all the rotated files or keeps them regardless of their age, but the file has to be rotated at some size
+		if env == envPluginLogMaxSize && value == 0 {
+			log.Errorf("%s MUST be greater than 0", env)
+			return false
+		}
+	}
+
+	// Canary rollouts are verified through the ipamd introspection endpoint
+	if utils.GetBoolAsStringEnvVar(envEnableCNICanary, defaultEnableCNICanary) {
+		if utils.GetBoolAsStringEnvVar(envDisableIntrospection, false) {
+			log.Errorf("%s cannot be enabled when %s is set", envEnableCNICanary, envDisableIntrospection)
+			return false
+		}
+		for env, defaultValue := range map[string]int{
+			envCNICanaryAdds:           defaultCNICanaryAdds,
+			envCNICanaryTimeoutSeconds: defaultCNICanaryTimeoutSeconds,
+		} {
+			value, err, input := utils.GetIntFromStringEnvVar(env, defaultValue)
+			if err != nil || value <= 0 {
+				log.Errorf("%s MUST be a valid positive integer. %s is invalid", env, input)
+				return false
+			}
+		}
+	}
+
+	// The egress SNAT IP is read from the ipamd introspection endpoint
+	egressSNATSource := utils.GetEnv(envV4EgressSNATSource, defaultV4EgressSNATSource)
+	if !validEgressSNATSource(egressSNATSource) {
+		log.Errorf("%s must be set to either 'primary', 'secondary' or 'eip'", envV4EgressSNATSource)
+		return false
+	}
+	if egressSNATSource != defaultV4EgressSNATSource && utils.GetBoolAsStringEnvVar(envDisableIntrospection, false) {
+		log.Errorf("%s=%s cannot be set when %s is set", envV4EgressSNATSource, egressSNATSource, envDisableIntrospection)
+		return false
+	}
+
 	// Validate MTU value for ENIs and pods
 	if !validateMTU(envEniMTU) || !validateMTU(envPodMTU) {
 		return false
@@ -419,8 +562,24 @@ func _main() int {
 		return 1
 	}
 
-	pluginBins := []string{"aws-cni", "egress-cni"}
+	pluginBins := []string{pluginBin, "egress-cni"}
 	hostCNIBinPath := utils.GetEnv(envHostCniBinPath, defaultHostCniBinPath)
+	canary := canaryEnabled(hostCNIBinPath)
+	if canary {
+		// Install the new aws-cni binary alongside the one already on the host, which is kept until the canary is verified
+		previousVersion, err := getPluginVersion(hostCNIBinPath + "/" + pluginBin)
+		if err != nil {
+			log.WithError(err).Warnf("Failed to get version of the installed %s binary", pluginBin)
+		} else {
+			// Let ipamd keep serving the installed binary in case the canary is rolled back
+			_ = os.Setenv(envPreviousPluginVersion, previousVersion)
+		}
+		if err := cp.CopyFile(pluginBin, hostCNIBinPath+"/"+canaryPluginBin); err != nil {
+			log.WithError(err).Errorf("Failed to install %s", canaryPluginBin)
+			return 1
+		}
+		pluginBins = pluginBins[1:]
+	}
 	err := cp.InstallBinaries(pluginBins, hostCNIBinPath)
 	if err != nil {
 		log.WithError(err).Error("Failed to install CNI binaries")
@@ -441,6 +600,7 @@ func _main() int {
 		log.WithError(err).Errorf("Failed to execute command: %s", cmd)
 		return 1
 	}
+	go forwardShutdownSignals(ipamdDaemon.Process)
 
 	log.Infof("Checking for IPAM connectivity... ")
 	if !waitForIPAM() {
@@ -449,19 +609,41 @@ func _main() int {
 	}
 
 	log.Infof("Copying config file... ")
-	err = generateJSON(defaultAWSconflistFile, tmpAWSconflistFile, getPrimaryIP)
+	// The conflist is generated in a writable directory of the container, the root filesystem may be read-only
+	tmpAWSconflistFile := utils.GetEnv(envConflistStagingDir, defaultConflistStagingDir) + awsConflistFile
+	err = generateJSON(defaultAWSconflistFile, tmpAWSconflistFile, egressNodeIPGetter(getPrimaryIP, getEgressSNATIP))
 	if err != nil {
 		log.WithError(err).Errorf("Failed to generate 10-awsconflist")
 		return 1
 	}
 
 	hostCniConfDirPath := utils.GetEnv(envHostCniConfDirPath, defaultHostCniConfDirPath)
-	err = cp.CopyFile(tmpAWSconflistFile, hostCniConfDirPath+awsConflistFile)
-	if err != nil {
-		log.WithError(err).Errorf("Failed to copy %s", awsConflistFile)
-		return 1
+	hostConflist := hostCniConfDirPath + awsConflistFile
+	if canary {
+		// Only the ADDs of the new plugin version are counted, so ADDs of the old binary that complete after the
+		// baseline is taken cannot promote the canary
+		baseline, err := getCNIAddStats()
+		if err != nil {
+			log.WithError(err).Errorf("Failed to get CNI ADD stats from ipamd")
+			return 1
+		}
+		err = installConflist(tmpAWSconflistFile, hostConflist, canaryPluginBin)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to copy %s", awsConflistFile)
+			return 1
+		}
+		log.Infof("Installed canary %s binary, verifying it before promotion.", pluginBin)
+		go runCanary(hostCNIBinPath, tmpAWSconflistFile, hostConflist, baseline)
+	} else {
+		err = cp.CopyFile(tmpAWSconflistFile, hostConflist)
+		if err != nil {
+			log.WithError(err).Errorf("Failed to copy %s", awsConflistFile)
+			return 1
+		}
+		log.Infof("Successfully copied CNI plugin binary and config file.")
+		// The previous aws-node may have been stopped during a canary rollout, the conflist now points at aws-cni
+		removeStaleCanary(hostCNIBinPath)
 	}
-	log.Infof("Successfully copied CNI plugin binary and config file.")
 
 	err = ipamdDaemon.Wait()
 	if err != nil {
@@ -471,3 +653,16 @@ func _main() int {
 	log.Infof("IPAMD stopped hence exiting ...")
 	return 0
 }
+
+// forwardShutdownSignals passes SIGTERM and SIGINT on to the IPAM daemon, so that it shuts down gracefully rather than
+// being killed along with the entrypoint
+func forwardShutdownSignals(ipamd *os.Process) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, syscall.SIGINT)
+	for s := range sig {
+		log.Infof("Received %s, forwarding it to the IPAM daemon", s)
+		if err := ipamd.Signal(s); err != nil {
+			log.WithError(err).Warnf("Failed to forward %s to the IPAM daemon", s)
+		}
+	}
+}
@@ -1,10 +1,20 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/featuregate"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
 )
 
 const (
@@ -26,6 +36,16 @@ func TestGenerateJSON(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// Validate that the conflist generated by generateJSON carries a valid checksum
+func TestGenerateJSONChecksum(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "10-aws.conflist")
+	err := generateJSON(awsConflist, outFile, getPrimaryIPMock)
+	assert.NoError(t, err)
+	byteValue, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	assert.NoError(t, cniutils.VerifyConflistChecksum(byteValue))
+}
+
 // Validate that generateJSON runs without error when bandwidth plugin is added to the default conflist
 func TestGenerateJSONPlusBandwidth(t *testing.T) {
 	_ = os.Setenv(envEnBandwidthPlugin, "true")
@@ -48,6 +68,157 @@ func TestGenerateJSONPlusBandwidthAndTuning(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+// generateEgressPluginConf generates the conflist and returns the egress-cni plugin entry of it
+func generateEgressPluginConf(t *testing.T, getPrimaryIP func(ipv4 bool) (string, error)) *NetConf {
+	outFile := filepath.Join(t.TempDir(), "10-aws.conflist")
+	err := generateJSON(awsConflist, outFile, getPrimaryIP)
+	assert.NoError(t, err)
+
+	byteValue, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	data := NetConfList{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	assert.Equal(t, "egress-cni", data.Plugins[1].Type)
+	return data.Plugins[1]
+}
+
+// Validate that generateJSON configures the egress of both IP families in the egress-cni plugin entry
+func TestGenerateJSONEgress(t *testing.T) {
+	// IPv4 egress of the pods of an IPv6 cluster
+	t.Setenv(envEnIPv6, "true")
+	egressConf := generateEgressPluginConf(t, getPrimaryIPMock)
+	assert.Equal(t, "true", egressConf.V4Egress.Enabled)
+	assert.Equal(t, nodeIP, egressConf.V4Egress.NodeIP)
+	assert.Equal(t, "169.254.172.0/22", (*net.IPNet)(&egressConf.V4Egress.IPAM.Ranges[0][0].Subnet).String())
+	assert.Equal(t, "0.0.0.0/0", egressConf.V4Egress.IPAM.Routes[0].Dst.String())
+	assert.Equal(t, "/run/cni/v6pd/egress-v4-ipam", egressConf.V4Egress.IPAM.DataDir)
+	assert.Equal(t, "false", egressConf.V6Egress.Enabled)
+
+	// IPv6 egress of the pods of an IPv4 cluster
+	t.Setenv(envEnIPv6, "false")
+	t.Setenv(envEnIPv6Egress, "true")
+	egressConf = generateEgressPluginConf(t, getPrimaryIPMock)
+	assert.Equal(t, "false", egressConf.V4Egress.Enabled)
+	assert.Equal(t, "true", egressConf.V6Egress.Enabled)
+	assert.Equal(t, "2600::", egressConf.V6Egress.NodeIP)
+	assert.Equal(t, "/run/cni/v4pd/egress-v6-ipam", egressConf.V6Egress.IPAM.DataDir)
+}
+
+// Validate that generateJSON still fills in the templates configuring the egress of the cluster IP family only
+func TestGenerateJSONSingleEgressTemplate(t *testing.T) {
+	t.Setenv(envEnIPv6, "true")
+	template := filepath.Join(t.TempDir(), "10-aws.conflist")
+	assert.NoError(t, os.WriteFile(template, []byte(`{
+  "cniVersion": "0.4.0",
+  "name": "aws-cni",
+  "plugins": [
+    {"name": "aws-cni", "type": "aws-cni", "vethPrefix": "__VETHPREFIX__", "mtu": "__MTU__"},
+    {
+      "name": "egress-cni",
+      "type": "egress-cni",
+      "enabled": "__EGRESSPLUGINENABLED__",
+      "nodeIP": "__NODEIP__",
+      "ipam": {"type": "host-local", "ranges": [[{"subnet": "__EGRESSPLUGINIPAMSUBNET__"}]], "routes": [{"dst": "__EGRESSPLUGINIPAMDST__"}], "dataDir": "__EGRESSPLUGINIPAMDATADIR__"}
+    }
+  ]
+}`), 0644))
+	outFile := filepath.Join(t.TempDir(), "10-aws.conflist")
+	assert.NoError(t, generateJSON(template, outFile, getPrimaryIPMock))
+
+	byteValue, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	data := NetConfList{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	assert.Equal(t, "true", data.Plugins[1].Enabled)
+	assert.Equal(t, nodeIP, data.Plugins[1].NodeIP.String())
+	assert.Equal(t, egressPluginIpamDataDirV4, data.Plugins[1].IPAM.DataDir)
+}
+
+// Validate that generateJSON configures IPv4 egress through NAT64 in an IPv6 cluster, without the node IPv4 address
+func TestGenerateJSONNAT64(t *testing.T) {
+	t.Setenv(envEnIPv6, "true")
+	t.Setenv(envEnIPv4EgressNAT64, "true")
+	egressConf := generateEgressPluginConf(t, func(ipv4 bool) (string, error) {
+		return "", errors.New("no local-ipv4 in imds metadata")
+	})
+	assert.Equal(t, "true", egressConf.V4Egress.Enabled)
+	assert.Equal(t, egressPluginNAT64Prefix, egressConf.V4Egress.NAT64Prefix)
+	assert.Empty(t, egressConf.V4Egress.NodeIP)
+}
+
+// Validate that generateJSON configures IPv4 egress through NAT64 on IPv6-only nodes, which have no IPv4 address
+func TestGenerateJSONIPv6OnlyNode(t *testing.T) {
+	t.Setenv(envEnIPv6, "true")
+	egressConf := generateEgressPluginConf(t, func(ipv4 bool) (string, error) {
+		if ipv4 {
+			return "", fmt.Errorf("get instance metadata: failed to retrieve local-ipv4 - %w",
+				awserr.NewRequestFailure(awserr.New("EC2MetadataError", "not found", nil), http.StatusNotFound, ""))
+		}
+		return "2600::", nil
+	})
+	assert.Equal(t, "true", egressConf.V4Egress.Enabled)
+	assert.Equal(t, egressPluginNAT64Prefix, egressConf.V4Egress.NAT64Prefix)
+	assert.Empty(t, egressConf.V4Egress.NodeIP)
+
+	// Other failures to get the node IPv4 address are not mistaken for an IPv6-only node
+	err := generateJSON(awsConflist, filepath.Join(t.TempDir(), "10-aws.conflist"), func(ipv4 bool) (string, error) {
+		return "", errors.New("connection refused")
+	})
+	assert.Error(t, err)
+}
+
+// Validate that generateJSON passes the per-pod route table mode to the aws-cni plugin
+func TestGenerateJSONPodRouteTables(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "10-aws.conflist")
+	assert.NoError(t, generateJSON(awsConflist, outFile, getPrimaryIPMock))
+	byteValue, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	data := NetConfList{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	assert.Equal(t, "false", data.Plugins[0].PodRouteTables)
+
+	t.Setenv(envEnPodRouteTables, "true")
+	assert.NoError(t, generateJSON(awsConflist, outFile, getPrimaryIPMock))
+	byteValue, err = os.ReadFile(outFile)
+	assert.NoError(t, err)
+	data = NetConfList{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	assert.Equal(t, "true", data.Plugins[0].PodRouteTables)
+}
+
+// Validate that generateJSON passes the valid feature gates to the plugins
+func TestGenerateJSONFeatureGates(t *testing.T) {
+	t.Setenv(featuregate.EnvFeatureGates, "UnknownFeature=true,invalid")
+	outFile := filepath.Join(t.TempDir(), "10-aws.conflist")
+	assert.NoError(t, generateJSON(awsConflist, outFile, getPrimaryIPMock))
+	byteValue, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	data := NetConfList{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	assert.Equal(t, "", data.Plugins[0].FeatureGates)
+	assert.NotContains(t, string(byteValue), "__FEATUREGATES__")
+}
+
+// Validate that generateJSON caps the pod MTU in GWLB appliance mode
+func TestGenerateJSONGWLBApplianceMode(t *testing.T) {
+	t.Setenv(envGWLBApplianceMode, "true")
+	outFile := filepath.Join(t.TempDir(), "10-aws.conflist")
+	assert.NoError(t, generateJSON(awsConflist, outFile, getPrimaryIPMock))
+	byteValue, err := os.ReadFile(outFile)
+	assert.NoError(t, err)
+	data := NetConfList{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	assert.Equal(t, "8500", data.Plugins[0].MTU)
+
+	t.Setenv(envPodMTU, "1500")
+	assert.NoError(t, generateJSON(awsConflist, outFile, getPrimaryIPMock))
+	byteValue, err = os.ReadFile(outFile)
+	assert.NoError(t, err)
+	data = NetConfList{}
+	assert.NoError(t, json.Unmarshal(byteValue, &data))
+	assert.Equal(t, "1500", data.Plugins[0].MTU)
+}
+
 func TestMTUValidation(t *testing.T) {
 	// By default, ENI MTU and pod MTU should be valid
 	assert.True(t, validateMTU(envEniMTU))
@@ -0,0 +1,102 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Operator rolling out the CNIConfig onto the aws-node DaemonSet
+package main
+
+import (
+	"os"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/configoperator"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/version"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	leaderElectionID = "cni-config-operator.vpc.amazonaws.com"
+
+	// Environment variables locating the aws-node DaemonSet
+	envDaemonSetNamespace = "AWS_NODE_NAMESPACE"
+	envDaemonSetName      = "AWS_NODE_DAEMONSET"
+)
+
+func main() {
+	os.Exit(_main())
+}
+
+func _main() int {
+	log := logger.Get()
+	log.Infof("Starting CNI config operator %s ...", version.Version)
+	ctrl.SetLogger(zap.New())
+
+	namespace := utils.GetEnv(envDaemonSetNamespace, "kube-system")
+	restCfg, err := k8sapi.GetRestConfig()
+	if err != nil {
+		log.Errorf("Failed to get the Kubernetes client configuration: %v", err)
+		return 1
+	}
+	clientset, err := kubernetes.NewForConfig(restCfg)
+	if err != nil {
+		log.Errorf("Failed to create the Kubernetes clientset: %v", err)
+		return 1
+	}
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{corev1.AddToScheme, appsv1.AddToScheme, v1alpha1.AddToScheme} {
+		if err := addToScheme(scheme); err != nil {
+			log.Errorf("Failed to build the scheme: %v", err)
+			return 1
+		}
+	}
+	mgr, err := ctrl.NewManager(restCfg, ctrl.Options{
+		Scheme:  scheme,
+		Metrics: metricsserver.Options{BindAddress: "0"},
+		// Namespaced objects, the aws-node pods and DaemonSet, are only watched in the namespace of aws-node
+		Cache:                   cache.Options{DefaultNamespaces: map[string]cache.Config{namespace: {}}},
+		LeaderElection:          true,
+		LeaderElectionID:        leaderElectionID,
+		LeaderElectionNamespace: namespace,
+	})
+	if err != nil {
+		log.Errorf("Failed to create the controller manager: %v", err)
+		return 1
+	}
+
+	reconciler := &configoperator.Reconciler{
+		Client:        mgr.GetClient(),
+		ErrorCounter:  &configoperator.PodProxyErrorCounter{Clientset: clientset},
+		Namespace:     namespace,
+		DaemonSetName: utils.GetEnv(envDaemonSetName, "aws-node"),
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		log.Errorf("Failed to set up the CNIConfig controller: %v", err)
+		return 1
+	}
+
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		log.Errorf("Controller manager stopped: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -24,6 +24,7 @@ import (
 	"time"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/pflag"
 
 	"github.com/aws/amazon-vpc-cni-k8s/cmd/cni-metrics-helper/metrics"
@@ -40,6 +41,17 @@ const (
 
 	// Environment variable to enable the metrics endpoint on 61681
 	envEnablePrometheusMetrics = "USE_PROMETHEUS"
+
+	// Environment variable to export the metrics aggregated over the aws-node pods on the metrics endpoint on 61681
+	envEnablePrometheusExporter = "USE_PROMETHEUS_EXPORTER"
+
+	// Environment variable to read the metrics of the aws-node pods over https, when they serve them over TLS
+	envAWSNodeMetricsTLS = "AWS_NODE_METRICS_TLS"
+
+	// Environment variables to break the capacity metrics down by nodegroup and availability zone
+	envBreakdownNodegroupLabel = "BREAKDOWN_NODEGROUP_LABEL"
+	envBreakdownByAZ           = "BREAKDOWN_BY_AZ"
+	envBreakdownMaxGroups      = "BREAKDOWN_MAX_GROUPS"
 )
 
 var (
@@ -50,6 +62,7 @@ type options struct {
 	submitCW         bool
 	help             bool
 	submitPrometheus bool
+	exportPrometheus bool
 }
 
 func prometheusRegister() {
@@ -118,6 +131,17 @@ func main() {
 		}
 	}
 
+	prometheusExporterENV, found := os.LookupEnv(envEnablePrometheusExporter)
+	if found {
+		prometheusExporterENV = strings.ToLower(prometheusExporterENV)
+		if strings.Compare(prometheusExporterENV, "yes") == 0 || strings.Compare(prometheusExporterENV, "true") == 0 {
+			options.exportPrometheus = true
+		}
+		if strings.Compare(prometheusExporterENV, "no") == 0 || strings.Compare(prometheusExporterENV, "false") == 0 {
+			options.exportPrometheus = false
+		}
+	}
+
 	metricUpdateIntervalEnv, found := os.LookupEnv("METRIC_UPDATE_INTERVAL")
 	if !found {
 		metricUpdateIntervalEnv = "30"
@@ -128,6 +152,31 @@ func main() {
 		os.Exit(1)
 	}
 
+	var awsNodeMetricsTLS bool
+	if awsNodeMetricsTLSEnv, found := os.LookupEnv(envAWSNodeMetricsTLS); found {
+		awsNodeMetricsTLS, err = strconv.ParseBool(awsNodeMetricsTLSEnv)
+		if err != nil {
+			log.Fatalf("%s (%s) format invalid. Boolean required: %s", envAWSNodeMetricsTLS, awsNodeMetricsTLSEnv, err)
+		}
+	}
+
+	breakdown := metrics.BreakdownConfig{
+		NodegroupLabel: os.Getenv(envBreakdownNodegroupLabel),
+		MaxGroups:      metrics.DefaultBreakdownMaxGroups,
+	}
+	if breakdownByAZEnv, found := os.LookupEnv(envBreakdownByAZ); found {
+		breakdown.ByZone, err = strconv.ParseBool(breakdownByAZEnv)
+		if err != nil {
+			log.Fatalf("%s (%s) format invalid. Boolean required: %s", envBreakdownByAZ, breakdownByAZEnv, err)
+		}
+	}
+	if breakdownMaxGroupsEnv, found := os.LookupEnv(envBreakdownMaxGroups); found {
+		breakdown.MaxGroups, err = strconv.Atoi(breakdownMaxGroupsEnv)
+		if err != nil || breakdown.MaxGroups < 1 {
+			log.Fatalf("%s (%s) format invalid. Positive integer required: %v", envBreakdownMaxGroups, breakdownMaxGroupsEnv, err)
+		}
+	}
+
 	// Fetch region, if using IRSA it be will auto injected as env variable in pod spec
 	// If not found then it will be empty, in which case we will try to fetch it from IMDS (existing approach)
 	// This can also mean that Cx is not using IRSA and we shouldn't enforce IRSA requirement
@@ -136,7 +185,7 @@ func main() {
 	// should be name/identifier for the cluster if specified
 	clusterID, _ := os.LookupEnv("AWS_CLUSTER_ID")
 
-	log.Infof("Starting CNIMetricsHelper. Sending metrics to CloudWatch: %v, Prometheus: %v, LogLevel %s, metricUpdateInterval %d", options.submitCW, options.submitPrometheus, logConfig.LogLevel, metricUpdateInterval)
+	log.Infof("Starting CNIMetricsHelper. Sending metrics to CloudWatch: %v, Prometheus: %v, Prometheus exporter: %v, LogLevel %s, metricUpdateInterval %d, breakdown %+v", options.submitCW, options.submitPrometheus, options.exportPrometheus, logConfig.LogLevel, metricUpdateInterval, breakdown)
 
 	clientSet, err := k8sapi.GetKubeClientSet()
 	if err != nil {
@@ -162,13 +211,23 @@ func main() {
 		defer cw.Stop()
 	}
 
-	if options.submitPrometheus {
-		// Start prometheus server
-		go prometheusmetrics.ServeMetrics(metricsPort)
+	var exporter *metrics.Exporter
+	if options.exportPrometheus {
+		exporter = metrics.NewExporter()
+		prometheus.MustRegister(exporter)
+	}
+
+	if options.submitPrometheus || options.exportPrometheus {
+		// Start prometheus server, over TLS and with authentication if configured
+		metricsConfig, err := prometheusmetrics.GetServerSecurityConfig()
+		if err != nil {
+			log.Fatalf("Invalid metrics endpoint configuration: %v", err)
+		}
+		go prometheusmetrics.ServeMetrics(metricsPort, metricsConfig)
 	}
 
 	podWatcher := metrics.NewDefaultPodWatcher(k8sClient, log)
-	var cniMetric = metrics.CNIMetricsNew(clientSet, cw, options.submitCW, options.submitPrometheus, log, podWatcher)
+	var cniMetric = metrics.CNIMetricsNew(clientSet, cw, options.submitCW, options.submitPrometheus, log, podWatcher, breakdown, exporter, awsNodeMetricsTLS)
 
 	// metric loop
 	for range time.Tick(time.Duration(metricUpdateInterval) * time.Second) {
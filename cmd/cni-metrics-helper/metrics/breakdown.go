@@ -0,0 +1,173 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	dto "github.com/prometheus/client_model/go"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/publisher"
+)
+
+const (
+	nodegroupDimension        = "NODEGROUP"
+	availabilityZoneDimension = "AVAILABILITY_ZONE"
+
+	// unknownGroup is the group of the nodes without the label of a dimension
+	unknownGroup = "unknown"
+	// otherGroup is the group of the nodes of the groups beyond the maximum number of groups
+	otherGroup = "other"
+
+	// DefaultBreakdownMaxGroups is the default maximum number of groups of each broken down metric
+	DefaultBreakdownMaxGroups = 20
+)
+
+// BreakdownConfig selects the dimensions by which the capacity gauges are broken down, in addition to the cluster wide
+// metrics. The breakdown is disabled if no dimension is selected.
+type BreakdownConfig struct {
+	// NodegroupLabel is the node label whose value is the nodegroup dimension, such as eks.amazonaws.com/nodegroup
+	NodegroupLabel string
+	// ByZone adds the availability zone dimension, from the topology.kubernetes.io/zone node label
+	ByZone bool
+	// MaxGroups bounds the number of groups of each metric, the nodes of the other groups are summed in the "other"
+	// group, so that the number of CloudWatch metrics does not grow with the cluster
+	MaxGroups int
+}
+
+func (c BreakdownConfig) enabled() bool {
+	return c.NodegroupLabel != "" || c.ByZone
+}
+
+// metricsGroup is the nodegroup and availability zone of the nodes of a broken down metric, the fields of the
+// dimensions that are not selected are empty
+type metricsGroup struct {
+	nodegroup string
+	zone      string
+}
+
+func (g metricsGroup) dimensions() []*cloudwatch.Dimension {
+	var dimensions []*cloudwatch.Dimension
+	if g.nodegroup != "" {
+		dimensions = append(dimensions, &cloudwatch.Dimension{
+			Name:  aws.String(nodegroupDimension),
+			Value: aws.String(g.nodegroup),
+		})
+	}
+	if g.zone != "" {
+		dimensions = append(dimensions, &cloudwatch.Dimension{
+			Name:  aws.String(availabilityZoneDimension),
+			Value: aws.String(g.zone),
+		})
+	}
+	return dimensions
+}
+
+type groupPoints struct {
+	values map[metricsGroup]float64
+}
+
+// groupTargets returns the group of each target from the labels of the node of the target. Once there are more groups
+// than config.MaxGroups, the targets of the groups that sort last are put in the "other" group.
+func groupTargets(config BreakdownConfig, targets []string, targetLabels map[string]map[string]string) map[string]metricsGroup {
+	targetGroups := map[string]metricsGroup{}
+	groupSet := map[metricsGroup]bool{}
+	for _, target := range targets {
+		labels, ok := targetLabels[target]
+		if !ok {
+			continue
+		}
+		group := metricsGroup{}
+		if config.NodegroupLabel != "" {
+			group.nodegroup = labelOrUnknown(labels, config.NodegroupLabel)
+		}
+		if config.ByZone {
+			group.zone = labelOrUnknown(labels, corev1.LabelTopologyZone)
+		}
+		targetGroups[target] = group
+		groupSet[group] = true
+	}
+
+	if len(groupSet) <= config.MaxGroups {
+		return targetGroups
+	}
+	groups := make([]metricsGroup, 0, len(groupSet))
+	for group := range groupSet {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].nodegroup != groups[j].nodegroup {
+			return groups[i].nodegroup < groups[j].nodegroup
+		}
+		return groups[i].zone < groups[j].zone
+	})
+	other := metricsGroup{}
+	if config.NodegroupLabel != "" {
+		other.nodegroup = otherGroup
+	}
+	if config.ByZone {
+		other.zone = otherGroup
+	}
+	for _, group := range groups[config.MaxGroups:] {
+		groupSet[group] = false
+	}
+	for target, group := range targetGroups {
+		if !groupSet[group] {
+			targetGroups[target] = other
+		}
+	}
+	return targetGroups
+}
+
+func labelOrUnknown(labels map[string]string, key string) string {
+	if value := labels[key]; value != "" {
+		return value
+	}
+	return unknownGroup
+}
+
+// processGroupedGauges aggregates the gauges of a target in the group of the target
+func processGroupedGauges(family *dto.MetricFamily, convert metricsConvert, group metricsGroup) {
+	if family.GetType() != dto.MetricType_GAUGE {
+		return
+	}
+	for _, metric := range family.GetMetric() {
+		for _, act := range convert.actions {
+			if act.groups == nil || !act.matchFunc(metric) {
+				continue
+			}
+			value := act.groups.values[group]
+			act.actionFunc(&value, metric.GetGauge().GetValue())
+			act.groups.values[group] = value
+		}
+	}
+}
+
+func produceGroupedGauges(act metricsAction, cw publisher.Publisher) {
+	if act.groups == nil {
+		return
+	}
+	for group, value := range act.groups.values {
+		dataPoint := &cloudwatch.MetricDatum{
+			MetricName: aws.String(act.cwMetricName),
+			Dimensions: group.dimensions(),
+			Unit:       aws.String(cloudwatch.StandardUnitCount),
+			Value:      aws.Float64(value),
+		}
+		cw.Publish(dataPoint)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/publisher/mock_publisher"
+)
+
+const nodegroupLabel = "eks.amazonaws.com/nodegroup"
+
+func TestGroupTargets(t *testing.T) {
+	targetLabels := map[string]map[string]string{
+		"aws-node-1": {nodegroupLabel: "ng-a", "topology.kubernetes.io/zone": "us-west-2a"},
+		"aws-node-2": {nodegroupLabel: "ng-a", "topology.kubernetes.io/zone": "us-west-2b"},
+		"aws-node-3": {"topology.kubernetes.io/zone": "us-west-2b"},
+	}
+	targets := []string{"aws-node-1", "aws-node-2", "aws-node-3", "aws-node-4"}
+
+	config := BreakdownConfig{NodegroupLabel: nodegroupLabel, ByZone: true, MaxGroups: DefaultBreakdownMaxGroups}
+	assert.Equal(t, map[string]metricsGroup{
+		"aws-node-1": {nodegroup: "ng-a", zone: "us-west-2a"},
+		"aws-node-2": {nodegroup: "ng-a", zone: "us-west-2b"},
+		"aws-node-3": {nodegroup: unknownGroup, zone: "us-west-2b"},
+	}, groupTargets(config, targets, targetLabels))
+
+	config = BreakdownConfig{ByZone: true, MaxGroups: DefaultBreakdownMaxGroups}
+	assert.Equal(t, map[string]metricsGroup{
+		"aws-node-1": {zone: "us-west-2a"},
+		"aws-node-2": {zone: "us-west-2b"},
+		"aws-node-3": {zone: "us-west-2b"},
+	}, groupTargets(config, targets, targetLabels))
+}
+
+func TestGroupTargetsBoundsGroups(t *testing.T) {
+	targetLabels := map[string]map[string]string{
+		"aws-node-1": {nodegroupLabel: "ng-a"},
+		"aws-node-2": {nodegroupLabel: "ng-b"},
+		"aws-node-3": {nodegroupLabel: "ng-c"},
+		"aws-node-4": {nodegroupLabel: "ng-d"},
+	}
+	targets := []string{"aws-node-1", "aws-node-2", "aws-node-3", "aws-node-4"}
+
+	config := BreakdownConfig{NodegroupLabel: nodegroupLabel, MaxGroups: 2}
+	assert.Equal(t, map[string]metricsGroup{
+		"aws-node-1": {nodegroup: "ng-a"},
+		"aws-node-2": {nodegroup: "ng-b"},
+		"aws-node-3": {nodegroup: otherGroup},
+		"aws-node-4": {nodegroup: otherGroup},
+	}, groupTargets(config, targets, targetLabels))
+}
+
+func TestGroupedGauges(t *testing.T) {
+	// The metrics are not shared with the other tests, which check the deltas of the counters
+	interestingMetrics := map[string]metricsConvert{
+		"awscni_assigned_ip_addresses": {
+			actions: []metricsAction{
+				{cwMetricName: "assignIPAddresses",
+					matchFunc:  matchAny,
+					actionFunc: metricsAdd,
+					data:       &dataPoints{},
+					groups:     &groupPoints{}}}},
+		"awscni_ec2api_req_count": {
+			actions: []metricsAction{
+				{cwMetricName: "ec2ApiReqCount",
+					matchFunc:  matchAny,
+					actionFunc: metricsAdd,
+					data:       &dataPoints{}}}},
+	}
+	group := metricsGroup{nodegroup: "ng-a", zone: "us-west-2a"}
+	testTarget := newTestMetricsTarget("cni_test1.data", interestingMetrics)
+	testTarget.targetGroups = map[string]metricsGroup{"cni_test1.data": group}
+	_, _, _, err := metricsListGrabAggregateConvert(context.Background(), testTarget)
+	assert.NoError(t, err)
+
+	action := interestingMetrics["awscni_assigned_ip_addresses"].actions[0]
+	assert.Equal(t, 1.0, action.data.curSingleDataPoint)
+	assert.Equal(t, map[metricsGroup]float64{group: 1.0}, action.groups.values)
+
+	ctrl := gomock.NewController(t)
+	mockPublisher := mock_publisher.NewMockPublisher(ctrl)
+	mockPublisher.EXPECT().Publish(&cloudwatch.MetricDatum{
+		MetricName: aws.String("assignIPAddresses"),
+		Dimensions: []*cloudwatch.Dimension{
+			{Name: aws.String(nodegroupDimension), Value: aws.String("ng-a")},
+			{Name: aws.String(availabilityZoneDimension), Value: aws.String("us-west-2a")},
+		},
+		Unit:  aws.String(cloudwatch.StandardUnitCount),
+		Value: aws.Float64(1.0),
+	})
+	produceGroupedGauges(action, mockPublisher)
+
+	// Counters are not broken down
+	produceGroupedGauges(interestingMetrics["awscni_ec2api_req_count"].actions[0], mockPublisher)
+}
@@ -33,19 +33,22 @@ var InterestingCNIMetrics = map[string]metricsConvert{
 			{cwMetricName: "assignIPAddresses",
 				matchFunc:  matchAny,
 				actionFunc: metricsAdd,
-				data:       &dataPoints{}}}},
+				data:       &dataPoints{},
+				groups:     &groupPoints{}}}},
 	"awscni_total_ip_addresses": {
 		actions: []metricsAction{
 			{cwMetricName: "totalIPAddresses",
 				matchFunc:  matchAny,
 				actionFunc: metricsAdd,
-				data:       &dataPoints{}}}},
+				data:       &dataPoints{},
+				groups:     &groupPoints{}}}},
 	"awscni_total_ipv4_prefixes": {
 		actions: []metricsAction{
 			{cwMetricName: "totalIPv4Prefixes",
 				matchFunc:  matchAny,
 				actionFunc: metricsAdd,
-				data:       &dataPoints{}}}},
+				data:       &dataPoints{},
+				groups:     &groupPoints{}}}},
 	"awscni_assigned_ip_per_cidr": {
 		actions: []metricsAction{
 			{cwMetricName: "totalAssignedIPv4sPerCidr",
@@ -57,19 +60,22 @@ var InterestingCNIMetrics = map[string]metricsConvert{
 			{cwMetricName: "eniAllocated",
 				matchFunc:  matchAny,
 				actionFunc: metricsAdd,
-				data:       &dataPoints{}}}},
+				data:       &dataPoints{},
+				groups:     &groupPoints{}}}},
 	"awscni_eni_max": {
 		actions: []metricsAction{
 			{cwMetricName: "eniMaxAvailable",
 				matchFunc:  matchAny,
 				actionFunc: metricsAdd,
-				data:       &dataPoints{}}}},
+				data:       &dataPoints{},
+				groups:     &groupPoints{}}}},
 	"awscni_ip_max": {
 		actions: []metricsAction{
 			{cwMetricName: "maxIPAddresses",
 				matchFunc:  matchAny,
 				actionFunc: metricsAdd,
-				data:       &dataPoints{}}}},
+				data:       &dataPoints{},
+				groups:     &groupPoints{}}}},
 	"awscni_aws_api_latency_ms": {
 		actions: []metricsAction{
 			{cwMetricName: "awsAPILatency",
@@ -171,12 +177,15 @@ type CNIMetricsTarget struct {
 	podWatcher              *defaultPodWatcher
 	submitCW                bool
 	submitPrometheusMetrics bool
+	breakdown               BreakdownConfig
+	exporter                *Exporter
+	targetTLS               bool
 	log                     logger.Logger
 }
 
 // CNIMetricsNew creates a new metricsTarget
 func CNIMetricsNew(k8sClient kubernetes.Interface, cw publisher.Publisher, submitCW bool, submitPrometheus bool, l logger.Logger,
-	watcher *defaultPodWatcher) *CNIMetricsTarget {
+	watcher *defaultPodWatcher, breakdown BreakdownConfig, exporter *Exporter, targetTLS bool) *CNIMetricsTarget {
 	return &CNIMetricsTarget{
 		interestingMetrics:      InterestingCNIMetrics,
 		cwMetricsPublisher:      cw,
@@ -184,12 +193,15 @@ func CNIMetricsNew(k8sClient kubernetes.Interface, cw publisher.Publisher, submi
 		podWatcher:              watcher,
 		submitCW:                submitCW,
 		submitPrometheusMetrics: submitPrometheus,
+		breakdown:               breakdown,
+		exporter:                exporter,
+		targetTLS:               targetTLS,
 		log:                     l,
 	}
 }
 
 func (t *CNIMetricsTarget) grabMetricsFromTarget(ctx context.Context, cniPod string) ([]byte, error) {
-	output, err := getMetricsFromPod(ctx, t.kubeClient, cniPod, metav1.NamespaceSystem, metricsPort)
+	output, err := getMetricsFromPod(ctx, t.kubeClient, cniPod, metav1.NamespaceSystem, metricsPort, t.targetTLS)
 	if err != nil {
 		t.log.Errorf("grabMetricsFromTarget: Failed to grab CNI endpoint: %v", err)
 		return nil, err
@@ -215,6 +227,40 @@ func (t *CNIMetricsTarget) getTargetList(ctx context.Context) ([]string, error)
 	return pods, nil
 }
 
+// getTargetGroups reads the nodegroup and availability zone of the targets from the labels of their nodes
+func (t *CNIMetricsTarget) getTargetGroups(ctx context.Context, targets []string) (map[string]metricsGroup, error) {
+	if !t.breakdown.enabled() {
+		return nil, nil
+	}
+	podNodes, err := t.podWatcher.GetCNIPodNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	targetLabels := map[string]map[string]string{}
+	nodeLabels := map[string]map[string]string{}
+	for _, target := range targets {
+		nodeName, ok := podNodes[target]
+		if !ok || nodeName == "" {
+			continue
+		}
+		labels, ok := nodeLabels[nodeName]
+		if !ok {
+			labels, err = t.podWatcher.GetNodeLabels(ctx, nodeName)
+			if err != nil {
+				t.log.Warnf("Failed to get the labels of node %s: %v", nodeName, err)
+				continue
+			}
+			nodeLabels[nodeName] = labels
+		}
+		targetLabels[target] = labels
+	}
+	return groupTargets(t.breakdown, targets, targetLabels), nil
+}
+
+func (t *CNIMetricsTarget) getExporter() *Exporter {
+	return t.exporter
+}
+
 func (t *CNIMetricsTarget) submitCloudWatch() bool {
 	return t.submitCW
 }
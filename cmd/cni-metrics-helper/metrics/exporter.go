@@ -0,0 +1,179 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const (
+	// exportedMetricPrefix replaces the awscni_ prefix of the metrics of ipamd in the names of the exported metrics, so
+	// that they do not clash with the metrics of the aws-node pods when Prometheus also scrapes these
+	exportedMetricPrefix = "awscni_cluster_"
+	// groupedMetricSuffix is added to the names of the metrics broken down by nodegroup and availability zone
+	groupedMetricSuffix = "_by_group"
+)
+
+var (
+	exportedTargetsDesc = prometheus.NewDesc(exportedMetricPrefix+"targets",
+		"The number of aws-node pods found through the Kubernetes API in the last poll", nil, nil)
+	exportedScrapeErrorsDesc = prometheus.NewDesc(exportedMetricPrefix+"target_scrape_errors_total",
+		"The number of failed reads of the metrics of an aws-node pod", nil, nil)
+	groupLabels = []string{"nodegroup", "availability_zone"}
+)
+
+// exportedSeries identifies a metric of the Exporter
+type exportedSeries struct {
+	name      string
+	valueType prometheus.ValueType
+	grouped   bool
+	group     metricsGroup
+}
+
+// Exporter exposes the metrics aggregated over the aws-node pods of the cluster to Prometheus. It aggregates the
+// metrics of the targets of a poll on its own, since the counters of the CloudWatch metrics are deltas between polls,
+// and serves the values of the last complete poll.
+type Exporter struct {
+	lock         sync.RWMutex
+	pending      map[exportedSeries]float64
+	published    map[exportedSeries]float64
+	targets      int
+	scrapeErrors int
+}
+
+// NewExporter creates an Exporter, which must be registered with Prometheus to be served
+func NewExporter() *Exporter {
+	return &Exporter{
+		pending:   map[exportedSeries]float64{},
+		published: map[exportedSeries]float64{},
+	}
+}
+
+// Describe sends no descriptions, which makes the Exporter an unchecked collector, since its metrics depend on the
+// metrics that the aws-node pods report
+func (e *Exporter) Describe(ch chan<- *prometheus.Desc) {
+}
+
+// Collect sends the metrics of the last complete poll
+func (e *Exporter) Collect(ch chan<- prometheus.Metric) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+
+	ch <- prometheus.MustNewConstMetric(exportedTargetsDesc, prometheus.GaugeValue, float64(e.targets))
+	ch <- prometheus.MustNewConstMetric(exportedScrapeErrorsDesc, prometheus.CounterValue, float64(e.scrapeErrors))
+	for series, value := range e.published {
+		if !series.grouped {
+			desc := prometheus.NewDesc(series.name, series.name+" aggregated over the aws-node pods of the cluster",
+				nil, nil)
+			ch <- prometheus.MustNewConstMetric(desc, series.valueType, value)
+			continue
+		}
+		desc := prometheus.NewDesc(series.name+groupedMetricSuffix,
+			series.name+" aggregated over the aws-node pods of each nodegroup and availability zone", groupLabels, nil)
+		ch <- prometheus.MustNewConstMetric(desc, series.valueType, value, series.group.nodegroup, series.group.zone)
+	}
+}
+
+// begin starts the aggregation of a poll. The methods of a nil Exporter do nothing, so that the metrics targets without
+// an Exporter need no checks.
+func (e *Exporter) begin() {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.pending = map[exportedSeries]float64{}
+}
+
+// add aggregates a metric family of a target
+func (e *Exporter) add(family *dto.MetricFamily, convert metricsConvert, group metricsGroup, grouped bool) {
+	if e == nil {
+		return
+	}
+	var valueType prometheus.ValueType
+	switch family.GetType() {
+	case dto.MetricType_COUNTER:
+		valueType = prometheus.CounterValue
+	case dto.MetricType_GAUGE, dto.MetricType_SUMMARY:
+		valueType = prometheus.GaugeValue
+	default:
+		return
+	}
+	name := exportedMetricPrefix + strings.TrimPrefix(family.GetName(), "awscni_")
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, metric := range family.GetMetric() {
+		sample := sampleValue(family.GetType(), metric)
+		for _, act := range convert.actions {
+			if !act.matchFunc(metric) {
+				continue
+			}
+			series := exportedSeries{name: name, valueType: valueType}
+			value := e.pending[series]
+			act.actionFunc(&value, sample)
+			e.pending[series] = value
+
+			if grouped && act.groups != nil && family.GetType() == dto.MetricType_GAUGE {
+				series = exportedSeries{name: name, valueType: valueType, grouped: true, group: group}
+				value = e.pending[series]
+				act.actionFunc(&value, sample)
+				e.pending[series] = value
+			}
+		}
+	}
+}
+
+// scrapeFailed counts a target whose metrics could not be read
+func (e *Exporter) scrapeFailed() {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.scrapeErrors++
+}
+
+// commit publishes the metrics of the poll
+func (e *Exporter) commit(targets int) {
+	if e == nil {
+		return
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.published = e.pending
+	e.pending = map[exportedSeries]float64{}
+	e.targets = targets
+}
+
+// sampleValue returns the value of a metric, the 99th percentile for summaries
+func sampleValue(metricType dto.MetricType, metric *dto.Metric) float64 {
+	switch metricType {
+	case dto.MetricType_COUNTER:
+		return metric.GetCounter().GetValue()
+	case dto.MetricType_SUMMARY:
+		for _, q := range metric.GetSummary().GetQuantile() {
+			if q.GetQuantile() == 0.99 {
+				return q.GetValue()
+			}
+		}
+		return 0
+	default:
+		return metric.GetGauge().GetValue()
+	}
+}
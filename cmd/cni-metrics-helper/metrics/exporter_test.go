@@ -0,0 +1,96 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExporter(t *testing.T) {
+	// The metrics are not shared with the other tests, which check the deltas of the counters
+	interestingMetrics := map[string]metricsConvert{
+		"awscni_assigned_ip_addresses": {
+			actions: []metricsAction{
+				{cwMetricName: "assignIPAddresses",
+					matchFunc:  matchAny,
+					actionFunc: metricsAdd,
+					data:       &dataPoints{},
+					groups:     &groupPoints{}}}},
+		"awscni_ec2api_req_count": {
+			actions: []metricsAction{
+				{cwMetricName: "ec2ApiReqCount",
+					matchFunc:  matchAny,
+					actionFunc: metricsAdd,
+					data:       &dataPoints{}}}},
+	}
+	exporter := NewExporter()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(exporter)
+
+	testTarget := newTestMetricsTarget("cni_test1.data", interestingMetrics)
+	testTarget.targetGroups = map[string]metricsGroup{"cni_test1.data": {nodegroup: "ng-a", zone: "us-west-2a"}}
+	testTarget.exporter = exporter
+	_, _, _, err := metricsListGrabAggregateConvert(context.Background(), testTarget)
+	assert.NoError(t, err)
+
+	expected := `
+# HELP awscni_cluster_assigned_ip_addresses awscni_cluster_assigned_ip_addresses aggregated over the aws-node pods of the cluster
+# TYPE awscni_cluster_assigned_ip_addresses gauge
+awscni_cluster_assigned_ip_addresses 1
+# HELP awscni_cluster_assigned_ip_addresses_by_group awscni_cluster_assigned_ip_addresses aggregated over the aws-node pods of each nodegroup and availability zone
+# TYPE awscni_cluster_assigned_ip_addresses_by_group gauge
+awscni_cluster_assigned_ip_addresses_by_group{availability_zone="us-west-2a",nodegroup="ng-a"} 1
+# HELP awscni_cluster_ec2api_req_count awscni_cluster_ec2api_req_count aggregated over the aws-node pods of the cluster
+# TYPE awscni_cluster_ec2api_req_count counter
+awscni_cluster_ec2api_req_count 21
+# HELP awscni_cluster_target_scrape_errors_total The number of failed reads of the metrics of an aws-node pod
+# TYPE awscni_cluster_target_scrape_errors_total counter
+awscni_cluster_target_scrape_errors_total 0
+# HELP awscni_cluster_targets The number of aws-node pods found through the Kubernetes API in the last poll
+# TYPE awscni_cluster_targets gauge
+awscni_cluster_targets 1
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+
+	// The values are not accumulated over polls
+	_, _, _, err = metricsListGrabAggregateConvert(context.Background(), testTarget)
+	assert.NoError(t, err)
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+}
+
+func TestExporterScrapeErrors(t *testing.T) {
+	exporter := NewExporter()
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(exporter)
+
+	exporter.begin()
+	exporter.scrapeFailed()
+	exporter.commit(2)
+
+	expected := `
+# HELP awscni_cluster_target_scrape_errors_total The number of failed reads of the metrics of an aws-node pod
+# TYPE awscni_cluster_target_scrape_errors_total counter
+awscni_cluster_target_scrape_errors_total 1
+# HELP awscni_cluster_targets The number of aws-node pods found through the Kubernetes API in the last poll
+# TYPE awscni_cluster_targets gauge
+awscni_cluster_targets 2
+`
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected)))
+}
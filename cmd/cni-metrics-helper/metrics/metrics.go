@@ -39,6 +39,10 @@ type metricsTarget interface {
 	getInterestingMetrics() map[string]metricsConvert
 	getCWMetricsPublisher() publisher.Publisher
 	getTargetList(ctx context.Context) ([]string, error)
+	// getTargetGroups returns the group of each target whose metrics are also broken down by group
+	getTargetGroups(ctx context.Context, targets []string) (map[string]metricsGroup, error)
+	// getExporter returns the Exporter of the aggregated metrics, nil if they are not exported
+	getExporter() *Exporter
 	submitCloudWatch() bool
 	submitPrometheus() bool
 	getLogger() logger.Logger
@@ -54,7 +58,9 @@ type metricsAction struct {
 	actionFunc   actionFuncType
 	data         *dataPoints
 	bucket       *bucketPoints
-	logToFile    bool
+	// groups is set for the gauges that are also broken down by nodegroup and availability zone
+	groups    *groupPoints
+	logToFile bool
 }
 
 type dataPoints struct {
@@ -86,12 +92,18 @@ func metricsMax(aggregatedValue *float64, sampleValue float64) {
 	}
 }
 
-func getMetricsFromPod(ctx context.Context, k8sClient kubernetes.Interface, podName string, namespace string, port int) ([]byte, error) {
+// getMetricsFromPod reads the metrics of a pod through the API server proxy, over https if useTLS is set. The API
+// server does not verify the certificate of the pod, nor forward the credentials of the request.
+func getMetricsFromPod(ctx context.Context, k8sClient kubernetes.Interface, podName string, namespace string, port int, useTLS bool) ([]byte, error) {
+	name := fmt.Sprintf("%v:%v", podName, port)
+	if useTLS {
+		name = "https:" + name
+	}
 	rawOutput, err := k8sClient.CoreV1().RESTClient().Get().
 		Namespace(namespace).
 		Resource("pods").
 		SubResource("proxy").
-		Name(fmt.Sprintf("%v:%v", podName, port)).
+		Name(name).
 		Suffix("metrics").
 		Do(ctx).Raw()
 
@@ -335,6 +347,7 @@ func produceCloudWatchMetrics(t metricsTarget, families map[string]*dto.MetricFa
 					Value:      aws.Float64(action.data.curSingleDataPoint),
 				}
 				cw.Publish(dataPoint)
+				produceGroupedGauges(action, cw)
 			case dto.MetricType_SUMMARY:
 				dataPoint := &cloudwatch.MetricDatum{
 					MetricName: aws.String(action.cwMetricName),
@@ -382,6 +395,10 @@ func resetMetrics(interestingMetrics map[string]metricsConvert) {
 			if act.bucket != nil {
 				act.bucket.curBucket = make([]*bucketPoint, 0)
 			}
+
+			if act.groups != nil {
+				act.groups.values = map[metricsGroup]float64{}
+			}
 		}
 	}
 }
@@ -395,10 +412,18 @@ func metricsListGrabAggregateConvert(ctx context.Context, t metricsTarget) (map[
 
 	targetList, _ := t.getTargetList(ctx)
 	t.getLogger().Debugf("Total TargetList pod count: %d", len(targetList))
+	targetGroups, err := t.getTargetGroups(ctx, targetList)
+	if err != nil {
+		// The cluster wide metrics are still produced
+		t.getLogger().Warnf("Failed to get the groups of the metric targets: %v", err)
+	}
+	exporter := t.getExporter()
+	exporter.begin()
 	for _, target := range targetList {
 		rawOutput, err := t.grabMetricsFromTarget(ctx, target)
 		if err != nil {
 			// it may take times to remove some metric targets
+			exporter.scrapeFailed()
 			continue
 		}
 
@@ -423,8 +448,14 @@ func metricsListGrabAggregateConvert(ctx context.Context, t metricsTarget) (map[
 			if curReset {
 				resetDetected = true
 			}
+			group, grouped := targetGroups[target]
+			if grouped {
+				processGroupedGauges(family, convert, group)
+			}
+			exporter.add(family, convert, group, grouped)
 		}
 	}
+	exporter.commit(len(targetList))
 
 	// TODO resetDetected is NOT right for cniMetrics, so force it for now
 	if len(targetList) > 1 {
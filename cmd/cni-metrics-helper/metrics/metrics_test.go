@@ -27,6 +27,8 @@ import (
 type testMetricsTarget struct {
 	metricFile         string
 	interestingMetrics map[string]metricsConvert
+	targetGroups       map[string]metricsGroup
+	exporter           *Exporter
 }
 
 func (target *testMetricsTarget) getLogger() logger.Logger {
@@ -57,6 +59,14 @@ func (target *testMetricsTarget) getTargetList(ctx context.Context) ([]string, e
 	return []string{target.metricFile}, nil
 }
 
+func (target *testMetricsTarget) getTargetGroups(ctx context.Context, targets []string) (map[string]metricsGroup, error) {
+	return target.targetGroups, nil
+}
+
+func (target *testMetricsTarget) getExporter() *Exporter {
+	return target.exporter
+}
+
 func (target *testMetricsTarget) submitCloudWatch() bool {
 	return false
 }
@@ -5,6 +5,7 @@ import (
 
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
@@ -31,6 +32,43 @@ func NewDefaultPodWatcher(k8sClient client.Client, log logger.Logger) *defaultPo
 // and so the function has to be updated if the CNI pod name format changes.
 func (d *defaultPodWatcher) GetCNIPods(ctx context.Context) ([]string, error) {
 	var CNIPods []string
+	podList, err := d.listCNIPods(ctx)
+	if err != nil {
+		return CNIPods, err
+	}
+
+	for _, pod := range podList.Items {
+		CNIPods = append(CNIPods, pod.Name)
+	}
+
+	d.log.Infof("Total aws-node pod count: %d", len(CNIPods))
+	return CNIPods, nil
+}
+
+// GetCNIPodNodes returns the node of each aws-node pod
+func (d *defaultPodWatcher) GetCNIPodNodes(ctx context.Context) (map[string]string, error) {
+	podList, err := d.listCNIPods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	podNodes := map[string]string{}
+	for _, pod := range podList.Items {
+		podNodes[pod.Name] = pod.Spec.NodeName
+	}
+	return podNodes, nil
+}
+
+// GetNodeLabels returns the labels of the node
+func (d *defaultPodWatcher) GetNodeLabels(ctx context.Context, nodeName string) (map[string]string, error) {
+	var node corev1.Node
+	if err := d.k8sClient.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+		return nil, err
+	}
+	return node.Labels, nil
+}
+
+func (d *defaultPodWatcher) listCNIPods(ctx context.Context) (*corev1.PodList, error) {
 	var podList corev1.PodList
 	labelSelector, err := metav1.LabelSelectorAsSelector(&metav1.LabelSelector{
 		MatchLabels: map[string]string{
@@ -49,13 +87,7 @@ func (d *defaultPodWatcher) GetCNIPods(ctx context.Context) ([]string, error) {
 
 	err = d.k8sClient.List(ctx, &podList, &listOptions)
 	if err != nil {
-		return CNIPods, err
+		return nil, err
 	}
-
-	for _, pod := range podList.Items {
-		CNIPods = append(CNIPods, pod.Name)
-	}
-
-	d.log.Infof("Total aws-node pod count: %d", len(CNIPods))
-	return CNIPods, nil
+	return &podList, nil
 }
@@ -49,17 +49,20 @@ const (
 
 // egressContext includes all info to run container ADD or DEL action
 type egressContext struct {
-	Procsys       procsyswrapper.ProcSys
-	Ipam          hostipamwrapper.HostIpam
-	Link          netlinkwrapper.NetLink
-	Ns            nswrapper.NS
-	NsPath        string
-	ArgsIfName    string
-	Veth          vethwrapper.Veth
-	IPTablesIface iptableswrapper.IPTablesIface
-	IptCreator    func(iptables.Protocol) (iptableswrapper.IPTablesIface, error)
-
-	NetConf   *NetConf
+	Procsys    procsyswrapper.ProcSys
+	Ipam       hostipamwrapper.HostIpam
+	Link       netlinkwrapper.NetLink
+	Ns         nswrapper.NS
+	NsPath     string
+	ArgsIfName string
+	Veth       vethwrapper.Veth
+	// IPTables holds the iptables and ip6tables handles shared by the egresses of both IP families
+	IPTables   map[iptables.Protocol]iptableswrapper.IPTablesIface
+	IptCreator func(iptables.Protocol) (iptableswrapper.IPTablesIface, error)
+
+	NetConf *NetConf
+	// Egress is the egress being set up or torn down
+	Egress    *EgressConf
 	Result    *current.Result
 	TmpResult *current.Result
 	Log       logger.Logger
@@ -100,6 +103,22 @@ func NewEgressDelContext(nsPath string) egressContext {
 	}
 }
 
+// iptables returns the iptables handle of the protocol, which the egresses of both IP families share
+func (ec *egressContext) iptables(protocol iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+	if ipt, ok := ec.IPTables[protocol]; ok {
+		return ipt, nil
+	}
+	ipt, err := ec.IptCreator(protocol)
+	if err != nil {
+		return nil, err
+	}
+	if ec.IPTables == nil {
+		ec.IPTables = map[iptables.Protocol]iptableswrapper.IPTablesIface{}
+	}
+	ec.IPTables[protocol] = ipt
+	return ipt, nil
+}
+
 func (ec *egressContext) setupContainerVethV4() (*current.Interface, *current.Interface, error) {
 	// The IPAM result will be something like IP=192.168.3.5/24, GW=192.168.3.1.
 	// What we want is really a point-to-point link but veth does not support IFF_POINTTOPOINT.
@@ -117,7 +136,7 @@ func (ec *egressContext) setupContainerVethV4() (*current.Interface, *current.In
 
 	err := ec.Ns.WithNetNSPath(ec.NsPath, func(hostNS ns.NetNS) error {
 		// Empty veth MAC is passed
-		hostVeth, contVeth0, err := ec.Veth.Setup(ec.NetConf.IfName, ec.Mtu, "", hostNS)
+		hostVeth, contVeth0, err := ec.Veth.Setup(ec.Egress.ifName(), ec.Mtu, "", hostNS)
 		if err != nil {
 			return err
 		}
@@ -133,13 +152,13 @@ func (ec *egressContext) setupContainerVethV4() (*current.Interface, *current.In
 		}
 		ec.TmpResult.Interfaces = []*current.Interface{hostInterface, containerInterface}
 
-		if err = ec.Ipam.ConfigureIface(ec.NetConf.IfName, ec.TmpResult); err != nil {
+		if err = ec.Ipam.ConfigureIface(ec.Egress.ifName(), ec.TmpResult); err != nil {
 			return err
 		}
 
-		contVeth, err := ec.Link.LinkByName(ec.NetConf.IfName)
+		contVeth, err := ec.Link.LinkByName(ec.Egress.ifName())
 		if err != nil {
-			return fmt.Errorf("failed to look up %q: %v", ec.NetConf.IfName, err)
+			return fmt.Errorf("failed to look up %q: %v", ec.Egress.ifName(), err)
 		}
 
 		for _, ipc := range ec.TmpResult.IPs {
@@ -241,11 +260,10 @@ func (ec *egressContext) setupHostVethV4(vethName string) error {
 
 // cmdAddEgressV4 exec necessary settings to support IPv4 egress traffic in EKS IPv6 cluster
 func (ec *egressContext) cmdAddEgressV4() (err error) {
-	if ec.IPTablesIface == nil {
-		if ec.IPTablesIface, err = ec.IptCreator(iptables.ProtocolIPv4); err != nil {
-			ec.Log.Error("command iptables not found")
-			return err
-		}
+	ipt, err := ec.iptables(iptables.ProtocolIPv4)
+	if err != nil {
+		ec.Log.Error("command iptables not found")
+		return err
 	}
 	if err = cniutils.EnableIpForwarding(ec.Procsys, ec.TmpResult.IPs); err != nil {
 		return fmt.Errorf("could not enable IP forwarding: %v", err)
@@ -262,12 +280,12 @@ func (ec *egressContext) cmdAddEgressV4() (err error) {
 		return err
 	}
 
-	ec.Log.Debugf("Node IP: %s", ec.NetConf.NodeIP)
-	if ec.NetConf.NodeIP != nil {
+	ec.Log.Debugf("Node IP: %s", ec.Egress.NodeIP)
+	if ec.Egress.NodeIP != nil {
 		for _, ipc := range ec.TmpResult.IPs {
 			if ipc.Address.IP.To4() != nil {
 				// add SNAT chain/rules necessary for the container IPv6 egress traffic
-				if err = snat.Add(ec.IPTablesIface, ec.NetConf.NodeIP, ipc.Address.IP, ipv4MulticastRange, ec.SnatChain, ec.SnatComment, ec.NetConf.RandomizeSNAT); err != nil {
+				if err = snat.Add(ipt, ec.Egress.NodeIP, ipc.Address.IP, ipv4MulticastRange, ec.SnatChain, ec.SnatComment, ec.NetConf.RandomizeSNAT); err != nil {
 					return err
 				}
 			}
@@ -276,9 +294,19 @@ func (ec *egressContext) cmdAddEgressV4() (err error) {
 
 	// Copy interfaces over to result, but not IPs.
 	ec.Result.Interfaces = append(ec.Result.Interfaces, ec.TmpResult.Interfaces...)
+	return nil
+}
 
-	// Pass through the previous result
-	return types.PrintResult(ec.Result, ec.NetConf.CNIVersion)
+// cmdAddEgressNAT64 checks the NAT64 prefix that IPv6 pods reach IPv4 endpoints through in EKS IPv6 cluster. DNS64
+// answers the names of IPv4 endpoints with addresses in the prefix, which the VPC routes to a NAT gateway. The pod gets
+// no IPv4 address, so that applications resolve the names to these addresses rather than to unreachable IPv4 ones.
+func (ec *egressContext) cmdAddEgressNAT64() error {
+	_, prefix, err := net.ParseCIDR(ec.Egress.NAT64Prefix)
+	if err != nil || prefix.IP.To4() != nil {
+		return fmt.Errorf("invalid NAT64 prefix %q", ec.Egress.NAT64Prefix)
+	}
+	ec.Log.Debugf("IPv4 egress through NAT64 prefix %s", prefix)
+	return nil
 }
 
 // cmdDelEgressV4 exec clear the setting to support IPv4 egress traffic in EKS IPv6 cluster
@@ -292,12 +320,11 @@ func (ec *egressContext) cmdDelEgress(ipv4 bool) (err error) {
 		ipFamily = netlink.FAMILY_V6
 	}
 
-	if ec.IPTablesIface == nil {
-		if ec.IPTablesIface, err = ec.IptCreator(protocol); err != nil {
-			ec.Log.Error("command iptables not found")
-			// without iptables ir ip6tables, chain/rules could not be removed
-			return err
-		}
+	ipt, err := ec.iptables(protocol)
+	if err != nil {
+		ec.Log.Error("command iptables not found")
+		// without iptables ir ip6tables, chain/rules could not be removed
+		return err
 	}
 	if ec.NsPath != "" {
 		_ = ec.Ns.WithNetNSPath(ec.NsPath, func(hostNS ns.NetNS) error {
@@ -307,10 +334,10 @@ func (ec *egressContext) cmdDelEgress(ipv4 bool) (err error) {
 
 			var _err error
 			var link netlink.Link
-			link, _err = ec.Link.LinkByName(ec.NetConf.IfName)
+			link, _err = ec.Link.LinkByName(ec.Egress.ifName())
 			if _err != nil {
 				if !cniutils.IsLinkNotFoundError(_err) {
-					ec.Log.Errorf("failed to get container link by name %s: %v", ec.NetConf.IfName, _err)
+					ec.Log.Errorf("failed to get container link by name %s: %v", ec.Egress.ifName(), _err)
 				}
 				return nil
 			}
@@ -318,7 +345,7 @@ func (ec *egressContext) cmdDelEgress(ipv4 bool) (err error) {
 			//Retrieve IP addresses assigned to the link
 			contIPAddrs, _err = ec.Link.AddrList(link, ipFamily)
 			if _err != nil {
-				ec.Log.Errorf("failed to get IP addresses for link %s: %v", ec.NetConf.IfName, _err)
+				ec.Log.Errorf("failed to get IP addresses for link %s: %v", ec.Egress.ifName(), _err)
 			}
 
 			return _err
@@ -330,7 +357,7 @@ func (ec *egressContext) cmdDelEgress(ipv4 bool) (err error) {
 		// NOTE: IsGlobalUnicast returns true for unique-local IPv6 address
 		if (ipv4 && ipAddr.IP.To4() != nil && ipAddr.IP.IsLinkLocalUnicast()) ||
 			(!ipv4 && ipAddr.IP.To4() == nil && ipAddr.IP.IsGlobalUnicast()) {
-			err = snat.Del(ec.IPTablesIface, ipAddr.IP, ec.SnatChain, ec.SnatComment)
+			err = snat.Del(ipt, ipAddr.IP, ec.SnatChain, ec.SnatComment)
 			if err != nil {
 				ec.Log.Errorf("failed to remove iptables chain %s: %v", ec.SnatChain, err)
 			} else {
@@ -352,11 +379,10 @@ func (ec *egressContext) cmdAddEgressV6() (err error) {
 	// 4. container IPv6 egress traffic go through node primary interface (eth0) which has an IPv6 global unicast address
 	// 5. IPv6 egress traffic of all containers in a node shares node primary interface (eth0) through SNAT
 
-	if ec.IPTablesIface == nil {
-		if ec.IPTablesIface, err = ec.IptCreator(iptables.ProtocolIPv6); err != nil {
-			ec.Log.Error("command ip6tables not found")
-			return err
-		}
+	ipt, err := ec.iptables(iptables.ProtocolIPv6)
+	if err != nil {
+		ec.Log.Error("command ip6tables not found")
+		return err
 	}
 	// first disable IPv6 on container's primary interface (eth0)
 	err = ec.disableContainerInterfaceIPv6(ec.ArgsIfName)
@@ -368,7 +394,7 @@ func (ec *egressContext) cmdAddEgressV6() (err error) {
 	hostInterface, containerInterface, err := ec.setupContainerVethV6()
 	if err != nil {
 		ec.Log.Errorf("veth created failed, ns: %s name: %s, mtu: %d, ipam-result: %+v err: %v",
-			ec.NsPath, ec.NetConf.IfName, ec.Mtu, *ec.TmpResult, err)
+			ec.NsPath, ec.Egress.ifName(), ec.Mtu, *ec.TmpResult, err)
 		return err
 	}
 	ec.Log.Debugf("veth pair created for container IPv6 egress traffic, container interface: %s ,host interface: %s",
@@ -392,7 +418,7 @@ func (ec *egressContext) cmdAddEgressV6() (err error) {
 
 	// set up SNAT in host for container IPv6 egress traffic
 	// following line adds an ip6tables entries to NAT for IPv6 traffic between container v6if0 and node primary ENI (eth0)
-	err = snat.Add(ec.IPTablesIface, ec.NetConf.NodeIP, containerIPv6, ipv6MulticastRange, ec.SnatChain, ec.SnatComment, ec.NetConf.RandomizeSNAT)
+	err = snat.Add(ipt, ec.Egress.NodeIP, containerIPv6, ipv6MulticastRange, ec.SnatChain, ec.SnatComment, ec.NetConf.RandomizeSNAT)
 	if err != nil {
 		ec.Log.Errorf("setup host snat failed: %v", err)
 		return err
@@ -401,9 +427,7 @@ func (ec *egressContext) cmdAddEgressV6() (err error) {
 
 	// Copy interfaces over to result, but not IPs.
 	ec.Result.Interfaces = append(ec.Result.Interfaces, ec.TmpResult.Interfaces...)
-
-	// Pass through the previous result
-	return types.PrintResult(ec.Result, ec.NetConf.CNIVersion)
+	return nil
 }
 
 func (ec *egressContext) disableContainerInterfaceIPv6(ifName string) error {
@@ -483,7 +507,7 @@ func (ec *egressContext) setupContainerVethV6() (hostInterface, containerInterfa
 		var contVeth net.Interface
 
 		// Empty veth MAC is passed
-		hostVeth, contVeth, err = ec.Veth.Setup(ec.NetConf.IfName, ec.Mtu, "", hostNS)
+		hostVeth, contVeth, err = ec.Veth.Setup(ec.Egress.ifName(), ec.Mtu, "", hostNS)
 		if err != nil {
 			return err
 		}
@@ -503,7 +527,7 @@ func (ec *egressContext) setupContainerVethV6() (hostInterface, containerInterfa
 			ipc.Interface = current.Int(1)
 		}
 
-		err = ec.Ipam.ConfigureIface(ec.NetConf.IfName, ec.TmpResult)
+		err = ec.Ipam.ConfigureIface(ec.Egress.ifName(), ec.TmpResult)
 		if err != nil {
 			return err
 		}
@@ -513,9 +537,9 @@ func (ec *egressContext) setupContainerVethV6() (hostInterface, containerInterfa
 	return hostInterface, containerInterface, err
 }
 
-func (ec *egressContext) hostLocalIpamAdd(stdinData []byte) (err error) {
+func (ec *egressContext) hostLocalIpamAdd(ipamType string, stdinData []byte) (err error) {
 	var ipamResultI types.Result
-	if ipamResultI, err = ec.Ipam.ExecAdd(ec.NetConf.IPAM.Type, stdinData); err != nil {
+	if ipamResultI, err = ec.Ipam.ExecAdd(ipamType, stdinData); err != nil {
 		return fmt.Errorf("running IPAM plugin failed: %v", err)
 	}
 
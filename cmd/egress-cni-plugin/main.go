@@ -76,36 +76,73 @@ func add(args *skel.CmdArgs, ec *egressContext) (err error) {
 	// chained plugin to VPC CNI. We only need this plugin to kick in if egress is enabled in VPC CNI. So, the
 	// value of an env variable in VPC CNI determines whether this plugin should be enabled and this is an attempt to
 	// pass through the variable configured in VPC CNI.
-	if ec.NetConf.Enabled != "true" {
-		return types.PrintResult(ec.Result, ec.NetConf.CNIVersion)
+	ec.SnatComment = utils.FormatComment(ec.NetConf.Name, args.ContainerID)
+	for _, egress := range ec.NetConf.egresses() {
+		// Pods only need the egress of the IP family they have no address of
+		if podHasAddress(ec.Result, egress.ipv4) {
+			ec.Log.Debugf("pod has an %s address, skipping %s egress", egress, egress)
+			continue
+		}
+		if egress.ipv4 && ec.NetConf.ipv6Only() {
+			ec.Log.Debugf("pod has the %s annotation, skipping IPv4 egress", ipv6OnlyAnnotation)
+			continue
+		}
+		if err = ec.addEgress(args, egress); err != nil {
+			return err
+		}
+	}
+
+	// Pass through the previous result
+	return types.PrintResult(ec.Result, ec.NetConf.CNIVersion)
+}
+
+// addEgress sets up the egress of one IP family for the container
+func (ec *egressContext) addEgress(args *skel.CmdArgs, egress *EgressConf) (err error) {
+	ec.Egress = egress
+	// With NAT64, IPv4 egress needs neither an IPv4 interface nor SNAT
+	if egress.NAT64Prefix != "" {
+		return ec.cmdAddEgressNAT64()
+	}
+	if !egress.ipv4 && (egress.NodeIP == nil || !egress.NodeIP.IsGlobalUnicast()) {
+		return fmt.Errorf("global unicast IPv6 not found in host primary interface which is mandatory to support IPv6 egress")
 	}
 
+	ipamType, err := egress.ipamType()
+	if err != nil {
+		return err
+	}
+	stdinData, err := egressStdinData(args.StdinData, egress)
+	if err != nil {
+		return err
+	}
 	// Invoke ipam del if err to avoid ip leak
 	defer func() {
 		if err != nil {
-			ec.Ipam.ExecDel(ec.NetConf.IPAM.Type, args.StdinData)
+			ec.Ipam.ExecDel(ipamType, stdinData)
 		}
 	}()
-	err = ec.hostLocalIpamAdd(args.StdinData)
+	err = ec.hostLocalIpamAdd(ipamType, stdinData)
 	if err != nil {
 		ec.Log.Errorf("failed to get one ip address from host-local ipam: %v", err)
 		return err
 	}
 
-	ec.SnatComment = utils.FormatComment(ec.NetConf.Name, args.ContainerID)
-	if ec.NetConf.NodeIP.To4() == nil { // NodeIP is not IPv4 address, pod IPv6 egress for eks IPv4 cluster
-		if ec.NetConf.NodeIP == nil || !ec.NetConf.NodeIP.IsGlobalUnicast() {
-			return fmt.Errorf("global unicast IPv6 not found in host primary interface which is mandatory to support IPv6 egress")
+	ec.SnatChain = utils.MustFormatChainNameWithPrefix(ec.NetConf.Name, args.ContainerID, egress.chainPrefix())
+	if egress.ipv4 { // pod IPv4 egress for eks IPv6 cluster
+		return ec.cmdAddEgressV4()
+	}
+	// pod IPv6 egress for eks IPv4 cluster
+	return ec.cmdAddEgressV6()
+}
+
+// podHasAddress returns whether the previous result assigned the pod an address of the IP family
+func podHasAddress(result *current.Result, ipv4 bool) bool {
+	for _, ipc := range result.IPs {
+		if (ipc.Address.IP.To4() != nil) == ipv4 {
+			return true
 		}
-		ec.SnatChain = utils.MustFormatChainNameWithPrefix(ec.NetConf.Name, args.ContainerID, "E6-")
-		ec.NetConf.IfName = egressIPv6InterfaceName
-		err = ec.cmdAddEgressV6()
-	} else { // NodeIP is IPv4 address, pod IPv4 egress for eks IPv6 cluster
-		ec.SnatChain = utils.MustFormatChainNameWithPrefix(ec.NetConf.Name, args.ContainerID, "E4-")
-		ec.NetConf.IfName = egressIPv4InterfaceName
-		err = ec.cmdAddEgressV4()
-	}
-	return err
+	}
+	return false
 }
 
 func cmdDel(args *skel.CmdArgs) error {
@@ -121,29 +158,38 @@ func del(args *skel.CmdArgs, ec *egressContext) (err error) {
 	ec.Log.Debugf("Received a Del request: nsPath: %s conf=%+v", ec.NsPath, *ec.NetConf)
 
 	// We only need this plugin to kick in if egress is enabled
-	if ec.NetConf.Enabled != "true" {
+	egresses := ec.NetConf.egresses()
+	if len(egresses) == 0 {
 		ec.Log.Debugf("egress-cni plugin is disabled")
 		return nil
 	}
 
-	if err = ec.Ipam.ExecDel(ec.NetConf.IPAM.Type, args.StdinData); err != nil {
+	ec.SnatComment = utils.FormatComment(ec.NetConf.Name, args.ContainerID)
+	for _, egress := range egresses {
+		if err = ec.delEgress(args, egress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// delEgress tears down the egress of one IP family of the container. The egress of the pods that did not need it was
+// never set up, which is not an error.
+func (ec *egressContext) delEgress(args *skel.CmdArgs, egress *EgressConf) error {
+	ec.Egress = egress
+	ipamType, err := egress.ipamType()
+	if err != nil {
+		return err
+	}
+	stdinData, err := egressStdinData(args.StdinData, egress)
+	if err != nil {
+		return err
+	}
+	if err = ec.Ipam.ExecDel(ipamType, stdinData); err != nil {
 		ec.Log.Debugf("running IPAM plugin failed: %v", err)
 		return fmt.Errorf("running IPAM plugin failed: %v", err)
 	}
 
-	ec.SnatComment = utils.FormatComment(ec.NetConf.Name, args.ContainerID)
-	var ipv4 bool
-	if ec.NetConf.NodeIP.To4() == nil { // NodeIP is not IPv4 address
-		ipv4 = false
-		ec.SnatChain = utils.MustFormatChainNameWithPrefix(ec.NetConf.Name, args.ContainerID, "E6-")
-		// IPv6 egress
-		ec.NetConf.IfName = egressIPv6InterfaceName
-	} else {
-		ipv4 = true
-		ec.SnatChain = utils.MustFormatChainNameWithPrefix(ec.NetConf.Name, args.ContainerID, "E4-")
-		// IPv4 egress
-		ec.NetConf.IfName = egressIPv4InterfaceName
-	}
-
-	return ec.cmdDelEgress(ipv4)
+	ec.SnatChain = utils.MustFormatChainNameWithPrefix(ec.NetConf.Name, args.ContainerID, egress.chainPrefix())
+	return ec.cmdDelEgress(egress.ipv4)
 }
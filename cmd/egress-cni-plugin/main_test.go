@@ -14,14 +14,19 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"testing"
 
 	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/coreos/go-iptables/iptables"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
 
 	mock_ipamwrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/hostipamwrapper/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iptableswrapper"
 	mock_iptables "github.com/aws/amazon-vpc-cni-k8s/pkg/iptableswrapper/mocks"
 	mock_netlinkwrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/netlinkwrapper/mocks"
 	mock_nswrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/nswrapper/mocks"
@@ -71,14 +76,14 @@ func TestCmdAddV4(t *testing.T) {
 	}
 
 	ec := egressContext{
-		Procsys:       mock_procsyswrapper.NewMockProcSys(ctrl),
-		Ns:            mock_nswrapper.NewMockNS(ctrl),
-		NsPath:        "/var/run/netns/cni-xxxx",
-		ArgsIfName:    args.IfName,
-		IPTablesIface: mock_iptables.NewMockIPTablesIface(ctrl),
-		Ipam:          mock_ipamwrapper.NewMockHostIpam(ctrl),
-		Link:          mock_netlinkwrapper.NewMockNetLink(ctrl),
-		Veth:          mock_veth.NewMockVeth(ctrl),
+		Procsys:    mock_procsyswrapper.NewMockProcSys(ctrl),
+		Ns:         mock_nswrapper.NewMockNS(ctrl),
+		NsPath:     "/var/run/netns/cni-xxxx",
+		ArgsIfName: args.IfName,
+		IPTables:   map[iptables.Protocol]iptableswrapper.IPTablesIface{iptables.ProtocolIPv4: mock_iptables.NewMockIPTablesIface(ctrl)},
+		Ipam:       mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link:       mock_netlinkwrapper.NewMockNetLink(ctrl),
+		Veth:       mock_veth.NewMockVeth(ctrl),
 	}
 
 	var actualIptablesRules, actualRouteAdd, actualRouteDel []string
@@ -142,11 +147,11 @@ func TestCmdDelV4(t *testing.T) {
 	}
 
 	ec := egressContext{
-		Ns:            mock_nswrapper.NewMockNS(ctrl),
-		NsPath:        "/var/run/netns/cni-xxxx",
-		IPTablesIface: mock_iptables.NewMockIPTablesIface(ctrl),
-		Ipam:          mock_ipamwrapper.NewMockHostIpam(ctrl),
-		Link:          mock_netlinkwrapper.NewMockNetLink(ctrl),
+		Ns:       mock_nswrapper.NewMockNS(ctrl),
+		NsPath:   "/var/run/netns/cni-xxxx",
+		IPTables: map[iptables.Protocol]iptableswrapper.IPTablesIface{iptables.ProtocolIPv4: mock_iptables.NewMockIPTablesIface(ctrl)},
+		Ipam:     mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link:     mock_netlinkwrapper.NewMockNetLink(ctrl),
 	}
 
 	var actualIptablesDel []string
@@ -197,14 +202,14 @@ func TestCmdAddV6(t *testing.T) {
 	}
 
 	ec := egressContext{
-		Procsys:       mock_procsyswrapper.NewMockProcSys(ctrl),
-		Ns:            mock_nswrapper.NewMockNS(ctrl),
-		NsPath:        "/var/run/netns/cni-xxxx",
-		ArgsIfName:    args.IfName,
-		IPTablesIface: mock_iptables.NewMockIPTablesIface(ctrl),
-		Ipam:          mock_ipamwrapper.NewMockHostIpam(ctrl),
-		Link:          mock_netlinkwrapper.NewMockNetLink(ctrl),
-		Veth:          mock_veth.NewMockVeth(ctrl),
+		Procsys:    mock_procsyswrapper.NewMockProcSys(ctrl),
+		Ns:         mock_nswrapper.NewMockNS(ctrl),
+		NsPath:     "/var/run/netns/cni-xxxx",
+		ArgsIfName: args.IfName,
+		IPTables:   map[iptables.Protocol]iptableswrapper.IPTablesIface{iptables.ProtocolIPv6: mock_iptables.NewMockIPTablesIface(ctrl)},
+		Ipam:       mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link:       mock_netlinkwrapper.NewMockNetLink(ctrl),
+		Veth:       mock_veth.NewMockVeth(ctrl),
 	}
 
 	var actualIptablesRules, actualRouteAdd, actualRouteReplace []string
@@ -264,11 +269,11 @@ func TestCmdDelV6(t *testing.T) {
 		}`),
 	}
 	ec := egressContext{
-		Ns:            mock_nswrapper.NewMockNS(ctrl),
-		NsPath:        "/var/run/netns/cni-xxxx",
-		Ipam:          mock_ipamwrapper.NewMockHostIpam(ctrl),
-		Link:          mock_netlinkwrapper.NewMockNetLink(ctrl),
-		IPTablesIface: mock_iptables.NewMockIPTablesIface(ctrl),
+		Ns:       mock_nswrapper.NewMockNS(ctrl),
+		NsPath:   "/var/run/netns/cni-xxxx",
+		Ipam:     mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link:     mock_netlinkwrapper.NewMockNetLink(ctrl),
+		IPTables: map[iptables.Protocol]iptableswrapper.IPTablesIface{iptables.ProtocolIPv6: mock_iptables.NewMockIPTablesIface(ctrl)},
 	}
 
 	var actualIptablesDel []string
@@ -284,3 +289,270 @@ func TestCmdDelV6(t *testing.T) {
 		fmt.Sprintf("del chain nat %s", snatChainV6)}
 	assert.EqualValues(t, expectIptablesDel, actualIptablesDel)
 }
+
+func TestCmdAddNAT64(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	stdinData := `{
+				"cniVersion":"1.0.0",
+				"mtu":"9001",
+				"name":"aws-cni",
+				"enabled":"true",
+				"nodeIP": "",
+				"nat64Prefix": "%s",
+				"ipam": {"type":"host-local","ranges":[[{"subnet": "169.254.172.0/22"}]],"routes":[{"dst":"0.0.0.0"}],"dataDir":"/run/cni/v6pd/egress-v4-ipam"},
+				"pluginLogFile":"egress-plugin.log",
+				"pluginLogLevel":"DEBUG",
+				"prevResult":
+					{
+					"cniVersion":"1.0.0",
+					"interfaces":
+						[
+							{"name":"eni36e5b0ee702"},
+							{"name":"eth0","sandbox":"/var/run/netns/cni-266298c1-b141-9c7f-f26b-97ff084f3fcc"}],
+					"ips":
+						[{"version":"6","interface":1,"address":"%s"}],
+					"dns":{}
+					},
+				"type":"aws-cni",
+				"vethPrefix":"eni"
+		}`
+	newArgs := func(prefix, podIP string) *skel.CmdArgs {
+		return &skel.CmdArgs{
+			ContainerID: containerIDV4,
+			IfName:      "eth0",
+			StdinData:   []byte(fmt.Sprintf(stdinData, prefix, podIP)),
+		}
+	}
+
+	// No IPv4 interface, IPAM allocation or SNAT rule is set up for the pod
+	ec := egressContext{
+		Ns:       mock_nswrapper.NewMockNS(ctrl),
+		NsPath:   "/var/run/netns/cni-xxxx",
+		IPTables: map[iptables.Protocol]iptableswrapper.IPTablesIface{iptables.ProtocolIPv4: mock_iptables.NewMockIPTablesIface(ctrl)},
+		Ipam:     mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link:     mock_netlinkwrapper.NewMockNetLink(ctrl),
+		Veth:     mock_veth.NewMockVeth(ctrl),
+	}
+	assert.NoError(t, add(newArgs("64:ff9b::/96", "2600:1f16:828:c404:af46:9f44:d2ea:4569/128"), &ec))
+
+	assert.Error(t, add(newArgs("100.64.0.0/10", "2600:1f16:828:c404:af46:9f44:d2ea:4569/128"), &ec))
+	// Pods with an IPv4 address need no IPv4 egress
+	assert.NoError(t, add(newArgs("100.64.0.0/10", "192.168.13.226/32"), &ec))
+
+	fmt.Println()
+}
+
+func TestCmdAddIPv6OnlyAnnotation(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	args := &skel.CmdArgs{
+		ContainerID: containerIDV4,
+		IfName:      "eth0",
+		StdinData: []byte(`{
+				"cniVersion":"1.0.0",
+				"mtu":"9001",
+				"name":"aws-cni",
+				"enabled":"true",
+				"nodeIP": "192.168.1.123",
+				"ipam": {"type":"host-local","ranges":[[{"subnet": "169.254.172.0/22"}]],"routes":[{"dst":"0.0.0.0"}],"dataDir":"/run/cni/v6pd/egress-v4-ipam"},
+				"pluginLogFile":"egress-plugin.log",
+				"pluginLogLevel":"DEBUG",
+				"runtimeConfig": {"io.kubernetes.cri.pod-annotations": {"vpc.amazonaws.com/ipv6-only": "true"}},
+				"prevResult":
+					{
+					"cniVersion":"1.0.0",
+					"interfaces":
+						[
+							{"name":"eni36e5b0ee702"},
+							{"name":"eth0","sandbox":"/var/run/netns/cni-266298c1-b141-9c7f-f26b-97ff084f3fcc"}],
+					"ips":
+						[{"version":"6","interface":1,"address":"2600:1f16:828:c404:af46:9f44:d2ea:4569/128"}],
+					"dns":{}
+					},
+				"type":"aws-cni",
+				"vethPrefix":"eni"
+		}`),
+	}
+
+	// No IPv4 interface, IPAM allocation or SNAT rule is set up for the pod
+	ec := egressContext{
+		Ns:       mock_nswrapper.NewMockNS(ctrl),
+		NsPath:   "/var/run/netns/cni-xxxx",
+		IPTables: map[iptables.Protocol]iptableswrapper.IPTablesIface{iptables.ProtocolIPv4: mock_iptables.NewMockIPTablesIface(ctrl)},
+		Ipam:     mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link:     mock_netlinkwrapper.NewMockNetLink(ctrl),
+		Veth:     mock_veth.NewMockVeth(ctrl),
+	}
+	assert.NoError(t, add(args, &ec))
+}
+
+func TestCmdDelNAT64(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	args := &skel.CmdArgs{
+		ContainerID: containerIDV4,
+		IfName:      "eth0",
+		StdinData: []byte(`{
+				"cniVersion":"1.0.0",
+				"mtu":"9001",
+				"name":"aws-cni",
+				"enabled":"true",
+				"nodeIP": "",
+				"nat64Prefix": "64:ff9b::/96",
+				"ipam": {"type":"host-local","ranges":[[{"subnet": "169.254.172.0/22"}]],"routes":[{"dst":"0.0.0.0"}],"dataDir":"/run/cni/v6pd/egress-v4-ipam"},
+				"pluginLogFile":"egress-plugin.log",
+				"pluginLogLevel":"DEBUG",
+				"type":"aws-cni",
+				"vethPrefix":"eni"
+		}`),
+	}
+
+	ec := egressContext{
+		Ns:       mock_nswrapper.NewMockNS(ctrl),
+		NsPath:   "/var/run/netns/cni-xxxx",
+		IPTables: map[iptables.Protocol]iptableswrapper.IPTablesIface{iptables.ProtocolIPv4: mock_iptables.NewMockIPTablesIface(ctrl)},
+		Ipam:     mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link:     mock_netlinkwrapper.NewMockNetLink(ctrl),
+	}
+
+	// The IPv4 egress interface of a pod created before NAT64 was enabled is cleaned up
+	var actualIptablesDel []string
+	err := SetupDelExpectV4(ec, &actualIptablesDel)
+	assert.Nil(t, err)
+
+	err = del(args, &ec)
+	assert.Nil(t, err)
+
+	expectIptablesDel := []string{
+		fmt.Sprintf("nat POSTROUTING -s 169.254.172.10 -j %s -m comment --comment name: \"aws-cni\" id: \"containerId-123\"", snatChainV4),
+		fmt.Sprintf("clear chain nat %s", snatChainV4),
+		fmt.Sprintf("del chain nat %s", snatChainV4)}
+	assert.EqualValues(t, expectIptablesDel, actualIptablesDel)
+}
+
+const dualEgressConf = `{
+				"cniVersion":"1.0.0",
+				"mtu":"9001",
+				"name":"aws-cni",
+				"randomizeSNAT":"prng",
+				"v4Egress": {
+					"enabled":"true",
+					"nodeIP": "192.168.1.123",
+					"ipam": {"type":"host-local","ranges":[[{"subnet": "169.254.172.0/22"}]],"routes":[{"dst":"0.0.0.0"}],"dataDir":"/run/cni/v6pd/egress-v4-ipam"}
+				},
+				"v6Egress": {
+					"enabled":"true",
+					"nodeIP": "2600::",
+					"ipam": {"type":"host-local","ranges":[[{"subnet": "fd00::ac:00/118"}]],"routes":[{"dst":"::/0"}],"dataDir":"/run/cni/v4pd/egress-v6-ipam"}
+				},
+				"pluginLogFile":"egress-plugin.log",
+				"pluginLogLevel":"DEBUG",
+				"prevResult":
+					{
+					"cniVersion":"1.0.0",
+					"interfaces":
+						[
+							{"name":"eni36e5b0ee702"},
+							{"name":"eth0","sandbox":"/var/run/netns/cni-266298c1-b141-9c7f-f26b-97ff084f3fcc"}],
+					"ips":
+						[{"version":"6","interface":1,"address":"2600:1f16:828:c404:af46:9f44:d2ea:4569/128"}],
+					"dns":{}
+					},
+				"type":"aws-cni",
+				"vethPrefix":"eni"
+		}`
+
+func TestCmdAddDualEgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	args := &skel.CmdArgs{
+		ContainerID: containerIDV4,
+		IfName:      "eth0",
+		StdinData:   []byte(dualEgressConf),
+	}
+
+	ec := egressContext{
+		Procsys:    mock_procsyswrapper.NewMockProcSys(ctrl),
+		Ns:         mock_nswrapper.NewMockNS(ctrl),
+		NsPath:     "/var/run/netns/cni-xxxx",
+		ArgsIfName: args.IfName,
+		IPTables: map[iptables.Protocol]iptableswrapper.IPTablesIface{
+			iptables.ProtocolIPv4: mock_iptables.NewMockIPTablesIface(ctrl),
+			iptables.ProtocolIPv6: mock_iptables.NewMockIPTablesIface(ctrl),
+		},
+		Ipam: mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link: mock_netlinkwrapper.NewMockNetLink(ctrl),
+		Veth: mock_veth.NewMockVeth(ctrl),
+	}
+
+	// The IPv6 pod only gets the IPv4 egress, from the IPAM configuration of the IPv4 egress
+	var actualIptablesRules, actualRouteAdd, actualRouteDel []string
+	err := SetupAddExpectV4(ec, snatChainV4, &actualIptablesRules, &actualRouteAdd, &actualRouteDel)
+	assert.Nil(t, err)
+
+	err = add(args, &ec)
+	assert.Nil(t, err)
+
+	expectIptablesRules := []string{
+		fmt.Sprintf("nat %s -d 224.0.0.0/4 -j ACCEPT -m comment --comment name: \"aws-cni\" id: \"%s\"", snatChainV4, containerIDV4),
+		fmt.Sprintf("nat %s -j SNAT --to-source 192.168.1.123 -m comment --comment name: \"aws-cni\" id: \"%s\" --random-fully", snatChainV4, containerIDV4),
+		fmt.Sprintf("nat POSTROUTING -s 169.254.172.10 -j %s -m comment --comment name: \"aws-cni\" id: \"%s\"", snatChainV4, containerIDV4)}
+	assert.EqualValues(t, expectIptablesRules, actualIptablesRules)
+
+	fmt.Println()
+}
+
+func TestCmdDelDualEgress(t *testing.T) {
+	ctrl := gomock.NewController(t)
+
+	args := &skel.CmdArgs{
+		ContainerID: containerIDV4,
+		IfName:      "eth0",
+		StdinData:   []byte(dualEgressConf),
+	}
+
+	ec := egressContext{
+		Ns:     mock_nswrapper.NewMockNS(ctrl),
+		NsPath: "/var/run/netns/cni-xxxx",
+		IPTables: map[iptables.Protocol]iptableswrapper.IPTablesIface{
+			iptables.ProtocolIPv4: mock_iptables.NewMockIPTablesIface(ctrl),
+			iptables.ProtocolIPv6: mock_iptables.NewMockIPTablesIface(ctrl),
+		},
+		Ipam: mock_ipamwrapper.NewMockHostIpam(ctrl),
+		Link: mock_netlinkwrapper.NewMockNetLink(ctrl),
+	}
+
+	var actualIptablesDel []string
+	err := SetupDelExpectV4(ec, &actualIptablesDel)
+	assert.Nil(t, err)
+
+	// The IPv6 egress, which the pod did not need, is released from its own IPAM data directory
+	var ipamDataDirs []string
+	ec.Ipam.(*mock_ipamwrapper.MockHostIpam).EXPECT().ExecDel("host-local", gomock.Any()).DoAndReturn(
+		func(_ string, stdinData []byte) error {
+			conf := struct {
+				IPAM struct {
+					DataDir string `json:"dataDir"`
+				} `json:"ipam"`
+			}{}
+			assert.NoError(t, json.Unmarshal(stdinData, &conf))
+			ipamDataDirs = append(ipamDataDirs, conf.IPAM.DataDir)
+			return nil
+		})
+	ec.Ns.(*mock_nswrapper.MockNS).EXPECT().WithNetNSPath(ec.NsPath, gomock.Any()).DoAndReturn(
+		func(_ string, f func(ns.NetNS) error) error {
+			return f(nil)
+		})
+	ec.Link.(*mock_netlinkwrapper.MockNetLink).EXPECT().LinkByName(egressIPv6InterfaceName).Return(nil, errors.New("Link not found"))
+
+	err = del(args, &ec)
+	assert.Nil(t, err)
+
+	expectIptablesDel := []string{
+		fmt.Sprintf("nat POSTROUTING -s 169.254.172.10 -j %s -m comment --comment name: \"aws-cni\" id: \"containerId-123\"", snatChainV4),
+		fmt.Sprintf("clear chain nat %s", snatChainV4),
+		fmt.Sprintf("del chain nat %s", snatChainV4)}
+	assert.EqualValues(t, expectIptablesDel, actualIptablesDel)
+	assert.Equal(t, []string{"/run/cni/v4pd/egress-v6-ipam"}, ipamDataDirs)
+}
@@ -21,6 +21,7 @@ import (
 	"github.com/containernetworking/cni/pkg/types"
 	cniversion "github.com/containernetworking/cni/pkg/version"
 
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/featuregate"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
 )
 
@@ -30,27 +31,112 @@ const (
 
 	// egressIPv6InterfaceName interface name used in container ns for IPv6 egress traffic
 	egressIPv6InterfaceName = "v6if0"
+
+	// ipv6OnlyAnnotation opts a pod of an IPv6 cluster out of IPv4 egress, so that it only has its IPv6 address
+	ipv6OnlyAnnotation = "vpc.amazonaws.com/ipv6-only"
 )
 
+// EgressConf is the egress configuration of one IP family
+type EgressConf struct {
+	Enabled string `json:"enabled"`
+
+	// IP to use as SNAT target
+	NodeIP net.IP `json:"nodeIP"`
+
+	// NAT64 prefix that IPv6 pods reach IPv4 endpoints through. When set, pods get no IPv4 egress interface.
+	NAT64Prefix string `json:"nat64Prefix,omitempty"`
+
+	// IPAM configuration of the host-local plugin allocating the egress address of the pod
+	IPAM json.RawMessage `json:"ipam"`
+
+	// ipv4 is whether this is the IPv4 egress of IPv6 pods rather than the IPv6 egress of IPv4 pods
+	ipv4 bool
+}
+
+func (e *EgressConf) enabled() bool {
+	return e != nil && e.Enabled == "true"
+}
+
+// ipamType returns the type of the IPAM plugin of the egress
+func (e *EgressConf) ipamType() (string, error) {
+	ipam := types.IPAM{}
+	if err := json.Unmarshal(e.IPAM, &ipam); err != nil {
+		return "", fmt.Errorf("failed to parse ipam of %s egress: %v", e, err)
+	}
+	return ipam.Type, nil
+}
+
+// ifName returns the interface created in the container for the egress
+func (e *EgressConf) ifName() string {
+	if e.ipv4 {
+		return egressIPv4InterfaceName
+	}
+	return egressIPv6InterfaceName
+}
+
+// chainPrefix returns the prefix of the SNAT chain names of the egress
+func (e *EgressConf) chainPrefix() string {
+	if e.ipv4 {
+		return "E4-"
+	}
+	return "E6-"
+}
+
+func (e *EgressConf) String() string {
+	if e.ipv4 {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
 // NetConf is our CNI config structure
 type NetConf struct {
 	types.NetConf
 
-	// Interface inside container to create
-	IfName string `json:"ifName"`
-
 	// MTU for Egress v4 interface
 	MTU string `json:"mtu"`
 
-	Enabled string `json:"enabled"`
-
 	RandomizeSNAT string `json:"randomizeSNAT"`
 
-	// IP to use as SNAT target
-	NodeIP net.IP `json:"nodeIP"`
+	// V4Egress is the IPv4 egress of IPv6 pods, and V6Egress the IPv6 egress of IPv4 pods. Both can be configured
+	// in the same entry, each pod gets the egress of the family it lacks.
+	V4Egress *EgressConf `json:"v4Egress,omitempty"`
+	V6Egress *EgressConf `json:"v6Egress,omitempty"`
+
+	// Enabled, NodeIP, NAT64Prefix and the IPAM configuration at the top level configure a single egress, whose
+	// family is given by NodeIP
+	Enabled     string `json:"enabled"`
+	NodeIP      net.IP `json:"nodeIP"`
+	NAT64Prefix string `json:"nat64Prefix"`
 
 	PluginLogFile  string `json:"pluginLogFile"`
 	PluginLogLevel string `json:"pluginLogLevel"`
+
+	// FeatureGates are the feature gates of aws-node, passed on by aws-vpc-cni
+	FeatureGates string `json:"featureGates"`
+	featureGate  *featuregate.FeatureGate
+
+	// RuntimeConfig is passed by the container runtime for the capabilities of the plugin
+	RuntimeConfig struct {
+		// PodAnnotations are the annotations of the pod, passed by containerd
+		PodAnnotations map[string]string `json:"io.kubernetes.cri.pod-annotations,omitempty"`
+	} `json:"runtimeConfig,omitempty"`
+}
+
+// ipv6Only returns whether the pod opted out of IPv4 egress
+func (conf *NetConf) ipv6Only() bool {
+	return conf.RuntimeConfig.PodAnnotations[ipv6OnlyAnnotation] == "true"
+}
+
+// egresses returns the enabled egresses
+func (conf *NetConf) egresses() []*EgressConf {
+	var egresses []*EgressConf
+	for _, egress := range []*EgressConf{conf.V4Egress, conf.V6Egress} {
+		if egress.enabled() {
+			egresses = append(egresses, egress)
+		}
+	}
+	return egresses
 }
 
 // LoadConf load stdin and parse to NetConf type, a new log instance is created based on conf settings
@@ -67,10 +153,45 @@ func LoadConf(bytes []byte) (*NetConf, logger.Logger, error) {
 		}
 	}
 
+	if conf.V4Egress == nil && conf.V6Egress == nil {
+		single := struct {
+			IPAM json.RawMessage `json:"ipam"`
+		}{}
+		if err := json.Unmarshal(bytes, &single); err != nil {
+			return nil, nil, err
+		}
+		egress := &EgressConf{Enabled: conf.Enabled, NodeIP: conf.NodeIP, NAT64Prefix: conf.NAT64Prefix, IPAM: single.IPAM}
+		// The pods created before NAT64 was enabled may still have an IPv4 egress interface to clean up
+		if conf.NodeIP.To4() == nil && conf.NAT64Prefix == "" {
+			conf.V6Egress = egress
+		} else {
+			conf.V4Egress = egress
+		}
+	}
+	if conf.V4Egress != nil {
+		conf.V4Egress.ipv4 = true
+	}
+
 	logConfig := logger.Configuration{
 		LogLevel:    conf.PluginLogLevel,
 		LogLocation: conf.PluginLogFile,
 	}
 	log := logger.New(&logConfig)
+
+	var errs []error
+	conf.featureGate, errs = featuregate.Parse(conf.FeatureGates)
+	for _, err := range errs {
+		log.Debugf("%v", err)
+	}
 	return conf, log, nil
 }
+
+// egressStdinData returns the stdin data with the IPAM configuration of the egress, for the host-local plugin
+func egressStdinData(stdinData []byte, egress *EgressConf) ([]byte, error) {
+	conf := map[string]interface{}{}
+	if err := json.Unmarshal(stdinData, &conf); err != nil {
+		return nil, err
+	}
+	conf["ipam"] = egress.IPAM
+	return json.Marshal(conf)
+}
@@ -19,6 +19,7 @@ import (
 
 	current "github.com/containernetworking/cni/pkg/types/100"
 	_ns "github.com/containernetworking/plugins/pkg/ns"
+	"github.com/coreos/go-iptables/iptables"
 	"github.com/golang/mock/gomock"
 	"github.com/vishvananda/netlink"
 
@@ -56,7 +57,7 @@ func SetupAddExpectV4(ec egressContext, chain string, actualIptablesRules, actua
 			},
 		}, nil)
 
-	ec.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().NewChain("nat", chain).Return(nil)
+	ec.IPTables[iptables.ProtocolIPv4].(*mock_iptables.MockIPTablesIface).EXPECT().NewChain("nat", chain).Return(nil)
 
 	macHost := [6]byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F}
 	macCont := [6]byte{0xCC, 0xB8, 0x33, 0x4C, 0x88, 0x4F}
@@ -108,10 +109,10 @@ func SetupAddExpectV4(ec egressContext, chain string, actualIptablesRules, actua
 	ec.Ipam.(*mock_ipam.MockHostIpam).EXPECT().ConfigureIface(egressIPv4InterfaceName, gomock.Any()).Return(nil)
 	ec.Procsys.(*mock_procsys.MockProcSys).EXPECT().Get("net/ipv4/ip_forward").Return("0", nil)
 	ec.Procsys.(*mock_procsys.MockProcSys).EXPECT().Set("net/ipv4/ip_forward", "1").Return(nil)
-	ec.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().HasRandomFully().Return(true)
-	ec.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().ListChains("nat").Return([]string{"POSTROUTING"}, nil)
+	ec.IPTables[iptables.ProtocolIPv4].(*mock_iptables.MockIPTablesIface).EXPECT().HasRandomFully().Return(true)
+	ec.IPTables[iptables.ProtocolIPv4].(*mock_iptables.MockIPTablesIface).EXPECT().ListChains("nat").Return([]string{"POSTROUTING"}, nil)
 
-	ec.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().AppendUnique("nat", gomock.Any(), gomock.Any()).Do(func(arg1, arg2 interface{}, arg3 ...interface{}) {
+	ec.IPTables[iptables.ProtocolIPv4].(*mock_iptables.MockIPTablesIface).EXPECT().AppendUnique("nat", gomock.Any(), gomock.Any()).Do(func(arg1, arg2 interface{}, arg3 ...interface{}) {
 		actualResult := arg1.(string) + " " + arg2.(string)
 		for _, arg := range arg3 {
 			actualResult += " " + arg.(string)
@@ -154,7 +155,7 @@ func SetupDelExpectV4(ec egressContext, actualIptablesDel *[]string) error {
 			},
 		}, nil)
 
-	ec.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().Delete("nat", "POSTROUTING", gomock.Any()).Do(
+	ec.IPTables[iptables.ProtocolIPv4].(*mock_iptables.MockIPTablesIface).EXPECT().Delete("nat", "POSTROUTING", gomock.Any()).Do(
 		func(arg1 interface{}, arg2 interface{}, arg3 ...interface{}) {
 			actualResult := arg1.(string) + " " + arg2.(string)
 			for _, arg := range arg3 {
@@ -163,13 +164,13 @@ func SetupDelExpectV4(ec egressContext, actualIptablesDel *[]string) error {
 			*actualIptablesDel = append(*actualIptablesDel, actualResult)
 		}).Return(nil).AnyTimes()
 
-	ec.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().ClearChain("nat", gomock.Any()).Do(
+	ec.IPTables[iptables.ProtocolIPv4].(*mock_iptables.MockIPTablesIface).EXPECT().ClearChain("nat", gomock.Any()).Do(
 		func(arg1 interface{}, arg2 interface{}) {
 			actualResult := arg1.(string) + " " + arg2.(string)
 			*actualIptablesDel = append(*actualIptablesDel, "clear chain "+actualResult)
 		}).Return(nil).AnyTimes()
 
-	ec.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().DeleteChain("nat", gomock.Any()).Do(
+	ec.IPTables[iptables.ProtocolIPv4].(*mock_iptables.MockIPTablesIface).EXPECT().DeleteChain("nat", gomock.Any()).Do(
 		func(arg1 interface{}, arg2 interface{}) {
 			actualResult := arg1.(string) + " " + arg2.(string)
 			*actualIptablesDel = append(*actualIptablesDel, "del chain "+actualResult)
@@ -198,7 +199,7 @@ func SetupAddExpectV6(c egressContext, chain string, actualIptablesRules, actual
 			},
 		}, nil)
 
-	c.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().NewChain("nat", chain).Return(nil)
+	c.IPTables[iptables.ProtocolIPv6].(*mock_iptables.MockIPTablesIface).EXPECT().NewChain("nat", chain).Return(nil)
 
 	macHost := [6]byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, 0x4F}
 	macCont := [6]byte{0xCC, 0xB8, 0x33, 0x4C, 0x88, 0x4F}
@@ -264,10 +265,10 @@ func SetupAddExpectV6(c egressContext, chain string, actualIptablesRules, actual
 
 	c.Ipam.(*mock_ipam.MockHostIpam).EXPECT().ConfigureIface(egressIPv6InterfaceName, gomock.Any()).Return(nil)
 	c.Procsys.(*mock_procsys.MockProcSys).EXPECT().Set("net/ipv6/conf/eth0/disable_ipv6", "1").Return(nil)
-	c.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().HasRandomFully().Return(true)
-	c.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().ListChains("nat").Return([]string{"POSTROUTING", c.SnatChain}, nil)
+	c.IPTables[iptables.ProtocolIPv6].(*mock_iptables.MockIPTablesIface).EXPECT().HasRandomFully().Return(true)
+	c.IPTables[iptables.ProtocolIPv6].(*mock_iptables.MockIPTablesIface).EXPECT().ListChains("nat").Return([]string{"POSTROUTING", c.SnatChain}, nil)
 
-	c.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().AppendUnique("nat", gomock.Any(), gomock.Any()).Do(func(arg1 interface{}, arg2 interface{}, arg3 ...interface{}) {
+	c.IPTables[iptables.ProtocolIPv6].(*mock_iptables.MockIPTablesIface).EXPECT().AppendUnique("nat", gomock.Any(), gomock.Any()).Do(func(arg1 interface{}, arg2 interface{}, arg3 ...interface{}) {
 		actualResult := arg1.(string) + " " + arg2.(string)
 		for _, arg := range arg3 {
 			actualResult += " " + arg.(string)
@@ -310,7 +311,7 @@ func SetupDelExpectV6(c egressContext, chain string, actualIptablesDel *[]string
 			},
 		}, nil).AnyTimes()
 
-	c.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().Delete("nat", "POSTROUTING", gomock.Any()).Do(
+	c.IPTables[iptables.ProtocolIPv6].(*mock_iptables.MockIPTablesIface).EXPECT().Delete("nat", "POSTROUTING", gomock.Any()).Do(
 		func(arg1 interface{}, arg2 interface{}, arg3 ...interface{}) {
 			actualResult := arg1.(string) + " " + arg2.(string)
 			for _, arg := range arg3 {
@@ -319,13 +320,13 @@ func SetupDelExpectV6(c egressContext, chain string, actualIptablesDel *[]string
 			*actualIptablesDel = append(*actualIptablesDel, actualResult)
 		}).Return(nil).AnyTimes()
 
-	c.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().ClearChain("nat", chain).Do(
+	c.IPTables[iptables.ProtocolIPv6].(*mock_iptables.MockIPTablesIface).EXPECT().ClearChain("nat", chain).Do(
 		func(arg1 interface{}, arg2 interface{}) {
 			actualResult := arg1.(string) + " " + arg2.(string)
 			*actualIptablesDel = append(*actualIptablesDel, "clear chain "+actualResult)
 		}).Return(nil).AnyTimes()
 
-	c.IPTablesIface.(*mock_iptables.MockIPTablesIface).EXPECT().DeleteChain("nat", chain).Do(
+	c.IPTables[iptables.ProtocolIPv6].(*mock_iptables.MockIPTablesIface).EXPECT().DeleteChain("nat", chain).Do(
 		func(arg1 interface{}, arg2 interface{}) {
 			actualResult := arg1.(string) + " " + arg2.(string)
 			*actualIptablesDel = append(*actualIptablesDel, "del chain "+actualResult)
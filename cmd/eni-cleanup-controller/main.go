@@ -0,0 +1,102 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Controller deleting the ENIs ipamd created for the instances of deleted nodes
+package main
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/awssession"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ec2metadatawrapper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/enicleanup"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/version"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	leaderElectionID = "eni-cleanup-controller.vpc.amazonaws.com"
+
+	// Environment variable with the CLUSTER_NAME set on aws-node, to only clean up the ENIs of this cluster
+	envClusterName = "CLUSTER_NAME"
+)
+
+func main() {
+	os.Exit(_main())
+}
+
+func _main() int {
+	log := logger.Get()
+	log.Infof("Starting ENI cleanup controller %s ...", version.Version)
+	ctrl.SetLogger(zap.New())
+
+	sess := awssession.New()
+	// With IRSA, the region is injected in the environment, otherwise it comes from instance metadata
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		var err error
+		region, err = ec2metadatawrapper.New(sess).Region()
+		if err != nil {
+			log.Errorf("Failed to get the region from instance metadata, set AWS_REGION: %v", err)
+			return 1
+		}
+	}
+	ec2Client := ec2wrapper.New(sess.Copy(aws.NewConfig().WithRegion(region)))
+
+	restCfg, err := k8sapi.GetRestConfig()
+	if err != nil {
+		log.Errorf("Failed to get the Kubernetes client configuration: %v", err)
+		return 1
+	}
+	scheme := runtime.NewScheme()
+	if err := corev1.AddToScheme(scheme); err != nil {
+		log.Errorf("Failed to build the scheme: %v", err)
+		return 1
+	}
+	mgr, err := ctrl.NewManager(restCfg, ctrl.Options{
+		Scheme:           scheme,
+		Metrics:          metricsserver.Options{BindAddress: "0"},
+		LeaderElection:   true,
+		LeaderElectionID: leaderElectionID,
+	})
+	if err != nil {
+		log.Errorf("Failed to create the controller manager: %v", err)
+		return 1
+	}
+
+	reconciler := &enicleanup.NodeReconciler{
+		Client:      mgr.GetClient(),
+		EC2:         ec2Client,
+		ClusterName: utils.GetEnv(envClusterName, ""),
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		log.Errorf("Failed to set up the node controller: %v", err)
+		return 1
+	}
+
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		log.Errorf("Controller manager stopped: %v", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,114 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Mutating admission webhook of the pods
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/aws/amazon-vpc-resource-controller-k8s/apis/vpcresources/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/podwebhook"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/version"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	// Environment variables with the directory of the tls.crt and tls.key of the server, and the port it listens on
+	envCertDir     = "WEBHOOK_CERT_DIR"
+	envPort        = "WEBHOOK_PORT"
+	defaultCertDir = "/etc/pod-webhook/certs"
+	defaultPort    = 9443
+
+	// Environment variable to request the vpc.amazonaws.com/pod-ip resource in the pods
+	envInjectPodIPResource = "INJECT_POD_IP_RESOURCE"
+	// Environment variable to request the vpc.amazonaws.com/pod-eni resource in the pods matched by a SecurityGroupPolicy
+	envInjectPodENIResource = "INJECT_POD_ENI_RESOURCE"
+	// Environment variable to add the nodes of the ENIConfigs required by the annotations of the pods to their affinity
+	envPlacementHints = "ENABLE_PLACEMENT_HINTS"
+
+	healthProbeBindAddress = ":8081"
+)
+
+func main() {
+	os.Exit(_main())
+}
+
+func _main() int {
+	log := logger.Get()
+	log.Infof("Starting pod webhook %s ...", version.Version)
+	ctrl.SetLogger(zap.New())
+
+	port, err := strconv.Atoi(utils.GetEnv(envPort, strconv.Itoa(defaultPort)))
+	if err != nil {
+		log.Errorf("Invalid %s: %v", envPort, err)
+		return 1
+	}
+	restCfg, err := k8sapi.GetRestConfig()
+	if err != nil {
+		log.Errorf("Failed to get the Kubernetes client configuration: %v", err)
+		return 1
+	}
+	scheme := runtime.NewScheme()
+	for _, addToScheme := range []func(*runtime.Scheme) error{corev1.AddToScheme, v1alpha1.AddToScheme, v1beta1.AddToScheme} {
+		if err := addToScheme(scheme); err != nil {
+			log.Errorf("Failed to build the scheme: %v", err)
+			return 1
+		}
+	}
+	// The webhook keeps no state, so every replica serves requests without leader election
+	mgr, err := ctrl.NewManager(restCfg, ctrl.Options{
+		Scheme:                 scheme,
+		Metrics:                metricsserver.Options{BindAddress: "0"},
+		HealthProbeBindAddress: healthProbeBindAddress,
+		WebhookServer: webhook.NewServer(webhook.Options{
+			Port:    port,
+			CertDir: utils.GetEnv(envCertDir, defaultCertDir),
+		}),
+	})
+	if err != nil {
+		log.Errorf("Failed to create the controller manager: %v", err)
+		return 1
+	}
+
+	mutator := &podwebhook.Mutator{
+		Decoder:              admission.NewDecoder(scheme),
+		Client:               mgr.GetClient(),
+		InjectPodIPResource:  utils.GetBoolAsStringEnvVar(envInjectPodIPResource, false),
+		InjectPodENIResource: utils.GetBoolAsStringEnvVar(envInjectPodENIResource, false),
+		PlacementHints:       utils.GetBoolAsStringEnvVar(envPlacementHints, false),
+	}
+	mgr.GetWebhookServer().Register(podwebhook.Path, &webhook.Admission{Handler: mutator})
+	if err := mgr.AddReadyzCheck("webhook", mgr.GetWebhookServer().StartedChecker()); err != nil {
+		log.Errorf("Failed to set up the readiness check: %v", err)
+		return 1
+	}
+
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		log.Errorf("Controller manager stopped: %v", err)
+		return 1
+	}
+	return 0
+}
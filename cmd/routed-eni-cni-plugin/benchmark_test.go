@@ -0,0 +1,88 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/containernetworking/cni/pkg/skel"
+	"github.com/golang/mock/gomock"
+	"google.golang.org/grpc"
+
+	mock_driver "github.com/aws/amazon-vpc-cni-k8s/cmd/routed-eni-cni-plugin/driver/mocks"
+	mock_grpcwrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/grpcwrapper/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iplease"
+	mock_rpcwrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/rpcwrapper/mocks"
+	mock_typeswrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/typeswrapper/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/benchgate"
+	"github.com/aws/amazon-vpc-cni-k8s/rpc"
+	mock_rpc "github.com/aws/amazon-vpc-cni-k8s/rpc/mocks"
+)
+
+// benchmarkCmdAddDel measures cmdAdd and cmdDel of the plugin against an ipamd and a network driver that do nothing
+func benchmarkCmdAddDel(b *testing.B) {
+	ipLeasePath = filepath.Join(b.TempDir(), "ip-leases")
+	defer func() { ipLeasePath = iplease.DefaultPath }()
+
+	ctrl := gomock.NewController(b)
+	defer ctrl.Finish()
+	mocksTypes := mock_typeswrapper.NewMockCNITYPES(ctrl)
+	mocksGRPC := mock_grpcwrapper.NewMockGRPC(ctrl)
+	mocksRPC := mock_rpcwrapper.NewMockRPC(ctrl)
+	mocksNetwork := mock_driver.NewMockNetworkAPIs(ctrl)
+
+	// Each call opens its own logger like the plugin binary does, a log file would be opened and left open every time
+	conf := *netConf
+	conf.PluginLogLevel = "Error"
+	conf.PluginLogFile = "stderr"
+	stdinData, _ := json.Marshal(conf)
+	cmdArgs := &skel.CmdArgs{ContainerID: containerID, Netns: netNS, IfName: ifName, StdinData: stdinData}
+
+	conn, _ := grpc.Dial(ipamdAddress, grpc.WithInsecure())
+	mockC := mock_rpc.NewMockCNIBackendClient(ctrl)
+	mocksTypes.EXPECT().LoadArgs(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mocksTypes.EXPECT().PrintResult(gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mocksGRPC.EXPECT().Dial(gomock.Any(), gomock.Any()).Return(conn, nil).AnyTimes()
+	mocksRPC.EXPECT().NewCNIBackendClient(conn).Return(mockC).AnyTimes()
+	mockC.EXPECT().AddNetwork(gomock.Any(), gomock.Any()).Return(
+		&rpc.AddNetworkReply{Success: true, IPv4Addr: ipAddr, DeviceNumber: devNum, NetworkPolicyMode: "none"}, nil).AnyTimes()
+	mockC.EXPECT().DelNetwork(gomock.Any(), gomock.Any()).Return(
+		&rpc.DelNetworkReply{Success: true, IPv4Addr: ipAddr, DeviceNumber: devNum}, nil).AnyTimes()
+	mocksNetwork.EXPECT().SetupPodNetwork(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(),
+		gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+	mocksNetwork.EXPECT().TeardownPodNetwork(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil).AnyTimes()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := add(cmdArgs, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork); err != nil {
+			b.Fatal(err)
+		}
+		if err := del(cmdArgs, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCmdAddDel(b *testing.B) {
+	benchmarkCmdAddDel(b)
+}
+
+// TestBenchmarkRegression fails when cmdAdd and cmdDel get slower than testdata/benchmark_baseline.json, see benchgate
+func TestBenchmarkRegression(t *testing.T) {
+	benchgate.Check(t, "testdata/benchmark_baseline.json", []benchgate.Benchmark{
+		{Name: "CmdAddDel", F: benchmarkCmdAddDel},
+	})
+}
@@ -22,6 +22,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/containernetworking/cni/pkg/skel"
 	"github.com/containernetworking/cni/pkg/types"
@@ -29,18 +30,26 @@ import (
 	cniSpecVersion "github.com/containernetworking/cni/pkg/version"
 	"github.com/pkg/errors"
 	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/aws/amazon-vpc-cni-k8s/cmd/routed-eni-cni-plugin/driver"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/delspool"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/featuregate"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/grpcwrapper"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iplease"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/rpcwrapper"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/sgpp"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/typeswrapper"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/podsetup"
 	pb "github.com/aws/amazon-vpc-cni-k8s/rpc"
 	"github.com/aws/amazon-vpc-cni-k8s/utils"
 )
@@ -51,6 +60,16 @@ const npAgentAddress = "127.0.0.1:50052"
 
 const dummyInterfacePrefix = "dummy"
 
+// delNetworkTimeout bounds the time the DEL waits for ipamd, a DEL that times out is spooled for ipamd to release
+const delNetworkTimeout = 10 * time.Second
+
+// ipLeasePath, delSpoolPath and podSetupReportPath are variables so that tests can use temporary files
+var (
+	ipLeasePath        = iplease.DefaultPath
+	delSpoolPath       = delspool.DefaultPath
+	podSetupReportPath = podsetup.DefaultReportPath
+)
+
 var version string
 
 // NetConf stores the common network config for the CNI plugin
@@ -71,6 +90,28 @@ type NetConf struct {
 	PluginLogFile string `json:"pluginLogFile"`
 
 	PluginLogLevel string `json:"pluginLogLevel"`
+
+	// PluginLogMaxSize is the size in MB at which the plugin log file is rotated
+	PluginLogMaxSize string `json:"pluginLogMaxSize"`
+
+	// PluginLogMaxBackups is the number of rotated plugin log files to keep
+	PluginLogMaxBackups string `json:"pluginLogMaxBackups"`
+
+	// PluginLogMaxAge is the number of days to keep rotated plugin log files
+	PluginLogMaxAge string `json:"pluginLogMaxAge"`
+
+	// PodRouteTables gives each IPv4 pod its own route table instead of the route table of its ENI
+	PodRouteTables string `json:"podRouteTables"`
+
+	// FeatureGates are the feature gates of aws-node, passed on by aws-vpc-cni
+	FeatureGates string `json:"featureGates"`
+
+	featureGate *featuregate.FeatureGate
+}
+
+func (conf *NetConf) podRouteTables() bool {
+	enabled, _ := strconv.ParseBool(conf.PodRouteTables)
+	return enabled
 }
 
 // K8sArgs is the valid CNI_ARGS used for Kubernetes
@@ -85,6 +126,9 @@ type K8sArgs struct {
 
 	// K8S_POD_INFRA_CONTAINER_ID is pod's sandbox id
 	K8S_POD_INFRA_CONTAINER_ID types.UnmarshallableString
+
+	// K8S_POD_UID is pod's UID
+	K8S_POD_UID types.UnmarshallableString
 }
 
 func init() {
@@ -115,15 +159,39 @@ func LoadNetConf(bytes []byte) (*NetConf, logger.Logger, error) {
 	logConfig := logger.Configuration{
 		LogLevel:    conf.PluginLogLevel,
 		LogLocation: conf.PluginLogFile,
+		// Invalid values fall back to the default rotation settings
+		MaxSizeMB:  parseLogRotationValue(conf.PluginLogMaxSize),
+		MaxBackups: parseLogRotationValue(conf.PluginLogMaxBackups),
+		MaxAgeDays: parseLogRotationValue(conf.PluginLogMaxAge),
 	}
 	log := logger.New(&logConfig)
 
+	// aws-vpc-cni only writes the valid gates, the others come from a conflist written by another version
+	var errs []error
+	conf.featureGate, errs = featuregate.Parse(conf.FeatureGates)
+	for _, err := range errs {
+		log.Debugf("%v", err)
+	}
+
 	if len(conf.VethPrefix) > 4 {
 		return nil, nil, errors.New("conf.VethPrefix can be at most 4 characters long")
 	}
 	return &conf, log, nil
 }
 
+// parseLogRotationValue returns the integer value of a log rotation setting, or 0 to use the default. A setting of 0
+// removes the limit, the logger ignores it for the size.
+func parseLogRotationValue(value string) int {
+	parsed, err := strconv.Atoi(value)
+	switch {
+	case err != nil || parsed < 0:
+		return 0
+	case parsed == 0:
+		return logger.LogRotationUnlimited
+	}
+	return parsed
+}
+
 func cmdAdd(args *skel.CmdArgs) error {
 	return add(args, typeswrapper.New(), grpcwrapper.New(), rpcwrapper.New(), driver.New())
 }
@@ -135,6 +203,9 @@ func add(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 	if err != nil {
 		return errors.Wrap(err, "add cmd: error loading config from args")
 	}
+	traceID := logger.NewTraceID()
+	log = log.WithFields(logger.Fields{logger.TraceIDKey: traceID})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), logger.TraceIDMetadataKey, traceID)
 
 	log.Infof("Received CNI add request: ContainerID(%s) Netns(%s) IfName(%s) Args(%s) Path(%s) argsStdinData(%s)",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path, args.StdinData)
@@ -162,20 +233,32 @@ func add(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 
 	c := rpcClient.NewCNIBackendClient(conn)
 
-	r, err := c.AddNetwork(context.Background(),
-		&pb.AddNetworkRequest{
-			ClientVersion:              version,
-			K8S_POD_NAME:               string(k8sArgs.K8S_POD_NAME),
-			K8S_POD_NAMESPACE:          string(k8sArgs.K8S_POD_NAMESPACE),
-			K8S_POD_INFRA_CONTAINER_ID: string(k8sArgs.K8S_POD_INFRA_CONTAINER_ID),
-			Netns:                      args.Netns,
-			ContainerID:                args.ContainerID,
-			NetworkName:                conf.Name,
-			IfName:                     args.IfName,
-		})
+	timer := podsetup.NewTimer()
+	ipamdStart := time.Now()
+	// An IP leased by ipamd ahead of time saves the round trip, ipamd confirms it asynchronously
+	r := claimIPLease(args, conf, k8sArgs, log)
+	if r == nil {
+		r, err = c.AddNetwork(ctx,
+			&pb.AddNetworkRequest{
+				ClientVersion:              version,
+				K8S_POD_NAME:               string(k8sArgs.K8S_POD_NAME),
+				K8S_POD_NAMESPACE:          string(k8sArgs.K8S_POD_NAMESPACE),
+				K8S_POD_INFRA_CONTAINER_ID: string(k8sArgs.K8S_POD_INFRA_CONTAINER_ID),
+				K8S_POD_UID:                string(k8sArgs.K8S_POD_UID),
+				Netns:                      args.Netns,
+				ContainerID:                args.ContainerID,
+				NetworkName:                conf.Name,
+				IfName:                     args.IfName,
+			})
+	}
+	timer.Observe(podsetup.PhaseIpamdWait, ipamdStart)
 
 	if err != nil {
 		log.Errorf("Error received from AddNetwork grpc call for containerID %s: %v", args.ContainerID, err)
+		// ipamd waited for an IP without getting one, the runtime can retry later
+		if status.Code(err) == codes.ResourceExhausted {
+			return types.NewError(types.ErrTryAgainLater, "no IP address available", ipWaitTimeoutDetails(status.Convert(err)))
+		}
 		return errors.Wrap(err, "add cmd: Error received from AddNetwork gRPC call")
 	}
 
@@ -219,14 +302,15 @@ func add(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 		hostVethNamePrefix := sgpp.BuildHostVethNamePrefix(conf.VethPrefix, conf.PodSGEnforcingMode)
 		hostVethName = networkutils.GeneratePodHostVethName(hostVethNamePrefix, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
 		err = driverClient.SetupBranchENIPodNetwork(hostVethName, args.IfName, args.Netns, v4Addr, v6Addr, int(r.PodVlanId), r.PodENIMAC,
-			r.PodENISubnetGW, int(r.ParentIfIndex), mtu, conf.PodSGEnforcingMode, log)
+			r.PodENISubnetGW, int(r.ParentIfIndex), mtu, conf.PodSGEnforcingMode, timer, log)
 		// For branch ENI mode, the pod VLAN ID is packed in Interface.Mac
 		dummyInterface = &current.Interface{Name: dummyInterfaceName, Mac: fmt.Sprint(r.PodVlanId)}
 	} else {
 		// build hostVethName
 		// Note: the maximum length for linux interface name is 15
 		hostVethName = networkutils.GeneratePodHostVethName(conf.VethPrefix, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
-		err = driverClient.SetupPodNetwork(hostVethName, args.IfName, args.Netns, v4Addr, v6Addr, int(r.DeviceNumber), mtu, log)
+		err = driverClient.SetupPodNetwork(hostVethName, args.IfName, args.Netns, v4Addr, v6Addr, int(r.DeviceNumber), conf.podRouteTables(),
+			mtu, timer, log)
 		// For non-branch ENI, the pod VLAN ID value of 0 is packed in Interface.Mac, while the interface device number is packed in Interface.Sandbox
 		dummyInterface = &current.Interface{Name: dummyInterfaceName, Mac: fmt.Sprint(0), Sandbox: fmt.Sprint(r.DeviceNumber)}
 	}
@@ -237,11 +321,12 @@ func add(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 			args.ContainerID, err)
 
 		// return allocated IP back to IP pool
-		r, delErr := c.DelNetwork(context.Background(), &pb.DelNetworkRequest{
+		r, delErr := c.DelNetwork(ctx, &pb.DelNetworkRequest{
 			ClientVersion:              version,
 			K8S_POD_NAME:               string(k8sArgs.K8S_POD_NAME),
 			K8S_POD_NAMESPACE:          string(k8sArgs.K8S_POD_NAMESPACE),
 			K8S_POD_INFRA_CONTAINER_ID: string(k8sArgs.K8S_POD_INFRA_CONTAINER_ID),
+			K8S_POD_UID:                string(k8sArgs.K8S_POD_UID),
 			ContainerID:                args.ContainerID,
 			IfName:                     args.IfName,
 			NetworkName:                conf.Name,
@@ -280,6 +365,7 @@ func add(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 	result.Interfaces = append(result.Interfaces, dummyInterface)
 
 	if utils.IsStrictMode(r.NetworkPolicyMode) {
+		policyStart := time.Now()
 		// Set up a connection to the network policy agent
 		npConn, err := grpcClient.Dial(npAgentAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
 		if err != nil {
@@ -305,11 +391,69 @@ func add(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 		}
 
 		log.Debugf("Network Policy agent returned Success : %v", npr.Success)
+		timer.Observe(podsetup.PhasePolicyHandoff, policyStart)
 	}
 
+	reportPodSetup(args, conf, traceID, timer, log)
 	return cniTypes.PrintResult(result, conf.CNIVersion)
 }
 
+// ipWaitTimeoutDetails returns the message of ipamd, with the class of the error that kept it from allocating an IP
+func ipWaitTimeoutDetails(st *status.Status) string {
+	details := st.Message()
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			details += fmt.Sprintf(" (last allocation error: %s, retryable: %s)", info.GetReason(), info.GetMetadata()["retryable"])
+		}
+	}
+	return details
+}
+
+// reportPodSetup leaves the durations of the phases of the pod setup for ipamd, which exports them as metrics. ipamd
+// picks the report up when it serves the next ADD or DEL, so that the ADD does not wait for ipamd once the pod is set
+// up. The pod is set up whether or not the report is written.
+func reportPodSetup(args *skel.CmdArgs, conf *NetConf, traceID string, timer *podsetup.Timer, log logger.Logger) {
+	report := podsetup.NewReport(args.ContainerID, args.IfName, conf.Name, traceID, timer)
+	if err := podsetup.WriteReport(podSetupReportPath, report); err != nil {
+		log.Debugf("Failed to report the pod setup phases to ipamd: %v", err)
+	}
+}
+
+// claimIPLease claims an IP from the lease file of ipamd, and returns it as AddNetwork would. It returns nil when ipamd
+// does not lease IPs or has none left, the plugin then calls AddNetwork.
+func claimIPLease(args *skel.CmdArgs, conf *NetConf, k8sArgs K8sArgs, log logger.Logger) *pb.AddNetworkReply {
+	leases, err := iplease.Open(ipLeasePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to open the IP lease file: %v", err)
+		}
+		return nil
+	}
+	defer leases.Close()
+
+	lease, err := leases.Claim(iplease.Claim{
+		ContainerID:  args.ContainerID,
+		IfName:       args.IfName,
+		NetworkName:  conf.Name,
+		PodName:      string(k8sArgs.K8S_POD_NAME),
+		PodNamespace: string(k8sArgs.K8S_POD_NAMESPACE),
+		PodUID:       string(k8sArgs.K8S_POD_UID),
+	})
+	if err != nil {
+		if !errors.Is(err, iplease.ErrNoLease) {
+			log.Warnf("Failed to claim an IP lease for container %s: %v", args.ContainerID, err)
+		}
+		return nil
+	}
+	log.Infof("Claimed leased IP %s for container %s interface %s", lease.IPv4Addr, args.ContainerID, args.IfName)
+	return &pb.AddNetworkReply{
+		Success:           true,
+		IPv4Addr:          lease.IPv4Addr,
+		DeviceNumber:      int32(lease.DeviceNumber),
+		NetworkPolicyMode: leases.NetworkPolicyMode(),
+	}
+}
+
 func cmdDel(args *skel.CmdArgs) error {
 	return del(args, typeswrapper.New(), grpcwrapper.New(), rpcwrapper.New(), driver.New())
 }
@@ -323,6 +467,9 @@ func del(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 	if err != nil {
 		return errors.Wrap(err, "del cmd: error loading config from args")
 	}
+	traceID := logger.NewTraceID()
+	log = log.WithFields(logger.Fields{logger.TraceIDKey: traceID})
+	ctx := metadata.AppendToOutgoingContext(context.Background(), logger.TraceIDMetadataKey, traceID)
 
 	log.Infof("Received CNI del request: ContainerID(%s) Netns(%s) IfName(%s) Args(%s) Path(%s) argsStdinData(%s)",
 		args.ContainerID, args.Netns, args.IfName, args.Args, args.Path, args.StdinData)
@@ -353,25 +500,22 @@ func del(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 
 		// When IPAMD is unreachable, try to teardown pod network using previous result. This action prevents rules from leaking while IPAMD is unreachable.
 		// Note that no error is returned to kubelet as there is no guarantee that kubelet will retry delete, and returning an error would prevent container runtime
-		// from cleaning up resources. When IPAMD again becomes responsive, it is responsible for reclaiming IP.
-		if teardownPodNetworkWithPrevResult(driverClient, conf, k8sArgs, args.IfName, log) {
-			log.Infof("Handled pod teardown using prevResult: ContainerID(%s) Netns(%s) IfName(%s) PodNamespace(%s) PodName(%s)",
-				args.ContainerID, args.Netns, args.IfName, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
-		} else {
-			log.Infof("Could not teardown pod using prevResult: ContainerID(%s) Netns(%s) IfName(%s) PodNamespace(%s) PodName(%s)",
-				args.ContainerID, args.Netns, args.IfName, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
-		}
+		// from cleaning up resources. The release of the IP is spooled for IPAMD to drain when it starts again.
+		teardownAndSpoolRelease(driverClient, args, conf, k8sArgs, log)
 		return nil
 	}
 	defer conn.Close()
 
 	c := rpcClient.NewCNIBackendClient(conn)
 
-	r, err := c.DelNetwork(context.Background(), &pb.DelNetworkRequest{
+	delCtx, cancel := context.WithTimeout(ctx, delNetworkTimeout)
+	defer cancel()
+	r, err := c.DelNetwork(delCtx, &pb.DelNetworkRequest{
 		ClientVersion:              version,
 		K8S_POD_NAME:               string(k8sArgs.K8S_POD_NAME),
 		K8S_POD_NAMESPACE:          string(k8sArgs.K8S_POD_NAMESPACE),
 		K8S_POD_INFRA_CONTAINER_ID: string(k8sArgs.K8S_POD_INFRA_CONTAINER_ID),
+		K8S_POD_UID:                string(k8sArgs.K8S_POD_UID),
 		NetworkName:                conf.Name,
 		ContainerID:                args.ContainerID,
 		IfName:                     args.IfName,
@@ -388,15 +532,9 @@ func del(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 		}
 		log.Errorf("Error received from DelNetwork gRPC call for container %s: %v", args.ContainerID, err)
 
-		// DelNetworkRequest may return a connection error, so try to delete using PrevResult whenever an error is returned. As with the case above, do
-		// not return error to kubelet, as there is no guarantee that delete is retried.
-		if teardownPodNetworkWithPrevResult(driverClient, conf, k8sArgs, args.IfName, log) {
-			log.Infof("Handled pod teardown using prevResult: ContainerID(%s) Netns(%s) IfName(%s) PodNamespace(%s) PodName(%s)",
-				args.ContainerID, args.Netns, args.IfName, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
-		} else {
-			log.Infof("Could not teardown pod using prevResult: ContainerID(%s) Netns(%s) IfName(%s) PodNamespace(%s) PodName(%s)",
-				args.ContainerID, args.Netns, args.IfName, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
-		}
+		// DelNetworkRequest may return a connection error or time out, so try to delete using PrevResult whenever an error is returned. As with the
+		// case above, do not return error to kubelet, as there is no guarantee that delete is retried.
+		teardownAndSpoolRelease(driverClient, args, conf, k8sArgs, log)
 		return nil
 	}
 
@@ -447,6 +585,35 @@ func del(args *skel.CmdArgs, cniTypes typeswrapper.CNITYPES, grpcClient grpcwrap
 	return nil
 }
 
+// teardownAndSpoolRelease tears the pod network down using prevResult, and spools the release of the IP for ipamd,
+// which could not be reached
+func teardownAndSpoolRelease(driverClient driver.NetworkAPIs, args *skel.CmdArgs, conf *NetConf, k8sArgs K8sArgs, log logger.Logger) {
+	if teardownPodNetworkWithPrevResult(driverClient, conf, k8sArgs, args.IfName, log) {
+		log.Infof("Handled pod teardown using prevResult: ContainerID(%s) Netns(%s) IfName(%s) PodNamespace(%s) PodName(%s)",
+			args.ContainerID, args.Netns, args.IfName, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
+	} else {
+		log.Infof("Could not teardown pod using prevResult: ContainerID(%s) Netns(%s) IfName(%s) PodNamespace(%s) PodName(%s)",
+			args.ContainerID, args.Netns, args.IfName, string(k8sArgs.K8S_POD_NAMESPACE), string(k8sArgs.K8S_POD_NAME))
+	}
+
+	err := delspool.Write(delSpoolPath, delspool.Release{
+		ContainerID:   args.ContainerID,
+		IfName:        args.IfName,
+		NetworkName:   conf.Name,
+		PodName:       string(k8sArgs.K8S_POD_NAME),
+		PodNamespace:  string(k8sArgs.K8S_POD_NAMESPACE),
+		PodUID:        string(k8sArgs.K8S_POD_UID),
+		ClientVersion: version,
+		SpooledAt:     time.Now(),
+	})
+	if err != nil {
+		// The IP is still reclaimed by the reconciliation of ipamd, once the pod is gone
+		log.Errorf("Failed to spool the release of the IP of container %s: %v", args.ContainerID, err)
+		return
+	}
+	log.Infof("Spooled the release of the IP of container %s for ipamd", args.ContainerID)
+}
+
 func getContainerIP(prevResult *current.Result, contVethName string) (net.IPNet, error) {
 	containerIfaceIndex, _, found := cniutils.FindInterfaceByName(prevResult.Interfaces, contVethName)
 	if !found {
@@ -17,10 +17,14 @@ import (
 	"encoding/json"
 	"errors"
 	"net"
+	"path/filepath"
 	"testing"
 
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/delspool"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iplease"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/sgpp"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/podsetup"
 	"github.com/aws/aws-sdk-go/aws"
 	current "github.com/containernetworking/cni/pkg/types/100"
 
@@ -28,7 +32,10 @@ import (
 	"github.com/containernetworking/cni/pkg/types"
 	"github.com/golang/mock/gomock"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 
 	mock_driver "github.com/aws/amazon-vpc-cni-k8s/cmd/routed-eni-cni-plugin/driver/mocks"
 	mock_grpcwrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/grpcwrapper/mocks"
@@ -68,6 +75,11 @@ func setup(t *testing.T) (*gomock.Controller,
 	*mock_rpcwrapper.MockRPC,
 	*mock_driver.MockNetworkAPIs) {
 	ctrl := gomock.NewController(t)
+	// The DELs that do not reach ipamd are spooled
+	delSpoolPath = filepath.Join(t.TempDir(), "del-spool")
+	t.Cleanup(func() { delSpoolPath = delspool.DefaultPath })
+	podSetupReportPath = filepath.Join(t.TempDir(), "pod-setup-reports")
+	t.Cleanup(func() { podSetupReportPath = podsetup.DefaultReportPath })
 	return ctrl,
 		mock_typeswrapper.NewMockCNITYPES(ctrl),
 		mock_grpcwrapper.NewMockGRPC(ctrl),
@@ -102,7 +114,7 @@ func TestCmdAdd(t *testing.T) {
 		Mask: net.IPv4Mask(255, 255, 255, 255),
 	}
 	mocksNetwork.EXPECT().SetupPodNetwork(gomock.Any(), cmdArgs.IfName, cmdArgs.Netns,
-		v4Addr, nil, int(addNetworkReply.DeviceNumber), gomock.Any(), gomock.Any()).Return(nil)
+		v4Addr, nil, int(addNetworkReply.DeviceNumber), false, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 	mocksTypes.EXPECT().PrintResult(gomock.Any(), gomock.Any()).Return(nil)
 
@@ -110,6 +122,52 @@ func TestCmdAdd(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestCmdAddWithIPLease(t *testing.T) {
+	ctrl, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork := setup(t)
+	defer ctrl.Finish()
+
+	ipLeasePath = filepath.Join(t.TempDir(), "ip-leases")
+	defer func() { ipLeasePath = iplease.DefaultPath }()
+	leases, err := iplease.Create(ipLeasePath, 1, "none")
+	assert.NoError(t, err)
+	defer leases.Close()
+	_, err = leases.Offer([]iplease.Lease{{IPv4Addr: ipAddr, DeviceNumber: devNum}})
+	assert.NoError(t, err)
+
+	stdinData, _ := json.Marshal(netConf)
+
+	cmdArgs := &skel.CmdArgs{ContainerID: containerID,
+		Netns:     netNS,
+		IfName:    ifName,
+		StdinData: stdinData}
+
+	mocksTypes.EXPECT().LoadArgs(gomock.Any(), gomock.Any()).Return(nil)
+
+	conn, _ := grpc.Dial(ipamdAddress, grpc.WithInsecure())
+
+	mocksGRPC.EXPECT().Dial(gomock.Any(), gomock.Any()).Return(conn, nil)
+	mockC := mock_rpc.NewMockCNIBackendClient(ctrl)
+	mocksRPC.EXPECT().NewCNIBackendClient(conn).Return(mockC)
+
+	// The leased IP is used without calling AddNetwork
+	v4Addr := &net.IPNet{
+		IP:   net.ParseIP(ipAddr),
+		Mask: net.IPv4Mask(255, 255, 255, 255),
+	}
+	mocksNetwork.EXPECT().SetupPodNetwork(gomock.Any(), cmdArgs.IfName, cmdArgs.Netns,
+		v4Addr, nil, devNum, false, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
+
+	mocksTypes.EXPECT().PrintResult(gomock.Any(), gomock.Any()).Return(nil)
+
+	err = add(cmdArgs, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork)
+	assert.Nil(t, err)
+
+	claimed, err := leases.TakeClaims()
+	assert.NoError(t, err)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, containerID, claimed[0].ContainerID)
+}
+
 func TestCmdAddWithNPenabled(t *testing.T) {
 	ctrl, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork := setup(t)
 	defer ctrl.Finish()
@@ -146,12 +204,23 @@ func TestCmdAddWithNPenabled(t *testing.T) {
 		Mask: net.IPv4Mask(255, 255, 255, 255),
 	}
 	mocksNetwork.EXPECT().SetupPodNetwork(gomock.Any(), cmdArgs.IfName, cmdArgs.Netns,
-		v4Addr, nil, int(addNetworkReply.DeviceNumber), gomock.Any(), gomock.Any()).Return(nil)
+		v4Addr, nil, int(addNetworkReply.DeviceNumber), false, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 	mocksTypes.EXPECT().PrintResult(gomock.Any(), gomock.Any()).Return(nil)
 
 	err := add(cmdArgs, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork)
 	assert.Nil(t, err)
+
+	// The phases are left for ipamd, without waiting for it
+	var phases []string
+	drained, errs := podsetup.DrainReports(podSetupReportPath, func(report podsetup.Report) {
+		for phase := range report.Phases {
+			phases = append(phases, phase)
+		}
+	})
+	assert.Equal(t, 1, drained)
+	assert.Empty(t, errs)
+	assert.ElementsMatch(t, []string{podsetup.PhaseIpamdWait, podsetup.PhasePolicyHandoff}, phases)
 }
 
 func TestCmdAddWithNPenabledWithErr(t *testing.T) {
@@ -190,7 +259,7 @@ func TestCmdAddWithNPenabledWithErr(t *testing.T) {
 		Mask: net.IPv4Mask(255, 255, 255, 255),
 	}
 	mocksNetwork.EXPECT().SetupPodNetwork(gomock.Any(), cmdArgs.IfName, cmdArgs.Netns,
-		v4Addr, nil, int(addNetworkReply.DeviceNumber), gomock.Any(), gomock.Any()).Return(nil)
+		v4Addr, nil, int(addNetworkReply.DeviceNumber), false, gomock.Any(), gomock.Any(), gomock.Any()).Return(nil)
 
 	err := add(cmdArgs, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork)
 	assert.Error(t, err)
@@ -223,6 +292,45 @@ func TestCmdAddNetworkErr(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestCmdAddNoIPAvailable(t *testing.T) {
+	ctrl, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork := setup(t)
+	defer ctrl.Finish()
+
+	stdinData, _ := json.Marshal(netConf)
+
+	cmdArgs := &skel.CmdArgs{ContainerID: containerID,
+		Netns:     netNS,
+		IfName:    ifName,
+		StdinData: stdinData}
+
+	mocksTypes.EXPECT().LoadArgs(gomock.Any(), gomock.Any()).Return(nil)
+
+	conn, _ := grpc.Dial(ipamdAddress, grpc.WithInsecure())
+
+	mocksGRPC.EXPECT().Dial(gomock.Any(), gomock.Any()).Return(conn, nil)
+	mockC := mock_rpc.NewMockCNIBackendClient(ctrl)
+	mocksRPC.EXPECT().NewCNIBackendClient(conn).Return(mockC)
+
+	mockC.EXPECT().AddNetwork(gomock.Any(), gomock.Any()).Return(nil, status.Error(codes.ResourceExhausted, "no IP allocated in time"))
+
+	err := add(cmdArgs, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork)
+
+	var cniErr *types.Error
+	if assert.ErrorAs(t, err, &cniErr) {
+		assert.Equal(t, types.ErrTryAgainLater, cniErr.Code)
+		assert.Equal(t, "no IP allocated in time", cniErr.Details)
+	}
+}
+
+func TestIPWaitTimeoutDetails(t *testing.T) {
+	st := status.New(codes.ResourceExhausted, "no IP allocated in time")
+	assert.Equal(t, "no IP allocated in time", ipWaitTimeoutDetails(st))
+
+	st, err := st.WithDetails(&errdetails.ErrorInfo{Reason: "throttled", Metadata: map[string]string{"retryable": "true"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "no IP allocated in time (last allocation error: throttled, retryable: true)", ipWaitTimeoutDetails(st))
+}
+
 func TestCmdAddErrSetupPodNetwork(t *testing.T) {
 	ctrl, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork := setup(t)
 	defer ctrl.Finish()
@@ -251,7 +359,7 @@ func TestCmdAddErrSetupPodNetwork(t *testing.T) {
 	}
 
 	mocksNetwork.EXPECT().SetupPodNetwork(gomock.Any(), cmdArgs.IfName, cmdArgs.Netns,
-		addr, nil, int(addNetworkReply.DeviceNumber), gomock.Any(), gomock.Any()).Return(errors.New("error on SetupPodNetwork"))
+		addr, nil, int(addNetworkReply.DeviceNumber), false, gomock.Any(), gomock.Any(), gomock.Any()).Return(errors.New("error on SetupPodNetwork"))
 
 	// when SetupPodNetwork fails, expect to return IP back to datastore
 	delNetworkReply := &rpc.DelNetworkReply{Success: true, IPv4Addr: ipAddr, DeviceNumber: devNum}
@@ -322,6 +430,18 @@ func TestCmdDelErrDelNetwork(t *testing.T) {
 	// On DelNetwork fail, the CNI must not return an error to kubelet as deletes are best-effort.
 	err := del(cmdArgs, mocksTypes, mocksGRPC, mocksRPC, mocksNetwork)
 	assert.Nil(t, err)
+
+	// The release of the IP is spooled for ipamd
+	var released []delspool.Release
+	drained, errs := delspool.Drain(delSpoolPath, func(r delspool.Release) error {
+		released = append(released, r)
+		return nil
+	})
+	assert.Empty(t, errs)
+	assert.Equal(t, 1, drained)
+	assert.Equal(t, containerID, released[0].ContainerID)
+	assert.Equal(t, ifName, released[0].IfName)
+	assert.Equal(t, cniName, released[0].NetworkName)
 }
 
 func TestCmdDelErrTeardown(t *testing.T) {
@@ -386,7 +506,7 @@ func TestCmdAddForPodENINetwork(t *testing.T) {
 		Mask: net.IPv4Mask(255, 255, 255, 255),
 	}
 	mocksNetwork.EXPECT().SetupBranchENIPodNetwork(gomock.Any(), cmdArgs.IfName, cmdArgs.Netns, addr, nil, 1, "eniHardwareAddr",
-		"10.0.0.1", 2, gomock.Any(), sgpp.EnforcingModeStrict, gomock.Any()).Return(nil)
+		"10.0.0.1", 2, gomock.Any(), sgpp.EnforcingModeStrict, gomock.Any(), gomock.Any()).Return(nil)
 
 	mocksTypes.EXPECT().PrintResult(gomock.Any(), gomock.Any()).Return(nil)
 
@@ -1126,3 +1246,22 @@ func Test_teardownPodNetworkWithPrevResult(t *testing.T) {
 		})
 	}
 }
+
+func Test_parseLogRotationValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  int
+	}{
+		{name: "valid value", value: "10", want: 10},
+		{name: "empty value uses default", value: "", want: 0},
+		{name: "invalid value uses default", value: "ten", want: 0},
+		{name: "negative value uses default", value: "-1", want: 0},
+		{name: "zero removes the limit", value: "0", want: logger.LogRotationUnlimited},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseLogRotationValue(tt.value))
+		})
+	}
+}
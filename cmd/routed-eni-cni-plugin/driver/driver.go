@@ -35,6 +35,7 @@ import (
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/podsetup"
 )
 
 const (
@@ -47,14 +48,15 @@ const (
 
 // NetworkAPIs defines network API calls
 type NetworkAPIs interface {
-	// SetupPodNetwork sets up pod network for normal ENI based pods
-	SetupPodNetwork(hostVethName string, contVethName string, netnsPath string, v4Addr *net.IPNet, v6Addr *net.IPNet, deviceNumber int, mtu int, log logger.Logger) error
+	// SetupPodNetwork sets up pod network for normal ENI based pods, in a route table of its own if podRouteTable is set
+	SetupPodNetwork(hostVethName string, contVethName string, netnsPath string, v4Addr *net.IPNet, v6Addr *net.IPNet, deviceNumber int,
+		podRouteTable bool, mtu int, timer *podsetup.Timer, log logger.Logger) error
 	// TeardownPodNetwork clean up pod network for normal ENI based pods
 	TeardownPodNetwork(containerAddr *net.IPNet, deviceNumber int, log logger.Logger) error
 
 	// SetupBranchENIPodNetwork sets up pod network for branch ENI based pods
 	SetupBranchENIPodNetwork(hostVethName string, contVethName string, netnsPath string, v4Addr *net.IPNet, v6Addr *net.IPNet, vlanID int, eniMAC string,
-		subnetGW string, parentIfIndex int, mtu int, podSGEnforcingMode sgpp.EnforcingMode, log logger.Logger) error
+		subnetGW string, parentIfIndex int, mtu int, podSGEnforcingMode sgpp.EnforcingMode, timer *podsetup.Timer, log logger.Logger) error
 	// TeardownBranchENIPodNetwork cleans up pod network for branch ENI based pods
 	TeardownBranchENIPodNetwork(containerAddr *net.IPNet, vlanID int, podSGEnforcingMode sgpp.EnforcingMode, log logger.Logger) error
 }
@@ -230,14 +232,16 @@ func (createVethContext *createVethPairContext) run(hostNS ns.NetNS) error {
 // SetupPodNetwork wires up linux networking for a pod's network
 // we expect v4Addr and v6Addr to have correct IPAddress Family.
 func (n *linuxNetwork) SetupPodNetwork(hostVethName string, contVethName string, netnsPath string, v4Addr *net.IPNet, v6Addr *net.IPNet,
-	deviceNumber int, mtu int, log logger.Logger) error {
-	log.Debugf("SetupPodNetwork: hostVethName=%s, contVethName=%s, netnsPath=%s, v4Addr=%v, v6Addr=%v, deviceNumber=%d, mtu=%d",
-		hostVethName, contVethName, netnsPath, v4Addr, v6Addr, deviceNumber, mtu)
+	deviceNumber int, podRouteTable bool, mtu int, timer *podsetup.Timer, log logger.Logger) error {
+	log.Debugf("SetupPodNetwork: hostVethName=%s, contVethName=%s, netnsPath=%s, v4Addr=%v, v6Addr=%v, deviceNumber=%d, podRouteTable=%t, mtu=%d",
+		hostVethName, contVethName, netnsPath, v4Addr, v6Addr, deviceNumber, podRouteTable, mtu)
 
+	linkStart := time.Now()
 	hostVeth, err := n.setupVeth(hostVethName, contVethName, netnsPath, v4Addr, v6Addr, mtu, log)
 	if err != nil {
 		return errors.Wrapf(err, "SetupPodNetwork: failed to setup veth pair")
 	}
+	timer.Observe(podsetup.PhaseLinkSetup, linkStart)
 
 	var containerAddr *net.IPNet
 	if v4Addr != nil {
@@ -250,9 +254,19 @@ func (n *linuxNetwork) SetupPodNetwork(hostVethName string, contVethName string,
 	if deviceNumber > 0 {
 		rtTable = deviceNumber + 1
 	}
+	routeStart := time.Now()
+	// The per-pod route tables are IPv4 only
+	if podRouteTable && v4Addr != nil {
+		podTable := networkutils.PodRouteTable(v4Addr.IP)
+		if err := networkutils.SetupPodRouteTable(n.netLink, rtTable, podTable); err != nil {
+			return errors.Wrapf(err, "SetupPodNetwork: unable to setup the route table of the pod")
+		}
+		rtTable = podTable
+	}
 	if err := n.setupIPBasedContainerRouteRules(hostVeth, containerAddr, rtTable, log); err != nil {
 		return errors.Wrapf(err, "SetupPodNetwork: unable to setup IP based container routes and rules")
 	}
+	timer.Observe(podsetup.PhaseRouteRuleProgramming, routeStart)
 	return nil
 }
 
@@ -264,29 +278,44 @@ func (n *linuxNetwork) TeardownPodNetwork(containerAddr *net.IPNet, deviceNumber
 	if deviceNumber > 0 {
 		rtTable = deviceNumber + 1
 	}
+	isV4 := containerAddr.IP.To4() != nil
+	if isV4 {
+		// Removes the rule of the pod whichever table it uses, the table of its ENI or its own route table, since
+		// ENABLE_POD_ROUTE_TABLES may have been changed after the pod was set up
+		rtTable = unix.RT_TABLE_UNSPEC
+	}
 	if err := n.teardownIPBasedContainerRouteRules(containerAddr, rtTable, log); err != nil {
 		return errors.Wrapf(err, "TeardownPodNetwork: unable to teardown IP based container routes and rules")
 	}
+	if isV4 {
+		// The route table of the pod is empty unless the pod was set up with ENABLE_POD_ROUTE_TABLES
+		if err := networkutils.TeardownPodRouteTable(n.netLink, networkutils.PodRouteTable(containerAddr.IP)); err != nil {
+			return errors.Wrapf(err, "TeardownPodNetwork: unable to teardown the route table of the pod")
+		}
+	}
 	return nil
 }
 
 // SetupBranchENIPodNetwork sets up the network ns for pods requesting its own security group
 // we expect v4Addr and v6Addr to have correct IPAddress Family.
 func (n *linuxNetwork) SetupBranchENIPodNetwork(hostVethName string, contVethName string, netnsPath string, v4Addr *net.IPNet, v6Addr *net.IPNet,
-	vlanID int, eniMAC string, subnetGW string, parentIfIndex int, mtu int, podSGEnforcingMode sgpp.EnforcingMode, log logger.Logger) error {
+	vlanID int, eniMAC string, subnetGW string, parentIfIndex int, mtu int, podSGEnforcingMode sgpp.EnforcingMode, timer *podsetup.Timer, log logger.Logger) error {
 	log.Debugf("SetupBranchENIPodNetwork: hostVethName=%s, contVethName=%s, netnsPath=%s, v4Addr=%v, v6Addr=%v, vlanID=%d, eniMAC=%s, subnetGW=%s, parentIfIndex=%d, mtu=%d, podSGEnforcingMode=%v",
 		hostVethName, contVethName, netnsPath, v4Addr, v6Addr, vlanID, eniMAC, subnetGW, parentIfIndex, mtu, podSGEnforcingMode)
 
+	linkStart := time.Now()
 	hostVeth, err := n.setupVeth(hostVethName, contVethName, netnsPath, v4Addr, v6Addr, mtu, log)
 	if err != nil {
 		return errors.Wrapf(err, "SetupBranchENIPodNetwork: failed to setup veth pair")
 	}
+	timer.Observe(podsetup.PhaseLinkSetup, linkStart)
 
 	// clean up any previous hostVeth ip rule recursively. (when pod with same name are recreated multiple times).
 	//
 	// per our understanding, previous we obtain vlanID from pod spec, it could be possible the vlanID is already updated when deleting old pod, thus the hostVeth been cleaned up during oldPod deletion is incorrect.
 	// now since we obtain vlanID from prevResult during pod deletion, we should be able to correctly purge hostVeth during pod deletion and thus don't need this logic.
 	// this logic is kept here for safety purpose.
+	routeStart := time.Now()
 	oldFromHostVethRule := n.netLink.NewRule()
 	oldFromHostVethRule.IifName = hostVethName
 	oldFromHostVethRule.Priority = networkutils.VlanRulePriority
@@ -296,12 +325,15 @@ func (n *linuxNetwork) SetupBranchENIPodNetwork(hostVethName string, contVethNam
 	if err := networkutils.NetLinkRuleDelAll(n.netLink, oldFromHostVethRule); err != nil {
 		return errors.Wrapf(err, "SetupBranchENIPodNetwork: failed to delete hostVeth rule for %s", hostVethName)
 	}
+	timer.Observe(podsetup.PhaseRouteRuleProgramming, routeStart)
 
+	linkStart = time.Now()
 	rtTable := vlanID + 100
 	vlanLink, err := n.setupVlan(vlanID, eniMAC, subnetGW, parentIfIndex, rtTable, log)
 	if err != nil {
 		return errors.Wrapf(err, "SetupBranchENIPodNetwork: failed to setup vlan")
 	}
+	timer.Observe(podsetup.PhaseLinkSetup, linkStart)
 
 	var containerAddr *net.IPNet
 	if v4Addr != nil {
@@ -310,6 +342,7 @@ func (n *linuxNetwork) SetupBranchENIPodNetwork(hostVethName string, contVethNam
 		containerAddr = v6Addr
 	}
 
+	routeStart = time.Now()
 	switch podSGEnforcingMode {
 	case sgpp.EnforcingModeStrict:
 		if err := n.setupIIFBasedContainerRouteRules(hostVeth, containerAddr, vlanLink, rtTable, log); err != nil {
@@ -320,6 +353,7 @@ func (n *linuxNetwork) SetupBranchENIPodNetwork(hostVethName string, contVethNam
 			return errors.Wrapf(err, "SetupBranchENIPodNetwork: unable to setup IP based container routes and rules")
 		}
 	}
+	timer.Observe(podsetup.PhaseRouteRuleProgramming, routeStart)
 	return nil
 }
 
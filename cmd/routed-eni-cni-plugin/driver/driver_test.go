@@ -26,6 +26,7 @@ import (
 	mock_procsyswrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper/mocks"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/sgpp"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/podsetup"
 	"github.com/golang/mock/gomock"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -62,6 +63,13 @@ func Test_linuxNetwork_SetupPodNetwork(t *testing.T) {
 	fromContainerRuleForRTTable4.Priority = networkutils.FromPodRulePriority
 	fromContainerRuleForRTTable4.Table = 4
 
+	podTable := networkutils.PodRouteTable(containerAddr.IP)
+	fromContainerRuleForPodTable := netlink.NewRule()
+	fromContainerRuleForPodTable.Src = containerAddr
+	fromContainerRuleForPodTable.Priority = networkutils.FromPodRulePriority
+	fromContainerRuleForPodTable.Table = podTable
+	eniGateway := net.ParseIP("192.168.0.1")
+
 	type linkByNameCall struct {
 		linkName string
 		link     netlink.Link
@@ -79,6 +87,11 @@ func Test_linuxNetwork_SetupPodNetwork(t *testing.T) {
 		route *netlink.Route
 		err   error
 	}
+	type routeListFilteredCall struct {
+		filter *netlink.Route
+		routes []netlink.Route
+		err    error
+	}
 	type ruleAddCall struct {
 		rule *netlink.Rule
 		err  error
@@ -101,15 +114,18 @@ func Test_linuxNetwork_SetupPodNetwork(t *testing.T) {
 		procSysSetCalls    []procSysSetCall
 		routeReplaceCalls  []routeReplaceCall
 		ruleAddCalls       []ruleAddCall
+
+		routeListFilteredCalls []routeListFilteredCall
 	}
 	type args struct {
-		hostVethName string
-		contVethName string
-		netnsPath    string
-		v4Addr       *net.IPNet
-		v6Addr       *net.IPNet
-		deviceNumber int
-		mtu          int
+		hostVethName  string
+		contVethName  string
+		netnsPath     string
+		v4Addr        *net.IPNet
+		v6Addr        *net.IPNet
+		deviceNumber  int
+		podRouteTable bool
+		mtu           int
 	}
 	tests := []struct {
 		name    string
@@ -246,6 +262,108 @@ func Test_linuxNetwork_SetupPodNetwork(t *testing.T) {
 				mtu:          9001,
 			},
 		},
+		{
+			name: "successfully setup pod network - pod sponsored by eth3 in its own route table",
+			fields: fields{
+				linkByNameCalls: []linkByNameCall{
+					{
+						linkName: "eni8ea2c11fe35",
+						err:      errors.New("not exists"),
+					},
+					{
+						linkName: "eni8ea2c11fe35",
+						link:     hostVethWithIndex9,
+					},
+				},
+				linkSetupCalls: []linkSetupCall{
+					{
+						link: hostVethWithIndex9,
+					},
+				},
+				routeListFilteredCalls: []routeListFilteredCall{
+					{
+						filter: &netlink.Route{Table: 4},
+						routes: []netlink.Route{
+							{
+								LinkIndex: 5,
+								Dst:       &net.IPNet{IP: eniGateway, Mask: net.CIDRMask(32, 32)},
+								Scope:     netlink.SCOPE_LINK,
+								Table:     4,
+							},
+							{
+								LinkIndex: 5,
+								Gw:        eniGateway,
+								Table:     4,
+							},
+						},
+					},
+				},
+				routeReplaceCalls: []routeReplaceCall{
+					{
+						route: &netlink.Route{
+							LinkIndex: 5,
+							Dst:       &net.IPNet{IP: eniGateway, Mask: net.CIDRMask(32, 32)},
+							Scope:     netlink.SCOPE_LINK,
+							Table:     podTable,
+						},
+					},
+					{
+						route: &netlink.Route{
+							LinkIndex: 5,
+							Dst:       &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+							Gw:        eniGateway,
+							Scope:     netlink.SCOPE_UNIVERSE,
+							Table:     podTable,
+						},
+					},
+					{
+						route: &netlink.Route{
+							LinkIndex: hostVethWithIndex9.Index,
+							Scope:     netlink.SCOPE_LINK,
+							Dst:       containerAddr,
+							Table:     unix.RT_TABLE_MAIN,
+						},
+					},
+				},
+				ruleAddCalls: []ruleAddCall{
+					{
+						rule: toContainerRule,
+					},
+					{
+						rule: fromContainerRuleForPodTable,
+					},
+				},
+				withNetNSPathCalls: []withNetNSPathCall{
+					{
+						netNSPath: "/proc/42/ns/net",
+					},
+				},
+				procSysSetCalls: []procSysSetCall{
+					{
+						key:   "net/ipv6/conf/eni8ea2c11fe35/accept_ra",
+						value: "0",
+					},
+					{
+						key:   "net/ipv6/conf/eni8ea2c11fe35/accept_redirects",
+						value: "1",
+					},
+					{
+						key:   "net/ipv6/conf/eni8ea2c11fe35/forwarding",
+						value: "0",
+					},
+				},
+			},
+			args: args{
+				hostVethName:  "eni8ea2c11fe35",
+				contVethName:  "eth0",
+				netnsPath:     "/proc/42/ns/net",
+				v4Addr:        containerAddr,
+				v6Addr:        nil,
+				deviceNumber:  3,
+				podRouteTable: true,
+				mtu:           9001,
+			},
+		},
 		{
 			name: "failed to setup vethPair",
 			fields: fields{
@@ -351,6 +469,9 @@ func Test_linuxNetwork_SetupPodNetwork(t *testing.T) {
 			for _, call := range tt.fields.linkSetupCalls {
 				netLink.EXPECT().LinkSetUp(call.link).Return(call.err)
 			}
+			for _, call := range tt.fields.routeListFilteredCalls {
+				netLink.EXPECT().RouteListFiltered(unix.AF_INET, call.filter, netlink.RT_FILTER_TABLE).Return(call.routes, call.err)
+			}
 			for _, call := range tt.fields.routeReplaceCalls {
 				netLink.EXPECT().RouteReplace(call.route).Return(call.err)
 			}
@@ -374,11 +495,15 @@ func Test_linuxNetwork_SetupPodNetwork(t *testing.T) {
 				ns:      ns,
 				procSys: procSys,
 			}
-			err := n.SetupPodNetwork(tt.args.hostVethName, tt.args.contVethName, tt.args.netnsPath, tt.args.v4Addr, tt.args.v6Addr, tt.args.deviceNumber, tt.args.mtu, testLogger)
+			timer := podsetup.NewTimer()
+			err := n.SetupPodNetwork(tt.args.hostVethName, tt.args.contVethName, tt.args.netnsPath, tt.args.v4Addr, tt.args.v6Addr, tt.args.deviceNumber, tt.args.podRouteTable,
+				tt.args.mtu, timer, testLogger)
 			if tt.wantErr != nil {
 				assert.EqualError(t, err, tt.wantErr.Error())
 			} else {
 				assert.NoError(t, err)
+				assert.Contains(t, timer.Durations(), podsetup.PhaseLinkSetup)
+				assert.Contains(t, timer.Durations(), podsetup.PhaseRouteRuleProgramming)
 			}
 		})
 	}
@@ -400,10 +525,24 @@ func Test_linuxNetwork_TeardownPodNetwork(t *testing.T) {
 	toContainerRule.Priority = networkutils.ToContainerRulePriority
 	toContainerRule.Table = unix.RT_TABLE_MAIN
 
-	fromContainerRuleForRTTable4 := netlink.NewRule()
-	fromContainerRuleForRTTable4.Src = containerAddr
-	fromContainerRuleForRTTable4.Priority = networkutils.FromPodRulePriority
-	fromContainerRuleForRTTable4.Table = 4
+	fromContainerRuleForAnyTable := netlink.NewRule()
+	fromContainerRuleForAnyTable.Src = containerAddr
+	fromContainerRuleForAnyTable.Priority = networkutils.FromPodRulePriority
+	fromContainerRuleForAnyTable.Table = unix.RT_TABLE_UNSPEC
+	podTable := networkutils.PodRouteTable(containerAddr.IP)
+	podTableRoutes := []netlink.Route{
+		{
+			LinkIndex: 5,
+			Dst:       &net.IPNet{IP: net.ParseIP("192.168.0.1"), Mask: net.CIDRMask(32, 32)},
+			Scope:     netlink.SCOPE_LINK,
+			Table:     podTable,
+		},
+		{
+			LinkIndex: 5,
+			Gw:        net.ParseIP("192.168.0.1"),
+			Table:     podTable,
+		},
+	}
 	type routeDelCall struct {
 		route *netlink.Route
 		err   error
@@ -412,9 +551,16 @@ func Test_linuxNetwork_TeardownPodNetwork(t *testing.T) {
 		rule *netlink.Rule
 		err  error
 	}
+	type routeListFilteredCall struct {
+		filter *netlink.Route
+		routes []netlink.Route
+		err    error
+	}
 	type fields struct {
 		routeDelCalls []routeDelCall
 		ruleDelCalls  []ruleDelCall
+
+		routeListFilteredCalls []routeListFilteredCall
 	}
 
 	type args struct {
@@ -439,6 +585,15 @@ func Test_linuxNetwork_TeardownPodNetwork(t *testing.T) {
 					{
 						rule: toContainerRule,
 					},
+					{
+						rule: fromContainerRuleForAnyTable,
+						err:  syscall.ENOENT,
+					},
+				},
+				routeListFilteredCalls: []routeListFilteredCall{
+					{
+						filter: &netlink.Route{Table: podTable},
+					},
 				},
 			},
 			args: args{
@@ -459,13 +614,57 @@ func Test_linuxNetwork_TeardownPodNetwork(t *testing.T) {
 						rule: toContainerRule,
 					},
 					{
-						rule: fromContainerRuleForRTTable4,
+						rule: fromContainerRuleForAnyTable,
 					},
 					{
-						rule: fromContainerRuleForRTTable4,
+						rule: fromContainerRuleForAnyTable,
 						err:  syscall.ENOENT,
 					},
 				},
+				routeListFilteredCalls: []routeListFilteredCall{
+					{
+						filter: &netlink.Route{Table: podTable},
+					},
+				},
+			},
+			args: args{
+				containerAddr: containerAddr,
+				deviceNumber:  3,
+			},
+		},
+		{
+			// ENABLE_POD_ROUTE_TABLES may have been turned off since the pod was set up
+			name: "successfully teardown pod network - pod in its own route table",
+			fields: fields{
+				routeDelCalls: []routeDelCall{
+					{
+						route: toContainerRoute,
+					},
+					{
+						route: &podTableRoutes[0],
+					},
+					{
+						route: &podTableRoutes[1],
+					},
+				},
+				ruleDelCalls: []ruleDelCall{
+					{
+						rule: toContainerRule,
+					},
+					{
+						rule: fromContainerRuleForAnyTable,
+					},
+					{
+						rule: fromContainerRuleForAnyTable,
+						err:  syscall.ENOENT,
+					},
+				},
+				routeListFilteredCalls: []routeListFilteredCall{
+					{
+						filter: &netlink.Route{Table: podTable},
+						routes: podTableRoutes,
+					},
+				},
 			},
 			args: args{
 				containerAddr: containerAddr,
@@ -496,6 +695,9 @@ func Test_linuxNetwork_TeardownPodNetwork(t *testing.T) {
 
 			netLink := mock_netlinkwrapper.NewMockNetLink(ctrl)
 			netLink.EXPECT().NewRule().DoAndReturn(func() *netlink.Rule { return netlink.NewRule() }).AnyTimes()
+			for _, call := range tt.fields.routeListFilteredCalls {
+				netLink.EXPECT().RouteListFiltered(unix.AF_INET, call.filter, netlink.RT_FILTER_TABLE).Return(call.routes, call.err)
+			}
 			for _, call := range tt.fields.routeDelCalls {
 				netLink.EXPECT().RouteDel(call.route).Return(call.err)
 			}
@@ -1571,11 +1773,14 @@ func Test_linuxNetwork_SetupBranchENIPodNetwork(t *testing.T) {
 				ns:      ns,
 				procSys: procSys,
 			}
-			err := n.SetupBranchENIPodNetwork(tt.args.hostVethName, tt.args.contVethName, tt.args.netnsPath, tt.args.v4Addr, tt.args.v6Addr, tt.args.vlanID, tt.args.eniMAC, tt.args.subnetGW, tt.args.parentIfIndex, tt.args.mtu, tt.args.podSGEnforcingMode, testLogger)
+			timer := podsetup.NewTimer()
+			err := n.SetupBranchENIPodNetwork(tt.args.hostVethName, tt.args.contVethName, tt.args.netnsPath, tt.args.v4Addr, tt.args.v6Addr, tt.args.vlanID, tt.args.eniMAC, tt.args.subnetGW, tt.args.parentIfIndex, tt.args.mtu, tt.args.podSGEnforcingMode, timer, testLogger)
 			if tt.wantErr != nil {
 				assert.EqualError(t, err, tt.wantErr.Error())
 			} else {
 				assert.NoError(t, err)
+				assert.Contains(t, timer.Durations(), podsetup.PhaseLinkSetup)
+				assert.Contains(t, timer.Durations(), podsetup.PhaseRouteRuleProgramming)
 			}
 		})
 	}
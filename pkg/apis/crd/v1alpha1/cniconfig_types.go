@@ -0,0 +1,156 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CNIConfigName is the name of the CNIConfig that applies to the cluster, other CNIConfigs are ignored
+const CNIConfigName = "default"
+
+// Phases of the rollout of a CNIConfig
+const (
+	CNIConfigPhaseProgressing = "Progressing"
+	CNIConfigPhasePaused      = "Paused"
+	CNIConfigPhaseComplete    = "Complete"
+)
+
+// CNIConfigSpec defines the desired configuration of the aws-node DaemonSet
+type CNIConfigSpec struct {
+	// Env is set on the aws-node container, replacing the values of the variables that are already set
+	Env map[string]string `json:"env,omitempty"`
+	// ConflistTemplate replaces the 10-aws.conflist template of the image when set
+	ConflistTemplate string `json:"conflistTemplate,omitempty"`
+	// WarmPoolOverrides replace the warm targets of the environment on the nodes matching their selector. The first
+	// matching override applies, ipamd reads them when it starts.
+	WarmPoolOverrides []WarmPoolOverride `json:"warmPoolOverrides,omitempty"`
+	// SysctlPolicies replace the sysctls aws-node sets on the interfaces of the nodes matching their selector. The
+	// first matching policy applies, ipamd reads them when it starts and reconciles the sysctls every 30 seconds.
+	SysctlPolicies []SysctlPolicy `json:"sysctlPolicies,omitempty"`
+	// RouteAdvertisements advertise the pod IPs of the nodes matching their selector to BGP routers. The first matching
+	// advertisement applies, ipamd reads them when it starts.
+	RouteAdvertisements []RouteAdvertisement `json:"routeAdvertisements,omitempty"`
+	// Rollout controls how the aws-node pods are restarted with the new configuration
+	Rollout CNIConfigRollout `json:"rollout,omitempty"`
+}
+
+// WarmPoolOverride sets the warm targets of the nodes whose labels match NodeSelector, for instance by nodegroup with
+// eks.amazonaws.com/nodegroup, by availability zone with topology.kubernetes.io/zone, or by instance type with
+// node.kubernetes.io/instance-type. The targets that are not set keep the value of the environment.
+type WarmPoolOverride struct {
+	NodeSelector     metav1.LabelSelector `json:"nodeSelector"`
+	WarmENITarget    *int                 `json:"warmENITarget,omitempty"`
+	WarmIPTarget     *int                 `json:"warmIPTarget,omitempty"`
+	MinimumIPTarget  *int                 `json:"minimumIPTarget,omitempty"`
+	WarmPrefixTarget *int                 `json:"warmPrefixTarget,omitempty"`
+}
+
+// SysctlPolicy sets the sysctls of the interfaces of the nodes whose labels match NodeSelector. The sysctls that are
+// not set keep the value aws-node sets by default.
+type SysctlPolicy struct {
+	NodeSelector metav1.LabelSelector `json:"nodeSelector"`
+	Interfaces   []InterfaceSysctls   `json:"interfaces"`
+}
+
+// InterfaceSysctls sets sysctls of an interface. They are named by their path under net/ipv4/conf/<interface> or
+// net/ipv6/conf/<interface>, prefixed with the family, like ipv4/rp_filter or ipv6/accept_ra. An empty value leaves
+// the sysctl to the host, including those aws-node sets by default.
+type InterfaceSysctls struct {
+	// Interface is "primary" for the primary ENI, "all" or "default" for the settings of all or of new interfaces, or
+	// the name of an interface
+	Interface string            `json:"interface"`
+	Sysctls   map[string]string `json:"sysctls"`
+}
+
+// RouteAdvertisement advertises the pod IPs and prefixes of the nodes whose labels match NodeSelector to BGP peers, for
+// networks where the routes to the pods are not propagated by a transit gateway, like on-premises routers reached over
+// Direct Connect. ipamd writes the configuration of an FRR daemon running on the node, which does the BGP sessions.
+type RouteAdvertisement struct {
+	NodeSelector metav1.LabelSelector `json:"nodeSelector"`
+	// ASN is the autonomous system number of the nodes
+	ASN   uint32    `json:"asn"`
+	Peers []BGPPeer `json:"peers"`
+}
+
+// BGPPeer is a router the pod IPs are advertised to
+type BGPPeer struct {
+	Address string `json:"address"`
+	ASN     uint32 `json:"asn"`
+	// BFD enables bidirectional forwarding detection with the peer
+	BFD bool `json:"bfd,omitempty"`
+	// EBGPMultihop is the TTL of the BGP packets, for the peers that are not on the subnet of the node
+	EBGPMultihop int `json:"ebgpMultihop,omitempty"`
+}
+
+// CNIConfigRollout defines how a configuration change is rolled out, one nodegroup after the other
+type CNIConfigRollout struct {
+	// NodeGroupLabel is the node label whose values are the stages of the rollout, in alphabetical order.
+	// Defaults to eks.amazonaws.com/nodegroup.
+	NodeGroupLabel string `json:"nodeGroupLabel,omitempty"`
+	// MaxUnavailable is the number of aws-node pods of a nodegroup restarted at the same time. Defaults to 1.
+	MaxUnavailable int `json:"maxUnavailable,omitempty"`
+	// SoakTime is how long an updated nodegroup is observed before moving to the next one. Defaults to 5m.
+	SoakTime *metav1.Duration `json:"soakTime,omitempty"`
+	// MaxErrors pauses the rollout when the updated aws-node pods of a nodegroup report more ipamd and AWS API errors
+	// during the soak time. Defaults to 10, a negative value disables the check.
+	MaxErrors *int `json:"maxErrors,omitempty"`
+	// Paused stops restarting aws-node pods. The operator sets it when MaxErrors is exceeded.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// CNIConfigStatus defines the observed state of the rollout of a CNIConfig
+type CNIConfigStatus struct {
+	// ConfigHash identifies the configuration being rolled out, aws-node pods carry it in an annotation
+	ConfigHash string `json:"configHash,omitempty"`
+	Phase      string `json:"phase,omitempty"`
+	// CurrentNodeGroup is the nodegroup being restarted or observed
+	CurrentNodeGroup string `json:"currentNodeGroup,omitempty"`
+	// SoakStartTime is when all the aws-node pods of CurrentNodeGroup were updated and ready
+	SoakStartTime *metav1.Time `json:"soakStartTime,omitempty"`
+	// PausedNodeGroup is the nodegroup whose errors paused the rollout. The errors are accepted once the rollout is
+	// resumed.
+	PausedNodeGroup     string   `json:"pausedNodeGroup,omitempty"`
+	CompletedNodeGroups []string `json:"completedNodeGroups,omitempty"`
+	Message             string   `json:"message,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+
+// CNIConfig is the Schema for the cniconfigs API
+type CNIConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   CNIConfigSpec   `json:"spec,omitempty"`
+	Status CNIConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// CNIConfigList contains a list of CNIConfig
+type CNIConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CNIConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&CNIConfig{}, &CNIConfigList{})
+}
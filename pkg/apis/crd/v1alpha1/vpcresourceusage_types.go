@@ -0,0 +1,71 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VPCResourceUsageStatus is the VPC resources consumed by the pods of a node, by namespace
+type VPCResourceUsageStatus struct {
+	InstanceID string `json:"instanceID,omitempty"`
+	// UpdateTime is when ipamd last exported the usage of the node
+	UpdateTime metav1.Time                 `json:"updateTime,omitempty"`
+	Namespaces []NamespaceVPCResourceUsage `json:"namespaces,omitempty"`
+}
+
+// NamespaceVPCResourceUsage is the VPC resources consumed by the pods of a namespace on a node. The secondary ENIs and
+// the prefixes are shared by the pods of several namespaces, each namespace is charged the share of the IPs of an ENI
+// or prefix that its pods are assigned. The warm ENIs, prefixes and IPs are not charged to any namespace.
+type NamespaceVPCResourceUsage struct {
+	Namespace string `json:"namespace"`
+	Pods      int    `json:"pods"`
+	// IPs are the IPv4 and IPv6 addresses assigned to the pods
+	IPs      int               `json:"ips"`
+	ENIs     resource.Quantity `json:"enis"`
+	Prefixes resource.Quantity `json:"prefixes"`
+	// BranchENIs are the ENIs of the pods with their own security groups
+	BranchENIs int `json:"branchENIs"`
+	// EIPs are the carrier IPs associated with the pods
+	EIPs int `json:"eips"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+
+// VPCResourceUsage is the Schema for the vpcresourceusages API. ipamd keeps one per node, named after the node and
+// deleted with it.
+type VPCResourceUsage struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Status VPCResourceUsageStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VPCResourceUsageList contains a list of VPCResourceUsage
+type VPCResourceUsageList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VPCResourceUsage `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VPCResourceUsage{}, &VPCResourceUsageList{})
+}
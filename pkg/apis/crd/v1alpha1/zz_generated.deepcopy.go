@@ -22,9 +22,177 @@ limitations under the License.
 package v1alpha1
 
 import (
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BGPPeer) DeepCopyInto(out *BGPPeer) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BGPPeer.
+func (in *BGPPeer) DeepCopy() *BGPPeer {
+	if in == nil {
+		return nil
+	}
+	out := new(BGPPeer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIConfig) DeepCopyInto(out *CNIConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIConfig.
+func (in *CNIConfig) DeepCopy() *CNIConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CNIConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIConfigList) DeepCopyInto(out *CNIConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]CNIConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIConfigList.
+func (in *CNIConfigList) DeepCopy() *CNIConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *CNIConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIConfigRollout) DeepCopyInto(out *CNIConfigRollout) {
+	*out = *in
+	if in.SoakTime != nil {
+		in, out := &in.SoakTime, &out.SoakTime
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.MaxErrors != nil {
+		in, out := &in.MaxErrors, &out.MaxErrors
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIConfigRollout.
+func (in *CNIConfigRollout) DeepCopy() *CNIConfigRollout {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIConfigRollout)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIConfigSpec) DeepCopyInto(out *CNIConfigSpec) {
+	*out = *in
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.WarmPoolOverrides != nil {
+		in, out := &in.WarmPoolOverrides, &out.WarmPoolOverrides
+		*out = make([]WarmPoolOverride, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.SysctlPolicies != nil {
+		in, out := &in.SysctlPolicies, &out.SysctlPolicies
+		*out = make([]SysctlPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.RouteAdvertisements != nil {
+		in, out := &in.RouteAdvertisements, &out.RouteAdvertisements
+		*out = make([]RouteAdvertisement, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Rollout.DeepCopyInto(&out.Rollout)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIConfigSpec.
+func (in *CNIConfigSpec) DeepCopy() *CNIConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CNIConfigStatus) DeepCopyInto(out *CNIConfigStatus) {
+	*out = *in
+	if in.SoakStartTime != nil {
+		in, out := &in.SoakStartTime, &out.SoakStartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletedNodeGroups != nil {
+		in, out := &in.CompletedNodeGroups, &out.CompletedNodeGroups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CNIConfigStatus.
+func (in *CNIConfigStatus) DeepCopy() *CNIConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CNIConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ENIConfig) DeepCopyInto(out *ENIConfig) {
 	*out = *in
@@ -113,3 +281,203 @@ func (in *ENIConfigStatus) DeepCopy() *ENIConfigStatus {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *InterfaceSysctls) DeepCopyInto(out *InterfaceSysctls) {
+	*out = *in
+	if in.Sysctls != nil {
+		in, out := &in.Sysctls, &out.Sysctls
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new InterfaceSysctls.
+func (in *InterfaceSysctls) DeepCopy() *InterfaceSysctls {
+	if in == nil {
+		return nil
+	}
+	out := new(InterfaceSysctls)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *NamespaceVPCResourceUsage) DeepCopyInto(out *NamespaceVPCResourceUsage) {
+	*out = *in
+	out.ENIs = in.ENIs.DeepCopy()
+	out.Prefixes = in.Prefixes.DeepCopy()
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new NamespaceVPCResourceUsage.
+func (in *NamespaceVPCResourceUsage) DeepCopy() *NamespaceVPCResourceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(NamespaceVPCResourceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RouteAdvertisement) DeepCopyInto(out *RouteAdvertisement) {
+	*out = *in
+	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]BGPPeer, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RouteAdvertisement.
+func (in *RouteAdvertisement) DeepCopy() *RouteAdvertisement {
+	if in == nil {
+		return nil
+	}
+	out := new(RouteAdvertisement)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SysctlPolicy) DeepCopyInto(out *SysctlPolicy) {
+	*out = *in
+	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
+	if in.Interfaces != nil {
+		in, out := &in.Interfaces, &out.Interfaces
+		*out = make([]InterfaceSysctls, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SysctlPolicy.
+func (in *SysctlPolicy) DeepCopy() *SysctlPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(SysctlPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VPCResourceUsage) DeepCopyInto(out *VPCResourceUsage) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VPCResourceUsage.
+func (in *VPCResourceUsage) DeepCopy() *VPCResourceUsage {
+	if in == nil {
+		return nil
+	}
+	out := new(VPCResourceUsage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VPCResourceUsage) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VPCResourceUsageList) DeepCopyInto(out *VPCResourceUsageList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VPCResourceUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VPCResourceUsageList.
+func (in *VPCResourceUsageList) DeepCopy() *VPCResourceUsageList {
+	if in == nil {
+		return nil
+	}
+	out := new(VPCResourceUsageList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VPCResourceUsageList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VPCResourceUsageStatus) DeepCopyInto(out *VPCResourceUsageStatus) {
+	*out = *in
+	in.UpdateTime.DeepCopyInto(&out.UpdateTime)
+	if in.Namespaces != nil {
+		in, out := &in.Namespaces, &out.Namespaces
+		*out = make([]NamespaceVPCResourceUsage, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VPCResourceUsageStatus.
+func (in *VPCResourceUsageStatus) DeepCopy() *VPCResourceUsageStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VPCResourceUsageStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WarmPoolOverride) DeepCopyInto(out *WarmPoolOverride) {
+	*out = *in
+	in.NodeSelector.DeepCopyInto(&out.NodeSelector)
+	if in.WarmENITarget != nil {
+		in, out := &in.WarmENITarget, &out.WarmENITarget
+		*out = new(int)
+		**out = **in
+	}
+	if in.WarmIPTarget != nil {
+		in, out := &in.WarmIPTarget, &out.WarmIPTarget
+		*out = new(int)
+		**out = **in
+	}
+	if in.MinimumIPTarget != nil {
+		in, out := &in.MinimumIPTarget, &out.MinimumIPTarget
+		*out = new(int)
+		**out = **in
+	}
+	if in.WarmPrefixTarget != nil {
+		in, out := &in.WarmPrefixTarget, &out.WarmPrefixTarget
+		*out = new(int)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WarmPoolOverride.
+func (in *WarmPoolOverride) DeepCopy() *WarmPoolOverride {
+	if in == nil {
+		return nil
+	}
+	out := new(WarmPoolOverride)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,246 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package awsfixture records the HTTP interactions of AWS SDK clients with AWS to a fixture file, and replays them in
+// tests. Replayed responses go through the SDK like real ones, so that tests cover the actual shapes of the responses,
+// including error bodies and pagination, without AWS access.
+package awsfixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// envRecord is set to "true" to record the fixtures of the tests against AWS, with the credentials and region of the
+// environment, rather than replay them
+const envRecord = "AWS_FIXTURE_RECORD"
+
+// Request is the part of an HTTP request that is matched against the recorded ones. The signature and the other
+// headers are left out, since they change with the time and the credentials.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Params holds form-encoded bodies, such as the ones of EC2 query requests, Body any other body
+	Params map[string]string `json:"params,omitempty"`
+	Body   string            `json:"body,omitempty"`
+}
+
+// Response is a recorded HTTP response
+type Response struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// Interaction is a request and the response AWS returned for it
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Cassette holds the interactions of a fixture file
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+
+	lock     sync.Mutex
+	replayed []bool
+}
+
+// Load reads a fixture file
+func Load(path string) (*Cassette, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(content, &c); err != nil {
+		return nil, fmt.Errorf("invalid fixture file %s: %v", path, err)
+	}
+	c.replayed = make([]bool, len(c.Interactions))
+	return &c, nil
+}
+
+// Save writes the interactions to a fixture file
+func (c *Cassette) Save(path string) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// Unreplayed returns the requests that were recorded but not replayed
+func (c *Cassette) Unreplayed() []Request {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var requests []Request
+	for i, replayed := range c.replayed {
+		if !replayed {
+			requests = append(requests, c.Interactions[i].Request)
+		}
+	}
+	return requests
+}
+
+// Recorder returns a transport that sends the requests with next, and adds them to the cassette with their response
+func (c *Cassette) Recorder(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		request, err := newRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := next.RoundTrip(r)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+
+		response := Response{StatusCode: resp.StatusCode, Body: string(body)}
+		if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+			response.Headers = map[string]string{"Content-Type": contentType}
+		}
+		c.lock.Lock()
+		c.Interactions = append(c.Interactions, Interaction{Request: request, Response: response})
+		c.replayed = append(c.replayed, true)
+		c.lock.Unlock()
+		return resp, nil
+	})
+}
+
+// Replayer returns a transport that answers each request with the response of the first recorded interaction with the
+// same request that was not replayed yet. Requests that were not recorded fail.
+func (c *Cassette) Replayer() http.RoundTripper {
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		request, err := newRequest(r)
+		if err != nil {
+			return nil, err
+		}
+		c.lock.Lock()
+		defer c.lock.Unlock()
+		for i, interaction := range c.Interactions {
+			if c.replayed[i] || !reflect.DeepEqual(interaction.Request, request) {
+				continue
+			}
+			c.replayed[i] = true
+			header := make(http.Header)
+			for key, value := range interaction.Response.Headers {
+				header.Set(key, value)
+			}
+			return &http.Response{
+				Status:        fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+				StatusCode:    interaction.Response.StatusCode,
+				Header:        header,
+				Body:          io.NopCloser(strings.NewReader(interaction.Response.Body)),
+				ContentLength: int64(len(interaction.Response.Body)),
+				Request:       r,
+			}, nil
+		}
+		return nil, fmt.Errorf("no recorded interaction for %+v", request)
+	})
+}
+
+// Session returns a session whose requests are replayed from the fixture file, and fails the test if some recorded
+// interactions were not replayed. With AWS_FIXTURE_RECORD=true, the requests are sent to AWS and the fixture file is
+// overwritten with them once the test is done. Review recorded fixtures for account IDs and other private data before
+// committing them.
+func Session(t testing.TB, path string) *session.Session {
+	if os.Getenv(envRecord) == "true" {
+		c := &Cassette{}
+		sess := session.Must(session.NewSession(&aws.Config{MaxRetries: aws.Int(0)}))
+		// The transport is replaced once the session is created, which may have set it up for AWS_CA_BUNDLE
+		next := sess.Config.HTTPClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		sess.Config.HTTPClient = &http.Client{Transport: c.Recorder(next)}
+		t.Cleanup(func() {
+			if err := c.Save(path); err != nil {
+				t.Errorf("Failed to save the AWS fixture: %v", err)
+			}
+		})
+		return sess
+	}
+
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load the AWS fixture: %v", err)
+	}
+	t.Cleanup(func() {
+		for _, request := range c.Unreplayed() {
+			t.Errorf("Recorded AWS request was not replayed: %+v", request)
+		}
+	})
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	sess.Config.HTTPClient = &http.Client{Transport: c.Replayer()}
+	return sess
+}
+
+// newRequest returns the part of r that is matched, and leaves the body of r readable
+func newRequest(r *http.Request) (Request, error) {
+	request := Request{Method: r.Method, Path: r.URL.Path}
+	if r.Body == nil {
+		return request, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body.Close()
+	if err != nil {
+		return request, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if len(body) == 0 {
+		return request, nil
+	}
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		values, err := url.ParseQuery(string(body))
+		if err == nil {
+			request.Params = make(map[string]string, len(values))
+			for key, value := range values {
+				request.Params[key] = strings.Join(value, ",")
+			}
+			return request, nil
+		}
+	}
+	request.Body = string(body)
+	return request, nil
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
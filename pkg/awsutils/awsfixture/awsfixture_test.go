@@ -0,0 +1,104 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsfixture
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const describeSubnetsResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<DescribeSubnetsResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+    <requestId>0b9a5a5e-6d1b-4c2c-8f1a-2d4e6f8a0b1c</requestId>
+    <subnetSet>
+        <item>
+            <subnetId>subnet-1</subnetId>
+            <availableIpAddressCount>250</availableIpAddressCount>
+        </item>
+    </subnetSet>
+</DescribeSubnetsResponse>`
+
+const notFoundResponse = `<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>InvalidSubnetID.NotFound</Code><Message>The subnet ID 'subnet-2' does not exist</Message></Error></Errors><RequestID>1d2c3b4a</RequestID></Response>`
+
+func TestRecordReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml;charset=UTF-8")
+		require.NoError(t, r.ParseForm())
+		if r.Form.Get("SubnetId.1") == "subnet-1" {
+			w.Write([]byte(describeSubnetsResponse))
+		} else {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(notFoundResponse))
+		}
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "fixture.json")
+
+	describe := func(sess *session.Session) {
+		svc := ec2.New(sess, &aws.Config{Endpoint: aws.String(server.URL)})
+		output, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{"subnet-1"})})
+		require.NoError(t, err)
+		assert.Equal(t, int64(250), aws.Int64Value(output.Subnets[0].AvailableIpAddressCount))
+
+		_, err = svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{"subnet-2"})})
+		require.Error(t, err)
+		assert.Equal(t, "InvalidSubnetID.NotFound", err.(awserr.Error).Code())
+	}
+
+	recorded := &Cassette{}
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+		MaxRetries:  aws.Int(0),
+	}))
+	sess.Config.HTTPClient = &http.Client{Transport: recorded.Recorder(http.DefaultTransport)}
+	describe(sess)
+	require.NoError(t, recorded.Save(path))
+	require.Len(t, recorded.Interactions, 2)
+	assert.Equal(t, "DescribeSubnets", recorded.Interactions[0].Request.Params["Action"])
+
+	// The server is not called anymore
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Unexpected request to the server")
+	})
+	describe(Session(t, path))
+
+	// Requests that were not recorded fail
+	svc := ec2.New(Session(t, path), &aws.Config{Endpoint: aws.String(server.URL)})
+	_, err := svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{"subnet-1"})})
+	require.NoError(t, err)
+	_, err = svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{"subnet-1"})})
+	assert.ErrorContains(t, err, "no recorded interaction")
+	_, err = svc.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{"subnet-2"})})
+	assert.Equal(t, "InvalidSubnetID.NotFound", err.(awserr.Error).Code())
+}
+
+func TestUnreplayed(t *testing.T) {
+	c := &Cassette{
+		Interactions: []Interaction{{Request: Request{Method: "POST", Path: "/"}}},
+		replayed:     []bool{false},
+	}
+	assert.Equal(t, []Request{{Method: "POST", Path: "/"}}, c.Unreplayed())
+}
@@ -0,0 +1,112 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awssession
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	// Environment variable to only use the IAM roles for service accounts (IRSA) credentials, and never fall back to
+	// the environment, the shared configuration or the node instance role
+	envIRSAOnly = "IRSA_ONLY_CREDENTIALS"
+
+	// Environment variables that the EKS pod identity webhook sets for IRSA
+	envRoleARN              = "AWS_ROLE_ARN"
+	envWebIdentityTokenFile = "AWS_WEB_IDENTITY_TOKEN_FILE"
+	envRoleSessionName      = "AWS_ROLE_SESSION_NAME"
+)
+
+// IRSAOnly returns whether only the IRSA credentials may be used
+func IRSAOnly() bool {
+	return utils.GetBoolAsStringEnvVar(envIRSAOnly, false)
+}
+
+// irsaCredentials returns the credentials of the IRSA role, without any fallback. When IRSA is not configured, the
+// credentials fail every request rather than falling back to the node instance role.
+func irsaCredentials(awsCfg aws.Config) *credentials.Credentials {
+	roleARN := os.Getenv(envRoleARN)
+	tokenFile := os.Getenv(envWebIdentityTokenFile)
+	if roleARN == "" || tokenFile == "" {
+		return credentials.NewCredentials(&credentials.ErrorProvider{
+			Err: errors.Errorf("%s is set, but %s or %s is not: the service account of aws-node is not "+
+				"configured for IRSA", envIRSAOnly, envRoleARN, envWebIdentityTokenFile),
+			ProviderName: stscreds.WebIdentityProviderName,
+		})
+	}
+
+	// AssumeRoleWithWebIdentity is not signed, the STS client needs no credentials of its own
+	awsCfg.Credentials = credentials.AnonymousCredentials
+	stsClient := sts.New(session.Must(session.NewSession(&awsCfg)))
+	return credentials.NewCredentials(stscreds.NewWebIdentityRoleProviderWithOptions(stsClient, roleARN,
+		os.Getenv(envRoleSessionName), stscreds.FetchTokenPath(tokenFile)))
+}
+
+// CheckIRSAToken checks that the IRSA web identity token is configured, readable and not expired. The token is not
+// verified, STS does that when the credentials are retrieved.
+func CheckIRSAToken(now time.Time) error {
+	roleARN := os.Getenv(envRoleARN)
+	tokenFile := os.Getenv(envWebIdentityTokenFile)
+	if roleARN == "" || tokenFile == "" {
+		return errors.Errorf("%s or %s is not set, the service account of aws-node is not configured for IRSA",
+			envRoleARN, envWebIdentityTokenFile)
+	}
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to read the IRSA web identity token")
+	}
+	expiry, err := tokenExpiry(strings.TrimSpace(string(token)))
+	if err != nil {
+		return errors.Wrap(err, "invalid IRSA web identity token")
+	}
+	if !expiry.After(now) {
+		return errors.Errorf("the IRSA web identity token expired at %s", expiry.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// tokenExpiry returns the exp claim of a JWT
+func tokenExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, errors.New("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to decode the JWT payload")
+	}
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, errors.Wrap(err, "failed to parse the JWT claims")
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, errors.New("the JWT has no expiry")
+	}
+	return time.Unix(claims.Exp, 0), nil
+}
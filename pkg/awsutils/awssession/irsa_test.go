@@ -0,0 +1,78 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awssession
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testToken returns an unsigned JWT with the exp claim
+func testToken(exp time.Time) string {
+	encode := base64.RawURLEncoding.EncodeToString
+	return encode([]byte(`{"alg":"RS256"}`)) + "." +
+		encode([]byte(fmt.Sprintf(`{"sub":"system:serviceaccount:kube-system:aws-node","exp":%d}`, exp.Unix()))) + ".sig"
+}
+
+func TestCheckIRSAToken(t *testing.T) {
+	now := time.Now()
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	t.Setenv(envRoleARN, "arn:aws:iam::123456789012:role/aws-node")
+	t.Setenv(envWebIdentityTokenFile, tokenFile)
+
+	// Missing token
+	assert.Error(t, CheckIRSAToken(now))
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte(testToken(now.Add(time.Hour))+"\n"), 0600))
+	assert.NoError(t, CheckIRSAToken(now))
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte(testToken(now.Add(-time.Minute))), 0600))
+	assert.ErrorContains(t, CheckIRSAToken(now), "expired")
+
+	require.NoError(t, os.WriteFile(tokenFile, []byte("not-a-token"), 0600))
+	assert.Error(t, CheckIRSAToken(now))
+
+	// IRSA not configured
+	t.Setenv(envRoleARN, "")
+	assert.Error(t, CheckIRSAToken(now))
+}
+
+func TestIRSAOnlyNeverFallsBack(t *testing.T) {
+	t.Setenv(envIRSAOnly, "true")
+	t.Setenv(envRoleARN, "")
+	t.Setenv(envWebIdentityTokenFile, "")
+	// Credentials the default chain would use
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+
+	sess := New()
+	_, err := sess.Config.Credentials.Get()
+	assert.ErrorContains(t, err, envWebIdentityTokenFile)
+
+	// With IRSA configured, the web identity provider is used
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	t.Setenv(envRoleARN, "arn:aws:iam::123456789012:role/aws-node")
+	t.Setenv(envWebIdentityTokenFile, tokenFile)
+	sess = New()
+	_, err = sess.Config.Credentials.Get()
+	assert.ErrorContains(t, err, stscreds.ErrCodeWebIdentity)
+}
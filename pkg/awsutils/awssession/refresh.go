@@ -0,0 +1,88 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awssession
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// authFailureCodes are the error codes of requests that failed because the credentials could not be retrieved, or were
+// rejected
+var authFailureCodes = map[string]bool{
+	stscreds.ErrCodeWebIdentity: true,
+	"NoCredentialProviders":     true,
+	"ExpiredToken":              true,
+	"ExpiredTokenException":     true,
+	"AuthFailure":               true,
+	"InvalidClientTokenId":      true,
+}
+
+// endpointFailureCodes are the error codes of requests that could not reach their endpoint
+var endpointFailureCodes = map[string]bool{
+	request.ErrCodeRequestError:    true,
+	request.ErrCodeResponseTimeout: true,
+}
+
+// IsAuthFailure returns whether the request failed because the credentials could not be retrieved, or were rejected
+func IsAuthFailure(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && authFailureCodes[aerr.Code()]
+}
+
+// IsEndpointFailure returns whether the request could not reach its endpoint
+func IsEndpointFailure(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && endpointFailureCodes[aerr.Code()]
+}
+
+// refreshHandler returns the handler that recovers from failed requests without restarting. After an authentication
+// failure, the cached credentials are expired, so that the next request retrieves them again, which reads the rotated
+// web identity token again. After any failure, the idle connections are closed, so that the next request resolves the
+// STS and EC2 endpoints again rather than reusing a connection to an address they moved away from.
+func refreshHandler(httpClient *http.Client) request.NamedHandler {
+	var lock sync.Mutex
+	failing := false
+	return request.NamedHandler{
+		Name: "amazon-vpc-cni-k8s/refresh",
+		Fn: func(r *request.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			if r.Error == nil {
+				if failing {
+					log.Infof("AWS requests succeed again after %s", r.Operation.Name)
+				}
+				failing = false
+				return
+			}
+			authFailure := IsAuthFailure(r.Error)
+			if !authFailure && !IsEndpointFailure(r.Error) {
+				return
+			}
+			if !failing {
+				log.Warnf("%s failed, refreshing the credentials and the connections to the endpoints: %v",
+					r.Operation.Name, r.Error)
+			}
+			failing = true
+			if authFailure && r.Config.Credentials != nil {
+				r.Config.Credentials.Expire()
+			}
+			httpClient.CloseIdleConnections()
+		},
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awssession
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingTransport counts the calls to CloseIdleConnections
+type countingTransport struct {
+	http.RoundTripper
+	closed int
+}
+
+func (t *countingTransport) CloseIdleConnections() {
+	t.closed++
+}
+
+func TestRefreshHandler(t *testing.T) {
+	transport := &countingTransport{}
+	handler := refreshHandler(&http.Client{Transport: transport})
+	creds := credentials.NewStaticCredentials("AKIDEXAMPLE", "secret", "")
+	send := func(err error) {
+		_, getErr := creds.Get()
+		assert.NoError(t, getErr)
+		handler.Fn(&request.Request{
+			Operation: &request.Operation{Name: "DescribeInstances"},
+			Config:    aws.Config{Credentials: creds},
+			Error:     err,
+		})
+	}
+
+	send(nil)
+	assert.False(t, creds.IsExpired())
+	assert.Equal(t, 0, transport.closed)
+
+	// Other errors are left to the callers
+	send(awserr.New("UnauthorizedOperation", "denied", nil))
+	assert.False(t, creds.IsExpired())
+	assert.Equal(t, 0, transport.closed)
+
+	// The endpoint is resolved again on the next request
+	send(awserr.New(request.ErrCodeRequestError, "send request failed", errors.New("i/o timeout")))
+	assert.False(t, creds.IsExpired())
+	assert.Equal(t, 1, transport.closed)
+
+	// The credentials are retrieved again on the next request
+	send(awserr.New("ExpiredToken", "the security token included in the request is expired", nil))
+	assert.True(t, creds.IsExpired())
+	assert.Equal(t, 2, transport.closed)
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	assert.True(t, IsAuthFailure(awserr.New("WebIdentityErr", "failed fetching WebIdentity token", nil)))
+	assert.True(t, IsAuthFailure(awserr.New("NoCredentialProviders", "no valid providers in chain", nil)))
+	assert.False(t, IsAuthFailure(awserr.New("UnauthorizedOperation", "denied", nil)))
+	assert.False(t, IsAuthFailure(errors.New("AuthFailure")))
+}
@@ -60,11 +60,12 @@ func getHTTPTimeout() time.Duration {
 
 // New will return an session for service clients
 func New() *session.Session {
+	httpClient := &http.Client{
+		Timeout: getHTTPTimeout(),
+	}
 	awsCfg := aws.Config{
-		MaxRetries: aws.Int(maxRetries),
-		HTTPClient: &http.Client{
-			Timeout: getHTTPTimeout(),
-		},
+		MaxRetries:          aws.Int(maxRetries),
+		HTTPClient:          httpClient,
 		STSRegionalEndpoint: endpoints.RegionalSTSEndpoint,
 	}
 
@@ -81,9 +82,16 @@ func New() *session.Session {
 		awsCfg.EndpointResolver = endpoints.ResolverFunc(customResolver)
 	}
 
+	if IRSAOnly() {
+		log.Info("Only using the IRSA credentials, never the node instance role")
+		awsCfg.Credentials = irsaCredentials(awsCfg)
+	}
+
 	sess := session.Must(session.NewSession(&awsCfg))
 	//injecting session handler info
 	injectUserAgent(&sess.Handlers)
+	// Recover from rotated credentials and moved endpoints without restarting
+	sess.Handlers.Complete.PushBackNamed(refreshHandler(httpClient))
 
 	return sess
 }
@@ -23,14 +23,17 @@ import (
 	"os"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"text/template"
 	"time"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/awssession"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/faultinject"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/retry"
@@ -48,20 +51,32 @@ import (
 )
 
 const (
-	maxENIEC2APIRetries  = 12
-	maxENIBackoffDelay   = time.Minute
-	eniDescriptionPrefix = "aws-K8S-"
+	// ENIDescriptionPrefix starts the description of the ENIs created by ipamd
+	ENIDescriptionPrefix = "aws-K8S-"
+	// ENINodeTagKey is the tag with the ID of the instance an ENI was created for
+	ENINodeTagKey = "node.k8s.amazonaws.com/instance_id"
+	// ENIClusterTagKey is the tag with the CLUSTER_NAME of the cluster an ENI was created for
+	ENIClusterTagKey = "cluster.k8s.amazonaws.com/name"
+)
+
+const (
+	maxENIEC2APIRetries = 12
+	maxENIBackoffDelay  = time.Minute
 
 	// AllocENI need to choose a first free device number between 0 and maxENI
 	// 100 is a hard limit because we use vlanID + 100 for pod networking table names
 	maxENIs                 = 100
 	clusterNameEnvVar       = "CLUSTER_NAME"
-	eniNodeTagKey           = "node.k8s.amazonaws.com/instance_id"
+	nodeNameEnvVar          = "MY_NODE_NAME"
 	eniCreatedAtTagKey      = "node.k8s.amazonaws.com/createdAt"
-	eniClusterTagKey        = "cluster.k8s.amazonaws.com/name"
 	additionalEniTagsEnvVar = "ADDITIONAL_ENI_TAGS"
+	subnetMinFreeIPsEnvVar  = "SUBNET_MIN_FREE_IPS"
+	secondaryENISGsEnvVar   = "SECONDARY_ENI_SECURITY_GROUPS"
 	reservedTagKeyPrefix    = "k8s.amazonaws.com"
 	subnetDiscoveryTagKey   = "kubernetes.io/role/cni"
+	// defaultSubnetPriority is the priority of the subnets tagged for the CNI without a positive integer value, and of
+	// the untagged subnet of the primary ENI. Subnets tagged with 0 are excluded instead.
+	defaultSubnetPriority = 1
 	// UnknownInstanceType indicates that the instance type is not yet supported
 	UnknownInstanceType = "vpc ip resource(eni ip limit): unknown instance type"
 
@@ -84,7 +99,7 @@ var (
 	ErrNoNetworkInterfaces = errors.New("No network interfaces found for ENI")
 )
 
-var log = logger.Get()
+var log = logger.GetComponent("awsutils")
 
 // APIs defines interfaces calls for adding/getting/deleting ENIs/secondary IPs. The APIs are not thread-safe.
 type APIs interface {
@@ -124,8 +139,8 @@ type APIs interface {
 	// DeallocPrefixAddresses deallocates the list of IP addresses from a ENI
 	DeallocPrefixAddresses(eniID string, ips []string) error
 
-	//AllocIPv6Prefixes allocates IPv6 prefixes to the ENI passed in
-	AllocIPv6Prefixes(eniID string) ([]*string, error)
+	//AllocIPv6Prefixes allocates count IPv6 prefixes to the ENI passed in
+	AllocIPv6Prefixes(eniID string, count int) ([]*string, error)
 
 	// GetVPCIPv4CIDRs returns VPC's IPv4 CIDRs from instance metadata
 	GetVPCIPv4CIDRs() ([]string, error)
@@ -188,6 +203,47 @@ type APIs interface {
 	FetchInstanceTypeLimits() error
 
 	IsPrefixDelegationSupported() bool
+
+	// ValidateEC2Config checks with DryRun calls that the EC2 resources and permissions needed by the configuration are available
+	ValidateEC2Config(ctx context.Context, subnetID string, securityGroups []*string, checkENIProvisioning bool) []error
+
+	// ValidateNAT64Config checks that the subnet of the primary ENI resolves and routes IPv4 endpoints through NAT64
+	ValidateNAT64Config(ctx context.Context) []error
+
+	// GetRoutedPrivateIPv4CIDRs returns the RFC1918 destinations that the subnet of the primary ENI routes to the
+	// given types of route targets
+	GetRoutedPrivateIPv4CIDRs(ctx context.Context, targets []string) ([]string, error)
+
+	// SetupEgressSNATIP returns the secondary IPv4 address of the primary ENI that IPv4 egress is translated to,
+	// backed by one of the Elastic IPs if any are given
+	SetupEgressSNATIP(ctx context.Context, eipAllocationIDs []string) (string, error)
+
+	// CheckEC2Permissions returns the EC2 actions the configuration needs, verified with DryRun calls where possible
+	CheckEC2Permissions(ctx context.Context, subnetID string, securityGroups []*string, enableENIProvisioning bool) []EC2Permission
+
+	// GetTerminationNotice returns why the instance is going away, or an empty string when it is not
+	GetTerminationNotice(ctx context.Context) (string, error)
+
+	// InWavelengthZone returns whether the instance is in a Wavelength Zone
+	InWavelengthZone() bool
+
+	// AllocateCarrierIP allocates a carrier IP and associates it with the private IP of the ENI
+	AllocateCarrierIP(ctx context.Context, eniID, privateIP string) (string, error)
+
+	// ReleaseCarrierIP releases the carrier IPs associated with the private IP, if any
+	ReleaseCarrierIP(ctx context.Context, privateIP string) error
+
+	// GetCarrierIPs returns the carrier IPs allocated for the instance by private IP
+	GetCarrierIPs(ctx context.Context) (map[string][]string, error)
+
+	// IPAMPoolID returns the IPAM pool the IPs and prefixes of the ENIs are allocated from, if any
+	IPAMPoolID() string
+
+	// IsIPAMPoolCIDR returns whether the IP or prefix, in CIDR notation, was allocated from the IPAM pool
+	IsIPAMPoolCIDR(cidr string) bool
+
+	// GetEC2Failures returns the most recent failed EC2 calls that change resources, with their request IDs
+	GetEC2Failures() []EC2Failure
 }
 
 // EC2InstanceMetadataCache caches instance metadata
@@ -205,15 +261,45 @@ type EC2InstanceMetadataCache struct {
 	availabilityZone string
 	region           string
 	vpcID            string
+	// zoneType and outpostARN are the placement of the instance, outpostARN is empty when it is not on an Outpost
+	zoneType   string
+	outpostARN string
+	// subnetPlacements caches whether subnets are co-located with the instance
+	subnetPlacements map[string]bool
+	// subnetOwners caches the accounts that own the subnets, which differ from the account of the instance in a shared VPC
+	subnetOwners map[string]string
+	account      string
 
 	unmanagedENIs          StringSet
 	useCustomNetworking    bool
 	multiCardENIs          StringSet
 	useSubnetDiscovery     bool
 	enablePrefixDelegation bool
+	// subnetMinFreeIPs is the number of free IPs below which discovered subnets are only used when the others fail
+	subnetMinFreeIPs int64
 
 	clusterName       string
 	additionalENITags map[string]string
+	// secondaryENISGs are the security groups of the secondary ENIs when they differ from the ones of the primary ENI
+	secondaryENISGs []string
+	// excludedENIs and includedENIs override the tags that tell whether ipamd manages an ENI
+	excludedENIs interfaceSet
+	includedENIs interfaceSet
+	// primaryENIDeviceNumber is the device number of the primary ENI. When it is not 0, the ENI at device number 0 is
+	// an uplink of the host.
+	primaryENIDeviceNumber int
+	// ipamPoolID is the IPAM pool the IPs and prefixes of the ENIs are allocated from, ipamPoolAllocations are the
+	// allocations of the pool for the ENIs of the instance, by CIDR
+	ipamPoolID          string
+	ipamPoolLock        sync.Mutex
+	ipamPoolAllocations map[string]ipamPoolAllocation
+	// ec2Failures are the most recent failed EC2 mutations
+	ec2Failures     []EC2Failure
+	ec2FailuresLock sync.Mutex
+	// nodeName, eniDescriptionTemplate and eniNameTagTemplate name the ENIs ipamd creates
+	nodeName               string
+	eniDescriptionTemplate *template.Template
+	eniNameTagTemplate     *template.Template
 
 	imds   TypedIMDS
 	ec2SVC ec2wrapper.EC2
@@ -278,7 +364,11 @@ type DescribeAllENIsResult struct {
 	TagMap          map[string]TagMap
 	TrunkENI        string
 	EFAENIs         map[string]bool
+	EFAOnlyENIs     map[string]bool
 	MultiCardENIIDs []string
+	// ExcludedENIs and IncludedENIs are the ENIs selected by EXCLUDED_ENIS and INCLUDED_ENIS
+	ExcludedENIs map[string]bool
+	IncludedENIs map[string]bool
 }
 
 // msSince returns milliseconds since start.
@@ -358,11 +448,22 @@ func New(useSubnetDiscovery, useCustomNetworking, disableLeakedENICleanup, v4Ena
 	ctx := context.Background()
 
 	sess := awssession.New()
+	faultinject.Default().InjectAWS(&sess.Handlers)
 	ec2Metadata := ec2metadata.New(sess)
 	cache := &EC2InstanceMetadataCache{}
 	cache.imds = TypedIMDS{instrumentedIMDS{ec2Metadata}}
 	cache.clusterName = os.Getenv(clusterNameEnvVar)
 	cache.additionalENITags = loadAdditionalENITags()
+	cache.subnetMinFreeIPs = loadSubnetMinFreeIPs()
+	cache.secondaryENISGs = loadSecondaryENISGs()
+	cache.excludedENIs = loadInterfaceSet(excludedENIsEnvVar)
+	cache.includedENIs = loadInterfaceSet(includedENIsEnvVar)
+	cache.primaryENIDeviceNumber = loadPrimaryENIDeviceNumber()
+	cache.ipamPoolID = loadIPAMPoolID()
+	cache.ipamPoolAllocations = map[string]ipamPoolAllocation{}
+	cache.nodeName = os.Getenv(nodeNameEnvVar)
+	cache.eniDescriptionTemplate = loadENITemplate(eniDescriptionTemplateEnvVar)
+	cache.eniNameTagTemplate = loadENITemplate(eniNameTagTemplateEnvVar)
 
 	region, err := ec2Metadata.Region()
 	if err != nil {
@@ -380,12 +481,24 @@ func New(useSubnetDiscovery, useCustomNetworking, disableLeakedENICleanup, v4Ena
 
 	awsCfg := aws.NewConfig().WithRegion(region)
 	sess = sess.Copy(awsCfg)
+	sess.Handlers.Complete.PushBackNamed(credentialEventHandler())
+	instrumentEC2Calls(&sess.Handlers)
 	ec2SVC := ec2wrapper.New(sess)
 	cache.ec2SVC = ec2SVC
 	err = cache.initWithEC2Metadata(ctx)
 	if err != nil {
 		return nil, err
 	}
+	cache.initPlacement(ctx)
+	if cache.ipamPoolID != "" && !cache.v4Enabled {
+		log.Errorf("%s is not supported in IPv6 clusters, the pods get IPv6 prefixes from EC2", ipamPoolIDEnvVar)
+		cache.ipamPoolID = ""
+	}
+	if cache.ipamPoolID != "" {
+		if err = cache.loadIPAMPoolAllocations(ctx); err != nil {
+			return nil, err
+		}
+	}
 
 	// Clean up leaked ENIs in the background
 	if !disableLeakedENICleanup {
@@ -412,11 +525,16 @@ func (cache *EC2InstanceMetadataCache) initWithEC2Metadata(ctx context.Context)
 
 	// retrieve primary interface local-ipv4
 	cache.localIPv4, err = cache.imds.GetLocalIPv4(ctx)
-	if err != nil {
+	if err != nil && (cache.v4Enabled || !IsNotFound(err)) {
 		awsAPIErrInc("GetLocalIPv4", err)
 		return err
 	}
-	log.Debugf("Discovered the instance primary IPv4 address: %s", cache.localIPv4)
+	if cache.localIPv4 == nil {
+		// Instances in IPv6-only subnets have no IPv4 address, which IPv6 clusters do not need
+		log.Infof("The instance has no IPv4 address, running as an IPv6-only node")
+	} else {
+		log.Debugf("Discovered the instance primary IPv4 address: %s", cache.localIPv4)
+	}
 
 	// retrieve instance-id
 	cache.instanceID, err = cache.imds.GetInstanceID(ctx)
@@ -440,6 +558,11 @@ func (cache *EC2InstanceMetadataCache) initWithEC2Metadata(ctx context.Context)
 		awsAPIErrInc("GetMAC", err)
 		return err
 	}
+	if cache.primaryENIDeviceNumber != 0 {
+		if mac, err = cache.selectPrimaryENI(ctx, mac); err != nil {
+			return err
+		}
+	}
 	cache.primaryENImac = mac
 	log.Debugf("Found primary interface's MAC address: %s", mac)
 
@@ -504,6 +627,11 @@ func (cache *EC2InstanceMetadataCache) RefreshSGIDs(mac string, store *datastore
 
 	if !cache.useCustomNetworking && (addedSGsCount != 0 || deletedSGsCount != 0) {
 		eniInfos := store.GetENIInfos()
+		// The secondary ENIs follow the security groups of the primary ENI, unless they have their own
+		if len(cache.secondaryENISGs) > 0 {
+			sgIDs = cache.secondaryENISGs
+			delete(eniInfos.ENIs, cache.primaryENI)
+		}
 
 		var eniIDs []string
 
@@ -528,13 +656,12 @@ func (cache *EC2InstanceMetadataCache) RefreshSGIDs(mac string, store *datastore
 			}
 			start := time.Now()
 			_, err = cache.ec2SVC.ModifyNetworkInterfaceAttributeWithContext(context.Background(), attributeInput)
+			err = cache.ec2CallError("ModifyNetworkInterfaceAttribute", err)
 			prometheusmetrics.Ec2ApiReq.WithLabelValues("ModifyNetworkInterfaceAttribute").Inc()
 			prometheusmetrics.AwsAPILatency.WithLabelValues("ModifyNetworkInterfaceAttribute", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 			if err != nil {
-				if aerr, ok := err.(awserr.Error); ok {
-					if aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
-						awsAPIErrInc("IMDSMetaDataOutOfSync", err)
-					}
+				if errors.Is(err, ErrNotFound) {
+					awsAPIErrInc("IMDSMetaDataOutOfSync", err)
 				}
 				checkAPIErrorAndBroadcastEvent(err, "ec2:ModifyNetworkInterfaceAttribute")
 				awsAPIErrInc("ModifyNetworkInterfaceAttribute", err)
@@ -604,24 +731,29 @@ func (cache *EC2InstanceMetadataCache) getENIMetadata(eniMAC string) (ENIMetadat
 
 	log.Debugf("Found ENI: %s, MAC %s, device %d", eniID, eniMAC, deviceNum)
 
-	// Get IPv4 and IPv6 addresses assigned to interface
+	// Get IPv4 and IPv6 addresses assigned to interface. ENIs in IPv6-only subnets have no IPv4 address, which only
+	// IPv4 clusters need.
+	var subnetV4Cidr string
+	var ec2ip4s []*ec2.NetworkInterfacePrivateIpAddress
 	cidr, err := cache.imds.GetSubnetIPv4CIDRBlock(ctx, eniMAC)
-	if err != nil {
+	if err != nil && (cache.v4Enabled || !IsNotFound(err)) {
 		awsAPIErrInc("GetSubnetIPv4CIDRBlock", err)
 		return ENIMetadata{}, err
 	}
+	if err == nil {
+		subnetV4Cidr = cidr.String()
+		imdsIPv4s, err := cache.imds.GetLocalIPv4s(ctx, eniMAC)
+		if err != nil {
+			awsAPIErrInc("GetLocalIPv4s", err)
+			return ENIMetadata{}, err
+		}
 
-	imdsIPv4s, err := cache.imds.GetLocalIPv4s(ctx, eniMAC)
-	if err != nil {
-		awsAPIErrInc("GetLocalIPv4s", err)
-		return ENIMetadata{}, err
-	}
-
-	ec2ip4s := make([]*ec2.NetworkInterfacePrivateIpAddress, len(imdsIPv4s))
-	for i, ip4 := range imdsIPv4s {
-		ec2ip4s[i] = &ec2.NetworkInterfacePrivateIpAddress{
-			Primary:          aws.Bool(i == 0),
-			PrivateIpAddress: aws.String(ip4.String()),
+		ec2ip4s = make([]*ec2.NetworkInterfacePrivateIpAddress, len(imdsIPv4s))
+		for i, ip4 := range imdsIPv4s {
+			ec2ip4s[i] = &ec2.NetworkInterfacePrivateIpAddress{
+				Primary:          aws.Bool(i == 0),
+				PrivateIpAddress: aws.String(ip4.String()),
+			}
 		}
 	}
 
@@ -685,7 +817,7 @@ func (cache *EC2InstanceMetadataCache) getENIMetadata(eniMAC string) (ENIMetadat
 		ENIID:          eniID,
 		MAC:            eniMAC,
 		DeviceNumber:   deviceNum,
-		SubnetIPv4CIDR: cidr.String(),
+		SubnetIPv4CIDR: subnetV4Cidr,
 		IPv4Addresses:  ec2ip4s,
 		IPv4Prefixes:   ec2ipv4Prefixes,
 		SubnetIPv6CIDR: subnetV6Cidr,
@@ -702,6 +834,7 @@ func (cache *EC2InstanceMetadataCache) awsGetFreeDeviceNumber() (int, error) {
 
 	start := time.Now()
 	result, err := cache.ec2SVC.DescribeInstancesWithContext(context.Background(), input)
+	err = cache.ec2CallError("DescribeInstances", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeInstances").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeInstances", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -771,6 +904,7 @@ func (cache *EC2InstanceMetadataCache) AllocENI(useCustomCfg bool, sg []*string,
 
 	start := time.Now()
 	_, err = cache.ec2SVC.ModifyNetworkInterfaceAttributeWithContext(context.Background(), attributeInput)
+	err = cache.ec2CallError("ModifyNetworkInterfaceAttribute", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("ModifyNetworkInterfaceAttribute").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("ModifyNetworkInterfaceAttribute", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -804,6 +938,7 @@ func (cache *EC2InstanceMetadataCache) attachENI(eniID string) (string, error) {
 	}
 	start := time.Now()
 	attachOutput, err := cache.ec2SVC.AttachNetworkInterfaceWithContext(context.Background(), attachInput)
+	err = cache.ec2CallError("AttachNetworkInterface", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("AttachNetworkInterface").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("AttachNetworkInterface", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -818,13 +953,16 @@ func (cache *EC2InstanceMetadataCache) attachENI(eniID string) (string, error) {
 
 // return ENI id, error
 func (cache *EC2InstanceMetadataCache) createENI(useCustomCfg bool, sg []*string, eniCfgSubnet string, numIPs int) (string, error) {
-	eniDescription := eniDescriptionPrefix + cache.instanceID
+	eniDescription := cache.eniDescription(eniPurposeSecondary)
 	tags := map[string]string{
 		eniCreatedAtTagKey: time.Now().Format(time.RFC3339),
 	}
 	for key, value := range cache.buildENITags() {
 		tags[key] = value
 	}
+	if name := cache.eniNameTag(eniPurposeSecondary); name != "" {
+		tags[nameTagKey] = name
+	}
 	tagSpec := []*ec2.TagSpecification{
 		{
 			ResourceType: aws.String(ec2.ResourceTypeNetworkInterface),
@@ -846,7 +984,7 @@ func (cache *EC2InstanceMetadataCache) createENI(useCustomCfg bool, sg []*string
 	if cache.enablePrefixDelegation {
 		input = &ec2.CreateNetworkInterfaceInput{
 			Description:       aws.String(eniDescription),
-			Groups:            aws.StringSlice(cache.securityGroups.SortedList()),
+			Groups:            aws.StringSlice(cache.eniSecurityGroups()),
 			SubnetId:          aws.String(cache.subnetID),
 			TagSpecifications: tagSpec,
 			Ipv4PrefixCount:   aws.Int64(int64(needIPs)),
@@ -854,17 +992,35 @@ func (cache *EC2InstanceMetadataCache) createENI(useCustomCfg bool, sg []*string
 	} else {
 		input = &ec2.CreateNetworkInterfaceInput{
 			Description:                    aws.String(eniDescription),
-			Groups:                         aws.StringSlice(cache.securityGroups.SortedList()),
+			Groups:                         aws.StringSlice(cache.eniSecurityGroups()),
 			SubnetId:                       aws.String(cache.subnetID),
 			TagSpecifications:              tagSpec,
 			SecondaryPrivateIpAddressCount: aws.Int64(int64(needIPs)),
 		}
 	}
 
+	if cache.ipamPoolID != "" {
+		// The IPs are allocated from the IPAM pool once the ENI is attached and its subnet is known
+		input.Ipv4PrefixCount = nil
+		input.SecondaryPrivateIpAddressCount = nil
+	}
+
 	var err error
 	var networkInterfaceID string
 	if cache.useCustomNetworking {
 		input = createENIUsingCustomCfg(sg, eniCfgSubnet, input)
+		if cache.useSubnetDiscovery {
+			networkInterfaceID, err = cache.tryCreateNetworkInterfaceInColocatedSubnet(input)
+			if err == nil && networkInterfaceID != "" {
+				return networkInterfaceID, nil
+			}
+		}
+		if eniCfgSubnet == "" {
+			if err == nil {
+				err = errors.New("no ENIConfig subnet, and no subnet tagged " + subnetDiscoveryTagKey + " co-located with the instance")
+			}
+			return "", errors.Wrap(err, "failed to create network interface")
+		}
 		log.Infof("Creating ENI with security groups: %v in subnet: %s", aws.StringValueSlice(input.Groups), aws.StringValue(input.SubnetId))
 
 		networkInterfaceID, err = cache.tryCreateNetworkInterface(input)
@@ -896,6 +1052,9 @@ func (cache *EC2InstanceMetadataCache) createENI(useCustomCfg bool, sg []*string
 						return networkInterfaceID, nil
 					}
 				}
+				if err == nil {
+					err = errors.New("no subnet tagged " + subnetDiscoveryTagKey + " co-located with the instance, and the subnet of the instance is excluded")
+				}
 			}
 		} else {
 			log.Info("Using same security group config as the primary interface for the new ENI")
@@ -924,6 +1083,7 @@ func (cache *EC2InstanceMetadataCache) getVpcSubnets() ([]*ec2.Subnet, error) {
 
 	start := time.Now()
 	subnetResult, err := cache.ec2SVC.DescribeSubnetsWithContext(context.Background(), describeSubnetInput)
+	err = cache.ec2CallError("DescribeSubnets", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeSubnets").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeSubnets", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -933,12 +1093,36 @@ func (cache *EC2InstanceMetadataCache) getVpcSubnets() ([]*ec2.Subnet, error) {
 		return nil, errors.Wrap(err, "AllocENI: unable to describe subnets")
 	}
 
-	// Sort the subnet by available IP address counter (desc order) before determining subnet to use
-	sort.SliceStable(subnetResult.Subnets, func(i, j int) bool {
-		return *subnetResult.Subnets[j].AvailableIpAddressCount < *subnetResult.Subnets[i].AvailableIpAddressCount
+	cache.recordSubnetOwners(subnetResult.Subnets)
+
+	// The ENIs of an instance on an Outpost can only be in the subnets of the Outpost, and the ENIs of a regional
+	// instance can not be in the subnets of the Outposts of its zone
+	var subnets []*ec2.Subnet
+	for _, subnet := range subnetResult.Subnets {
+		if aws.StringValue(subnet.OutpostArn) != cache.outpostARN {
+			continue
+		}
+		if excludedSubnet(subnet) {
+			log.Debugf("Subnet %s is excluded from subnet discovery", aws.StringValue(subnet.SubnetId))
+			continue
+		}
+		subnets = append(subnets, subnet)
+	}
+
+	// Sort the subnet by headroom, priority, then by available IP address counter (desc order) before determining subnet
+	// to use. The subnets below the free IP floor come last, so that a preferred subnet is not exhausted before the
+	// others are used.
+	sort.SliceStable(subnets, func(i, j int) bool {
+		if headroomI, headroomJ := cache.hasHeadroom(subnets[i]), cache.hasHeadroom(subnets[j]); headroomI != headroomJ {
+			return headroomI
+		}
+		if priorityI, priorityJ := subnetPriority(subnets[i]), subnetPriority(subnets[j]); priorityI != priorityJ {
+			return priorityI > priorityJ
+		}
+		return *subnets[j].AvailableIpAddressCount < *subnets[i].AvailableIpAddressCount
 	})
 
-	return subnetResult.Subnets, nil
+	return subnets, nil
 }
 
 func validTag(subnet *ec2.Subnet) bool {
@@ -950,13 +1134,55 @@ func validTag(subnet *ec2.Subnet) bool {
 	return false
 }
 
+// hasHeadroom returns whether a subnet has at least SUBNET_MIN_FREE_IPS free IPs, from the count returned by the last
+// DescribeSubnets call
+func (cache *EC2InstanceMetadataCache) hasHeadroom(subnet *ec2.Subnet) bool {
+	return aws.Int64Value(subnet.AvailableIpAddressCount) >= cache.subnetMinFreeIPs
+}
+
+// excludedSubnet returns whether the kubernetes.io/role/cni tag of a subnet is 0, which keeps the ENIs out of it, even
+// when it is the subnet of the primary ENI
+func excludedSubnet(subnet *ec2.Subnet) bool {
+	for _, tag := range subnet.Tags {
+		if aws.StringValue(tag.Key) == subnetDiscoveryTagKey {
+			return strings.TrimSpace(aws.StringValue(tag.Value)) == "0"
+		}
+	}
+	return false
+}
+
+// subnetPriority returns the priority of a subnet from the value of its kubernetes.io/role/cni tag. New ENIs go to the
+// subnets of the highest priority first, so that a subnet can be drained by lowering its priority, while it stays
+// tagged for the ENIs already in it.
+func subnetPriority(subnet *ec2.Subnet) int {
+	for _, tag := range subnet.Tags {
+		if aws.StringValue(tag.Key) != subnetDiscoveryTagKey {
+			continue
+		}
+		if priority, err := strconv.Atoi(aws.StringValue(tag.Value)); err == nil && priority > 0 {
+			return priority
+		}
+		break
+	}
+	return defaultSubnetPriority
+}
+
+// eniSecurityGroups returns the security groups of new ENIs, SECONDARY_ENI_SECURITY_GROUPS when it is set, so that the
+// ports of the node are not open on the ENIs of the pods, or else the ones of the primary ENI
+func (cache *EC2InstanceMetadataCache) eniSecurityGroups() []string {
+	if len(cache.secondaryENISGs) > 0 {
+		return cache.secondaryENISGs
+	}
+	return cache.securityGroups.SortedList()
+}
+
 func createENIUsingCustomCfg(sg []*string, eniCfgSubnet string, input *ec2.CreateNetworkInterfaceInput) *ec2.CreateNetworkInterfaceInput {
 	log.Info("Using a custom network config for the new ENI")
 
 	if len(sg) != 0 {
 		input.Groups = sg
 	} else {
-		log.Warnf("No custom networking security group found, will use the node's primary ENI's SG: %v", aws.StringValueSlice(input.Groups))
+		log.Warnf("No custom networking security group found, will use the default secondary ENI SG: %v", aws.StringValueSlice(input.Groups))
 	}
 	input.SubnetId = aws.String(eniCfgSubnet)
 
@@ -966,6 +1192,7 @@ func createENIUsingCustomCfg(sg []*string, eniCfgSubnet string, input *ec2.Creat
 func (cache *EC2InstanceMetadataCache) tryCreateNetworkInterface(input *ec2.CreateNetworkInterfaceInput) (string, error) {
 	start := time.Now()
 	result, err := cache.ec2SVC.CreateNetworkInterfaceWithContext(context.Background(), input)
+	err = cache.ec2CallError("CreateNetworkInterface", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("CreateNetworkInterface").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("CreateNetworkInterface", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err == nil {
@@ -975,6 +1202,7 @@ func (cache *EC2InstanceMetadataCache) tryCreateNetworkInterface(input *ec2.Crea
 	checkAPIErrorAndBroadcastEvent(err, "ec2:CreateNetworkInterface")
 	awsAPIErrInc("CreateNetworkInterface", err)
 	prometheusmetrics.Ec2ApiErr.WithLabelValues("CreateNetworkInterface").Inc()
+	err = cache.sharedSubnetError(err, aws.StringValue(input.SubnetId))
 	log.Errorf("Failed to CreateNetworkInterface %v for subnet %s", err, *input.SubnetId)
 	return "", err
 }
@@ -982,13 +1210,13 @@ func (cache *EC2InstanceMetadataCache) tryCreateNetworkInterface(input *ec2.Crea
 // buildENITags computes the desired AWS Tags for eni
 func (cache *EC2InstanceMetadataCache) buildENITags() map[string]string {
 	tags := map[string]string{
-		eniNodeTagKey: cache.instanceID,
+		ENINodeTagKey: cache.instanceID,
 	}
 
 	// If clusterName is provided,
 	// tag the ENI with "cluster.k8s.amazonaws.com/name=<cluster_name>"
 	if cache.clusterName != "" {
-		tags[eniClusterTagKey] = cache.clusterName
+		tags[ENIClusterTagKey] = cache.clusterName
 	}
 	for key, value := range cache.additionalENITags {
 		tags[key] = value
@@ -1018,6 +1246,7 @@ func (cache *EC2InstanceMetadataCache) TagENI(eniID string, currentTags map[stri
 	return retry.NWithBackoff(retry.NewSimpleBackoff(500*time.Millisecond, maxENIBackoffDelay, 0.3, 2), 5, func() error {
 		start := time.Now()
 		_, err := cache.ec2SVC.CreateTagsWithContext(context.Background(), input)
+		err = cache.ec2CallError("CreateTags", err)
 		prometheusmetrics.Ec2ApiReq.WithLabelValues("CreateTags").Inc()
 		prometheusmetrics.AwsAPILatency.WithLabelValues("CreateTags", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 		if err != nil {
@@ -1033,6 +1262,7 @@ func (cache *EC2InstanceMetadataCache) TagENI(eniID string, currentTags map[stri
 }
 
 func awsAPIErrInc(api string, err error) {
+	prometheusmetrics.AwsAPIErrClass.WithLabelValues(api, ErrorClass(err)).Inc()
 	if aerr, ok := err.(awserr.Error); ok {
 		prometheusmetrics.AwsAPIErr.With(prometheus.Labels{"api": api, "error": aerr.Code()}).Inc()
 	}
@@ -1053,7 +1283,7 @@ func (cache *EC2InstanceMetadataCache) freeENI(eniName string, sleepDelayAfterDe
 	// Find out attachment
 	attachID, err := cache.getENIAttachmentID(eniName)
 	if err != nil {
-		if err == ErrENINotFound {
+		if errors.Is(err, ErrENINotFound) {
 			log.Infof("ENI %s not found. It seems to be already freed", eniName)
 			return nil
 		}
@@ -1071,10 +1301,11 @@ func (cache *EC2InstanceMetadataCache) freeENI(eniName string, sleepDelayAfterDe
 	err = retry.NWithBackoff(retry.NewSimpleBackoff(time.Millisecond*200, maxBackoffDelay, 0.15, 2.0), maxENIEC2APIRetries, func() error {
 		start := time.Now()
 		_, ec2Err := cache.ec2SVC.DetachNetworkInterfaceWithContext(context.Background(), detachInput)
+		ec2Err = cache.ec2CallError("DetachNetworkInterface", ec2Err)
 		prometheusmetrics.Ec2ApiReq.WithLabelValues("DetachNetworkInterface").Inc()
 		prometheusmetrics.AwsAPILatency.WithLabelValues("DetachNetworkInterface", fmt.Sprint(ec2Err != nil), awsReqStatus(ec2Err)).Observe(msSince(start))
 		if ec2Err != nil {
-			checkAPIErrorAndBroadcastEvent(err, "ec2:DetachNetworkInterface")
+			checkAPIErrorAndBroadcastEvent(ec2Err, "ec2:DetachNetworkInterface")
 			awsAPIErrInc("DetachNetworkInterface", ec2Err)
 			prometheusmetrics.Ec2ApiErr.WithLabelValues("DetachNetworkInterface").Inc()
 			log.Errorf("Failed to detach ENI %s %v", eniName, ec2Err)
@@ -1098,6 +1329,7 @@ func (cache *EC2InstanceMetadataCache) freeENI(eniName string, sleepDelayAfterDe
 	}
 
 	log.Infof("Successfully freed ENI: %s", eniName)
+	cache.releaseIPAMPoolCIDRs(context.Background(), eniName, nil)
 	return nil
 }
 
@@ -1109,13 +1341,12 @@ func (cache *EC2InstanceMetadataCache) getENIAttachmentID(eniID string) (*string
 
 	start := time.Now()
 	result, err := cache.ec2SVC.DescribeNetworkInterfacesWithContext(context.Background(), input)
+	err = cache.ec2CallError("DescribeNetworkInterfaces", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeNetworkInterfaces", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
-				return nil, ErrENINotFound
-			}
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrENINotFound
 		}
 		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeNetworkInterfaces")
 		awsAPIErrInc("DescribeNetworkInterfaces", err)
@@ -1147,15 +1378,14 @@ func (cache *EC2InstanceMetadataCache) deleteENI(eniName string, maxBackoffDelay
 	err := retry.NWithBackoff(retry.NewSimpleBackoff(time.Millisecond*500, maxBackoffDelay, 0.15, 2.0), maxENIEC2APIRetries, func() error {
 		start := time.Now()
 		_, ec2Err := cache.ec2SVC.DeleteNetworkInterfaceWithContext(context.Background(), deleteInput)
+		ec2Err = cache.ec2CallError("DeleteNetworkInterface", ec2Err)
 		prometheusmetrics.Ec2ApiReq.WithLabelValues("DeleteNetworkInterface").Inc()
 		prometheusmetrics.AwsAPILatency.WithLabelValues("DeleteNetworkInterface", fmt.Sprint(ec2Err != nil), awsReqStatus(ec2Err)).Observe(msSince(start))
 		if ec2Err != nil {
-			if aerr, ok := ec2Err.(awserr.Error); ok {
-				// If already deleted, we are good
-				if aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
-					log.Infof("ENI %s has already been deleted", eniName)
-					return nil
-				}
+			// If already deleted, we are good
+			if errors.Is(ec2Err, ErrNotFound) {
+				log.Infof("ENI %s has already been deleted", eniName)
+				return nil
 			}
 			checkAPIErrorAndBroadcastEvent(ec2Err, "ec2:DeleteNetworkInterface")
 			awsAPIErrInc("DeleteNetworkInterface", ec2Err)
@@ -1177,13 +1407,12 @@ func (cache *EC2InstanceMetadataCache) GetIPv4sFromEC2(eniID string) (addrList [
 
 	start := time.Now()
 	result, err := cache.ec2SVC.DescribeNetworkInterfacesWithContext(context.Background(), input)
+	err = cache.ec2CallError("DescribeNetworkInterfaces", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeNetworkInterfaces", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
-				return nil, ErrENINotFound
-			}
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrENINotFound
 		}
 		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeNetworkInterfaces")
 		awsAPIErrInc("DescribeNetworkInterfaces", err)
@@ -1208,14 +1437,12 @@ func (cache *EC2InstanceMetadataCache) GetIPv4PrefixesFromEC2(eniID string) (add
 
 	start := time.Now()
 	result, err := cache.ec2SVC.DescribeNetworkInterfacesWithContext(context.Background(), input)
+	err = cache.ec2CallError("DescribeNetworkInterfaces", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeNetworkInterfaces", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
-				return nil, ErrENINotFound
-			}
-
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrENINotFound
 		}
 		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeNetworkInterfaces")
 		awsAPIErrInc("DescribeNetworkInterfaces", err)
@@ -1240,14 +1467,12 @@ func (cache *EC2InstanceMetadataCache) GetIPv6PrefixesFromEC2(eniID string) (add
 
 	start := time.Now()
 	result, err := cache.ec2SVC.DescribeNetworkInterfacesWithContext(context.Background(), input)
+	err = cache.ec2CallError("DescribeNetworkInterfaces", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeNetworkInterfaces", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
-				return nil, ErrENINotFound
-			}
-
+		if errors.Is(err, ErrNotFound) {
+			return nil, ErrENINotFound
 		}
 		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeNetworkInterfaces")
 		awsAPIErrInc("DescribeNetworkInterfaces", err)
@@ -1285,6 +1510,7 @@ func (cache *EC2InstanceMetadataCache) DescribeAllENIs() (DescribeAllENIsResult,
 		input := &ec2.DescribeNetworkInterfacesInput{NetworkInterfaceIds: aws.StringSlice(eniIDs)}
 		start := time.Now()
 		ec2Response, err = cache.ec2SVC.DescribeNetworkInterfacesWithContext(context.Background(), input)
+		err = cache.ec2CallError("DescribeNetworkInterfaces", err)
 		prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
 		prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeNetworkInterfaces", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 		if err == nil {
@@ -1295,23 +1521,22 @@ func (cache *EC2InstanceMetadataCache) DescribeAllENIs() (DescribeAllENIsResult,
 		prometheusmetrics.Ec2ApiErr.WithLabelValues("DescribeNetworkInterfaces").Inc()
 		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeNetworkInterfaces")
 		log.Errorf("Failed to call ec2:DescribeNetworkInterfaces for %v: %v", aws.StringValueSlice(input.NetworkInterfaceIds), err)
-		if aerr, ok := err.(awserr.Error); ok {
-			if aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
-				badENIID := badENIID(aerr.Message())
-				log.Debugf("Could not find interface: %s, ID: %s", aerr.Message(), badENIID)
-				awsAPIErrInc("IMDSMetaDataOutOfSync", err)
-				// Remove this ENI from the map
-				delete(eniMap, badENIID)
-				// Remove the failing ENI ID from the EC2 API request and try again
-				var tmpENIIDs []string
-				for _, eniID := range eniIDs {
-					if eniID != badENIID {
-						tmpENIIDs = append(tmpENIIDs, eniID)
-					}
+		var ec2Err *EC2Error
+		if errors.Is(err, ErrNotFound) && errors.As(err, &ec2Err) {
+			badENIID := badENIID(ec2Err.Message())
+			log.Debugf("Could not find interface: %s, ID: %s", ec2Err.Message(), badENIID)
+			awsAPIErrInc("IMDSMetaDataOutOfSync", err)
+			// Remove this ENI from the map
+			delete(eniMap, badENIID)
+			// Remove the failing ENI ID from the EC2 API request and try again
+			var tmpENIIDs []string
+			for _, eniID := range eniIDs {
+				if eniID != badENIID {
+					tmpENIIDs = append(tmpENIIDs, eniID)
 				}
-				eniIDs = tmpENIIDs
-				continue
 			}
+			eniIDs = tmpENIIDs
+			continue
 		}
 		// For other errors sleep a short while before the next retry
 		time.Sleep(time.Duration(retryCount*10) * time.Millisecond)
@@ -1331,7 +1556,10 @@ func (cache *EC2InstanceMetadataCache) DescribeAllENIs() (DescribeAllENIsResult,
 	var trunkENI string
 	var multiCardENIIDs []string
 	efaENIs := make(map[string]bool, 0)
+	efaOnlyENIs := make(map[string]bool, 0)
 	tagMap := make(map[string]TagMap, len(ec2Response.NetworkInterfaces))
+	excludedENIs := make(map[string]bool)
+	includedENIs := make(map[string]bool)
 	for _, ec2res := range ec2Response.NetworkInterfaces {
 		eniID := aws.StringValue(ec2res.NetworkInterfaceId)
 		attachment := ec2res.Attachment
@@ -1359,16 +1587,28 @@ func (cache *EC2InstanceMetadataCache) DescribeAllENIs() (DescribeAllENIsResult,
 		if interfaceType == "efa" {
 			efaENIs[eniID] = true
 		}
+		// EFA-only interfaces have no IP addresses, but they still occupy an ENI slot on the instance
+		if interfaceType == "efa-only" {
+			efaOnlyENIs[eniID] = true
+		}
 		// Check IPv4 addresses
 		logOutOfSyncState(eniID, eniMetadata.IPv4Addresses, ec2res.PrivateIpAddresses)
 		tagMap[eniMetadata.ENIID] = convertSDKTagsToTags(ec2res.TagSet)
+		if cache.excludedENIs.has(eniID, aws.StringValue(ec2res.MacAddress)) {
+			excludedENIs[eniID] = true
+		} else if cache.includedENIs.has(eniID, aws.StringValue(ec2res.MacAddress)) {
+			includedENIs[eniID] = true
+		}
 	}
 	return DescribeAllENIsResult{
 		ENIMetadata:     verifiedENIs,
 		TagMap:          tagMap,
 		TrunkENI:        trunkENI,
 		EFAENIs:         efaENIs,
+		EFAOnlyENIs:     efaOnlyENIs,
 		MultiCardENIIDs: multiCardENIIDs,
+		ExcludedENIs:    excludedENIs,
+		IncludedENIs:    includedENIs,
 	}, nil
 }
 
@@ -1427,6 +1667,36 @@ func loadAdditionalENITags() map[string]string {
 	return additionalENITags
 }
 
+// loadSecondaryENISGs loads the security groups of the secondary ENIs from environment variables, a comma-separated list
+func loadSecondaryENISGs() []string {
+	var sgs []string
+	for _, sg := range strings.Split(os.Getenv(secondaryENISGsEnvVar), ",") {
+		if sg = strings.TrimSpace(sg); sg != "" {
+			sgs = append(sgs, sg)
+		}
+	}
+	if len(sgs) > 0 {
+		log.Infof("Secondary ENIs use security groups %v", sgs)
+	}
+	return sgs
+}
+
+// loadSubnetMinFreeIPs loads the free IP floor of the discovered subnets from environment variables, 0 when it is not
+// set or invalid
+func loadSubnetMinFreeIPs() int64 {
+	minFreeIPsStr := os.Getenv(subnetMinFreeIPsEnvVar)
+	if minFreeIPsStr == "" {
+		return 0
+	}
+	minFreeIPs, err := strconv.ParseInt(minFreeIPsStr, 10, 64)
+	if err != nil || minFreeIPs < 0 {
+		log.Warnf("ignoring invalid %s %q", subnetMinFreeIPsEnvVar, minFreeIPsStr)
+		return 0
+	}
+	log.Infof("Subnets with fewer than %d free IPs are used last", minFreeIPs)
+	return minFreeIPs
+}
+
 var eniErrorMessageRegex = regexp.MustCompile("'([a-zA-Z0-9-]+)'")
 
 func badENIID(errMsg string) string {
@@ -1484,6 +1754,7 @@ func (cache *EC2InstanceMetadataCache) AllocIPAddress(eniID string) error {
 
 	start := time.Now()
 	output, err := cache.ec2SVC.AssignPrivateIpAddressesWithContext(context.Background(), input)
+	err = cache.ec2CallError("AssignPrivateIpAddresses", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("AssignPrivateIpAddresses").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("AssignPrivateIpAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -1507,6 +1778,7 @@ func (cache *EC2InstanceMetadataCache) FetchInstanceTypeLimits() error {
 	log.Debugf("Instance type limits are missing from vpc_ip_limits.go hence making an EC2 call to fetch the limits")
 	describeInstanceTypesInput := &ec2.DescribeInstanceTypesInput{InstanceTypes: []*string{aws.String(cache.instanceType)}}
 	output, err := cache.ec2SVC.DescribeInstanceTypesWithContext(context.Background(), describeInstanceTypesInput)
+	err = cache.ec2CallError("DescribeInstanceTypes", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeInstanceTypes").Inc()
 	if err != nil || len(output.InstanceTypes) != 1 {
 		prometheusmetrics.Ec2ApiErr.WithLabelValues("DescribeInstanceTypes").Inc()
@@ -1620,6 +1892,9 @@ func (cache *EC2InstanceMetadataCache) AllocIPAddresses(eniID string, numIPs int
 
 	log.Infof("Trying to allocate %d IP addresses on ENI %s", needIPs, eniID)
 	log.Debugf("PD enabled - %t", cache.enablePrefixDelegation)
+	if cache.ipamPoolID != "" {
+		return cache.allocIPAMPoolAddresses(context.Background(), eniID, needIPs)
+	}
 	input := &ec2.AssignPrivateIpAddressesInput{}
 
 	if cache.enablePrefixDelegation {
@@ -1638,6 +1913,7 @@ func (cache *EC2InstanceMetadataCache) AllocIPAddresses(eniID string, numIPs int
 
 	start := time.Now()
 	output, err := cache.ec2SVC.AssignPrivateIpAddressesWithContext(context.Background(), input)
+	err = cache.ec2CallError("AssignPrivateIpAddresses", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("AssignPrivateIpAddresses").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("AssignPrivateIpAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -1657,14 +1933,15 @@ func (cache *EC2InstanceMetadataCache) AllocIPAddresses(eniID string, numIPs int
 	return output, nil
 }
 
-func (cache *EC2InstanceMetadataCache) AllocIPv6Prefixes(eniID string) ([]*string, error) {
-	//We only need to allocate one IPv6 prefix per ENI.
+func (cache *EC2InstanceMetadataCache) AllocIPv6Prefixes(eniID string, count int) ([]*string, error) {
+	//A single IPv6 prefix per ENI is enough for most nodes, more can be configured for very dense ones.
 	input := &ec2.AssignIpv6AddressesInput{
 		NetworkInterfaceId: aws.String(eniID),
-		Ipv6PrefixCount:    aws.Int64(1),
+		Ipv6PrefixCount:    aws.Int64(int64(count)),
 	}
 	start := time.Now()
 	output, err := cache.ec2SVC.AssignIpv6AddressesWithContext(context.Background(), input)
+	err = cache.ec2CallError("AssignIpv6Addresses", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("AssignIpv6Addresses").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("AssignIpv6AddressesWithContext", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -1688,6 +1965,7 @@ func (cache *EC2InstanceMetadataCache) WaitForENIAndIPsAttached(eni string, want
 func (cache *EC2InstanceMetadataCache) waitForENIAndIPsAttached(eni string, wantedCidrs int, maxBackoffDelay time.Duration) (eniMetadata ENIMetadata, err error) {
 	start := time.Now()
 	attempt := 0
+	poolAllocated := false
 	// Wait until the ENI shows up in the instance metadata service and has at least some secondary IPs
 	err = retry.NWithBackoff(retry.NewSimpleBackoff(time.Millisecond*100, maxBackoffDelay, 0.15, 2.0), maxENIEC2APIRetries, func() error {
 		attempt++
@@ -1714,6 +1992,14 @@ func (cache *EC2InstanceMetadataCache) waitForENIAndIPsAttached(eni string, want
 					eniIPCount = len(returnedENI.IPv4Addresses) - 1
 				}
 
+				if eniIPCount < 1 && cache.ipamPoolID != "" && !cache.v6Enabled && !poolAllocated {
+					// ENIs are created without IPs, which are allocated from the IPAM pool in the subnet of the ENI
+					if _, err := cache.allocIPAMPoolAddresses(context.Background(), eni, wantedCidrs); err != nil {
+						log.Warnf("Failed to allocate IPs from IPAM pool %s for ENI %s: %v", cache.ipamPoolID, eni, err)
+						return ErrNoSecondaryIPsFound
+					}
+					poolAllocated = true
+				}
 				if eniIPCount < 1 {
 					log.Debugf("No secondary IPv4 addresses/prefixes available yet on ENI %s", returnedENI.ENIID)
 					return ErrNoSecondaryIPsFound
@@ -1766,6 +2052,7 @@ func (cache *EC2InstanceMetadataCache) DeallocIPAddresses(eniID string, ips []st
 
 	start := time.Now()
 	_, err := cache.ec2SVC.UnassignPrivateIpAddressesWithContext(context.Background(), input)
+	err = cache.ec2CallError("UnassignPrivateIpAddresses", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("UnassignPrivateIpAddresses").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("UnassignPrivateIpAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -1776,6 +2063,13 @@ func (cache *EC2InstanceMetadataCache) DeallocIPAddresses(eniID string, ips []st
 		return errors.Wrap(err, fmt.Sprintf("deallocate IP addresses: failed to deallocate private IP addresses: %s", ips))
 	}
 	log.Debugf("Successfully freed IPs %v from ENI %s", ips, eniID)
+	if cache.ipamPoolID != "" {
+		cidrs := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			cidrs = append(cidrs, ip+"/32")
+		}
+		cache.releaseIPAMPoolCIDRs(context.Background(), eniID, cidrs)
+	}
 	return nil
 }
 
@@ -1794,6 +2088,7 @@ func (cache *EC2InstanceMetadataCache) DeallocPrefixAddresses(eniID string, pref
 
 	start := time.Now()
 	_, err := cache.ec2SVC.UnassignPrivateIpAddressesWithContext(context.Background(), input)
+	err = cache.ec2CallError("UnassignPrivateIpAddresses", err)
 	prometheusmetrics.Ec2ApiReq.WithLabelValues("UnassignPrivateIpAddresses").Inc()
 	prometheusmetrics.AwsAPILatency.WithLabelValues("UnassignPrivateIpAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 	if err != nil {
@@ -1804,6 +2099,7 @@ func (cache *EC2InstanceMetadataCache) DeallocPrefixAddresses(eniID string, pref
 		return errors.Wrap(err, fmt.Sprintf("deallocate prefix: failed to deallocate Prefix addresses: %v", prefixes))
 	}
 	log.Debugf("Successfully freed Prefixes %v from ENI %s", prefixes, eniID)
+	cache.releaseIPAMPoolCIDRs(context.Background(), eniID, prefixes)
 	return nil
 }
 
@@ -1817,13 +2113,12 @@ func (cache *EC2InstanceMetadataCache) cleanUpLeakedENIsInternal(startupDelay ti
 	time.Sleep(startupDelay)
 
 	log.Debug("Checking for leaked AWS CNI ENIs.")
-	networkInterfaces, err := cache.getLeakedENIs()
+	eniIDs, err := cache.getLeakedENIs()
 	if err != nil {
 		log.Warnf("Unable to get leaked ENIs: %v", err)
 	} else {
 		// Clean up all the leaked ones we found
-		for _, networkInterface := range networkInterfaces {
-			eniID := aws.StringValue(networkInterface.NetworkInterfaceId)
+		for _, eniID := range eniIDs {
 			err = cache.deleteENI(eniID, maxENIBackoffDelay)
 			if err != nil {
 				awsUtilsErrInc("cleanUpLeakedENIDeleteErr", err)
@@ -1856,6 +2151,7 @@ func (cache *EC2InstanceMetadataCache) tagENIcreateTS(eniID string, maxBackoffDe
 	_ = retry.NWithBackoff(retry.NewSimpleBackoff(500*time.Millisecond, maxBackoffDelay, 0.3, 2), 5, func() error {
 		start := time.Now()
 		_, err := cache.ec2SVC.CreateTagsWithContext(context.Background(), input)
+		err = cache.ec2CallError("CreateTags", err)
 		prometheusmetrics.Ec2ApiReq.WithLabelValues("CreateTags").Inc()
 		prometheusmetrics.AwsAPILatency.WithLabelValues("CreateTags", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
 		if err != nil {
@@ -1870,14 +2166,14 @@ func (cache *EC2InstanceMetadataCache) tagENIcreateTS(eniID string, maxBackoffDe
 	})
 }
 
-// getLeakedENIs calls DescribeNetworkInterfaces to get all available ENIs that were allocated by
+// getLeakedENIs calls DescribeNetworkInterfaces to get the IDs of all available ENIs that were allocated by
 // the AWS CNI plugin, but were not deleted.
-func (cache *EC2InstanceMetadataCache) getLeakedENIs() ([]*ec2.NetworkInterface, error) {
+func (cache *EC2InstanceMetadataCache) getLeakedENIs() ([]string, error) {
 	leakedENIFilters := []*ec2.Filter{
 		{
 			Name: aws.String("tag-key"),
 			Values: []*string{
-				aws.String(eniNodeTagKey),
+				aws.String(ENINodeTagKey),
 			},
 		},
 		{
@@ -1895,7 +2191,7 @@ func (cache *EC2InstanceMetadataCache) getLeakedENIs() ([]*ec2.NetworkInterface,
 	}
 	if cache.clusterName != "" {
 		leakedENIFilters = append(leakedENIFilters, &ec2.Filter{
-			Name: aws.String(fmt.Sprintf("tag:%s", eniClusterTagKey)),
+			Name: aws.String(fmt.Sprintf("tag:%s", ENIClusterTagKey)),
 			Values: []*string{
 				aws.String(cache.clusterName),
 			},
@@ -1907,10 +2203,15 @@ func (cache *EC2InstanceMetadataCache) getLeakedENIs() ([]*ec2.NetworkInterface,
 		MaxResults: aws.Int64(describeENIPageSize),
 	}
 
-	var networkInterfaces []*ec2.NetworkInterface
+	// Only the IDs are kept, so that the pages of ENIs can be freed once processed
+	var eniIDs []string
 	filterFn := func(networkInterface *ec2.NetworkInterface) error {
 		// Verify the description starts with "aws-K8S-"
-		if !strings.HasPrefix(aws.StringValue(networkInterface.Description), eniDescriptionPrefix) {
+		if !strings.HasPrefix(aws.StringValue(networkInterface.Description), ENIDescriptionPrefix) {
+			return nil
+		}
+		if cache.excludedENIs.has(aws.StringValue(networkInterface.NetworkInterfaceId), aws.StringValue(networkInterface.MacAddress)) {
+			log.Infof("Not cleaning up ENI %s since it is excluded", aws.StringValue(networkInterface.NetworkInterfaceId))
 			return nil
 		}
 		// Check that it's not a newly created ENI
@@ -1934,7 +2235,7 @@ func (cache *EC2InstanceMetadataCache) getLeakedENIs() ([]*ec2.NetworkInterface,
 			cache.tagENIcreateTS(aws.StringValue(networkInterface.NetworkInterfaceId), maxENIBackoffDelay)
 			return nil
 		}
-		networkInterfaces = append(networkInterfaces, networkInterface)
+		eniIDs = append(eniIDs, aws.StringValue(networkInterface.NetworkInterfaceId))
 		return nil
 	}
 
@@ -1943,13 +2244,13 @@ func (cache *EC2InstanceMetadataCache) getLeakedENIs() ([]*ec2.NetworkInterface,
 		return nil, errors.Wrap(err, "awsutils: unable to obtain filtered list of network interfaces")
 	}
 
-	if len(networkInterfaces) < 1 {
+	if len(eniIDs) < 1 {
 		log.Debug("No AWS CNI leaked ENIs found.")
 		return nil, nil
 	}
 
-	log.Debugf("Found %d leaked ENIs with the AWS CNI tag.", len(networkInterfaces))
-	return networkInterfaces, nil
+	log.Debugf("Found %d leaked ENIs with the AWS CNI tag.", len(eniIDs))
+	return eniIDs, nil
 }
 
 // GetVPCIPv4CIDRs returns VPC CIDRs
@@ -2022,30 +2323,42 @@ func (cache *EC2InstanceMetadataCache) IsUnmanagedENI(eniID string) bool {
 	return false
 }
 
+// getENIsFromPaginatedDescribeNetworkInterfaces streams the ENIs of a paginated DescribeNetworkInterfaces call through
+// filterFn, one page at a time. filterFn must not keep the ENIs it is given, only what it needs of them, so that only one
+// page is held in memory however many ENIs match the filters.
 func (cache *EC2InstanceMetadataCache) getENIsFromPaginatedDescribeNetworkInterfaces(
 	input *ec2.DescribeNetworkInterfacesInput, filterFn func(networkInterface *ec2.NetworkInterface) error) error {
 	pageNum := 0
 	var innerErr error
+	start := time.Now()
 	pageFn := func(output *ec2.DescribeNetworkInterfacesOutput, lastPage bool) (nextPage bool) {
 		pageNum++
+		// Every page is a call to EC2
+		prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
+		prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeNetworkInterfaces", "false", awsReqStatus(nil)).Observe(msSince(start))
 		log.Debugf("EC2 DescribeNetworkInterfaces succeeded with %d results on page %d",
 			len(output.NetworkInterfaces), pageNum)
-		for _, eni := range output.NetworkInterfaces {
+		for i, eni := range output.NetworkInterfaces {
 			if err := filterFn(eni); err != nil {
 				innerErr = err
 				return false
 			}
+			// The SDK keeps the page until the next one is read, the processed ENIs can be freed already
+			output.NetworkInterfaces[i] = nil
 		}
+		start = time.Now()
 		return true
 	}
 
 	if err := cache.ec2SVC.DescribeNetworkInterfacesPagesWithContext(context.TODO(), input, pageFn); err != nil {
+		err = cache.ec2CallError("DescribeNetworkInterfaces", err)
 		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeNetworkInterfaces")
 		awsAPIErrInc("DescribeNetworkInterfaces", err)
+		prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
+		prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeNetworkInterfaces", "true", awsReqStatus(err)).Observe(msSince(start))
 		prometheusmetrics.Ec2ApiErr.WithLabelValues("DescribeNetworkInterfaces").Inc()
 		return err
 	}
-	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeNetworkInterfaces").Inc()
 	return innerErr
 }
 
@@ -2074,12 +2387,10 @@ func (cache *EC2InstanceMetadataCache) IsPrimaryENI(eniID string) bool {
 }
 
 func checkAPIErrorAndBroadcastEvent(err error, api string) {
-	if aerr, ok := err.(awserr.Error); ok {
-		if aerr.Code() == "UnauthorizedOperation" {
-			if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
-				eventRecorder.SendPodEvent(v1.EventTypeWarning, "MissingIAMPermissions", api,
-					fmt.Sprintf("Unauthorized operation: failed to call %v due to missing permissions. Please refer https://github.com/aws/amazon-vpc-cni-k8s/blob/master/docs/iam-policy.md to attach relevant policy to IAM role", api))
-			}
+	if errors.Is(err, ErrUnauthorized) {
+		if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+			eventRecorder.SendPodEvent(v1.EventTypeWarning, "MissingIAMPermissions", api,
+				fmt.Sprintf("Unauthorized operation: failed to call %v due to missing permissions. Please refer https://github.com/aws/amazon-vpc-cni-k8s/blob/master/docs/iam-policy.md to attach relevant policy to IAM role", api))
 		}
 	}
 }
@@ -31,7 +31,10 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/awsfixture"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper"
 	mock_ec2wrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -201,6 +204,35 @@ func TestInitWithEC2metadataErr(t *testing.T) {
 	}
 }
 
+func TestInitWithEC2metadataIPv6OnlyNode(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	mockMetadata := testMetadata(nil)
+	delete(mockMetadata, metadataLocalIP)
+	delete(mockMetadata, metadataMACPath+primaryMAC+metadataSubnetCIDR)
+	delete(mockMetadata, metadataMACPath+primaryMAC+metadataIPv4s)
+	mockMetadata[metadataMACPath+primaryMAC+metadataIPv6Prefixes] = eni2v6Prefix
+
+	// IPv4 clusters need the IPv4 address of the node
+	cache := &EC2InstanceMetadataCache{imds: TypedIMDS{mockMetadata}, ec2SVC: mockEC2, v4Enabled: true}
+	assert.Error(t, cache.initWithEC2Metadata(ctx))
+
+	cache = &EC2InstanceMetadataCache{imds: TypedIMDS{mockMetadata}, ec2SVC: mockEC2, v6Enabled: true}
+	if assert.NoError(t, cache.initWithEC2Metadata(ctx)) {
+		assert.Nil(t, cache.localIPv4)
+		assert.Equal(t, primaryeniID, cache.primaryENI)
+	}
+	enis, err := cache.GetAttachedENIs()
+	if assert.NoError(t, err) && assert.Len(t, enis, 1) {
+		assert.Empty(t, enis[0].SubnetIPv4CIDR)
+		assert.Empty(t, enis[0].IPv4Addresses)
+		assert.Len(t, enis[0].IPv6Prefixes, 1)
+	}
+}
+
 func TestGetAttachedENIs(t *testing.T) {
 	mockMetadata := testMetadata(map[string]interface{}{
 		metadataMACPath: primaryMAC + " " + eni2MAC,
@@ -356,11 +388,12 @@ func TestDescribeAllENIs(t *testing.T) {
 		n       int
 		awsErr  error
 		expErr  error
+		expIs   error
 	}{
-		{"Success DescribeENI", map[string]TagMap{"": {"foo": "foo-value"}}, 1, nil, nil},
-		{"Not found error", nil, maxENIEC2APIRetries, awserr.New("InvalidNetworkInterfaceID.NotFound", "no 'eni-xxx'", nil), expectedError},
-		{"Not found, no message", nil, maxENIEC2APIRetries, awserr.New("InvalidNetworkInterfaceID.NotFound", "no message", nil), noMessageError},
-		{"Other error", nil, maxENIEC2APIRetries, err, err},
+		{"Success DescribeENI", map[string]TagMap{"": {"foo": "foo-value"}}, 1, nil, nil, nil},
+		{"Not found error", nil, maxENIEC2APIRetries, awserr.New("InvalidNetworkInterfaceID.NotFound", "no 'eni-xxx'", nil), expectedError, ErrNotFound},
+		{"Not found, no message", nil, maxENIEC2APIRetries, awserr.New("InvalidNetworkInterfaceID.NotFound", "no message", nil), noMessageError, ErrNotFound},
+		{"Other error", nil, maxENIEC2APIRetries, err, err, err},
 	}
 
 	mockMetadata := testMetadata(nil)
@@ -369,7 +402,12 @@ func TestDescribeAllENIs(t *testing.T) {
 		mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Times(tc.n).Return(result, tc.awsErr)
 		cache := &EC2InstanceMetadataCache{imds: TypedIMDS{mockMetadata}, ec2SVC: mockEC2}
 		metaData, err := cache.DescribeAllENIs()
-		assert.Equal(t, tc.expErr, err, tc.name)
+		if tc.expErr == nil {
+			assert.NoError(t, err, tc.name)
+		} else {
+			assert.EqualError(t, err, tc.expErr.Error(), tc.name)
+			assert.ErrorIs(t, err, tc.expIs, tc.name)
+		}
 		assert.Equal(t, tc.exptags, metaData.TagMap, tc.name)
 	}
 }
@@ -430,6 +468,148 @@ func TestAllocENI(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestGetVpcSubnetsPriority(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	withPriority := func(subnet *ec2.Subnet, priority string) *ec2.Subnet {
+		subnet.Tags = []*ec2.Tag{{Key: aws.String(subnetDiscoveryTagKey), Value: aws.String(priority)}}
+		return subnet
+	}
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+			testSubnet(subnetID, "us-west-2a", "", 300, false),
+			withPriority(testSubnet("subnet-draining", "us-west-2a", "", 500, true), "1"),
+			withPriority(testSubnet("subnet-preferred", "us-west-2a", "", 50, true), "10"),
+			withPriority(testSubnet("subnet-preferred-large", "us-west-2a", "", 100, true), "10"),
+			withPriority(testSubnet("subnet-no-priority", "us-west-2a", "", 400, true), ""),
+		}}, nil)
+
+	// The subnets of the highest priority come first, then the ones with the most free IPs
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, availabilityZone: "us-west-2a"}
+	result, err := cache.getVpcSubnets()
+	assert.NoError(t, err)
+	var ids []string
+	for _, subnet := range result {
+		ids = append(ids, aws.StringValue(subnet.SubnetId))
+	}
+	assert.Equal(t, []string{"subnet-preferred-large", "subnet-preferred", "subnet-draining", "subnet-no-priority", subnetID}, ids)
+}
+
+func TestGetVpcSubnetsHeadroom(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	preferred := testSubnet("subnet-preferred", "us-west-2a", "", 20, true)
+	preferred.Tags[0].Value = aws.String("10")
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+			preferred,
+			testSubnet("subnet-small", "us-west-2a", "", 40, true),
+			testSubnet("subnet-large", "us-west-2a", "", 300, true),
+		}}, nil).Times(2)
+
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, availabilityZone: "us-west-2a"}
+	result, err := cache.getVpcSubnets()
+	assert.NoError(t, err)
+	assert.Equal(t, "subnet-preferred", aws.StringValue(result[0].SubnetId))
+
+	// The preferred subnet is below the floor, it is only used when the others fail
+	cache.subnetMinFreeIPs = 50
+	result, err = cache.getVpcSubnets()
+	assert.NoError(t, err)
+	var ids []string
+	for _, subnet := range result {
+		ids = append(ids, aws.StringValue(subnet.SubnetId))
+	}
+	assert.Equal(t, []string{"subnet-large", "subnet-preferred", "subnet-small"}, ids)
+}
+
+func TestLoadSubnetMinFreeIPs(t *testing.T) {
+	assert.Equal(t, int64(0), loadSubnetMinFreeIPs())
+	t.Setenv(subnetMinFreeIPsEnvVar, "64")
+	assert.Equal(t, int64(64), loadSubnetMinFreeIPs())
+	t.Setenv(subnetMinFreeIPsEnvVar, "-1")
+	assert.Equal(t, int64(0), loadSubnetMinFreeIPs())
+}
+
+func TestCreateENIExcludedSubnets(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	excluded := func(subnet *ec2.Subnet) *ec2.Subnet {
+		subnet.Tags = []*ec2.Tag{{Key: aws.String(subnetDiscoveryTagKey), Value: aws.String("0")}}
+		return subnet
+	}
+	cache := &EC2InstanceMetadataCache{
+		ec2SVC:             mockEC2,
+		instanceType:       "c5n.18xlarge",
+		availabilityZone:   "us-west-2a",
+		subnetID:           subnetID,
+		useSubnetDiscovery: true,
+	}
+
+	// The subnet of the node is reserved, even though it has the most free IPs
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+			excluded(testSubnet(subnetID, "us-west-2a", "", 500, false)),
+			testSubnet("subnet-pods", "us-west-2a", "", 100, true),
+		}}, nil)
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *ec2.CreateNetworkInterfaceInput, _ ...interface{}) (*ec2.CreateNetworkInterfaceOutput, error) {
+			assert.Equal(t, "subnet-pods", aws.StringValue(input.SubnetId))
+			return &ec2.CreateNetworkInterfaceOutput{NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String(eniID)}}, nil
+		})
+	id, err := cache.createENI(false, nil, "", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, eniID, id)
+
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+			excluded(testSubnet(subnetID, "us-west-2a", "", 500, false)),
+			excluded(testSubnet("subnet-pods", "us-west-2a", "", 100, true)),
+		}}, nil)
+	_, err = cache.createENI(false, nil, "", 5)
+	assert.Error(t, err)
+}
+
+func TestSecondaryENISecurityGroups(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	cache := &EC2InstanceMetadataCache{
+		ec2SVC:          mockEC2,
+		imds:            TypedIMDS{testMetadata(nil)},
+		instanceType:    "c5n.18xlarge",
+		primaryENI:      primaryeniID,
+		secondaryENISGs: []string{"sg-pods"},
+	}
+	ds := datastore.NewDataStore(log, datastore.NewTestCheckpoint(datastore.CheckpointData{Version: datastore.CheckpointFormatVersion}), false)
+	assert.NoError(t, ds.AddENI(primaryeniID, 0, true, false, false))
+	assert.NoError(t, ds.AddENI(eni2ID, 1, false, false, false))
+
+	// The secondary ENIs get their own security groups, the primary ENI keeps the ones of the node
+	mockEC2.EXPECT().ModifyNetworkInterfaceAttributeWithContext(gomock.Any(), &ec2.ModifyNetworkInterfaceAttributeInput{
+		Groups:             aws.StringSlice([]string{"sg-pods"}),
+		NetworkInterfaceId: aws.String(eni2ID),
+	}).Return(nil, nil)
+	assert.NoError(t, cache.RefreshSGIDs(primaryMAC, ds))
+
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *ec2.CreateNetworkInterfaceInput, _ ...interface{}) (*ec2.CreateNetworkInterfaceOutput, error) {
+			assert.Equal(t, []string{"sg-pods"}, aws.StringValueSlice(input.Groups))
+			return &ec2.CreateNetworkInterfaceOutput{NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String(eniID)}}, nil
+		})
+	_, err := cache.createENI(false, nil, "", 5)
+	assert.NoError(t, err)
+}
+
+func TestLoadSecondaryENISGs(t *testing.T) {
+	assert.Empty(t, loadSecondaryENISGs())
+	t.Setenv(secondaryENISGsEnvVar, "sg-pods, sg-monitoring,")
+	assert.Equal(t, []string{"sg-pods", "sg-monitoring"}, loadSecondaryENISGs())
+}
+
 func TestAllocENINoFreeDevice(t *testing.T) {
 	ctrl, mockEC2 := setup(t)
 	defer ctrl.Finish()
@@ -1138,11 +1318,11 @@ func TestEC2InstanceMetadataCache_cleanUpLeakedENIsInternal(t *testing.T) {
 	ctrl, mockEC2 := setup(t)
 	defer ctrl.Finish()
 
-	description := eniDescriptionPrefix + "test"
+	description := ENIDescriptionPrefix + "test"
 	interfaces := []*ec2.NetworkInterface{{
 		Description: &description,
 		TagSet: []*ec2.Tag{
-			{Key: aws.String(eniNodeTagKey), Value: aws.String("test-value")},
+			{Key: aws.String(ENINodeTagKey), Value: aws.String("test-value")},
 		},
 	}}
 
@@ -1167,6 +1347,42 @@ func setupDescribeNetworkInterfacesPagesWithContextMock(
 		})
 }
 
+func TestEC2InstanceMetadataCache_getENIsFromPaginatedDescribeNetworkInterfaces(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	pages := []*ec2.DescribeNetworkInterfacesOutput{
+		{NetworkInterfaces: []*ec2.NetworkInterface{{NetworkInterfaceId: aws.String("eni-1")}, {NetworkInterfaceId: aws.String("eni-2")}}},
+		{NetworkInterfaces: []*ec2.NetworkInterface{{NetworkInterfaceId: aws.String("eni-3")}}},
+	}
+	mockEC2.EXPECT().
+		DescribeNetworkInterfacesPagesWithContext(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *ec2.DescribeNetworkInterfacesInput,
+			fn func(*ec2.DescribeNetworkInterfacesOutput, bool) bool, _ ...request.Option) error {
+			for i, page := range pages {
+				if !fn(page, i == len(pages)-1) {
+					break
+				}
+			}
+			return nil
+		})
+
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2}
+	var eniIDs []string
+	err := cache.getENIsFromPaginatedDescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{}, func(eni *ec2.NetworkInterface) error {
+		eniIDs = append(eniIDs, aws.StringValue(eni.NetworkInterfaceId))
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eni-1", "eni-2", "eni-3"}, eniIDs)
+	// The processed ENIs are not referenced by the pages anymore
+	for _, page := range pages {
+		for _, eni := range page.NetworkInterfaces {
+			assert.Nil(t, eni)
+		}
+	}
+}
+
 func TestEC2InstanceMetadataCache_buildENITags(t *testing.T) {
 	type fields struct {
 		instanceID        string
@@ -1242,7 +1458,7 @@ func TestEC2InstanceMetadataCache_getLeakedENIs(t *testing.T) {
 	tests := []struct {
 		name    string
 		fields  fields
-		want    []*ec2.NetworkInterface
+		want    []string
 		wantErr error
 	}{
 		{
@@ -1325,23 +1541,7 @@ func TestEC2InstanceMetadataCache_getLeakedENIs(t *testing.T) {
 					},
 				},
 			},
-			want: []*ec2.NetworkInterface{
-				{
-					NetworkInterfaceId: aws.String("eni-1"),
-					Description:        aws.String("aws-K8S-i-xxxxx"),
-					Status:             aws.String("available"),
-					TagSet: []*ec2.Tag{
-						{
-							Key:   aws.String("node.k8s.amazonaws.com/instance_id"),
-							Value: aws.String("i-xxxxx"),
-						},
-						{
-							Key:   aws.String("node.k8s.amazonaws.com/createdAt"),
-							Value: aws.String(tenMinuteAgo.Format(time.RFC3339)),
-						},
-					},
-				},
-			},
+			want: []string{"eni-1"},
 		},
 		{
 			name: "without clusterName - one ENI - description didn't match",
@@ -1529,27 +1729,7 @@ func TestEC2InstanceMetadataCache_getLeakedENIs(t *testing.T) {
 					},
 				},
 			},
-			want: []*ec2.NetworkInterface{
-				{
-					NetworkInterfaceId: aws.String("eni-1"),
-					Description:        aws.String("aws-K8S-i-xxxxx"),
-					Status:             aws.String("available"),
-					TagSet: []*ec2.Tag{
-						{
-							Key:   aws.String("node.k8s.amazonaws.com/instance_id"),
-							Value: aws.String("i-xxxxx"),
-						},
-						{
-							Key:   aws.String("node.k8s.amazonaws.com/createdAt"),
-							Value: aws.String(tenMinuteAgo.Format(time.RFC3339)),
-						},
-						{
-							Key:   aws.String("cluster.k8s.amazonaws.com/name"),
-							Value: aws.String("awesome-cluster"),
-						},
-					},
-				},
-			},
+			want: []string{"eni-1"},
 		},
 		{
 			name: "with clusterName - one ENI - description didn't match",
@@ -2020,3 +2200,20 @@ func Test_loadAdditionalENITags(t *testing.T) {
 		})
 	}
 }
+
+func TestEC2InstanceMetadataCache_cleanUpLeakedENIsFixture(t *testing.T) {
+	cache := &EC2InstanceMetadataCache{
+		ec2SVC: ec2wrapper.New(awsfixture.Session(t, "testdata/fixtures/leaked-enis.json")),
+		vpcID:  "vpc-0c6c1a7e05d6ed3f3",
+	}
+
+	// Over two pages, ENIs that were not created by the CNI or that are too recent are left alone
+	eniIDs, err := cache.getLeakedENIs()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"eni-0a1b2c3d4e5f60001", "eni-0a1b2c3d4e5f60003"}, eniIDs)
+
+	// An ENI that is already gone counts as deleted
+	for _, eniID := range eniIDs {
+		assert.NoError(t, cache.deleteENI(eniID, time.Millisecond))
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// AllocateCarrierIP allocates a carrier IP in the network border group of the Wavelength Zone of the instance, and
+// associates it with the private IP of the ENI. The carrier IP is tagged with the instance, so that the carrier IPs
+// of the pods can be found again after a restart. It returns the carrier IP.
+func (cache *EC2InstanceMetadataCache) AllocateCarrierIP(ctx context.Context, eniID, privateIP string) (string, error) {
+	if !cache.InWavelengthZone() {
+		return "", errors.Errorf("carrier IPs are only available in Wavelength Zones, the instance is in %s %s",
+			cache.zoneType, cache.availabilityZone)
+	}
+
+	start := time.Now()
+	allocateOutput, err := cache.ec2SVC.AllocateAddressWithContext(ctx, &ec2.AllocateAddressInput{
+		Domain: aws.String(ec2.DomainTypeVpc),
+		// The network border group of a Wavelength Zone is named after the zone
+		NetworkBorderGroup: aws.String(cache.availabilityZone),
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String(ec2.ResourceTypeElasticIp),
+				Tags:         convertTagsToSDKTags(cache.buildENITags()),
+			},
+		},
+	})
+	err = cache.ec2CallError("AllocateAddress", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("AllocateAddress").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("AllocateAddress", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:AllocateAddress")
+		awsAPIErrInc("AllocateAddress", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("AllocateAddress").Inc()
+		return "", errors.Wrapf(err, "failed to allocate a carrier IP in %s", cache.availabilityZone)
+	}
+	allocationID := aws.StringValue(allocateOutput.AllocationId)
+	carrierIP := aws.StringValue(allocateOutput.CarrierIp)
+
+	start = time.Now()
+	_, err = cache.ec2SVC.AssociateAddressWithContext(ctx, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String(allocationID),
+		NetworkInterfaceId: aws.String(eniID),
+		PrivateIpAddress:   aws.String(privateIP),
+	})
+	err = cache.ec2CallError("AssociateAddress", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("AssociateAddress").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("AssociateAddress", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:AssociateAddress")
+		awsAPIErrInc("AssociateAddress", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("AssociateAddress").Inc()
+		if releaseErr := cache.releaseAddress(ctx, allocationID); releaseErr != nil {
+			log.Errorf("Failed to release carrier IP %s that could not be associated: %v", carrierIP, releaseErr)
+		}
+		return "", errors.Wrapf(err, "failed to associate carrier IP %s with %s on ENI %s", carrierIP, privateIP, eniID)
+	}
+	log.Infof("Associated carrier IP %s with %s on ENI %s", carrierIP, privateIP, eniID)
+	return carrierIP, nil
+}
+
+// ReleaseCarrierIP disassociates and releases the carrier IPs associated with the private IP, if any. An empty private
+// IP releases the carrier IPs of the instance that are not associated with any private IP.
+func (cache *EC2InstanceMetadataCache) ReleaseCarrierIP(ctx context.Context, privateIP string) error {
+	addresses, err := cache.describeCarrierIPs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, address := range addresses {
+		if aws.StringValue(address.PrivateIpAddress) != privateIP {
+			continue
+		}
+		if associationID := aws.StringValue(address.AssociationId); associationID != "" {
+			start := time.Now()
+			_, err = cache.ec2SVC.DisassociateAddressWithContext(ctx, &ec2.DisassociateAddressInput{
+				AssociationId: aws.String(associationID),
+			})
+			err = cache.ec2CallError("DisassociateAddress", err)
+			prometheusmetrics.Ec2ApiReq.WithLabelValues("DisassociateAddress").Inc()
+			prometheusmetrics.AwsAPILatency.WithLabelValues("DisassociateAddress", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				checkAPIErrorAndBroadcastEvent(err, "ec2:DisassociateAddress")
+				awsAPIErrInc("DisassociateAddress", err)
+				prometheusmetrics.Ec2ApiErr.WithLabelValues("DisassociateAddress").Inc()
+				return errors.Wrapf(err, "failed to disassociate carrier IP %s from %s", aws.StringValue(address.CarrierIp), privateIP)
+			}
+		}
+		if err = cache.releaseAddress(ctx, aws.StringValue(address.AllocationId)); err != nil {
+			return err
+		}
+		log.Infof("Released carrier IP %s of %s", aws.StringValue(address.CarrierIp), privateIP)
+	}
+	return nil
+}
+
+// GetCarrierIPs returns the carrier IPs allocated for the instance, by the private IP they are associated with. The
+// carrier IPs that are not associated with any private IP are listed under an empty private IP.
+func (cache *EC2InstanceMetadataCache) GetCarrierIPs(ctx context.Context) (map[string][]string, error) {
+	addresses, err := cache.describeCarrierIPs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	carrierIPs := map[string][]string{}
+	for _, address := range addresses {
+		privateIP := aws.StringValue(address.PrivateIpAddress)
+		carrierIPs[privateIP] = append(carrierIPs[privateIP], aws.StringValue(address.CarrierIp))
+	}
+	return carrierIPs, nil
+}
+
+// describeCarrierIPs returns the carrier IPs tagged with the instance
+func (cache *EC2InstanceMetadataCache) describeCarrierIPs(ctx context.Context) ([]*ec2.Address, error) {
+	start := time.Now()
+	result, err := cache.ec2SVC.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:" + ENINodeTagKey),
+				Values: []*string{aws.String(cache.instanceID)},
+			},
+		},
+	})
+	err = cache.ec2CallError("DescribeAddresses", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeAddresses").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeAddresses")
+		awsAPIErrInc("DescribeAddresses", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("DescribeAddresses").Inc()
+		return nil, errors.Wrap(err, "failed to describe the carrier IPs of the instance")
+	}
+	var addresses []*ec2.Address
+	for _, address := range result.Addresses {
+		if aws.StringValue(address.CarrierIp) != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses, nil
+}
+
+func (cache *EC2InstanceMetadataCache) releaseAddress(ctx context.Context, allocationID string) error {
+	start := time.Now()
+	_, err := cache.ec2SVC.ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{
+		AllocationId:       aws.String(allocationID),
+		NetworkBorderGroup: aws.String(cache.availabilityZone),
+	})
+	err = cache.ec2CallError("ReleaseAddress", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("ReleaseAddress").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("ReleaseAddress", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:ReleaseAddress")
+		awsAPIErrInc("ReleaseAddress", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("ReleaseAddress").Inc()
+		return errors.Wrapf(err, "failed to release address %s", allocationID)
+	}
+	return nil
+}
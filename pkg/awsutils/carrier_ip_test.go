@@ -0,0 +1,111 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_ec2wrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper/mocks"
+)
+
+const wavelengthZone = "us-east-1-wl1-bos-wlz-1"
+
+func wavelengthCache(mockEC2 *mock_ec2wrapper.MockEC2) *EC2InstanceMetadataCache {
+	return &EC2InstanceMetadataCache{
+		ec2SVC:           mockEC2,
+		instanceID:       instanceID,
+		region:           "us-east-1",
+		availabilityZone: wavelengthZone,
+		zoneType:         ZoneTypeWavelengthZone,
+	}
+}
+
+func TestAllocateCarrierIP(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	cache := wavelengthCache(mockEC2)
+
+	mockEC2.EXPECT().AllocateAddressWithContext(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *ec2.AllocateAddressInput, _ ...interface{}) (*ec2.AllocateAddressOutput, error) {
+			assert.Equal(t, wavelengthZone, aws.StringValue(input.NetworkBorderGroup))
+			assert.Equal(t, instanceID, aws.StringValue(input.TagSpecifications[0].Tags[0].Value))
+			return &ec2.AllocateAddressOutput{AllocationId: aws.String("eipalloc-1"), CarrierIp: aws.String("155.146.0.10")}, nil
+		})
+	mockEC2.EXPECT().AssociateAddressWithContext(ctx, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String("eipalloc-1"),
+		NetworkInterfaceId: aws.String(eniID),
+		PrivateIpAddress:   aws.String("10.0.0.5"),
+	}).Return(&ec2.AssociateAddressOutput{}, nil)
+
+	carrierIP, err := cache.AllocateCarrierIP(ctx, eniID, "10.0.0.5")
+	assert.NoError(t, err)
+	assert.Equal(t, "155.146.0.10", carrierIP)
+
+	// A carrier IP that can not be associated is released
+	mockEC2.EXPECT().AllocateAddressWithContext(ctx, gomock.Any()).
+		Return(&ec2.AllocateAddressOutput{AllocationId: aws.String("eipalloc-2"), CarrierIp: aws.String("155.146.0.11")}, nil)
+	mockEC2.EXPECT().AssociateAddressWithContext(ctx, gomock.Any()).Return(nil, errors.New("InvalidParameterValue"))
+	mockEC2.EXPECT().ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{
+		AllocationId:       aws.String("eipalloc-2"),
+		NetworkBorderGroup: aws.String(wavelengthZone),
+	}).Return(&ec2.ReleaseAddressOutput{}, nil)
+	_, err = cache.AllocateCarrierIP(ctx, eniID, "10.0.0.6")
+	assert.Error(t, err)
+
+	// There are no carrier IPs outside of Wavelength Zones
+	cache = &EC2InstanceMetadataCache{ec2SVC: mockEC2, availabilityZone: "us-east-1a", zoneType: ZoneTypeAvailabilityZone}
+	_, err = cache.AllocateCarrierIP(ctx, eniID, "10.0.0.5")
+	assert.Error(t, err)
+}
+
+func TestReleaseCarrierIP(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	cache := wavelengthCache(mockEC2)
+
+	addresses := &ec2.DescribeAddressesOutput{Addresses: []*ec2.Address{
+		{AllocationId: aws.String("eipalloc-1"), AssociationId: aws.String("eipassoc-1"), CarrierIp: aws.String("155.146.0.10"), PrivateIpAddress: aws.String("10.0.0.5")},
+		{AllocationId: aws.String("eipalloc-2"), CarrierIp: aws.String("155.146.0.11")},
+		// Elastic IPs tagged with the instance are not carrier IPs
+		{AllocationId: aws.String("eipalloc-3"), PublicIp: aws.String("54.0.0.1"), PrivateIpAddress: aws.String("10.0.0.5")},
+	}}
+	mockEC2.EXPECT().DescribeAddressesWithContext(ctx, gomock.Any()).Return(addresses, nil).Times(3)
+
+	mockEC2.EXPECT().DisassociateAddressWithContext(ctx, &ec2.DisassociateAddressInput{AssociationId: aws.String("eipassoc-1")}).
+		Return(&ec2.DisassociateAddressOutput{}, nil)
+	mockEC2.EXPECT().ReleaseAddressWithContext(ctx, &ec2.ReleaseAddressInput{
+		AllocationId:       aws.String("eipalloc-1"),
+		NetworkBorderGroup: aws.String(wavelengthZone),
+	}).Return(&ec2.ReleaseAddressOutput{}, nil)
+	assert.NoError(t, cache.ReleaseCarrierIP(ctx, "10.0.0.5"))
+
+	// An address already released is not an error
+	mockEC2.EXPECT().ReleaseAddressWithContext(ctx, gomock.Any()).
+		Return(nil, awserr.New("InvalidAllocationID.NotFound", "not found", nil))
+	assert.NoError(t, cache.ReleaseCarrierIP(ctx, ""))
+
+	carrierIPs, err := cache.GetCarrierIPs(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"10.0.0.5": {"155.146.0.10"}, "": {"155.146.0.11"}}, carrierIPs)
+}
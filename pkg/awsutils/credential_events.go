@@ -0,0 +1,59 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/awssession"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+const (
+	awsCredentialsUnavailableReason = "AWSCredentialsUnavailable"
+	awsCredentialsRefreshedReason   = "AWSCredentialsRefreshed"
+)
+
+// credentialEventHandler returns the handler that sends an event on the aws-node pod when the EC2 requests start
+// failing to authenticate, and when they authenticate again once the credentials are refreshed. The session refreshes
+// the credentials on its own, the events only make the outage visible.
+func credentialEventHandler() request.NamedHandler {
+	var lock sync.Mutex
+	failing := false
+	return request.NamedHandler{
+		Name: "amazon-vpc-cni-k8s/credential-events",
+		Fn: func(r *request.Request) {
+			lock.Lock()
+			defer lock.Unlock()
+			switch {
+			case r.Error == nil && failing:
+				failing = false
+				if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+					eventRecorder.SendPodEvent(v1.EventTypeNormal, awsCredentialsRefreshedReason, r.Operation.Name,
+						"EC2 requests authenticate again with the refreshed AWS credentials")
+				}
+			case r.Error != nil && !failing && awssession.IsAuthFailure(r.Error):
+				failing = true
+				if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+					eventRecorder.SendPodEvent(v1.EventTypeWarning, awsCredentialsUnavailableReason, r.Operation.Name,
+						fmt.Sprintf("EC2 requests fail to authenticate, the AWS credentials are refreshed on the next request: %v", r.Error))
+				}
+			}
+		},
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestCredentialEventHandler(t *testing.T) {
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+	handler := credentialEventHandler()
+	send := func(err error) {
+		handler.Fn(&request.Request{Operation: &request.Operation{Name: "AssignPrivateIpAddresses"}, Error: err})
+	}
+
+	send(nil)
+	assert.Len(t, fakeRecorder.Events, 0)
+
+	// One event for the outage, whatever the number of failed requests
+	send(awserr.New("WebIdentityErr", "failed fetching WebIdentity token", nil))
+	send(awserr.New("WebIdentityErr", "failed fetching WebIdentity token", nil))
+	if assert.Len(t, fakeRecorder.Events, 1) {
+		assert.Contains(t, <-fakeRecorder.Events, awsCredentialsUnavailableReason)
+	}
+
+	send(nil)
+	if assert.Len(t, fakeRecorder.Events, 1) {
+		assert.Contains(t, <-fakeRecorder.Events, awsCredentialsRefreshedReason)
+	}
+	send(nil)
+	assert.Len(t, fakeRecorder.Events, 0)
+}
@@ -0,0 +1,250 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	// Status of an EC2 permission needed by the configuration
+	PermissionAllowed    = "Allowed"
+	PermissionDenied     = "Denied"
+	PermissionUnverified = "Unverified"
+
+	// dryRunSucceededCode is returned by EC2 for a DryRun request that would have succeeded
+	dryRunSucceededCode = "DryRunOperation"
+	unauthorizedCode    = "UnauthorizedOperation"
+)
+
+// definitiveConfigErrorCodes are the EC2 error codes that can not be fixed by retrying
+var definitiveConfigErrorCodes = map[string]bool{
+	unauthorizedCode:                     true,
+	"InvalidSubnetID.NotFound":           true,
+	"InvalidSubnetID.Malformed":          true,
+	"InvalidGroup.NotFound":              true,
+	"InvalidGroupId.Malformed":           true,
+	"InvalidNetworkInterfaceID.NotFound": true,
+}
+
+// ValidateEC2Config checks with DryRun calls that the ENIs ipamd needs for its configuration can be created in subnetID
+// with securityGroups, tagged and described. An empty subnetID and securityGroups use the
+// subnet and security groups of the primary ENI. Only errors that retrying can not fix are returned, other errors are
+// logged.
+func (cache *EC2InstanceMetadataCache) ValidateEC2Config(ctx context.Context, subnetID string, securityGroups []*string, checkENIProvisioning bool) []error {
+	if subnetID == "" {
+		subnetID = cache.subnetID
+	}
+	if len(securityGroups) == 0 {
+		securityGroups = aws.StringSlice(cache.securityGroups.SortedList())
+	}
+
+	var errs []error
+	check := func(api, resource string, err error) {
+		if err == nil {
+			return
+		}
+		aerr, ok := err.(awserr.Error)
+		if ok && aerr.Code() == dryRunSucceededCode {
+			return
+		}
+		if !ok || !definitiveConfigErrorCodes[aerr.Code()] {
+			log.Warnf("Could not validate ec2:%s for %s: %v", api, resource, err)
+			return
+		}
+		if aerr.Code() == unauthorizedCode {
+			errs = append(errs, fmt.Errorf("the node IAM role is not allowed to call ec2:%s for %s", api, resource))
+		} else {
+			errs = append(errs, fmt.Errorf("ec2:%s failed for %s: %s: %s", api, resource, aerr.Code(), aerr.Message()))
+		}
+	}
+
+	_, err := cache.ec2SVC.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{SubnetIds: []*string{aws.String(subnetID)}})
+	check("DescribeSubnets", subnetID, err)
+
+	if checkENIProvisioning {
+		_, err = cache.ec2SVC.CreateNetworkInterfaceWithContext(ctx, cache.dryRunCreateNetworkInterfaceInput(subnetID, securityGroups))
+		check("CreateNetworkInterface", fmt.Sprintf("subnet %s with security groups %v", subnetID, aws.StringValueSlice(securityGroups)), err)
+	}
+
+	_, err = cache.ec2SVC.DescribeNetworkInterfacesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
+		DryRun:              aws.Bool(true),
+		NetworkInterfaceIds: []*string{aws.String(cache.primaryENI)},
+	})
+	check("DescribeNetworkInterfaces", cache.primaryENI, err)
+
+	if checkENIProvisioning {
+		// ipamd tags the ENIs it creates, and the primary ENI is in the same subnet as them
+		_, err = cache.ec2SVC.CreateTagsWithContext(ctx, cache.dryRunCreateTagsInput())
+		check("CreateTags", cache.primaryENI, err)
+	}
+	return errs
+}
+
+// EC2Permission is an EC2 API action that the configuration needs, and whether the node IAM role allows it
+type EC2Permission struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+	Status string `json:"status"`
+	// Message explains why the action is denied or could not be verified
+	Message string `json:"message,omitempty"`
+}
+
+// dryRunCreateNetworkInterfaceInput returns a DryRun request creating an ENI the way ipamd does, including the tags
+// that scoped-down IAM policies may require
+func (cache *EC2InstanceMetadataCache) dryRunCreateNetworkInterfaceInput(subnetID string, securityGroups []*string) *ec2.CreateNetworkInterfaceInput {
+	return &ec2.CreateNetworkInterfaceInput{
+		DryRun:   aws.Bool(true),
+		Groups:   securityGroups,
+		SubnetId: aws.String(subnetID),
+		TagSpecifications: []*ec2.TagSpecification{
+			{
+				ResourceType: aws.String(ec2.ResourceTypeNetworkInterface),
+				Tags:         convertTagsToSDKTags(cache.buildENITags()),
+			},
+		},
+	}
+}
+
+func (cache *EC2InstanceMetadataCache) dryRunCreateTagsInput() *ec2.CreateTagsInput {
+	return &ec2.CreateTagsInput{
+		DryRun:    aws.Bool(true),
+		Resources: []*string{aws.String(cache.primaryENI)},
+		Tags:      []*ec2.Tag{{Key: aws.String(ENINodeTagKey), Value: aws.String(cache.instanceID)}},
+	}
+}
+
+// CheckEC2Permissions returns the EC2 API actions that the configuration needs, and verifies with DryRun calls those
+// that can be checked without an ENI created by ipamd. An empty subnetID and securityGroups use the subnet and
+// security groups of the primary ENI.
+func (cache *EC2InstanceMetadataCache) CheckEC2Permissions(ctx context.Context, subnetID string, securityGroups []*string, enableENIProvisioning bool) []EC2Permission {
+	if subnetID == "" {
+		subnetID = cache.subnetID
+	}
+	if len(securityGroups) == 0 {
+		securityGroups = aws.StringSlice(cache.securityGroups.SortedList())
+	}
+
+	var permissions []EC2Permission
+	verify := func(action, reason string, dryRun func() error) {
+		permission := EC2Permission{Action: "ec2:" + action, Reason: reason}
+		err := dryRun()
+		aerr, ok := err.(awserr.Error)
+		switch {
+		case ok && aerr.Code() == dryRunSucceededCode:
+			permission.Status = PermissionAllowed
+		case ok && aerr.Code() == unauthorizedCode:
+			permission.Status = PermissionDenied
+			permission.Message = aerr.Message()
+		case err == nil:
+			// Only DryRun requests are sent, so a successful response means the request was not a DryRun
+			permission.Status = PermissionUnverified
+			permission.Message = "unexpected response to DryRun request"
+		default:
+			permission.Status = PermissionUnverified
+			permission.Message = err.Error()
+		}
+		permissions = append(permissions, permission)
+	}
+	unverified := func(action, reason string) {
+		permissions = append(permissions, EC2Permission{
+			Action:  "ec2:" + action,
+			Reason:  reason,
+			Status:  PermissionUnverified,
+			Message: "can only be checked against an ENI created by ipamd",
+		})
+	}
+
+	verify("DescribeInstances", "discover the instance", func() error {
+		_, err := cache.ec2SVC.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{
+			DryRun:      aws.Bool(true),
+			InstanceIds: []*string{aws.String(cache.instanceID)},
+		})
+		return err
+	})
+	verify("DescribeInstanceTypes", "look up ENI and IP limits", func() error {
+		_, err := cache.ec2SVC.DescribeInstanceTypesWithContext(ctx, &ec2.DescribeInstanceTypesInput{
+			DryRun:        aws.Bool(true),
+			InstanceTypes: []*string{aws.String(cache.instanceType)},
+		})
+		return err
+	})
+	verify("DescribeNetworkInterfaces", "discover attached and leaked ENIs", func() error {
+		_, err := cache.ec2SVC.DescribeNetworkInterfacesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{
+			DryRun:              aws.Bool(true),
+			NetworkInterfaceIds: []*string{aws.String(cache.primaryENI)},
+		})
+		return err
+	})
+	verify("CreateTags", "tag ENIs", func() error {
+		_, err := cache.ec2SVC.CreateTagsWithContext(ctx, cache.dryRunCreateTagsInput())
+		return err
+	})
+	if !enableENIProvisioning {
+		return permissions
+	}
+
+	if cache.useSubnetDiscovery {
+		verify("DescribeSubnets", "discover subnets for new ENIs", func() error {
+			_, err := cache.ec2SVC.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{
+				DryRun:    aws.Bool(true),
+				SubnetIds: []*string{aws.String(subnetID)},
+			})
+			return err
+		})
+	}
+	if cache.v4Enabled {
+		verify("CreateNetworkInterface", "create ENIs", func() error {
+			_, err := cache.ec2SVC.CreateNetworkInterfaceWithContext(ctx, cache.dryRunCreateNetworkInterfaceInput(subnetID, securityGroups))
+			return err
+		})
+		unverified("AttachNetworkInterface", "attach new ENIs")
+		unverified("DetachNetworkInterface", "detach unused ENIs")
+		unverified("DeleteNetworkInterface", "delete unused and leaked ENIs")
+		unverified("ModifyNetworkInterfaceAttribute", "set ENI termination and security groups")
+		unverified("AssignPrivateIpAddresses", "assign IPs or prefixes to ENIs")
+		unverified("UnassignPrivateIpAddresses", "release unused IPs or prefixes")
+	}
+	if cache.ipamPoolID != "" {
+		verify("GetIpamPoolAllocations", "find the IPAM pool allocations of the instance", func() error {
+			return cache.ec2SVC.GetIpamPoolAllocationsPagesWithContext(ctx, &ec2.GetIpamPoolAllocationsInput{
+				DryRun:     aws.Bool(true),
+				IpamPoolId: aws.String(cache.ipamPoolID),
+			}, func(*ec2.GetIpamPoolAllocationsOutput, bool) bool { return false })
+		})
+		verify("AllocateIpamPoolCidr", "allocate IPs or prefixes from the IPAM pool", func() error {
+			_, err := cache.ec2SVC.AllocateIpamPoolCidrWithContext(ctx, &ec2.AllocateIpamPoolCidrInput{
+				DryRun:        aws.Bool(true),
+				IpamPoolId:    aws.String(cache.ipamPoolID),
+				NetmaskLength: aws.Int64(secondaryIPv4MaskLength),
+			})
+			return err
+		})
+		permissions = append(permissions, EC2Permission{
+			Action:  "ec2:ReleaseIpamPoolAllocation",
+			Reason:  "release unused IPs or prefixes to the IPAM pool",
+			Status:  PermissionUnverified,
+			Message: "can only be checked against an allocation of the IPAM pool",
+		})
+	}
+	if cache.v6Enabled {
+		unverified("AssignIpv6Addresses", "assign IPv6 prefixes to ENIs")
+	}
+	return permissions
+}
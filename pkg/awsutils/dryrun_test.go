@@ -0,0 +1,100 @@
+package awsutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateEC2Config(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	dryRunOK := awserr.New(dryRunSucceededCode, "Request would have succeeded", nil)
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, subnetID: subnetID, primaryENI: primaryeniID, instanceID: instanceID}
+	cache.securityGroups.Set([]string{sg1})
+
+	// Everything is allowed
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any()).Return(&ec2.DescribeSubnetsOutput{}, nil)
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *ec2.CreateNetworkInterfaceInput, _ ...interface{}) (*ec2.CreateNetworkInterfaceOutput, error) {
+			assert.True(t, aws.BoolValue(input.DryRun))
+			assert.Equal(t, subnetID, aws.StringValue(input.SubnetId))
+			assert.Equal(t, []string{sg1}, aws.StringValueSlice(input.Groups))
+			return nil, dryRunOK
+		})
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	mockEC2.EXPECT().CreateTagsWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	assert.Empty(t, cache.ValidateEC2Config(context.Background(), "", nil, true))
+
+	// A missing subnet and permission are reported, throttling is not
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any()).Return(nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID 'subnet-custom' does not exist", nil))
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any()).Return(nil, awserr.New("InvalidSubnetID.NotFound", "The subnet ID 'subnet-custom' does not exist", nil))
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(nil, awserr.New("RequestLimitExceeded", "", nil))
+	mockEC2.EXPECT().CreateTagsWithContext(gomock.Any(), gomock.Any()).Return(nil, awserr.New(unauthorizedCode, "", nil))
+	errs := cache.ValidateEC2Config(context.Background(), "subnet-custom", aws.StringSlice([]string{"sg-custom"}), true)
+	assert.Len(t, errs, 3)
+	assert.Contains(t, errs[0].Error(), "InvalidSubnetID.NotFound")
+	assert.Contains(t, errs[2].Error(), "not allowed to call ec2:CreateTags")
+
+	// ENI provisioning checks are skipped when ENI provisioning is disabled
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any()).Return(&ec2.DescribeSubnetsOutput{}, nil)
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	assert.Empty(t, cache.ValidateEC2Config(context.Background(), "", nil, false))
+}
+
+func TestCheckEC2Permissions(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	dryRunOK := awserr.New(dryRunSucceededCode, "Request would have succeeded", nil)
+	denied := awserr.New(unauthorizedCode, "You are not authorized to perform this operation.", nil)
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, subnetID: subnetID, primaryENI: primaryeniID, instanceID: instanceID, v4Enabled: true}
+	cache.securityGroups.Set([]string{sg1})
+
+	mockEC2.EXPECT().DescribeInstancesWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	mockEC2.EXPECT().DescribeInstanceTypesWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(nil, awserr.New("RequestLimitExceeded", "", nil))
+	mockEC2.EXPECT().CreateTagsWithContext(gomock.Any(), gomock.Any()).Return(nil, denied)
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *ec2.CreateNetworkInterfaceInput, _ ...interface{}) (*ec2.CreateNetworkInterfaceOutput, error) {
+			assert.True(t, aws.BoolValue(input.DryRun))
+			assert.Equal(t, subnetID, aws.StringValue(input.SubnetId))
+			assert.Equal(t, []string{sg1}, aws.StringValueSlice(input.Groups))
+			return nil, dryRunOK
+		})
+
+	statuses := map[string]string{}
+	for _, permission := range cache.CheckEC2Permissions(context.Background(), "", nil, true) {
+		statuses[permission.Action] = permission.Status
+	}
+	assert.Equal(t, map[string]string{
+		"ec2:DescribeInstances":               PermissionAllowed,
+		"ec2:DescribeInstanceTypes":           PermissionAllowed,
+		"ec2:DescribeNetworkInterfaces":       PermissionUnverified,
+		"ec2:CreateTags":                      PermissionDenied,
+		"ec2:CreateNetworkInterface":          PermissionAllowed,
+		"ec2:AttachNetworkInterface":          PermissionUnverified,
+		"ec2:DetachNetworkInterface":          PermissionUnverified,
+		"ec2:DeleteNetworkInterface":          PermissionUnverified,
+		"ec2:ModifyNetworkInterfaceAttribute": PermissionUnverified,
+		"ec2:AssignPrivateIpAddresses":        PermissionUnverified,
+		"ec2:UnassignPrivateIpAddresses":      PermissionUnverified,
+	}, statuses)
+
+	// Only the read and tagging permissions are needed when ENI provisioning is disabled
+	mockEC2.EXPECT().DescribeInstancesWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	mockEC2.EXPECT().DescribeInstanceTypesWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	mockEC2.EXPECT().CreateTagsWithContext(gomock.Any(), gomock.Any()).Return(nil, dryRunOK)
+	permissions := cache.CheckEC2Permissions(context.Background(), "", nil, false)
+	assert.Len(t, permissions, 4)
+	for _, permission := range permissions {
+		assert.Equal(t, PermissionAllowed, permission.Status)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/corehandlers"
+	"github.com/aws/aws-sdk-go/aws/request"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// Results of an EC2 API call in the call duration metric
+const (
+	ec2CallSuccess   = "success"
+	ec2CallThrottled = "throttled"
+	ec2CallError     = "error"
+)
+
+// instrumentEC2Calls adds the handlers that export the duration of the EC2 calls and how many are in flight. The calls
+// waiting out a retry backoff are counted apart, they pile up when EC2 throttles the node.
+func instrumentEC2Calls(handlers *request.Handlers) {
+	// The first attempt validates the request, then Complete runs once whatever the outcome
+	handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: "amazon-vpc-cni-k8s/ec2-call-start",
+		Fn: func(r *request.Request) {
+			prometheusmetrics.Ec2APIInflightCalls.WithLabelValues(r.Operation.Name).Inc()
+		},
+	})
+	handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: "amazon-vpc-cni-k8s/ec2-call-end",
+		Fn: func(r *request.Request) {
+			// A request that failed before its first attempt was never counted in flight
+			if r.AttemptTime.IsZero() {
+				return
+			}
+			prometheusmetrics.Ec2APIInflightCalls.WithLabelValues(r.Operation.Name).Dec()
+			prometheusmetrics.Ec2APICallDuration.WithLabelValues(r.Operation.Name, ec2CallResult(r.Error)).
+				Observe(time.Since(r.Time).Seconds())
+		},
+	})
+
+	// The SDK sleeps through the backoff in its after retry handler
+	backoff := corehandlers.AfterRetryHandler
+	swapped := handlers.AfterRetry.Swap(backoff.Name, request.NamedHandler{
+		Name: backoff.Name,
+		Fn: func(r *request.Request) {
+			calls := prometheusmetrics.Ec2APIRetryBackoffCalls.WithLabelValues(r.Operation.Name)
+			calls.Inc()
+			defer calls.Dec()
+			backoff.Fn(r)
+		},
+	})
+	if !swapped {
+		log.Warnf("Not counting the EC2 calls waiting for a retry, no %s handler", backoff.Name)
+	}
+}
+
+func ec2CallResult(err error) string {
+	switch {
+	case err == nil:
+		return ec2CallSuccess
+	case request.IsErrorThrottle(err):
+		return ec2CallThrottled
+	default:
+		return ec2CallError
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/corehandlers"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+func TestInstrumentEC2Calls(t *testing.T) {
+	var handlers request.Handlers
+	handlers.AfterRetry.PushBackNamed(corehandlers.AfterRetryHandler)
+	instrumentEC2Calls(&handlers)
+
+	retryer := client.DefaultRetryer{NumMaxRetries: 1, MinThrottleDelay: 200 * time.Millisecond, MaxThrottleDelay: 200 * time.Millisecond}
+	send := func(api string, errs ...error) error {
+		r := request.New(aws.Config{}, metadata.ClientInfo{}, handlers, retryer, &request.Operation{Name: api}, nil, nil)
+		r.Handlers.Send.PushBack(func(r *request.Request) {
+			assert.Equal(t, 1.0, testutil.ToFloat64(prometheusmetrics.Ec2APIInflightCalls.WithLabelValues(api)))
+			r.HTTPResponse = &http.Response{StatusCode: http.StatusOK, Header: http.Header{}}
+			if attempt := r.RetryCount; attempt < len(errs) {
+				r.Error = errs[attempt]
+			}
+		})
+		return r.Send()
+	}
+
+	calls := func(api, result string) uint64 {
+		var m dto.Metric
+		assert.NoError(t, prometheusmetrics.Ec2APICallDuration.WithLabelValues(api, result).(prometheus.Histogram).Write(&m))
+		return m.GetHistogram().GetSampleCount()
+	}
+
+	assert.NoError(t, send("DescribeSubnets"))
+	assert.Equal(t, 0.0, testutil.ToFloat64(prometheusmetrics.Ec2APIInflightCalls.WithLabelValues("DescribeSubnets")))
+	assert.Equal(t, uint64(1), calls("DescribeSubnets", ec2CallSuccess))
+
+	// A throttled call waits out the backoff before it is retried, and fails when it is throttled again
+	throttled := awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)
+	done := make(chan error)
+	go func() { done <- send("AssignPrivateIpAddresses", throttled, throttled) }()
+	assert.Eventually(t, func() bool {
+		return testutil.ToFloat64(prometheusmetrics.Ec2APIRetryBackoffCalls.WithLabelValues("AssignPrivateIpAddresses")) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Error(t, <-done)
+	assert.Equal(t, 0.0, testutil.ToFloat64(prometheusmetrics.Ec2APIRetryBackoffCalls.WithLabelValues("AssignPrivateIpAddresses")))
+	assert.Equal(t, 0.0, testutil.ToFloat64(prometheusmetrics.Ec2APIInflightCalls.WithLabelValues("AssignPrivateIpAddresses")))
+	assert.Equal(t, uint64(1), calls("AssignPrivateIpAddresses", ec2CallThrottled))
+
+	assert.Equal(t, ec2CallError, ec2CallResult(awserr.New("InvalidSubnetID.NotFound", "", nil)))
+}
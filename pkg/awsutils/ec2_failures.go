@@ -0,0 +1,71 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"strings"
+	"time"
+)
+
+// maxEC2Failures is how many failed EC2 mutations are kept for introspection
+const maxEC2Failures = 50
+
+// EC2Failure is a failed EC2 call that changes resources, with the ID of the request to give to AWS support
+type EC2Failure struct {
+	Time      time.Time `json:"time"`
+	API       string    `json:"api"`
+	Class     string    `json:"class"`
+	Code      string    `json:"code"`
+	Message   string    `json:"message"`
+	RequestID string    `json:"requestId,omitempty"`
+}
+
+// isEC2Mutation returns whether the EC2 operation changes resources, rather than only reading them
+func isEC2Mutation(api string) bool {
+	return !strings.HasPrefix(api, "Describe") && !strings.HasPrefix(api, "Get")
+}
+
+// ec2CallError classifies the error of an EC2 call, and keeps the failed mutations with their request ID
+func (cache *EC2InstanceMetadataCache) ec2CallError(api string, err error) error {
+	err = newEC2Error(api, err)
+	ec2Err, ok := err.(*EC2Error)
+	if !ok || !isEC2Mutation(api) {
+		return err
+	}
+	log.Warnf("EC2 %s failed with %s, request ID %q: %s", api, ec2Err.Code(), ec2Err.RequestID, ec2Err.Message())
+
+	cache.ec2FailuresLock.Lock()
+	defer cache.ec2FailuresLock.Unlock()
+	if len(cache.ec2Failures) == maxEC2Failures {
+		cache.ec2Failures = cache.ec2Failures[1:]
+	}
+	cache.ec2Failures = append(cache.ec2Failures, EC2Failure{
+		Time:      time.Now(),
+		API:       api,
+		Class:     ErrorClass(ec2Err),
+		Code:      ec2Err.Code(),
+		Message:   ec2Err.Message(),
+		RequestID: ec2Err.RequestID,
+	})
+	return err
+}
+
+// GetEC2Failures returns the most recent failed EC2 mutations, oldest first
+func (cache *EC2InstanceMetadataCache) GetEC2Failures() []EC2Failure {
+	cache.ec2FailuresLock.Lock()
+	defer cache.ec2FailuresLock.Unlock()
+	failures := make([]EC2Failure, len(cache.ec2Failures))
+	copy(failures, cache.ec2Failures)
+	return failures
+}
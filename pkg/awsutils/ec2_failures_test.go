@@ -0,0 +1,69 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEC2FailuresRecordMutations(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, instanceType: "c5n.18xlarge"}
+	limitErr := awserr.NewRequestFailure(awserr.New("PrivateIpAddressLimitExceeded", "Number of private addresses will exceed limit.", nil),
+		http.StatusBadRequest, "6a2c1e4f-3b8d-4d2e-9f2a-0c1d2e3f4a5b")
+	mockEC2.EXPECT().AssignPrivateIpAddressesWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil, limitErr)
+	_, err := cache.AllocIPAddresses(eniID, 5)
+	assert.ErrorIs(t, err, ErrIPLimitExceeded)
+	assert.Contains(t, err.Error(), "6a2c1e4f-3b8d-4d2e-9f2a-0c1d2e3f4a5b")
+	assert.Equal(t, "6a2c1e4f-3b8d-4d2e-9f2a-0c1d2e3f4a5b", EC2RequestID(err))
+
+	// Failed reads are not recorded
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(nil,
+		awserr.NewRequestFailure(awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil), http.StatusServiceUnavailable, "b1c2"))
+	_, err = cache.GetIPv4sFromEC2(eniID)
+	assert.Equal(t, "b1c2", EC2RequestID(err))
+
+	failures := cache.GetEC2Failures()
+	if assert.Len(t, failures, 1) {
+		assert.Equal(t, "AssignPrivateIpAddresses", failures[0].API)
+		assert.Equal(t, "ip_limit_exceeded", failures[0].Class)
+		assert.Equal(t, "PrivateIpAddressLimitExceeded", failures[0].Code)
+		assert.Equal(t, "Number of private addresses will exceed limit.", failures[0].Message)
+		assert.Equal(t, "6a2c1e4f-3b8d-4d2e-9f2a-0c1d2e3f4a5b", failures[0].RequestID)
+	}
+}
+
+func TestEC2FailuresKeepMostRecent(t *testing.T) {
+	cache := &EC2InstanceMetadataCache{}
+	for i := 0; i < maxEC2Failures+5; i++ {
+		reqErr := awserr.NewRequestFailure(awserr.New("InvalidParameterValue", "", nil), http.StatusBadRequest, fmt.Sprintf("req-%d", i))
+		assert.Error(t, cache.ec2CallError("CreateTags", reqErr))
+	}
+	failures := cache.GetEC2Failures()
+	assert.Len(t, failures, maxEC2Failures)
+	assert.Equal(t, "req-5", failures[0].RequestID)
+	assert.Equal(t, fmt.Sprintf("req-%d", maxEC2Failures+4), failures[maxEC2Failures-1].RequestID)
+
+	// Errors that are not from EC2 are not recorded
+	assert.Error(t, cache.ec2CallError("CreateTags", fmt.Errorf("failed to sign the request")))
+	assert.Len(t, cache.GetEC2Failures(), maxEC2Failures)
+}
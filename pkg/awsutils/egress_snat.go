@@ -0,0 +1,151 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// SetupEgressSNATIP returns the private IPv4 address of the primary ENI that the IPv4 egress of the pods of an IPv6
+// cluster is translated to, instead of the primary IP of the node. The first secondary IPv4 address of the primary
+// ENI is used, and one is assigned when there is none. ipamd does not manage the IPv4 addresses of the ENIs in IPv6
+// mode, so the address stays the same across restarts.
+//
+// With Elastic IP allocation IDs, the address is the one an Elastic IP of the list is associated with, so that the
+// egress leaves the VPC with that Elastic IP. When none is associated with the primary ENI yet, the first Elastic IP
+// of the list that is not associated elsewhere is associated with the secondary IPv4 address.
+func (cache *EC2InstanceMetadataCache) SetupEgressSNATIP(ctx context.Context, eipAllocationIDs []string) (string, error) {
+	var addresses []*ec2.Address
+	if len(eipAllocationIDs) > 0 {
+		var err error
+		addresses, err = cache.describeAddresses(ctx, eipAllocationIDs)
+		if err != nil {
+			return "", err
+		}
+		for _, address := range addresses {
+			if aws.StringValue(address.NetworkInterfaceId) == cache.primaryENI {
+				log.Infof("Elastic IP %s is associated with %s on the primary ENI %s", aws.StringValue(address.PublicIp),
+					aws.StringValue(address.PrivateIpAddress), cache.primaryENI)
+				return aws.StringValue(address.PrivateIpAddress), nil
+			}
+		}
+	}
+
+	privateIP, err := cache.egressSecondaryIPv4(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(eipAllocationIDs) == 0 {
+		return privateIP, nil
+	}
+
+	for _, address := range addresses {
+		if aws.StringValue(address.AssociationId) != "" {
+			continue
+		}
+		err = cache.associateAddress(ctx, aws.StringValue(address.AllocationId), privateIP)
+		if err == nil {
+			log.Infof("Associated Elastic IP %s with %s on the primary ENI %s", aws.StringValue(address.PublicIp),
+				privateIP, cache.primaryENI)
+			return privateIP, nil
+		}
+		// Another node may have claimed the Elastic IP since it was described
+		log.Warnf("Failed to associate Elastic IP %s with %s: %v", aws.StringValue(address.PublicIp), privateIP, err)
+	}
+	return "", errors.Errorf("none of the Elastic IPs %v can be associated with %s on the primary ENI %s",
+		eipAllocationIDs, privateIP, cache.primaryENI)
+}
+
+// egressSecondaryIPv4 returns the first secondary IPv4 address of the primary ENI, and assigns one if there is none
+func (cache *EC2InstanceMetadataCache) egressSecondaryIPv4(ctx context.Context) (string, error) {
+	addrs, err := cache.GetIPv4sFromEC2(cache.primaryENI)
+	if err != nil {
+		return "", err
+	}
+	for _, addr := range addrs {
+		if !aws.BoolValue(addr.Primary) {
+			return aws.StringValue(addr.PrivateIpAddress), nil
+		}
+	}
+
+	// AllocIPAddresses assigns prefixes in prefix delegation mode, a single address is needed here
+	start := time.Now()
+	output, err := cache.ec2SVC.AssignPrivateIpAddressesWithContext(ctx, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId:             aws.String(cache.primaryENI),
+		SecondaryPrivateIpAddressCount: aws.Int64(1),
+	})
+	err = cache.ec2CallError("AssignPrivateIpAddresses", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("AssignPrivateIpAddresses").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("AssignPrivateIpAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:AssignPrivateIpAddresses")
+		awsAPIErrInc("AssignPrivateIpAddresses", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("AssignPrivateIpAddresses").Inc()
+		return "", errors.Wrapf(err, "failed to assign an egress IPv4 address to the primary ENI %s", cache.primaryENI)
+	}
+	if len(output.AssignedPrivateIpAddresses) == 0 {
+		return "", errors.Errorf("no IPv4 address assigned to the primary ENI %s", cache.primaryENI)
+	}
+	privateIP := aws.StringValue(output.AssignedPrivateIpAddresses[0].PrivateIpAddress)
+	log.Infof("Assigned egress IPv4 address %s to the primary ENI %s", privateIP, cache.primaryENI)
+	return privateIP, nil
+}
+
+// describeAddresses returns the Elastic IPs with the allocation IDs
+func (cache *EC2InstanceMetadataCache) describeAddresses(ctx context.Context, allocationIDs []string) ([]*ec2.Address, error) {
+	start := time.Now()
+	result, err := cache.ec2SVC.DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{
+		AllocationIds: aws.StringSlice(allocationIDs),
+	})
+	err = cache.ec2CallError("DescribeAddresses", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeAddresses").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeAddresses")
+		awsAPIErrInc("DescribeAddresses", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("DescribeAddresses").Inc()
+		return nil, errors.Wrapf(err, "failed to describe Elastic IPs %v", allocationIDs)
+	}
+	return result.Addresses, nil
+}
+
+// associateAddress associates the Elastic IP with the private IP of the primary ENI. The Elastic IP is not taken
+// away from where it is associated already.
+func (cache *EC2InstanceMetadataCache) associateAddress(ctx context.Context, allocationID, privateIP string) error {
+	start := time.Now()
+	_, err := cache.ec2SVC.AssociateAddressWithContext(ctx, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String(allocationID),
+		AllowReassociation: aws.Bool(false),
+		NetworkInterfaceId: aws.String(cache.primaryENI),
+		PrivateIpAddress:   aws.String(privateIP),
+	})
+	err = cache.ec2CallError("AssociateAddress", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("AssociateAddress").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("AssociateAddress", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:AssociateAddress")
+		awsAPIErrInc("AssociateAddress", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("AssociateAddress").Inc()
+		return errors.Wrapf(err, "failed to associate Elastic IP %s", allocationID)
+	}
+	return nil
+}
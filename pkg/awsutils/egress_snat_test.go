@@ -0,0 +1,113 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func primaryENIIPv4s(secondaryIPs ...string) *ec2.DescribeNetworkInterfacesOutput {
+	addrs := []*ec2.NetworkInterfacePrivateIpAddress{{PrivateIpAddress: aws.String("10.0.0.10"), Primary: aws.Bool(true)}}
+	for _, ip := range secondaryIPs {
+		addrs = append(addrs, &ec2.NetworkInterfacePrivateIpAddress{PrivateIpAddress: aws.String(ip), Primary: aws.Bool(false)})
+	}
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []*ec2.NetworkInterface{{PrivateIpAddresses: addrs}}}
+}
+
+func TestSetupEgressSNATIP(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, primaryENI: eniID}
+
+	// An existing secondary IP is reused
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(primaryENIIPv4s("10.0.0.20", "10.0.0.21"), nil)
+	ip, err := cache.SetupEgressSNATIP(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.20", ip)
+
+	// A single secondary IP is assigned otherwise, even in prefix delegation mode
+	cache.enablePrefixDelegation = true
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(primaryENIIPv4s(), nil)
+	mockEC2.EXPECT().AssignPrivateIpAddressesWithContext(ctx, &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId:             aws.String(eniID),
+		SecondaryPrivateIpAddressCount: aws.Int64(1),
+	}).Return(&ec2.AssignPrivateIpAddressesOutput{
+		AssignedPrivateIpAddresses: []*ec2.AssignedPrivateIpAddress{{PrivateIpAddress: aws.String("10.0.0.30")}},
+	}, nil)
+	ip, err = cache.SetupEgressSNATIP(ctx, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.30", ip)
+
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(primaryENIIPv4s(), nil)
+	mockEC2.EXPECT().AssignPrivateIpAddressesWithContext(ctx, gomock.Any()).Return(nil, errors.New("PrivateIpAddressLimitExceeded"))
+	_, err = cache.SetupEgressSNATIP(ctx, nil)
+	assert.Error(t, err)
+}
+
+func TestSetupEgressSNATIPWithEIP(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, primaryENI: eniID}
+	allocationIDs := []string{"eipalloc-1", "eipalloc-2", "eipalloc-3"}
+
+	// An Elastic IP already associated with the primary ENI is kept, along with its private IP
+	mockEC2.EXPECT().DescribeAddressesWithContext(ctx, &ec2.DescribeAddressesInput{AllocationIds: aws.StringSlice(allocationIDs)}).
+		Return(&ec2.DescribeAddressesOutput{Addresses: []*ec2.Address{
+			{AllocationId: aws.String("eipalloc-1"), AssociationId: aws.String("eipassoc-1"), NetworkInterfaceId: aws.String("eni-other"), PrivateIpAddress: aws.String("10.0.1.5")},
+			{AllocationId: aws.String("eipalloc-2"), AssociationId: aws.String("eipassoc-2"), NetworkInterfaceId: aws.String(eniID), PrivateIpAddress: aws.String("10.0.0.25")},
+		}}, nil)
+	ip, err := cache.SetupEgressSNATIP(ctx, allocationIDs)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.25", ip)
+
+	// Otherwise the free Elastic IPs are tried in turn, without taking them from other nodes
+	mockEC2.EXPECT().DescribeAddressesWithContext(ctx, gomock.Any()).Return(&ec2.DescribeAddressesOutput{Addresses: []*ec2.Address{
+		{AllocationId: aws.String("eipalloc-1"), AssociationId: aws.String("eipassoc-1"), NetworkInterfaceId: aws.String("eni-other"), PrivateIpAddress: aws.String("10.0.1.5")},
+		{AllocationId: aws.String("eipalloc-2")},
+		{AllocationId: aws.String("eipalloc-3")},
+	}}, nil)
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(primaryENIIPv4s("10.0.0.20"), nil)
+	mockEC2.EXPECT().AssociateAddressWithContext(ctx, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String("eipalloc-2"),
+		AllowReassociation: aws.Bool(false),
+		NetworkInterfaceId: aws.String(eniID),
+		PrivateIpAddress:   aws.String("10.0.0.20"),
+	}).Return(nil, errors.New("Resource.AlreadyAssociated"))
+	mockEC2.EXPECT().AssociateAddressWithContext(ctx, &ec2.AssociateAddressInput{
+		AllocationId:       aws.String("eipalloc-3"),
+		AllowReassociation: aws.Bool(false),
+		NetworkInterfaceId: aws.String(eniID),
+		PrivateIpAddress:   aws.String("10.0.0.20"),
+	}).Return(&ec2.AssociateAddressOutput{}, nil)
+	ip, err = cache.SetupEgressSNATIP(ctx, allocationIDs)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.20", ip)
+
+	// Running out of Elastic IPs is an error
+	mockEC2.EXPECT().DescribeAddressesWithContext(ctx, gomock.Any()).Return(&ec2.DescribeAddressesOutput{Addresses: []*ec2.Address{
+		{AllocationId: aws.String("eipalloc-1"), AssociationId: aws.String("eipassoc-1"), NetworkInterfaceId: aws.String("eni-other"), PrivateIpAddress: aws.String("10.0.1.5")},
+	}}, nil)
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any()).Return(primaryENIIPv4s("10.0.0.20"), nil)
+	_, err = cache.SetupEgressSNATIP(ctx, allocationIDs)
+	assert.Error(t, err)
+}
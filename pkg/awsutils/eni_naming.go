@@ -0,0 +1,112 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"os"
+	"strings"
+	"text/template"
+)
+
+const (
+	// eniDescriptionTemplateEnvVar is the Go template of the description of the ENIs ipamd creates, after the
+	// aws-K8S- prefix that the leaked ENI cleanup relies on
+	eniDescriptionTemplateEnvVar = "ENI_DESCRIPTION_TEMPLATE"
+	// eniNameTagTemplateEnvVar is the Go template of the Name tag of the ENIs ipamd creates, which have none by default
+	eniNameTagTemplateEnvVar = "ENI_NAME_TAG_TEMPLATE"
+
+	// eniPurposeSecondary is the purpose of the ENIs ipamd creates for the IPs of the pods. The trunk and branch ENIs
+	// are created by the VPC resource controller.
+	eniPurposeSecondary = "secondary"
+
+	nameTagKey = "Name"
+	// EC2 limits the length of the descriptions and of the tag values
+	maxENIDescriptionLength = 255
+	maxTagValueLength       = 256
+)
+
+// ENINamingData are the fields of the ENI description and Name tag templates
+type ENINamingData struct {
+	ClusterName string
+	NodeName    string
+	InstanceID  string
+	Purpose     string
+}
+
+// loadENITemplate loads an ENI template from environment variables, nil when it is not set or invalid
+func loadENITemplate(envVar string) *template.Template {
+	text := os.Getenv(envVar)
+	if text == "" {
+		return nil
+	}
+	tmpl, err := template.New(envVar).Option("missingkey=error").Parse(text)
+	if err == nil {
+		// Unknown fields only fail when the template is executed
+		err = tmpl.Execute(&strings.Builder{}, ENINamingData{})
+	}
+	if err != nil {
+		log.Warnf("Ignoring invalid %s %q: %v", envVar, text, err)
+		return nil
+	}
+	return tmpl
+}
+
+// renderENITemplate executes an ENI template, truncated to maxLength
+func renderENITemplate(tmpl *template.Template, data ENINamingData, maxLength int) (string, error) {
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+	value := out.String()
+	if len(value) > maxLength {
+		value = value[:maxLength]
+	}
+	return value, nil
+}
+
+// eniNamingData returns the fields of the templates for an ENI created for the purpose
+func (cache *EC2InstanceMetadataCache) eniNamingData(purpose string) ENINamingData {
+	return ENINamingData{
+		ClusterName: cache.clusterName,
+		NodeName:    cache.nodeName,
+		InstanceID:  cache.instanceID,
+		Purpose:     purpose,
+	}
+}
+
+// eniDescription returns the description of a new ENI, which always starts with ENIDescriptionPrefix
+func (cache *EC2InstanceMetadataCache) eniDescription(purpose string) string {
+	if cache.eniDescriptionTemplate != nil {
+		description, err := renderENITemplate(cache.eniDescriptionTemplate, cache.eniNamingData(purpose),
+			maxENIDescriptionLength-len(ENIDescriptionPrefix))
+		if err == nil {
+			return ENIDescriptionPrefix + description
+		}
+		log.Warnf("Failed to render %s, using the default description: %v", eniDescriptionTemplateEnvVar, err)
+	}
+	return ENIDescriptionPrefix + cache.instanceID
+}
+
+// eniNameTag returns the Name tag of a new ENI, empty when it has none
+func (cache *EC2InstanceMetadataCache) eniNameTag(purpose string) string {
+	if cache.eniNameTagTemplate == nil {
+		return ""
+	}
+	name, err := renderENITemplate(cache.eniNameTagTemplate, cache.eniNamingData(purpose), maxTagValueLength)
+	if err != nil {
+		log.Warnf("Failed to render %s, the ENI has no Name tag: %v", eniNameTagTemplateEnvVar, err)
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,92 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadENITemplate(t *testing.T) {
+	assert.Nil(t, loadENITemplate(eniNameTagTemplateEnvVar))
+
+	t.Setenv(eniNameTagTemplateEnvVar, "{{.ClusterName}}-{{.NodeName}}-{{.Purpose}}")
+	assert.NotNil(t, loadENITemplate(eniNameTagTemplateEnvVar))
+
+	// Syntax errors and unknown fields are ignored
+	t.Setenv(eniNameTagTemplateEnvVar, "{{.ClusterName")
+	assert.Nil(t, loadENITemplate(eniNameTagTemplateEnvVar))
+	t.Setenv(eniNameTagTemplateEnvVar, "{{.Namespace}}")
+	assert.Nil(t, loadENITemplate(eniNameTagTemplateEnvVar))
+}
+
+func TestENINaming(t *testing.T) {
+	cache := &EC2InstanceMetadataCache{instanceID: instanceID, clusterName: "prod", nodeName: "ip-10-0-0-1.ec2.internal"}
+	assert.Equal(t, ENIDescriptionPrefix+instanceID, cache.eniDescription(eniPurposeSecondary))
+	assert.Equal(t, "", cache.eniNameTag(eniPurposeSecondary))
+
+	t.Setenv(eniDescriptionTemplateEnvVar, "{{.ClusterName}}/{{.Purpose}}/{{.InstanceID}}")
+	t.Setenv(eniNameTagTemplateEnvVar, "{{.ClusterName}}-{{.NodeName}}-{{.Purpose}}")
+	cache.eniDescriptionTemplate = loadENITemplate(eniDescriptionTemplateEnvVar)
+	cache.eniNameTagTemplate = loadENITemplate(eniNameTagTemplateEnvVar)
+	// The description keeps the prefix of the ENIs the leaked ENI cleanup deletes
+	assert.Equal(t, ENIDescriptionPrefix+"prod/secondary/"+instanceID, cache.eniDescription(eniPurposeSecondary))
+	assert.Equal(t, "prod-ip-10-0-0-1.ec2.internal-secondary", cache.eniNameTag(eniPurposeSecondary))
+
+	cache.clusterName = strings.Repeat("c", 300)
+	assert.Len(t, cache.eniDescription(eniPurposeSecondary), maxENIDescriptionLength)
+	assert.Len(t, cache.eniNameTag(eniPurposeSecondary), maxTagValueLength)
+}
+
+func TestCreateENINaming(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	t.Setenv(eniDescriptionTemplateEnvVar, "{{.ClusterName}}-{{.InstanceID}}")
+	t.Setenv(eniNameTagTemplateEnvVar, "{{.ClusterName}}-{{.NodeName}}-{{.Purpose}}")
+	cache := &EC2InstanceMetadataCache{
+		ec2SVC:                 mockEC2,
+		imds:                   TypedIMDS{testMetadata(nil)},
+		instanceID:             instanceID,
+		instanceType:           "c5n.18xlarge",
+		subnetID:               subnetID,
+		primaryENImac:          primaryMAC,
+		clusterName:            "prod",
+		nodeName:               "node-1",
+		eniDescriptionTemplate: loadENITemplate(eniDescriptionTemplateEnvVar),
+		eniNameTagTemplate:     loadENITemplate(eniNameTagTemplateEnvVar),
+	}
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *ec2.CreateNetworkInterfaceInput, _ ...request.Option) (*ec2.CreateNetworkInterfaceOutput, error) {
+			assert.Equal(t, ENIDescriptionPrefix+"prod-"+instanceID, aws.StringValue(input.Description))
+			tags := map[string]string{}
+			for _, tag := range input.TagSpecifications[0].Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			assert.Equal(t, "prod-node-1-secondary", tags[nameTagKey])
+			assert.Equal(t, instanceID, tags[ENINodeTagKey])
+			return &ec2.CreateNetworkInterfaceOutput{NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String(eniID)}}, nil
+		})
+
+	id, err := cache.createENI(false, nil, "", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, eniID, id)
+}
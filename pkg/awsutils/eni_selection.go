@@ -0,0 +1,58 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	// excludedENIsEnvVar lists the ENIs, by ID or MAC address, that ipamd never manages nor cleans up, whatever their tags
+	excludedENIsEnvVar = "EXCLUDED_ENIS"
+	// includedENIsEnvVar lists the ENIs, by ID or MAC address, that ipamd manages whatever their tags
+	includedENIsEnvVar = "INCLUDED_ENIS"
+)
+
+// interfaceSet is a set of ENIs identified by their ID or MAC address
+type interfaceSet map[string]bool
+
+// loadInterfaceSet loads a comma-separated list of ENI IDs and MAC addresses from environment variables
+func loadInterfaceSet(envVar string) interfaceSet {
+	set := interfaceSet{}
+	for _, id := range strings.Split(os.Getenv(envVar), ",") {
+		if id = strings.ToLower(strings.TrimSpace(id)); id != "" {
+			set[id] = true
+		}
+	}
+	if len(set) > 0 {
+		log.Infof("%s selects the ENIs %v", envVar, set.sortedList())
+	}
+	return set
+}
+
+// has returns whether the set contains the ENI by ID or MAC address
+func (s interfaceSet) has(eniID, mac string) bool {
+	return (eniID != "" && s[strings.ToLower(eniID)]) || (mac != "" && s[strings.ToLower(mac)])
+}
+
+func (s interfaceSet) sortedList() []string {
+	ids := make([]string, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
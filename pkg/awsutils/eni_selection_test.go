@@ -0,0 +1,81 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadInterfaceSet(t *testing.T) {
+	assert.Empty(t, loadInterfaceSet(excludedENIsEnvVar))
+
+	t.Setenv(excludedENIsEnvVar, "eni-storage, 12:EF:2A:98:E5:5B,")
+	set := loadInterfaceSet(excludedENIsEnvVar)
+	assert.Equal(t, []string{"12:ef:2a:98:e5:5b", "eni-storage"}, set.sortedList())
+	assert.True(t, set.has("eni-storage", ""))
+	assert.True(t, set.has("eni-other", eni2MAC))
+	assert.False(t, set.has(primaryeniID, primaryMAC))
+	assert.False(t, set.has("", ""))
+}
+
+func TestDescribeAllENIsSelection(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	mockEC2.EXPECT().DescribeNetworkInterfacesWithContext(gomock.Any(), gomock.Any(), gomock.Any()).Return(
+		&ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: []*ec2.NetworkInterface{{
+			NetworkInterfaceId: aws.String(primaryeniID),
+			MacAddress:         aws.String(primaryMAC),
+		}}}, nil).Times(2)
+
+	cache := &EC2InstanceMetadataCache{imds: TypedIMDS{testMetadata(nil)}, ec2SVC: mockEC2,
+		excludedENIs: interfaceSet{primaryMAC: true}}
+	result, err := cache.DescribeAllENIs()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{primaryeniID: true}, result.ExcludedENIs)
+	assert.Empty(t, result.IncludedENIs)
+
+	cache.excludedENIs, cache.includedENIs = nil, interfaceSet{primaryeniID: true}
+	result, err = cache.DescribeAllENIs()
+	require.NoError(t, err)
+	assert.Empty(t, result.ExcludedENIs)
+	assert.Equal(t, map[string]bool{primaryeniID: true}, result.IncludedENIs)
+}
+
+func TestCleanUpLeakedENIsExcluded(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	interfaces := []*ec2.NetworkInterface{{
+		NetworkInterfaceId: aws.String(eni2ID),
+		MacAddress:         aws.String(eni2MAC),
+		Description:        aws.String(ENIDescriptionPrefix + "test"),
+		TagSet: []*ec2.Tag{
+			{Key: aws.String(ENINodeTagKey), Value: aws.String(instanceID)},
+			{Key: aws.String(eniCreatedAtTagKey), Value: aws.String(time.Now().Add(-time.Hour).Format(time.RFC3339))},
+		},
+	}}
+	setupDescribeNetworkInterfacesPagesWithContextMock(t, mockEC2, interfaces, nil, 1)
+
+	// The excluded ENI is neither retagged nor deleted
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, excludedENIs: interfaceSet{eni2ID: true}}
+	cache.cleanUpLeakedENIsInternal(time.Millisecond)
+}
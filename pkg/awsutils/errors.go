@@ -0,0 +1,180 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/pkg/errors"
+)
+
+// errorClass is the class of the errors of EC2, whether retrying them can help
+type errorClass struct {
+	name      string
+	message   string
+	retryable bool
+}
+
+func (c *errorClass) Error() string {
+	return c.message
+}
+
+// The classes of the EC2 errors returned by awsutils, that they match with errors.Is
+var (
+	// ErrThrottled is the class of the requests EC2 throttled, even after the retries of the SDK
+	ErrThrottled = &errorClass{name: "throttled", message: "EC2 request throttled", retryable: true}
+	// ErrTransient is the class of the requests that failed on the side of EC2 or on the way to it
+	ErrTransient = &errorClass{name: "transient", message: "EC2 request failed transiently", retryable: true}
+	// ErrUnauthorized is the class of the requests that the IAM role of the node is not allowed to make
+	ErrUnauthorized = &errorClass{name: "unauthorized", message: "EC2 request not authorized"}
+	// ErrNotFound is the class of the requests on an ENI, address or allocation that does not exist
+	ErrNotFound = &errorClass{name: "not_found", message: "EC2 resource not found"}
+	// ErrInsufficientSubnetIPs is the class of the requests for IPs or prefixes that the subnet does not have
+	ErrInsufficientSubnetIPs = &errorClass{name: "insufficient_subnet_ips", message: "not enough free IPs or prefixes in the subnet"}
+	// ErrIPLimitExceeded is the class of the requests for more IPs or prefixes than the ENI can hold
+	ErrIPLimitExceeded = &errorClass{name: "ip_limit_exceeded", message: "IP address limit of the ENI exceeded"}
+	// ErrENILimitExceeded is the class of the requests attaching more ENIs than the instance can hold
+	ErrENILimitExceeded = &errorClass{name: "eni_limit_exceeded", message: "ENI limit of the instance exceeded"}
+)
+
+// otherErrorClass names the errors of no known class
+const otherErrorClass = "other"
+
+// ec2ErrorClasses maps the error codes of EC2 to their class, the codes ending with .NotFound are of ErrNotFound
+var ec2ErrorClasses = map[string]*errorClass{
+	"UnauthorizedOperation":             ErrUnauthorized,
+	"InsufficientCidrBlocks":            ErrInsufficientSubnetIPs,
+	"InsufficientFreeAddressesInSubnet": ErrInsufficientSubnetIPs,
+	"PrivateIpAddressLimitExceeded":     ErrIPLimitExceeded,
+	"AttachmentLimitExceeded":           ErrENILimitExceeded,
+}
+
+// EC2Error is an error of an EC2 call, classified so that callers decide on it with errors.Is instead of its code. It
+// is still an awserr.Error, and its message is the one of the error of the SDK.
+type EC2Error struct {
+	// API is the EC2 operation that failed
+	API string
+	// RequestID identifies the request for AWS support, it is empty when the request did not reach EC2
+	RequestID string
+	class     *errorClass
+	err       error
+	aerr      awserr.Error
+}
+
+// newEC2Error classifies the error of an EC2 call. Errors that do not come from the SDK are returned as is.
+func newEC2Error(api string, err error) error {
+	var ec2Err *EC2Error
+	var aerr awserr.Error
+	if err == nil || errors.As(err, &ec2Err) || !errors.As(err, &aerr) {
+		return err
+	}
+	ec2Err = &EC2Error{API: api, class: classifyAWSError(aerr), err: err, aerr: aerr}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		ec2Err.RequestID = reqErr.RequestID()
+	}
+	return ec2Err
+}
+
+func classifyAWSError(aerr awserr.Error) *errorClass {
+	if class, ok := ec2ErrorClasses[aerr.Code()]; ok {
+		return class
+	}
+	var reqErr awserr.RequestFailure
+	switch {
+	case request.IsErrorThrottle(aerr):
+		return ErrThrottled
+	case strings.HasSuffix(aerr.Code(), ".NotFound"):
+		return ErrNotFound
+	case errors.As(aerr, &reqErr) && reqErr.StatusCode() == http.StatusNotFound:
+		return ErrNotFound
+	case errors.As(aerr, &reqErr) && reqErr.StatusCode() >= http.StatusInternalServerError:
+		return ErrTransient
+	case request.IsErrorRetryable(aerr):
+		return ErrTransient
+	}
+	return nil
+}
+
+func (e *EC2Error) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap returns the error of the SDK
+func (e *EC2Error) Unwrap() error {
+	return e.err
+}
+
+// Is matches the class of the error
+func (e *EC2Error) Is(target error) bool {
+	return e.class != nil && target == e.class
+}
+
+// Code returns the EC2 error code
+func (e *EC2Error) Code() string {
+	return e.aerr.Code()
+}
+
+// Message returns the EC2 error message
+func (e *EC2Error) Message() string {
+	return e.aerr.Message()
+}
+
+// OrigErr returns the error the SDK error wraps, if any
+func (e *EC2Error) OrigErr() error {
+	return e.aerr.OrigErr()
+}
+
+// ErrorClass returns the name of the class of an error of awsutils, for metrics and error details. Errors that
+// awsutils did not classify are classified from their EC2 code, and errors of no known class are "other".
+func ErrorClass(err error) string {
+	if class := errorClassOf(err); class != nil {
+		return class.name
+	}
+	return otherErrorClass
+}
+
+// IsRetryable returns whether retrying the failed EC2 request later can succeed
+func IsRetryable(err error) bool {
+	class := errorClassOf(err)
+	return class != nil && class.retryable
+}
+
+// EC2RequestID returns the ID of the failed EC2 request, or an empty string when it has none
+func EC2RequestID(err error) string {
+	var ec2Err *EC2Error
+	if errors.As(err, &ec2Err) {
+		return ec2Err.RequestID
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) {
+		return reqErr.RequestID()
+	}
+	return ""
+}
+
+func errorClassOf(err error) *errorClass {
+	var ec2Err *EC2Error
+	if errors.As(err, &ec2Err) {
+		return ec2Err.class
+	}
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		return classifyAWSError(aerr)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEC2Error(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		class     error
+		className string
+		retryable bool
+	}{
+		{"unauthorized", awserr.New("UnauthorizedOperation", "", nil), ErrUnauthorized, "unauthorized", false},
+		{"insufficient cidr blocks", awserr.New("InsufficientCidrBlocks", "", nil), ErrInsufficientSubnetIPs, "insufficient_subnet_ips", false},
+		{"insufficient free addresses", awserr.New("InsufficientFreeAddressesInSubnet", "", nil), ErrInsufficientSubnetIPs, "insufficient_subnet_ips", false},
+		{"ip limit", awserr.New("PrivateIpAddressLimitExceeded", "", nil), ErrIPLimitExceeded, "ip_limit_exceeded", false},
+		{"eni limit", awserr.New("AttachmentLimitExceeded", "", nil), ErrENILimitExceeded, "eni_limit_exceeded", false},
+		{"throttled", awserr.New("RequestLimitExceeded", "", nil), ErrThrottled, "throttled", true},
+		{"not found", awserr.New("InvalidNetworkInterfaceID.NotFound", "", nil), ErrNotFound, "not_found", false},
+		{"not found status", awserr.NewRequestFailure(awserr.New("NoSuchEntity", "", nil), http.StatusNotFound, ""), ErrNotFound, "not_found", false},
+		{"server error", awserr.NewRequestFailure(awserr.New("InternalError", "", nil), http.StatusInternalServerError, ""), ErrTransient, "transient", true},
+		{"unknown code", awserr.New("InvalidParameterValue", "", nil), nil, "other", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := newEC2Error("AssignPrivateIpAddresses", test.err)
+			assert.Equal(t, test.err.Error(), err.Error())
+			var ec2Err *EC2Error
+			if assert.ErrorAs(t, err, &ec2Err) {
+				assert.Equal(t, "AssignPrivateIpAddresses", ec2Err.API)
+			}
+			var aerr awserr.Error
+			if assert.ErrorAs(t, err, &aerr) {
+				assert.Equal(t, test.err.(awserr.Error).Code(), aerr.Code())
+			}
+			if test.class != nil {
+				assert.ErrorIs(t, err, test.class)
+				assert.ErrorIs(t, pkgerrors.Wrap(err, "failed to allocate IPs"), test.class)
+			}
+			assert.Equal(t, test.className, ErrorClass(err))
+			assert.Equal(t, test.retryable, IsRetryable(err))
+			// An error classified once keeps its class
+			assert.Same(t, err, newEC2Error("DescribeNetworkInterfaces", err))
+		})
+	}
+}
+
+func TestNewEC2ErrorNotFromSDK(t *testing.T) {
+	assert.NoError(t, newEC2Error("CreateTags", nil))
+	err := errors.New("failed to build the request")
+	assert.Same(t, err, newEC2Error("CreateTags", err))
+	assert.Equal(t, "other", ErrorClass(err))
+	assert.False(t, IsRetryable(err))
+	assert.NotErrorIs(t, err, ErrThrottled)
+}
+
+func TestErrorClassOfUnwrappedSDKError(t *testing.T) {
+	// Errors returned before classification, by mocks of ec2wrapper for instance, are classified from their code
+	err := pkgerrors.Wrap(awserr.New("Throttling", "Rate exceeded", nil), "failed to describe ENIs")
+	assert.Equal(t, "throttled", ErrorClass(err))
+	assert.True(t, IsRetryable(err))
+}
@@ -15,11 +15,13 @@ package awsutils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/pkg/errors"
@@ -199,6 +201,20 @@ func (imds TypedIMDS) GetVpcID(ctx context.Context, mac string) (string, error)
 	return vpcID, err
 }
 
+// GetOwnerID returns the ID of the AWS account that owns the network interface.
+func (imds TypedIMDS) GetOwnerID(ctx context.Context, mac string) (string, error) {
+	key := fmt.Sprintf("network/interfaces/macs/%s/owner-id", mac)
+	ownerID, err := imds.GetMetadataWithContext(ctx, key)
+	if err != nil {
+		if imdsErr, ok := err.(*imdsRequestError); ok {
+			log.Warnf("%v", err)
+			return ownerID, imdsErr.err
+		}
+		return "", err
+	}
+	return ownerID, err
+}
+
 // GetSecurityGroupIDs returns the IDs of the security groups to which the network interface belongs.
 func (imds TypedIMDS) GetSecurityGroupIDs(ctx context.Context, mac string) ([]string, error) {
 	key := fmt.Sprintf("network/interfaces/macs/%s/security-group-ids", mac)
@@ -217,7 +233,10 @@ func (imds TypedIMDS) getIP(ctx context.Context, key string) (net.IP, error) {
 	data, err := imds.GetMetadataWithContext(ctx, key)
 	if err != nil {
 		if imdsErr, ok := err.(*imdsRequestError); ok {
-			log.Warnf("%v", err)
+			// Missing keys are reported by the callers that need them
+			if !IsNotFound(imdsErr.err) {
+				log.Warnf("%v", err)
+			}
 			return nil, imdsErr.err
 		}
 		return nil, err
@@ -253,7 +272,10 @@ func (imds TypedIMDS) getCIDR(ctx context.Context, key string) (net.IPNet, error
 	data, err := imds.GetMetadataWithContext(ctx, key)
 	if err != nil {
 		if imdsErr, ok := err.(*imdsRequestError); ok {
-			log.Warnf("%v", err)
+			// Missing keys are reported by the callers that need them
+			if !IsNotFound(imdsErr.err) {
+				log.Warnf("%v", err)
+			}
 			return net.IPNet{}, imdsErr.err
 		}
 		return net.IPNet{}, err
@@ -292,7 +314,10 @@ func (imds TypedIMDS) GetLocalIPv4s(ctx context.Context, mac string) ([]net.IP,
 	ips, err := imds.getIPs(ctx, key)
 	if err != nil {
 		if imdsErr, ok := err.(*imdsRequestError); ok {
-			log.Warnf("%v", err)
+			// ENIs in IPv6-only subnets have no IPv4 address
+			if !IsNotFound(imdsErr.err) {
+				log.Warnf("%v", err)
+			}
 			return nil, imdsErr.err
 		}
 		return nil, err
@@ -396,6 +421,48 @@ func (imds TypedIMDS) GetSubnetIPv6CIDRBlocks(ctx context.Context, mac string) (
 	return imds.getCIDR(ctx, key)
 }
 
+// SpotInstanceAction is the action EC2 scheduled for a Spot Instance that is being interrupted
+type SpotInstanceAction struct {
+	Action string    `json:"action"`
+	Time   time.Time `json:"time"`
+}
+
+// GetSpotInstanceAction returns the interruption scheduled for this Spot Instance, or nil when there is none.
+func (imds TypedIMDS) GetSpotInstanceAction(ctx context.Context) (*SpotInstanceAction, error) {
+	data, err := imds.GetMetadataWithContext(ctx, "spot/instance-action")
+	if err != nil {
+		if imdsErr, ok := err.(*imdsRequestError); ok {
+			err = imdsErr.err
+		}
+		if IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var action SpotInstanceAction
+	if err := json.Unmarshal([]byte(data), &action); err != nil {
+		return nil, errors.Wrapf(err, "invalid spot instance action %q", data)
+	}
+	return &action, nil
+}
+
+// GetTargetLifecycleState returns the lifecycle state the Auto Scaling group is moving this instance to, or an empty
+// string when the instance is not part of an Auto Scaling group.
+func (imds TypedIMDS) GetTargetLifecycleState(ctx context.Context) (string, error) {
+	state, err := imds.GetMetadataWithContext(ctx, "autoscaling/target-lifecycle-state")
+	if err != nil {
+		if imdsErr, ok := err.(*imdsRequestError); ok {
+			err = imdsErr.err
+		}
+		if IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(state), nil
+}
+
 // IsNotFound returns true if the error was caused by an AWS API 404 response.
 func IsNotFound(err error) bool {
 	if err != nil {
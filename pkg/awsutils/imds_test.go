@@ -17,6 +17,7 @@ import (
 	"context"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -279,3 +280,36 @@ func TestGetIPv4Prefixes(t *testing.T) {
 		}
 	}
 }
+
+func TestGetSpotInstanceAction(t *testing.T) {
+	f := TypedIMDS{FakeIMDS(map[string]interface{}{
+		"spot/instance-action": `{"action": "terminate", "time": "2017-09-18T08:22:00Z"}`,
+	})}
+
+	action, err := f.GetSpotInstanceAction(context.TODO())
+	if assert.NoError(t, err) {
+		assert.Equal(t, &SpotInstanceAction{Action: "terminate", Time: time.Date(2017, 9, 18, 8, 22, 0, 0, time.UTC)}, action)
+	}
+
+	// IMDS returns 404 when no interruption is scheduled
+	action, err = TypedIMDS{FakeIMDS(map[string]interface{}{})}.GetSpotInstanceAction(context.TODO())
+	if assert.NoError(t, err) {
+		assert.Nil(t, action)
+	}
+}
+
+func TestGetTargetLifecycleState(t *testing.T) {
+	f := TypedIMDS{FakeIMDS(map[string]interface{}{
+		"autoscaling/target-lifecycle-state": "Terminated",
+	})}
+
+	state, err := f.GetTargetLifecycleState(context.TODO())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "Terminated", state)
+	}
+
+	state, err = TypedIMDS{FakeIMDS(map[string]interface{}{})}.GetTargetLifecycleState(context.TODO())
+	if assert.NoError(t, err) {
+		assert.Equal(t, "", state)
+	}
+}
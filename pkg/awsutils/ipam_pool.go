@@ -0,0 +1,260 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+const (
+	// ipamPoolIDEnvVar is the ID of an Amazon VPC IP Address Manager pool that the secondary IPv4 addresses and prefixes
+	// of the ENIs are allocated from. Each IP or prefix is an allocation of the pool, described with the instance and the
+	// ENI, so that the usage of the pool shows the node behind each address, and the allocation rules of the pool apply
+	// to the CNI. The pool must cover the subnets of the ENIs. Empty by default, EC2 picks the addresses.
+	ipamPoolIDEnvVar = "VPC_IPAM_POOL_ID"
+
+	// ipamPoolAllocationPrefix starts the description of the pool allocations made by ipamd
+	ipamPoolAllocationPrefix = "aws-node"
+
+	secondaryIPv4MaskLength = 32
+	ipv4PrefixMaskLength    = 28
+)
+
+// ipamPoolAllocation is an IP or prefix allocated from the IPAM pool for an ENI
+type ipamPoolAllocation struct {
+	id    string
+	eniID string
+}
+
+func loadIPAMPoolID() string {
+	poolID := os.Getenv(ipamPoolIDEnvVar)
+	if poolID != "" && !strings.HasPrefix(poolID, "ipam-pool-") {
+		log.Errorf("Ignoring %s %q, it is not the ID of an IPAM pool", ipamPoolIDEnvVar, poolID)
+		return ""
+	}
+	return poolID
+}
+
+// IPAMPoolID returns the IPAM pool the IPs and prefixes of the ENIs are allocated from, if any
+func (cache *EC2InstanceMetadataCache) IPAMPoolID() string {
+	return cache.ipamPoolID
+}
+
+// IsIPAMPoolCIDR returns whether the IP or prefix, in CIDR notation, was allocated from the IPAM pool
+func (cache *EC2InstanceMetadataCache) IsIPAMPoolCIDR(cidr string) bool {
+	cache.ipamPoolLock.Lock()
+	defer cache.ipamPoolLock.Unlock()
+	_, ok := cache.ipamPoolAllocations[cidr]
+	return ok
+}
+
+func (cache *EC2InstanceMetadataCache) ipamPoolAllocationDescription(eniID string) string {
+	return strings.Join([]string{ipamPoolAllocationPrefix, cache.instanceID, eniID}, " ")
+}
+
+// loadIPAMPoolAllocations finds the allocations made for the ENIs of the instance, so that they are released after a
+// restart of ipamd
+func (cache *EC2InstanceMetadataCache) loadIPAMPoolAllocations(ctx context.Context) error {
+	allocations := map[string]ipamPoolAllocation{}
+	start := time.Now()
+	err := cache.ec2SVC.GetIpamPoolAllocationsPagesWithContext(ctx, &ec2.GetIpamPoolAllocationsInput{
+		IpamPoolId: aws.String(cache.ipamPoolID),
+	}, func(output *ec2.GetIpamPoolAllocationsOutput, _ bool) bool {
+		for _, allocation := range output.IpamPoolAllocations {
+			fields := strings.Fields(aws.StringValue(allocation.Description))
+			if len(fields) != 3 || fields[0] != ipamPoolAllocationPrefix || fields[1] != cache.instanceID {
+				continue
+			}
+			allocations[aws.StringValue(allocation.Cidr)] = ipamPoolAllocation{
+				id:    aws.StringValue(allocation.IpamPoolAllocationId),
+				eniID: fields[2],
+			}
+		}
+		return true
+	})
+	err = cache.ec2CallError("GetIpamPoolAllocations", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("GetIpamPoolAllocations").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("GetIpamPoolAllocations", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:GetIpamPoolAllocations")
+		awsAPIErrInc("GetIpamPoolAllocations", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("GetIpamPoolAllocations").Inc()
+		return errors.Wrapf(err, "failed to get the allocations of IPAM pool %s", cache.ipamPoolID)
+	}
+	cache.ipamPoolLock.Lock()
+	cache.ipamPoolAllocations = allocations
+	cache.ipamPoolLock.Unlock()
+	log.Infof("Found %d allocations of IPAM pool %s for the instance", len(allocations), cache.ipamPoolID)
+	return nil
+}
+
+// eniSubnetIPv4CIDR returns the IPv4 CIDR of the subnet of an attached ENI, the pool allocations must be in it
+func (cache *EC2InstanceMetadataCache) eniSubnetIPv4CIDR(ctx context.Context, eniID string) (string, error) {
+	macs, err := cache.imds.GetMACs(ctx)
+	if err != nil {
+		awsAPIErrInc("GetMACs", err)
+		return "", err
+	}
+	for _, mac := range macs {
+		id, err := cache.imds.GetInterfaceID(ctx, mac)
+		if err != nil {
+			awsAPIErrInc("GetInterfaceID", err)
+			return "", err
+		}
+		if id != eniID {
+			continue
+		}
+		cidr, err := cache.imds.GetSubnetIPv4CIDRBlock(ctx, mac)
+		if err != nil {
+			awsAPIErrInc("GetSubnetIPv4CIDRBlock", err)
+			return "", err
+		}
+		return cidr.String(), nil
+	}
+	return "", errors.Errorf("ENI %s is not attached to the instance yet", eniID)
+}
+
+// allocIPAMPoolAddresses allocates count IPs, or prefixes with prefix delegation, from the IPAM pool in the subnet of
+// the ENI and assigns them to the ENI. The allocations are released when they can not all be assigned.
+func (cache *EC2InstanceMetadataCache) allocIPAMPoolAddresses(ctx context.Context, eniID string, count int) (*ec2.AssignPrivateIpAddressesOutput, error) {
+	subnetCIDR, err := cache.eniSubnetIPv4CIDR(ctx, eniID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to find the subnet of ENI %s", eniID)
+	}
+	maskLength := secondaryIPv4MaskLength
+	if cache.enablePrefixDelegation {
+		maskLength = ipv4PrefixMaskLength
+	}
+
+	var cidrs []string
+	for i := 0; i < count; i++ {
+		cidr, err := cache.allocateIPAMPoolCIDR(ctx, eniID, subnetCIDR, maskLength)
+		if err != nil {
+			if len(cidrs) == 0 {
+				return nil, err
+			}
+			// Assign what the pool could allocate, it may be exhausted
+			log.Warnf("Allocated %d of %d CIDRs for ENI %s from IPAM pool %s: %v", len(cidrs), count, eniID, cache.ipamPoolID, err)
+			break
+		}
+		cidrs = append(cidrs, cidr)
+	}
+
+	input := &ec2.AssignPrivateIpAddressesInput{NetworkInterfaceId: aws.String(eniID)}
+	if cache.enablePrefixDelegation {
+		input.Ipv4Prefixes = aws.StringSlice(cidrs)
+	} else {
+		for _, cidr := range cidrs {
+			ip, _, _ := net.ParseCIDR(cidr)
+			input.PrivateIpAddresses = append(input.PrivateIpAddresses, aws.String(ip.String()))
+		}
+	}
+	start := time.Now()
+	output, err := cache.ec2SVC.AssignPrivateIpAddressesWithContext(ctx, input)
+	err = cache.ec2CallError("AssignPrivateIpAddresses", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("AssignPrivateIpAddresses").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("AssignPrivateIpAddresses", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:AssignPrivateIpAddresses")
+		awsAPIErrInc("AssignPrivateIpAddresses", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("AssignPrivateIpAddresses").Inc()
+		cache.releaseIPAMPoolCIDRs(ctx, eniID, cidrs)
+		return nil, errors.Wrapf(err, "failed to assign %v allocated from IPAM pool %s to ENI %s", cidrs, cache.ipamPoolID, eniID)
+	}
+	log.Infof("Assigned %v allocated from IPAM pool %s to ENI %s", cidrs, cache.ipamPoolID, eniID)
+	return output, nil
+}
+
+// allocateIPAMPoolCIDR allocates a CIDR of the given mask length within subnetCIDR from the IPAM pool
+func (cache *EC2InstanceMetadataCache) allocateIPAMPoolCIDR(ctx context.Context, eniID, subnetCIDR string, maskLength int) (string, error) {
+	start := time.Now()
+	output, err := cache.ec2SVC.AllocateIpamPoolCidrWithContext(ctx, &ec2.AllocateIpamPoolCidrInput{
+		IpamPoolId:    aws.String(cache.ipamPoolID),
+		NetmaskLength: aws.Int64(int64(maskLength)),
+		AllowedCidrs:  []*string{aws.String(subnetCIDR)},
+		Description:   aws.String(cache.ipamPoolAllocationDescription(eniID)),
+	})
+	err = cache.ec2CallError("AllocateIpamPoolCidr", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("AllocateIpamPoolCidr").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("AllocateIpamPoolCidr", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:AllocateIpamPoolCidr")
+		awsAPIErrInc("AllocateIpamPoolCidr", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("AllocateIpamPoolCidr").Inc()
+		return "", errors.Wrapf(err, "failed to allocate a /%d in %s from IPAM pool %s", maskLength, subnetCIDR, cache.ipamPoolID)
+	}
+	cidr := aws.StringValue(output.IpamPoolAllocation.Cidr)
+	cache.ipamPoolLock.Lock()
+	cache.ipamPoolAllocations[cidr] = ipamPoolAllocation{
+		id:    aws.StringValue(output.IpamPoolAllocation.IpamPoolAllocationId),
+		eniID: eniID,
+	}
+	cache.ipamPoolLock.Unlock()
+	return cidr, nil
+}
+
+// releaseIPAMPoolCIDRs releases the pool allocations of the ENI among cidrs, or all of them when cidrs is nil. The
+// addresses are already unassigned from the ENI, so errors are only logged, the allocations are released again after
+// the next restart of ipamd.
+func (cache *EC2InstanceMetadataCache) releaseIPAMPoolCIDRs(ctx context.Context, eniID string, cidrs []string) {
+	if cache.ipamPoolID == "" {
+		return
+	}
+	selected := map[string]bool{}
+	for _, cidr := range cidrs {
+		selected[cidr] = true
+	}
+	cache.ipamPoolLock.Lock()
+	released := map[string]ipamPoolAllocation{}
+	for cidr, allocation := range cache.ipamPoolAllocations {
+		if allocation.eniID == eniID && (cidrs == nil || selected[cidr]) {
+			released[cidr] = allocation
+		}
+	}
+	cache.ipamPoolLock.Unlock()
+
+	for cidr, allocation := range released {
+		start := time.Now()
+		_, err := cache.ec2SVC.ReleaseIpamPoolAllocationWithContext(ctx, &ec2.ReleaseIpamPoolAllocationInput{
+			IpamPoolId:           aws.String(cache.ipamPoolID),
+			IpamPoolAllocationId: aws.String(allocation.id),
+			Cidr:                 aws.String(cidr),
+		})
+		err = cache.ec2CallError("ReleaseIpamPoolAllocation", err)
+		prometheusmetrics.Ec2ApiReq.WithLabelValues("ReleaseIpamPoolAllocation").Inc()
+		prometheusmetrics.AwsAPILatency.WithLabelValues("ReleaseIpamPoolAllocation", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			checkAPIErrorAndBroadcastEvent(err, "ec2:ReleaseIpamPoolAllocation")
+			awsAPIErrInc("ReleaseIpamPoolAllocation", err)
+			prometheusmetrics.Ec2ApiErr.WithLabelValues("ReleaseIpamPoolAllocation").Inc()
+			log.Errorf("Failed to release %s of ENI %s to IPAM pool %s: %v", cidr, eniID, cache.ipamPoolID, err)
+			continue
+		}
+		cache.ipamPoolLock.Lock()
+		delete(cache.ipamPoolAllocations, cidr)
+		cache.ipamPoolLock.Unlock()
+		log.Infof("Released %s of ENI %s to IPAM pool %s", cidr, eniID, cache.ipamPoolID)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_ec2wrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper/mocks"
+)
+
+const ipamPoolID = "ipam-pool-0123456789abcdef0"
+
+func ipamPoolCache(mockEC2 *mock_ec2wrapper.MockEC2) *EC2InstanceMetadataCache {
+	return &EC2InstanceMetadataCache{
+		imds:                TypedIMDS{testMetadata(nil)},
+		ec2SVC:              mockEC2,
+		instanceID:          instanceID,
+		ipamPoolID:          ipamPoolID,
+		ipamPoolAllocations: map[string]ipamPoolAllocation{},
+	}
+}
+
+func TestLoadIPAMPoolID(t *testing.T) {
+	t.Setenv(ipamPoolIDEnvVar, ipamPoolID)
+	assert.Equal(t, ipamPoolID, loadIPAMPoolID())
+	t.Setenv(ipamPoolIDEnvVar, "pool-1")
+	assert.Equal(t, "", loadIPAMPoolID())
+}
+
+func TestAllocIPAddressesFromIPAMPool(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	cache := ipamPoolCache(mockEC2)
+
+	allocated := []string{"10.0.1.16/28", "10.0.1.32/28"}
+	for i, cidr := range allocated {
+		mockEC2.EXPECT().AllocateIpamPoolCidrWithContext(gomock.Any(), &ec2.AllocateIpamPoolCidrInput{
+			IpamPoolId:    aws.String(ipamPoolID),
+			NetmaskLength: aws.Int64(28),
+			AllowedCidrs:  []*string{aws.String(subnetCIDR)},
+			Description:   aws.String("aws-node " + instanceID + " " + primaryeniID),
+		}).Return(&ec2.AllocateIpamPoolCidrOutput{IpamPoolAllocation: &ec2.IpamPoolAllocation{
+			Cidr:                 aws.String(cidr),
+			IpamPoolAllocationId: aws.String([]string{"ipam-pool-alloc-1", "ipam-pool-alloc-2"}[i]),
+		}}, nil)
+	}
+	mockEC2.EXPECT().AssignPrivateIpAddressesWithContext(gomock.Any(), &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String(primaryeniID),
+		Ipv4Prefixes:       aws.StringSlice(allocated),
+	}).Return(&ec2.AssignPrivateIpAddressesOutput{}, nil)
+
+	cache.enablePrefixDelegation = true
+	_, err := cache.allocIPAMPoolAddresses(context.Background(), primaryeniID, 2)
+	assert.NoError(t, err)
+	assert.True(t, cache.IsIPAMPoolCIDR("10.0.1.16/28"))
+	assert.True(t, cache.IsIPAMPoolCIDR("10.0.1.32/28"))
+
+	// The allocations are released with the prefixes
+	mockEC2.EXPECT().UnassignPrivateIpAddressesWithContext(gomock.Any(), gomock.Any()).Return(nil, nil)
+	mockEC2.EXPECT().ReleaseIpamPoolAllocationWithContext(gomock.Any(), &ec2.ReleaseIpamPoolAllocationInput{
+		IpamPoolId:           aws.String(ipamPoolID),
+		IpamPoolAllocationId: aws.String("ipam-pool-alloc-1"),
+		Cidr:                 aws.String("10.0.1.16/28"),
+	}).Return(&ec2.ReleaseIpamPoolAllocationOutput{}, nil)
+	assert.NoError(t, cache.DeallocPrefixAddresses(primaryeniID, []string{"10.0.1.16/28"}))
+	assert.False(t, cache.IsIPAMPoolCIDR("10.0.1.16/28"))
+	assert.True(t, cache.IsIPAMPoolCIDR("10.0.1.32/28"))
+}
+
+func TestAllocIPAddressesFromIPAMPoolAssignFailure(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	cache := ipamPoolCache(mockEC2)
+
+	mockEC2.EXPECT().AllocateIpamPoolCidrWithContext(gomock.Any(), gomock.Any()).Return(&ec2.AllocateIpamPoolCidrOutput{
+		IpamPoolAllocation: &ec2.IpamPoolAllocation{Cidr: aws.String("10.0.1.5/32"), IpamPoolAllocationId: aws.String("ipam-pool-alloc-1")},
+	}, nil)
+	// The pool is exhausted after the first IP, which is still assigned
+	mockEC2.EXPECT().AllocateIpamPoolCidrWithContext(gomock.Any(), gomock.Any()).Return(nil, errors.New("IpamPoolExhausted"))
+	mockEC2.EXPECT().AssignPrivateIpAddressesWithContext(gomock.Any(), &ec2.AssignPrivateIpAddressesInput{
+		NetworkInterfaceId: aws.String(primaryeniID),
+		PrivateIpAddresses: aws.StringSlice([]string{"10.0.1.5"}),
+	}).Return(nil, errors.New("PrivateIpAddressLimitExceeded"))
+	// The allocation that could not be assigned is released
+	mockEC2.EXPECT().ReleaseIpamPoolAllocationWithContext(gomock.Any(), gomock.Any()).Return(&ec2.ReleaseIpamPoolAllocationOutput{}, nil)
+
+	_, err := cache.allocIPAMPoolAddresses(context.Background(), primaryeniID, 2)
+	assert.Error(t, err)
+	assert.False(t, cache.IsIPAMPoolCIDR("10.0.1.5/32"))
+
+	// Nothing is assigned when the pool has no address at all
+	mockEC2.EXPECT().AllocateIpamPoolCidrWithContext(gomock.Any(), gomock.Any()).Return(nil, errors.New("IpamPoolExhausted"))
+	_, err = cache.allocIPAMPoolAddresses(context.Background(), primaryeniID, 1)
+	assert.Error(t, err)
+
+	// ENIs that are not attached yet have no known subnet
+	_, err = cache.allocIPAMPoolAddresses(context.Background(), "eni-unknown", 1)
+	assert.Error(t, err)
+}
+
+func TestLoadIPAMPoolAllocations(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	cache := ipamPoolCache(mockEC2)
+
+	mockEC2.EXPECT().GetIpamPoolAllocationsPagesWithContext(gomock.Any(), &ec2.GetIpamPoolAllocationsInput{
+		IpamPoolId: aws.String(ipamPoolID),
+	}, gomock.Any()).DoAndReturn(
+		func(_ context.Context, _ *ec2.GetIpamPoolAllocationsInput, fn func(*ec2.GetIpamPoolAllocationsOutput, bool) bool, _ ...interface{}) error {
+			fn(&ec2.GetIpamPoolAllocationsOutput{IpamPoolAllocations: []*ec2.IpamPoolAllocation{
+				{Cidr: aws.String("10.0.1.5/32"), IpamPoolAllocationId: aws.String("ipam-pool-alloc-1"),
+					Description: aws.String("aws-node " + instanceID + " " + primaryeniID)},
+				// Allocations of other instances, and not made by ipamd, are left alone
+				{Cidr: aws.String("10.0.1.6/32"), IpamPoolAllocationId: aws.String("ipam-pool-alloc-2"),
+					Description: aws.String("aws-node i-0000000000000000 " + primaryeniID)},
+				{Cidr: aws.String("10.0.2.0/24"), IpamPoolAllocationId: aws.String("ipam-pool-alloc-3")},
+			}}, true)
+			return nil
+		})
+
+	assert.NoError(t, cache.loadIPAMPoolAllocations(context.Background()))
+	assert.Equal(t, map[string]ipamPoolAllocation{
+		"10.0.1.5/32": {id: "ipam-pool-alloc-1", eniID: primaryeniID},
+	}, cache.ipamPoolAllocations)
+
+	// Freeing the ENI releases all of its allocations
+	mockEC2.EXPECT().ReleaseIpamPoolAllocationWithContext(gomock.Any(), &ec2.ReleaseIpamPoolAllocationInput{
+		IpamPoolId:           aws.String(ipamPoolID),
+		IpamPoolAllocationId: aws.String("ipam-pool-alloc-1"),
+		Cidr:                 aws.String("10.0.1.5/32"),
+	}).Return(&ec2.ReleaseIpamPoolAllocationOutput{}, nil)
+	cache.releaseIPAMPoolCIDRs(context.Background(), primaryeniID, nil)
+	assert.Empty(t, cache.ipamPoolAllocations)
+}
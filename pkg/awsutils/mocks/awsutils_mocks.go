@@ -19,12 +19,12 @@
 package mock_awsutils
 
 import (
+	context "context"
 	net "net"
 	reflect "reflect"
 
-	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
-
 	awsutils "github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	datastore "github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
 	vpc "github.com/aws/amazon-vpc-cni-k8s/pkg/vpc"
 	ec2 "github.com/aws/aws-sdk-go/service/ec2"
 	gomock "github.com/golang/mock/gomock"
@@ -98,18 +98,47 @@ func (mr *MockAPIsMockRecorder) AllocIPAddresses(arg0, arg1 interface{}) *gomock
 }
 
 // AllocIPv6Prefixes mocks base method.
-func (m *MockAPIs) AllocIPv6Prefixes(arg0 string) ([]*string, error) {
+func (m *MockAPIs) AllocIPv6Prefixes(arg0 string, arg1 int) ([]*string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AllocIPv6Prefixes", arg0)
+	ret := m.ctrl.Call(m, "AllocIPv6Prefixes", arg0, arg1)
 	ret0, _ := ret[0].([]*string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // AllocIPv6Prefixes indicates an expected call of AllocIPv6Prefixes.
-func (mr *MockAPIsMockRecorder) AllocIPv6Prefixes(arg0 interface{}) *gomock.Call {
+func (mr *MockAPIsMockRecorder) AllocIPv6Prefixes(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllocIPv6Prefixes", reflect.TypeOf((*MockAPIs)(nil).AllocIPv6Prefixes), arg0, arg1)
+}
+
+// AllocateCarrierIP mocks base method.
+func (m *MockAPIs) AllocateCarrierIP(arg0 context.Context, arg1, arg2 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AllocateCarrierIP", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AllocateCarrierIP indicates an expected call of AllocateCarrierIP.
+func (mr *MockAPIsMockRecorder) AllocateCarrierIP(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllocIPv6Prefixes", reflect.TypeOf((*MockAPIs)(nil).AllocIPv6Prefixes), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AllocateCarrierIP", reflect.TypeOf((*MockAPIs)(nil).AllocateCarrierIP), arg0, arg1, arg2)
+}
+
+// CheckEC2Permissions mocks base method.
+func (m *MockAPIs) CheckEC2Permissions(arg0 context.Context, arg1 string, arg2 []*string, arg3 bool) []awsutils.EC2Permission {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckEC2Permissions", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]awsutils.EC2Permission)
+	return ret0
+}
+
+// CheckEC2Permissions indicates an expected call of CheckEC2Permissions.
+func (mr *MockAPIsMockRecorder) CheckEC2Permissions(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckEC2Permissions", reflect.TypeOf((*MockAPIs)(nil).CheckEC2Permissions), arg0, arg1, arg2, arg3)
 }
 
 // DeallocIPAddresses mocks base method.
@@ -198,6 +227,35 @@ func (mr *MockAPIsMockRecorder) GetAttachedENIs() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetAttachedENIs", reflect.TypeOf((*MockAPIs)(nil).GetAttachedENIs))
 }
 
+// GetCarrierIPs mocks base method.
+func (m *MockAPIs) GetCarrierIPs(arg0 context.Context) (map[string][]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCarrierIPs", arg0)
+	ret0, _ := ret[0].(map[string][]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetCarrierIPs indicates an expected call of GetCarrierIPs.
+func (mr *MockAPIsMockRecorder) GetCarrierIPs(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCarrierIPs", reflect.TypeOf((*MockAPIs)(nil).GetCarrierIPs), arg0)
+}
+
+// GetEC2Failures mocks base method.
+func (m *MockAPIs) GetEC2Failures() []awsutils.EC2Failure {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEC2Failures")
+	ret0, _ := ret[0].([]awsutils.EC2Failure)
+	return ret0
+}
+
+// GetEC2Failures indicates an expected call of GetEC2Failures.
+func (mr *MockAPIsMockRecorder) GetEC2Failures() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEC2Failures", reflect.TypeOf((*MockAPIs)(nil).GetEC2Failures))
+}
+
 // GetENIIPv4Limit mocks base method.
 func (m *MockAPIs) GetENIIPv4Limit() int {
 	m.ctrl.T.Helper()
@@ -369,6 +427,36 @@ func (mr *MockAPIsMockRecorder) GetPrimaryENImac() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPrimaryENImac", reflect.TypeOf((*MockAPIs)(nil).GetPrimaryENImac))
 }
 
+// GetRoutedPrivateIPv4CIDRs mocks base method.
+func (m *MockAPIs) GetRoutedPrivateIPv4CIDRs(arg0 context.Context, arg1 []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRoutedPrivateIPv4CIDRs", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoutedPrivateIPv4CIDRs indicates an expected call of GetRoutedPrivateIPv4CIDRs.
+func (mr *MockAPIsMockRecorder) GetRoutedPrivateIPv4CIDRs(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoutedPrivateIPv4CIDRs", reflect.TypeOf((*MockAPIs)(nil).GetRoutedPrivateIPv4CIDRs), arg0, arg1)
+}
+
+// GetTerminationNotice mocks base method.
+func (m *MockAPIs) GetTerminationNotice(arg0 context.Context) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTerminationNotice", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetTerminationNotice indicates an expected call of GetTerminationNotice.
+func (mr *MockAPIsMockRecorder) GetTerminationNotice(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTerminationNotice", reflect.TypeOf((*MockAPIs)(nil).GetTerminationNotice), arg0)
+}
+
 // GetVPCIPv4CIDRs mocks base method.
 func (m *MockAPIs) GetVPCIPv4CIDRs() ([]string, error) {
 	m.ctrl.T.Helper()
@@ -399,6 +487,34 @@ func (mr *MockAPIsMockRecorder) GetVPCIPv6CIDRs() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetVPCIPv6CIDRs", reflect.TypeOf((*MockAPIs)(nil).GetVPCIPv6CIDRs))
 }
 
+// IPAMPoolID mocks base method.
+func (m *MockAPIs) IPAMPoolID() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IPAMPoolID")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// IPAMPoolID indicates an expected call of IPAMPoolID.
+func (mr *MockAPIsMockRecorder) IPAMPoolID() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IPAMPoolID", reflect.TypeOf((*MockAPIs)(nil).IPAMPoolID))
+}
+
+// InWavelengthZone mocks base method.
+func (m *MockAPIs) InWavelengthZone() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "InWavelengthZone")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// InWavelengthZone indicates an expected call of InWavelengthZone.
+func (mr *MockAPIsMockRecorder) InWavelengthZone() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InWavelengthZone", reflect.TypeOf((*MockAPIs)(nil).InWavelengthZone))
+}
+
 // InitCachedPrefixDelegation mocks base method.
 func (m *MockAPIs) InitCachedPrefixDelegation(arg0 bool) {
 	m.ctrl.T.Helper()
@@ -411,6 +527,20 @@ func (mr *MockAPIsMockRecorder) InitCachedPrefixDelegation(arg0 interface{}) *go
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitCachedPrefixDelegation", reflect.TypeOf((*MockAPIs)(nil).InitCachedPrefixDelegation), arg0)
 }
 
+// IsIPAMPoolCIDR mocks base method.
+func (m *MockAPIs) IsIPAMPoolCIDR(arg0 string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IsIPAMPoolCIDR", arg0)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// IsIPAMPoolCIDR indicates an expected call of IsIPAMPoolCIDR.
+func (mr *MockAPIsMockRecorder) IsIPAMPoolCIDR(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsIPAMPoolCIDR", reflect.TypeOf((*MockAPIs)(nil).IsIPAMPoolCIDR), arg0)
+}
+
 // IsMultiCardENI mocks base method.
 func (m *MockAPIs) IsMultiCardENI(arg0 string) bool {
 	m.ctrl.T.Helper()
@@ -468,17 +598,31 @@ func (mr *MockAPIsMockRecorder) IsUnmanagedENI(arg0 interface{}) *gomock.Call {
 }
 
 // RefreshSGIDs mocks base method.
-func (m *MockAPIs) RefreshSGIDs(mac string, store *datastore.DataStore) error {
+func (m *MockAPIs) RefreshSGIDs(arg0 string, arg1 *datastore.DataStore) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "RefreshSGIDs", mac, store)
+	ret := m.ctrl.Call(m, "RefreshSGIDs", arg0, arg1)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // RefreshSGIDs indicates an expected call of RefreshSGIDs.
-func (mr *MockAPIsMockRecorder) RefreshSGIDs(mac, store interface{}) *gomock.Call {
+func (mr *MockAPIsMockRecorder) RefreshSGIDs(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshSGIDs", reflect.TypeOf((*MockAPIs)(nil).RefreshSGIDs), arg0, arg1)
+}
+
+// ReleaseCarrierIP mocks base method.
+func (m *MockAPIs) ReleaseCarrierIP(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReleaseCarrierIP", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReleaseCarrierIP indicates an expected call of ReleaseCarrierIP.
+func (mr *MockAPIsMockRecorder) ReleaseCarrierIP(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RefreshSGIDs", reflect.TypeOf((*MockAPIs)(nil).RefreshSGIDs), mac, store)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReleaseCarrierIP", reflect.TypeOf((*MockAPIs)(nil).ReleaseCarrierIP), arg0, arg1)
 }
 
 // SetMultiCardENIs mocks base method.
@@ -507,6 +651,21 @@ func (mr *MockAPIsMockRecorder) SetUnmanagedENIs(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetUnmanagedENIs", reflect.TypeOf((*MockAPIs)(nil).SetUnmanagedENIs), arg0)
 }
 
+// SetupEgressSNATIP mocks base method.
+func (m *MockAPIs) SetupEgressSNATIP(arg0 context.Context, arg1 []string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetupEgressSNATIP", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetupEgressSNATIP indicates an expected call of SetupEgressSNATIP.
+func (mr *MockAPIsMockRecorder) SetupEgressSNATIP(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetupEgressSNATIP", reflect.TypeOf((*MockAPIs)(nil).SetupEgressSNATIP), arg0, arg1)
+}
+
 // TagENI mocks base method.
 func (m *MockAPIs) TagENI(arg0 string, arg1 map[string]string) error {
 	m.ctrl.T.Helper()
@@ -521,6 +680,34 @@ func (mr *MockAPIsMockRecorder) TagENI(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TagENI", reflect.TypeOf((*MockAPIs)(nil).TagENI), arg0, arg1)
 }
 
+// ValidateEC2Config mocks base method.
+func (m *MockAPIs) ValidateEC2Config(arg0 context.Context, arg1 string, arg2 []*string, arg3 bool) []error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateEC2Config", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]error)
+	return ret0
+}
+
+// ValidateEC2Config indicates an expected call of ValidateEC2Config.
+func (mr *MockAPIsMockRecorder) ValidateEC2Config(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateEC2Config", reflect.TypeOf((*MockAPIs)(nil).ValidateEC2Config), arg0, arg1, arg2, arg3)
+}
+
+// ValidateNAT64Config mocks base method.
+func (m *MockAPIs) ValidateNAT64Config(arg0 context.Context) []error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ValidateNAT64Config", arg0)
+	ret0, _ := ret[0].([]error)
+	return ret0
+}
+
+// ValidateNAT64Config indicates an expected call of ValidateNAT64Config.
+func (mr *MockAPIsMockRecorder) ValidateNAT64Config(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ValidateNAT64Config", reflect.TypeOf((*MockAPIs)(nil).ValidateNAT64Config), arg0)
+}
+
 // WaitForENIAndIPsAttached mocks base method.
 func (m *MockAPIs) WaitForENIAndIPsAttached(arg0 string, arg1 int) (awsutils.ENIMetadata, error) {
 	m.ctrl.T.Helper()
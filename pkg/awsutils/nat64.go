@@ -0,0 +1,87 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// NAT64Prefix is the well-known prefix that VPC NAT gateways translate to IPv4
+const NAT64Prefix = "64:ff9b::/96"
+
+// ValidateNAT64Config checks that DNS64 is enabled on the subnet of the primary ENI, so that the names of IPv4
+// endpoints resolve to addresses in the NAT64 prefix, and that the route table of the subnet routes the prefix.
+// Failures to describe the route tables are only logged, as they say nothing about the configuration.
+func (cache *EC2InstanceMetadataCache) ValidateNAT64Config(ctx context.Context) []error {
+	subnet, err := cache.describeSubnet(ctx, cache.subnetID)
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	if !aws.BoolValue(subnet.EnableDns64) {
+		errs = append(errs, fmt.Errorf("DNS64 is not enabled on subnet %s, the names of IPv4 endpoints do not "+
+			"resolve to NAT64 addresses", cache.subnetID))
+	}
+
+	routeTable, err := cache.describeSubnetRouteTable(ctx)
+	if err != nil {
+		log.Warnf("Could not check the route to the NAT64 prefix %s: %v", NAT64Prefix, err)
+		return errs
+	}
+	for _, route := range routeTable.Routes {
+		if aws.StringValue(route.DestinationIpv6CidrBlock) == NAT64Prefix && aws.StringValue(route.State) == ec2.RouteStateActive {
+			return errs
+		}
+	}
+	return append(errs, fmt.Errorf("route table %s of subnet %s has no active route for the NAT64 prefix %s",
+		aws.StringValue(routeTable.RouteTableId), cache.subnetID, NAT64Prefix))
+}
+
+// describeSubnetRouteTable returns the route table associated with the subnet of the primary ENI, or the main route
+// table of the VPC for subnets without one
+func (cache *EC2InstanceMetadataCache) describeSubnetRouteTable(ctx context.Context) (*ec2.RouteTable, error) {
+	filters := [][]*ec2.Filter{
+		{{Name: aws.String("association.subnet-id"), Values: []*string{aws.String(cache.subnetID)}}},
+		{
+			{Name: aws.String("vpc-id"), Values: []*string{aws.String(cache.vpcID)}},
+			{Name: aws.String("association.main"), Values: []*string{aws.String("true")}},
+		},
+	}
+	for _, filter := range filters {
+		start := time.Now()
+		result, err := cache.ec2SVC.DescribeRouteTablesWithContext(ctx, &ec2.DescribeRouteTablesInput{Filters: filter})
+		err = cache.ec2CallError("DescribeRouteTables", err)
+		prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeRouteTables").Inc()
+		prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeRouteTables", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+		if err != nil {
+			checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeRouteTables")
+			awsAPIErrInc("DescribeRouteTables", err)
+			prometheusmetrics.Ec2ApiErr.WithLabelValues("DescribeRouteTables").Inc()
+			return nil, errors.Wrapf(err, "unable to describe the route table of subnet %s", cache.subnetID)
+		}
+		if len(result.RouteTables) > 0 {
+			return result.RouteTables[0], nil
+		}
+	}
+	return nil, errors.Errorf("no route table found for subnet %s", cache.subnetID)
+}
@@ -0,0 +1,64 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNAT64Config(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, subnetID: subnetID, vpcID: "vpc-1"}
+
+	nat64Route := &ec2.Route{
+		DestinationIpv6CidrBlock: aws.String(NAT64Prefix),
+		NatGatewayId:             aws.String("nat-1"),
+		State:                    aws.String(ec2.RouteStateActive),
+	}
+	describeSubnet := func(dns64 bool) {
+		mockEC2.EXPECT().DescribeSubnetsWithContext(ctx, gomock.Any()).Return(&ec2.DescribeSubnetsOutput{
+			Subnets: []*ec2.Subnet{{SubnetId: aws.String(subnetID), EnableDns64: aws.Bool(dns64)}},
+		}, nil)
+	}
+
+	describeSubnet(true)
+	mockEC2.EXPECT().DescribeRouteTablesWithContext(ctx, gomock.Any()).Return(&ec2.DescribeRouteTablesOutput{
+		RouteTables: []*ec2.RouteTable{{RouteTableId: aws.String("rtb-1"), Routes: []*ec2.Route{nat64Route}}},
+	}, nil)
+	assert.Empty(t, cache.ValidateNAT64Config(ctx))
+
+	// Subnets without a route table of their own use the main route table of the VPC
+	describeSubnet(false)
+	mockEC2.EXPECT().DescribeRouteTablesWithContext(ctx, gomock.Any()).Return(&ec2.DescribeRouteTablesOutput{}, nil)
+	mockEC2.EXPECT().DescribeRouteTablesWithContext(ctx, gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *ec2.DescribeRouteTablesInput, _ ...interface{}) (*ec2.DescribeRouteTablesOutput, error) {
+			assert.Equal(t, "association.main", aws.StringValue(input.Filters[1].Name))
+			return &ec2.DescribeRouteTablesOutput{RouteTables: []*ec2.RouteTable{{RouteTableId: aws.String("rtb-main")}}}, nil
+		})
+	assert.Len(t, cache.ValidateNAT64Config(ctx), 2)
+
+	// The route table can not be checked without the permission to describe it
+	describeSubnet(true)
+	mockEC2.EXPECT().DescribeRouteTablesWithContext(ctx, gomock.Any()).Return(nil, errors.New("UnauthorizedOperation"))
+	assert.Empty(t, cache.ValidateNAT64Config(ctx))
+}
@@ -0,0 +1,166 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// The types of the zones of a region
+const (
+	ZoneTypeAvailabilityZone = "availability-zone"
+	ZoneTypeLocalZone        = "local-zone"
+	ZoneTypeWavelengthZone   = "wavelength-zone"
+)
+
+// zoneTypeOf returns the type of a zone from its name, which needs no ec2:DescribeAvailabilityZones permission. The
+// availability zones of a region are named after the region and a letter (us-west-2a), Wavelength Zones contain "-wlz-"
+// (us-east-1-wl1-bos-wlz-1), and Local Zones are named after the region and a location (us-west-2-lax-1a).
+func zoneTypeOf(region, zone string) string {
+	switch {
+	case strings.Contains(zone, "-wlz-"):
+		return ZoneTypeWavelengthZone
+	case strings.HasPrefix(zone, region+"-"):
+		return ZoneTypeLocalZone
+	default:
+		return ZoneTypeAvailabilityZone
+	}
+}
+
+// initPlacement finds the Outpost of the instance, if any, from its primary subnet. The ENIs of an instance on an
+// Outpost can only be created in the subnets of that Outpost, while the zone of the instance is the availability zone
+// the Outpost is anchored to, which it shares with the regional subnets.
+func (cache *EC2InstanceMetadataCache) initPlacement(ctx context.Context) {
+	cache.zoneType = zoneTypeOf(cache.region, cache.availabilityZone)
+	cache.subnetPlacements = map[string]bool{}
+
+	subnet, err := cache.describeSubnet(ctx, cache.subnetID)
+	if err != nil {
+		log.Warnf("Failed to find the Outpost of the instance, assuming it is not on an Outpost: %v", err)
+		return
+	}
+	cache.outpostARN = aws.StringValue(subnet.OutpostArn)
+	cache.subnetPlacements[cache.subnetID] = true
+	if cache.outpostARN != "" {
+		log.Infof("The instance is on Outpost %s in %s", cache.outpostARN, cache.availabilityZone)
+	} else {
+		log.Infof("The instance is in %s %s", cache.zoneType, cache.availabilityZone)
+	}
+	if cache.zoneType == ZoneTypeWavelengthZone {
+		log.Infof("The instance is in a Wavelength Zone: pods without a carrier IP of their own reach the carrier " +
+			"network through SNAT to the primary IP of the primary ENI")
+	}
+}
+
+// InWavelengthZone returns whether the instance is in a Wavelength Zone, where pods reach the carrier network through a
+// carrier IP
+func (cache *EC2InstanceMetadataCache) InWavelengthZone() bool {
+	return cache.zoneType == ZoneTypeWavelengthZone
+}
+
+// isColocatedSubnet returns whether the subnet is in the zone and on the Outpost of the instance, which the ENIs
+// attached to the instance must be. The subnets do not move, so the result is cached.
+func (cache *EC2InstanceMetadataCache) isColocatedSubnet(ctx context.Context, subnetID string) (bool, error) {
+	if subnetID == "" {
+		return false, nil
+	}
+	if cache.subnetPlacements == nil {
+		cache.subnetPlacements = map[string]bool{}
+	}
+	if colocated, ok := cache.subnetPlacements[subnetID]; ok {
+		return colocated, nil
+	}
+	subnet, err := cache.describeSubnet(ctx, subnetID)
+	if err != nil {
+		return false, err
+	}
+	colocated := cache.colocated(subnet)
+	cache.subnetPlacements[subnetID] = colocated
+	return colocated, nil
+}
+
+// tryCreateNetworkInterfaceInColocatedSubnet creates the ENI of custom networking in a subnet tagged for the CNI and
+// co-located with the instance, when the ENIConfig subnet is not co-located with it: an ENIConfig per zone name can not
+// tell an Outpost from the regional subnets of the zone it is anchored to, and Local and Wavelength Zones often have no
+// ENIConfig at all. It returns an empty ENI ID when the ENIConfig subnet is to be used instead.
+func (cache *EC2InstanceMetadataCache) tryCreateNetworkInterfaceInColocatedSubnet(input *ec2.CreateNetworkInterfaceInput) (string, error) {
+	eniCfgSubnet := aws.StringValue(input.SubnetId)
+	colocated, err := cache.isColocatedSubnet(context.Background(), eniCfgSubnet)
+	if err != nil {
+		log.Warnf("Failed to check that the ENIConfig subnet is co-located with the instance: %v", err)
+		return "", nil
+	}
+	if colocated {
+		return "", nil
+	}
+	subnets, err := cache.getVpcSubnets()
+	if err != nil {
+		return "", err
+	}
+	for _, subnet := range subnets {
+		// Pods are not in the subnet of the primary ENI with custom networking
+		if aws.StringValue(subnet.SubnetId) == cache.subnetID || !validTag(subnet) {
+			continue
+		}
+		if eniCfgSubnet != "" {
+			log.Warnf("ENIConfig subnet %s is not in %s or not on the Outpost of the instance, using subnet %s instead",
+				eniCfgSubnet, cache.availabilityZone, aws.StringValue(subnet.SubnetId))
+		}
+		input.SubnetId = subnet.SubnetId
+		log.Infof("Creating ENI with security groups: %v in subnet: %s", aws.StringValueSlice(input.Groups), aws.StringValue(input.SubnetId))
+		var networkInterfaceID string
+		networkInterfaceID, err = cache.tryCreateNetworkInterface(input)
+		if err == nil {
+			return networkInterfaceID, nil
+		}
+	}
+	input.SubnetId = aws.String(eniCfgSubnet)
+	return "", err
+}
+
+// colocated returns whether the subnet is in the zone and on the Outpost of the instance
+func (cache *EC2InstanceMetadataCache) colocated(subnet *ec2.Subnet) bool {
+	return aws.StringValue(subnet.AvailabilityZone) == cache.availabilityZone &&
+		aws.StringValue(subnet.OutpostArn) == cache.outpostARN
+}
+
+func (cache *EC2InstanceMetadataCache) describeSubnet(ctx context.Context, subnetID string) (*ec2.Subnet, error) {
+	start := time.Now()
+	result, err := cache.ec2SVC.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{
+		SubnetIds: []*string{aws.String(subnetID)},
+	})
+	err = cache.ec2CallError("DescribeSubnets", err)
+	prometheusmetrics.Ec2ApiReq.WithLabelValues("DescribeSubnets").Inc()
+	prometheusmetrics.AwsAPILatency.WithLabelValues("DescribeSubnets", fmt.Sprint(err != nil), awsReqStatus(err)).Observe(msSince(start))
+	if err != nil {
+		checkAPIErrorAndBroadcastEvent(err, "ec2:DescribeSubnets")
+		awsAPIErrInc("DescribeSubnets", err)
+		prometheusmetrics.Ec2ApiErr.WithLabelValues("DescribeSubnets").Inc()
+		return nil, errors.Wrapf(err, "unable to describe subnet %s", subnetID)
+	}
+	if len(result.Subnets) == 0 {
+		return nil, errors.Errorf("subnet %s not found", subnetID)
+	}
+	cache.recordSubnetOwners(result.Subnets)
+	return result.Subnets[0], nil
+}
@@ -0,0 +1,160 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const outpostARN = "arn:aws:outposts:us-west-2:123456789012:outpost/op-0123456789abcdef0"
+
+func testSubnet(id, zone, outpost string, available int64, tagged bool) *ec2.Subnet {
+	subnet := &ec2.Subnet{
+		SubnetId:                aws.String(id),
+		AvailabilityZone:        aws.String(zone),
+		AvailableIpAddressCount: aws.Int64(available),
+	}
+	if outpost != "" {
+		subnet.OutpostArn = aws.String(outpost)
+	}
+	if tagged {
+		subnet.Tags = []*ec2.Tag{{Key: aws.String(subnetDiscoveryTagKey), Value: aws.String("1")}}
+	}
+	return subnet
+}
+
+func TestZoneTypeOf(t *testing.T) {
+	assert.Equal(t, ZoneTypeAvailabilityZone, zoneTypeOf("us-west-2", "us-west-2a"))
+	assert.Equal(t, ZoneTypeLocalZone, zoneTypeOf("us-west-2", "us-west-2-lax-1a"))
+	assert.Equal(t, ZoneTypeWavelengthZone, zoneTypeOf("us-east-1", "us-east-1-wl1-bos-wlz-1"))
+}
+
+func TestInitPlacement(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, region: "us-east-1", availabilityZone: "us-east-1-wl1-bos-wlz-1", subnetID: subnetID}
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), &ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{subnetID})}).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{testSubnet(subnetID, "us-east-1-wl1-bos-wlz-1", "", 10, false)}}, nil)
+	cache.initPlacement(context.Background())
+	assert.True(t, cache.InWavelengthZone())
+	assert.Empty(t, cache.outpostARN)
+
+	cache = &EC2InstanceMetadataCache{ec2SVC: mockEC2, region: "us-west-2", availabilityZone: "us-west-2a", subnetID: subnetID}
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{testSubnet(subnetID, "us-west-2a", outpostARN, 10, false)}}, nil)
+	cache.initPlacement(context.Background())
+	assert.False(t, cache.InWavelengthZone())
+	assert.Equal(t, outpostARN, cache.outpostARN)
+}
+
+func TestGetVpcSubnetsOnOutpost(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	subnets := []*ec2.Subnet{
+		testSubnet("subnet-regional", "us-west-2a", "", 100, true),
+		testSubnet("subnet-outpost", "us-west-2a", outpostARN, 10, true),
+	}
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: subnets}, nil).Times(2)
+
+	// An instance on the Outpost only uses the subnets of the Outpost
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, availabilityZone: "us-west-2a", outpostARN: outpostARN}
+	result, err := cache.getVpcSubnets()
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "subnet-outpost", aws.StringValue(result[0].SubnetId))
+	}
+
+	// A regional instance does not use the subnets of the Outposts of its zone
+	cache = &EC2InstanceMetadataCache{ec2SVC: mockEC2, availabilityZone: "us-west-2a"}
+	result, err = cache.getVpcSubnets()
+	assert.NoError(t, err)
+	if assert.Len(t, result, 1) {
+		assert.Equal(t, "subnet-regional", aws.StringValue(result[0].SubnetId))
+	}
+}
+
+func TestCreateENICustomNetworkingOnOutpost(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	cache := &EC2InstanceMetadataCache{
+		ec2SVC:              mockEC2,
+		instanceType:        "c5n.18xlarge",
+		availabilityZone:    "us-west-2a",
+		outpostARN:          outpostARN,
+		subnetID:            subnetID,
+		useCustomNetworking: true,
+		useSubnetDiscovery:  true,
+	}
+
+	// The ENIConfig of the zone names a regional subnet, which the ENIs of the instance can not be in
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), &ec2.DescribeSubnetsInput{SubnetIds: aws.StringSlice([]string{"subnet-regional"})}).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{testSubnet("subnet-regional", "us-west-2a", "", 100, true)}}, nil)
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{
+			testSubnet("subnet-regional", "us-west-2a", "", 100, true),
+			testSubnet(subnetID, "us-west-2a", outpostARN, 50, true),
+			testSubnet("subnet-outpost-untagged", "us-west-2a", outpostARN, 40, false),
+			testSubnet("subnet-outpost-pods", "us-west-2a", outpostARN, 30, true),
+		}}, nil).Times(2)
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *ec2.CreateNetworkInterfaceInput, _ ...interface{}) (*ec2.CreateNetworkInterfaceOutput, error) {
+			assert.Equal(t, "subnet-outpost-pods", aws.StringValue(input.SubnetId))
+			assert.Equal(t, []string{"sg-pods"}, aws.StringValueSlice(input.Groups))
+			return &ec2.CreateNetworkInterfaceOutput{NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String(eniID)}}, nil
+		}).Times(2)
+
+	id, err := cache.createENI(true, aws.StringSlice([]string{"sg-pods"}), "subnet-regional", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, eniID, id)
+
+	// Without an ENIConfig, a discovered subnet is used as well. The placement of the ENIConfig subnet was cached.
+	id, err = cache.createENI(true, aws.StringSlice([]string{"sg-pods"}), "", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, eniID, id)
+}
+
+func TestCreateENICustomNetworkingColocatedENIConfig(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	cache := &EC2InstanceMetadataCache{
+		ec2SVC:              mockEC2,
+		instanceType:        "c5n.18xlarge",
+		availabilityZone:    "us-west-2-lax-1a",
+		subnetID:            subnetID,
+		useCustomNetworking: true,
+		useSubnetDiscovery:  true,
+	}
+
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{testSubnet("subnet-lax", "us-west-2-lax-1a", "", 100, false)}}, nil)
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(_ context.Context, input *ec2.CreateNetworkInterfaceInput, _ ...interface{}) (*ec2.CreateNetworkInterfaceOutput, error) {
+			assert.Equal(t, "subnet-lax", aws.StringValue(input.SubnetId))
+			return &ec2.CreateNetworkInterfaceOutput{NetworkInterface: &ec2.NetworkInterface{NetworkInterfaceId: aws.String(eniID)}}, nil
+		})
+
+	_, err := cache.createENI(true, nil, "subnet-lax", 5)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,102 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// primaryENIDeviceNumberEnvVar selects, by device number, the ENI that serves the pods as the primary ENI on nodes with
+// more than one uplink, e.g. when the interface at device number 0 faces an on-premises network. The ENI at device
+// number 0 is then left to the host and never managed. Defaults to 0.
+const primaryENIDeviceNumberEnvVar = "PRIMARY_ENI_DEVICE_NUMBER"
+
+func loadPrimaryENIDeviceNumber() int {
+	value := os.Getenv(primaryENIDeviceNumberEnvVar)
+	if value == "" {
+		return 0
+	}
+	deviceNumber, err := strconv.Atoi(value)
+	if err != nil || deviceNumber < 0 {
+		log.Errorf("Failed to parse %s %q, using the ENI at device number 0 as the primary ENI", primaryENIDeviceNumberEnvVar, value)
+		return 0
+	}
+	return deviceNumber
+}
+
+// selectPrimaryENI returns the MAC address of the ENI at the configured device number, and takes the primary IPv4
+// address of the node from it. The ENI at device number 0, uplinkMAC, is excluded from management.
+func (cache *EC2InstanceMetadataCache) selectPrimaryENI(ctx context.Context, uplinkMAC string) (string, error) {
+	if cache.v6Enabled {
+		// The pods of IPv6 clusters get their prefix from the ENI at device number 0, which the host routes through
+		log.Errorf("%s is not supported in IPv6 clusters, using the ENI at device number 0 as the primary ENI",
+			primaryENIDeviceNumberEnvVar)
+		return uplinkMAC, nil
+	}
+
+	macs, err := cache.imds.GetMACs(ctx)
+	if err != nil {
+		awsAPIErrInc("GetMACs", err)
+		return "", err
+	}
+	var primaryMAC string
+	for _, mac := range macs {
+		deviceNumber, err := cache.imds.GetDeviceNumber(ctx, mac)
+		if err != nil {
+			awsAPIErrInc("GetDeviceNumber", err)
+			return "", err
+		}
+		if deviceNumber != cache.primaryENIDeviceNumber {
+			continue
+		}
+		if primaryMAC != "" {
+			return "", errors.Errorf("%s: ENIs %s and %s both have device number %d", primaryENIDeviceNumberEnvVar,
+				primaryMAC, mac, deviceNumber)
+		}
+		primaryMAC = mac
+	}
+	if primaryMAC == "" {
+		return "", errors.Errorf("%s: no ENI is attached at device number %d", primaryENIDeviceNumberEnvVar,
+			cache.primaryENIDeviceNumber)
+	}
+
+	ips, err := cache.imds.GetLocalIPv4s(ctx, primaryMAC)
+	if err != nil {
+		awsAPIErrInc("GetLocalIPv4s", err)
+		return "", err
+	}
+	if len(ips) == 0 {
+		return "", errors.Errorf("%s: ENI %s has no IPv4 address", primaryENIDeviceNumberEnvVar, primaryMAC)
+	}
+	cache.localIPv4 = ips[0]
+
+	uplinkENI, err := cache.imds.GetInterfaceID(ctx, uplinkMAC)
+	if err != nil {
+		awsAPIErrInc("GetInterfaceID", err)
+		return "", err
+	}
+	if cache.excludedENIs == nil {
+		cache.excludedENIs = interfaceSet{}
+	}
+	cache.excludedENIs[strings.ToLower(uplinkENI)] = true
+	cache.excludedENIs[strings.ToLower(uplinkMAC)] = true
+	log.Infof("Using the ENI at device number %d, MAC %s and IP %s, as the primary ENI, leaving %s to the host",
+		cache.primaryENIDeviceNumber, primaryMAC, cache.localIPv4, uplinkENI)
+	return primaryMAC, nil
+}
@@ -0,0 +1,70 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadPrimaryENIDeviceNumber(t *testing.T) {
+	assert.Equal(t, 0, loadPrimaryENIDeviceNumber())
+	t.Setenv(primaryENIDeviceNumberEnvVar, "1")
+	assert.Equal(t, 1, loadPrimaryENIDeviceNumber())
+	t.Setenv(primaryENIDeviceNumberEnvVar, "-1")
+	assert.Equal(t, 0, loadPrimaryENIDeviceNumber())
+	t.Setenv(primaryENIDeviceNumberEnvVar, "eth1")
+	assert.Equal(t, 0, loadPrimaryENIDeviceNumber())
+}
+
+func TestInitWithEC2metadataPrimaryENIDeviceNumber(t *testing.T) {
+	ctx := context.Background()
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	mockMetadata := testMetadata(map[string]interface{}{
+		metadataMACPath: primaryMAC + " " + eni2MAC,
+		metadataMACPath + eni2MAC + metadataDeviceNum: eni2Device,
+		metadataMACPath + eni2MAC + metadataInterface: eni2ID,
+		metadataMACPath + eni2MAC + metadataIPv4s:     eni2PrivateIP,
+		metadataMACPath + eni2MAC + metadataSubnetID:  "subnet-pods",
+		metadataMACPath + eni2MAC + metadataVpcID:     vpcID,
+	})
+
+	cache := &EC2InstanceMetadataCache{imds: TypedIMDS{mockMetadata}, ec2SVC: mockEC2, v4Enabled: true,
+		primaryENIDeviceNumber: 1}
+	require.NoError(t, cache.initWithEC2Metadata(ctx))
+	assert.Equal(t, eni2MAC, cache.primaryENImac)
+	assert.Equal(t, eni2ID, cache.primaryENI)
+	assert.Equal(t, eni2PrivateIP, cache.localIPv4.String())
+	assert.Equal(t, "subnet-pods", cache.subnetID)
+	// The ENI at device number 0 is left to the host
+	assert.True(t, cache.excludedENIs.has(primaryeniID, ""))
+	assert.True(t, cache.excludedENIs.has("", primaryMAC))
+	assert.False(t, cache.excludedENIs.has(eni2ID, eni2MAC))
+
+	// There is no ENI at the device number
+	cache = &EC2InstanceMetadataCache{imds: TypedIMDS{mockMetadata}, ec2SVC: mockEC2, v4Enabled: true,
+		primaryENIDeviceNumber: 2}
+	assert.Error(t, cache.initWithEC2Metadata(ctx))
+
+	// IPv6 clusters keep the ENI at device number 0
+	cache = &EC2InstanceMetadataCache{imds: TypedIMDS{mockMetadata}, ec2SVC: mockEC2, v6Enabled: true,
+		primaryENIDeviceNumber: 1}
+	require.NoError(t, cache.initWithEC2Metadata(ctx))
+	assert.Equal(t, primaryMAC, cache.primaryENImac)
+	assert.Empty(t, cache.excludedENIs)
+}
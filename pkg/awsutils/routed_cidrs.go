@@ -0,0 +1,103 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// Route targets whose private destinations can be excluded from SNAT, by the prefix of their resource ID
+const (
+	RouteTargetTransitGateway        = "tgw"
+	RouteTargetVPCPeering            = "pcx"
+	RouteTargetVirtualPrivateGateway = "vgw"
+)
+
+var rfc1918Blocks = []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16"}
+
+// GetRoutedPrivateIPv4CIDRs returns the RFC1918 destinations that the route table of the subnet of the primary ENI
+// sends to one of the given route targets. These networks are reached without going through a NAT, so they see the
+// source IP of the pods unless the node translates it.
+func (cache *EC2InstanceMetadataCache) GetRoutedPrivateIPv4CIDRs(ctx context.Context, targets []string) ([]string, error) {
+	routeTable, err := cache.describeSubnetRouteTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var private []*net.IPNet
+	for _, block := range rfc1918Blocks {
+		_, ipNet, _ := net.ParseCIDR(block)
+		private = append(private, ipNet)
+	}
+
+	seen := make(map[string]struct{})
+	var cidrs []string
+	for _, route := range routeTable.Routes {
+		if aws.StringValue(route.State) != ec2.RouteStateActive || !routesToTarget(route, targets) {
+			continue
+		}
+		_, dst, err := net.ParseCIDR(aws.StringValue(route.DestinationCidrBlock))
+		if err != nil {
+			continue
+		}
+		if !containedInAny(dst, private) {
+			log.Debugf("Ignoring route to %s, it is not an RFC1918 destination", dst)
+			continue
+		}
+		if _, ok := seen[dst.String()]; !ok {
+			seen[dst.String()] = struct{}{}
+			cidrs = append(cidrs, dst.String())
+		}
+	}
+	sort.Strings(cidrs)
+	return cidrs, nil
+}
+
+// routesToTarget tells whether the target of the route is of one of the given types
+func routesToTarget(route *ec2.Route, targets []string) bool {
+	var targetID string
+	switch {
+	case route.TransitGatewayId != nil:
+		targetID = aws.StringValue(route.TransitGatewayId)
+	case route.VpcPeeringConnectionId != nil:
+		targetID = aws.StringValue(route.VpcPeeringConnectionId)
+	case route.GatewayId != nil:
+		targetID = aws.StringValue(route.GatewayId)
+	default:
+		return false
+	}
+	for _, target := range targets {
+		if strings.HasPrefix(targetID, target+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func containedInAny(cidr *net.IPNet, blocks []*net.IPNet) bool {
+	ones, _ := cidr.Mask.Size()
+	for _, block := range blocks {
+		blockOnes, _ := block.Mask.Size()
+		if block.Contains(cidr.IP) && ones >= blockOnes {
+			return true
+		}
+	}
+	return false
+}
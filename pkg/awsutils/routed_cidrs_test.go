@@ -0,0 +1,70 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetRoutedPrivateIPv4CIDRs(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+	ctx := context.Background()
+	cache := &EC2InstanceMetadataCache{ec2SVC: mockEC2, subnetID: subnetID, vpcID: "vpc-1"}
+
+	route := func(dst string, target *ec2.Route, state string) *ec2.Route {
+		target.DestinationCidrBlock = aws.String(dst)
+		target.State = aws.String(state)
+		return target
+	}
+	routes := []*ec2.Route{
+		route("10.0.0.0/16", &ec2.Route{GatewayId: aws.String("local")}, ec2.RouteStateActive),
+		route("10.1.0.0/16", &ec2.Route{TransitGatewayId: aws.String("tgw-1")}, ec2.RouteStateActive),
+		route("192.168.0.0/16", &ec2.Route{TransitGatewayId: aws.String("tgw-1")}, ec2.RouteStateActive),
+		route("172.16.0.0/12", &ec2.Route{VpcPeeringConnectionId: aws.String("pcx-1")}, ec2.RouteStateActive),
+		route("172.31.0.0/16", &ec2.Route{VpcPeeringConnectionId: aws.String("pcx-2")}, ec2.RouteStateBlackhole),
+		route("10.2.0.0/16", &ec2.Route{GatewayId: aws.String("vgw-1")}, ec2.RouteStateActive),
+		// Public and default routes through a transit gateway still need SNAT
+		route("0.0.0.0/0", &ec2.Route{TransitGatewayId: aws.String("tgw-1")}, ec2.RouteStateActive),
+		route("100.64.0.0/10", &ec2.Route{TransitGatewayId: aws.String("tgw-1")}, ec2.RouteStateActive),
+		route("8.0.0.0/7", &ec2.Route{TransitGatewayId: aws.String("tgw-1")}, ec2.RouteStateActive),
+		{DestinationIpv6CidrBlock: aws.String("fd00::/8"), TransitGatewayId: aws.String("tgw-1"), State: aws.String(ec2.RouteStateActive)},
+	}
+	describeRouteTable := func() {
+		mockEC2.EXPECT().DescribeRouteTablesWithContext(ctx, gomock.Any()).Return(&ec2.DescribeRouteTablesOutput{
+			RouteTables: []*ec2.RouteTable{{RouteTableId: aws.String("rtb-1"), Routes: routes}},
+		}, nil)
+	}
+
+	describeRouteTable()
+	cidrs, err := cache.GetRoutedPrivateIPv4CIDRs(ctx, []string{RouteTargetTransitGateway, RouteTargetVPCPeering})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.1.0.0/16", "172.16.0.0/12", "192.168.0.0/16"}, cidrs)
+
+	describeRouteTable()
+	cidrs, err = cache.GetRoutedPrivateIPv4CIDRs(ctx, []string{RouteTargetVirtualPrivateGateway})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"10.2.0.0/16"}, cidrs)
+
+	mockEC2.EXPECT().DescribeRouteTablesWithContext(ctx, gomock.Any()).Return(nil, errors.New("UnauthorizedOperation"))
+	_, err = cache.GetRoutedPrivateIPv4CIDRs(ctx, []string{RouteTargetTransitGateway})
+	assert.Error(t, err)
+}
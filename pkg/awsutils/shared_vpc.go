@@ -0,0 +1,74 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+)
+
+// recordSubnetOwners keeps the accounts that own the subnets returned by DescribeSubnets. In a shared VPC, the subnets
+// are owned by the account of the VPC, and the instances and ENIs of the participants by their own accounts.
+func (cache *EC2InstanceMetadataCache) recordSubnetOwners(subnets []*ec2.Subnet) {
+	if cache.subnetOwners == nil {
+		cache.subnetOwners = map[string]string{}
+	}
+	for _, subnet := range subnets {
+		if ownerID := aws.StringValue(subnet.OwnerId); ownerID != "" {
+			cache.subnetOwners[aws.StringValue(subnet.SubnetId)] = ownerID
+		}
+	}
+}
+
+// accountID returns the account of the instance, which owns its primary ENI and the ENIs ipamd creates
+func (cache *EC2InstanceMetadataCache) accountID(ctx context.Context) string {
+	if cache.account == "" && cache.primaryENImac != "" {
+		account, err := cache.imds.GetOwnerID(ctx, cache.primaryENImac)
+		if err != nil {
+			log.Debugf("Failed to find the account of the instance: %v", err)
+			return ""
+		}
+		cache.account = account
+	}
+	return cache.account
+}
+
+// sharedSubnetError explains the failure to create an ENI in a subnet that the account of the instance does not own,
+// or that it can not see at all. The participants of a shared VPC can only create ENIs in the subnets that the owner of
+// the VPC shares with them through AWS RAM, and their IAM policy has to allow ec2:CreateNetworkInterface on subnets of
+// another account.
+func (cache *EC2InstanceMetadataCache) sharedSubnetError(err error, subnetID string) error {
+	var aerr awserr.Error
+	if !errors.As(err, &aerr) {
+		return err
+	}
+	switch aerr.Code() {
+	case "InvalidSubnetID.NotFound":
+		return errors.Wrapf(err, "subnet %s is not visible to the account of the instance, a subnet of a shared VPC "+
+			"must be shared with the account through AWS RAM", subnetID)
+	case "UnauthorizedOperation":
+		ownerID := cache.subnetOwners[subnetID]
+		account := cache.accountID(context.Background())
+		if ownerID == "" || account == "" || ownerID == account {
+			return err
+		}
+		return errors.Wrapf(err, "subnet %s is owned by account %s, the IAM policy of account %s must allow "+
+			"ec2:CreateNetworkInterface on the subnets of the shared VPC", subnetID, ownerID, account)
+	}
+	return err
+}
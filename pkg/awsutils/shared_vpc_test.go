@@ -0,0 +1,81 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	participantAccount = "111122223333"
+	vpcOwnerAccount    = "444455556666"
+)
+
+func TestCreateENIInSharedSubnet(t *testing.T) {
+	ctrl, mockEC2 := setup(t)
+	defer ctrl.Finish()
+
+	cache := &EC2InstanceMetadataCache{
+		ec2SVC:             mockEC2,
+		imds:               TypedIMDS{testMetadata(map[string]interface{}{metadataMACPath + primaryMAC + "/owner-id": participantAccount})},
+		instanceType:       "c5n.18xlarge",
+		availabilityZone:   "us-west-2a",
+		subnetID:           subnetID,
+		primaryENImac:      primaryMAC,
+		useSubnetDiscovery: true,
+	}
+	sharedSubnet := testSubnet("subnet-shared", "us-west-2a", "", 100, true)
+	sharedSubnet.OwnerId = aws.String(vpcOwnerAccount)
+	mockEC2.EXPECT().DescribeSubnetsWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(&ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{sharedSubnet}}, nil)
+	mockEC2.EXPECT().CreateNetworkInterfaceWithContext(gomock.Any(), gomock.Any(), gomock.Any()).
+		Return(nil, awserr.New("UnauthorizedOperation", "You are not authorized to perform this operation.", nil))
+
+	_, err := cache.createENI(false, nil, "", 5)
+	assert.ErrorContains(t, err, "subnet subnet-shared is owned by account 444455556666, the IAM policy of account 111122223333")
+	var aerr awserr.Error
+	assert.True(t, errors.As(err, &aerr))
+}
+
+func TestSharedSubnetError(t *testing.T) {
+	cache := &EC2InstanceMetadataCache{
+		imds:          TypedIMDS{testMetadata(map[string]interface{}{metadataMACPath + primaryMAC + "/owner-id": participantAccount})},
+		primaryENImac: primaryMAC,
+	}
+	cache.recordSubnetOwners([]*ec2.Subnet{
+		{SubnetId: aws.String("subnet-shared"), OwnerId: aws.String(vpcOwnerAccount)},
+		{SubnetId: aws.String(subnetID), OwnerId: aws.String(participantAccount)},
+	})
+	assert.Equal(t, participantAccount, cache.accountID(context.Background()))
+
+	// The subnet is not shared with the account
+	err := cache.sharedSubnetError(awserr.New("InvalidSubnetID.NotFound", "The subnet ID 'subnet-other' does not exist", nil), "subnet-other")
+	assert.ErrorContains(t, err, "must be shared with the account through AWS RAM")
+
+	// The subnets of the account need no hint
+	unauthorized := awserr.New("UnauthorizedOperation", "You are not authorized to perform this operation.", nil)
+	assert.Equal(t, unauthorized, cache.sharedSubnetError(unauthorized, subnetID))
+	assert.ErrorContains(t, cache.sharedSubnetError(unauthorized, "subnet-shared"), "owned by account 444455556666")
+
+	subnetFull := awserr.New("InsufficientFreeAddressesInSubnet", "", nil)
+	assert.Equal(t, subnetFull, cache.sharedSubnetError(subnetFull, "subnet-shared"))
+}
@@ -0,0 +1,49 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Target lifecycle states of an Auto Scaling group instance that take the instance away from the cluster. Instances
+// moving to Warmed:Running keep running, and are not included.
+var leavingLifecycleStates = map[string]bool{
+	"Terminated":        true,
+	"Warmed:Stopped":    true,
+	"Warmed:Hibernated": true,
+}
+
+// GetTerminationNotice returns why the instance is going away, from the Spot interruption notice or the target
+// lifecycle state of its Auto Scaling group, or an empty string when it is not.
+func (cache *EC2InstanceMetadataCache) GetTerminationNotice(ctx context.Context) (string, error) {
+	action, err := cache.imds.GetSpotInstanceAction(ctx)
+	if err != nil {
+		return "", err
+	}
+	if action != nil {
+		return fmt.Sprintf("spot interruption: %s at %s", action.Action, action.Time.Format(time.RFC3339)), nil
+	}
+
+	state, err := cache.imds.GetTargetLifecycleState(ctx)
+	if err != nil {
+		return "", err
+	}
+	if leavingLifecycleStates[state] {
+		return fmt.Sprintf("auto scaling target lifecycle state %s", state), nil
+	}
+	return "", nil
+}
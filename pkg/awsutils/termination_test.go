@@ -0,0 +1,68 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package awsutils
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetTerminationNotice(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		metadata map[string]interface{}
+		notice   string
+	}{
+		{
+			name:     "no notice",
+			metadata: map[string]interface{}{},
+		},
+		{
+			name: "spot interruption",
+			metadata: map[string]interface{}{
+				"spot/instance-action": `{"action": "stop", "time": "2017-09-18T08:22:00Z"}`,
+			},
+			notice: "spot interruption: stop at 2017-09-18T08:22:00Z",
+		},
+		{
+			name: "scale in",
+			metadata: map[string]interface{}{
+				"autoscaling/target-lifecycle-state": "Terminated",
+			},
+			notice: "auto scaling target lifecycle state Terminated",
+		},
+		{
+			name: "in service",
+			metadata: map[string]interface{}{
+				"autoscaling/target-lifecycle-state": "InService",
+			},
+		},
+		{
+			name: "warm pool",
+			metadata: map[string]interface{}{
+				"autoscaling/target-lifecycle-state": "Warmed:Running",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cache := &EC2InstanceMetadataCache{imds: TypedIMDS{FakeIMDS(tc.metadata)}}
+			notice, err := cache.GetTerminationNotice(context.TODO())
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.notice, notice)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package configoperator
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/prometheus/common/expfmt"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// metricsPort is the port of the prometheus metrics of ipamd
+const metricsPort = 61678
+
+// Counters of ipamd that are summed up to decide whether a rollout is paused
+var errorMetrics = []string{
+	"awscni_ipamd_error_count",
+	"awscni_aws_api_error_count",
+}
+
+// PodProxyErrorCounter reads the error metrics of aws-node pods through the pod proxy of the API server, like
+// cni-metrics-helper
+type PodProxyErrorCounter struct {
+	Clientset kubernetes.Interface
+}
+
+// CountErrors sums the error counters of ipamd in the pod
+func (c *PodProxyErrorCounter) CountErrors(ctx context.Context, pod *corev1.Pod) (float64, error) {
+	rawOutput, err := c.Clientset.CoreV1().RESTClient().Get().
+		Namespace(pod.Namespace).
+		Resource("pods").
+		SubResource("proxy").
+		Name(fmt.Sprintf("%v:%v", pod.Name, metricsPort)).
+		Suffix("metrics").
+		Do(ctx).Raw()
+	if err != nil {
+		return 0, err
+	}
+	return sumErrorMetrics(rawOutput)
+}
+
+func sumErrorMetrics(rawOutput []byte) (float64, error) {
+	parser := &expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(rawOutput))
+	if err != nil {
+		return 0, err
+	}
+	var total float64
+	for _, name := range errorMetrics {
+		family, ok := families[name]
+		if !ok {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			total += metric.GetCounter().GetValue()
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,512 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package configoperator rolls out the CNIConfig onto the aws-node DaemonSet, one nodegroup after the other
+package configoperator
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+)
+
+const (
+	// ConfigHashAnnotation is set on the pod template of aws-node to the hash of the configuration it carries, along
+	// with the rest of the pod template
+	ConfigHashAnnotation = "vpc.amazonaws.com/cni-config-hash"
+	// OriginalEnvAnnotation is set on the aws-node DaemonSet to the variables the operator set, with the values they
+	// had before, so that they can be restored once they are removed from the configuration
+	OriginalEnvAnnotation = "vpc.amazonaws.com/cni-config-original-env"
+
+	awsNodeContainerName = "aws-node"
+	conflistTemplateKey  = "10-aws.conflist"
+	conflistTemplatePath = "/app/10-aws.conflist"
+	conflistVolumeName   = "cni-config-conflist-template"
+
+	defaultNodeGroupLabel = "eks.amazonaws.com/nodegroup"
+	defaultMaxUnavailable = 1
+	defaultSoakTime       = 5 * time.Minute
+	defaultMaxErrors      = 10
+
+	// requeueInterval is how often restarted aws-node pods are checked for readiness
+	requeueInterval = 10 * time.Second
+)
+
+var log = logger.GetComponent("configoperator")
+
+// ErrorCounter returns the number of errors an aws-node pod reported since it started
+type ErrorCounter interface {
+	CountErrors(ctx context.Context, pod *corev1.Pod) (float64, error)
+}
+
+// Reconciler applies the CNIConfig to the aws-node DaemonSet, and restarts the aws-node pods nodegroup by nodegroup.
+// The DaemonSet is switched to the OnDelete update strategy, so that only the operator restarts pods. Since the hash
+// of the rollout covers the pod template, the changes made to the DaemonSet by others are rolled out the same way.
+type Reconciler struct {
+	Client       client.Client
+	ErrorCounter ErrorCounter
+	// Namespace and DaemonSetName locate the aws-node DaemonSet
+	Namespace     string
+	DaemonSetName string
+}
+
+// SetupWithManager registers the reconciler for the CNIConfig and the aws-node DaemonSet with the manager
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	toConfig := handler.EnqueueRequestsFromMapFunc(func(_ context.Context, obj client.Object) []reconcile.Request {
+		if obj.GetNamespace() != r.Namespace || obj.GetName() != r.DaemonSetName {
+			return nil
+		}
+		return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: v1alpha1.CNIConfigName}}}
+	})
+	return ctrl.NewControllerManagedBy(mgr).
+		// The status written by the reconciler does not need another pass
+		For(&v1alpha1.CNIConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// Re-apply the configuration when the DaemonSet is changed by someone else
+		Watches(&appsv1.DaemonSet{}, toConfig).
+		Complete(r)
+}
+
+// Reconcile applies the configuration to the DaemonSet, then moves its rollout forward
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if req.Name != v1alpha1.CNIConfigName {
+		return ctrl.Result{}, nil
+	}
+	var cfg v1alpha1.CNIConfig
+	if err := r.Client.Get(ctx, req.NamespacedName, &cfg); err != nil {
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+	var ds appsv1.DaemonSet
+	if err := r.Client.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: r.DaemonSetName}, &ds); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to get DaemonSet %s/%s", r.Namespace, r.DaemonSetName)
+	}
+
+	original := cfg.Status.DeepCopy()
+	hash, err := r.applyConfig(ctx, &cfg, &ds)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if cfg.Status.ConfigHash != hash {
+		log.Infof("Rolling out configuration %s to DaemonSet %s/%s", hash, r.Namespace, r.DaemonSetName)
+		cfg.Status = v1alpha1.CNIConfigStatus{ConfigHash: hash, Phase: v1alpha1.CNIConfigPhaseProgressing}
+	}
+
+	result, err := r.rollout(ctx, &cfg, &ds, hash)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if equality.Semantic.DeepEqual(original, &cfg.Status) {
+		return result, nil
+	}
+	if err := r.Client.Status().Update(ctx, &cfg); err != nil {
+		return ctrl.Result{}, errors.Wrap(err, "failed to update the CNIConfig status")
+	}
+	return result, nil
+}
+
+// configHash identifies the part of the configuration that is set on the aws-node pods, and the pod template of the
+// DaemonSet without ConfigHashAnnotation
+func configHash(spec *v1alpha1.CNIConfigSpec, template *corev1.PodTemplateSpec) (string, error) {
+	template = template.DeepCopy()
+	delete(template.Annotations, ConfigHashAnnotation)
+	data, err := json.Marshal(struct {
+		Env               map[string]string
+		ConflistTemplate  string
+		WarmPoolOverrides []v1alpha1.WarmPoolOverride
+		// Omitted when empty, so that the hash of the configurations without sysctl policies does not change
+		SysctlPolicies []v1alpha1.SysctlPolicy `json:",omitempty"`
+		Template       *corev1.PodTemplateSpec
+	}{spec.Env, spec.ConflistTemplate, spec.WarmPoolOverrides, spec.SysctlPolicies, template})
+	if err != nil {
+		return "", errors.Wrap(err, "failed to hash the configuration")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:10], nil
+}
+
+// applyConfig updates the pod template of the DaemonSet, and the ConfigMap holding the conflist template. It returns
+// the hash of the configuration.
+func (r *Reconciler) applyConfig(ctx context.Context, cfg *v1alpha1.CNIConfig, ds *appsv1.DaemonSet) (string, error) {
+	configMapName := ds.Name + "-conflist-template"
+	if cfg.Spec.ConflistTemplate != "" {
+		if err := r.applyConflistConfigMap(ctx, configMapName, cfg.Spec.ConflistTemplate); err != nil {
+			return "", err
+		}
+	}
+
+	updated := ds.DeepCopy()
+	updated.Spec.UpdateStrategy = appsv1.DaemonSetUpdateStrategy{Type: appsv1.OnDeleteDaemonSetStrategyType}
+	podSpec := &updated.Spec.Template.Spec
+
+	var container *corev1.Container
+	for i := range podSpec.Containers {
+		if podSpec.Containers[i].Name == awsNodeContainerName {
+			container = &podSpec.Containers[i]
+		}
+	}
+	if container == nil {
+		return "", errors.Errorf("DaemonSet %s/%s has no %s container", ds.Namespace, ds.Name, awsNodeContainerName)
+	}
+	originalEnv := map[string]*corev1.EnvVar{}
+	if value := ds.Annotations[OriginalEnvAnnotation]; value != "" {
+		if err := json.Unmarshal([]byte(value), &originalEnv); err != nil {
+			log.Warnf("Ignoring the invalid %s annotation of DaemonSet %s/%s: %v", OriginalEnvAnnotation, ds.Namespace, ds.Name, err)
+			originalEnv = map[string]*corev1.EnvVar{}
+		}
+	}
+	setEnv(container, cfg.Spec.Env, originalEnv)
+	if len(originalEnv) > 0 {
+		data, err := json.Marshal(originalEnv)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to marshal the original variables")
+		}
+		if updated.Annotations == nil {
+			updated.Annotations = map[string]string{}
+		}
+		updated.Annotations[OriginalEnvAnnotation] = string(data)
+	} else {
+		delete(updated.Annotations, OriginalEnvAnnotation)
+	}
+
+	podSpec.Volumes = removeVolume(podSpec.Volumes, conflistVolumeName)
+	container.VolumeMounts = removeVolumeMount(container.VolumeMounts, conflistVolumeName)
+	if cfg.Spec.ConflistTemplate != "" {
+		podSpec.Volumes = append(podSpec.Volumes, corev1.Volume{
+			Name: conflistVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: configMapName}},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      conflistVolumeName,
+			MountPath: conflistTemplatePath,
+			SubPath:   conflistTemplateKey,
+			ReadOnly:  true,
+		})
+	}
+
+	hash, err := configHash(&cfg.Spec, &updated.Spec.Template)
+	if err != nil {
+		return "", err
+	}
+	if updated.Spec.Template.Annotations == nil {
+		updated.Spec.Template.Annotations = map[string]string{}
+	}
+	updated.Spec.Template.Annotations[ConfigHashAnnotation] = hash
+
+	if equality.Semantic.DeepEqual(ds.Spec, updated.Spec) && equality.Semantic.DeepEqual(ds.Annotations, updated.Annotations) {
+		return hash, nil
+	}
+	log.Infof("Updating DaemonSet %s/%s with configuration %s", ds.Namespace, ds.Name, hash)
+	if err := r.Client.Update(ctx, updated); err != nil {
+		return "", errors.Wrapf(err, "failed to update DaemonSet %s/%s", ds.Namespace, ds.Name)
+	}
+	*ds = *updated
+	return hash, nil
+}
+
+func (r *Reconciler) applyConflistConfigMap(ctx context.Context, name, template string) error {
+	var cm corev1.ConfigMap
+	err := r.Client.Get(ctx, types.NamespacedName{Namespace: r.Namespace, Name: name}, &cm)
+	if apierrors.IsNotFound(err) {
+		cm = corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: r.Namespace, Name: name},
+			Data:       map[string]string{conflistTemplateKey: template},
+		}
+		return errors.Wrapf(r.Client.Create(ctx, &cm), "failed to create ConfigMap %s/%s", r.Namespace, name)
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to get ConfigMap %s/%s", r.Namespace, name)
+	}
+	if cm.Data[conflistTemplateKey] == template {
+		return nil
+	}
+	cm.Data = map[string]string{conflistTemplateKey: template}
+	return errors.Wrapf(r.Client.Update(ctx, &cm), "failed to update ConfigMap %s/%s", r.Namespace, name)
+}
+
+// setEnv sets the variables on the container, in a stable order. originalEnv holds the variables set by the
+// operator, with their value before, nil when they were not set. The variables that are no longer in env get their
+// original value back, and originalEnv is updated with the variables set now.
+func setEnv(container *corev1.Container, env map[string]string, originalEnv map[string]*corev1.EnvVar) {
+	removed := make([]string, 0, len(originalEnv))
+	for name := range originalEnv {
+		if _, ok := env[name]; !ok {
+			removed = append(removed, name)
+		}
+	}
+	sort.Strings(removed)
+	for _, name := range removed {
+		container.Env = removeEnv(container.Env, name)
+		if original := originalEnv[name]; original != nil {
+			container.Env = append(container.Env, *original)
+		}
+		delete(originalEnv, name)
+	}
+
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		found := false
+		for i := range container.Env {
+			if container.Env[i].Name == name {
+				if _, ok := originalEnv[name]; !ok {
+					original := container.Env[i]
+					originalEnv[name] = &original
+				}
+				container.Env[i] = corev1.EnvVar{Name: name, Value: env[name]}
+				found = true
+			}
+		}
+		if !found {
+			if _, ok := originalEnv[name]; !ok {
+				originalEnv[name] = nil
+			}
+			container.Env = append(container.Env, corev1.EnvVar{Name: name, Value: env[name]})
+		}
+	}
+}
+
+func removeEnv(env []corev1.EnvVar, name string) []corev1.EnvVar {
+	var kept []corev1.EnvVar
+	for _, envVar := range env {
+		if envVar.Name != name {
+			kept = append(kept, envVar)
+		}
+	}
+	return kept
+}
+
+func removeVolume(volumes []corev1.Volume, name string) []corev1.Volume {
+	var kept []corev1.Volume
+	for _, volume := range volumes {
+		if volume.Name != name {
+			kept = append(kept, volume)
+		}
+	}
+	return kept
+}
+
+func removeVolumeMount(mounts []corev1.VolumeMount, name string) []corev1.VolumeMount {
+	var kept []corev1.VolumeMount
+	for _, mount := range mounts {
+		if mount.Name != name {
+			kept = append(kept, mount)
+		}
+	}
+	return kept
+}
+
+// rollout restarts the outdated aws-node pods of the first nodegroup that is not completed, then waits for the soak
+// time and checks the errors of its pods before moving to the next nodegroup
+func (r *Reconciler) rollout(ctx context.Context, cfg *v1alpha1.CNIConfig, ds *appsv1.DaemonSet, hash string) (ctrl.Result, error) {
+	groups, err := r.podsByNodeGroup(ctx, cfg, ds)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := &cfg.Status
+	rollout := &cfg.Spec.Rollout
+	completed := map[string]bool{}
+	for _, name := range status.CompletedNodeGroups {
+		completed[name] = true
+	}
+	for _, group := range names {
+		if completed[group] {
+			continue
+		}
+		if status.CurrentNodeGroup != group {
+			status.CurrentNodeGroup = group
+			status.SoakStartTime = nil
+		}
+
+		var outdated []*corev1.Pod
+		unavailable := 0
+		for _, pod := range groups[group] {
+			switch {
+			case pod.DeletionTimestamp != nil:
+				unavailable++
+			case pod.Annotations[ConfigHashAnnotation] != hash:
+				outdated = append(outdated, pod)
+			case !isPodReady(pod):
+				unavailable++
+			}
+		}
+
+		if len(outdated) > 0 {
+			if rollout.Paused {
+				status.Phase = v1alpha1.CNIConfigPhasePaused
+				if status.PausedNodeGroup == "" {
+					status.Message = "Paused, set spec.rollout.paused to false to resume"
+				}
+				return ctrl.Result{}, nil
+			}
+			status.Phase = v1alpha1.CNIConfigPhaseProgressing
+			status.Message = fmt.Sprintf("Restarting %d aws-node pods of nodegroup %q", len(outdated), group)
+			maxUnavailable := rollout.MaxUnavailable
+			if maxUnavailable <= 0 {
+				maxUnavailable = defaultMaxUnavailable
+			}
+			for i := 0; i < len(outdated) && unavailable < maxUnavailable; i++ {
+				log.Infof("Restarting aws-node pod %s on node %s", outdated[i].Name, outdated[i].Spec.NodeName)
+				if err := r.Client.Delete(ctx, outdated[i]); client.IgnoreNotFound(err) != nil {
+					return ctrl.Result{}, errors.Wrapf(err, "failed to delete pod %s", outdated[i].Name)
+				}
+				unavailable++
+			}
+			return ctrl.Result{RequeueAfter: requeueInterval}, nil
+		}
+		if unavailable > 0 {
+			status.Message = fmt.Sprintf("Waiting for %d aws-node pods of nodegroup %q to be ready", unavailable, group)
+			return ctrl.Result{RequeueAfter: requeueInterval}, nil
+		}
+
+		if status.SoakStartTime == nil {
+			now := metav1.Now()
+			status.SoakStartTime = &now
+		}
+		soakTime := defaultSoakTime
+		if rollout.SoakTime != nil {
+			soakTime = rollout.SoakTime.Duration
+		}
+		if remaining := soakTime - time.Since(status.SoakStartTime.Time); remaining > 0 {
+			status.Message = fmt.Sprintf("Observing nodegroup %q", group)
+			return ctrl.Result{RequeueAfter: remaining}, nil
+		}
+
+		if status.PausedNodeGroup != group || rollout.Paused {
+			errorCount, err := r.countErrors(ctx, groups[group])
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			maxErrors := defaultMaxErrors
+			if rollout.MaxErrors != nil {
+				maxErrors = *rollout.MaxErrors
+			}
+			if maxErrors >= 0 && errorCount > float64(maxErrors) {
+				if err := r.pause(ctx, cfg); err != nil {
+					return ctrl.Result{}, err
+				}
+				status.Phase = v1alpha1.CNIConfigPhasePaused
+				status.PausedNodeGroup = group
+				status.Message = fmt.Sprintf("Paused, the aws-node pods of nodegroup %q reported %.0f errors, more than %d. "+
+					"Set spec.rollout.paused to false to resume.", group, errorCount, maxErrors)
+				log.Warnf("Pausing the rollout of configuration %s: %s", hash, status.Message)
+				return ctrl.Result{}, nil
+			}
+		}
+
+		log.Infof("Nodegroup %q is updated to configuration %s", group, hash)
+		status.CompletedNodeGroups = append(status.CompletedNodeGroups, group)
+		status.CurrentNodeGroup = ""
+		status.SoakStartTime = nil
+		status.PausedNodeGroup = ""
+	}
+
+	status.Phase = v1alpha1.CNIConfigPhaseComplete
+	status.Message = fmt.Sprintf("All %d nodegroups are updated", len(names))
+	return ctrl.Result{}, nil
+}
+
+// podsByNodeGroup returns the aws-node pods, by the nodegroup label of their node
+func (r *Reconciler) podsByNodeGroup(ctx context.Context, cfg *v1alpha1.CNIConfig, ds *appsv1.DaemonSet) (map[string][]*corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(ds.Spec.Selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid selector of DaemonSet %s/%s", ds.Namespace, ds.Name)
+	}
+	var pods corev1.PodList
+	if err := r.Client.List(ctx, &pods, client.InNamespace(ds.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, errors.Wrap(err, "failed to list the aws-node pods")
+	}
+	var nodes corev1.NodeList
+	if err := r.Client.List(ctx, &nodes); err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	label := cfg.Spec.Rollout.NodeGroupLabel
+	if label == "" {
+		label = defaultNodeGroupLabel
+	}
+	nodeGroups := map[string]string{}
+	for _, node := range nodes.Items {
+		nodeGroups[node.Name] = node.Labels[label]
+	}
+	groups := map[string][]*corev1.Pod{}
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		group := nodeGroups[pod.Spec.NodeName]
+		groups[group] = append(groups[group], pod)
+	}
+	return groups, nil
+}
+
+func (r *Reconciler) countErrors(ctx context.Context, pods []*corev1.Pod) (float64, error) {
+	var total float64
+	for _, pod := range pods {
+		count, err := r.ErrorCounter.CountErrors(ctx, pod)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to get the error metrics of pod %s", pod.Name)
+		}
+		total += count
+	}
+	return total, nil
+}
+
+// pause sets spec.rollout.paused, so that the rollout only resumes once someone looked at the errors
+func (r *Reconciler) pause(ctx context.Context, cfg *v1alpha1.CNIConfig) error {
+	status := cfg.Status
+	patch := client.MergeFrom(cfg.DeepCopy())
+	cfg.Spec.Rollout.Paused = true
+	if err := r.Client.Patch(ctx, cfg, patch); err != nil {
+		return errors.Wrap(err, "failed to pause the rollout")
+	}
+	cfg.Status = status
+	return nil
+}
+
+func isPodReady(pod *corev1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == corev1.PodReady {
+			return condition.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
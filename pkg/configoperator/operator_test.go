@@ -0,0 +1,263 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package configoperator
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	testclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+)
+
+const namespace = "kube-system"
+
+var selector = map[string]string{"k8s-app": "aws-node"}
+
+type fakeErrorCounter map[string]float64
+
+func (f fakeErrorCounter) CountErrors(_ context.Context, pod *corev1.Pod) (float64, error) {
+	return f[pod.Spec.NodeName], nil
+}
+
+func setup(t *testing.T, cfg *v1alpha1.CNIConfig, objects ...client.Object) (*Reconciler, fakeErrorCounter) {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, appsv1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+
+	ds := &appsv1.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "aws-node"},
+		Spec: appsv1.DaemonSetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: selector},
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: selector},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name: "aws-node",
+					Env:  []corev1.EnvVar{{Name: "WARM_ENI_TARGET", Value: "1"}},
+				}}},
+			},
+		},
+	}
+	objects = append(objects, cfg, ds)
+	errorCounter := fakeErrorCounter{}
+	return &Reconciler{
+		Client:        testclient.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).WithStatusSubresource(cfg).Build(),
+		ErrorCounter:  errorCounter,
+		Namespace:     namespace,
+		DaemonSetName: "aws-node",
+	}, errorCounter
+}
+
+func node(name, nodeGroup string) *corev1.Node {
+	return &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{defaultNodeGroupLabel: nodeGroup}}}
+}
+
+func awsNodePod(nodeName, hash string) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:   namespace,
+			Name:        "aws-node-" + nodeName + hash,
+			Labels:      selector,
+			Annotations: map[string]string{ConfigHashAnnotation: hash},
+		},
+		Spec:   corev1.PodSpec{NodeName: nodeName},
+		Status: corev1.PodStatus{Conditions: []corev1.PodCondition{{Type: corev1.PodReady, Status: corev1.ConditionTrue}}},
+	}
+}
+
+func reconcileConfig(t *testing.T, r *Reconciler) (ctrl.Result, *v1alpha1.CNIConfig) {
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: v1alpha1.CNIConfigName}})
+	require.NoError(t, err)
+	var cfg v1alpha1.CNIConfig
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Name: v1alpha1.CNIConfigName}, &cfg))
+	return result, &cfg
+}
+
+func podExists(t *testing.T, r *Reconciler, pod *corev1.Pod) bool {
+	err := r.Client.Get(context.TODO(), client.ObjectKeyFromObject(pod), &corev1.Pod{})
+	if apierrors.IsNotFound(err) {
+		return false
+	}
+	require.NoError(t, err)
+	return true
+}
+
+// endSoak moves the start of the soak of the current nodegroup to the past
+func endSoak(t *testing.T, r *Reconciler, cfg *v1alpha1.CNIConfig) {
+	past := metav1.NewTime(time.Now().Add(-2 * defaultSoakTime))
+	cfg.Status.SoakStartTime = &past
+	require.NoError(t, r.Client.Status().Update(context.TODO(), cfg))
+}
+
+func TestApplyConfig(t *testing.T) {
+	r, _ := setup(t, &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec: v1alpha1.CNIConfigSpec{
+			Env:              map[string]string{"WARM_ENI_TARGET": "0", "WARM_IP_TARGET": "5"},
+			ConflistTemplate: `{"cniVersion": "0.4.0"}`,
+		},
+	})
+	_, cfg := reconcileConfig(t, r)
+
+	var ds appsv1.DaemonSet
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "aws-node"}, &ds))
+	assert.Equal(t, appsv1.OnDeleteDaemonSetStrategyType, ds.Spec.UpdateStrategy.Type)
+	assert.Equal(t, cfg.Status.ConfigHash, ds.Spec.Template.Annotations[ConfigHashAnnotation])
+	container := ds.Spec.Template.Spec.Containers[0]
+	assert.Equal(t, []corev1.EnvVar{{Name: "WARM_ENI_TARGET", Value: "0"}, {Name: "WARM_IP_TARGET", Value: "5"}}, container.Env)
+	assert.Equal(t, conflistTemplatePath, container.VolumeMounts[0].MountPath)
+	assert.Equal(t, "aws-node-conflist-template", ds.Spec.Template.Spec.Volumes[0].ConfigMap.Name)
+
+	var cm corev1.ConfigMap
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "aws-node-conflist-template"}, &cm))
+	assert.Equal(t, `{"cniVersion": "0.4.0"}`, cm.Data[conflistTemplateKey])
+
+	// Without a conflist template, the one of the image is used again
+	cfg.Spec.ConflistTemplate = ""
+	require.NoError(t, r.Client.Update(context.TODO(), cfg))
+	reconcileConfig(t, r)
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "aws-node"}, &ds))
+	assert.Empty(t, ds.Spec.Template.Spec.Volumes)
+	assert.Empty(t, ds.Spec.Template.Spec.Containers[0].VolumeMounts)
+}
+
+func TestRestoreRemovedEnv(t *testing.T) {
+	r, _ := setup(t, &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec:       v1alpha1.CNIConfigSpec{Env: map[string]string{"WARM_ENI_TARGET": "0", "WARM_IP_TARGET": "5"}},
+	})
+	_, cfg := reconcileConfig(t, r)
+
+	// WARM_ENI_TARGET gets the value of the DaemonSet back, WARM_IP_TARGET was not set on it
+	cfg.Spec.Env = nil
+	require.NoError(t, r.Client.Update(context.TODO(), cfg))
+	reconcileConfig(t, r)
+	var ds appsv1.DaemonSet
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "aws-node"}, &ds))
+	assert.Equal(t, []corev1.EnvVar{{Name: "WARM_ENI_TARGET", Value: "1"}}, ds.Spec.Template.Spec.Containers[0].Env)
+	assert.NotContains(t, ds.Annotations, OriginalEnvAnnotation)
+}
+
+func TestRolloutOnTemplateChange(t *testing.T) {
+	r, _ := setup(t, &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec:       v1alpha1.CNIConfigSpec{Env: map[string]string{"WARM_IP_TARGET": "5"}},
+	})
+	_, cfg := reconcileConfig(t, r)
+	hash := cfg.Status.ConfigHash
+
+	// Reconciling again does not change the hash
+	_, cfg = reconcileConfig(t, r)
+	assert.Equal(t, hash, cfg.Status.ConfigHash)
+
+	// A new image, as set by helm upgrade, is rolled out by the operator
+	var ds appsv1.DaemonSet
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "aws-node"}, &ds))
+	ds.Spec.Template.Spec.Containers[0].Image = "amazon-k8s-cni:v1.19.1"
+	require.NoError(t, r.Client.Update(context.TODO(), &ds))
+	_, cfg = reconcileConfig(t, r)
+	assert.NotEqual(t, hash, cfg.Status.ConfigHash)
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Namespace: namespace, Name: "aws-node"}, &ds))
+	assert.Equal(t, cfg.Status.ConfigHash, ds.Spec.Template.Annotations[ConfigHashAnnotation])
+}
+
+func TestRolloutByNodeGroup(t *testing.T) {
+	podA, podB := awsNodePod("node-a", "old"), awsNodePod("node-b", "old")
+	r, _ := setup(t, &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec:       v1alpha1.CNIConfigSpec{Env: map[string]string{"WARM_IP_TARGET": "5"}},
+	}, node("node-a", "group-a"), node("node-b", "group-b"), podA, podB)
+
+	// The first nodegroup is restarted
+	result, cfg := reconcileConfig(t, r)
+	assert.Equal(t, requeueInterval, result.RequeueAfter)
+	assert.Equal(t, v1alpha1.CNIConfigPhaseProgressing, cfg.Status.Phase)
+	assert.Equal(t, "group-a", cfg.Status.CurrentNodeGroup)
+	assert.False(t, podExists(t, r, podA))
+	assert.True(t, podExists(t, r, podB))
+
+	// The DaemonSet controller creates the updated pod, which is observed during the soak time
+	require.NoError(t, r.Client.Create(context.TODO(), awsNodePod("node-a", cfg.Status.ConfigHash)))
+	result, cfg = reconcileConfig(t, r)
+	assert.InDelta(t, defaultSoakTime, result.RequeueAfter, float64(time.Second))
+	assert.NotNil(t, cfg.Status.SoakStartTime)
+	assert.True(t, podExists(t, r, podB))
+
+	// Then the next nodegroup is restarted
+	endSoak(t, r, cfg)
+	_, cfg = reconcileConfig(t, r)
+	assert.Equal(t, []string{"group-a"}, cfg.Status.CompletedNodeGroups)
+	assert.Equal(t, "group-b", cfg.Status.CurrentNodeGroup)
+	assert.False(t, podExists(t, r, podB))
+
+	require.NoError(t, r.Client.Create(context.TODO(), awsNodePod("node-b", cfg.Status.ConfigHash)))
+	_, cfg = reconcileConfig(t, r)
+	endSoak(t, r, cfg)
+	_, cfg = reconcileConfig(t, r)
+	assert.Equal(t, v1alpha1.CNIConfigPhaseComplete, cfg.Status.Phase)
+	assert.Equal(t, []string{"group-a", "group-b"}, cfg.Status.CompletedNodeGroups)
+}
+
+func TestPauseOnErrors(t *testing.T) {
+	podB := awsNodePod("node-b", "old")
+	r, errorCounter := setup(t, &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec:       v1alpha1.CNIConfigSpec{Env: map[string]string{"WARM_IP_TARGET": "5"}},
+	}, node("node-a", "group-a"), node("node-b", "group-b"), awsNodePod("node-a", "old"), podB)
+	errorCounter["node-a"] = defaultMaxErrors + 1
+
+	_, cfg := reconcileConfig(t, r)
+	require.NoError(t, r.Client.Create(context.TODO(), awsNodePod("node-a", cfg.Status.ConfigHash)))
+	_, cfg = reconcileConfig(t, r)
+	endSoak(t, r, cfg)
+	_, cfg = reconcileConfig(t, r)
+	assert.Equal(t, v1alpha1.CNIConfigPhasePaused, cfg.Status.Phase)
+	assert.Equal(t, "group-a", cfg.Status.PausedNodeGroup)
+	assert.True(t, cfg.Spec.Rollout.Paused)
+	assert.True(t, podExists(t, r, podB))
+
+	// Resuming accepts the errors of the paused nodegroup
+	cfg.Spec.Rollout.Paused = false
+	require.NoError(t, r.Client.Update(context.TODO(), cfg))
+	_, cfg = reconcileConfig(t, r)
+	assert.Equal(t, v1alpha1.CNIConfigPhaseProgressing, cfg.Status.Phase)
+	assert.Equal(t, []string{"group-a"}, cfg.Status.CompletedNodeGroups)
+	assert.False(t, podExists(t, r, podB))
+}
+
+func TestSumErrorMetrics(t *testing.T) {
+	total, err := sumErrorMetrics([]byte(`# TYPE awscni_ipamd_error_count counter
+awscni_ipamd_error_count{error="nodeIPPoolReconcileBadIMDSData"} 2
+awscni_ipamd_error_count{error="increaseIPPoolAllocIPAddressesFailed"} 3
+# TYPE awscni_aws_api_error_count counter
+awscni_aws_api_error_count{api="AssignPrivateIpAddresses",error="InsufficientCidrBlocks"} 1
+# TYPE awscni_assigned_ip_addresses gauge
+awscni_assigned_ip_addresses 12
+`))
+	require.NoError(t, err)
+	assert.Equal(t, float64(6), total)
+}
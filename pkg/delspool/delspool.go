@@ -0,0 +1,136 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package delspool queues the IP releases of the CNI DELs that could not reach ipamd. The plugin tears the pod network
+// down on its own and writes the release to a spool directory on the host, so that the DEL succeeds and kubelet can
+// finish the teardown. ipamd drains the directory when it starts, before it serves requests, and releases the IPs.
+//
+// There is one file per sandbox, named after it, so that a retried DEL replaces its release rather than adding one.
+package delspool
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPath is the spool directory. /var/run/aws-node is shared by the aws-node containers and the host.
+const DefaultPath = "/var/run/aws-node/del-spool"
+
+const (
+	fileSuffix = ".json"
+	tmpPrefix  = ".tmp-"
+	// staleTmpAge is the age after which a file that was never renamed is left by a plugin that died
+	staleTmpAge = time.Minute
+)
+
+// Release is a DEL that did not reach ipamd, with the fields of the DelNetwork request
+type Release struct {
+	ContainerID   string    `json:"containerID"`
+	IfName        string    `json:"ifName"`
+	NetworkName   string    `json:"networkName"`
+	PodName       string    `json:"podName"`
+	PodNamespace  string    `json:"podNamespace"`
+	PodUID        string    `json:"podUID"`
+	ClientVersion string    `json:"clientVersion"`
+	SpooledAt     time.Time `json:"spooledAt"`
+}
+
+func (r Release) fileName() string {
+	sum := sha256.Sum256([]byte(r.NetworkName + "/" + r.ContainerID + "/" + r.IfName))
+	return hex.EncodeToString(sum[:16]) + fileSuffix
+}
+
+// Write spools a release in dir. The file is written next to its final name then renamed, so that ipamd never reads a
+// partial release.
+func Write(dir string, release Release) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "delspool: failed to create %s", dir)
+	}
+	data, err := json.Marshal(release)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, release.fileName())
+	tmp, err := os.CreateTemp(dir, tmpPrefix)
+	if err != nil {
+		return errors.Wrapf(err, "delspool: failed to create a file in %s", dir)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "delspool: failed to write %s", path)
+	}
+	return nil
+}
+
+// Drain calls release for each release spooled in dir, and removes those it handled. The releases that fail stay
+// spooled for the next drain, as do the files that cannot be read. It returns the number of releases handled and the
+// errors of the others.
+func Drain(dir string, release func(Release) error) (int, []error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, []error{errors.Wrapf(err, "delspool: failed to read %s", dir)}
+	}
+	drained := 0
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if strings.HasPrefix(entry.Name(), tmpPrefix) {
+			// Left by a plugin that died while writing, unless it is still being written
+			if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > staleTmpAge {
+				os.Remove(path)
+			}
+			continue
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, errors.Wrapf(err, "delspool: failed to read %s", path))
+			continue
+		}
+		var r Release
+		if err := json.Unmarshal(data, &r); err != nil {
+			// A release that cannot be parsed never will be, its IP is reclaimed by the reconciliation of ipamd
+			errs = append(errs, errors.Wrapf(err, "delspool: dropping invalid release %s", path))
+			os.Remove(path)
+			continue
+		}
+		if err := release(r); err != nil {
+			errs = append(errs, errors.Wrapf(err, "delspool: failed to release container %s", r.ContainerID))
+			continue
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, errors.Wrapf(err, "delspool: failed to remove %s", path))
+		}
+		drained++
+	}
+	return drained, errs
+}
@@ -0,0 +1,67 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package delspool
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAndDrain(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "del-spool")
+
+	// Nothing was spooled
+	drained, errs := Drain(dir, func(Release) error { return nil })
+	assert.Equal(t, 0, drained)
+	assert.Empty(t, errs)
+
+	pod1 := Release{ContainerID: "container1", IfName: "eth0", NetworkName: "aws-cni", PodName: "pod1", PodNamespace: "default"}
+	require.NoError(t, Write(dir, pod1))
+	// A retried DEL replaces its release
+	pod1.PodUID = "uid1"
+	require.NoError(t, Write(dir, pod1))
+	pod2 := Release{ContainerID: "container2", IfName: "eth0", NetworkName: "aws-cni", PodName: "pod2", PodNamespace: "default"}
+	require.NoError(t, Write(dir, pod2))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tmpPrefix+"stale"), nil, 0600))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, tmpPrefix+"stale"), time.Now().Add(-time.Hour), time.Now().Add(-time.Hour)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, tmpPrefix+"writing"), nil, 0600))
+
+	var released []Release
+	drained, errs = Drain(dir, func(r Release) error {
+		released = append(released, r)
+		if r.ContainerID == "container2" {
+			return errors.New("datastore not ready")
+		}
+		return nil
+	})
+	assert.Equal(t, 1, drained)
+	require.Len(t, errs, 2)
+	assert.ElementsMatch(t, []Release{pod1, pod2}, released)
+
+	// The failed release stays spooled, as does the file still being written
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.ElementsMatch(t, []string{pod2.fileName(), tmpPrefix + "writing"}, names)
+}
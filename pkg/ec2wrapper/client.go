@@ -37,6 +37,15 @@ type EC2 interface {
 	CreateTagsWithContext(ctx aws.Context, input *ec2svc.CreateTagsInput, opts ...request.Option) (*ec2svc.CreateTagsOutput, error)
 	DescribeNetworkInterfacesPagesWithContext(ctx aws.Context, input *ec2svc.DescribeNetworkInterfacesInput, fn func(*ec2svc.DescribeNetworkInterfacesOutput, bool) bool, opts ...request.Option) error
 	DescribeSubnetsWithContext(ctx aws.Context, input *ec2svc.DescribeSubnetsInput, opts ...request.Option) (*ec2svc.DescribeSubnetsOutput, error)
+	AllocateAddressWithContext(ctx aws.Context, input *ec2svc.AllocateAddressInput, opts ...request.Option) (*ec2svc.AllocateAddressOutput, error)
+	AssociateAddressWithContext(ctx aws.Context, input *ec2svc.AssociateAddressInput, opts ...request.Option) (*ec2svc.AssociateAddressOutput, error)
+	DisassociateAddressWithContext(ctx aws.Context, input *ec2svc.DisassociateAddressInput, opts ...request.Option) (*ec2svc.DisassociateAddressOutput, error)
+	ReleaseAddressWithContext(ctx aws.Context, input *ec2svc.ReleaseAddressInput, opts ...request.Option) (*ec2svc.ReleaseAddressOutput, error)
+	DescribeAddressesWithContext(ctx aws.Context, input *ec2svc.DescribeAddressesInput, opts ...request.Option) (*ec2svc.DescribeAddressesOutput, error)
+	DescribeRouteTablesWithContext(ctx aws.Context, input *ec2svc.DescribeRouteTablesInput, opts ...request.Option) (*ec2svc.DescribeRouteTablesOutput, error)
+	AllocateIpamPoolCidrWithContext(ctx aws.Context, input *ec2svc.AllocateIpamPoolCidrInput, opts ...request.Option) (*ec2svc.AllocateIpamPoolCidrOutput, error)
+	ReleaseIpamPoolAllocationWithContext(ctx aws.Context, input *ec2svc.ReleaseIpamPoolAllocationInput, opts ...request.Option) (*ec2svc.ReleaseIpamPoolAllocationOutput, error)
+	GetIpamPoolAllocationsPagesWithContext(ctx aws.Context, input *ec2svc.GetIpamPoolAllocationsInput, fn func(*ec2svc.GetIpamPoolAllocationsOutput, bool) bool, opts ...request.Option) error
 }
 
 // New creates a new EC2 wrapper
@@ -0,0 +1,244 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package enicleanup deletes the ENIs that ipamd created for an instance once its node is deleted
+package enicleanup
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+)
+
+const (
+	// FinalizerName was placed on nodes by earlier versions of the controller to hold back their deletion. It blocked
+	// the deletion of every node while the controller was down, so it is only removed now.
+	FinalizerName = "vpc.amazonaws.com/eni-cleanup"
+
+	// requeueInterval is how often ENIs that are still attached to a terminating instance are checked again
+	requeueInterval = 30 * time.Second
+
+	// maxCleanupTime bounds how long the ENIs of a deleted node are waited for. Past it, the remaining ENIs are left to
+	// the leaked ENI cleanup of ipamd.
+	maxCleanupTime = 15 * time.Minute
+)
+
+var log = logger.GetComponent("enicleanup")
+
+// Instance states in which the instance still exists, and can still use its ENIs
+var liveInstanceStates = map[string]bool{
+	ec2.InstanceStateNamePending:  true,
+	ec2.InstanceStateNameRunning:  true,
+	ec2.InstanceStateNameStopping: true,
+	ec2.InstanceStateNameStopped:  true,
+}
+
+// NodeReconciler watches the deletion of the nodes of EC2 instances, and deletes the ENIs ipamd created for their
+// instance. Nothing holds back the deletion of the nodes, the ENIs of nodes deleted while the controller is down are
+// left to the leaked ENI cleanup of ipamd.
+type NodeReconciler struct {
+	Client client.Client
+	EC2    ec2wrapper.EC2
+	// ClusterName restricts the cleanup to the ENIs tagged with the CLUSTER_NAME of ipamd, when set
+	ClusterName string
+
+	// cleanupStarted records when the cleanup of the ENIs of each instance started. Requests are reconciled one at a
+	// time, so it needs no lock.
+	cleanupStarted map[string]time.Time
+}
+
+// SetupWithManager registers the reconciler for the deletion of nodes with the manager. The requests it reconciles
+// are named after the instance of the deleted node.
+func (r *NodeReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.Add(manager.RunnableFunc(func(ctx context.Context) error {
+		return RemoveFinalizers(ctx, r.Client)
+	})); err != nil {
+		return err
+	}
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("eni-cleanup").
+		WithOptions(controller.Options{MaxConcurrentReconciles: 1}).
+		Watches(&corev1.Node{}, handler.Funcs{DeleteFunc: enqueueDeletedNode}).
+		Complete(r)
+}
+
+// enqueueDeletedNode queues the instance of a deleted node for the cleanup of its ENIs
+func enqueueDeletedNode(_ context.Context, e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	if instanceID := instanceIDFromProviderID(e.Object.(*corev1.Node).Spec.ProviderID); instanceID != "" {
+		q.Add(ctrl.Request{NamespacedName: types.NamespacedName{Name: instanceID}})
+	}
+}
+
+// RemoveFinalizers removes FinalizerName from the nodes, where earlier versions of the controller placed it
+func RemoveFinalizers(ctx context.Context, c client.Client) error {
+	var nodes corev1.NodeList
+	if err := c.List(ctx, &nodes); err != nil {
+		return errors.Wrap(err, "failed to list the nodes")
+	}
+	for i := range nodes.Items {
+		node := &nodes.Items[i]
+		if !controllerutil.ContainsFinalizer(node, FinalizerName) {
+			continue
+		}
+		patch := client.MergeFromWithOptions(node.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		controllerutil.RemoveFinalizer(node, FinalizerName)
+		if err := c.Patch(ctx, node, patch); client.IgnoreNotFound(err) != nil {
+			return errors.Wrapf(err, "failed to remove the finalizer of node %s", node.Name)
+		}
+		log.Infof("Removed the %s finalizer of node %s", FinalizerName, node.Name)
+	}
+	return nil
+}
+
+// Reconcile deletes the ENIs of the instance of a deleted node, the name of the request is the instance ID
+func (r *NodeReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	instanceID := req.Name
+	if r.cleanupStarted == nil {
+		r.cleanupStarted = make(map[string]time.Time)
+	}
+	started, ok := r.cleanupStarted[instanceID]
+	if !ok {
+		started = time.Now()
+		r.cleanupStarted[instanceID] = started
+	}
+
+	pending, err := r.deleteInstanceENIs(ctx, instanceID)
+	expired := time.Since(started) > maxCleanupTime
+	switch {
+	case err != nil && !expired:
+		return ctrl.Result{}, err
+	case err != nil:
+		log.Warnf("Giving up on the ENIs of instance %s: %v", instanceID, err)
+	case pending > 0 && !expired:
+		log.Infof("Waiting for %d ENIs to be detached from instance %s", pending, instanceID)
+		return ctrl.Result{RequeueAfter: requeueInterval}, nil
+	case pending > 0:
+		log.Warnf("Giving up on %d ENIs still attached to instance %s", pending, instanceID)
+	}
+	delete(r.cleanupStarted, instanceID)
+	return ctrl.Result{}, nil
+}
+
+// deleteInstanceENIs deletes the detached ENIs ipamd created for the instance. It returns the number of ENIs that are
+// still attached to the instance while it terminates, and need to be checked again.
+func (r *NodeReconciler) deleteInstanceENIs(ctx context.Context, instanceID string) (int, error) {
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", awsutils.ENINodeTagKey)),
+			Values: []*string{aws.String(instanceID)},
+		},
+	}
+	if r.ClusterName != "" {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", awsutils.ENIClusterTagKey)),
+			Values: []*string{aws.String(r.ClusterName)},
+		})
+	}
+
+	// Only the IDs of the detached ENIs are kept, so that the pages of ENIs can be freed once processed
+	var detached []string
+	var attached int
+	err := r.EC2.DescribeNetworkInterfacesPagesWithContext(ctx, &ec2.DescribeNetworkInterfacesInput{Filters: filters},
+		func(page *ec2.DescribeNetworkInterfacesOutput, _ bool) bool {
+			for _, eni := range page.NetworkInterfaces {
+				if !strings.HasPrefix(aws.StringValue(eni.Description), awsutils.ENIDescriptionPrefix) {
+					continue
+				}
+				if aws.StringValue(eni.Status) != ec2.NetworkInterfaceStatusAvailable {
+					attached++
+					continue
+				}
+				detached = append(detached, aws.StringValue(eni.NetworkInterfaceId))
+			}
+			return true
+		})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to describe the ENIs of instance %s", instanceID)
+	}
+
+	for _, eniID := range detached {
+		_, err := r.EC2.DeleteNetworkInterfaceWithContext(ctx, &ec2.DeleteNetworkInterfaceInput{NetworkInterfaceId: aws.String(eniID)})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidNetworkInterfaceID.NotFound" {
+				continue
+			}
+			return 0, errors.Wrapf(err, "failed to delete ENI %s of instance %s", eniID, instanceID)
+		}
+		log.Infof("Deleted ENI %s of instance %s", eniID, instanceID)
+	}
+	if attached == 0 {
+		return 0, nil
+	}
+
+	// The node object can be deleted while its instance keeps running, its ENIs are then still in use
+	live, err := r.isInstanceLive(ctx, instanceID)
+	if err != nil {
+		return 0, err
+	}
+	if live {
+		log.Infof("Instance %s still exists, keeping its %d attached ENIs", instanceID, attached)
+		return 0, nil
+	}
+	return attached, nil
+}
+
+func (r *NodeReconciler) isInstanceLive(ctx context.Context, instanceID string) (bool, error) {
+	output, err := r.EC2.DescribeInstancesWithContext(ctx, &ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String(instanceID)}})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "InvalidInstanceID.NotFound" {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to describe instance %s", instanceID)
+	}
+	for _, reservation := range output.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.State != nil && liveInstanceStates[aws.StringValue(instance.State.Name)] {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// instanceIDFromProviderID returns the instance ID of a provider ID of the form aws:///us-west-2a/i-0123456789abcdef0,
+// or an empty string for nodes that are not EC2 instances
+func instanceIDFromProviderID(providerID string) string {
+	if !strings.HasPrefix(providerID, "aws://") {
+		return ""
+	}
+	instanceID := providerID[strings.LastIndex(providerID, "/")+1:]
+	if !strings.HasPrefix(instanceID, "i-") {
+		return ""
+	}
+	return instanceID
+}
@@ -0,0 +1,159 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package enicleanup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	testclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	mock_ec2wrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/ec2wrapper/mocks"
+)
+
+const (
+	nodeName   = "ip-192-168-55-73.us-west-2.compute.internal"
+	instanceID = "i-0e1f3b9eb950e4980"
+	providerID = "aws:///us-west-2a/" + instanceID
+)
+
+func setup(t *testing.T, objs ...client.Object) (*NodeReconciler, *mock_ec2wrapper.MockEC2) {
+	mockCtrl := gomock.NewController(t)
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	mockEC2 := mock_ec2wrapper.NewMockEC2(mockCtrl)
+	return &NodeReconciler{
+		Client: testclient.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+		EC2:    mockEC2,
+	}, mockEC2
+}
+
+func expectENIs(mockEC2 *mock_ec2wrapper.MockEC2, enis ...*ec2.NetworkInterface) {
+	mockEC2.EXPECT().DescribeNetworkInterfacesPagesWithContext(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, input *ec2.DescribeNetworkInterfacesInput, fn func(*ec2.DescribeNetworkInterfacesOutput, bool) bool, _ ...request.Option) error {
+			fn(&ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: enis}, true)
+			return nil
+		})
+}
+
+func eni(id, status string) *ec2.NetworkInterface {
+	return &ec2.NetworkInterface{
+		NetworkInterfaceId: aws.String(id),
+		Description:        aws.String(awsutils.ENIDescriptionPrefix + id),
+		Status:             aws.String(status),
+	}
+}
+
+func expectInstanceState(mockEC2 *mock_ec2wrapper.MockEC2, state string) {
+	mockEC2.EXPECT().DescribeInstancesWithContext(gomock.Any(), gomock.Any()).Return(&ec2.DescribeInstancesOutput{
+		Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{{State: &ec2.InstanceState{Name: aws.String(state)}}}}},
+	}, nil)
+}
+
+func reconcile(t *testing.T, r *NodeReconciler) ctrl.Result {
+	result, err := r.Reconcile(context.TODO(), ctrl.Request{NamespacedName: types.NamespacedName{Name: instanceID}})
+	require.NoError(t, err)
+	return result
+}
+
+func TestEnqueueDeletedNode(t *testing.T) {
+	q := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer q.ShutDown()
+
+	enqueueDeletedNode(context.TODO(), event.DeleteEvent{Object: &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Spec:       corev1.NodeSpec{ProviderID: providerID},
+	}}, q)
+	// Nodes that are not EC2 instances have no ENIs to clean up
+	enqueueDeletedNode(context.TODO(), event.DeleteEvent{Object: &corev1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "fargate-" + nodeName},
+		Spec:       corev1.NodeSpec{ProviderID: "aws:///us-west-2a/0123456789abcdef/fargate-" + nodeName},
+	}}, q)
+
+	require.Equal(t, 1, q.Len())
+	item, _ := q.Get()
+	assert.Equal(t, ctrl.Request{NamespacedName: types.NamespacedName{Name: instanceID}}, item)
+}
+
+func TestRemoveFinalizers(t *testing.T) {
+	r, _ := setup(t,
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: nodeName, Finalizers: []string{FinalizerName, "example.com/other"}}},
+		&corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "other-" + nodeName}})
+	require.NoError(t, RemoveFinalizers(context.TODO(), r.Client))
+
+	var node corev1.Node
+	require.NoError(t, r.Client.Get(context.TODO(), client.ObjectKey{Name: nodeName}, &node))
+	assert.Equal(t, []string{"example.com/other"}, node.Finalizers)
+}
+
+func TestDeleteENIsOfTerminatedInstance(t *testing.T) {
+	r, mockEC2 := setup(t)
+	expectENIs(mockEC2, eni("eni-1", ec2.NetworkInterfaceStatusAvailable), eni("eni-2", ec2.NetworkInterfaceStatusInUse))
+	mockEC2.EXPECT().DeleteNetworkInterfaceWithContext(gomock.Any(), &ec2.DeleteNetworkInterfaceInput{
+		NetworkInterfaceId: aws.String("eni-1"),
+	}).Return(&ec2.DeleteNetworkInterfaceOutput{}, nil)
+	expectInstanceState(mockEC2, ec2.InstanceStateNameShuttingDown)
+
+	// eni-2 is still attached to the terminating instance
+	assert.Equal(t, requeueInterval, reconcile(t, r).RequeueAfter)
+
+	// Once detached, it is deleted too
+	expectENIs(mockEC2, eni("eni-2", ec2.NetworkInterfaceStatusAvailable))
+	mockEC2.EXPECT().DeleteNetworkInterfaceWithContext(gomock.Any(), &ec2.DeleteNetworkInterfaceInput{
+		NetworkInterfaceId: aws.String("eni-2"),
+	}).Return(&ec2.DeleteNetworkInterfaceOutput{}, nil)
+	assert.Zero(t, reconcile(t, r).RequeueAfter)
+	assert.Empty(t, r.cleanupStarted)
+}
+
+func TestKeepENIsOfLiveInstance(t *testing.T) {
+	r, mockEC2 := setup(t)
+	expectENIs(mockEC2, eni("eni-1", ec2.NetworkInterfaceStatusInUse))
+	expectInstanceState(mockEC2, ec2.InstanceStateNameRunning)
+
+	assert.Zero(t, reconcile(t, r).RequeueAfter)
+}
+
+func TestGiveUpAfterMaxCleanupTime(t *testing.T) {
+	r, mockEC2 := setup(t)
+	r.cleanupStarted = map[string]time.Time{instanceID: time.Now().Add(-2 * maxCleanupTime)}
+	expectENIs(mockEC2, eni("eni-1", ec2.NetworkInterfaceStatusInUse))
+	expectInstanceState(mockEC2, ec2.InstanceStateNameTerminated)
+
+	assert.Zero(t, reconcile(t, r).RequeueAfter)
+	assert.Empty(t, r.cleanupStarted)
+}
+
+func TestInstanceIDFromProviderID(t *testing.T) {
+	assert.Equal(t, instanceID, instanceIDFromProviderID(providerID))
+	assert.Equal(t, "", instanceIDFromProviderID(""))
+	assert.Equal(t, "", instanceIDFromProviderID("kind://docker/kind/kind-worker"))
+	assert.Equal(t, "", instanceIDFromProviderID("aws:///us-west-2a/fargate-ip-192-168-55-73.us-west-2.compute.internal"))
+}
@@ -122,6 +122,21 @@ func getEniConfigLabelDef() string {
 	return defaultEniConfigLabelDef
 }
 
+// NodeSelectorTerms returns the node selector terms of the nodes using one of the ENIConfigs. The nodes selecting their
+// ENIConfig with an annotation, or using the default one without a label, cannot be told apart with labels and do not
+// match.
+func NodeSelectorTerms(names []string) []corev1.NodeSelectorTerm {
+	return []corev1.NodeSelectorTerm{
+		{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: externalEniConfigLabel, Operator: corev1.NodeSelectorOpIn, Values: names},
+		}},
+		{MatchExpressions: []corev1.NodeSelectorRequirement{
+			{Key: externalEniConfigLabel, Operator: corev1.NodeSelectorOpDoesNotExist},
+			{Key: getEniConfigLabelDef(), Operator: corev1.NodeSelectorOpIn, Values: names},
+		}},
+	}
+}
+
 func GetNodeSpecificENIConfigName(node corev1.Node) (string, error) {
 	var eniConfigName string
 
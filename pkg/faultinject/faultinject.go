@@ -0,0 +1,212 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package faultinject makes calls to EC2, to instance metadata and to the datastore checkpoint fail or slow down, as
+// configured by the FAULT_INJECTION environment variable, to test how ipamd behaves under partial AWS failures.
+//
+// FAULT_INJECTION is a comma-separated list of rules. Each rule is a target, optionally followed by "/" and an
+// operation, then ":" and semicolon-separated settings:
+//
+//	ec2:error=0.1;latency=500ms,ec2/CreateNetworkInterface:error=1;code=InsufficientFreeAddressesInSubnet,imds:error=0.5
+//
+// The targets are "ec2", "imds" and "datastore", whose only operation is "Checkpoint". "error" is the probability that a
+// call fails, "code" the error code of AWS calls that fail, "latency" a delay added to every call. When several rules
+// match a call, the rule of the operation takes precedence over the rule of the target.
+package faultinject
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+)
+
+const (
+	// EnvFaultInjection is the environment variable holding the fault injection rules
+	EnvFaultInjection = "FAULT_INJECTION"
+
+	// Targets of the rules
+	TargetEC2       = "ec2"
+	TargetIMDS      = "imds"
+	TargetDatastore = "datastore"
+
+	// DefaultErrorCode is the code of the injected AWS errors when the rule sets none
+	DefaultErrorCode = "FaultInjected"
+
+	handlerName = "amazon-vpc-cni-k8s/faultinject"
+)
+
+var log = logger.Get()
+
+// serviceTargets maps the AWS SDK clients to the targets of the rules
+var serviceTargets = map[string]string{
+	ec2.ServiceName:         TargetEC2,
+	ec2metadata.ServiceName: TargetIMDS,
+}
+
+// Rule is the faults injected in the calls of a target, or of one of its operations
+type Rule struct {
+	ErrorRate float64
+	ErrorCode string
+	Latency   time.Duration
+}
+
+// Injector injects the faults of its rules. A nil Injector injects nothing.
+type Injector struct {
+	// rules are keyed by target, or by target and operation as "target/operation"
+	rules map[string]Rule
+
+	lock   sync.Mutex
+	random *rand.Rand
+	sleep  func(time.Duration)
+}
+
+var (
+	defaultInjector *Injector
+	defaultOnce     sync.Once
+)
+
+// Default returns the Injector configured by FAULT_INJECTION, or nil if it is not set or invalid
+func Default() *Injector {
+	defaultOnce.Do(func() {
+		spec := os.Getenv(EnvFaultInjection)
+		if spec == "" {
+			return
+		}
+		injector, err := Parse(spec)
+		if err != nil {
+			log.Errorf("Ignoring invalid %s: %v", EnvFaultInjection, err)
+			return
+		}
+		log.Warnf("Injecting faults into calls to AWS and the datastore: %s", spec)
+		defaultInjector = injector
+	})
+	return defaultInjector
+}
+
+// Parse returns the Injector of the given rules
+func Parse(spec string) (*Injector, error) {
+	rules := make(map[string]Rule)
+	for _, ruleSpec := range strings.Split(spec, ",") {
+		ruleSpec = strings.TrimSpace(ruleSpec)
+		if ruleSpec == "" {
+			continue
+		}
+		scope, settings, found := strings.Cut(ruleSpec, ":")
+		if !found {
+			return nil, fmt.Errorf("rule %q has no settings", ruleSpec)
+		}
+		target, _, _ := strings.Cut(scope, "/")
+		if target != TargetEC2 && target != TargetIMDS && target != TargetDatastore {
+			return nil, fmt.Errorf("rule %q has unknown target %q", ruleSpec, target)
+		}
+		rule := Rule{ErrorCode: DefaultErrorCode}
+		for _, setting := range strings.Split(settings, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(setting), "=")
+			var err error
+			switch key {
+			case "error":
+				rule.ErrorRate, err = strconv.ParseFloat(value, 64)
+				if err == nil && (rule.ErrorRate < 0 || rule.ErrorRate > 1) {
+					err = fmt.Errorf("not between 0 and 1")
+				}
+			case "code":
+				rule.ErrorCode = value
+			case "latency":
+				rule.Latency, err = time.ParseDuration(value)
+			default:
+				err = fmt.Errorf("unknown setting")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("rule %q has invalid setting %q: %v", ruleSpec, setting, err)
+			}
+		}
+		rules[scope] = rule
+	}
+	return &Injector{
+		rules:  rules,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+		sleep:  time.Sleep,
+	}, nil
+}
+
+// inject waits for the latency of the rule matching the operation, then returns whether the call must fail
+func (i *Injector) inject(target, operation string) (Rule, bool) {
+	rule, found := i.rules[target+"/"+operation]
+	if !found {
+		if rule, found = i.rules[target]; !found {
+			return Rule{}, false
+		}
+	}
+	if rule.Latency > 0 {
+		i.sleep(rule.Latency)
+	}
+	i.lock.Lock()
+	fail := i.random.Float64() < rule.ErrorRate
+	i.lock.Unlock()
+	return rule, fail
+}
+
+// InjectAWS makes the requests of the EC2 and instance metadata clients created from the handlers fail or slow down.
+// It must be called on the session handlers before the clients are created.
+func (i *Injector) InjectAWS(handlers *request.Handlers) {
+	if i == nil {
+		return
+	}
+	// Build handlers stop at the first error, and failing requests are not retried, so that the rules apply to calls
+	// rather than to attempts
+	handlers.Build.PushFrontNamed(request.NamedHandler{
+		Name: handlerName,
+		Fn: func(r *request.Request) {
+			target, found := serviceTargets[r.ClientInfo.ServiceName]
+			if !found {
+				return
+			}
+			if rule, fail := i.inject(target, r.Operation.Name); fail {
+				r.Error = awserr.New(rule.ErrorCode, fmt.Sprintf("fault injected into %s %s", target, r.Operation.Name), nil)
+			}
+		},
+	})
+}
+
+// Checkpointer returns a checkpointer whose checkpoints fail or slow down as configured for the datastore target
+func (i *Injector) Checkpointer(checkpointer datastore.Checkpointer) datastore.Checkpointer {
+	if i == nil {
+		return checkpointer
+	}
+	return &faultyCheckpointer{Checkpointer: checkpointer, injector: i}
+}
+
+type faultyCheckpointer struct {
+	datastore.Checkpointer
+	injector *Injector
+}
+
+// Checkpoint fails without writing the data, as if the write had failed
+func (c *faultyCheckpointer) Checkpoint(data interface{}) error {
+	if _, fail := c.injector.inject(TargetDatastore, "Checkpoint"); fail {
+		return fmt.Errorf("fault injected into datastore Checkpoint")
+	}
+	return c.Checkpointer.Checkpoint(data)
+}
@@ -0,0 +1,92 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package faultinject
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestParse(t *testing.T) {
+	injector, err := Parse("ec2:error=0.1;latency=500ms, ec2/CreateNetworkInterface:error=1;code=InsufficientFreeAddressesInSubnet,datastore:error=0.5")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]Rule{
+		"ec2":                        {ErrorRate: 0.1, ErrorCode: DefaultErrorCode, Latency: 500 * time.Millisecond},
+		"ec2/CreateNetworkInterface": {ErrorRate: 1, ErrorCode: "InsufficientFreeAddressesInSubnet"},
+		"datastore":                  {ErrorRate: 0.5, ErrorCode: DefaultErrorCode},
+	}, injector.rules)
+
+	for _, spec := range []string{"ec2", "s3:error=1", "ec2:error=2", "ec2:latency=soon", "imds:timeout=1s"} {
+		_, err := Parse(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestInjectAWS(t *testing.T) {
+	injector, err := Parse("ec2:error=1,ec2/DescribeInstances:error=1;code=RequestLimitExceeded;latency=1s,imds:error=1")
+	require.NoError(t, err)
+	var slept time.Duration
+	injector.sleep = func(d time.Duration) { slept += d }
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Region:      aws.String("us-west-2"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String("http://127.0.0.1:0"),
+		MaxRetries:  aws.Int(3),
+	}))
+	injector.InjectAWS(&sess.Handlers)
+
+	_, err = ec2.New(sess).DescribeInstances(&ec2.DescribeInstancesInput{})
+	require.Error(t, err)
+	assert.Equal(t, "RequestLimitExceeded", err.(awserr.Error).Code())
+	assert.Equal(t, time.Second, slept)
+
+	_, err = ec2.New(sess).DescribeSubnets(&ec2.DescribeSubnetsInput{})
+	require.Error(t, err)
+	assert.Equal(t, DefaultErrorCode, err.(awserr.Error).Code())
+	assert.Equal(t, time.Second, slept)
+
+	_, err = ec2metadata.New(sess).GetMetadata("instance-id")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), DefaultErrorCode)
+}
+
+func TestCheckpointer(t *testing.T) {
+	var injector *Injector
+	checkpoint := datastore.NewTestCheckpoint(nil)
+	assert.Equal(t, checkpoint, injector.Checkpointer(checkpoint))
+
+	injector, err := Parse("datastore:error=1")
+	require.NoError(t, err)
+	faulty := injector.Checkpointer(checkpoint)
+	assert.Error(t, faulty.Checkpoint("data"))
+	assert.Nil(t, checkpoint.Data)
+
+	injector, err = Parse("datastore:error=0")
+	require.NoError(t, err)
+	faulty = injector.Checkpointer(checkpoint)
+	assert.NoError(t, faulty.Checkpoint("data"))
+	assert.Equal(t, "data", checkpoint.Data)
+}
@@ -0,0 +1,206 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package featuregate enables the features of aws-node that are not generally available yet, as configured by the
+// FEATURE_GATES environment variable of aws-node, a comma-separated list of features set to true or false:
+//
+//	FeatureA=true,FeatureB=false
+//
+// ipamd reads the gates from its environment, and aws-vpc-cni passes them to the CNI plugins in the conflist, so that
+// all the components of a node agree on the enabled features.
+//
+// The gates are safe to roll back. A gate that the running version does not know, set for a newer version, is ignored
+// with a warning rather than failing the start. ipamd records the enabled features on the node, and runs the disable
+// hook of the features that were enabled by the previous run and no longer are, so that disabling a feature removes
+// what it left on the node. An alpha feature must keep the checkpoint readable by the previous release, which knows
+// nothing of it.
+package featuregate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvFeatureGates is the environment variable holding the feature gates
+const EnvFeatureGates = "FEATURE_GATES"
+
+// Feature is the name of a feature gate
+type Feature string
+
+// Stage is the maturity of a feature
+type Stage string
+
+const (
+	// Alpha features are disabled by default, and may change or be removed in any release
+	Alpha Stage = "ALPHA"
+	// Beta features are complete, they are enabled by default unless they need changes outside of aws-node
+	Beta Stage = "BETA"
+	// GA features are always enabled, their gate is kept locked to true for a release before it is removed, so that a
+	// FEATURE_GATES that still sets it keeps working
+	GA Stage = "GA"
+)
+
+// FeatureSpec is the default and the stage of a feature
+type FeatureSpec struct {
+	Default bool
+	Stage   Stage
+	// LockToDefault features can no longer be changed, the gates set to another value are ignored
+	LockToDefault bool
+}
+
+// features are the feature gates of aws-node. A feature is added as Alpha, and its gate is only removed once it has
+// been GA and locked to true for a release.
+var features = map[Feature]FeatureSpec{}
+
+// FeatureGate is the state of the feature gates
+type FeatureGate struct {
+	known map[Feature]FeatureSpec
+	// set are the gates set explicitly, the others have their default
+	set map[Feature]bool
+}
+
+// New parses the value of FEATURE_GATES for the known features. The invalid and unknown gates are ignored, and
+// returned as errors to report.
+func New(known map[Feature]FeatureSpec, value string) (*FeatureGate, []error) {
+	g := &FeatureGate{known: known, set: map[Feature]bool{}}
+	var errs []error
+	for _, gate := range strings.Split(value, ",") {
+		gate = strings.TrimSpace(gate)
+		if gate == "" {
+			continue
+		}
+		name, enabledStr, found := strings.Cut(gate, "=")
+		feature := Feature(strings.TrimSpace(name))
+		enabled, err := strconv.ParseBool(strings.TrimSpace(enabledStr))
+		if !found || err != nil {
+			errs = append(errs, fmt.Errorf("ignoring invalid feature gate %q, expected <feature>=<true|false>", gate))
+			continue
+		}
+		spec, ok := known[feature]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("ignoring unknown feature gate %s, it may be set for another version of aws-node", feature))
+		case spec.LockToDefault && enabled != spec.Default:
+			errs = append(errs, fmt.Errorf("ignoring feature gate %s=%t, the %s feature is locked to %t", feature, enabled, spec.Stage, spec.Default))
+		default:
+			g.set[feature] = enabled
+		}
+	}
+	return g, errs
+}
+
+// Parse parses the value of FEATURE_GATES for the features of aws-node
+func Parse(value string) (*FeatureGate, []error) {
+	return New(features, value)
+}
+
+// FromEnv parses FEATURE_GATES from the environment
+func FromEnv() (*FeatureGate, []error) {
+	return Parse(os.Getenv(EnvFeatureGates))
+}
+
+// Enabled returns whether the feature is enabled, false for unknown features. A nil FeatureGate has the defaults of the
+// features of aws-node.
+func (g *FeatureGate) Enabled(feature Feature) bool {
+	if g == nil {
+		return features[feature].Default
+	}
+	if enabled, ok := g.set[feature]; ok {
+		return enabled
+	}
+	return g.known[feature].Default
+}
+
+// String returns the gates set explicitly, in the format of FEATURE_GATES, so that they can be passed on to the CNI
+// plugins
+func (g *FeatureGate) String() string {
+	gates := make([]string, 0, len(g.set))
+	for feature, enabled := range g.set {
+		gates = append(gates, fmt.Sprintf("%s=%t", feature, enabled))
+	}
+	sort.Strings(gates)
+	return strings.Join(gates, ",")
+}
+
+// State is whether a feature is enabled
+type State struct {
+	Feature Feature `json:"feature"`
+	Stage   Stage   `json:"stage"`
+	Enabled bool    `json:"enabled"`
+}
+
+// States returns the state of all the known features, sorted by name
+func (g *FeatureGate) States() []State {
+	states := make([]State, 0, len(g.known))
+	for feature, spec := range g.known {
+		states = append(states, State{Feature: feature, Stage: spec.Stage, Enabled: g.Enabled(feature)})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Feature < states[j].Feature })
+	return states
+}
+
+// Reconcile runs the disable hooks of the features enabled when the state was last recorded at path and disabled now,
+// then records the features enabled now. The features whose hook fails stay recorded, so that it is run again on the
+// next start. It returns the errors of the hooks.
+func (g *FeatureGate) Reconcile(path string, disableHooks map[Feature]func() error) []error {
+	var previous []Feature
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &previous); err != nil {
+			return []error{fmt.Errorf("failed to parse the feature gate state %s: %v", path, err)}
+		}
+	} else if !os.IsNotExist(err) {
+		return []error{fmt.Errorf("failed to read the feature gate state %s: %v", path, err)}
+	}
+
+	var errs []error
+	recorded := map[Feature]bool{}
+	for _, feature := range previous {
+		if g.Enabled(feature) {
+			continue
+		}
+		// The features of a newer version have no hook here, what they left on the node is not cleaned up
+		hook, ok := disableHooks[feature]
+		if !ok {
+			continue
+		}
+		if err := hook(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to disable feature %s: %v", feature, err))
+			recorded[feature] = true
+		}
+	}
+	for feature := range g.known {
+		if g.Enabled(feature) {
+			recorded[feature] = true
+		}
+	}
+
+	current := make([]Feature, 0, len(recorded))
+	for feature := range recorded {
+		current = append(current, feature)
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i] < current[j] })
+	data, err := json.Marshal(current)
+	if err == nil {
+		if err = os.WriteFile(path+".tmp", data, 0644); err == nil {
+			err = os.Rename(path+".tmp", path)
+		}
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to record the feature gate state %s: %v", path, err))
+	}
+	return errs
+}
@@ -0,0 +1,95 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package featuregate
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var testFeatures = map[Feature]FeatureSpec{
+	"AlphaFeature": {Default: false, Stage: Alpha},
+	"BetaFeature":  {Default: true, Stage: Beta},
+	"GAFeature":    {Default: true, Stage: GA, LockToDefault: true},
+}
+
+func TestNew(t *testing.T) {
+	g, errs := New(testFeatures, "")
+	assert.Empty(t, errs)
+	assert.False(t, g.Enabled("AlphaFeature"))
+	assert.True(t, g.Enabled("BetaFeature"))
+	assert.False(t, g.Enabled("UnknownFeature"))
+	assert.Equal(t, "", g.String())
+
+	g, errs = New(testFeatures, " AlphaFeature=true, BetaFeature=false ,GAFeature=false,NewerFeature=true,AlphaFeature")
+	assert.Len(t, errs, 3)
+	assert.ErrorContains(t, errs[0], "locked to true")
+	assert.ErrorContains(t, errs[1], "unknown feature gate NewerFeature")
+	assert.ErrorContains(t, errs[2], "invalid feature gate")
+	assert.True(t, g.Enabled("AlphaFeature"))
+	assert.False(t, g.Enabled("BetaFeature"))
+	assert.True(t, g.Enabled("GAFeature"))
+	assert.False(t, g.Enabled("NewerFeature"))
+	// Only the valid gates are passed on to the plugins
+	assert.Equal(t, "AlphaFeature=true,BetaFeature=false", g.String())
+
+	assert.Equal(t, []State{
+		{Feature: "AlphaFeature", Stage: Alpha, Enabled: true},
+		{Feature: "BetaFeature", Stage: Beta, Enabled: false},
+		{Feature: "GAFeature", Stage: GA, Enabled: true},
+	}, g.States())
+}
+
+func TestReconcile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feature-gates.json")
+	var disabled []Feature
+	hooks := map[Feature]func() error{
+		"AlphaFeature": func() error {
+			disabled = append(disabled, "AlphaFeature")
+			return nil
+		},
+		"BetaFeature": func() error {
+			disabled = append(disabled, "BetaFeature")
+			return errors.New("busy")
+		},
+	}
+
+	g, _ := New(testFeatures, "AlphaFeature=true")
+	assert.Empty(t, g.Reconcile(path, hooks))
+	assert.Empty(t, disabled)
+	data, _ := os.ReadFile(path)
+	assert.JSONEq(t, `["AlphaFeature","BetaFeature","GAFeature"]`, string(data))
+
+	// Rolling back the gates disables the features, those that fail stay recorded
+	g, _ = New(testFeatures, "BetaFeature=false")
+	errs := g.Reconcile(path, hooks)
+	assert.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "failed to disable feature BetaFeature: busy")
+	assert.ElementsMatch(t, []Feature{"AlphaFeature", "BetaFeature"}, disabled)
+	data, _ = os.ReadFile(path)
+	assert.JSONEq(t, `["BetaFeature","GAFeature"]`, string(data))
+
+	// The features of a newer version are forgotten
+	assert.NoError(t, os.WriteFile(path, []byte(`["NewerFeature"]`), 0644))
+	disabled = nil
+	g, _ = New(testFeatures, "")
+	assert.Empty(t, g.Reconcile(path, hooks))
+	assert.Empty(t, disabled)
+	data, _ = os.ReadFile(path)
+	assert.JSONEq(t, `["BetaFeature","GAFeature"]`, string(data))
+}
@@ -0,0 +1,146 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package frr renders the configuration of an FRR daemon that advertises the pod IPs of the node to BGP routers. aws-node
+// does not speak BGP itself, FRR runs next to it on the node and loads the configuration ipamd writes.
+package frr
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPath is where the configuration is written. /var/run/aws-node is shared by the aws-node containers and the
+// host, so that an FRR container or a daemon of the host can read it.
+const DefaultPath = "/var/run/aws-node/frr/bgpd.conf"
+
+// Peer is a BGP router the pod IPs are advertised to
+type Peer struct {
+	Address string
+	ASN     uint32
+	// BFD detects the failure of the peer faster than the hold time of BGP
+	BFD bool
+	// EBGPMultihop is the TTL of the BGP packets for the peers that are not on the subnet of the node, 0 for directly
+	// connected peers
+	EBGPMultihop int
+}
+
+// Config is the BGP speaker of the node
+type Config struct {
+	ASN uint32
+	// RouterID is the primary IPv4 address of the node
+	RouterID string
+	Peers    []Peer
+	// Prefixes are the CIDRs of the pod IPs of the node, IPv6 ones when IPv6 is set
+	Prefixes []string
+	IPv6     bool
+}
+
+// Validate checks the numbers and addresses of the speaker and of its peers
+func (c Config) Validate() error {
+	if c.ASN == 0 {
+		return errors.New("frr: the ASN of the node is not set")
+	}
+	if net.ParseIP(c.RouterID).To4() == nil {
+		return errors.Errorf("frr: invalid router ID %q", c.RouterID)
+	}
+	if len(c.Peers) == 0 {
+		return errors.New("frr: no peer")
+	}
+	for _, peer := range c.Peers {
+		if net.ParseIP(peer.Address) == nil {
+			return errors.Errorf("frr: invalid peer address %q", peer.Address)
+		}
+		if peer.ASN == 0 {
+			return errors.Errorf("frr: the ASN of peer %s is not set", peer.Address)
+		}
+		if peer.EBGPMultihop < 0 || peer.EBGPMultihop > 255 {
+			return errors.Errorf("frr: invalid eBGP multihop %d of peer %s", peer.EBGPMultihop, peer.Address)
+		}
+	}
+	return nil
+}
+
+// Render returns the bgpd configuration of the speaker. The prefixes are announced whether or not the kernel has a route
+// to them, the pod routes are installed by the plugin one pod at a time.
+func (c Config) Render() string {
+	var b strings.Builder
+	b.WriteString("! Generated by aws-node, do not edit\n")
+	fmt.Fprintf(&b, "router bgp %d\n", c.ASN)
+	fmt.Fprintf(&b, " bgp router-id %s\n", c.RouterID)
+	b.WriteString(" no bgp ebgp-requires-policy\n")
+	b.WriteString(" no bgp network import-check\n")
+	for _, peer := range c.Peers {
+		fmt.Fprintf(&b, " neighbor %s remote-as %d\n", peer.Address, peer.ASN)
+		if peer.EBGPMultihop > 0 {
+			fmt.Fprintf(&b, " neighbor %s ebgp-multihop %d\n", peer.Address, peer.EBGPMultihop)
+		}
+		if peer.BFD {
+			fmt.Fprintf(&b, " neighbor %s bfd\n", peer.Address)
+		}
+	}
+	b.WriteString(" !\n")
+	if c.IPv6 {
+		b.WriteString(" address-family ipv6 unicast\n")
+	} else {
+		b.WriteString(" address-family ipv4 unicast\n")
+	}
+	for _, prefix := range c.Prefixes {
+		fmt.Fprintf(&b, "  network %s\n", prefix)
+	}
+	for _, peer := range c.Peers {
+		fmt.Fprintf(&b, "  neighbor %s activate\n", peer.Address)
+	}
+	b.WriteString(" exit-address-family\n")
+	b.WriteString("exit\n")
+	return b.String()
+}
+
+// WriteConfig writes the configuration to path when it changed, and returns whether it did. The file is written next
+// to path then renamed, so that FRR never loads a partial configuration.
+func WriteConfig(path string, c Config) (bool, error) {
+	data := []byte(c.Render())
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, data) {
+		return false, nil
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, errors.Wrapf(err, "frr: failed to create %s", dir)
+	}
+	tmp, err := os.CreateTemp(dir, ".tmp-")
+	if err != nil {
+		return false, errors.Wrapf(err, "frr: failed to create a file in %s", dir)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// CreateTemp creates the file readable by its owner only, FRR runs as its own user
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return false, errors.Wrapf(err, "frr: failed to write %s", path)
+	}
+	return true, nil
+}
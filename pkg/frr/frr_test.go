@@ -0,0 +1,98 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package frr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testConfig() Config {
+	return Config{
+		ASN:      64512,
+		RouterID: "10.0.0.10",
+		Peers: []Peer{
+			{Address: "192.168.0.1", ASN: 65000, BFD: true, EBGPMultihop: 4},
+			{Address: "10.0.0.1", ASN: 64512},
+		},
+		Prefixes: []string{"10.0.0.16/28", "10.0.0.42/32"},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, testConfig().Validate())
+
+	for name, change := range map[string]func(*Config){
+		"no ASN":           func(c *Config) { c.ASN = 0 },
+		"IPv6 router ID":   func(c *Config) { c.RouterID = "2600::1" },
+		"no peer":          func(c *Config) { c.Peers = nil },
+		"invalid peer":     func(c *Config) { c.Peers[0].Address = "router" },
+		"no peer ASN":      func(c *Config) { c.Peers[1].ASN = 0 },
+		"invalid multihop": func(c *Config) { c.Peers[0].EBGPMultihop = 256 },
+	} {
+		c := testConfig()
+		change(&c)
+		assert.Error(t, c.Validate(), name)
+	}
+}
+
+func TestRender(t *testing.T) {
+	assert.Equal(t, `! Generated by aws-node, do not edit
+router bgp 64512
+ bgp router-id 10.0.0.10
+ no bgp ebgp-requires-policy
+ no bgp network import-check
+ neighbor 192.168.0.1 remote-as 65000
+ neighbor 192.168.0.1 ebgp-multihop 4
+ neighbor 192.168.0.1 bfd
+ neighbor 10.0.0.1 remote-as 64512
+ !
+ address-family ipv4 unicast
+  network 10.0.0.16/28
+  network 10.0.0.42/32
+  neighbor 192.168.0.1 activate
+  neighbor 10.0.0.1 activate
+ exit-address-family
+exit
+`, testConfig().Render())
+}
+
+func TestWriteConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "frr", "bgpd.conf")
+	c := testConfig()
+
+	changed, err := WriteConfig(path, c)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, c.Render(), string(data))
+
+	// The same configuration is not written again
+	changed, err = WriteConfig(path, c)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	c.Prefixes = c.Prefixes[:1]
+	changed, err = WriteConfig(path, c)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
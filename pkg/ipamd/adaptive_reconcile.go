@@ -0,0 +1,70 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	// minReconcileInterval is the reconcile interval after a reconcile failed or found the ENIs or IPs changed
+	minReconcileInterval = 30 * time.Second
+	// maxReconcileInterval bounds the reconcile interval while the node is stable
+	maxReconcileInterval = 10 * time.Minute
+	// reconcileJitter spreads the reconciles of the nodes of a cluster by up to this fraction of the interval, so that
+	// nodes started together do not call EC2 together
+	reconcileJitter = 0.2
+)
+
+// reconcileInterval returns how long nodeIPPoolReconcile waits after the last change of the pool
+func (c *IPAMContext) reconcileInterval() time.Duration {
+	if !c.adaptiveReconcile {
+		return nodeIPPoolReconcileInterval
+	}
+	return c.nextReconcileInterval
+}
+
+// recordReconcile doubles the reconcile interval after a reconcile that found nothing to change, up to
+// maxReconcileInterval, and drops it to minReconcileInterval after a reconcile that failed or changed the datastore
+func (c *IPAMContext) recordReconcile(stable bool) {
+	if !c.adaptiveReconcile {
+		return
+	}
+	if stable {
+		backoff := 2 * c.reconcileBackoff
+		if backoff > maxReconcileInterval {
+			backoff = maxReconcileInterval
+		}
+		c.setReconcileBackoff(backoff)
+	} else {
+		c.setReconcileBackoff(minReconcileInterval)
+	}
+}
+
+// resetReconcileBackoff brings the reconcile interval back to its default after ipamd changed the ENIs or IPs itself
+func (c *IPAMContext) resetReconcileBackoff() {
+	if !c.adaptiveReconcile {
+		return
+	}
+	if c.reconcileBackoff > nodeIPPoolReconcileInterval {
+		c.setReconcileBackoff(nodeIPPoolReconcileInterval)
+	}
+}
+
+func (c *IPAMContext) setReconcileBackoff(backoff time.Duration) {
+	c.reconcileBackoff = backoff
+	jitter := time.Duration((rand.Float64()*2 - 1) * reconcileJitter * float64(backoff))
+	c.nextReconcileInterval = backoff + jitter
+}
@@ -0,0 +1,62 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func assertReconcileInterval(t *testing.T, c *IPAMContext, backoff time.Duration) {
+	assert.Equal(t, backoff, c.reconcileBackoff)
+	jitter := time.Duration(reconcileJitter * float64(backoff))
+	assert.GreaterOrEqual(t, c.reconcileInterval(), backoff-jitter)
+	assert.LessOrEqual(t, c.reconcileInterval(), backoff+jitter)
+}
+
+func TestAdaptiveReconcileInterval(t *testing.T) {
+	c := &IPAMContext{adaptiveReconcile: true}
+	c.setReconcileBackoff(nodeIPPoolReconcileInterval)
+	assertReconcileInterval(t, c, nodeIPPoolReconcileInterval)
+
+	// Stable reconciles back off up to maxReconcileInterval
+	c.recordReconcile(true)
+	assertReconcileInterval(t, c, 2*nodeIPPoolReconcileInterval)
+	for i := 0; i < 10; i++ {
+		c.recordReconcile(true)
+	}
+	assertReconcileInterval(t, c, maxReconcileInterval)
+
+	// A change made by ipamd brings the interval back to the default
+	c.resetReconcileBackoff()
+	assertReconcileInterval(t, c, nodeIPPoolReconcileInterval)
+
+	// A failed or changing reconcile tightens the interval
+	c.recordReconcile(false)
+	assertReconcileInterval(t, c, minReconcileInterval)
+	c.resetReconcileBackoff()
+	assertReconcileInterval(t, c, minReconcileInterval)
+}
+
+func TestAdaptiveReconcileIntervalDisabled(t *testing.T) {
+	c := &IPAMContext{}
+	c.setReconcileBackoff(nodeIPPoolReconcileInterval)
+	c.recordReconcile(true)
+	c.recordReconcile(true)
+	assert.Equal(t, nodeIPPoolReconcileInterval, c.reconcileInterval())
+	c.recordReconcile(false)
+	assert.Equal(t, nodeIPPoolReconcileInterval, c.reconcileInterval())
+}
@@ -0,0 +1,100 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// densityWindow is how long the peak number of pods is remembered, so that the pool only shrinks once pods have
+	// been gone for a while
+	densityWindow         = time.Hour
+	densityBuckets        = 12
+	densityBucketDuration = densityWindow / densityBuckets
+
+	// The adaptive warm IP target is a tenth of the pod capacity of the node, within the bounds below
+	adaptiveWarmIPFraction = 10
+	minAdaptiveWarmIPs     = 2
+)
+
+// podDensity keeps the peak number of pods with an IP over densityWindow, in buckets of densityBucketDuration
+type podDensity struct {
+	buckets     [densityBuckets]int
+	current     int
+	bucketStart time.Time
+}
+
+func (d *podDensity) observe(now time.Time, assignedIPs int) {
+	if now.Sub(d.bucketStart) >= densityWindow {
+		*d = podDensity{bucketStart: now}
+	}
+	for now.Sub(d.bucketStart) >= densityBucketDuration {
+		d.current = (d.current + 1) % densityBuckets
+		d.buckets[d.current] = 0
+		d.bucketStart = d.bucketStart.Add(densityBucketDuration)
+	}
+	d.buckets[d.current] = max(d.buckets[d.current], assignedIPs)
+}
+
+func (d *podDensity) peak() int {
+	peak := 0
+	for _, assigned := range d.buckets {
+		peak = max(peak, assigned)
+	}
+	return peak
+}
+
+// warmTargetsConfigured returns whether any of the warm targets is set in the environment. The manifests and the Helm
+// chart set WARM_ENI_TARGET to its default of 1 and WARM_PREFIX_TARGET to 1, which do not count: the first changes
+// nothing, and the prefix target only applies with prefix delegation, where adaptive warm targets are not used.
+func warmTargetsConfigured() bool {
+	for _, env := range []string{envWarmIPTarget, envMinimumIPTarget} {
+		if _, found := os.LookupEnv(env); found {
+			return true
+		}
+	}
+	if value, found := os.LookupEnv(envWarmENITarget); found && value != strconv.Itoa(defaultWarmENITarget) {
+		return true
+	}
+	return false
+}
+
+// computeAdaptiveWarmTargets returns the warm IP target and the minimum IP target for the limits of the instance and
+// the peak number of pods. The warm IPs scale with the number of pods the node can run instead of the size of its
+// ENIs, and the minimum keeps the IPs of the recent peak of pods.
+func computeAdaptiveWarmTargets(maxPods, maxENI, maxIPsPerENI, peakPods int) (int, int) {
+	capacity := maxENI * maxIPsPerENI
+	if maxPods > 0 {
+		capacity = min(capacity, maxPods)
+	}
+	warmIPTarget := max(min(capacity/adaptiveWarmIPFraction, maxIPsPerENI), minAdaptiveWarmIPs)
+	minimumIPTarget := min(peakPods, capacity)
+	return warmIPTarget, minimumIPTarget
+}
+
+// updateAdaptiveWarmTargets records the number of pods on the node and recomputes the warm targets. The caller holds
+// ipPoolLock.
+func (c *IPAMContext) updateAdaptiveWarmTargets() {
+	stats := c.dataStore.GetIPStats(ipV4AddrFamily)
+	c.podDensity.observe(time.Now(), stats.AssignedIPs)
+	warmIPTarget, minimumIPTarget := computeAdaptiveWarmTargets(c.maxPods, c.maxENI, c.maxIPsPerENI, c.podDensity.peak())
+	if warmIPTarget != c.warmIPTarget || minimumIPTarget != c.minimumIPTarget {
+		log.Infof("Adaptive warm targets - warm IP target: %d, minimum IP target: %d", warmIPTarget, minimumIPTarget)
+	}
+	c.warmIPTarget = warmIPTarget
+	c.minimumIPTarget = minimumIPTarget
+}
@@ -0,0 +1,79 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeAdaptiveWarmTargets(t *testing.T) {
+	tests := []struct {
+		name            string
+		maxPods         int
+		maxENI          int
+		maxIPsPerENI    int
+		peakPods        int
+		warmIPTarget    int
+		minimumIPTarget int
+	}{
+		{"t3.small", 11, 3, 3, 4, 2, 4},
+		{"m5.large", 29, 3, 9, 0, 2, 0},
+		{"m5.4xlarge", 110, 8, 29, 40, 11, 40},
+		{"m5.24xlarge with max pods", 737, 15, 49, 200, 49, 200},
+		{"peak over capacity", 29, 3, 9, 50, 2, 27},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warmIPTarget, minimumIPTarget := computeAdaptiveWarmTargets(tt.maxPods, tt.maxENI, tt.maxIPsPerENI, tt.peakPods)
+			assert.Equal(t, tt.warmIPTarget, warmIPTarget)
+			assert.Equal(t, tt.minimumIPTarget, minimumIPTarget)
+		})
+	}
+}
+
+func TestPodDensity(t *testing.T) {
+	var d podDensity
+	start := time.Now()
+	d.observe(start, 30)
+	d.observe(start.Add(time.Minute), 10)
+	assert.Equal(t, 30, d.peak())
+
+	// The peak is remembered for the window, then forgotten bucket by bucket
+	d.observe(start.Add(densityWindow-time.Minute), 5)
+	assert.Equal(t, 30, d.peak())
+	d.observe(start.Add(densityWindow+time.Minute), 5)
+	assert.Equal(t, 5, d.peak())
+
+	// After a long gap, only the new observation counts
+	d.observe(start.Add(5*densityWindow), 7)
+	assert.Equal(t, 7, d.peak())
+}
+
+func TestWarmTargetsConfigured(t *testing.T) {
+	assert.False(t, warmTargetsConfigured())
+
+	// The defaults of the Helm chart
+	t.Setenv(envWarmENITarget, "1")
+	t.Setenv(envWarmPrefixTarget, "1")
+	assert.False(t, warmTargetsConfigured())
+
+	t.Setenv(envWarmENITarget, "2")
+	assert.True(t, warmTargetsConfigured())
+	t.Setenv(envWarmENITarget, "1")
+	t.Setenv(envMinimumIPTarget, "10")
+	assert.True(t, warmTargetsConfigured())
+}
@@ -0,0 +1,95 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+const (
+	apiServerCheckInterval = time.Minute
+	apiServerCheckTimeout  = 5 * time.Second
+
+	apiServerUnreachableReason = "APIServerUnreachable"
+	apiServerReconnectedReason = "APIServerReconnected"
+)
+
+// apiServerMonitor checks that the API server is reachable, and closes the connections to it when it is not
+type apiServerMonitor struct {
+	check func(ctx context.Context) error
+	reset func()
+	// unreachableSince is the time of the first failed check of the current outage, zero when the API server is reachable
+	unreachableSince time.Time
+}
+
+// MonitorAPIServer periodically checks that the API server is reachable. When it is not, the connections to it are
+// closed, so that the clients dial again with the API server endpoint resolved again, rather than waiting on
+// connections to an address the endpoint moved away from until ipamd restarts.
+func (c *IPAMContext) MonitorAPIServer() {
+	clientSet, err := k8sapi.GetKubeClientSet()
+	if err != nil {
+		log.Errorf("Failed to create the client to check the API server: %v", err)
+		return
+	}
+	monitor := &apiServerMonitor{
+		check: func(ctx context.Context) error {
+			_, err := clientSet.Discovery().RESTClient().Get().AbsPath("/version").DoRaw(ctx)
+			return err
+		},
+		reset: k8sapi.ResetAPIServerConnections,
+	}
+	for {
+		time.Sleep(apiServerCheckInterval)
+		monitor.poll(context.Background(), time.Now())
+	}
+}
+
+// poll checks the API server once
+func (m *apiServerMonitor) poll(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, apiServerCheckTimeout)
+	defer cancel()
+	err := m.check(ctx)
+	// An API server that answers with an error status is reachable
+	if _, ok := err.(apierrors.APIStatus); err != nil && !ok {
+		m.reset()
+		if !m.unreachableSince.IsZero() {
+			return
+		}
+		m.unreachableSince = now
+		log.Warnf("API server unreachable, closing the connections to it: %v", err)
+		if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+			eventRecorder.SendPodEvent(v1.EventTypeWarning, apiServerUnreachableReason, "CheckAPIServer",
+				fmt.Sprintf("The API server is unreachable, reconnecting: %v", err))
+		}
+		return
+	}
+	if m.unreachableSince.IsZero() {
+		return
+	}
+	outage := now.Sub(m.unreachableSince).Round(time.Second)
+	m.unreachableSince = time.Time{}
+	log.Infof("API server reachable again after %s", outage)
+	if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+		eventRecorder.SendPodEvent(v1.EventTypeNormal, apiServerReconnectedReason, "CheckAPIServer",
+			fmt.Sprintf("Reconnected to the API server after %s", outage))
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestAPIServerMonitorPoll(t *testing.T) {
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+	var checkErr error
+	resets := 0
+	m := &apiServerMonitor{
+		check: func(ctx context.Context) error { return checkErr },
+		reset: func() { resets++ },
+	}
+	now := time.Now()
+
+	m.poll(context.Background(), now)
+	assert.Equal(t, 0, resets)
+	assert.Len(t, fakeRecorder.Events, 0)
+
+	// The connections are closed on every failed check, the event is only sent once
+	checkErr = errors.New("dial tcp 10.0.0.1:443: i/o timeout")
+	m.poll(context.Background(), now)
+	m.poll(context.Background(), now.Add(apiServerCheckInterval))
+	assert.Equal(t, 2, resets)
+	if assert.Len(t, fakeRecorder.Events, 1) {
+		assert.Contains(t, <-fakeRecorder.Events, apiServerUnreachableReason)
+	}
+
+	// An error status means the API server is reachable
+	checkErr = apierrors.NewServiceUnavailable("overloaded")
+	m.poll(context.Background(), now.Add(2*apiServerCheckInterval))
+	assert.Equal(t, 2, resets)
+	if assert.Len(t, fakeRecorder.Events, 1) {
+		event := <-fakeRecorder.Events
+		assert.Contains(t, event, apiServerReconnectedReason)
+		assert.Contains(t, event, "2m0s")
+	}
+
+	checkErr = apierrors.NewNotFound(schema.GroupResource{}, "version")
+	m.poll(context.Background(), now.Add(3*apiServerCheckInterval))
+	assert.Len(t, fakeRecorder.Events, 0)
+}
@@ -0,0 +1,148 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+
+	mock_awsutils "github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	mock_networkutils "github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/benchgate"
+	pb "github.com/aws/amazon-vpc-cni-k8s/rpc"
+)
+
+// benchmarkPods are the numbers of pods added and deleted concurrently by the benchmarks
+var benchmarkPods = []int{1, 16, 64}
+
+// benchmarkDatastore returns a datastore with IPs for all the pods, and no cooldown so that they are reused right away
+func benchmarkDatastore(b *testing.B, pods int) *datastore.DataStore {
+	b.Setenv("IP_COOLDOWN_PERIOD", "0")
+	ds := datastore.NewDataStore(log, datastore.NullCheckpoint{}, false)
+	ds.AddENI(primaryENIid, primaryDevice, true, false, false)
+	for i := 0; i < pods; i++ {
+		ip := net.IPv4(10, 10, byte(i/250), byte(i%250+1))
+		ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: ip, Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	return ds
+}
+
+// runPods runs b.N operations, spread over the given number of concurrent pods
+func runPods(b *testing.B, pods int, op func(containerID string) error) {
+	var next int64
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for pod := 0; pod < pods; pod++ {
+		wg.Add(1)
+		go func(containerID string) {
+			defer wg.Done()
+			for atomic.AddInt64(&next, 1) <= int64(b.N) {
+				if err := op(containerID); err != nil {
+					b.Error(err)
+					return
+				}
+			}
+		}(fmt.Sprintf("container-%d", pod))
+	}
+	wg.Wait()
+}
+
+func benchmarkDatastoreAssignUnassign(pods int) func(b *testing.B) {
+	return func(b *testing.B) {
+		ds := benchmarkDatastore(b, pods)
+		runPods(b, pods, func(containerID string) error {
+			key := datastore.IPAMKey{NetworkName: "net0", ContainerID: containerID, IfName: "eth0"}
+			if _, _, err := ds.AssignPodIPv4Address(key, datastore.IPAMMetadata{}); err != nil {
+				return err
+			}
+			_, _, _, err := ds.UnassignPodIPAddress(key, "")
+			return err
+		})
+	}
+}
+
+func benchmarkAddDelNetwork(pods int) func(b *testing.B) {
+	return func(b *testing.B) {
+		ctrl := gomock.NewController(b)
+		defer ctrl.Finish()
+		awsClient := mock_awsutils.NewMockAPIs(ctrl)
+		network := mock_networkutils.NewMockNetworkAPIs(ctrl)
+		awsClient.EXPECT().GetVPCIPv4CIDRs().Return([]string{vpcCIDR}, nil).AnyTimes()
+		network.EXPECT().UseExternalSNAT().Return(false).AnyTimes()
+		network.EXPECT().GetExcludeSNATCIDRs().Return(nil).AnyTimes()
+
+		s := &server{
+			version: "1.2.3",
+			ipamContext: &IPAMContext{
+				awsClient:     awsClient,
+				networkClient: network,
+				enableIPv4:    true,
+				dataStore:     benchmarkDatastore(b, pods),
+			},
+		}
+		runPods(b, pods, func(containerID string) error {
+			if _, err := s.AddNetwork(context.Background(), &pb.AddNetworkRequest{
+				ClientVersion: "1.2.3",
+				Netns:         "netns",
+				NetworkName:   "net0",
+				ContainerID:   containerID,
+				IfName:        "eth0",
+			}); err != nil {
+				return err
+			}
+			_, err := s.DelNetwork(context.Background(), &pb.DelNetworkRequest{
+				ClientVersion: "1.2.3",
+				NetworkName:   "net0",
+				ContainerID:   containerID,
+				IfName:        "eth0",
+			})
+			return err
+		})
+	}
+}
+
+func benchmarks() []benchgate.Benchmark {
+	var benchmarks []benchgate.Benchmark
+	for _, pods := range benchmarkPods {
+		benchmarks = append(benchmarks,
+			benchgate.Benchmark{Name: fmt.Sprintf("DatastoreAssignUnassign/pods=%d", pods), F: benchmarkDatastoreAssignUnassign(pods)},
+			benchgate.Benchmark{Name: fmt.Sprintf("AddDelNetwork/pods=%d", pods), F: benchmarkAddDelNetwork(pods)},
+		)
+	}
+	return benchmarks
+}
+
+func BenchmarkDatastoreAssignUnassign(b *testing.B) {
+	for _, pods := range benchmarkPods {
+		b.Run(fmt.Sprintf("pods=%d", pods), benchmarkDatastoreAssignUnassign(pods))
+	}
+}
+
+func BenchmarkAddDelNetwork(b *testing.B) {
+	for _, pods := range benchmarkPods {
+		b.Run(fmt.Sprintf("pods=%d", pods), benchmarkAddDelNetwork(pods))
+	}
+}
+
+// TestBenchmarkRegression fails when the ADD/DEL path gets slower than testdata/benchmark_baseline.json, see benchgate
+func TestBenchmarkRegression(t *testing.T) {
+	benchgate.Check(t, "testdata/benchmark_baseline.json", benchmarks())
+}
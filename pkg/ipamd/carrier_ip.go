@@ -0,0 +1,258 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	// envEnablePodCarrierIP enables carrier IPs for the pods that ask for one on nodes in a Wavelength Zone
+	envEnablePodCarrierIP = "ENABLE_POD_CARRIER_IP"
+
+	// carrierIPAnnotation is set to "true" on the pods that need a carrier IP
+	carrierIPAnnotation = "vpc.amazonaws.com/carrier-ip"
+	// carrierIPAddressKey is the annotation that ipamd sets to the carrier IP of the pod
+	carrierIPAddressKey = "vpc.amazonaws.com/carrier-ip-address"
+
+	// The IPs of the deleted pods are assigned in the datastore to sandboxes of this network until their carrier IP is
+	// released, so that no other pod gets an IP the carrier network still reaches
+	carrierIPReleaseNetworkName = "_carrier_ip_release"
+	carrierIPReleaseIfName      = "carrier"
+)
+
+// Bounds of the backoff between the attempts to release a carrier IP, variables so that tests do not wait
+var (
+	carrierIPReleaseMinBackoff = time.Second
+	carrierIPReleaseMaxBackoff = time.Minute
+)
+
+func enablePodCarrierIP() bool {
+	return utils.GetBoolAsStringEnvVar(envEnablePodCarrierIP, false)
+}
+
+// setupCarrierIP associates a carrier IP with the IP of the pod if the pod asks for one, so that the carrier network
+// reaches the pod directly rather than through the node, and excludes the pod from SNAT so that its traffic leaves
+// with the IP the carrier IP is associated with.
+func (c *IPAMContext) setupCarrierIP(ctx context.Context, podName, podNamespace, ipv4Addr string, deviceNumber int) error {
+	pod, err := c.GetPod(podName, podNamespace)
+	if err != nil {
+		return err
+	}
+	if pod.Annotations[carrierIPAnnotation] != "true" {
+		return nil
+	}
+
+	// The EC2 calls are made without the lock, so that the ADDs and DELs of the other pods do not wait for them. The
+	// ADDs of one IP do not overlap, the runtime serializes the ADDs of a sandbox and a deleted pod keeps its IP until
+	// its carrier IP is released.
+	c.carrierIPLock.Lock()
+	// A retried ADD gets the same IP back, which already has its carrier IP
+	carrierIP, ok := c.carrierIPs[ipv4Addr]
+	c.carrierIPLock.Unlock()
+	if !ok {
+		eniID := c.eniOfDevice(deviceNumber)
+		if eniID == "" {
+			return errors.Errorf("no ENI with device number %d for %s", deviceNumber, ipv4Addr)
+		}
+		carrierIP, err = c.awsClient.AllocateCarrierIP(ctx, eniID, ipv4Addr)
+		if err != nil {
+			return err
+		}
+		c.carrierIPLock.Lock()
+		c.carrierIPs[ipv4Addr] = carrierIP
+		c.carrierIPLock.Unlock()
+	}
+	if err = c.networkClient.SetupCarrierIPRules(net.ParseIP(ipv4Addr)); err != nil {
+		return errors.Wrapf(err, "failed to exclude %s from SNAT", ipv4Addr)
+	}
+	log.Infof("Pod %s/%s reachable on carrier IP %s", podNamespace, podName, carrierIP)
+	if err = c.AnnotatePod(podName, podNamespace, carrierIPAddressKey, carrierIP, ""); err != nil {
+		log.Errorf("Failed to annotate pod %s/%s with its carrier IP: %v", podNamespace, podName, err)
+	}
+	return nil
+}
+
+// unassignPodIPAddress unassigns the IP of a pod from the datastore, through unassignCarrierIPPod when pods may have a
+// carrier IP, so that every release path keeps the IP out of the pool until its carrier IP is released
+func (c *IPAMContext) unassignPodIPAddress(ipamKey datastore.IPAMKey, podUID string) (*datastore.ENI, string, int, error) {
+	if c.enablePodCarrierIP {
+		return c.unassignCarrierIPPod(ipamKey, podUID)
+	}
+	return c.dataStore.UnassignPodIPAddress(ipamKey, podUID)
+}
+
+// unassignCarrierIPPod unassigns the IP of the pod like UnassignPodIPAddress. When the IP has a carrier IP, the IP is
+// assigned to a carrier IP release sandbox instead, and goes back to the pool once the carrier IP is released in the
+// background.
+func (c *IPAMContext) unassignCarrierIPPod(ipamKey datastore.IPAMKey, podUID string) (*datastore.ENI, string, int, error) {
+	c.carrierIPLock.Lock()
+	ipv4Addr := ""
+	if len(c.carrierIPs) > 0 {
+		for _, info := range c.dataStore.AllocatedIPs() {
+			if _, ok := c.carrierIPs[info.IP]; ok && info.IPAMKey == ipamKey {
+				ipv4Addr = info.IP
+			}
+		}
+	}
+	c.carrierIPLock.Unlock()
+	if ipv4Addr != "" {
+		if deviceNumber, err := c.holdCarrierIP(ipv4Addr, ipamKey); err == nil {
+			return nil, ipv4Addr, deviceNumber, nil
+		}
+	}
+
+	eni, ip, deviceNumber, err := c.dataStore.UnassignPodIPAddress(ipamKey, podUID)
+	if err != nil || ip == "" {
+		return eni, ip, deviceNumber, err
+	}
+	// The pod was found under another key, hold its IP now that it is unassigned
+	c.carrierIPLock.Lock()
+	_, ok := c.carrierIPs[ip]
+	c.carrierIPLock.Unlock()
+	if ok {
+		c.holdCarrierIP(ip, datastore.IPAMKey{})
+	}
+	return eni, ip, deviceNumber, nil
+}
+
+// holdCarrierIP moves the IP from the sandbox to its carrier IP release sandbox, and releases the carrier IP in the
+// background
+func (c *IPAMContext) holdCarrierIP(ipv4Addr string, from datastore.IPAMKey) (int, error) {
+	deviceNumber, err := c.dataStore.ReassignPodIPv4Address(ipv4Addr, from, carrierIPReleaseKey(ipv4Addr), datastore.IPAMMetadata{})
+	if err != nil {
+		log.Errorf("Failed to keep %s out of the pool until its carrier IP is released: %v", ipv4Addr, err)
+		if deviceNumber < 0 {
+			return deviceNumber, err
+		}
+	}
+	go c.releaseCarrierIP(ipv4Addr)
+	return deviceNumber, nil
+}
+
+// releaseCarrierIP releases the carrier IP of a held IP, retrying until EC2 disassociates and releases it, then removes
+// the SNAT exclusion of the IP and puts it back in the pool
+func (c *IPAMContext) releaseCarrierIP(ipv4Addr string) {
+	defer utilruntime.HandleCrash()
+	backoff := carrierIPReleaseMinBackoff
+	for {
+		err := c.awsClient.ReleaseCarrierIP(context.Background(), ipv4Addr)
+		if err == nil {
+			break
+		}
+		log.Warnf("Failed to release the carrier IP of %s, retrying in %s: %v", ipv4Addr, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > carrierIPReleaseMaxBackoff {
+			backoff = carrierIPReleaseMaxBackoff
+		}
+	}
+	if err := c.networkClient.TeardownCarrierIPRules(net.ParseIP(ipv4Addr)); err != nil {
+		log.Errorf("Failed to remove the SNAT exclusion of %s: %v", ipv4Addr, err)
+	}
+	c.carrierIPLock.Lock()
+	delete(c.carrierIPs, ipv4Addr)
+	c.carrierIPLock.Unlock()
+	if _, _, _, err := c.dataStore.UnassignPodIPAddress(carrierIPReleaseKey(ipv4Addr), ""); err != nil {
+		log.Warnf("Failed to put %s back in the pool after the release of its carrier IP: %v", ipv4Addr, err)
+	}
+}
+
+// carrierIPReleaseKey is the sandbox that holds the IP while its carrier IP is released
+func carrierIPReleaseKey(ipv4Addr string) datastore.IPAMKey {
+	return datastore.IPAMKey{
+		ContainerID: "carrier-ip-release-" + ipv4Addr,
+		IfName:      carrierIPReleaseIfName,
+		NetworkName: carrierIPReleaseNetworkName,
+	}
+}
+
+// restoreCarrierIPs reloads the carrier IPs of the pods from EC2, and releases the carrier IPs of the IPs that are no
+// longer assigned to a pod, which the pods deleted while ipamd was down leave behind. The releases that the previous
+// ipamd did not finish are resumed.
+func (c *IPAMContext) restoreCarrierIPs(ctx context.Context) {
+	carrierIPs, err := c.awsClient.GetCarrierIPs(ctx)
+	if err != nil {
+		log.Errorf("Failed to restore the carrier IPs of the pods: %v", err)
+		return
+	}
+	assignedIPs := sets.NewString()
+	heldIPs := sets.NewString()
+	for _, info := range c.dataStore.AllocatedIPs() {
+		if info.IPAMKey.NetworkName == carrierIPReleaseNetworkName {
+			heldIPs.Insert(info.IP)
+			continue
+		}
+		assignedIPs.Insert(info.IP)
+	}
+
+	restored := map[string]string{}
+	for ipv4Addr, podCarrierIPs := range carrierIPs {
+		if ipv4Addr == "" || !assignedIPs.Has(ipv4Addr) && !heldIPs.Has(ipv4Addr) {
+			log.Infof("Releasing carrier IPs %v of unassigned IP %q", podCarrierIPs, ipv4Addr)
+			if err := c.awsClient.ReleaseCarrierIP(ctx, ipv4Addr); err != nil {
+				log.Errorf("Failed to release carrier IPs %v: %v", podCarrierIPs, err)
+			}
+			if ipv4Addr != "" {
+				if err := c.networkClient.TeardownCarrierIPRules(net.ParseIP(ipv4Addr)); err != nil {
+					log.Errorf("Failed to remove the SNAT exclusion of %s: %v", ipv4Addr, err)
+				}
+			}
+			continue
+		}
+		restored[ipv4Addr] = podCarrierIPs[0]
+		// The rules survive ipamd restarts, but not node reboots
+		if err := c.networkClient.SetupCarrierIPRules(net.ParseIP(ipv4Addr)); err != nil {
+			log.Errorf("Failed to exclude %s from SNAT: %v", ipv4Addr, err)
+		}
+	}
+
+	c.carrierIPLock.Lock()
+	for ipv4Addr, carrierIP := range restored {
+		c.carrierIPs[ipv4Addr] = carrierIP
+	}
+	c.carrierIPLock.Unlock()
+	for _, ipv4Addr := range heldIPs.List() {
+		if _, ok := restored[ipv4Addr]; ok {
+			go c.releaseCarrierIP(ipv4Addr)
+			continue
+		}
+		// The carrier IP was released, the IP was not put back in the pool yet
+		if err := c.networkClient.TeardownCarrierIPRules(net.ParseIP(ipv4Addr)); err != nil {
+			log.Errorf("Failed to remove the SNAT exclusion of %s: %v", ipv4Addr, err)
+		}
+		if _, _, _, err := c.dataStore.UnassignPodIPAddress(carrierIPReleaseKey(ipv4Addr), ""); err != nil {
+			log.Warnf("Failed to put %s back in the pool after the release of its carrier IP: %v", ipv4Addr, err)
+		}
+	}
+	log.Infof("Restored %d carrier IPs", len(restored))
+}
+
+// eniOfDevice returns the ID of the ENI with the device number, or an empty string if there is none
+func (c *IPAMContext) eniOfDevice(deviceNumber int) string {
+	for eniID, eni := range c.dataStore.GetENIInfos().ENIs {
+		if eni.DeviceNumber == deviceNumber {
+			return eniID
+		}
+	}
+	return ""
+}
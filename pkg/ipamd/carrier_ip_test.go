@@ -0,0 +1,194 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func carrierIPTestContext(t *testing.T, m *testMocks) *IPAMContext {
+	ds := testDatastore()
+	assert.NoError(t, ds.AddENI("eni-1", 1, false, false, false))
+	_, cidr, _ := net.ParseCIDR("10.0.0.5/32")
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", *cidr, false))
+	_, _, err := ds.AssignPodIPv4Address(datastore.IPAMKey{NetworkName: "net0", ContainerID: "sandbox", IfName: "eth0"},
+		datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "edge"})
+	assert.NoError(t, err)
+	return &IPAMContext{
+		awsClient:          m.awsutils,
+		k8sClient:          m.k8sClient,
+		networkClient:      m.network,
+		dataStore:          ds,
+		enableIPv4:         true,
+		enablePodCarrierIP: true,
+		carrierIPs:         make(map[string]string),
+	}
+}
+
+func TestSetupCarrierIP(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	c := carrierIPTestContext(t, m)
+
+	assert.NoError(t, m.k8sClient.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}))
+	assert.NoError(t, m.k8sClient.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "edge",
+		Namespace:   "default",
+		Annotations: map[string]string{carrierIPAnnotation: "true"},
+	}}))
+
+	// Pods without the annotation keep SNAT to the primary IP
+	assert.NoError(t, c.setupCarrierIP(ctx, "web", "default", "10.0.0.5", 1))
+	assert.Empty(t, c.carrierIPs)
+
+	m.awsutils.EXPECT().AllocateCarrierIP(ctx, "eni-1", "10.0.0.5").Return("155.146.0.10", nil)
+	m.network.EXPECT().SetupCarrierIPRules(net.ParseIP("10.0.0.5")).Return(nil).Times(2)
+	assert.NoError(t, c.setupCarrierIP(ctx, "edge", "default", "10.0.0.5", 1))
+	assert.Equal(t, map[string]string{"10.0.0.5": "155.146.0.10"}, c.carrierIPs)
+	pod, err := c.GetPod("edge", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, "155.146.0.10", pod.Annotations[carrierIPAddressKey])
+
+	// A retried ADD reuses the carrier IP
+	assert.NoError(t, c.setupCarrierIP(ctx, "edge", "default", "10.0.0.5", 1))
+
+}
+
+func TestUnassignCarrierIPPod(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	carrierIPReleaseMinBackoff = time.Millisecond
+	defer func() { carrierIPReleaseMinBackoff = time.Second }()
+	c := carrierIPTestContext(t, m)
+	c.carrierIPs["10.0.0.5"] = "155.146.0.10"
+
+	// The IP stays out of the pool while EC2 fails to release its carrier IP
+	failed := make(chan struct{})
+	released := make(chan struct{})
+	gomock.InOrder(
+		m.awsutils.EXPECT().ReleaseCarrierIP(gomock.Any(), "10.0.0.5").DoAndReturn(func(context.Context, string) error {
+			close(failed)
+			return errors.New("RequestLimitExceeded")
+		}),
+		m.awsutils.EXPECT().ReleaseCarrierIP(gomock.Any(), "10.0.0.5").Return(nil),
+	)
+	m.network.EXPECT().TeardownCarrierIPRules(net.ParseIP("10.0.0.5")).DoAndReturn(func(net.IP) error {
+		close(released)
+		return nil
+	})
+
+	eni, ip, deviceNumber, err := c.unassignCarrierIPPod(datastore.IPAMKey{NetworkName: "net0", ContainerID: "sandbox", IfName: "eth0"}, "")
+	assert.NoError(t, err)
+	assert.Nil(t, eni)
+	assert.Equal(t, "10.0.0.5", ip)
+	assert.Equal(t, 1, deviceNumber)
+	<-failed
+	assert.Equal(t, 1, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+
+	<-released
+	assert.Eventually(t, func() bool {
+		return c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs == 0
+	}, time.Second, time.Millisecond)
+	c.carrierIPLock.Lock()
+	assert.Empty(t, c.carrierIPs)
+	c.carrierIPLock.Unlock()
+
+	// Nothing to release for the pods without a carrier IP
+	_, _, _, err = c.unassignCarrierIPPod(datastore.IPAMKey{NetworkName: "net0", ContainerID: "sandbox", IfName: "eth0"}, "")
+	assert.ErrorIs(t, err, datastore.ErrUnknownPod)
+}
+
+func TestSetupCarrierIPAllocationFailure(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	c := carrierIPTestContext(t, m)
+
+	assert.NoError(t, m.k8sClient.Create(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Name:        "edge",
+		Namespace:   "default",
+		Annotations: map[string]string{carrierIPAnnotation: "true"},
+	}}))
+
+	m.awsutils.EXPECT().AllocateCarrierIP(ctx, "eni-1", "10.0.0.5").Return("", errors.New("AddressLimitExceeded"))
+	assert.Error(t, c.setupCarrierIP(ctx, "edge", "default", "10.0.0.5", 1))
+	assert.Empty(t, c.carrierIPs)
+
+	// The IP of the pod must be on a known ENI
+	assert.Error(t, c.setupCarrierIP(ctx, "edge", "default", "10.0.0.5", 3))
+}
+
+func TestRestoreCarrierIPs(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	c := carrierIPTestContext(t, m)
+
+	m.awsutils.EXPECT().GetCarrierIPs(ctx).Return(map[string][]string{
+		"10.0.0.5": {"155.146.0.10"},
+		"10.0.0.6": {"155.146.0.11"},
+		"":         {"155.146.0.12"},
+	}, nil)
+	// The carrier IPs of the pods deleted while ipamd was down are released
+	m.awsutils.EXPECT().ReleaseCarrierIP(ctx, "10.0.0.6").Return(nil)
+	m.network.EXPECT().TeardownCarrierIPRules(net.ParseIP("10.0.0.6")).Return(nil)
+	m.awsutils.EXPECT().ReleaseCarrierIP(ctx, "").Return(nil)
+	m.network.EXPECT().SetupCarrierIPRules(net.ParseIP("10.0.0.5")).Return(nil)
+
+	c.restoreCarrierIPs(ctx)
+	assert.Equal(t, map[string]string{"10.0.0.5": "155.146.0.10"}, c.carrierIPs)
+}
+
+func TestRestoreHeldCarrierIPs(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	c := carrierIPTestContext(t, m)
+	_, cidr, _ := net.ParseCIDR("10.0.0.6/32")
+	assert.NoError(t, c.dataStore.AddIPv4CidrToStore("eni-1", *cidr, false))
+	// The previous ipamd held both IPs for the release of their carrier IP, and released the one of 10.0.0.6
+	_, err := c.dataStore.ReassignPodIPv4Address("10.0.0.5", datastore.IPAMKey{NetworkName: "net0", ContainerID: "sandbox", IfName: "eth0"},
+		carrierIPReleaseKey("10.0.0.5"), datastore.IPAMMetadata{})
+	assert.NoError(t, err)
+	_, err = c.dataStore.ReassignPodIPv4Address("10.0.0.6", datastore.IPAMKey{}, carrierIPReleaseKey("10.0.0.6"), datastore.IPAMMetadata{})
+	assert.NoError(t, err)
+
+	released := make(chan struct{})
+	m.awsutils.EXPECT().GetCarrierIPs(ctx).Return(map[string][]string{"10.0.0.5": {"155.146.0.10"}}, nil)
+	m.network.EXPECT().SetupCarrierIPRules(net.ParseIP("10.0.0.5")).Return(nil)
+	m.network.EXPECT().TeardownCarrierIPRules(net.ParseIP("10.0.0.6")).Return(nil)
+	m.awsutils.EXPECT().ReleaseCarrierIP(gomock.Any(), "10.0.0.5").Return(nil)
+	m.network.EXPECT().TeardownCarrierIPRules(net.ParseIP("10.0.0.5")).DoAndReturn(func(net.IP) error {
+		close(released)
+		return nil
+	})
+
+	c.restoreCarrierIPs(ctx)
+	<-released
+	assert.Eventually(t, func() bool {
+		return c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs == 0
+	}, time.Second, time.Millisecond)
+}
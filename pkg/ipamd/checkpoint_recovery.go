@@ -0,0 +1,97 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+// recoverCheckpoint rebuilds the allocations of a checkpoint that is missing or cannot be decoded from the pods of the
+// node. The ENIs and their IPs are already in the datastore, as described by EC2, so only the IPs of the pods are
+// missing. Starting empty would give the IPs of the running pods to new ones.
+func (c *IPAMContext) recoverCheckpoint(ctx context.Context) error {
+	allocations, err := c.podAllocations(ctx)
+	if err != nil {
+		// The checkpoint is left in place, the next start tries again
+		return errors.Wrap(err, "failed to list the pods to rebuild the checkpoint")
+	}
+	return c.dataStore.RebuildBackingStore(allocations, c.enableIPv6)
+}
+
+// podAllocations returns the allocations of the running pods of the node that got their IP from ipamd, as they would be
+// checkpointed
+func (c *IPAMContext) podAllocations(ctx context.Context) ([]datastore.CheckpointEntry, error) {
+	pods, err := c.nodePods(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.allocationsOfPods(pods), nil
+}
+
+// nodePods returns the pods of the node that are not terminated
+func (c *IPAMContext) nodePods(ctx context.Context) ([]corev1.Pod, error) {
+	var pods corev1.PodList
+	if err := c.k8sClient.List(ctx, &pods); err != nil {
+		return nil, err
+	}
+	var nodePods []corev1.Pod
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != c.myNodeName || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		nodePods = append(nodePods, pod)
+	}
+	return nodePods, nil
+}
+
+// allocationsOfPods returns the allocations of the pods that got their IP from ipamd
+func (c *IPAMContext) allocationsOfPods(pods []corev1.Pod) []datastore.CheckpointEntry {
+	var allocations []datastore.CheckpointEntry
+	seen := make(map[string]bool)
+	for _, pod := range pods {
+		// Pods with a branch ENI get their IP from the VPC resource controller
+		if _, ok := pod.Annotations[podENIAnnotation]; pod.Spec.HostNetwork || ok {
+			continue
+		}
+		for _, podIP := range pod.Status.PodIPs {
+			ip := net.ParseIP(podIP.IP)
+			if ip == nil || (ip.To4() == nil) != c.enableIPv6 || seen[ip.String()] {
+				continue
+			}
+			seen[ip.String()] = true
+			allocation := datastore.CheckpointEntry{
+				IPAMKey:             datastore.RecoveredIPAMKey(string(pod.UID)),
+				AllocationTimestamp: pod.CreationTimestamp.UnixNano(),
+				Metadata: datastore.IPAMMetadata{
+					K8SPodNamespace: pod.Namespace,
+					K8SPodName:      pod.Name,
+					K8SPodUID:       string(pod.UID),
+				},
+			}
+			if c.enableIPv6 {
+				allocation.IPv6 = ip.String()
+			} else {
+				allocation.IPv4 = ip.String()
+			}
+			allocations = append(allocations, allocation)
+		}
+	}
+	return allocations
+}
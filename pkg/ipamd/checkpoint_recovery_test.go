@@ -0,0 +1,66 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestPodAllocations(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	pod := func(name, nodeName string, phase corev1.PodPhase, ips ...string) *corev1.Pod {
+		p := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+			Spec:       corev1.PodSpec{NodeName: nodeName},
+			Status:     corev1.PodStatus{Phase: phase},
+		}
+		for _, ip := range ips {
+			p.Status.PodIPs = append(p.Status.PodIPs, corev1.PodIP{IP: ip})
+		}
+		return p
+	}
+	hostNetwork := pod("host-network", "node-1", corev1.PodRunning, "10.0.0.100")
+	hostNetwork.Spec.HostNetwork = true
+	branch := pod("branch", "node-1", corev1.PodRunning, "10.0.5.1")
+	branch.Annotations = map[string]string{podENIAnnotation: `[{"eniId":"eni-1","vlanID":1}]`}
+	for _, p := range []*corev1.Pod{
+		pod("running", "node-1", corev1.PodRunning, "10.0.0.1", "2600::1"),
+		pod("completed", "node-1", corev1.PodSucceeded, "10.0.0.2"),
+		pod("elsewhere", "node-2", corev1.PodRunning, "10.0.1.1"),
+		hostNetwork,
+		branch,
+	} {
+		assert.NoError(t, m.k8sClient.Create(ctx, p))
+	}
+
+	c := &IPAMContext{k8sClient: m.k8sClient, myNodeName: "node-1", enableIPv4: true}
+	allocations, err := c.podAllocations(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, allocations, 1)
+	assert.Equal(t, datastore.RecoveredIPAMKey("running-uid"), allocations[0].IPAMKey)
+	assert.Equal(t, "10.0.0.1", allocations[0].IPv4)
+	assert.Equal(t, datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "running", K8SPodUID: "running-uid"},
+		allocations[0].Metadata)
+}
@@ -0,0 +1,109 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	conflistMonitorInterval = 60 * time.Second
+
+	// envConflistStagingDir is the directory where the aws-node entrypoint generates the conflist before installing it
+	// on the host
+	envConflistStagingDir     = "CNI_CONFLIST_STAGING_DIR"
+	defaultConflistStagingDir = "/tmp"
+	envHostCniConfDirPath     = "HOST_CNI_CONFDIR_PATH"
+	defaultHostCniConfDirPath = "/host/etc/cni/net.d"
+	conflistFile              = "/10-aws.conflist"
+
+	conflistModifiedReason = "ConflistModified"
+)
+
+// conflistMonitor detects external modifications of the installed conflist through its embedded checksum
+type conflistMonitor struct {
+	hostPath      string
+	generatedPath string
+	repair        bool
+	// reported and lastReported track the last modified conflist that was reported, so that it is reported only once
+	reported     bool
+	lastReported []byte
+}
+
+// MonitorConflist periodically checks that the installed conflist has not been modified outside of aws-node
+func (c *IPAMContext) MonitorConflist() {
+	m := &conflistMonitor{
+		hostPath:      utils.GetEnv(envHostCniConfDirPath, defaultHostCniConfDirPath) + conflistFile,
+		generatedPath: utils.GetEnv(envConflistStagingDir, defaultConflistStagingDir) + conflistFile,
+		repair:        utils.GetBoolAsStringEnvVar(envEnableConflistDriftRepair, false),
+	}
+	for {
+		time.Sleep(conflistMonitorInterval)
+		m.check()
+	}
+}
+
+// check reports, and repairs if enabled, an installed conflist whose checksum does not match. It returns true if
+// the conflist was modified.
+func (m *conflistMonitor) check() bool {
+	// Nothing to compare against until the entrypoint has generated and installed the conflist
+	generated, err := os.ReadFile(m.generatedPath)
+	if err != nil {
+		return false
+	}
+	installed, err := os.ReadFile(m.hostPath)
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("Failed to read %s: %v", m.hostPath, err)
+		return false
+	}
+	if err == nil {
+		if err = cniutils.VerifyConflistChecksum(installed); err == nil {
+			m.reported = false
+			return false
+		}
+	}
+
+	if m.repair {
+		log.Warnf("%s was modified outside of aws-node (%v), restoring it", m.hostPath, err)
+		if err := os.WriteFile(m.hostPath+".tmp", generated, 0644); err != nil {
+			log.Errorf("Failed to restore %s: %v", m.hostPath, err)
+		} else if err := os.Rename(m.hostPath+".tmp", m.hostPath); err != nil {
+			log.Errorf("Failed to restore %s: %v", m.hostPath, err)
+		}
+		sendConflistEvent("Repair", "CNI conflist "+m.hostPath+" was modified outside of aws-node and has been restored")
+		return true
+	}
+
+	if !m.reported || !bytes.Equal(installed, m.lastReported) {
+		log.Warnf("%s was modified outside of aws-node (%v)", m.hostPath, err)
+		sendConflistEvent("Detect", "CNI conflist "+m.hostPath+" was modified outside of aws-node")
+		m.reported = true
+		m.lastReported = installed
+	}
+	return true
+}
+
+func sendConflistEvent(action, message string) {
+	if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+		eventRecorder.SendPodEvent(v1.EventTypeWarning, conflistModifiedReason, action, message)
+	}
+}
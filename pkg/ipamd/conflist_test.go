@@ -0,0 +1,59 @@
+package ipamd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/cniutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestConflistMonitorCheck(t *testing.T) {
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+	dir := t.TempDir()
+	generated, err := cniutils.AddConflistChecksum([]byte(`{"cniVersion":"0.4.0","name":"aws-cni","plugins":[{"name":"aws-cni","type":"aws-cni"}]}`))
+	assert.NoError(t, err)
+	modified := []byte(`{"cniVersion":"0.4.0","name":"aws-cni","plugins":[{"name":"aws-cni","type":"aws-cni","mtu":"1500"}]}`)
+
+	m := &conflistMonitor{
+		hostPath:      filepath.Join(dir, "10-aws.conflist"),
+		generatedPath: filepath.Join(dir, "generated.conflist"),
+		repair:        true,
+	}
+
+	// Nothing is done before the conflist is generated
+	assert.NoError(t, os.WriteFile(m.hostPath, modified, 0644))
+	assert.False(t, m.check())
+
+	assert.NoError(t, os.WriteFile(m.generatedPath, generated, 0644))
+	assert.NoError(t, os.WriteFile(m.hostPath, generated, 0644))
+	assert.False(t, m.check())
+
+	// A modified conflist is restored
+	assert.NoError(t, os.WriteFile(m.hostPath, modified, 0644))
+	assert.True(t, m.check())
+	installed, err := os.ReadFile(m.hostPath)
+	assert.NoError(t, err)
+	assert.Equal(t, generated, installed)
+	assert.Len(t, fakeRecorder.Events, 1)
+	<-fakeRecorder.Events
+
+	// A deleted conflist is restored
+	assert.NoError(t, os.Remove(m.hostPath))
+	assert.True(t, m.check())
+	assert.FileExists(t, m.hostPath)
+	<-fakeRecorder.Events
+
+	// Without repair, a modified conflist is left in place and reported once
+	m.repair = false
+	assert.NoError(t, os.WriteFile(m.hostPath, modified, 0644))
+	assert.True(t, m.check())
+	assert.True(t, m.check())
+	installed, err = os.ReadFile(m.hostPath)
+	assert.NoError(t, err)
+	assert.Equal(t, modified, installed)
+	assert.Len(t, fakeRecorder.Events, 1)
+}
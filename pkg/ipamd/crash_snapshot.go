@@ -0,0 +1,226 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/awssession"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	// envCrashSnapshotDestination is where ipamd writes a snapshot of its state when it panics or exits on an error, an
+	// s3://bucket/prefix URL or the absolute path of a directory, usually a hostPath volume. Empty disables the snapshots.
+	envCrashSnapshotDestination = "CRASH_SNAPSHOT_DESTINATION"
+
+	// crashSnapshotStateTimeout bounds the wait for the datastore, the crash may have happened while it was locked
+	crashSnapshotStateTimeout = 2 * time.Second
+	// crashSnapshotUploadTimeout bounds the upload, the kubelet restarts the container meanwhile
+	crashSnapshotUploadTimeout = 10 * time.Second
+)
+
+// uploadCrashSnapshot is a variable so that tests do not call S3
+var uploadCrashSnapshot = uploadCrashSnapshotToS3
+
+// crashSnapshotDestination is a parsed CRASH_SNAPSHOT_DESTINATION, with either a bucket or a directory
+type crashSnapshotDestination struct {
+	bucket string
+	prefix string
+	dir    string
+}
+
+// CrashSnapshot is the state of ipamd written when it crashes, the same as its introspection endpoints report
+type CrashSnapshot struct {
+	Time          time.Time                 `json:"time"`
+	Reason        string                    `json:"reason"`
+	Stack         string                    `json:"stack,omitempty"`
+	Version       string                    `json:"version"`
+	NodeName      string                    `json:"nodeName"`
+	InstanceID    string                    `json:"instanceId"`
+	Config        map[string]interface{}    `json:"config"`
+	CNIAddStats   CNIAddStats               `json:"cniAddStats"`
+	EC2Failures   []awsutils.EC2Failure     `json:"ec2Failures,omitempty"`
+	UnmanagedENIs map[string]string         `json:"unmanagedEnis,omitempty"`
+	ENIs          *datastore.ENIInfos       `json:"enis,omitempty"`
+	Datastore     *datastore.CheckpointData `json:"datastore,omitempty"`
+	// StateError explains why the ENIs and the datastore are missing
+	StateError string `json:"stateError,omitempty"`
+}
+
+func parseCrashSnapshotDestination(dest string) (*crashSnapshotDestination, error) {
+	if dest == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(dest, "s3://") {
+		u, err := url.Parse(dest)
+		if err != nil {
+			return nil, err
+		}
+		if u.Host == "" {
+			return nil, errors.Errorf("%q has no bucket", dest)
+		}
+		return &crashSnapshotDestination{bucket: u.Host, prefix: strings.Trim(u.Path, "/")}, nil
+	}
+	if !filepath.IsAbs(dest) {
+		return nil, errors.Errorf("%q is neither an s3:// URL nor an absolute path", dest)
+	}
+	return &crashSnapshotDestination{dir: dest}, nil
+}
+
+// validateCrashSnapshotDestination loads and checks the crash snapshot destination setting
+func (c *IPAMContext) validateCrashSnapshotDestination() bool {
+	dest, err := parseCrashSnapshotDestination(utils.GetEnv(envCrashSnapshotDestination, ""))
+	if err != nil {
+		log.Errorf("Invalid %s: %v", envCrashSnapshotDestination, err)
+		return false
+	}
+	c.crashSnapshotDest = dest
+	return true
+}
+
+// HandleCrashes writes a crash snapshot when a background loop of ipamd panics, before the panic goes on and the
+// process exits. The loops must be started with GoHandlingCrashes, or defer utilruntime.HandleCrash themselves. The
+// panics of the main goroutine are handled by the caller.
+func (c *IPAMContext) HandleCrashes(version string) {
+	if c.crashSnapshotDest == nil {
+		return
+	}
+	utilruntime.PanicHandlers = append(utilruntime.PanicHandlers, func(r interface{}) {
+		c.WriteCrashSnapshot(version, fmt.Sprintf("panic: %v", r), debug.Stack())
+	})
+}
+
+// GoHandlingCrashes runs f in a new goroutine whose panic goes through the handlers of HandleCrashes
+func GoHandlingCrashes(f func()) {
+	go func() {
+		defer utilruntime.HandleCrash()
+		f()
+	}()
+}
+
+// handleRPCCrashes returns a gRPC interceptor that passes the panics of the CNI requests through the handlers of
+// HandleCrashes. The gRPC server runs each request in its own goroutine, which GoHandlingCrashes does not cover.
+func handleRPCCrashes(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	defer utilruntime.HandleCrash()
+	return handler(ctx, req)
+}
+
+// WriteCrashSnapshot writes the state of ipamd to the configured destination, so that it can be analyzed after the
+// node is gone. Errors are only logged, ipamd is exiting anyway.
+func (c *IPAMContext) WriteCrashSnapshot(version, reason string, stack []byte) {
+	if c.crashSnapshotDest == nil {
+		return
+	}
+	snapshot := c.crashSnapshot(version, reason, stack)
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		log.Errorf("Failed to marshal the crash snapshot: %v", err)
+		return
+	}
+	name := fmt.Sprintf("%s-%s.json", c.myNodeName, snapshot.Time.UTC().Format("20060102T150405Z"))
+	dest := c.crashSnapshotDest
+	if dest.dir != "" {
+		err = os.WriteFile(filepath.Join(dest.dir, name), data, 0600)
+		name = filepath.Join(dest.dir, name)
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), crashSnapshotUploadTimeout)
+		defer cancel()
+		name = path.Join(dest.prefix, name)
+		err = uploadCrashSnapshot(ctx, dest.bucket, name, data)
+		name = "s3://" + path.Join(dest.bucket, name)
+	}
+	if err != nil {
+		log.Errorf("Failed to write the crash snapshot to %s: %v", name, err)
+		return
+	}
+	log.Infof("Wrote the crash snapshot to %s", name)
+}
+
+func (c *IPAMContext) crashSnapshot(version, reason string, stack []byte) CrashSnapshot {
+	snapshot := CrashSnapshot{
+		Time:     time.Now(),
+		Reason:   reason,
+		Stack:    string(stack),
+		Version:  version,
+		NodeName: c.myNodeName,
+		Config:   GetConfigForDebug(),
+		CNIAddStats: CNIAddStats{Succeeded: atomic.LoadInt64(&c.cniAddSucceeded), Failed: atomic.LoadInt64(&c.cniAddFailed),
+			CurrentPluginSucceeded: atomic.LoadInt64(&c.cniAddSucceededCurrent), CurrentPluginFailed: atomic.LoadInt64(&c.cniAddFailedCurrent)},
+		UnmanagedENIs: c.UnmanagedENIs(),
+	}
+	if c.awsClient != nil {
+		snapshot.InstanceID = c.awsClient.GetInstanceID()
+		snapshot.EC2Failures = c.awsClient.GetEC2Failures()
+	}
+	if c.dataStore == nil {
+		snapshot.StateError = "the datastore is not initialized"
+		return snapshot
+	}
+
+	type state struct {
+		enis      *datastore.ENIInfos
+		datastore datastore.CheckpointData
+	}
+	states := make(chan state, 1)
+	go func() {
+		states <- state{enis: c.dataStore.GetENIInfos(), datastore: c.dataStore.Snapshot()}
+	}()
+	select {
+	case s := <-states:
+		snapshot.ENIs = s.enis
+		snapshot.Datastore = &s.datastore
+	case <-time.After(crashSnapshotStateTimeout):
+		snapshot.StateError = fmt.Sprintf("the datastore stayed locked for %s", crashSnapshotStateTimeout)
+	}
+	return snapshot
+}
+
+func uploadCrashSnapshotToS3(ctx context.Context, bucket, key string, data []byte) error {
+	sess := awssession.New()
+	region := aws.StringValue(sess.Config.Region)
+	if region == "" {
+		var err error
+		if region, err = ec2metadata.New(sess).RegionWithContext(ctx); err != nil {
+			return errors.Wrap(err, "failed to get the region")
+		}
+	}
+	_, err := s3.New(sess, aws.NewConfig().WithRegion(region)).PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
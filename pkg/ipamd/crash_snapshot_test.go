@@ -0,0 +1,161 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+func TestParseCrashSnapshotDestination(t *testing.T) {
+	for _, tc := range []struct {
+		dest    string
+		want    *crashSnapshotDestination
+		wantErr bool
+	}{
+		{dest: "", want: nil},
+		{dest: "s3://bucket", want: &crashSnapshotDestination{bucket: "bucket"}},
+		{dest: "s3://bucket/crashes/cluster-a/", want: &crashSnapshotDestination{bucket: "bucket", prefix: "crashes/cluster-a"}},
+		{dest: "/var/log/aws-routed-eni/crashes", want: &crashSnapshotDestination{dir: "/var/log/aws-routed-eni/crashes"}},
+		{dest: "s3:///prefix", wantErr: true},
+		{dest: "crashes", wantErr: true},
+	} {
+		t.Run(tc.dest, func(t *testing.T) {
+			dest, err := parseCrashSnapshotDestination(tc.dest)
+			if tc.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, dest)
+		})
+	}
+}
+
+func TestWriteCrashSnapshot(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	failures := []awsutils.EC2Failure{{API: "AssignPrivateIpAddresses", Code: "RequestLimitExceeded", RequestID: "req-1"}}
+	m.awsutils.EXPECT().GetInstanceID().Return(instanceID).Times(2)
+	m.awsutils.EXPECT().GetEC2Failures().Return(failures).Times(2)
+	ds := testDatastore()
+	require.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	require.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr02), Mask: net.CIDRMask(32, 32)}, false))
+
+	dir := t.TempDir()
+	c := &IPAMContext{
+		awsClient:         m.awsutils,
+		dataStore:         ds,
+		myNodeName:        "node-1",
+		crashSnapshotDest: &crashSnapshotDestination{dir: dir},
+	}
+	c.WriteCrashSnapshot("v1.19.0", "panic: boom", []byte("goroutine 1"))
+	files, err := filepath.Glob(filepath.Join(dir, "node-1-*.json"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	var snapshot CrashSnapshot
+	require.NoError(t, json.Unmarshal(data, &snapshot))
+	assert.Equal(t, "panic: boom", snapshot.Reason)
+	assert.Equal(t, "goroutine 1", snapshot.Stack)
+	assert.Equal(t, instanceID, snapshot.InstanceID)
+	assert.Equal(t, failures, snapshot.EC2Failures)
+	require.NotNil(t, snapshot.ENIs)
+	assert.Equal(t, 1, snapshot.ENIs.TotalIPs)
+	assert.Empty(t, snapshot.StateError)
+
+	// The S3 destination puts the snapshot under the prefix
+	defer func(upload func(context.Context, string, string, []byte) error) { uploadCrashSnapshot = upload }(uploadCrashSnapshot)
+	var bucket, key string
+	uploadCrashSnapshot = func(_ context.Context, b, k string, _ []byte) error {
+		bucket, key = b, k
+		return nil
+	}
+	c.crashSnapshotDest = &crashSnapshotDestination{bucket: "bucket", prefix: "crashes"}
+	c.WriteCrashSnapshot("v1.19.0", "failed to set up gRPC handler", nil)
+	assert.Equal(t, "bucket", bucket)
+	assert.Regexp(t, `^crashes/node-1-\d{8}T\d{6}Z\.json$`, key)
+}
+
+func TestHandleCrashes(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	m.awsutils.EXPECT().GetInstanceID().Return(instanceID).AnyTimes()
+	m.awsutils.EXPECT().GetEC2Failures().Return(nil).AnyTimes()
+	defer func(handlers []func(interface{}), reallyCrash bool) {
+		utilruntime.PanicHandlers, utilruntime.ReallyCrash = handlers, reallyCrash
+	}(utilruntime.PanicHandlers, utilruntime.ReallyCrash)
+	// The panic is not raised again, so that the test goes on
+	utilruntime.ReallyCrash = false
+
+	readSnapshot := func(dir string) *CrashSnapshot {
+		files, _ := filepath.Glob(filepath.Join(dir, "node-1-*.json"))
+		if len(files) != 1 {
+			return nil
+		}
+		data, err := os.ReadFile(files[0])
+		if err != nil {
+			return nil
+		}
+		var snapshot CrashSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return nil
+		}
+		return &snapshot
+	}
+
+	// A background loop that panics writes a snapshot
+	loopDir := t.TempDir()
+	c := &IPAMContext{
+		awsClient:         m.awsutils,
+		dataStore:         testDatastore(),
+		myNodeName:        "node-1",
+		crashSnapshotDest: &crashSnapshotDestination{dir: loopDir},
+	}
+	c.HandleCrashes("v1.19.0")
+	GoHandlingCrashes(func() { panic("boom") })
+	var snapshot *CrashSnapshot
+	require.Eventually(t, func() bool {
+		snapshot = readSnapshot(loopDir)
+		return snapshot != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "panic: boom", snapshot.Reason)
+	assert.Contains(t, snapshot.Stack, "TestHandleCrashes")
+
+	// So does a CNI request
+	rpcDir := t.TempDir()
+	c.crashSnapshotDest = &crashSnapshotDestination{dir: rpcDir}
+	_, err := handleRPCCrashes(context.Background(), nil, &grpc.UnaryServerInfo{}, func(context.Context, interface{}) (interface{}, error) {
+		panic("nil ENI")
+	})
+	assert.NoError(t, err)
+	snapshot = readSnapshot(rpcDir)
+	require.NotNil(t, snapshot)
+	assert.Equal(t, "panic: nil ENI", snapshot.Reason)
+}
@@ -0,0 +1,169 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datastore
+
+import (
+	"net"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// AddressSource is where the addresses of a CIDR of the datastore come from. The allocation logic only asks the source
+// of a CIDR whether it can back pods, so that a new source is added without changing it.
+type AddressSource interface {
+	// Name identifies the source in the introspection endpoints
+	Name() string
+	// AddressFamily is "4" or "6"
+	AddressFamily() string
+	// IsPrefix is true when the CIDRs of the source are prefixes rather than single IPs
+	IsPrefix() bool
+	// Usable tells whether the CIDRs of the source back pods, given whether prefix delegation is enabled
+	Usable(isPDEnabled bool) bool
+}
+
+// builtinSource are the IPs and prefixes ipamd assigns to the ENIs of the node
+type builtinSource struct {
+	name   string
+	family string
+	prefix bool
+}
+
+func (s builtinSource) Name() string          { return s.name }
+func (s builtinSource) AddressFamily() string { return s.family }
+func (s builtinSource) IsPrefix() bool        { return s.prefix }
+
+// Usable returns whether the source matches the mode of the node. Both kinds of IPv4 CIDRs can be attached to an ENI
+// during an upgrade or when prefix delegation is toggled, the pods only get IPs from one of them. IPv6 pods only get
+// IPs from prefixes.
+func (s builtinSource) Usable(isPDEnabled bool) bool {
+	if s.family == "6" {
+		return s.prefix
+	}
+	return s.prefix == isPDEnabled
+}
+
+var (
+	// SecondaryIPv4Source are the secondary IPv4 addresses of the ENIs
+	SecondaryIPv4Source AddressSource = builtinSource{name: "secondary-ipv4", family: "4"}
+	// IPv4PrefixSource are the /28 IPv4 prefixes delegated to the ENIs
+	IPv4PrefixSource AddressSource = builtinSource{name: "ipv4-prefix", family: "4", prefix: true}
+	// IPv6PrefixSource are the /80 IPv6 prefixes delegated to the ENIs
+	IPv6PrefixSource AddressSource = builtinSource{name: "ipv6-prefix", family: "6", prefix: true}
+	// IPAMPoolIPv4Source and IPAMPoolIPv4PrefixSource are the secondary IPv4 addresses and the IPv4 prefixes of the
+	// ENIs allocated from an Amazon VPC IP Address Manager pool
+	IPAMPoolIPv4Source       AddressSource = builtinSource{name: "ipam-pool-ipv4", family: "4"}
+	IPAMPoolIPv4PrefixSource AddressSource = builtinSource{name: "ipam-pool-ipv4-prefix", family: "4", prefix: true}
+	// secondaryIPv6Source are the IPv6 addresses of the ENIs, which are not given to pods
+	secondaryIPv6Source AddressSource = builtinSource{name: "secondary-ipv6", family: "6"}
+)
+
+// builtinIPv4Sources are the IPv4 sources of the CIDRs ipamd assigns to the ENIs, by name
+var builtinIPv4Sources = map[string]AddressSource{
+	SecondaryIPv4Source.Name():      SecondaryIPv4Source,
+	IPv4PrefixSource.Name():         IPv4PrefixSource,
+	IPAMPoolIPv4Source.Name():       IPAMPoolIPv4Source,
+	IPAMPoolIPv4PrefixSource.Name(): IPAMPoolIPv4PrefixSource,
+}
+
+// builtinAddressSource returns the source of the CIDRs added by AddIPv4CidrToStore and AddIPv6CidrToStore
+func builtinAddressSource(addressFamily string, isPrefix bool) AddressSource {
+	switch {
+	case addressFamily == "6" && isPrefix:
+		return IPv6PrefixSource
+	case addressFamily == "6":
+		return secondaryIPv6Source
+	case isPrefix:
+		return IPv4PrefixSource
+	default:
+		return SecondaryIPv4Source
+	}
+}
+
+// externalSource are CIDRs allocated to the node outside of ipamd, by an external IPAM
+type externalSource struct {
+	builtinSource
+}
+
+// Usable is true in both modes, the CIDRs of an external IPAM do not depend on prefix delegation
+func (s externalSource) Usable(bool) bool { return true }
+
+// NewExternalSource returns the source of the CIDRs of an external IPAM, the name shows in the introspection endpoints
+func NewExternalSource(name string, addressFamily string, isPrefix bool) AddressSource {
+	return externalSource{builtinSource{name: name, family: addressFamily, prefix: isPrefix}}
+}
+
+// validateCidrSource checks that the CIDR belongs to the address family of its source
+func validateCidrSource(cidr net.IPNet, source AddressSource) error {
+	if source == nil || source.Name() == "" {
+		return errors.New("add CIDR to datastore: missing address source")
+	}
+	isIPv4 := cidr.IP.To4() != nil
+	switch source.AddressFamily() {
+	case "4":
+		if !isIPv4 {
+			return errors.Errorf("add CIDR to datastore: %s is not an IPv4 CIDR of source %s", cidr.String(), source.Name())
+		}
+	case "6":
+		if isIPv4 {
+			return errors.Errorf("add CIDR to datastore: %s is not an IPv6 CIDR of source %s", cidr.String(), source.Name())
+		}
+	default:
+		return errors.Errorf("add CIDR to datastore: unknown address family %q of source %s", source.AddressFamily(), source.Name())
+	}
+	return nil
+}
+
+// PodAddress is an address assigned to a pod, with the ENI, the CIDR and the source it comes from
+type PodAddress struct {
+	IPAMKey      IPAMKey
+	IPAMMetadata IPAMMetadata
+	Address      string
+	ENI          string
+	DeviceNumber int
+	Cidr         string
+	Source       string
+}
+
+// PodAddresses returns the addresses assigned to pods, sorted by address
+func (ds *DataStore) PodAddresses() []PodAddress {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	var addresses []PodAddress
+	for _, eni := range ds.eniPool {
+		for _, cidrs := range []map[string]*CidrInfo{eni.AvailableIPv4Cidrs, eni.IPv6Cidrs} {
+			for _, cidr := range cidrs {
+				for _, addr := range cidr.IPAddresses {
+					if !addr.Assigned() {
+						continue
+					}
+					addresses = append(addresses, PodAddress{
+						IPAMKey:      addr.IPAMKey,
+						IPAMMetadata: addr.IPAMMetadata,
+						Address:      addr.Address,
+						ENI:          eni.ID,
+						DeviceNumber: eni.DeviceNumber,
+						Cidr:         cidr.Cidr.String(),
+						Source:       cidr.addressSource().Name(),
+					})
+				}
+			}
+		}
+	}
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].Address < addresses[j].Address
+	})
+	return addresses
+}
@@ -0,0 +1,114 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datastore
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuiltinAddressSources(t *testing.T) {
+	assert.Equal(t, SecondaryIPv4Source, builtinAddressSource("4", false))
+	assert.Equal(t, IPv4PrefixSource, builtinAddressSource("4", true))
+	assert.Equal(t, IPv6PrefixSource, builtinAddressSource("6", true))
+
+	assert.True(t, SecondaryIPv4Source.Usable(false))
+	assert.False(t, SecondaryIPv4Source.Usable(true))
+	assert.False(t, IPv4PrefixSource.Usable(false))
+	assert.True(t, IPv4PrefixSource.Usable(true))
+	assert.True(t, IPv6PrefixSource.Usable(false))
+	assert.False(t, builtinAddressSource("6", false).Usable(true))
+
+	// A CidrInfo built without a source gets the builtin one
+	cidr := &CidrInfo{AddressFamily: "4", IsPrefix: true}
+	assert.Equal(t, IPv4PrefixSource, cidr.addressSource())
+	assert.True(t, cidr.releasable())
+}
+
+func TestAddCidrToStore(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	assert.NoError(t, ds.AddENI("eni-1", 1, true, false, false))
+	pool := NewExternalSource("ipam-pool", "4", true)
+
+	// The CIDR must belong to the address family of the source
+	err := ds.AddCidrToStore("eni-1", net.IPNet{IP: net.ParseIP("2001:db8::"), Mask: net.CIDRMask(80, 128)}, pool)
+	assert.Error(t, err)
+	err = ds.AddCidrToStore("eni-1", net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)}, nil)
+	assert.Error(t, err)
+
+	cidr := net.IPNet{IP: net.ParseIP("10.1.0.0"), Mask: net.CIDRMask(28, 32)}
+	assert.NoError(t, ds.AddCidrToStore("eni-1", cidr, pool))
+	assert.EqualError(t, ds.AddCidrToStore("eni-1", cidr, pool), IPAlreadyInStoreError)
+	assert.Equal(t, 16, ds.total)
+	assert.Equal(t, 1, ds.allocatedPrefix)
+
+	// The external prefix backs pods even though prefix delegation is disabled
+	key := IPAMKey{"net0", "sandbox-1", "eth0"}
+	ip, device, err := ds.AssignPodIPv4Address(key, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, device)
+	assert.True(t, cidr.Contains(net.ParseIP(ip)))
+	assert.Equal(t, 1, ds.GetIPStats("4").AssignedIPs)
+
+	// ipamd does not release the CIDRs of an external source
+	_, _, _, err = ds.UnassignPodIPAddress(key, "")
+	assert.NoError(t, err)
+	assert.Empty(t, ds.FindFreeableCidrs("eni-1"))
+	assert.Empty(t, ds.FreeablePrefixes("eni-1"))
+	assert.NoError(t, ds.DelIPv4CidrFromStore("eni-1", cidr, false))
+	assert.Equal(t, 0, ds.total)
+}
+
+func TestPodAddresses(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	assert.NoError(t, ds.AddENI("eni-1", 0, true, false, false))
+	assert.NoError(t, ds.AddENI("eni-2", 1, false, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("10.0.0.42"), Mask: net.CIDRMask(32, 32)}, false))
+
+	key1 := IPAMKey{"net0", "sandbox-1", "eth0"}
+	_, _, err := ds.AssignPodIPv4Address(key1, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod-1"})
+	assert.NoError(t, err)
+	// The only secondary IP is taken, the next pod gets an address of the external source
+	assert.NoError(t, ds.AddCidrToStore("eni-2", net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.CIDRMask(32, 32)},
+		NewExternalSource("ipam-pool", "4", false)))
+	key2 := IPAMKey{"net0", "sandbox-2", "eth0"}
+	_, _, err = ds.AssignPodIPv4Address(key2, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod-2"})
+	assert.NoError(t, err)
+
+	assert.Equal(t, []PodAddress{
+		{
+			IPAMKey:      key2,
+			IPAMMetadata: IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod-2"},
+			Address:      "10.0.0.0",
+			ENI:          "eni-2",
+			DeviceNumber: 1,
+			Cidr:         "10.0.0.0/32",
+			Source:       "ipam-pool",
+		},
+		{
+			IPAMKey:      key1,
+			IPAMMetadata: IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod-1"},
+			Address:      "10.0.0.42",
+			ENI:          "eni-1",
+			DeviceNumber: 0,
+			Cidr:         "10.0.0.42/32",
+			Source:       "secondary-ipv4",
+		},
+	}, ds.PodAddresses())
+
+	// The source also shows in the ENIs of the introspection endpoint
+	assert.Equal(t, "ipam-pool", ds.GetENIInfos().ENIs["eni-2"].AvailableIPv4Cidrs["10.0.0.0/32"].Source)
+}
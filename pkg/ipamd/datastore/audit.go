@@ -0,0 +1,117 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datastore
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Audit actions
+const (
+	AuditActionAssign   = "assign"
+	AuditActionUnassign = "unassign"
+)
+
+// Audit requesters
+const (
+	// AuditRequesterCNI is used for changes requested by the CNI plugin through ADD and DEL
+	AuditRequesterCNI = "cni"
+	// AuditRequesterIPAMD is used for changes made by ipamd itself, e.g. when force removing an ENI
+	AuditRequesterIPAMD = "ipamd"
+	// AuditRequesterAdmin is used for changes made through the introspection API
+	AuditRequesterAdmin = "admin"
+)
+
+// AuditEvent is a single line of the IP allocation audit log
+type AuditEvent struct {
+	Timestamp time.Time `json:"timestamp"`
+	Action    string    `json:"action"`
+	Requester string    `json:"requester"`
+	IP        string    `json:"ip"`
+	ENI       string    `json:"eni"`
+	IPAMKey
+	IPAMMetadata
+	// AssignedTime is set on unassign, so that a single line attributes the IP for its full lifetime
+	AssignedTime *time.Time `json:"assignedTime,omitempty"`
+}
+
+// AuditLogger records the IP allocation lifecycle
+type AuditLogger interface {
+	Log(event AuditEvent)
+}
+
+// JSONAuditLog writes audit events as JSON lines
+type JSONAuditLog struct {
+	lock   sync.Mutex
+	writer io.Writer
+}
+
+// NewJSONAuditLog creates a JSONAuditLog appending to the file at path, rotating it when it reaches maxSizeMB
+// and keeping at most maxBackups rotated files
+func NewJSONAuditLog(path string, maxSizeMB, maxBackups int) *JSONAuditLog {
+	return &JSONAuditLog{
+		writer: &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSizeMB,
+			MaxBackups: maxBackups,
+			Compress:   true,
+		},
+	}
+}
+
+// Log implements the AuditLogger interface. Write failures are not returned, the audit log must never
+// block IP allocation.
+func (a *JSONAuditLog) Log(event AuditEvent) {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	_, _ = a.writer.Write(append(line, '\n'))
+}
+
+// SetAuditLogger sets the AuditLogger that records every IP assign and unassign
+func (ds *DataStore) SetAuditLogger(auditLogger AuditLogger) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	ds.auditLog = auditLogger
+}
+
+// auditUnsafe records an assign or unassign of addr on eni. For unassign, it must be called before the
+// address is cleared.
+func (ds *DataStore) auditUnsafe(action, requester string, eni *ENI, addr *AddressInfo) {
+	if ds.auditLog == nil {
+		return
+	}
+	event := AuditEvent{
+		Timestamp:    time.Now(),
+		Action:       action,
+		Requester:    requester,
+		IP:           addr.Address,
+		ENI:          eni.ID,
+		IPAMKey:      addr.IPAMKey,
+		IPAMMetadata: addr.IPAMMetadata,
+	}
+	if action == AuditActionUnassign {
+		assignedTime := addr.AssignedTime
+		event.AssignedTime = &assignedTime
+	}
+	ds.auditLog.Log(event)
+}
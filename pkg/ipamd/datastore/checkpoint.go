@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Checkpointer can persist data and (hopefully) restore it later
@@ -65,7 +66,9 @@ func (c *TestCheckpoint) Restore(into interface{}) error {
 	return json.Unmarshal(buf, into)
 }
 
-// JSONFile is a checkpointer that writes to a JSON file
+// JSONFile is a checkpointer that writes to a JSON file. The file is only ever
+// replaced as a whole, so that a crash or a torn write never leaves the node with
+// a partial or an older checkpoint.
 type JSONFile struct {
 	path string
 }
@@ -83,11 +86,18 @@ func (c *JSONFile) Checkpoint(data interface{}) error {
 	}
 
 	if err := json.NewEncoder(f).Encode(&data); err != nil {
+		f.Close()
 		os.Remove(f.Name())
 		return err
 	}
 
 	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+
+	if err := f.Close(); err != nil {
 		os.Remove(f.Name())
 		return err
 	}
@@ -97,7 +107,8 @@ func (c *JSONFile) Checkpoint(data interface{}) error {
 		return err
 	}
 
-	return nil
+	// A rename lost in a crash would bring back the previous checkpoint, without the IPs assigned since
+	return syncDir(filepath.Dir(c.path))
 }
 
 // Restore implements the Checkpointer interface
@@ -110,3 +121,31 @@ func (c *JSONFile) Restore(into interface{}) error {
 
 	return json.NewDecoder(f).Decode(into)
 }
+
+// Quarantine moves the checkpoint aside, so that it can be diagnosed once the allocation state is rebuilt without it.
+// It returns the path the checkpoint was moved to, or an empty path when there is no checkpoint.
+func (c *JSONFile) Quarantine() (string, error) {
+	path := c.path + ".corrupt-" + time.Now().UTC().Format("20060102T150405Z")
+	if err := os.Rename(c.path, path); err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return path, syncDir(filepath.Dir(c.path))
+}
+
+// Quarantiner is implemented by the checkpointers that can set an unreadable checkpoint aside
+type Quarantiner interface {
+	Quarantine() (string, error)
+}
+
+// syncDir flushes directory entries, so that renames survive a crash
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
@@ -0,0 +1,118 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datastore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONFileCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ipam.json")
+	c := NewJSONFile(path)
+
+	var data CheckpointData
+	assert.True(t, os.IsNotExist(c.Restore(&data)))
+
+	first := CheckpointData{Version: CheckpointFormatVersion, Allocations: []CheckpointEntry{{IPv4: "10.0.0.1"}}}
+	second := CheckpointData{Version: CheckpointFormatVersion, Allocations: []CheckpointEntry{{IPv4: "10.0.0.2"}}}
+	assert.NoError(t, c.Checkpoint(first))
+	assert.NoError(t, c.Checkpoint(second))
+
+	assert.NoError(t, c.Restore(&data))
+	assert.Equal(t, second, data)
+	// Only the checkpoint is left behind, no temporary file nor older checkpoint
+	files, err := filepath.Glob(path + "*")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{path}, files)
+
+	// A torn checkpoint is an error, there is no older checkpoint to fall back to
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "vpc-cni-ip`), 0644))
+	assert.Error(t, c.Restore(&CheckpointData{}))
+}
+
+func TestMigrateCheckpointData(t *testing.T) {
+	allocations := []CheckpointEntry{{IPv4: "10.0.0.1"}}
+	tests := []struct {
+		name    string
+		data    CheckpointData
+		wantErr bool
+	}{
+		{"current version", CheckpointData{Version: CheckpointFormatVersion, Allocations: allocations}, false},
+		{"newer version readable by this one", CheckpointData{Version: "vpc-cni-ipam/2", MinReaderVersion: "vpc-cni-ipam/1", Allocations: allocations}, false},
+		{"newer incompatible version", CheckpointData{Version: "vpc-cni-ipam/2", Allocations: allocations}, true},
+		{"unknown format", CheckpointData{Version: "some-other-ipam/1", Allocations: allocations}, true},
+		{"invalid version number", CheckpointData{Version: "vpc-cni-ipam/x", Allocations: allocations}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := migrateCheckpointData(tt.data)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, CheckpointData{Version: CheckpointFormatVersion, Allocations: allocations}, got)
+		})
+	}
+}
+
+func TestMigrateCheckpointDataThroughVersions(t *testing.T) {
+	// Version 2 renamed the network of the allocations, version 3 added their interface
+	migrations := map[int]func(CheckpointData) (CheckpointData, error){
+		1: func(data CheckpointData) (CheckpointData, error) {
+			for i := range data.Allocations {
+				data.Allocations[i].NetworkName = "aws-cni-v2"
+			}
+			return data, nil
+		},
+		2: func(data CheckpointData) (CheckpointData, error) {
+			for i := range data.Allocations {
+				data.Allocations[i].IfName = "eth0"
+			}
+			return data, nil
+		},
+	}
+	data := CheckpointData{Version: "vpc-cni-ipam/1", Allocations: []CheckpointEntry{{IPv4: "10.0.0.1"}}}
+
+	got, err := migrateCheckpointDataTo(data, 3, migrations)
+	assert.NoError(t, err)
+	assert.Equal(t, CheckpointData{
+		Version: "vpc-cni-ipam/3",
+		Allocations: []CheckpointEntry{{
+			IPAMKey: IPAMKey{NetworkName: "aws-cni-v2", IfName: "eth0"},
+			IPv4:    "10.0.0.1",
+		}},
+	}, got)
+
+	// Data written by version 2 only goes through the last migration
+	data = CheckpointData{Version: "vpc-cni-ipam/2", Allocations: []CheckpointEntry{{IPv4: "10.0.0.1"}}}
+	got, err = migrateCheckpointDataTo(data, 3, migrations)
+	assert.NoError(t, err)
+	assert.Equal(t, IPAMKey{IfName: "eth0"}, got.Allocations[0].IPAMKey)
+
+	delete(migrations, 2)
+	_, err = migrateCheckpointDataTo(data, 3, migrations)
+	assert.EqualError(t, err, "no migration from checkpoint version 2 to 3")
+
+	migrations[2] = func(data CheckpointData) (CheckpointData, error) {
+		return data, errors.New("unknown allocation")
+	}
+	_, err = migrateCheckpointDataTo(data, 3, migrations)
+	assert.EqualError(t, err, "failed to migrate checkpoint from version 2: unknown allocation")
+}
@@ -0,0 +1,87 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package datastore
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// checkpointFormatPrefix is the prefix of every checkpoint version stamp, e.g. "vpc-cni-ipam/1"
+const checkpointFormatPrefix = "vpc-cni-ipam/"
+
+// checkpointMigrations upgrade checkpoint data one format version at a time: checkpointMigrations[v]
+// converts data written in version v to version v+1. When CheckpointFormatVersion is bumped, a migration
+// for the previous version must be appended here.
+var checkpointMigrations = map[int]func(CheckpointData) (CheckpointData, error){}
+
+// parseCheckpointVersion returns the numeric format version of a checkpoint version stamp
+func parseCheckpointVersion(version string) (int, error) {
+	if !strings.HasPrefix(version, checkpointFormatPrefix) {
+		return 0, errors.Errorf("unknown checkpoint format %q", version)
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(version, checkpointFormatPrefix))
+	if err != nil || v < 1 {
+		return 0, errors.Errorf("invalid checkpoint version %q", version)
+	}
+	return v, nil
+}
+
+// migrateCheckpointData converts checkpoint data written by any CNI version into the current format.
+// Older checkpoints are upgraded through checkpointMigrations. Checkpoints written by a newer CNI, for example
+// before a rollback, are accepted as long as they declare the current version as a compatible reader.
+func migrateCheckpointData(data CheckpointData) (CheckpointData, error) {
+	current, err := parseCheckpointVersion(CheckpointFormatVersion)
+	if err != nil {
+		return data, err
+	}
+	return migrateCheckpointDataTo(data, current, checkpointMigrations)
+}
+
+// migrateCheckpointDataTo converts checkpoint data into format version current with the given migrations
+func migrateCheckpointDataTo(data CheckpointData, current int, migrations map[int]func(CheckpointData) (CheckpointData, error)) (CheckpointData, error) {
+	version, err := parseCheckpointVersion(data.Version)
+	if err != nil {
+		return data, err
+	}
+
+	if version > current {
+		minReader := version
+		if data.MinReaderVersion != "" {
+			if minReader, err = parseCheckpointVersion(data.MinReaderVersion); err != nil {
+				return data, err
+			}
+		}
+		if minReader > current {
+			return data, errors.Errorf("checkpoint version %s requires a reader of version %d or newer, this is %d",
+				data.Version, minReader, current)
+		}
+	}
+
+	for ; version < current; version++ {
+		migrate, ok := migrations[version]
+		if !ok {
+			return data, errors.Errorf("no migration from checkpoint version %d to %d", version, version+1)
+		}
+		if data, err = migrate(data); err != nil {
+			return data, errors.Wrapf(err, "failed to migrate checkpoint from version %d", version)
+		}
+	}
+
+	data.Version = checkpointFormatPrefix + strconv.Itoa(current)
+	data.MinReaderVersion = ""
+	return data, nil
+}
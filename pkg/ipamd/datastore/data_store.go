@@ -17,6 +17,7 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -76,9 +77,26 @@ const (
 const backfillNetworkName = "_migrated-from-cri"
 const backfillNetworkIface = "unknown"
 
+// The allocations rebuilt from the pods of the node after the checkpoint was lost are keyed by pod UID, as the sandbox
+// of the pod is not known
+const recoveredNetworkName = "_recovered-from-pods"
+const recoveredNetworkIface = "unknown"
+
 // ErrUnknownPod is an error when there is no pod in data store matching pod name, namespace, sandbox id
 var ErrUnknownPod = errors.New("datastore: unknown pod")
 
+// ErrCorruptCheckpoint is returned by ReadBackingStore when the checkpoint cannot be decoded
+var ErrCorruptCheckpoint = errors.New("datastore: corrupt checkpoint")
+
+// ErrMissingCheckpoint is returned by ReadBackingStore when there is no checkpoint
+var ErrMissingCheckpoint = errors.New("datastore: missing checkpoint")
+
+// ErrReadOnly is returned for new allocations once the node is going away
+var ErrReadOnly = errors.New("datastore: read-only, the node is going away")
+
+// ErrNoAvailableIPs is returned when no ENI of the data store has an unassigned IPv4 address
+var ErrNoAvailableIPs = errors.New("AssignPodIPv4Address: no available IP/Prefix addresses")
+
 // IPAMKey is the IPAM primary key.  Quoting CNI spec:
 //
 //	Plugins that store state should do so using a primary key of
@@ -103,6 +121,8 @@ func (k IPAMKey) String() string {
 type IPAMMetadata struct {
 	K8SPodNamespace string `json:"k8sPodNamespace,omitempty"`
 	K8SPodName      string `json:"k8sPodName,omitempty"`
+	// K8SPodUID is empty for allocations checkpointed by older CNI versions
+	K8SPodUID string `json:"k8sPodUID,omitempty"`
 }
 
 // ENI represents a single ENI. Exported fields will be marshaled for introspection.
@@ -146,6 +166,26 @@ type CidrInfo struct {
 	IsPrefix bool
 	// IP Address Family of the Cidr
 	AddressFamily string
+	// Source is the name of the AddressSource the Cidr comes from
+	Source string
+
+	source AddressSource
+}
+
+// addressSource returns the AddressSource of the Cidr, the CIDRs built outside of the datastore come from the builtin
+// sources
+func (cidr *CidrInfo) addressSource() AddressSource {
+	if cidr.source != nil {
+		return cidr.source
+	}
+	return builtinAddressSource(cidr.AddressFamily, cidr.IsPrefix)
+}
+
+// releasable returns whether ipamd releases the Cidr to EC2 when it is unused, the CIDRs of an external source are
+// removed by whoever added them
+func (cidr *CidrInfo) releasable() bool {
+	_, ok := cidr.addressSource().(builtinSource)
+	return ok
 }
 
 func (cidr *CidrInfo) Size() int {
@@ -229,6 +269,16 @@ func getCooldownPeriod() time.Duration {
 	return time.Duration(cooldownVal) * time.Second
 }
 
+// hasIPInCooling returns true if an IP address of the CIDR was unassigned recently
+func (cidr *CidrInfo) hasIPInCooling(ipCooldownPeriod time.Duration) bool {
+	for _, addr := range cidr.IPAddresses {
+		if addr.inCoolingPeriod(ipCooldownPeriod) {
+			return true
+		}
+	}
+	return false
+}
+
 // InCoolingPeriod checks whether an addr is in ipCooldownPeriod
 func (addr AddressInfo) inCoolingPeriod(ipCooldownPeriod time.Duration) bool {
 	return time.Since(addr.UnassignedTime) <= ipCooldownPeriod
@@ -277,6 +327,11 @@ type DataStore struct {
 	netLink          netlinkwrapper.NetLink
 	isPDEnabled      bool
 	ipCooldownPeriod time.Duration
+	auditLog         AuditLogger
+	readOnly         bool
+	eniInventory     Checkpointer
+	// eniPoolChanged is set when an ENI or a CIDR is added or removed, until the ENI inventory is written
+	eniPoolChanged bool
 }
 
 // ENIInfos contains ENI IP information
@@ -308,8 +363,35 @@ const CheckpointFormatVersion = "vpc-cni-ipam/1"
 // deliberately a "dumb" format since efficiency is less important
 // than version stability here.
 type CheckpointData struct {
-	Version     string            `json:"version"`
-	Allocations []CheckpointEntry `json:"allocations"`
+	Version string `json:"version"`
+	// MinReaderVersion is the oldest format version that can safely read this checkpoint, ignoring
+	// fields it doesn't know about. Empty means only readers of Version can.
+	MinReaderVersion string            `json:"minReaderVersion,omitempty"`
+	Allocations      []CheckpointEntry `json:"allocations"`
+}
+
+// ENIInventory is the format of the stored ENI inventory: the ENIs of the datastore with all their IPs and prefixes,
+// including the warm ones that no pod uses. It only changes with the pool, so it is kept apart from the allocations
+// that are written on every ADD and DEL.
+type ENIInventory struct {
+	Version string          `json:"version"`
+	ENIs    []CheckpointENI `json:"enis"`
+}
+
+// CheckpointENI is an ENI of the datastore and the CIDRs attached to it, as stored in checkpoints
+type CheckpointENI struct {
+	ID           string           `json:"id"`
+	DeviceNumber int              `json:"deviceNumber"`
+	IsPrimary    bool             `json:"isPrimary,omitempty"`
+	IsTrunk      bool             `json:"isTrunk,omitempty"`
+	IsEFA        bool             `json:"isEFA,omitempty"`
+	Cidrs        []CheckpointCidr `json:"cidrs,omitempty"`
+}
+
+// CheckpointCidr is an IP or a prefix of an ENI, with the name of its AddressSource
+type CheckpointCidr struct {
+	Cidr   string `json:"cidr"`
+	Source string `json:"source"`
 }
 
 // CheckpointEntry is a "row" in the conceptual IPAM datastore, as stored
@@ -331,17 +413,91 @@ func (ds *DataStore) ReadBackingStore(isv6Enabled bool) error {
 	ds.log.Infof("Begin ipam state recovery from backing store")
 
 	if err := ds.backingStore.Restore(&data); err != nil {
-		// Assume that no file == no containers are currently in use, e.g. a fresh reboot just cleared everything out.
-		// This is ok, and no-op.
+		// No file is expected on a new node or after a reboot, but the pods of the node tell whether it was lost
 		if os.IsNotExist(err) {
-			ds.log.Debugf("backing store doesn't exists, assuming bootstrap on a new node")
-			return nil
+			return ErrMissingCheckpoint
+		}
+		// The file could be read but not decoded
+		var pathErr *os.PathError
+		if !errors.As(err, &pathErr) {
+			return errors.Wrap(ErrCorruptCheckpoint, err.Error())
 		}
 		return errors.Wrap(err, "failed ipam state recovery from backing store")
 	}
-	if data.Version != CheckpointFormatVersion {
-		return errors.Errorf("failed ipam state recovery due to unexpected checkpointVersion: %v/%v", data.Version, CheckpointFormatVersion)
+	data, err := migrateCheckpointData(data)
+	if err != nil {
+		return errors.Wrap(err, "failed ipam state recovery")
+	}
+	return ds.restoreCheckpointData(data, isv6Enabled)
+}
+
+// ReadENIInventory returns the ENIs recorded in the ENI inventory with their IPs and prefixes, so that they can be set
+// up again without describing them. It returns no ENIs when there is no inventory.
+func (ds *DataStore) ReadENIInventory() ([]CheckpointENI, error) {
+	if ds.eniInventory == nil {
+		return nil, nil
+	}
+	var inventory ENIInventory
+	if err := ds.eniInventory.Restore(&inventory); err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err, "failed to read the ENI inventory")
 	}
+	if inventory.Version != CheckpointFormatVersion {
+		return nil, errors.Errorf("unsupported ENI inventory version %q", inventory.Version)
+	}
+	return inventory.ENIs, nil
+}
+
+// RestoreENICidrs adds the IPv4 addresses and prefixes of an ENI read by ReadENIInventory back to the datastore.
+// The ENI must have been added already. The CIDRs of sources other than the builtin IPv4 ones are skipped, their
+// owner adds them again. Returns the number of CIDRs added.
+func (ds *DataStore) RestoreENICidrs(eni CheckpointENI) (int, error) {
+	restored := 0
+	for _, checkpointCidr := range eni.Cidrs {
+		source, ok := builtinIPv4Sources[checkpointCidr.Source]
+		if !ok {
+			ds.log.Debugf("Not restoring %s of ENI %s from source %s", checkpointCidr.Cidr, eni.ID, checkpointCidr.Source)
+			continue
+		}
+		_, cidr, err := net.ParseCIDR(checkpointCidr.Cidr)
+		if err != nil {
+			return restored, errors.Wrapf(err, "invalid CIDR of ENI %s in the backing store", eni.ID)
+		}
+		err = ds.AddCidrToStore(eni.ID, *cidr, source)
+		if err != nil && err.Error() != IPAlreadyInStoreError {
+			return restored, err
+		}
+		restored++
+	}
+	return restored, nil
+}
+
+// RecoveredIPAMKey is the key of the allocation of a pod rebuilt by RebuildBackingStore
+func RecoveredIPAMKey(podUID string) IPAMKey {
+	return IPAMKey{NetworkName: recoveredNetworkName, ContainerID: podUID, IfName: recoveredNetworkIface}
+}
+
+// RebuildBackingStore replaces a checkpoint that is missing or cannot be read with the given allocations, keyed by
+// RecoveredIPAMKey. The corrupt checkpoint is quarantined for diagnosis. The allocations are filtered like those of a checkpoint, the
+// pods without a host-side veth are dropped.
+func (ds *DataStore) RebuildBackingStore(allocations []CheckpointEntry, isv6Enabled bool) error {
+	if q, ok := ds.backingStore.(Quarantiner); ok {
+		path, err := q.Quarantine()
+		if err != nil {
+			return errors.Wrap(err, "failed to quarantine the corrupt checkpoint")
+		}
+		if path != "" {
+			ds.log.Warnf("Quarantined the corrupt checkpoint to %s", path)
+		}
+	}
+	ds.log.Infof("Rebuilding the ipam state from %d pods", len(allocations))
+	return ds.restoreCheckpointData(CheckpointData{Version: CheckpointFormatVersion, Allocations: allocations}, isv6Enabled)
+}
+
+// restoreCheckpointData assigns the IPs of the allocations of the checkpoint, then writes it back
+func (ds *DataStore) restoreCheckpointData(data CheckpointData, isv6Enabled bool) error {
 	if normalizedData, err := ds.normalizeCheckpointDataByPodVethExistence(data); err != nil {
 		return errors.Wrap(err, "failed normalize checkpoint data with veth check")
 	} else {
@@ -401,7 +557,44 @@ func (ds *DataStore) ReadBackingStore(isv6Enabled bool) error {
 	return nil
 }
 
+// WriteBackingStore writes the current allocations to the backing store
+func (ds *DataStore) WriteBackingStore() error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return ds.writeBackingStoreUnsafe()
+}
+
 func (ds *DataStore) writeBackingStoreUnsafe() error {
+	data := ds.checkpointDataUnsafe()
+	return ds.backingStore.Checkpoint(&data)
+}
+
+// SetENIInventory sets where the ENIs of the datastore are recorded, to warm start the next ipamd from them
+func (ds *DataStore) SetENIInventory(eniInventory Checkpointer) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	ds.eniInventory = eniInventory
+	ds.eniPoolChanged = true
+}
+
+// WriteENIInventory writes the ENIs of the datastore to the ENI inventory, if an ENI or a CIDR was added or removed
+// since it was last written
+func (ds *DataStore) WriteENIInventory() error {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	if ds.eniInventory == nil || !ds.eniPoolChanged {
+		return nil
+	}
+	inventory := ENIInventory{Version: CheckpointFormatVersion, ENIs: ds.checkpointENIsUnsafe()}
+	if err := ds.eniInventory.Checkpoint(&inventory); err != nil {
+		return err
+	}
+	ds.eniPoolChanged = false
+	return nil
+}
+
+// checkpointDataUnsafe returns all current allocations in checkpoint format
+func (ds *DataStore) checkpointDataUnsafe() CheckpointData {
 	allocations := make([]CheckpointEntry, 0, ds.assigned)
 
 	for _, eni := range ds.eniPool {
@@ -435,12 +628,121 @@ func (ds *DataStore) writeBackingStoreUnsafe() error {
 		}
 	}
 
-	data := CheckpointData{
+	return CheckpointData{
 		Version:     CheckpointFormatVersion,
 		Allocations: allocations,
 	}
+}
 
-	return ds.backingStore.Checkpoint(&data)
+// checkpointENIsUnsafe returns the ENIs and their CIDRs in checkpoint format, sorted so that the inventory only
+// changes with them
+func (ds *DataStore) checkpointENIsUnsafe() []CheckpointENI {
+	enis := make([]CheckpointENI, 0, len(ds.eniPool))
+	for _, eni := range ds.eniPool {
+		checkpointENI := CheckpointENI{
+			ID:           eni.ID,
+			DeviceNumber: eni.DeviceNumber,
+			IsPrimary:    eni.IsPrimary,
+			IsTrunk:      eni.IsTrunk,
+			IsEFA:        eni.IsEFA,
+		}
+		for _, cidrs := range []map[string]*CidrInfo{eni.AvailableIPv4Cidrs, eni.IPv6Cidrs} {
+			for _, cidr := range cidrs {
+				checkpointENI.Cidrs = append(checkpointENI.Cidrs, CheckpointCidr{
+					Cidr:   cidr.Cidr.String(),
+					Source: cidr.addressSource().Name(),
+				})
+			}
+		}
+		sort.Slice(checkpointENI.Cidrs, func(i, j int) bool {
+			return checkpointENI.Cidrs[i].Cidr < checkpointENI.Cidrs[j].Cidr
+		})
+		enis = append(enis, checkpointENI)
+	}
+	sort.Slice(enis, func(i, j int) bool { return enis[i].ID < enis[j].ID })
+	return enis
+}
+
+// Snapshot returns a consistent copy of all IP allocations, in the same format as the backing store.
+func (ds *DataStore) Snapshot() CheckpointData {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return ds.checkpointDataUnsafe()
+}
+
+// MergeSnapshot restores the allocations of a snapshot taken with Snapshot into the data store. Allocations are
+// only restored if their IP belongs to an ENI in the data store and is free, and their sandbox doesn't hold an
+// IP already. Everything else is skipped. Returns the number of restored allocations.
+func (ds *DataStore) MergeSnapshot(data CheckpointData, isv6Enabled bool) (int, error) {
+	data, err := migrateCheckpointData(data)
+	if err != nil {
+		return 0, err
+	}
+
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.readOnly {
+		return 0, ErrReadOnly
+	}
+	restored := 0
+	for _, allocation := range data.Allocations {
+		if _, _, addr := ds.eniPool.FindAddressForSandbox(allocation.IPAMKey); addr != nil {
+			ds.log.Infof("MergeSnapshot: sandbox %s already has IP %s, skipping", allocation.IPAMKey, addr.Address)
+			continue
+		}
+		ipAddr := net.ParseIP(allocation.IPv4)
+		if isv6Enabled {
+			ipAddr = net.ParseIP(allocation.IPv6)
+		}
+		if ipAddr == nil {
+			continue
+		}
+		eni, cidr, addr := ds.findOrAddAddressUnsafe(ipAddr, isv6Enabled)
+		if addr == nil {
+			ds.log.Infof("MergeSnapshot: IP %s of sandbox %s is not in the data store, skipping", ipAddr, allocation.IPAMKey)
+			continue
+		}
+		if addr.Assigned() {
+			ds.log.Infof("MergeSnapshot: IP %s of sandbox %s is assigned to %s, skipping", ipAddr, allocation.IPAMKey, addr.IPAMKey)
+			continue
+		}
+		ds.assignPodIPAddressUnsafe(addr, allocation.IPAMKey, allocation.Metadata, time.Unix(0, allocation.AllocationTimestamp))
+		prometheusmetrics.EniIPsInUse.WithLabelValues(eni.ID).Inc()
+		prometheusmetrics.IpsPerCidr.With(prometheus.Labels{"cidr": cidr.Cidr.String()}).Inc()
+		ds.auditUnsafe(AuditActionAssign, AuditRequesterAdmin, eni, addr)
+		restored++
+	}
+
+	if restored > 0 {
+		if err := ds.writeBackingStoreUnsafe(); err != nil {
+			return restored, errors.Wrap(err, "failed to write backing store after merging snapshot")
+		}
+	}
+	return restored, nil
+}
+
+// findOrAddAddressUnsafe returns the AddressInfo of ipAddr if it belongs to a CIDR of an ENI in the data store,
+// adding it to the CIDR if the IP has never been handed out. Returns nils if no CIDR contains ipAddr.
+func (ds *DataStore) findOrAddAddressUnsafe(ipAddr net.IP, isv6Enabled bool) (*ENI, *CidrInfo, *AddressInfo) {
+	for _, eni := range ds.eniPool {
+		eniCidrs := eni.AvailableIPv4Cidrs
+		if isv6Enabled {
+			eniCidrs = eni.IPv6Cidrs
+		}
+		for _, cidr := range eniCidrs {
+			if !cidr.Cidr.Contains(ipAddr) {
+				continue
+			}
+			addr, ok := cidr.IPAddresses[ipAddr.String()]
+			if !ok {
+				addr = &AddressInfo{Address: ipAddr.String()}
+				cidr.IPAddresses[ipAddr.String()] = addr
+			}
+			return eni, cidr, addr
+		}
+	}
+	return nil, nil, nil
 }
 
 // AddENI add ENI to data store
@@ -462,6 +764,7 @@ func (ds *DataStore) AddENI(eniID string, deviceNumber int, isPrimary, isTrunk,
 		ID:                 eniID,
 		DeviceNumber:       deviceNumber,
 		AvailableIPv4Cidrs: make(map[string]*CidrInfo)}
+	ds.eniPoolChanged = true
 
 	prometheusmetrics.Enis.Set(float64(len(ds.eniPool)))
 	// Initialize ENI IPs In Use to 0 when an ENI is created
@@ -471,40 +774,57 @@ func (ds *DataStore) AddENI(eniID string, deviceNumber int, isPrimary, isTrunk,
 
 // AddIPv4AddressToStore adds IPv4 CIDR of an ENI to data store
 func (ds *DataStore) AddIPv4CidrToStore(eniID string, ipv4Cidr net.IPNet, isPrefix bool) error {
+	return ds.AddCidrToStore(eniID, ipv4Cidr, builtinAddressSource("4", isPrefix))
+}
+
+// AddCidrToStore adds a CIDR of an ENI from the given source to data store
+func (ds *DataStore) AddCidrToStore(eniID string, cidr net.IPNet, source AddressSource) error {
+	if err := validateCidrSource(cidr, source); err != nil {
+		return err
+	}
+
 	ds.lock.Lock()
 	defer ds.lock.Unlock()
 
-	strIPv4Cidr := ipv4Cidr.String()
-	ds.log.Infof("Adding %s to DS for %s", strIPv4Cidr, eniID)
+	strCidr := cidr.String()
+	ds.log.Infof("Adding %s from %s to DS for %s", strCidr, source.Name(), eniID)
 	curENI, ok := ds.eniPool[eniID]
 	if !ok {
 		ds.log.Infof("unknown ENI")
 		return errors.New("add ENI's IP to datastore: unknown ENI")
 	}
+	if source.AddressFamily() == "6" && curENI.IPv6Cidrs == nil {
+		curENI.IPv6Cidrs = make(map[string]*CidrInfo)
+	}
+	cidrs := curENI.AvailableIPv4Cidrs
+	if source.AddressFamily() == "6" {
+		cidrs = curENI.IPv6Cidrs
+	}
 	// Already there
-	_, ok = curENI.AvailableIPv4Cidrs[strIPv4Cidr]
-	if ok {
+	if _, ok = cidrs[strCidr]; ok {
 		ds.log.Infof("IP already in DS")
 		return errors.New(IPAlreadyInStoreError)
 	}
 
 	newCidrInfo := &CidrInfo{
-		Cidr:          ipv4Cidr,
+		Cidr:          cidr,
 		IPAddresses:   make(map[string]*AddressInfo),
-		IsPrefix:      isPrefix,
-		AddressFamily: "4",
+		IsPrefix:      source.IsPrefix(),
+		AddressFamily: source.AddressFamily(),
+		Source:        source.Name(),
+		source:        source,
 	}
-
-	curENI.AvailableIPv4Cidrs[strIPv4Cidr] = newCidrInfo
+	cidrs[strCidr] = newCidrInfo
+	ds.eniPoolChanged = true
 
 	ds.total += newCidrInfo.Size()
-	if isPrefix {
+	if newCidrInfo.IsPrefix {
 		ds.allocatedPrefix++
 		prometheusmetrics.TotalPrefixes.Set(float64(ds.allocatedPrefix))
 	}
 	prometheusmetrics.TotalIPs.Set(float64(ds.total))
 
-	ds.log.Infof("Added ENI(%s)'s IP/Prefix %s to datastore", eniID, strIPv4Cidr)
+	ds.log.Infof("Added ENI(%s)'s IP/Prefix %s to datastore", eniID, strCidr)
 	return nil
 }
 
@@ -536,6 +856,7 @@ func (ds *DataStore) DelIPv4CidrFromStore(eniID string, cidr net.IPNet, force bo
 				return errors.New(IPInUseError)
 			}
 			prometheusmetrics.ForceRemovedIPs.Inc()
+			ds.auditUnsafe(AuditActionUnassign, AuditRequesterIPAMD, curENI, addr)
 			ds.unassignPodIPAddressUnsafe(addr)
 			updateBackingStore = true
 		}
@@ -553,6 +874,7 @@ func (ds *DataStore) DelIPv4CidrFromStore(eniID string, cidr net.IPNet, force bo
 	}
 	prometheusmetrics.TotalIPs.Set(float64(ds.total))
 	delete(curENI.AvailableIPv4Cidrs, strIPv4Cidr)
+	ds.eniPoolChanged = true
 	ds.log.Infof("Deleted ENI(%s)'s IP/Prefix %s from datastore", eniID, strIPv4Cidr)
 
 	return nil
@@ -560,44 +882,7 @@ func (ds *DataStore) DelIPv4CidrFromStore(eniID string, cidr net.IPNet, force bo
 
 // AddIPv6AddressToStore adds IPv6 CIDR of an ENI to data store
 func (ds *DataStore) AddIPv6CidrToStore(eniID string, ipv6Cidr net.IPNet, isPrefix bool) error {
-	ds.lock.Lock()
-	defer ds.lock.Unlock()
-
-	strIPv6Cidr := ipv6Cidr.String()
-	ds.log.Debugf("Adding %s to DS for %s", strIPv6Cidr, eniID)
-	curENI, ok := ds.eniPool[eniID]
-	ds.log.Debugf("ENI in pool %s", ok)
-
-	if !ok {
-		ds.log.Debugf("unkown ENI")
-		return errors.New("add ENI's IP to datastore: unknown ENI")
-	}
-	// Check if already present in datastore.
-	_, ok = curENI.IPv6Cidrs[strIPv6Cidr]
-	ds.log.Debugf("IP not in  DS")
-	if ok {
-		ds.log.Debugf("IPv6 prefix %s already in DS", strIPv6Cidr)
-		return errors.New(IPAlreadyInStoreError)
-	}
-
-	ds.log.Debugf("Assigning IPv6CIDRs")
-	if curENI.IPv6Cidrs == nil {
-		curENI.IPv6Cidrs = make(map[string]*CidrInfo)
-	}
-	curENI.IPv6Cidrs[strIPv6Cidr] = &CidrInfo{
-		Cidr:          ipv6Cidr,
-		IPAddresses:   make(map[string]*AddressInfo),
-		IsPrefix:      isPrefix,
-		AddressFamily: "6",
-	}
-	ds.total += curENI.IPv6Cidrs[strIPv6Cidr].Size()
-	if isPrefix {
-		ds.allocatedPrefix++
-	}
-	prometheusmetrics.TotalIPs.Set(float64(ds.total))
-
-	ds.log.Debugf("Added ENI(%s)'s IP/Prefix %s to datastore", eniID, strIPv6Cidr)
-	return nil
+	return ds.AddCidrToStore(eniID, ipv6Cidr, builtinAddressSource("6", isPrefix))
 }
 
 func (ds *DataStore) AssignPodIPAddress(ipamKey IPAMKey, ipamMetadata IPAMMetadata, isIPv4Enabled bool, isIPv6Enabled bool) (ipv4Address string,
@@ -625,6 +910,9 @@ func (ds *DataStore) AssignPodIPv6Address(ipamKey IPAMKey, ipamMetadata IPAMMeta
 		ds.log.Infof("AssignPodIPv6Address: duplicate pod assign for sandbox %s", ipamKey)
 		return addr.Address, eni.DeviceNumber, nil
 	}
+	if ds.readOnly {
+		return "", -1, ErrReadOnly
+	}
 
 	// In IPv6 Prefix Delegation mode, eniPool will only have Primary ENI.
 	for _, eni := range ds.eniPool {
@@ -632,7 +920,7 @@ func (ds *DataStore) AssignPodIPv6Address(ipamKey IPAMKey, ipamMetadata IPAMMeta
 			continue
 		}
 		for _, V6Cidr := range eni.IPv6Cidrs {
-			if !V6Cidr.IsPrefix {
+			if !V6Cidr.addressSource().Usable(ds.isPDEnabled) {
 				continue
 			}
 			ipv6Address, err = ds.getFreeIPv6AddrFromCidr(V6Cidr)
@@ -657,6 +945,7 @@ func (ds *DataStore) AssignPodIPv6Address(ipamKey IPAMKey, ipamMetadata IPAMMeta
 			}
 			// Increment ENI IP usage on pod IPv6 allocation
 			prometheusmetrics.EniIPsInUse.WithLabelValues(eni.ID).Inc()
+			ds.auditUnsafe(AuditActionAssign, AuditRequesterCNI, eni, addr)
 			return addr.Address, eni.DeviceNumber, nil
 		}
 	}
@@ -676,6 +965,9 @@ func (ds *DataStore) AssignPodIPv4Address(ipamKey IPAMKey, ipamMetadata IPAMMeta
 		ds.log.Infof("AssignPodIPv4Address: duplicate pod assign for sandbox %s", ipamKey)
 		return addr.Address, eni.DeviceNumber, nil
 	}
+	if ds.readOnly {
+		return "", -1, ErrReadOnly
+	}
 
 	for _, eni := range ds.eniPool {
 		for _, availableCidr := range eni.AvailableIPv4Cidrs {
@@ -683,7 +975,7 @@ func (ds *DataStore) AssignPodIPv4Address(ipamKey IPAMKey, ipamMetadata IPAMMeta
 			var strPrivateIPv4 string
 			var err error
 
-			if (ds.isPDEnabled && availableCidr.IsPrefix) || (!ds.isPDEnabled && !availableCidr.IsPrefix) {
+			if availableCidr.addressSource().Usable(ds.isPDEnabled) {
 				strPrivateIPv4, err = ds.getFreeIPv4AddrfromCidr(availableCidr)
 				if err != nil {
 					ds.log.Debugf("Unable to get IP address from CIDR: %v", err)
@@ -725,6 +1017,7 @@ func (ds *DataStore) AssignPodIPv4Address(ipamKey IPAMKey, ipamMetadata IPAMMeta
 			}
 			// Increment ENI IP usage on pod IPv4 allocation
 			prometheusmetrics.EniIPsInUse.WithLabelValues(eni.ID).Inc()
+			ds.auditUnsafe(AuditActionAssign, AuditRequesterCNI, eni, addr)
 			return addr.Address, eni.DeviceNumber, nil
 		}
 		ds.log.Debugf("AssignPodIPv4Address: ENI %s does not have available addresses", eni.ID)
@@ -732,7 +1025,42 @@ func (ds *DataStore) AssignPodIPv4Address(ipamKey IPAMKey, ipamMetadata IPAMMeta
 
 	prometheusmetrics.NoAvailableIPAddrs.Inc()
 	ds.log.Errorf("DataStore has no available IP/Prefix addresses")
-	return "", -1, errors.New("AssignPodIPv4Address: no available IP/Prefix addresses")
+	return "", -1, ErrNoAvailableIPs
+}
+
+// PreviewPodIPAddress returns the address AssignPodIPAddress would assign to a new pod, without assigning it. The ENIs
+// and their CIDRs are tried in no particular order, so the pod may get another free address of the same kind.
+func (ds *DataStore) PreviewPodIPAddress(isIPv4Enabled bool, isIPv6Enabled bool) (PodAddress, error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	if ds.readOnly {
+		return PodAddress{}, ErrReadOnly
+	}
+	if !isIPv4Enabled && isIPv6Enabled && !ds.isPDEnabled {
+		return PodAddress{}, fmt.Errorf("PD is not enabled. V6 is only supported in PD mode")
+	}
+	for _, eni := range ds.eniPool {
+		cidrs := eni.AvailableIPv4Cidrs
+		if !isIPv4Enabled {
+			cidrs = eni.IPv6Cidrs
+		}
+		for _, cidr := range cidrs {
+			if !cidr.addressSource().Usable(ds.isPDEnabled) {
+				continue
+			}
+			if address, ok := cidr.peekUnusedIP(ds.ipCooldownPeriod); ok {
+				return PodAddress{
+					Address:      address,
+					ENI:          eni.ID,
+					DeviceNumber: eni.DeviceNumber,
+					Cidr:         cidr.Cidr.String(),
+					Source:       cidr.addressSource().Name(),
+				}, nil
+			}
+		}
+	}
+	return PodAddress{}, ErrNoAvailableIPs
 }
 
 // assignPodIPAddressUnsafe mark Address as assigned.
@@ -802,7 +1130,7 @@ func (ds *DataStore) GetIPStats(addressFamily string) *DataStoreStats {
 			AssignedCIDRs = eni.IPv6Cidrs
 		}
 		for _, cidr := range AssignedCIDRs {
-			if addressFamily == "4" && ((ds.isPDEnabled && cidr.IsPrefix) || (!ds.isPDEnabled && !cidr.IsPrefix)) {
+			if addressFamily == "4" && cidr.addressSource().Usable(ds.isPDEnabled) {
 				cidrStats := cidr.GetIPStatsFromCidr(ds.ipCooldownPeriod)
 				stats.AssignedIPs += cidrStats.AssignedIPs
 				stats.CooldownIPs += cidrStats.CooldownIPs
@@ -816,6 +1144,65 @@ func (ds *DataStore) GetIPStats(addressFamily string) *DataStoreStats {
 	return stats
 }
 
+// PrefixStats counts the prefixes of an ENI by how much of them is used, by assigned IPs or IPs in cooldown
+type PrefixStats struct {
+	// Empty prefixes can be released
+	Empty   int
+	Partial int
+	Full    int
+	// FreeIPsInPartial are the free IPs of the partially used prefixes, which keep the prefixes from being released
+	FreeIPsInPartial int
+}
+
+// ENIStats are the IP stats of an ENI
+type ENIStats struct {
+	DataStoreStats
+	Prefixes PrefixStats
+}
+
+// GetENIStats returns the ENIStats of each ENI for addressFamily, counting the same addresses as GetIPStats
+func (ds *DataStore) GetENIStats(addressFamily string) map[string]*ENIStats {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	enis := make(map[string]*ENIStats, len(ds.eniPool))
+	for _, eni := range ds.eniPool {
+		stats := &ENIStats{}
+		enis[eni.ID] = stats
+		AssignedCIDRs := eni.AvailableIPv4Cidrs
+		if addressFamily == "6" {
+			AssignedCIDRs = eni.IPv6Cidrs
+		}
+		for _, cidr := range AssignedCIDRs {
+			var cidrStats CidrStats
+			if addressFamily == "4" && cidr.addressSource().Usable(ds.isPDEnabled) {
+				cidrStats = cidr.GetIPStatsFromCidr(ds.ipCooldownPeriod)
+			} else if addressFamily == "6" {
+				cidrStats = CidrStats{AssignedIPs: cidr.AssignedIPAddressesInCidr()}
+			} else {
+				continue
+			}
+			stats.AssignedIPs += cidrStats.AssignedIPs
+			stats.CooldownIPs += cidrStats.CooldownIPs
+			stats.TotalIPs += cidr.Size()
+			if !cidr.IsPrefix {
+				continue
+			}
+			stats.TotalPrefixes++
+			switch used := cidrStats.AssignedIPs + cidrStats.CooldownIPs; {
+			case used == 0:
+				stats.Prefixes.Empty++
+			case used < cidr.Size():
+				stats.Prefixes.Partial++
+				stats.Prefixes.FreeIPsInPartial += cidr.Size() - used
+			default:
+				stats.Prefixes.Full++
+			}
+		}
+	}
+	return enis
+}
+
 // GetTrunkENI returns the trunk ENI ID or an empty string
 func (ds *DataStore) GetTrunkENI() string {
 	ds.lock.Lock()
@@ -847,7 +1234,7 @@ func (ds *DataStore) isRequiredForWarmIPTarget(warmIPTarget int, eni *ENI) bool
 	for _, other := range ds.eniPool {
 		if other.ID != eni.ID {
 			for _, otherPrefixes := range other.AvailableIPv4Cidrs {
-				if (ds.isPDEnabled && otherPrefixes.IsPrefix) || (!ds.isPDEnabled && !otherPrefixes.IsPrefix) {
+				if otherPrefixes.addressSource().Usable(ds.isPDEnabled) {
 					otherWarmIPs += otherPrefixes.Size() - otherPrefixes.AssignedIPAddressesInCidr()
 				}
 			}
@@ -868,7 +1255,7 @@ func (ds *DataStore) isRequiredForMinimumIPTarget(minimumIPTarget int, eni *ENI)
 	for _, other := range ds.eniPool {
 		if other.ID != eni.ID {
 			for _, otherPrefixes := range other.AvailableIPv4Cidrs {
-				if (ds.isPDEnabled && otherPrefixes.IsPrefix) || (!ds.isPDEnabled && !otherPrefixes.IsPrefix) {
+				if otherPrefixes.addressSource().Usable(ds.isPDEnabled) {
 					otherIPs += otherPrefixes.Size()
 				}
 			}
@@ -959,10 +1346,8 @@ func (e *ENI) isTooYoung() bool {
 // HasIPInCooling returns true if an IP address was unassigned recently.
 func (e *ENI) hasIPInCooling(ipCooldownPeriod time.Duration) bool {
 	for _, assignedaddr := range e.AvailableIPv4Cidrs {
-		for _, addr := range assignedaddr.IPAddresses {
-			if addr.inCoolingPeriod(ipCooldownPeriod) {
-				return true
-			}
+		if assignedaddr.hasIPInCooling(ipCooldownPeriod) {
+			return true
 		}
 	}
 	return false
@@ -991,6 +1376,48 @@ func (ds *DataStore) GetENINeedsIP(maxIPperENI int, skipPrimary bool) *ENI {
 	return nil
 }
 
+// GetWarmIPRebalance finds warm IPs to move from the ENI with the fewest pods to the ENI with the most pods that has room
+// for more IPs, so that new pods land on the busy ENIs and the others can drain. It returns the two ENIs and the number
+// of IPs to move, or 0 if there is nothing to move.
+func (ds *DataStore) GetWarmIPRebalance(maxIPperENI int, skipPrimary bool) (donor, recipient string, count int) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	if ds.isPDEnabled {
+		return "", "", 0
+	}
+
+	donorPods, recipientPods, donorWarmIPs := 0, 0, 0
+	for _, eni := range ds.eniPool {
+		if eni.IsTrunk || eni.IsEFA {
+			continue
+		}
+		pods := eni.AssignedIPv4Addresses()
+		// The primary ENI is never detached, so its warm IPs are not moved
+		if !eni.IsPrimary {
+			warmIPs := 0
+			for _, cidr := range eni.AvailableIPv4Cidrs {
+				if !cidr.IsPrefix && cidr.releasable() && cidr.AssignedIPAddressesInCidr() == 0 && !cidr.hasIPInCooling(ds.ipCooldownPeriod) {
+					warmIPs++
+				}
+			}
+			if warmIPs > 0 && (donor == "" || pods < donorPods) {
+				donor, donorPods, donorWarmIPs = eni.ID, pods, warmIPs
+			}
+		}
+		if !(skipPrimary && eni.IsPrimary) && len(eni.AvailableIPv4Cidrs) < maxIPperENI && (recipient == "" || pods > recipientPods) {
+			recipient, recipientPods = eni.ID, pods
+		}
+	}
+	// IPs only move towards ENIs with more pods, so that they do not move back and forth
+	if donor == "" || recipient == "" || recipientPods <= donorPods {
+		return "", "", 0
+	}
+	room := maxIPperENI - len(ds.eniPool[recipient].AvailableIPv4Cidrs)
+	ds.log.Debugf("GetWarmIPRebalance: ENI %s has %d pods and %d warm IPs, ENI %s has %d pods and room for %d IPs",
+		donor, donorPods, donorWarmIPs, recipient, recipientPods, room)
+	return donor, recipient, min(donorWarmIPs, room)
+}
+
 // RemoveUnusedENIFromStore removes a deletable ENI from the data store.
 // It returns the name of the ENI which has been removed from the data store and needs to be deleted,
 // or empty string if no ENI could be removed.
@@ -1002,8 +1429,27 @@ func (ds *DataStore) RemoveUnusedENIFromStore(warmIPTarget, minimumIPTarget, war
 	if deletableENI == nil {
 		return ""
 	}
+	ds.removeUnusedENIUnsafe(deletableENI.ID)
+	return deletableENI.ID
+}
+
+// RemoveIdleENIFromStore removes an ENI that has no pods and no IPs in cooling from the data store, whatever the warm
+// targets and the age of the ENI. It returns the name of the removed ENI, or an empty string if no ENI is idle.
+func (ds *DataStore) RemoveIdleENIFromStore() string {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	for _, eni := range ds.eniPool {
+		if eni.IsPrimary || eni.IsTrunk || eni.IsEFA || eni.hasPods() || eni.hasIPInCooling(ds.ipCooldownPeriod) {
+			continue
+		}
+		ds.removeUnusedENIUnsafe(eni.ID)
+		return eni.ID
+	}
+	return ""
+}
 
-	removableENI := deletableENI.ID
+func (ds *DataStore) removeUnusedENIUnsafe(removableENI string) {
 	for _, availableCidr := range ds.eniPool[removableENI].AvailableIPv4Cidrs {
 		ds.total -= availableCidr.Size()
 		if availableCidr.IsPrefix {
@@ -1011,17 +1457,17 @@ func (ds *DataStore) RemoveUnusedENIFromStore(warmIPTarget, minimumIPTarget, war
 			prometheusmetrics.TotalPrefixes.Set(float64(ds.allocatedPrefix))
 		}
 	}
-	ds.log.Infof("RemoveUnusedENIFromStore %s: IP/Prefix address pool stats: free %d addresses, total: %d, assigned: %d, total prefixes: %d",
+	ds.log.Infof("Removed unused ENI %s: IP/Prefix address pool stats: free %d addresses, total: %d, assigned: %d, total prefixes: %d",
 		removableENI, len(ds.eniPool[removableENI].AvailableIPv4Cidrs), ds.total, ds.assigned, ds.allocatedPrefix)
 
 	delete(ds.eniPool, removableENI)
+	ds.eniPoolChanged = true
 
 	// Prometheus update
 	prometheusmetrics.Enis.Set(float64(len(ds.eniPool)))
 	// Delete ENI IPs In Use when ENI is removed
 	prometheusmetrics.EniIPsInUse.DeleteLabelValues(removableENI)
 	prometheusmetrics.TotalIPs.Set(float64(ds.total))
-	return removableENI
 }
 
 // RemoveENIFromDataStore removes an ENI from the datastore. It returns nil on success, or an error.
@@ -1047,6 +1493,7 @@ func (ds *DataStore) RemoveENIFromDataStore(eniID string, force bool) error {
 		for _, assignedaddr := range eni.AvailableIPv4Cidrs {
 			for _, addr := range assignedaddr.IPAddresses {
 				if addr.Assigned() {
+					ds.auditUnsafe(AuditActionUnassign, AuditRequesterIPAMD, eni, addr)
 					ds.unassignPodIPAddressUnsafe(addr)
 				}
 			}
@@ -1071,6 +1518,7 @@ func (ds *DataStore) RemoveENIFromDataStore(eniID string, force bool) error {
 	ds.log.Infof("RemoveENIFromDataStore %s: IP/Prefix address pool stats: free %d addresses, total: %d, assigned: %d, total prefixes: %d",
 		eniID, len(eni.AvailableIPv4Cidrs), ds.total, ds.assigned, ds.allocatedPrefix)
 	delete(ds.eniPool, eniID)
+	ds.eniPoolChanged = true
 
 	// Prometheus gauge
 	prometheusmetrics.Enis.Set(float64(len(ds.eniPool)))
@@ -1081,7 +1529,9 @@ func (ds *DataStore) RemoveENIFromDataStore(eniID string, force bool) error {
 
 // UnassignPodIPAddress a) find out the IP address based on PodName and PodNameSpace
 // b)  mark IP address as unassigned c) returns IP address, ENI's device number, error
-func (ds *DataStore) UnassignPodIPAddress(ipamKey IPAMKey) (e *ENI, ip string, deviceNumber int, err error) {
+// If podUID is set and does not match the UID recorded at allocation time, the request is treated as
+// coming from a different pod instance and ErrUnknownPod is returned without releasing the IP.
+func (ds *DataStore) UnassignPodIPAddress(ipamKey IPAMKey, podUID string) (e *ENI, ip string, deviceNumber int, err error) {
 	ds.lock.Lock()
 	defer ds.lock.Unlock()
 	ds.log.Debugf("UnassignPodIPAddress: IP address pool stats: total %d, assigned %d, sandbox %s", ds.total, ds.assigned, ipamKey)
@@ -1095,6 +1545,12 @@ func (ds *DataStore) UnassignPodIPAddress(ipamKey IPAMKey) (e *ENI, ip string, d
 		ipamKey.IfName = backfillNetworkIface
 		eni, availableCidr, addr = ds.eniPool.FindAddressForSandbox(ipamKey)
 
+		// The allocation may also have been rebuilt from the pod after the checkpoint was lost
+		if addr == nil && podUID != "" {
+			ipamKey = RecoveredIPAMKey(podUID)
+			eni, availableCidr, addr = ds.eniPool.FindAddressForSandbox(ipamKey)
+		}
+
 		// If entry is still not found, IPAMD has no knowledge of this pod, so there is nothing to do.
 		if addr == nil {
 			ds.log.Warnf("UnassignPodIPAddress: Failed to find sandbox %s", ipamKey)
@@ -1102,6 +1558,13 @@ func (ds *DataStore) UnassignPodIPAddress(ipamKey IPAMKey) (e *ENI, ip string, d
 		}
 	}
 
+	// Allocations restored from checkpoints written before the pod UID was recorded have no UID to compare against
+	if podUID != "" && addr.IPAMMetadata.K8SPodUID != "" && addr.IPAMMetadata.K8SPodUID != podUID {
+		ds.log.Warnf("UnassignPodIPAddress: sandbox %s is assigned to pod UID %s, not %s",
+			ipamKey, addr.IPAMMetadata.K8SPodUID, podUID)
+		return nil, "", 0, ErrUnknownPod
+	}
+
 	originalIPAMMetadata := addr.IPAMMetadata
 	originalAssignedTime := addr.AssignedTime
 	ds.unassignPodIPAddressUnsafe(addr)
@@ -1110,6 +1573,8 @@ func (ds *DataStore) UnassignPodIPAddress(ipamKey IPAMKey) (e *ENI, ip string, d
 		ds.assignPodIPAddressUnsafe(addr, ipamKey, originalIPAMMetadata, originalAssignedTime)
 		return nil, "", 0, err
 	}
+	ds.auditUnsafe(AuditActionUnassign, AuditRequesterCNI, eni,
+		&AddressInfo{Address: addr.Address, IPAMKey: ipamKey, IPAMMetadata: originalIPAMMetadata, AssignedTime: originalAssignedTime})
 	addr.UnassignedTime = time.Now()
 
 	//Update prometheus for ips per cidr
@@ -1121,6 +1586,55 @@ func (ds *DataStore) UnassignPodIPAddress(ipamKey IPAMKey) (e *ENI, ip string, d
 	return eni, addr.Address, eni.DeviceNumber, nil
 }
 
+// ReassignPodIPv4Address moves an IPv4 address from sandbox `from` to sandbox `to`, which is already using it. The address
+// may also be unassigned, when the assignment to `from` was lost. A different address assigned to `to` is released.
+func (ds *DataStore) ReassignPodIPv4Address(address string, from, to IPAMKey, ipamMetadata IPAMMetadata) (deviceNumber int, err error) {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	ip := net.ParseIP(address)
+	for _, eni := range ds.eniPool {
+		for _, availableCidr := range eni.AvailableIPv4Cidrs {
+			if !availableCidr.Cidr.Contains(ip) {
+				continue
+			}
+			addr := availableCidr.IPAddresses[address]
+			if addr != nil && addr.Assigned() && addr.IPAMKey != from {
+				return -1, errors.Errorf("ReassignPodIPv4Address: %s is assigned to sandbox %s", address, addr.IPAMKey)
+			}
+			if addr == nil {
+				if availableCidr.IPAddresses == nil {
+					availableCidr.IPAddresses = make(map[string]*AddressInfo)
+				}
+				addr = &AddressInfo{Address: address}
+				availableCidr.IPAddresses[address] = addr
+			}
+
+			if prevENI, prevCidr, prev := ds.eniPool.FindAddressForSandbox(to); prev != nil && prev != addr {
+				ds.log.Warnf("ReassignPodIPv4Address: sandbox %s moves from %s to %s", to, prev.Address, address)
+				ds.auditUnsafe(AuditActionUnassign, AuditRequesterCNI, prevENI, prev)
+				ds.unassignPodIPAddressUnsafe(prev)
+				prev.UnassignedTime = time.Now()
+				prometheusmetrics.IpsPerCidr.With(prometheus.Labels{"cidr": prevCidr.Cidr.String()}).Dec()
+				prometheusmetrics.EniIPsInUse.WithLabelValues(prevENI.ID).Dec()
+			}
+			if !addr.Assigned() {
+				prometheusmetrics.IpsPerCidr.With(prometheus.Labels{"cidr": availableCidr.Cidr.String()}).Inc()
+				prometheusmetrics.EniIPsInUse.WithLabelValues(eni.ID).Inc()
+			}
+			ds.unassignPodIPAddressUnsafe(addr)
+			ds.assignPodIPAddressUnsafe(addr, to, ipamMetadata, time.Now())
+			ds.auditUnsafe(AuditActionAssign, AuditRequesterCNI, eni, addr)
+			// The pod already uses the address, so the assignment is kept even if the checkpoint cannot be written
+			if err := ds.writeBackingStoreUnsafe(); err != nil {
+				return eni.DeviceNumber, err
+			}
+			return eni.DeviceNumber, nil
+		}
+	}
+	return -1, errors.Errorf("ReassignPodIPv4Address: %s is not in the datastore", address)
+}
+
 // AllocatedIPs returns a recent snapshot of allocated sandbox<->IPs.
 // Note result may already be stale by the time you look at it.
 func (ds *DataStore) AllocatedIPs() []PodIPInfo {
@@ -1159,7 +1673,7 @@ func (ds *DataStore) FreeableIPs(eniID string) []net.IPNet {
 
 	freeable := make([]net.IPNet, 0, len(eni.AvailableIPv4Cidrs))
 	for _, assignedaddr := range eni.AvailableIPv4Cidrs {
-		if !assignedaddr.IsPrefix && assignedaddr.AssignedIPAddressesInCidr() == 0 {
+		if !assignedaddr.IsPrefix && assignedaddr.releasable() && assignedaddr.AssignedIPAddressesInCidr() == 0 {
 			freeable = append(freeable, assignedaddr.Cidr)
 		}
 	}
@@ -1181,7 +1695,7 @@ func (ds *DataStore) FreeablePrefixes(eniID string) []net.IPNet {
 
 	freeable := make([]net.IPNet, 0, len(eni.AvailableIPv4Cidrs))
 	for _, assignedaddr := range eni.AvailableIPv4Cidrs {
-		if assignedaddr.IsPrefix && assignedaddr.AssignedIPAddressesInCidr() == 0 {
+		if assignedaddr.IsPrefix && assignedaddr.releasable() && assignedaddr.AssignedIPAddressesInCidr() == 0 {
 			freeable = append(freeable, assignedaddr.Cidr)
 		}
 	}
@@ -1208,6 +1722,8 @@ func (ds *DataStore) GetENIInfos() *ENIInfos {
 				Cidr:        eniInfo.AvailableIPv4Cidrs[cidr].Cidr,
 				IPAddresses: make(map[string]*AddressInfo, len(eniInfo.AvailableIPv4Cidrs[cidr].IPAddresses)),
 				IsPrefix:    eniInfo.AvailableIPv4Cidrs[cidr].IsPrefix,
+				Source:      eniInfo.AvailableIPv4Cidrs[cidr].Source,
+				source:      eniInfo.AvailableIPv4Cidrs[cidr].source,
 			}
 			// Since IP Addresses might get removed, we need to make a deep copy here.
 			for ip, ipAddrInfoRef := range eniInfo.AvailableIPv4Cidrs[cidr].IPAddresses {
@@ -1220,6 +1736,8 @@ func (ds *DataStore) GetENIInfos() *ENIInfos {
 				Cidr:        eniInfo.IPv6Cidrs[cidr].Cidr,
 				IPAddresses: make(map[string]*AddressInfo, len(eniInfo.IPv6Cidrs[cidr].IPAddresses)),
 				IsPrefix:    eniInfo.IPv6Cidrs[cidr].IsPrefix,
+				Source:      eniInfo.IPv6Cidrs[cidr].Source,
+				source:      eniInfo.IPv6Cidrs[cidr].source,
 			}
 			// Since IP Addresses might get removed, we need to make a deep copy here.
 			for ip, ipAddrInfoRef := range eniInfo.IPv6Cidrs[cidr].IPAddresses {
@@ -1348,6 +1866,21 @@ func (ds *DataStore) getUnusedIP(availableCidr *CidrInfo) (string, error) {
 	return "", fmt.Errorf("no free IP available in the prefix - %s/%s", availableCidr.Cidr.IP, availableCidr.Cidr.Mask)
 }
 
+// peekUnusedIP returns the address getUnusedIP would pick, without cleaning up the unassigned addresses of the CIDR
+func (cidr *CidrInfo) peekUnusedIP(ipCooldownPeriod time.Duration) (string, bool) {
+	for _, addr := range cidr.IPAddresses {
+		if !addr.Assigned() && !addr.inCoolingPeriod(ipCooldownPeriod) {
+			return addr.Address, true
+		}
+	}
+	for ip := cidr.Cidr.IP.Mask(cidr.Cidr.Mask); cidr.Cidr.Contains(ip); getNextIPAddr(ip) {
+		if _, ok := cidr.IPAddresses[ip.String()]; !ok {
+			return ip.String(), true
+		}
+	}
+	return "", false
+}
+
 func getNextIPAddr(ip net.IP) {
 	for j := len(ip) - 1; j >= 0; j-- {
 		ip[j]++
@@ -1380,12 +1913,14 @@ func (ds *DataStore) FindFreeableCidrs(eniID string) []CidrInfo {
 
 	var freeable []CidrInfo
 	for _, assignedaddr := range eni.AvailableIPv4Cidrs {
-		if assignedaddr.AssignedIPAddressesInCidr() == 0 {
+		if assignedaddr.releasable() && assignedaddr.AssignedIPAddressesInCidr() == 0 {
 			tempFreeable := CidrInfo{
 				Cidr:          assignedaddr.Cidr,
 				IPAddresses:   nil,
 				IsPrefix:      assignedaddr.IsPrefix,
 				AddressFamily: assignedaddr.AddressFamily,
+				Source:        assignedaddr.Source,
+				source:        assignedaddr.source,
 			}
 			freeable = append(freeable, tempFreeable)
 		}
@@ -1394,6 +1929,50 @@ func (ds *DataStore) FindFreeableCidrs(eniID string) []CidrInfo {
 
 }
 
+// FindCooledDownCidrs returns the Cidrs of an ENI that have no pods and no IPs in cooling
+func (ds *DataStore) FindCooledDownCidrs(eniID string) []CidrInfo {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+
+	eni := ds.eniPool[eniID]
+	if eni == nil {
+		return nil
+	}
+
+	var cooledDown []CidrInfo
+	for _, assignedaddr := range eni.AvailableIPv4Cidrs {
+		if assignedaddr.releasable() && assignedaddr.AssignedIPAddressesInCidr() == 0 && !assignedaddr.hasIPInCooling(ds.ipCooldownPeriod) {
+			cooledDown = append(cooledDown, CidrInfo{
+				Cidr:          assignedaddr.Cidr,
+				IsPrefix:      assignedaddr.IsPrefix,
+				AddressFamily: assignedaddr.AddressFamily,
+			})
+		}
+	}
+	return cooledDown
+}
+
+// SetReadOnly makes the data store reject new allocations, while existing pods can still be released
+func (ds *DataStore) SetReadOnly() {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	ds.readOnly = true
+}
+
+// ClearReadOnly lets the data store allocate IPs again, when the node is no longer going away
+func (ds *DataStore) ClearReadOnly() {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	ds.readOnly = false
+}
+
+// IsReadOnly returns whether the data store rejects new allocations
+func (ds *DataStore) IsReadOnly() bool {
+	ds.lock.Lock()
+	defer ds.lock.Unlock()
+	return ds.readOnly
+}
+
 func DivCeil(x, y int) int {
 	return (x + y - 1) / y
 }
@@ -1472,6 +2051,22 @@ func (ds *DataStore) validateAllocationByPodVethExistence(allocation CheckpointE
 	return errors.Errorf("host-side veth not found for pod %v/%v", allocation.Metadata.K8SPodNamespace, allocation.Metadata.K8SPodName)
 }
 
+// AllocationsWithoutVeth returns the allocations whose pod has no host-side veth left. The allocations checkpointed
+// without the pod name are never returned.
+func (ds *DataStore) AllocationsWithoutVeth(allocations []CheckpointEntry) ([]CheckpointEntry, error) {
+	hostNSLinks, err := ds.netLink.LinkList()
+	if err != nil {
+		return nil, err
+	}
+	var withoutVeth []CheckpointEntry
+	for _, allocation := range allocations {
+		if ds.validateAllocationByPodVethExistence(allocation, hostNSLinks) != nil {
+			withoutVeth = append(withoutVeth, allocation)
+		}
+	}
+	return withoutVeth, nil
+}
+
 // For each stale allocation, cleanup leaked IP rules if they exist
 func (ds *DataStore) PruneStaleAllocations(staleAllocations []CheckpointEntry) {
 	ds.log.Info("Pruning potentially stale IP rules")
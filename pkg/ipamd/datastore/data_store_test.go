@@ -15,8 +15,10 @@ package datastore
 
 import (
 	"errors"
+	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -667,10 +669,10 @@ func TestPodIPv4Address(t *testing.T) {
 	_, _, err = ds.AssignPodIPv4Address(key4, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-4"})
 	assert.Error(t, err)
 	// Unassign unknown Pod
-	_, _, _, err = ds.UnassignPodIPAddress(key4)
+	_, _, _, err = ds.UnassignPodIPAddress(key4, "")
 	assert.Error(t, err)
 
-	_, _, deviceNum, err := ds.UnassignPodIPAddress(key2)
+	_, _, deviceNum, err := ds.UnassignPodIPAddress(key2, "")
 	assert.NoError(t, err)
 	assert.Equal(t, ds.total, 3)
 	assert.Equal(t, ds.assigned, 2)
@@ -857,7 +859,7 @@ func TestPodIPv4AddressWithPDEnabled(t *testing.T) {
 		cmp.Diff(checkpoint.Data, expectedCheckpointData, checkpointDataCmpOpts),
 	)
 
-	_, _, deviceNum, err := ds.UnassignPodIPAddress(key2)
+	_, _, deviceNum, err := ds.UnassignPodIPAddress(key2, "")
 	assert.NoError(t, err)
 	assert.Equal(t, ds.total, 16)
 	assert.Equal(t, ds.assigned, 2)
@@ -888,6 +890,173 @@ func TestPodIPv4AddressWithPDEnabled(t *testing.T) {
 	assert.Equal(t, ds.assigned, 2)
 }
 
+func TestENIInventory(t *testing.T) {
+	checkpoint := NewTestCheckpoint(struct{}{})
+	inventory := NewTestCheckpoint(struct{}{})
+	ds := NewDataStore(Testlog, checkpoint, false)
+	ds.SetENIInventory(inventory)
+	assert.NoError(t, ds.AddENI("eni-1", 0, true, false, false))
+	assert.NoError(t, ds.AddENI("eni-2", 2, false, true, false))
+	ipv4Addr1 := net.IPNet{IP: net.ParseIP("10.0.0.11"), Mask: net.IPv4Mask(255, 255, 255, 255)}
+	ipv4Addr2 := net.IPNet{IP: net.ParseIP("10.0.0.12"), Mask: net.IPv4Mask(255, 255, 255, 255)}
+	_, ipv4Prefix, _ := net.ParseCIDR("10.0.1.16/28")
+	_, externalCidr, _ := net.ParseCIDR("10.1.0.0/28")
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", ipv4Addr2, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", ipv4Addr1, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-2", *ipv4Prefix, true))
+	assert.NoError(t, ds.AddCidrToStore("eni-2", *externalCidr, NewExternalSource("external-ipam", "4", true)))
+
+	// One of the IPs is assigned, the warm ones are recorded as well
+	_, _, err := ds.AssignPodIPv4Address(IPAMKey{"net0", "sandbox-1", "eth0"}, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod-1"})
+	assert.NoError(t, err)
+	assert.NoError(t, ds.WriteENIInventory())
+	expectedENIs := []CheckpointENI{
+		{ID: "eni-1", IsPrimary: true, Cidrs: []CheckpointCidr{
+			{Cidr: "10.0.0.11/32", Source: "secondary-ipv4"},
+			{Cidr: "10.0.0.12/32", Source: "secondary-ipv4"},
+		}},
+		{ID: "eni-2", DeviceNumber: 2, IsTrunk: true, Cidrs: []CheckpointCidr{
+			{Cidr: "10.0.1.16/28", Source: "ipv4-prefix"},
+			{Cidr: "10.1.0.0/28", Source: "external-ipam"},
+		}},
+	}
+	assert.Equal(t, expectedENIs, inventory.Data.(*ENIInventory).ENIs)
+
+	// The inventory is only written again once the pool changes
+	inventory.Data = struct{}{}
+	assert.NoError(t, ds.WriteENIInventory())
+	assert.Equal(t, struct{}{}, inventory.Data)
+	_, _, err = ds.AssignPodIPv4Address(IPAMKey{"net0", "sandbox-2", "eth0"}, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod-2"})
+	assert.NoError(t, err)
+	assert.NoError(t, ds.WriteENIInventory())
+	assert.Equal(t, struct{}{}, inventory.Data)
+	ipv4Addr3 := net.IPNet{IP: net.ParseIP("10.0.0.13"), Mask: net.IPv4Mask(255, 255, 255, 255)}
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", ipv4Addr3, false))
+	assert.NoError(t, ds.WriteENIInventory())
+	assert.Len(t, inventory.Data.(*ENIInventory).ENIs[0].Cidrs, 3)
+	assert.NoError(t, ds.DelIPv4CidrFromStore("eni-1", ipv4Addr3, false))
+	assert.NoError(t, ds.WriteENIInventory())
+	assert.Equal(t, expectedENIs, inventory.Data.(*ENIInventory).ENIs)
+
+	enis, err := ds.ReadENIInventory()
+	assert.NoError(t, err)
+	assert.Equal(t, expectedENIs, enis)
+
+	// A new datastore restores the builtin CIDRs, then the allocations
+	restored := NewDataStore(Testlog, checkpoint, false)
+	restored.SetENIInventory(inventory)
+	for _, eni := range enis {
+		assert.NoError(t, restored.AddENI(eni.ID, eni.DeviceNumber, eni.IsPrimary, eni.IsTrunk, eni.IsEFA))
+		_, err := restored.RestoreENICidrs(eni)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 2, len(restored.eniPool["eni-1"].AvailableIPv4Cidrs))
+	assert.Equal(t, 1, len(restored.eniPool["eni-2"].AvailableIPv4Cidrs))
+	assert.Equal(t, "eni-2", restored.GetTrunkENI())
+
+	// A node without an inventory has no ENIs to warm start from
+	inventory.Error = os.ErrNotExist
+	enis, err = ds.ReadENIInventory()
+	assert.NoError(t, err)
+	assert.Empty(t, enis)
+}
+
+func TestUnassignPodIPAddressWithPodUID(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	_ = ds.AddENI("eni-1", 1, true, false, false)
+	ipv4Addr := net.IPNet{IP: net.ParseIP("1.1.1.1"), Mask: net.IPv4Mask(255, 255, 255, 255)}
+	_ = ds.AddIPv4CidrToStore("eni-1", ipv4Addr, false)
+	ipv4Addr = net.IPNet{IP: net.ParseIP("1.1.1.2"), Mask: net.IPv4Mask(255, 255, 255, 255)}
+	_ = ds.AddIPv4CidrToStore("eni-1", ipv4Addr, false)
+
+	key1 := IPAMKey{"net0", "sandbox-1", "eth0"}
+	assignedIP, _, err := ds.AssignPodIPv4Address(key1, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod", K8SPodUID: "uid-2"})
+	assert.NoError(t, err)
+
+	// A DEL with a different pod UID must not release the IP
+	_, _, _, err = ds.UnassignPodIPAddress(key1, "uid-1")
+	assert.Equal(t, ErrUnknownPod, err)
+	assert.Equal(t, 1, ds.assigned)
+
+	_, ip, _, err := ds.UnassignPodIPAddress(key1, "uid-2")
+	assert.NoError(t, err)
+	assert.Equal(t, assignedIP, ip)
+	assert.Equal(t, 0, ds.assigned)
+
+	// Allocations without a recorded UID, e.g. restored from an older checkpoint, match any UID
+	key2 := IPAMKey{"net0", "sandbox-2", "eth0"}
+	_, _, err = ds.AssignPodIPv4Address(key2, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod"})
+	assert.NoError(t, err)
+	_, _, _, err = ds.UnassignPodIPAddress(key2, "uid-3")
+	assert.NoError(t, err)
+}
+
+func TestReassignPodIPv4Address(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	_ = ds.AddENI("eni-1", 1, true, false, false)
+	_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("1.1.1.1"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("1.1.1.2"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+
+	lease := IPAMKey{"_lease", "lease-1", "lease"}
+	ip, _, err := ds.AssignPodIPv4Address(lease, IPAMMetadata{})
+	assert.NoError(t, err)
+
+	pod := IPAMKey{"net0", "sandbox-1", "eth0"}
+	deviceNumber, err := ds.ReassignPodIPv4Address(ip, lease, pod, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, deviceNumber)
+	assert.Equal(t, 1, ds.assigned)
+	_, _, addr := ds.eniPool.FindAddressForSandbox(pod)
+	assert.Equal(t, ip, addr.Address)
+	assert.Equal(t, "sample-pod", addr.IPAMMetadata.K8SPodName)
+
+	// An address of another sandbox is not taken
+	_, err = ds.ReassignPodIPv4Address(ip, lease, IPAMKey{"net0", "sandbox-2", "eth0"}, IPAMMetadata{})
+	assert.Error(t, err)
+
+	// An unassigned address can be reassigned, and the previous address of the sandbox is released
+	other := "1.1.1.2"
+	if ip == other {
+		other = "1.1.1.1"
+	}
+	_, err = ds.ReassignPodIPv4Address(other, lease, pod, IPAMMetadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ds.assigned)
+	_, _, addr = ds.eniPool.FindAddressForSandbox(pod)
+	assert.Equal(t, other, addr.Address)
+
+	_, err = ds.ReassignPodIPv4Address("1.1.1.3", lease, pod, IPAMMetadata{})
+	assert.Error(t, err)
+}
+
+func TestPreviewPodIPAddress(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	_, err := ds.PreviewPodIPAddress(true, false)
+	assert.ErrorIs(t, err, ErrNoAvailableIPs)
+
+	_ = ds.AddENI("eni-1", 1, false, false, false)
+	_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("1.1.1.1"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	address, err := ds.PreviewPodIPAddress(true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, PodAddress{Address: "1.1.1.1", ENI: "eni-1", DeviceNumber: 1, Cidr: "1.1.1.1/32", Source: SecondaryIPv4Source.Name()}, address)
+
+	// The preview does not assign the address, the next ADD gets it
+	assert.Equal(t, 0, ds.assigned)
+	ip, deviceNumber, err := ds.AssignPodIPv4Address(IPAMKey{"net0", "sandbox-1", "eth0"}, IPAMMetadata{})
+	assert.NoError(t, err)
+	assert.Equal(t, address.Address, ip)
+	assert.Equal(t, address.DeviceNumber, deviceNumber)
+
+	_, err = ds.PreviewPodIPAddress(true, false)
+	assert.ErrorIs(t, err, ErrNoAvailableIPs)
+	_, err = ds.PreviewPodIPAddress(false, true)
+	assert.Error(t, err)
+
+	ds.SetReadOnly()
+	_, err = ds.PreviewPodIPAddress(true, false)
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
+
 func TestGetIPStatsV4(t *testing.T) {
 	os.Setenv(envIPCooldownPeriod, "1")
 	defer os.Unsetenv(envIPCooldownPeriod)
@@ -916,7 +1085,7 @@ func TestGetIPStatsV4(t *testing.T) {
 		*ds.GetIPStats("4"),
 	)
 
-	_, _, _, err = ds.UnassignPodIPAddress(key2)
+	_, _, _, err = ds.UnassignPodIPAddress(key2, "")
 	assert.NoError(t, err)
 
 	assert.Equal(t,
@@ -969,7 +1138,7 @@ func TestGetIPStatsV4WithPD(t *testing.T) {
 		*ds.GetIPStats("4"),
 	)
 
-	_, _, _, err = ds.UnassignPodIPAddress(key2)
+	_, _, _, err = ds.UnassignPodIPAddress(key2, "")
 	assert.NoError(t, err)
 
 	assert.Equal(t,
@@ -997,6 +1166,35 @@ func TestGetIPStatsV4WithPD(t *testing.T) {
 	)
 }
 
+func TestGetENIStatsWithPD(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, true)
+
+	_ = ds.AddENI("eni-1", 1, true, false, false)
+	_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("10.0.0.0"), Mask: net.IPv4Mask(255, 255, 255, 240)}, true)
+	// Fill the prefix of eni-1 before eni-2 is added
+	for i := 0; i < 16; i++ {
+		_, _, err := ds.AssignPodIPv4Address(IPAMKey{"net0", fmt.Sprintf("sandbox-%d", i), "eth0"},
+			IPAMMetadata{K8SPodNamespace: "default", K8SPodName: fmt.Sprintf("sample-pod-%d", i)})
+		assert.NoError(t, err)
+	}
+	_ = ds.AddENI("eni-2", 2, false, false, false)
+	_ = ds.AddIPv4CidrToStore("eni-2", net.IPNet{IP: net.ParseIP("10.0.1.0"), Mask: net.IPv4Mask(255, 255, 255, 240)}, true)
+	_ = ds.AddIPv4CidrToStore("eni-2", net.IPNet{IP: net.ParseIP("10.0.1.16"), Mask: net.IPv4Mask(255, 255, 255, 240)}, true)
+	_, _, err := ds.AssignPodIPv4Address(IPAMKey{"net0", "sandbox-16", "eth0"},
+		IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-16"})
+	assert.NoError(t, err)
+
+	stats := ds.GetENIStats("4")
+	assert.Equal(t, ENIStats{
+		DataStoreStats: DataStoreStats{TotalIPs: 16, TotalPrefixes: 1, AssignedIPs: 16},
+		Prefixes:       PrefixStats{Full: 1},
+	}, *stats["eni-1"])
+	assert.Equal(t, ENIStats{
+		DataStoreStats: DataStoreStats{TotalIPs: 32, TotalPrefixes: 2, AssignedIPs: 1},
+		Prefixes:       PrefixStats{Empty: 1, Partial: 1, FreeIPsInPartial: 15},
+	}, *stats["eni-2"])
+}
+
 func TestGetIPStatsV6(t *testing.T) {
 	v6ds := NewDataStore(Testlog, NullCheckpoint{}, true)
 	_ = v6ds.AddENI("eni-1", 1, true, false, false)
@@ -1119,6 +1317,48 @@ func TestWarmENIInteractions(t *testing.T) {
 	assert.Equal(t, 3, ds.GetENIs())
 }
 
+func TestGetWarmIPRebalance(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	addIPs := func(eniID string, ips ...string) {
+		for _, ip := range ips {
+			_ = ds.AddIPv4CidrToStore(eniID, net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+		}
+	}
+	assignPods := func(pods int, prefix string) {
+		for i := 0; i < pods; i++ {
+			_, _, err := ds.AssignPodIPv4Address(IPAMKey{"net0", fmt.Sprintf("%s-%d", prefix, i), "eth0"}, IPAMMetadata{})
+			assert.NoError(t, err)
+		}
+	}
+
+	// Each ENI is full before the next one gets IPs, so that the pods land on it
+	_ = ds.AddENI("eni-1", 0, true, false, false)
+	addIPs("eni-1", "1.1.1.1", "1.1.1.2")
+	assignPods(2, "primary")
+	_ = ds.AddENI("eni-2", 1, false, false, false)
+	addIPs("eni-2", "1.1.2.1", "1.1.2.2", "1.1.2.3")
+	assignPods(3, "busy")
+	_ = ds.AddENI("eni-3", 2, false, false, false)
+	addIPs("eni-3", "1.1.3.1", "1.1.3.2", "1.1.3.3")
+	assignPods(1, "idle")
+
+	// The warm IPs of the ENI with the fewest pods move to the busiest ENI with room
+	donor, recipient, count := ds.GetWarmIPRebalance(5, false)
+	assert.Equal(t, "eni-3", donor)
+	assert.Equal(t, "eni-2", recipient)
+	assert.Equal(t, 2, count)
+
+	addIPs("eni-2", "1.1.2.4", "1.1.2.5")
+	donor, recipient, count = ds.GetWarmIPRebalance(5, false)
+	assert.Equal(t, "eni-3", donor)
+	assert.Equal(t, "eni-1", recipient)
+	assert.Equal(t, 2, count)
+
+	// Without the primary ENI, only ENIs with fewer pods have room
+	_, _, count = ds.GetWarmIPRebalance(5, true)
+	assert.Equal(t, 0, count)
+}
+
 func TestDataStore_normalizeCheckpointDataByPodVethExistence(t *testing.T) {
 	containerAddr := &net.IPNet{
 		IP:   net.ParseIP("192.168.1.1"),
@@ -1542,3 +1782,217 @@ func TestDataStore_validateAllocationByPodVethExistence(t *testing.T) {
 		})
 	}
 }
+
+func TestSnapshotAndMergeSnapshot(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	_ = ds.AddENI("eni-1", 1, true, false, false)
+	for _, ip := range []string{"1.1.1.1", "1.1.1.2", "1.1.1.3"} {
+		_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	key1 := IPAMKey{"net0", "sandbox-1", "eth0"}
+	key2 := IPAMKey{"net0", "sandbox-2", "eth0"}
+	ip1, _, err := ds.AssignPodIPv4Address(key1, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-1"})
+	assert.NoError(t, err)
+	_, _, err = ds.AssignPodIPv4Address(key2, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-2"})
+	assert.NoError(t, err)
+
+	snapshot := ds.Snapshot()
+	assert.Equal(t, CheckpointFormatVersion, snapshot.Version)
+	assert.Len(t, snapshot.Allocations, 2)
+
+	// Restore into a node with the same ENI, where sandbox-1's IP is taken by another sandbox
+	other := NewDataStore(Testlog, NullCheckpoint{}, false)
+	_ = other.AddENI("eni-1", 1, true, false, false)
+	for _, ip := range []string{"1.1.1.1", "1.1.1.2", "1.1.1.3"} {
+		_ = other.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	snapshot.Allocations = append(snapshot.Allocations, CheckpointEntry{
+		IPAMKey: IPAMKey{"net0", "sandbox-3", "eth0"},
+		IPv4:    "10.0.0.1",
+	})
+	_, _, addr := other.eniPool.FindAddressForSandbox(key1)
+	assert.Nil(t, addr)
+	otherKey := IPAMKey{"net0", "sandbox-4", "eth0"}
+	_, _, cidrAddr := other.findOrAddAddressUnsafe(net.ParseIP(ip1), false)
+	other.assignPodIPAddressUnsafe(cidrAddr, otherKey, IPAMMetadata{}, time.Now())
+
+	restored, err := other.MergeSnapshot(snapshot, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, restored)
+	assert.Equal(t, 2, other.assigned)
+	_, _, addr = other.eniPool.FindAddressForSandbox(key2)
+	assert.NotNil(t, addr)
+
+	_, err = other.MergeSnapshot(CheckpointData{Version: "vpc-cni-ipam/99"}, false)
+	assert.Error(t, err)
+}
+
+type testAuditLogger struct {
+	events []AuditEvent
+}
+
+func (a *testAuditLogger) Log(event AuditEvent) {
+	a.events = append(a.events, event)
+}
+
+func TestAuditLog(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	auditLog := &testAuditLogger{}
+	ds.SetAuditLogger(auditLog)
+	_ = ds.AddENI("eni-1", 1, true, false, false)
+	_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("1.1.1.1"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("1.1.1.2"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+
+	key1 := IPAMKey{"net0", "sandbox-1", "eth0"}
+	metadata1 := IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-1", K8SPodUID: "uid-1"}
+	ip1, _, err := ds.AssignPodIPv4Address(key1, metadata1)
+	assert.NoError(t, err)
+	key2 := IPAMKey{"net0", "sandbox-2", "eth0"}
+	ip2, _, err := ds.AssignPodIPv4Address(key2, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-2"})
+	assert.NoError(t, err)
+	_, _, _, err = ds.UnassignPodIPAddress(key1, "uid-1")
+	assert.NoError(t, err)
+	assert.NoError(t, ds.RemoveENIFromDataStore("eni-1", true))
+
+	assert.Len(t, auditLog.events, 4)
+	assert.Equal(t, AuditActionAssign, auditLog.events[0].Action)
+	assert.Equal(t, AuditRequesterCNI, auditLog.events[0].Requester)
+	assert.Equal(t, ip1, auditLog.events[0].IP)
+	assert.Equal(t, "eni-1", auditLog.events[0].ENI)
+	assert.Equal(t, key1, auditLog.events[0].IPAMKey)
+	assert.Equal(t, metadata1, auditLog.events[0].IPAMMetadata)
+	assert.Nil(t, auditLog.events[0].AssignedTime)
+
+	assert.Equal(t, AuditActionUnassign, auditLog.events[2].Action)
+	assert.Equal(t, AuditRequesterCNI, auditLog.events[2].Requester)
+	assert.Equal(t, key1, auditLog.events[2].IPAMKey)
+	assert.Equal(t, metadata1, auditLog.events[2].IPAMMetadata)
+	assert.NotNil(t, auditLog.events[2].AssignedTime)
+
+	assert.Equal(t, AuditActionUnassign, auditLog.events[3].Action)
+	assert.Equal(t, AuditRequesterIPAMD, auditLog.events[3].Requester)
+	assert.Equal(t, ip2, auditLog.events[3].IP)
+	assert.Equal(t, key2, auditLog.events[3].IPAMKey)
+}
+
+func TestReadOnly(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	_ = ds.AddENI("eni-1", 1, true, false, false)
+	for _, ip := range []string{"1.1.1.1", "1.1.1.2"} {
+		_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	key1 := IPAMKey{"net0", "sandbox-1", "eth0"}
+	ip1, _, err := ds.AssignPodIPv4Address(key1, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-1"})
+	assert.NoError(t, err)
+
+	ds.SetReadOnly()
+	assert.True(t, ds.IsReadOnly())
+
+	// New pods are rejected, a retried ADD of an existing pod still gets its IP
+	_, _, err = ds.AssignPodIPv4Address(IPAMKey{"net0", "sandbox-2", "eth0"}, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-2"})
+	assert.Equal(t, ErrReadOnly, err)
+	ip, _, err := ds.AssignPodIPv4Address(key1, IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod-1"})
+	assert.NoError(t, err)
+	assert.Equal(t, ip1, ip)
+
+	_, err = ds.MergeSnapshot(ds.Snapshot(), false)
+	assert.Equal(t, ErrReadOnly, err)
+
+	_, _, _, err = ds.UnassignPodIPAddress(key1, "")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, ds.assigned)
+}
+
+func TestRemoveIdleENIFromStore(t *testing.T) {
+	ds := NewDataStore(Testlog, NullCheckpoint{}, false)
+	_ = ds.AddENI("eni-1", 1, true, false, false)
+	_ = ds.AddENI("eni-2", 2, false, false, false)
+	_ = ds.AddENI("eni-3", 3, false, false, false)
+	_ = ds.AddENI("eni-4", 4, false, true, false)
+	_ = ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("1.1.1.1"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	_ = ds.AddIPv4CidrToStore("eni-2", net.IPNet{IP: net.ParseIP("1.1.2.1"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	_ = ds.AddIPv4CidrToStore("eni-2", net.IPNet{IP: net.ParseIP("1.1.2.2"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	_ = ds.AddIPv4CidrToStore("eni-3", net.IPNet{IP: net.ParseIP("1.1.3.1"), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+
+	// eni-2 has a pod, and an IP that was just released
+	ds.eniPool["eni-2"].AvailableIPv4Cidrs["1.1.2.1/32"].IPAddresses = map[string]*AddressInfo{
+		"1.1.2.1": {Address: "1.1.2.1", IPAMKey: IPAMKey{"net0", "sandbox-1", "eth0"}},
+	}
+	ds.eniPool["eni-2"].AvailableIPv4Cidrs["1.1.2.2/32"].IPAddresses = map[string]*AddressInfo{
+		"1.1.2.2": {Address: "1.1.2.2", UnassignedTime: time.Now()},
+	}
+	ds.assigned = 1
+
+	// Only the young eni-3 is idle, the primary and trunk ENIs are kept
+	assert.Equal(t, "eni-3", ds.RemoveIdleENIFromStore())
+	assert.Equal(t, "", ds.RemoveIdleENIFromStore())
+	assert.Equal(t, 3, ds.total)
+
+	// Only the IP of the primary ENI has cooled down
+	assert.Empty(t, ds.FindCooledDownCidrs("eni-2"))
+	cidrs := ds.FindCooledDownCidrs("eni-1")
+	if assert.Len(t, cidrs, 1) {
+		assert.Equal(t, "1.1.1.1/32", cidrs[0].Cidr.String())
+	}
+	ds.eniPool["eni-2"].AvailableIPv4Cidrs["1.1.2.2/32"].IPAddresses["1.1.2.2"].UnassignedTime = time.Time{}
+	cidrs = ds.FindCooledDownCidrs("eni-2")
+	if assert.Len(t, cidrs, 1) {
+		assert.Equal(t, "1.1.2.2/32", cidrs[0].Cidr.String())
+	}
+}
+
+func TestRebuildBackingStore(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	path := filepath.Join(t.TempDir(), "ipam.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"version": "vpc-cni-ip`), 0644))
+	ds := NewDataStore(Testlog, NewJSONFile(path), false)
+	netLink := mock_netlinkwrapper.NewMockNetLink(ctrl)
+	ds.netLink = netLink
+	assert.NoError(t, ds.AddENI("eni-1", 1, true, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)}, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(32, 32)}, false))
+
+	err := ds.ReadBackingStore(false)
+	assert.ErrorIs(t, err, ErrCorruptCheckpoint)
+
+	// Only pod1 still has its host-side veth
+	netLink.EXPECT().LinkList().Return([]netlink.Link{
+		&netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: networkutils.GeneratePodHostVethName("eni", "default", "pod1")}},
+	}, nil)
+	netLink.EXPECT().NewRule().DoAndReturn(func() *netlink.Rule { return netlink.NewRule() }).AnyTimes()
+	netLink.EXPECT().RuleDel(gomock.Any()).Return(nil).AnyTimes()
+	err = ds.RebuildBackingStore([]CheckpointEntry{
+		{IPAMKey: RecoveredIPAMKey("uid1"), IPv4: "10.0.0.1", Metadata: IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod1", K8SPodUID: "uid1"}},
+		{IPAMKey: RecoveredIPAMKey("uid2"), IPv4: "10.0.0.2", Metadata: IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod2", K8SPodUID: "uid2"}},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, ds.GetIPStats("4").AssignedIPs)
+
+	// The corrupt checkpoint is kept for diagnosis, and replaced by the rebuilt one
+	quarantined, _ := filepath.Glob(path + ".corrupt-*")
+	assert.Len(t, quarantined, 1)
+	var data CheckpointData
+	assert.NoError(t, NewJSONFile(path).Restore(&data))
+	assert.Len(t, data.Allocations, 1)
+
+	// The DEL of the pod finds the rebuilt allocation by pod UID
+	_, ip, _, err := ds.UnassignPodIPAddress(IPAMKey{NetworkName: "aws-cni", ContainerID: "sandbox1", IfName: "eth0"}, "uid1")
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.1", ip)
+
+	// A missing checkpoint is rebuilt the same way, with nothing to quarantine
+	path = filepath.Join(t.TempDir(), "ipam.json")
+	ds = NewDataStore(Testlog, NewJSONFile(path), false)
+	ds.netLink = netLink
+	assert.NoError(t, ds.AddENI("eni-1", 1, true, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)}, false))
+	assert.ErrorIs(t, ds.ReadBackingStore(false), ErrMissingCheckpoint)
+	netLink.EXPECT().LinkList().Return(nil, nil)
+	assert.NoError(t, ds.RebuildBackingStore(nil, false))
+	assert.Equal(t, 0, ds.GetIPStats("4").AssignedIPs)
+	quarantined, _ = filepath.Glob(path + ".corrupt-*")
+	assert.Empty(t, quarantined)
+	assert.FileExists(t, path)
+}
@@ -0,0 +1,126 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+// The datastore metrics are computed from the datastore on each scrape, so that they need no cleanup when ENIs go away
+var (
+	datastoreENIIPsDesc = prometheus.NewDesc(
+		"awscni_datastore_eni_ips",
+		"The IPs of an ENI in the datastore, by state: assigned to a pod, in cooldown after the pod was deleted, or available",
+		[]string{"eni", "subnet_cidr", "state"}, nil,
+	)
+	datastoreSubnetIPsDesc = prometheus.NewDesc(
+		"awscni_datastore_subnet_ips",
+		"The IPs of the ENIs of the node in a subnet, by state",
+		[]string{"subnet_cidr", "state"}, nil,
+	)
+	datastorePrefixesDesc = prometheus.NewDesc(
+		"awscni_datastore_prefixes",
+		"The prefixes of the datastore, by use: empty, partial or full",
+		[]string{"eni", "state"}, nil,
+	)
+	datastorePrefixFragmentationDesc = prometheus.NewDesc(
+		"awscni_datastore_prefix_fragmentation_ratio",
+		"The fraction of the free IPs of the prefixes that are in partially used prefixes, which cannot be released",
+		nil, nil,
+	)
+)
+
+// datastoreCollector exports the contents of the datastore, which are otherwise only available from the introspection
+// endpoints
+type datastoreCollector struct {
+	c *IPAMContext
+}
+
+func (d datastoreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- datastoreENIIPsDesc
+	ch <- datastoreSubnetIPsDesc
+	ch <- datastorePrefixesDesc
+	ch <- datastorePrefixFragmentationDesc
+}
+
+func (d datastoreCollector) Collect(ch chan<- prometheus.Metric) {
+	addressFamily := "4"
+	if d.c.enableIPv6 {
+		addressFamily = "6"
+	}
+	subnetIPs := map[string]map[string]int{}
+	freeIPs, freeIPsInPartial := 0, 0
+	enis := d.c.dataStore.GetENIStats(addressFamily)
+	subnets := d.c.eniSubnets(enis)
+	for eni, stats := range enis {
+		subnet := subnets[eni]
+		ips := map[string]int{
+			"assigned":  stats.AssignedIPs,
+			"cooldown":  stats.CooldownIPs,
+			"available": stats.TotalIPs - stats.AssignedIPs - stats.CooldownIPs,
+		}
+		if subnetIPs[subnet] == nil {
+			subnetIPs[subnet] = map[string]int{}
+		}
+		for state, n := range ips {
+			ch <- prometheus.MustNewConstMetric(datastoreENIIPsDesc, prometheus.GaugeValue, float64(n), eni, subnet, state)
+			subnetIPs[subnet][state] += n
+		}
+		if stats.TotalPrefixes == 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(datastorePrefixesDesc, prometheus.GaugeValue, float64(stats.Prefixes.Empty), eni, "empty")
+		ch <- prometheus.MustNewConstMetric(datastorePrefixesDesc, prometheus.GaugeValue, float64(stats.Prefixes.Partial), eni, "partial")
+		ch <- prometheus.MustNewConstMetric(datastorePrefixesDesc, prometheus.GaugeValue, float64(stats.Prefixes.Full), eni, "full")
+		freeIPs += ips["available"]
+		freeIPsInPartial += stats.Prefixes.FreeIPsInPartial
+	}
+	for subnet, ips := range subnetIPs {
+		for state, n := range ips {
+			ch <- prometheus.MustNewConstMetric(datastoreSubnetIPsDesc, prometheus.GaugeValue, float64(n), subnet, state)
+		}
+	}
+	fragmentation := 0.0
+	if freeIPs > 0 {
+		fragmentation = float64(freeIPsInPartial) / float64(freeIPs)
+	}
+	ch <- prometheus.MustNewConstMetric(datastorePrefixFragmentationDesc, prometheus.GaugeValue, fragmentation)
+}
+
+// setENISubnet records the subnet CIDR of an ENI, the label of its datastore metrics
+func (c *IPAMContext) setENISubnet(eni, subnetCIDR string) {
+	c.eniSubnetCIDRsLock.Lock()
+	defer c.eniSubnetCIDRsLock.Unlock()
+	if c.eniSubnetCIDRs == nil {
+		c.eniSubnetCIDRs = make(map[string]string)
+	}
+	c.eniSubnetCIDRs[eni] = subnetCIDR
+}
+
+// eniSubnets returns the subnet CIDRs of the ENIs of the datastore, and forgets the ENIs removed from it
+func (c *IPAMContext) eniSubnets(enis map[string]*datastore.ENIStats) map[string]string {
+	c.eniSubnetCIDRsLock.Lock()
+	defer c.eniSubnetCIDRsLock.Unlock()
+	subnets := make(map[string]string, len(enis))
+	for eni, subnetCIDR := range c.eniSubnetCIDRs {
+		if _, ok := enis[eni]; !ok {
+			delete(c.eniSubnetCIDRs, eni)
+			continue
+		}
+		subnets[eni] = subnetCIDR
+	}
+	return subnets
+}
@@ -0,0 +1,79 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestDatastoreCollector(t *testing.T) {
+	ds := testDatastorewithPrefix()
+	c := &IPAMContext{dataStore: ds, enableIPv4: true}
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP("10.0.0.16"), Mask: net.CIDRMask(28, 32)}, true))
+	c.setENISubnet(primaryENIid, "10.0.0.0/24")
+	for i := 0; i < 17; i++ {
+		if i == 16 {
+			assert.NoError(t, ds.AddENI(secENIid, secDevice, false, false, false))
+			assert.NoError(t, ds.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP("10.0.1.16"), Mask: net.CIDRMask(28, 32)}, true))
+			assert.NoError(t, ds.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP("10.0.1.32"), Mask: net.CIDRMask(28, 32)}, true))
+			c.setENISubnet(secENIid, "10.0.1.0/24")
+		}
+		_, _, err := ds.AssignPodIPv4Address(datastore.IPAMKey{NetworkName: "net0", ContainerID: fmt.Sprint(i), IfName: "eth0"},
+			datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: fmt.Sprintf("pod-%d", i)})
+		assert.NoError(t, err)
+	}
+	// The subnets of the ENIs removed from the datastore are forgotten
+	c.setENISubnet("eni-removed", "10.0.2.0/24")
+
+	expected := `
+# HELP awscni_datastore_eni_ips The IPs of an ENI in the datastore, by state: assigned to a pod, in cooldown after the pod was deleted, or available
+# TYPE awscni_datastore_eni_ips gauge
+awscni_datastore_eni_ips{eni="eni-00000000",state="assigned",subnet_cidr="10.0.0.0/24"} 16
+awscni_datastore_eni_ips{eni="eni-00000000",state="available",subnet_cidr="10.0.0.0/24"} 0
+awscni_datastore_eni_ips{eni="eni-00000000",state="cooldown",subnet_cidr="10.0.0.0/24"} 0
+awscni_datastore_eni_ips{eni="eni-00000001",state="assigned",subnet_cidr="10.0.1.0/24"} 1
+awscni_datastore_eni_ips{eni="eni-00000001",state="available",subnet_cidr="10.0.1.0/24"} 31
+awscni_datastore_eni_ips{eni="eni-00000001",state="cooldown",subnet_cidr="10.0.1.0/24"} 0
+# HELP awscni_datastore_prefix_fragmentation_ratio The fraction of the free IPs of the prefixes that are in partially used prefixes, which cannot be released
+# TYPE awscni_datastore_prefix_fragmentation_ratio gauge
+awscni_datastore_prefix_fragmentation_ratio 0.4838709677419355
+# HELP awscni_datastore_prefixes The prefixes of the datastore, by use: empty, partial or full
+# TYPE awscni_datastore_prefixes gauge
+awscni_datastore_prefixes{eni="eni-00000000",state="empty"} 0
+awscni_datastore_prefixes{eni="eni-00000000",state="full"} 1
+awscni_datastore_prefixes{eni="eni-00000000",state="partial"} 0
+awscni_datastore_prefixes{eni="eni-00000001",state="empty"} 1
+awscni_datastore_prefixes{eni="eni-00000001",state="full"} 0
+awscni_datastore_prefixes{eni="eni-00000001",state="partial"} 1
+# HELP awscni_datastore_subnet_ips The IPs of the ENIs of the node in a subnet, by state
+# TYPE awscni_datastore_subnet_ips gauge
+awscni_datastore_subnet_ips{state="assigned",subnet_cidr="10.0.0.0/24"} 16
+awscni_datastore_subnet_ips{state="assigned",subnet_cidr="10.0.1.0/24"} 1
+awscni_datastore_subnet_ips{state="available",subnet_cidr="10.0.0.0/24"} 0
+awscni_datastore_subnet_ips{state="available",subnet_cidr="10.0.1.0/24"} 31
+awscni_datastore_subnet_ips{state="cooldown",subnet_cidr="10.0.0.0/24"} 0
+awscni_datastore_subnet_ips{state="cooldown",subnet_cidr="10.0.1.0/24"} 0
+`
+	assert.NoError(t, testutil.CollectAndCompare(datastoreCollector{c}, strings.NewReader(expected)))
+	assert.NotContains(t, c.eniSubnetCIDRs, "eni-removed")
+}
@@ -0,0 +1,58 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/delspool"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/rpc"
+)
+
+// delSpoolReason is the reason of the DelNetwork requests of the spooled releases
+const delSpoolReason = "PodDeletedWhileUnreachable"
+
+// delSpoolPath is a variable so that tests can use a temporary directory
+var delSpoolPath = delspool.DefaultPath
+
+// drainDelSpool releases the IPs of the DELs the plugin spooled while ipamd was unreachable. It runs once the gRPC
+// listener is up and before requests are served, so that a DEL is either spooled before the drain or sent to ipamd.
+func (s *server) drainDelSpool() {
+	drained, errs := delspool.Drain(delSpoolPath, func(release delspool.Release) error {
+		log.Infof("Releasing the IP of container %s, whose DEL was spooled at %s", release.ContainerID, release.SpooledAt)
+		_, err := s.DelNetwork(context.Background(), &rpc.DelNetworkRequest{
+			// The spool is read by ipamd itself, the plugin that wrote it may have another version
+			ClientVersion:     s.version,
+			K8S_POD_NAME:      release.PodName,
+			K8S_POD_NAMESPACE: release.PodNamespace,
+			K8S_POD_UID:       release.PodUID,
+			NetworkName:       release.NetworkName,
+			ContainerID:       release.ContainerID,
+			IfName:            release.IfName,
+			Reason:            delSpoolReason,
+		})
+		if err == datastore.ErrUnknownPod {
+			// Released by the reconciliation, or never assigned
+			return nil
+		}
+		return err
+	})
+	for _, err := range errs {
+		log.Warnf("%v", err)
+	}
+	if drained > 0 {
+		log.Infof("Released the IPs of %d spooled DELs", drained)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/delspool"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestDrainDelSpool(t *testing.T) {
+	delSpoolPath = filepath.Join(t.TempDir(), "del-spool")
+	defer func() { delSpoolPath = delspool.DefaultPath }()
+
+	ds := testDatastore()
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP("10.0.0.1"), Mask: net.CIDRMask(32, 32)}, false))
+	key := datastore.IPAMKey{NetworkName: "aws-cni", ContainerID: "cid", IfName: "eth0"}
+	_, _, err := ds.AssignPodIPv4Address(key, datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod"})
+	assert.NoError(t, err)
+	s := &server{version: "1.2.3", ipamContext: &IPAMContext{dataStore: ds, enableIPv4: true}}
+
+	// The plugin of the previous version spooled the DEL of the pod, and of a pod ipamd never assigned an IP to
+	for _, release := range []delspool.Release{
+		{ContainerID: "cid", IfName: "eth0", NetworkName: "aws-cni", PodName: "pod", PodNamespace: "default", ClientVersion: "1.2.2"},
+		{ContainerID: "unknown", IfName: "eth0", NetworkName: "aws-cni", ClientVersion: "1.2.2"},
+	} {
+		release.SpooledAt = time.Now()
+		assert.NoError(t, delspool.Write(delSpoolPath, release))
+	}
+
+	s.drainDelSpool()
+	assert.Equal(t, 0, ds.GetIPStats("4").AssignedIPs)
+	entries, err := os.ReadDir(delSpoolPath)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
@@ -0,0 +1,104 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	// envV4EgressSNATSource selects the IPv4 address that the egress-cni plugin translates the IPv4 egress of the pods
+	// of an IPv6 cluster to
+	envV4EgressSNATSource = "V4_EGRESS_SNAT_SOURCE"
+	// envV4EgressEIPAllocationIDs lists the Elastic IPs that back the egress address with the "eip" source
+	envV4EgressEIPAllocationIDs = "V4_EGRESS_EIP_ALLOCATION_IDS"
+
+	// v4EgressSNATSourcePrimary translates to the primary IPv4 address of the node
+	v4EgressSNATSourcePrimary = "primary"
+	// v4EgressSNATSourceSecondary translates to a secondary IPv4 address of the primary ENI dedicated to egress
+	v4EgressSNATSourceSecondary = "secondary"
+	// v4EgressSNATSourceEIP translates to a dedicated secondary IPv4 address associated with one of the Elastic IPs
+	v4EgressSNATSourceEIP = "eip"
+)
+
+func v4EgressSNATSource() string {
+	return utils.GetEnv(envV4EgressSNATSource, v4EgressSNATSourcePrimary)
+}
+
+func v4EgressEIPAllocationIDs() []string {
+	var allocationIDs []string
+	for _, allocationID := range strings.Split(os.Getenv(envV4EgressEIPAllocationIDs), ",") {
+		if allocationID = strings.TrimSpace(allocationID); allocationID != "" {
+			allocationIDs = append(allocationIDs, allocationID)
+		}
+	}
+	return allocationIDs
+}
+
+// validateV4EgressSNATSource loads and checks the SNAT source setting, and falls back to the primary IP where there is
+// no IPv4 egress to translate
+func (c *IPAMContext) validateV4EgressSNATSource() bool {
+	c.v4EgressSNATSource = v4EgressSNATSource()
+	switch c.v4EgressSNATSource {
+	case v4EgressSNATSourcePrimary, v4EgressSNATSourceSecondary:
+	case v4EgressSNATSourceEIP:
+		if len(v4EgressEIPAllocationIDs()) == 0 {
+			log.Errorf("%s=%s needs the Elastic IPs to use in %s", envV4EgressSNATSource, v4EgressSNATSourceEIP,
+				envV4EgressEIPAllocationIDs)
+			return false
+		}
+	default:
+		log.Errorf("Invalid %s %q, supported sources: %s, %s, %s", envV4EgressSNATSource, c.v4EgressSNATSource,
+			v4EgressSNATSourcePrimary, v4EgressSNATSourceSecondary, v4EgressSNATSourceEIP)
+		return false
+	}
+
+	// IPv4 clusters SNAT through the host network, and NAT64 translates in the NAT gateway. IPv6-only nodes have no IPv4
+	// address to translate to and always go through NAT64.
+	if c.v4EgressSNATSource != v4EgressSNATSourcePrimary && (!c.enableIPv6 || enableV4EgressNAT64() || c.ipv6OnlyNode()) {
+		log.Warnf("%s only applies to the IPv4 egress of IPv6 clusters without NAT64, falling back to the primary IP",
+			envV4EgressSNATSource)
+		c.v4EgressSNATSource = v4EgressSNATSourcePrimary
+	}
+	return true
+}
+
+// ipv6OnlyNode returns whether the instance has no IPv4 address
+func (c *IPAMContext) ipv6OnlyNode() bool {
+	return c.awsClient != nil && c.awsClient.GetLocalIPv4() == nil
+}
+
+// setupEgressSNATIP picks the address the IPv4 egress of the pods is translated to. The aws-node entrypoint reads it
+// from the introspection endpoint to write it into the egress-cni plugin configuration.
+func (c *IPAMContext) setupEgressSNATIP(ctx context.Context) error {
+	var eipAllocationIDs []string
+	switch c.v4EgressSNATSource {
+	case v4EgressSNATSourceSecondary:
+	case v4EgressSNATSourceEIP:
+		eipAllocationIDs = v4EgressEIPAllocationIDs()
+	default:
+		return nil
+	}
+	ip, err := c.awsClient.SetupEgressSNATIP(ctx, eipAllocationIDs)
+	if err != nil {
+		return err
+	}
+	log.Infof("IPv4 egress of the pods is translated to %s (%s)", ip, c.v4EgressSNATSource)
+	c.egressSNATIP = ip
+	return nil
+}
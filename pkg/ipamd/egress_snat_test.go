@@ -0,0 +1,94 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateV4EgressSNATSource(t *testing.T) {
+	c := &IPAMContext{enableIPv6: true}
+	assert.True(t, c.validateV4EgressSNATSource())
+	assert.Equal(t, v4EgressSNATSourcePrimary, c.v4EgressSNATSource)
+
+	t.Setenv(envV4EgressSNATSource, "elastic")
+	assert.False(t, c.validateV4EgressSNATSource())
+
+	t.Setenv(envV4EgressSNATSource, v4EgressSNATSourceEIP)
+	assert.False(t, c.validateV4EgressSNATSource())
+	t.Setenv(envV4EgressEIPAllocationIDs, "eipalloc-1, eipalloc-2")
+	assert.True(t, c.validateV4EgressSNATSource())
+	assert.Equal(t, v4EgressSNATSourceEIP, c.v4EgressSNATSource)
+	assert.Equal(t, []string{"eipalloc-1", "eipalloc-2"}, v4EgressEIPAllocationIDs())
+
+	// There is nothing to translate in IPv4 clusters or with NAT64
+	c = &IPAMContext{enableIPv4: true}
+	assert.True(t, c.validateV4EgressSNATSource())
+	assert.Equal(t, v4EgressSNATSourcePrimary, c.v4EgressSNATSource)
+	t.Setenv(envEnableV4EgressNAT64, "true")
+	c = &IPAMContext{enableIPv6: true}
+	assert.True(t, c.validateV4EgressSNATSource())
+	assert.Equal(t, v4EgressSNATSourcePrimary, c.v4EgressSNATSource)
+}
+
+func TestValidateV4EgressSNATSourceIPv6OnlyNode(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	t.Setenv(envV4EgressSNATSource, v4EgressSNATSourceSecondary)
+	c := &IPAMContext{awsClient: m.awsutils, enableIPv6: true}
+	m.awsutils.EXPECT().GetLocalIPv4().Return(net.ParseIP("10.0.0.10"))
+	assert.True(t, c.validateV4EgressSNATSource())
+	assert.Equal(t, v4EgressSNATSourceSecondary, c.v4EgressSNATSource)
+
+	// There is no IPv4 address on the node, the egress goes through NAT64
+	m.awsutils.EXPECT().GetLocalIPv4().Return(nil)
+	assert.True(t, c.validateV4EgressSNATSource())
+	assert.Equal(t, v4EgressSNATSourcePrimary, c.v4EgressSNATSource)
+}
+
+func TestSetupEgressSNATIP(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	c := &IPAMContext{awsClient: m.awsutils, enableIPv6: true, v4EgressSNATSource: v4EgressSNATSourcePrimary}
+	assert.NoError(t, c.setupEgressSNATIP(ctx))
+	assert.Empty(t, c.egressSNATIP)
+
+	c.v4EgressSNATSource = v4EgressSNATSourceSecondary
+	m.awsutils.EXPECT().SetupEgressSNATIP(ctx, nil).Return("10.0.0.20", nil)
+	assert.NoError(t, c.setupEgressSNATIP(ctx))
+	assert.Equal(t, "10.0.0.20", c.egressSNATIP)
+
+	t.Setenv(envV4EgressEIPAllocationIDs, "eipalloc-1")
+	c = &IPAMContext{awsClient: m.awsutils, enableIPv6: true, v4EgressSNATSource: v4EgressSNATSourceEIP}
+	m.awsutils.EXPECT().SetupEgressSNATIP(ctx, []string{"eipalloc-1"}).Return("", errors.New("no Elastic IP available"))
+	assert.Error(t, c.setupEgressSNATIP(ctx))
+
+	m.awsutils.EXPECT().SetupEgressSNATIP(ctx, []string{"eipalloc-1"}).Return("10.0.0.25", nil)
+	assert.NoError(t, c.setupEgressSNATIP(ctx))
+	rr := httptest.NewRecorder()
+	egressSNATIPV1RequestHandler(c)(rr, httptest.NewRequest("GET", "/v1/egress-snat-ip", nil))
+	var snatIP EgressSNATIP
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &snatIP))
+	assert.Equal(t, EgressSNATIP{IP: "10.0.0.25", Source: v4EgressSNATSourceEIP}, snatIP)
+}
@@ -0,0 +1,99 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+const (
+	eniRepairInterval = 10 * time.Second
+
+	eniNetworkRepairedReason = "ENINetworkRepaired"
+)
+
+// eniNetwork is what the network of a secondary ENI was set up with
+type eniNetwork struct {
+	eniIP        string
+	mac          string
+	deviceNumber int
+	subnetCIDR   string
+}
+
+func (c *IPAMContext) setENINetwork(eni string, network eniNetwork) {
+	c.eniNetworksLock.Lock()
+	defer c.eniNetworksLock.Unlock()
+	if c.eniNetworks == nil {
+		c.eniNetworks = make(map[string]eniNetwork)
+	}
+	c.eniNetworks[eni] = network
+}
+
+// MonitorENINetworks repairs the network of the secondary ENIs when the host removes part of it, after a restart of a
+// host network daemon for example, instead of waiting for the ENIs to be set up again
+func (c *IPAMContext) MonitorENINetworks() {
+	for {
+		time.Sleep(eniRepairInterval)
+		c.repairENINetworks()
+	}
+}
+
+// repairENINetworks checks the network of the secondary ENIs in the datastore and repairs it if needed
+func (c *IPAMContext) repairENINetworks() {
+	enis := c.dataStore.GetENIInfos().ENIs
+	// The rules of the pods on secondary ENIs route their traffic through the table of the ENI, IPv4 only. In the per-pod
+	// route table mode they point to the tables of the pods instead and are left alone.
+	podIPs := map[int][]string{}
+	if !networkutils.PodRouteTablesEnabled() {
+		for _, info := range c.dataStore.AllocatedIPs() {
+			podIPs[info.DeviceNumber] = append(podIPs[info.DeviceNumber], info.IP)
+		}
+	}
+
+	c.eniNetworksLock.Lock()
+	networks := make(map[string]eniNetwork, len(c.eniNetworks))
+	for eni, network := range c.eniNetworks {
+		// Forget the ENIs removed from the datastore
+		if _, ok := enis[eni]; !ok {
+			delete(c.eniNetworks, eni)
+			continue
+		}
+		networks[eni] = network
+	}
+	c.eniNetworksLock.Unlock()
+
+	for eni, network := range networks {
+		repaired, err := c.networkClient.RepairENINetwork(network.eniIP, network.mac, network.deviceNumber, network.subnetCIDR,
+			podIPs[network.deviceNumber])
+		if err != nil {
+			log.Warnf("Failed to repair the network of ENI %s: %v", eni, err)
+			ipamdErrInc("repairENINetworkFailed")
+			continue
+		}
+		if !repaired {
+			continue
+		}
+		message := fmt.Sprintf("Repaired the routes and rules of ENI %s removed on the host", eni)
+		log.Infof(message)
+		if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+			eventRecorder.SendPodEvent(v1.EventTypeWarning, eniNetworkRepairedReason, "RepairENINetwork", message)
+		}
+	}
+}
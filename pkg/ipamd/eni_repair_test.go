@@ -0,0 +1,59 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestRepairENINetworks(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+
+	ds := testDatastore()
+	assert.NoError(t, ds.AddENI(secENIid, secDevice, false, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP(ipaddr11), Mask: net.CIDRMask(32, 32)}, false))
+	_, _, err := ds.AssignPodIPv4Address(datastore.IPAMKey{NetworkName: "net0", ContainerID: "sandbox", IfName: "eth0"},
+		datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "pod"})
+	assert.NoError(t, err)
+
+	c := &IPAMContext{dataStore: ds, networkClient: m.network}
+	secNetwork := eniNetwork{eniIP: ipaddr12, mac: secMAC, deviceNumber: secDevice, subnetCIDR: secSubnet}
+	c.setENINetwork(secENIid, secNetwork)
+	// Not in the datastore anymore
+	c.setENINetwork("eni-removed", eniNetwork{eniIP: "10.10.30.10", mac: "12:ef:2a:98:e5:5c", deviceNumber: 3, subnetCIDR: "10.10.30.0/24"})
+
+	m.network.EXPECT().RepairENINetwork(ipaddr12, secMAC, secDevice, secSubnet, []string{ipaddr11}).Return(false, nil)
+	c.repairENINetworks()
+	assert.Equal(t, map[string]eniNetwork{secENIid: secNetwork}, c.eniNetworks)
+	assert.Empty(t, fakeRecorder.Events)
+
+	m.network.EXPECT().RepairENINetwork(ipaddr12, secMAC, secDevice, secSubnet, []string{ipaddr11}).Return(true, nil)
+	c.repairENINetworks()
+	if assert.Len(t, fakeRecorder.Events, 1) {
+		assert.Contains(t, <-fakeRecorder.Events, eniNetworkRepairedReason)
+	}
+
+	// The rules of the pods point to their own route tables
+	t.Setenv("ENABLE_POD_ROUTE_TABLES", "true")
+	m.network.EXPECT().RepairENINetwork(ipaddr12, secMAC, secDevice, secSubnet, nil).Return(false, nil)
+	c.repairENINetworks()
+}
@@ -0,0 +1,99 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"fmt"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+const incompatibleFeaturesReason = "IncompatibleFeatures"
+
+// FeatureConflict is a combination of settings that ipamd does not support, as reported by the
+// /v1/feature-conflicts introspection endpoint
+type FeatureConflict struct {
+	Features []string `json:"features"`
+	Reason   string   `json:"reason"`
+}
+
+// featureRule describes a combination of settings that ipamd does not support. Instead of running with undefined
+// behavior, ipamd turns off the setting that cannot apply and reports the conflict.
+type featureRule struct {
+	features  []string
+	conflicts func(c *IPAMContext) bool
+	// resolve turns off the setting that cannot apply, nil when the setting is ignored anyway
+	resolve func(c *IPAMContext)
+	reason  string
+}
+
+// featureRules is the compatibility matrix of the settings that ipamd degrades from instead of failing to start
+var featureRules = []featureRule{
+	{
+		features: []string{envOnDemandAllocation, envWarmENITarget, envWarmIPTarget, envMinimumIPTarget, envEnableIpv4PrefixDelegation},
+		conflicts: func(c *IPAMContext) bool {
+			return c.onDemandAllocation && (c.warmENITarget != 0 || c.warmIPTargetsDefined() || c.enablePrefixDelegation)
+		},
+		resolve: func(c *IPAMContext) { c.onDemandAllocation = false },
+		reason: fmt.Sprintf("on-demand allocation replaces the warm pool, so it requires %s=0 without %s, %s or "+
+			"prefix delegation, using the warm pool", envWarmENITarget, envWarmIPTarget, envMinimumIPTarget),
+	},
+	{
+		features:  []string{envWarmIPRebalancing, envEnableIpv4PrefixDelegation},
+		conflicts: func(c *IPAMContext) bool { return c.warmIPRebalancing && c.enablePrefixDelegation },
+		resolve:   func(c *IPAMContext) { c.warmIPRebalancing = false },
+		reason:    "prefixes are shared by many pods, so there are no single warm IPs to move",
+	},
+	{
+		features:  []string{envIPLeaseTarget, envEnableIPv6, envEnablePodENI},
+		conflicts: func(c *IPAMContext) bool { return c.ipLeaseTarget > 0 && (c.enableIPv6 || c.enablePodENI) },
+		resolve:   func(c *IPAMContext) { c.ipLeaseTarget = 0 },
+		reason:    "only IPv4 addresses are leased and the plugin cannot tell which pods need a branch ENI, IPs are not leased to the plugin",
+	},
+	{
+		features:  []string{"ENABLE_POD_ROUTE_TABLES", envEnableIPv6},
+		conflicts: func(c *IPAMContext) bool { return c.enableIPv6 && networkutils.PodRouteTablesEnabled() },
+		reason:    "only IPv4 pods get a route table of their own, the setting is ignored in IPv6 clusters",
+	},
+}
+
+// resolveFeatureConflicts turns off the settings that cannot apply with the rest of the configuration, and reports
+// each conflict with a warning event on the aws-node pod. The environment only changes with a restart of aws-node, so
+// the combination is checked again whenever it changes.
+func (c *IPAMContext) resolveFeatureConflicts() {
+	c.featureConflicts = nil
+	for _, rule := range featureRules {
+		if !rule.conflicts(c) {
+			continue
+		}
+		if rule.resolve != nil {
+			rule.resolve(c)
+		}
+		c.featureConflicts = append(c.featureConflicts, FeatureConflict{Features: rule.features, Reason: rule.reason})
+		message := fmt.Sprintf("Unsupported combination of %s: %s", strings.Join(rule.features, ", "), rule.reason)
+		log.Warn(message)
+		if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+			eventRecorder.SendPodEvent(v1.EventTypeWarning, incompatibleFeaturesReason, "ValidateConfig", message)
+		}
+	}
+}
+
+// FeatureConflicts returns the combinations of settings that ipamd degraded from at startup
+func (c *IPAMContext) FeatureConflicts() []FeatureConflict {
+	return c.featureConflicts
+}
@@ -0,0 +1,63 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestResolveFeatureConflicts(t *testing.T) {
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+
+	// Nothing to degrade from
+	c := &IPAMContext{enableIPv4: true, onDemandAllocation: true, warmIPRebalancing: true, ipLeaseTarget: 5}
+	c.resolveFeatureConflicts()
+	assert.Empty(t, c.FeatureConflicts())
+	assert.True(t, c.onDemandAllocation)
+	assert.True(t, c.warmIPRebalancing)
+	assert.Equal(t, 5, c.ipLeaseTarget)
+	assert.Empty(t, fakeRecorder.Events)
+
+	t.Setenv("ENABLE_POD_ROUTE_TABLES", "true")
+	c = &IPAMContext{enableIPv6: true, enablePrefixDelegation: true, onDemandAllocation: true, warmIPRebalancing: true}
+	c.resolveFeatureConflicts()
+	assert.False(t, c.onDemandAllocation)
+	assert.False(t, c.warmIPRebalancing)
+	if assert.Len(t, c.FeatureConflicts(), 3) {
+		assert.Equal(t, []string{"ENABLE_POD_ROUTE_TABLES", envEnableIPv6}, c.FeatureConflicts()[2].Features)
+	}
+	if assert.Len(t, fakeRecorder.Events, 3) {
+		assert.Contains(t, <-fakeRecorder.Events, incompatibleFeaturesReason)
+		<-fakeRecorder.Events
+		<-fakeRecorder.Events
+	}
+
+	c = &IPAMContext{enableIPv4: true, enablePodENI: true, ipLeaseTarget: 5}
+	c.resolveFeatureConflicts()
+	assert.Zero(t, c.ipLeaseTarget)
+	assert.Len(t, c.FeatureConflicts(), 1)
+	assert.Len(t, fakeRecorder.Events, 1)
+
+	rr := httptest.NewRecorder()
+	featureConflictsV1RequestHandler(c)(rr, httptest.NewRequest("GET", "/v1/feature-conflicts", nil))
+	var conflicts []FeatureConflict
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &conflicts))
+	assert.Equal(t, c.FeatureConflicts(), conflicts)
+}
@@ -0,0 +1,63 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"path/filepath"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/featuregate"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// featureGateStateFileName records the features enabled by the last run of ipamd, next to the checkpoint
+const featureGateStateFileName = "feature-gates.json"
+
+// featureDisableHooks remove what a feature left on the node, when it is disabled after a run that enabled it. They run
+// before the node is initialized, and must be idempotent.
+var featureDisableHooks = map[featuregate.Feature]func(c *IPAMContext) error{}
+
+func featureGateStatePath() string {
+	return filepath.Join(filepath.Dir(dsBackingStorePath()), featureGateStateFileName)
+}
+
+// loadFeatureGates loads FEATURE_GATES, disables the features turned off since the last run and exports the state of
+// the gates
+func (c *IPAMContext) loadFeatureGates() {
+	gate, errs := featuregate.FromEnv()
+	for _, err := range errs {
+		log.Warnf("%v", err)
+	}
+	c.featureGate = gate
+
+	hooks := make(map[featuregate.Feature]func() error, len(featureDisableHooks))
+	for feature, hook := range featureDisableHooks {
+		hook := hook
+		hooks[feature] = func() error {
+			log.Infof("Disabling feature %s, enabled by the previous run of ipamd", feature)
+			return hook(c)
+		}
+	}
+	for _, err := range gate.Reconcile(featureGateStatePath(), hooks) {
+		log.Errorf("%v", err)
+	}
+
+	for _, state := range gate.States() {
+		enabled := 0.0
+		if state.Enabled {
+			enabled = 1
+		}
+		prometheusmetrics.FeatureEnabled.WithLabelValues(string(state.Feature), string(state.Stage)).Set(enabled)
+	}
+	log.Infof("Feature gates: %q", gate.String())
+}
@@ -0,0 +1,134 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
+)
+
+const (
+	iamPermissionCheckInterval = 30 * time.Minute
+
+	// IAMPermissionsConditionType is the node condition that is True when the node IAM role is missing EC2 permissions
+	// the configuration needs
+	IAMPermissionsConditionType v1.NodeConditionType = "AWSVPCCNIMissingIAMPermissions"
+
+	missingIAMPermissionsReason  = "MissingIAMPermissions"
+	iamPermissionsVerifiedReason = "IAMPermissionsVerified"
+)
+
+// MonitorIAMPermissions periodically checks the EC2 permissions the configuration needs, and reports missing ones
+// in the IAMPermissionsConditionType node condition
+func (c *IPAMContext) MonitorIAMPermissions() {
+	ctx := context.Background()
+	for {
+		permissions := c.checkIAMPermissions(ctx)
+		if err := c.setIAMPermissionsCondition(ctx, permissions); err != nil {
+			log.Warnf("Failed to update node condition %s: %v", IAMPermissionsConditionType, err)
+		}
+		time.Sleep(iamPermissionCheckInterval)
+	}
+}
+
+// checkIAMPermissions checks the EC2 permissions the configuration needs and keeps the result for introspection
+func (c *IPAMContext) checkIAMPermissions(ctx context.Context) []awsutils.EC2Permission {
+	subnetID, securityGroups, enableENIProvisioning := c.eniProvisioningConfig(ctx)
+	permissions := c.awsClient.CheckEC2Permissions(ctx, subnetID, securityGroups, enableENIProvisioning)
+	for _, permission := range permissions {
+		if permission.Status == awsutils.PermissionDenied {
+			log.Errorf("The node IAM role is missing %s, needed to %s", permission.Action, permission.Reason)
+		}
+	}
+
+	c.iamPermissionsLock.Lock()
+	defer c.iamPermissionsLock.Unlock()
+	c.iamPermissions = permissions
+	return permissions
+}
+
+// IAMPermissions returns the result of the last check of the EC2 permissions the configuration needs
+func (c *IPAMContext) IAMPermissions() []awsutils.EC2Permission {
+	c.iamPermissionsLock.RLock()
+	defer c.iamPermissionsLock.RUnlock()
+	return c.iamPermissions
+}
+
+// iamPermissionsCondition returns the node condition reporting the denied permissions
+func iamPermissionsCondition(permissions []awsutils.EC2Permission) v1.NodeCondition {
+	var denied []string
+	for _, permission := range permissions {
+		if permission.Status == awsutils.PermissionDenied {
+			denied = append(denied, permission.Action)
+		}
+	}
+	if len(denied) == 0 {
+		return v1.NodeCondition{
+			Type:    IAMPermissionsConditionType,
+			Status:  v1.ConditionFalse,
+			Reason:  iamPermissionsVerifiedReason,
+			Message: "The node IAM role has the EC2 permissions that could be verified",
+		}
+	}
+	return v1.NodeCondition{
+		Type:    IAMPermissionsConditionType,
+		Status:  v1.ConditionTrue,
+		Reason:  missingIAMPermissionsReason,
+		Message: fmt.Sprintf("The node IAM role is missing %s", strings.Join(denied, ", ")),
+	}
+}
+
+// setIAMPermissionsCondition sets the IAMPermissionsConditionType condition on the node
+func (c *IPAMContext) setIAMPermissionsCondition(ctx context.Context, permissions []awsutils.EC2Permission) error {
+	return setNodeCondition(ctx, c.k8sClient, iamPermissionsCondition(permissions))
+}
+
+// setNodeCondition sets a condition on the node, keeping its last transition time while its status does not change
+func setNodeCondition(ctx context.Context, k8sClient client.Client, condition v1.NodeCondition) error {
+	node, err := k8sapi.GetNode(ctx, k8sClient)
+	if err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	condition.LastHeartbeatTime = now
+	condition.LastTransitionTime = now
+
+	newNode := node.DeepCopy()
+	found := false
+	for i, existing := range newNode.Status.Conditions {
+		if existing.Type != condition.Type {
+			continue
+		}
+		if existing.Status == condition.Status {
+			condition.LastTransitionTime = existing.LastTransitionTime
+		}
+		newNode.Status.Conditions[i] = condition
+		found = true
+	}
+	if !found {
+		newNode.Status.Conditions = append(newNode.Status.Conditions, condition)
+	}
+	// A strategic merge patch only sends this condition, leaving the conditions owned by the kubelet alone
+	return k8sClient.Status().Patch(ctx, newNode, client.StrategicMergeFrom(&node))
+}
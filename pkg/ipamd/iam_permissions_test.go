@@ -0,0 +1,75 @@
+package ipamd
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+func TestCheckIAMPermissions(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	_ = os.Setenv("MY_NODE_NAME", myNodeName)
+
+	mockContext := &IPAMContext{
+		awsClient: m.awsutils,
+		k8sClient: m.k8sClient,
+	}
+	fakeNode := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: myNodeName},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}},
+		},
+	}
+	assert.NoError(t, m.k8sClient.Create(ctx, &fakeNode))
+
+	getCondition := func() *v1.NodeCondition {
+		var node v1.Node
+		assert.NoError(t, m.k8sClient.Get(ctx, types.NamespacedName{Name: myNodeName}, &node))
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == IAMPermissionsConditionType {
+				return &node.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	// A denied permission sets the condition
+	permissions := []awsutils.EC2Permission{
+		{Action: "ec2:DescribeInstances", Status: awsutils.PermissionAllowed},
+		{Action: "ec2:CreateTags", Status: awsutils.PermissionDenied},
+		{Action: "ec2:AssignPrivateIpAddresses", Status: awsutils.PermissionUnverified},
+	}
+	m.awsutils.EXPECT().CheckEC2Permissions(ctx, "", nil, true).Return(permissions)
+	assert.Equal(t, permissions, mockContext.checkIAMPermissions(ctx))
+	assert.Equal(t, permissions, mockContext.IAMPermissions())
+	assert.NoError(t, mockContext.setIAMPermissionsCondition(ctx, permissions))
+	condition := getCondition()
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionTrue, condition.Status)
+		assert.Equal(t, missingIAMPermissionsReason, condition.Reason)
+		assert.Contains(t, condition.Message, "ec2:CreateTags")
+	}
+
+	// Once the permission is granted, the condition is cleared and other conditions are kept
+	permissions[1].Status = awsutils.PermissionAllowed
+	m.awsutils.EXPECT().CheckEC2Permissions(gomock.Any(), "", nil, true).Return(permissions)
+	assert.NoError(t, mockContext.setIAMPermissionsCondition(ctx, mockContext.checkIAMPermissions(ctx)))
+	condition = getCondition()
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionFalse, condition.Status)
+		assert.Equal(t, iamPermissionsVerifiedReason, condition.Reason)
+	}
+	var node v1.Node
+	assert.NoError(t, m.k8sClient.Get(ctx, types.NamespacedName{Name: myNodeName}, &node))
+	assert.Len(t, node.Status.Conditions, 2)
+}
@@ -19,9 +19,11 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/eniconfig"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/retry"
@@ -39,6 +41,21 @@ type rootResponse struct {
 	AvailableCommands []string
 }
 
+// CNIAddStats counts the outcome of CNI ADD requests handled since ipamd started. The CurrentPlugin counters leave out
+// the ADDs of the previous plugin version, and the IPs claimed from leases, whose plugin version is unknown.
+type CNIAddStats struct {
+	Succeeded              int64 `json:"succeeded"`
+	Failed                 int64 `json:"failed"`
+	CurrentPluginSucceeded int64 `json:"currentPluginSucceeded"`
+	CurrentPluginFailed    int64 `json:"currentPluginFailed"`
+}
+
+// EgressSNATIP is the IPv4 address the IPv4 egress of the pods is translated to, empty for the primary IP of the node
+type EgressSNATIP struct {
+	IP     string `json:"ip"`
+	Source string `json:"source"`
+}
+
 // LoggingHandler is a object for handling http request
 type LoggingHandler struct {
 	h http.Handler
@@ -79,6 +96,16 @@ func (c *IPAMContext) setupIntrospectionServer() *http.Server {
 		"/v1/eni-configs":               eniConfigRequestHandler(c),
 		"/v1/networkutils-env-settings": networkEnvV1RequestHandler(),
 		"/v1/ipamd-env-settings":        ipamdEnvV1RequestHandler(),
+		"/v1/datastore-snapshot":        datastoreSnapshotV1RequestHandler(c),
+		"/v1/cni-add-stats":             cniAddStatsV1RequestHandler(c),
+		"/v1/iam-permissions":           iamPermissionsV1RequestHandler(c),
+		"/v1/egress-snat-ip":            egressSNATIPV1RequestHandler(c),
+		"/v1/feature-conflicts":         featureConflictsV1RequestHandler(c),
+		"/v1/maintenance":               maintenanceV1RequestHandler(c),
+		"/v1/unmanaged-enis":            unmanagedENIsV1RequestHandler(c),
+		"/v1/pod-addresses":             podAddressesV1RequestHandler(c),
+		"/v1/simulate-add":              simulateAddV1RequestHandler(c),
+		"/v1/ec2-failures":              ec2FailuresV1RequestHandler(c),
 	}
 	paths := make([]string, 0, len(serverFunctions))
 	for path := range serverFunctions {
@@ -112,9 +139,14 @@ func (c *IPAMContext) setupIntrospectionServer() *http.Server {
 
 	log.Infof("Serving introspection endpoints on %s", addr)
 
+	auth := getIntrospectionAuth()
+	if auth.allowedUIDs != nil && !strings.HasPrefix(addr, "unix:") {
+		log.Warnf("%s requires a Unix Domain Socket bind address, denying all introspection requests", envIntrospectionAllowedUIDs)
+	}
 	server := &http.Server{
 		Addr:         addr,
-		Handler:      loggingServeMux,
+		Handler:      c.shedWhenDegraded(auth.authorize(loggingServeMux)),
+		ConnContext:  connContext,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 	}
@@ -182,6 +214,178 @@ func ipamdEnvV1RequestHandler() func(http.ResponseWriter, *http.Request) {
 	}
 }
 
+// envEnableDatastoreSnapshotMerge lets POST /v1/datastore-snapshot change the allocations of the datastore. Defaults
+// to false, the endpoint then only exports snapshots.
+const envEnableDatastoreSnapshotMerge = "ENABLE_DATASTORE_SNAPSHOT_MERGE"
+
+// datastoreSnapshotV1RequestHandler exports the allocations in the datastore on GET, and merges a previously
+// exported snapshot back into the datastore on POST when enabled
+func datastoreSnapshotV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			responseJSON, err := json.Marshal(ipam.dataStore.Snapshot())
+			if err != nil {
+				log.Errorf("Failed to marshal datastore snapshot: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			logErr(w.Write(responseJSON))
+		case http.MethodPost:
+			if !parseBoolEnvVar(envEnableDatastoreSnapshotMerge, false) {
+				http.Error(w, envEnableDatastoreSnapshotMerge+" is not set", http.StatusForbidden)
+				return
+			}
+			var snapshot datastore.CheckpointData
+			if err := json.NewDecoder(r.Body).Decode(&snapshot); err != nil {
+				log.Errorf("Failed to unmarshal datastore snapshot: %v", err)
+				http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+				return
+			}
+			restored, err := ipam.dataStore.MergeSnapshot(snapshot, ipam.enableIPv6)
+			if err != nil {
+				log.Errorf("Failed to merge datastore snapshot: %v", err)
+				http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+				return
+			}
+			log.Infof("Merged datastore snapshot, restored %d of %d allocations", restored, len(snapshot.Allocations))
+			responseJSON, err := json.Marshal(map[string]int{"restored": restored, "skipped": len(snapshot.Allocations) - restored})
+			if err != nil {
+				log.Errorf("Failed to marshal merge result: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			logErr(w.Write(responseJSON))
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func cniAddStatsV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := CNIAddStats{
+			Succeeded:              atomic.LoadInt64(&ipam.cniAddSucceeded),
+			Failed:                 atomic.LoadInt64(&ipam.cniAddFailed),
+			CurrentPluginSucceeded: atomic.LoadInt64(&ipam.cniAddSucceededCurrent),
+			CurrentPluginFailed:    atomic.LoadInt64(&ipam.cniAddFailedCurrent),
+		}
+		responseJSON, err := json.Marshal(stats)
+		if err != nil {
+			log.Errorf("Failed to marshal CNI ADD stats: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// iamPermissionsV1RequestHandler reports the EC2 permissions the configuration needs, as of the last check
+func iamPermissionsV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(ipam.IAMPermissions())
+		if err != nil {
+			log.Errorf("Failed to marshal IAM permissions: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// egressSNATIPV1RequestHandler reports the IPv4 address the egress-cni plugin translates IPv4 egress to
+func egressSNATIPV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(EgressSNATIP{IP: ipam.egressSNATIP, Source: ipam.v4EgressSNATSource})
+		if err != nil {
+			log.Errorf("Failed to marshal egress SNAT IP: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// featureConflictsV1RequestHandler reports the unsupported combinations of settings ipamd degraded from
+func featureConflictsV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(ipam.FeatureConflicts())
+		if err != nil {
+			log.Errorf("Failed to marshal feature conflicts: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// maintenanceV1RequestHandler reports the maintenance mode set by the annotation of the node
+func maintenanceV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(MaintenanceMode{Mode: ipam.MaintenanceMode()})
+		if err != nil {
+			log.Errorf("Failed to marshal maintenance mode: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// unmanagedENIsV1RequestHandler reports the ENIs ipamd does not manage, and why
+func unmanagedENIsV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(ipam.UnmanagedENIs())
+		if err != nil {
+			log.Errorf("Failed to marshal unmanaged ENIs: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// ec2FailuresV1RequestHandler reports the recent failed EC2 calls that change resources, with their request IDs
+func ec2FailuresV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(ipam.awsClient.GetEC2Failures())
+		if err != nil {
+			log.Errorf("Failed to marshal EC2 failures: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// podAddressesV1RequestHandler reports the addresses of the pods and the address source backing each of them
+func podAddressesV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		responseJSON, err := json.Marshal(ipam.dataStore.PodAddresses())
+		if err != nil {
+			log.Errorf("Failed to marshal pod addresses: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
+// simulateAddV1RequestHandler reports what an ADD of the pod named by the name and namespace query parameters would get,
+// or of a new pod without them
+func simulateAddV1RequestHandler(ipam *IPAMContext) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		responseJSON, err := json.Marshal(ipam.simulateAdd(query.Get("name"), query.Get("namespace")))
+		if err != nil {
+			log.Errorf("Failed to marshal simulated ADD: %v", err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		logErr(w.Write(responseJSON))
+	}
+}
+
 func logErr(_ int, err error) {
 	if err != nil {
 		log.Errorf("Write failed: %v", err)
@@ -0,0 +1,138 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkhelper"
+)
+
+const (
+	// Environment variable to require the bearer token of the file in the Authorization header of introspection requests
+	envIntrospectionBearerTokenFile = "INTROSPECTION_BEARER_TOKEN_FILE"
+
+	// Environment variable with the comma separated UIDs allowed to connect to the introspection Unix Domain Socket
+	envIntrospectionAllowedUIDs = "INTROSPECTION_ALLOWED_UIDS"
+)
+
+// peerUIDKey is the context key of the UID of the process connected to the introspection socket
+type peerUIDKey struct{}
+
+// introspectionAuth is the authorization of the introspection requests. The zero value allows every request, like the
+// endpoint always did.
+type introspectionAuth struct {
+	// tokenFile requires its token in the Authorization header. It is read on every request, so that the token can be
+	// rotated without restarting.
+	tokenFile string
+	// allowedUIDs are the only processes allowed to connect to the Unix Domain Socket, nil allows all
+	allowedUIDs map[uint32]bool
+}
+
+// getIntrospectionAuth reads the authorization of the introspection endpoint from the environment
+func getIntrospectionAuth() introspectionAuth {
+	auth := introspectionAuth{tokenFile: os.Getenv(envIntrospectionBearerTokenFile)}
+	uids, ok := os.LookupEnv(envIntrospectionAllowedUIDs)
+	if !ok {
+		return auth
+	}
+	// Once set, only the valid UIDs are allowed, so that a typo does not open the endpoint to every process
+	auth.allowedUIDs = map[uint32]bool{}
+	for _, s := range strings.Split(uids, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			log.Warnf("Ignoring invalid UID %q in %s: %v", s, envIntrospectionAllowedUIDs, err)
+			continue
+		}
+		auth.allowedUIDs[uint32(uid)] = true
+	}
+	return auth
+}
+
+// connContext records the UID of the process connected to the Unix Domain Socket
+func connContext(ctx context.Context, conn net.Conn) context.Context {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+	uid, err := networkhelper.PeerUID(unixConn)
+	if err != nil {
+		log.Warnf("Failed to read the peer credentials of an introspection connection: %v", err)
+		return ctx
+	}
+	return context.WithValue(ctx, peerUIDKey{}, uid)
+}
+
+// authorize wraps the handler with the UID and bearer token checks, and logs the requests that change the state of
+// ipamd along with their outcome
+func (a introspectionAuth) authorize(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uid, hasUID := r.Context().Value(peerUIDKey{}).(uint32)
+		caller := r.RemoteAddr
+		if hasUID {
+			caller = "UID " + strconv.FormatUint(uint64(uid), 10)
+		}
+		mutating := r.Method != http.MethodGet && r.Method != http.MethodHead
+
+		if a.allowedUIDs != nil && (!hasUID || !a.allowedUIDs[uid]) {
+			log.Warnf("Denied introspection request %s %s from %s: UID not allowed", r.Method, r.URL.Path, caller)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		if a.tokenFile != "" {
+			token, err := os.ReadFile(a.tokenFile)
+			if err != nil {
+				log.Errorf("Failed to read the introspection bearer token file: %v", err)
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			expected := strings.TrimSpace(string(token))
+			provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if expected == "" || !found || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+				log.Warnf("Denied introspection request %s %s from %s: invalid bearer token", r.Method, r.URL.Path, caller)
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if !mutating {
+			h.ServeHTTP(w, r)
+			return
+		}
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(recorder, r)
+		log.Infof("Audit: introspection request %s %s from %s returned %d", r.Method, r.URL.Path, caller, recorder.status)
+	})
+}
+
+// statusRecorder keeps the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
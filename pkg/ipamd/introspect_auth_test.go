@@ -0,0 +1,80 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetIntrospectionAuth(t *testing.T) {
+	assert.Equal(t, introspectionAuth{}, getIntrospectionAuth())
+
+	t.Setenv(envIntrospectionBearerTokenFile, "/run/aws-node/token")
+	t.Setenv(envIntrospectionAllowedUIDs, "0, 1000,nobody")
+	assert.Equal(t, introspectionAuth{tokenFile: "/run/aws-node/token", allowedUIDs: map[uint32]bool{0: true, 1000: true}},
+		getIntrospectionAuth())
+
+	// Set without valid UIDs, no process is allowed
+	t.Setenv(envIntrospectionAllowedUIDs, "")
+	assert.Equal(t, map[uint32]bool{}, getIntrospectionAuth().allowedUIDs)
+}
+
+func TestIntrospectionAuthorize(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("s3cret\n"), 0600))
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		}
+	})
+
+	serve := func(auth introspectionAuth, method, token string, uid *uint32) int {
+		r := httptest.NewRequest(method, "/v1/datastore-snapshot", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if uid != nil {
+			r = r.WithContext(context.WithValue(r.Context(), peerUIDKey{}, *uid))
+		}
+		w := httptest.NewRecorder()
+		auth.authorize(handler).ServeHTTP(w, r)
+		return w.Code
+	}
+	root, other := uint32(0), uint32(1000)
+
+	assert.Equal(t, http.StatusOK, serve(introspectionAuth{}, http.MethodGet, "", nil))
+
+	byToken := introspectionAuth{tokenFile: tokenFile}
+	assert.Equal(t, http.StatusUnauthorized, serve(byToken, http.MethodGet, "", nil))
+	assert.Equal(t, http.StatusUnauthorized, serve(byToken, http.MethodGet, "wrong", nil))
+	assert.Equal(t, http.StatusOK, serve(byToken, http.MethodGet, "s3cret", nil))
+	assert.Equal(t, http.StatusUnprocessableEntity, serve(byToken, http.MethodPost, "s3cret", nil))
+
+	byUID := introspectionAuth{allowedUIDs: map[uint32]bool{root: true}}
+	assert.Equal(t, http.StatusOK, serve(byUID, http.MethodGet, "", &root))
+	assert.Equal(t, http.StatusForbidden, serve(byUID, http.MethodGet, "", &other))
+	// Without peer credentials, over TCP
+	assert.Equal(t, http.StatusForbidden, serve(byUID, http.MethodGet, "", nil))
+
+	// An unreadable token file denies every request
+	assert.Equal(t, http.StatusInternalServerError,
+		serve(introspectionAuth{tokenFile: filepath.Join(t.TempDir(), "missing")}, http.MethodGet, "s3cret", nil))
+}
@@ -0,0 +1,71 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+func TestEC2FailuresV1RequestHandler(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	failure := awsutils.EC2Failure{
+		Time:      time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		API:       "AssignPrivateIpAddresses",
+		Class:     "insufficient_subnet_ips",
+		Code:      "InsufficientFreeAddressesInSubnet",
+		Message:   "The specified subnet does not have enough free addresses to satisfy the request.",
+		RequestID: "6a2c1e4f-3b8d-4d2e-9f2a-0c1d2e3f4a5b",
+	}
+	m.awsutils.EXPECT().GetEC2Failures().Return([]awsutils.EC2Failure{failure})
+	c := &IPAMContext{awsClient: m.awsutils}
+
+	rr := httptest.NewRecorder()
+	ec2FailuresV1RequestHandler(c)(rr, httptest.NewRequest("GET", "/v1/ec2-failures", nil))
+	assert.Contains(t, rr.Body.String(), `"requestId":"6a2c1e4f-3b8d-4d2e-9f2a-0c1d2e3f4a5b"`)
+	var failures []awsutils.EC2Failure
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &failures))
+	assert.Equal(t, []awsutils.EC2Failure{failure}, failures)
+}
+
+func TestDatastoreSnapshotV1RequestHandlerMerge(t *testing.T) {
+	c := &IPAMContext{dataStore: datastoreWith3FreeIPs()}
+	snapshot := `{"version": "vpc-cni-ipam/1", "allocations": [{"containerID": "c1", "ipv4": "` + ipaddr01 + `"}]}`
+	post := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		datastoreSnapshotV1RequestHandler(c)(rr, httptest.NewRequest(http.MethodPost, "/v1/datastore-snapshot",
+			strings.NewReader(snapshot)))
+		return rr
+	}
+
+	// Merging changes the allocations, it is refused unless enabled
+	assert.Equal(t, http.StatusForbidden, post().Code)
+	assert.Empty(t, c.dataStore.Snapshot().Allocations)
+
+	t.Setenv(envEnableDatastoreSnapshotMerge, "true")
+	rr := post()
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"restored": 1, "skipped": 0}`, rr.Body.String())
+	assert.Len(t, c.dataStore.Snapshot().Allocations, 1)
+}
@@ -0,0 +1,243 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iplease"
+)
+
+const (
+	// ipLeaseInterval is how often the claimed leases are confirmed and new ones offered
+	ipLeaseInterval = time.Second
+
+	// The IPs offered to the plugin are assigned in the datastore to sandboxes of this network, until a pod claims them
+	ipLeaseNetworkName = "_lease"
+	ipLeaseIfName      = "lease"
+)
+
+// ipLeasePath is a variable so that tests can use a temporary file
+var ipLeasePath = iplease.DefaultPath
+
+// setupIPLeases confirms or releases the leases of the previous ipamd, which the datastore restored from the
+// checkpoint, then creates the lease file if IP_LEASE_TARGET is set
+func (c *IPAMContext) setupIPLeases() error {
+	c.ipLeaseLock.Lock()
+	defer c.ipLeaseLock.Unlock()
+
+	c.ipLeaseKeys = make(map[string]datastore.IPAMKey)
+	c.ipLeaseClaims = make(map[string]string)
+	for _, allocation := range c.dataStore.AllocatedIPs() {
+		if allocation.IPAMKey.NetworkName == ipLeaseNetworkName {
+			c.ipLeaseKeys[allocation.IP] = allocation.IPAMKey
+		}
+	}
+	previous, err := iplease.Open(ipLeasePath)
+	if err == nil {
+		claimed, _, err := previous.Retire()
+		previous.Close()
+		if err != nil {
+			log.Warnf("Failed to retire the previous IP lease file: %v", err)
+		}
+		c.confirmClaimsUnsafe(claimed)
+	} else if !os.IsNotExist(err) {
+		log.Warnf("Ignoring the previous IP lease file: %v", err)
+	}
+	for ip := range c.ipLeaseKeys {
+		c.releaseIPLeaseUnsafe(ip)
+	}
+
+	if c.ipLeaseTarget == 0 {
+		if err := os.Remove(ipLeasePath); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Failed to remove the IP lease file: %v", err)
+		}
+		return nil
+	}
+	c.ipLeases, err = iplease.Create(ipLeasePath, c.ipLeaseTarget, c.networkPolicyMode)
+	if err != nil {
+		return err
+	}
+	log.Infof("Leasing %d IPs to the CNI plugin through %s", c.ipLeaseTarget, ipLeasePath)
+	return nil
+}
+
+// MonitorIPLeases confirms the leases claimed by the plugin, and offers new ones in their place
+func (c *IPAMContext) MonitorIPLeases() {
+	if c.ipLeases == nil {
+		return
+	}
+	for {
+		time.Sleep(ipLeaseInterval)
+		c.confirmIPLeases()
+		c.offerIPLeases()
+	}
+}
+
+// confirmIPLeases assigns the claimed leases to the pods that claimed them
+func (c *IPAMContext) confirmIPLeases() {
+	c.ipLeaseLock.Lock()
+	defer c.ipLeaseLock.Unlock()
+	if c.ipLeases == nil {
+		return
+	}
+	claimed, err := c.ipLeases.TakeClaims()
+	if err != nil {
+		log.Warnf("Failed to read the claimed IP leases: %v", err)
+		return
+	}
+	c.confirmClaimsUnsafe(claimed)
+}
+
+// cancelIPLeases settles the leases claimed by a container before its DEL. A claim that ipamd did not take yet is
+// confirmed, so that the DEL releases the IP like any other, and a lease whose claim could not be confirmed is
+// released, as no pod will ever get it.
+func (c *IPAMContext) cancelIPLeases(containerID string) {
+	c.ipLeaseLock.Lock()
+	defer c.ipLeaseLock.Unlock()
+	if c.ipLeases != nil {
+		claimed, err := c.ipLeases.TakeClaims()
+		if err != nil {
+			log.Warnf("Failed to read the claimed IP leases: %v", err)
+		}
+		c.confirmClaimsUnsafe(claimed)
+	}
+	for ip, claimedBy := range c.ipLeaseClaims {
+		if claimedBy == containerID {
+			log.Infof("Releasing leased IP %s, its claim by sandbox %s was not confirmed", ip, containerID)
+			c.releaseIPLeaseUnsafe(ip)
+		}
+	}
+}
+
+func (c *IPAMContext) confirmClaimsUnsafe(claimed []iplease.ClaimedLease) {
+	for _, lease := range claimed {
+		if lease.ContainerID == "" || lease.IfName == "" || lease.NetworkName == "" {
+			// The IP stays assigned to the lease, until the DEL of the container or the next ipamd releases it
+			log.Warnf("Ignoring invalid claim of leased IP %s: %+v", lease.IPv4Addr, lease.Claim)
+			c.ipLeaseClaims[lease.IPv4Addr] = lease.ContainerID
+			continue
+		}
+		from := c.ipLeaseKeys[lease.IPv4Addr]
+		to := datastore.IPAMKey{
+			ContainerID: lease.ContainerID,
+			IfName:      lease.IfName,
+			NetworkName: lease.NetworkName,
+		}
+		ipamMetadata := datastore.IPAMMetadata{
+			K8SPodNamespace: lease.PodNamespace,
+			K8SPodName:      lease.PodName,
+			K8SPodUID:       lease.PodUID,
+		}
+		if _, err := c.dataStore.ReassignPodIPv4Address(lease.IPv4Addr, from, to, ipamMetadata); err != nil {
+			log.Errorf("Failed to confirm leased IP %s for sandbox %s: %v", lease.IPv4Addr, to, err)
+			c.ipLeaseClaims[lease.IPv4Addr] = lease.ContainerID
+			continue
+		}
+		delete(c.ipLeaseKeys, lease.IPv4Addr)
+		atomic.AddInt64(&c.cniAddSucceeded, 1)
+		log.Infof("Confirmed leased IP %s for pod %s/%s, sandbox %s", lease.IPv4Addr, lease.PodNamespace, lease.PodName, to)
+
+		if c.enablePodIPAnnotation {
+			if err := c.AnnotatePod(lease.PodName, lease.PodNamespace, vpccniPodIPKey, lease.IPv4Addr, ""); err != nil {
+				log.Errorf("Failed to add the pod annotation: %v", err)
+			}
+		}
+	}
+}
+
+// offerIPLeases assigns IPs to leases, until IP_LEASE_TARGET leases are offered or the datastore runs out of IPs
+func (c *IPAMContext) offerIPLeases() {
+	c.ipLeaseLock.Lock()
+	defer c.ipLeaseLock.Unlock()
+	if c.ipLeases == nil || c.isTerminating() {
+		return
+	}
+	// The plugin claims leases without going through the ipWaitQueue, so the free IPs go to the waiting ADDs, in
+	// their priority and namespace order, before new leases are offered
+	if c.ipWaitQueue.len() > 0 {
+		return
+	}
+	offered, err := c.ipLeases.Offered()
+	if err != nil {
+		log.Warnf("Failed to read the offered IP leases: %v", err)
+		return
+	}
+
+	var leases []iplease.Lease
+	for i := offered; i < c.ipLeaseTarget; i++ {
+		c.ipLeaseSeq++
+		key := datastore.IPAMKey{
+			ContainerID: fmt.Sprintf("lease-%d", c.ipLeaseSeq),
+			IfName:      ipLeaseIfName,
+			NetworkName: ipLeaseNetworkName,
+		}
+		ip, deviceNumber, err := c.dataStore.AssignPodIPv4Address(key, datastore.IPAMMetadata{})
+		if err != nil {
+			// The pool manager allocates more IPs, the remaining leases are offered once they are available
+			log.Debugf("Offering %d IP leases out of %d: %v", len(leases), c.ipLeaseTarget-offered, err)
+			break
+		}
+		c.ipLeaseKeys[ip] = key
+		leases = append(leases, iplease.Lease{IPv4Addr: ip, DeviceNumber: deviceNumber})
+	}
+	if len(leases) == 0 {
+		return
+	}
+
+	n, err := c.ipLeases.Offer(leases)
+	if err != nil {
+		log.Warnf("Failed to offer IP leases: %v", err)
+	}
+	for _, lease := range leases[n:] {
+		c.releaseIPLeaseUnsafe(lease.IPv4Addr)
+	}
+}
+
+// retireIPLeases stops the plugin from claiming leases, confirms those already claimed and releases the others, so
+// that the next ipamd starts from pods the kubelet knows about
+func (c *IPAMContext) retireIPLeases() {
+	c.ipLeaseLock.Lock()
+	defer c.ipLeaseLock.Unlock()
+	if c.ipLeases == nil {
+		return
+	}
+	claimed, revoked, err := c.ipLeases.Retire()
+	if err != nil {
+		log.Warnf("Failed to retire the IP lease file: %v", err)
+		return
+	}
+	c.confirmClaimsUnsafe(claimed)
+	for _, lease := range revoked {
+		c.releaseIPLeaseUnsafe(lease.IPv4Addr)
+	}
+	c.ipLeases.Close()
+	c.ipLeases = nil
+}
+
+func (c *IPAMContext) releaseIPLeaseUnsafe(ip string) {
+	key, found := c.ipLeaseKeys[ip]
+	if !found {
+		return
+	}
+	delete(c.ipLeaseKeys, ip)
+	delete(c.ipLeaseClaims, ip)
+	if _, _, _, err := c.dataStore.UnassignPodIPAddress(key, ""); err != nil {
+		log.Warnf("Failed to release leased IP %s: %v", ip, err)
+	}
+}
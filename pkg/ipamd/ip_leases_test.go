@@ -0,0 +1,135 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iplease"
+)
+
+func TestIPLeases(t *testing.T) {
+	ipLeasePath = filepath.Join(t.TempDir(), "ip-leases")
+	defer func() { ipLeasePath = iplease.DefaultPath }()
+
+	c := &IPAMContext{
+		dataStore:     testDatastore(),
+		ipLeaseTarget: 2,
+	}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+	for _, ip := range []string{ipaddr01, ipaddr02, ipaddr03} {
+		c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	require.NoError(t, c.setupIPLeases())
+	c.offerIPLeases()
+	assert.Equal(t, 2, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+
+	plugin, err := iplease.Open(ipLeasePath)
+	require.NoError(t, err)
+	defer plugin.Close()
+	lease, err := plugin.Claim(iplease.Claim{ContainerID: "container1", IfName: "eth0", NetworkName: "aws-cni", PodName: "pod1", PodNamespace: "default"})
+	require.NoError(t, err)
+
+	// The claimed IP is assigned to the pod, and a new lease takes its place
+	c.confirmIPLeases()
+	pod := datastore.IPAMKey{ContainerID: "container1", IfName: "eth0", NetworkName: "aws-cni"}
+	found := false
+	for _, allocation := range c.dataStore.AllocatedIPs() {
+		if allocation.IPAMKey == pod {
+			assert.Equal(t, lease.IPv4Addr, allocation.IP)
+			found = true
+		}
+	}
+	assert.True(t, found)
+	c.offerIPLeases()
+	assert.Equal(t, 3, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+
+	// The next ipamd releases the leases that were not claimed, and keeps the pod
+	c.ipLeases.Close()
+	next := &IPAMContext{dataStore: c.dataStore}
+	require.NoError(t, next.setupIPLeases())
+	assert.Equal(t, 1, next.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+	assert.NoFileExists(t, ipLeasePath)
+	_, err = plugin.Claim(iplease.Claim{ContainerID: "container2", IfName: "eth0", NetworkName: "aws-cni"})
+	assert.ErrorIs(t, err, iplease.ErrNoLease)
+}
+
+func TestCancelIPLeases(t *testing.T) {
+	ipLeasePath = filepath.Join(t.TempDir(), "ip-leases")
+	defer func() { ipLeasePath = iplease.DefaultPath }()
+
+	c := &IPAMContext{
+		dataStore:     testDatastore(),
+		ipLeaseTarget: 2,
+	}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+	for _, ip := range []string{ipaddr01, ipaddr02} {
+		c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	require.NoError(t, c.setupIPLeases())
+	defer c.ipLeases.Close()
+	c.offerIPLeases()
+
+	plugin, err := iplease.Open(ipLeasePath)
+	require.NoError(t, err)
+	defer plugin.Close()
+
+	// A DEL before the confirmation takes the claim, the IP is then released by the DEL
+	_, err = plugin.Claim(iplease.Claim{ContainerID: "container1", IfName: "eth0", NetworkName: "aws-cni"})
+	require.NoError(t, err)
+	c.cancelIPLeases("container1")
+	pod := datastore.IPAMKey{ContainerID: "container1", IfName: "eth0", NetworkName: "aws-cni"}
+	_, _, _, err = c.dataStore.UnassignPodIPAddress(pod, "")
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+
+	// A claim that cannot be confirmed keeps the IP until the DEL of the container
+	_, err = plugin.Claim(iplease.Claim{ContainerID: "container2", IfName: "eth0"})
+	require.NoError(t, err)
+	c.confirmIPLeases()
+	assert.Equal(t, 1, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+	c.cancelIPLeases("container3")
+	assert.Equal(t, 1, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+	c.cancelIPLeases("container2")
+	assert.Equal(t, 0, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+	assert.Empty(t, c.ipLeaseKeys)
+}
+
+func TestOfferIPLeasesWithWaitingADDs(t *testing.T) {
+	ipLeasePath = filepath.Join(t.TempDir(), "ip-leases")
+	defer func() { ipLeasePath = iplease.DefaultPath }()
+
+	c := &IPAMContext{
+		dataStore:     testDatastore(),
+		ipLeaseTarget: 1,
+	}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+	c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr01), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	require.NoError(t, c.setupIPLeases())
+	defer c.ipLeases.Close()
+
+	waiter := c.ipWaitQueue.add("default", allocationClassHigh)
+	c.offerIPLeases()
+	assert.Equal(t, 0, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+
+	c.ipWaitQueue.remove(waiter)
+	c.offerIPLeases()
+	assert.Equal(t, 1, c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs)
+}
@@ -0,0 +1,107 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"sync"
+)
+
+// ipWaiter is an ADD waiting in the ipWaitQueue
+type ipWaiter struct {
+	namespace string
+	class     string
+}
+
+// ipWaitQueue orders the ADDs waiting for an IP. The high priority ADDs come first, then the ADDs take turns by
+// namespace, so that a burst of pods in one namespace does not hold back the pods of the others. Within a namespace,
+// and between namespaces at the same turn, the ADDs come in arrival order.
+type ipWaitQueue struct {
+	lock    sync.Mutex
+	waiters []*ipWaiter // waiters are in arrival order
+}
+
+// add queues an ADD of a pod in the namespace
+func (q *ipWaitQueue) add(namespace, class string) *ipWaiter {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	w := &ipWaiter{namespace: namespace, class: class}
+	q.waiters = append(q.waiters, w)
+	return w
+}
+
+// remove takes an ADD out of the queue, once it got an IP or gave up
+func (q *ipWaitQueue) remove(w *ipWaiter) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	for i, waiter := range q.waiters {
+		if waiter == w {
+			q.waiters = append(q.waiters[:i], q.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// len returns the number of waiting ADDs
+func (q *ipWaitQueue) len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return len(q.waiters)
+}
+
+// count returns the number of waiting ADDs of the class
+func (q *ipWaitQueue) count(class string) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	n := 0
+	for _, w := range q.waiters {
+		if w.class == class {
+			n++
+		}
+	}
+	return n
+}
+
+// position returns the number of ADDs that get an IP before the given one
+func (q *ipWaitQueue) position(w *ipWaiter) int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	// The turn of an ADD is the number of ADDs of the same class and namespace that arrived before it
+	turns := make([]int, len(q.waiters))
+	queued := make(map[ipWaiter]int)
+	index := -1
+	for i, waiter := range q.waiters {
+		turns[i] = queued[*waiter]
+		queued[*waiter]++
+		if waiter == w {
+			index = i
+		}
+	}
+	if index < 0 {
+		return len(q.waiters)
+	}
+	position := 0
+	for i, waiter := range q.waiters {
+		if i == index {
+			continue
+		}
+		if waiter.class == w.class {
+			if turns[i] < turns[index] || turns[i] == turns[index] && i < index {
+				position++
+			}
+		} else if waiter.class == allocationClassHigh {
+			position++
+		}
+	}
+	return position
+}
@@ -0,0 +1,94 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestIPWaitQueuePosition(t *testing.T) {
+	var q ipWaitQueue
+	batch1 := q.add("batch", allocationClassNormal)
+	batch2 := q.add("batch", allocationClassNormal)
+	batch3 := q.add("batch", allocationClassNormal)
+	web1 := q.add("web", allocationClassNormal)
+	dns := q.add("kube-system", allocationClassHigh)
+	web2 := q.add("web", allocationClassNormal)
+
+	// The high priority ADD first, then the namespaces take turns
+	assert.Equal(t, 0, q.position(dns))
+	assert.Equal(t, 1, q.position(batch1))
+	assert.Equal(t, 2, q.position(web1))
+	assert.Equal(t, 3, q.position(batch2))
+	assert.Equal(t, 4, q.position(web2))
+	assert.Equal(t, 5, q.position(batch3))
+	assert.Equal(t, 6, q.len())
+	assert.Equal(t, 1, q.count(allocationClassHigh))
+
+	q.remove(dns)
+	q.remove(batch1)
+	assert.Equal(t, 0, q.position(batch2))
+	assert.Equal(t, 1, q.position(web1))
+	// Removed ADDs are behind all the others
+	assert.Equal(t, 4, q.position(batch1))
+}
+
+func TestAssignPodIPKeepsIPsForWaiters(t *testing.T) {
+	c := &IPAMContext{dataStore: testDatastore(), enableIPv4: true}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+	c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr01), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+
+	// A normal ADD that does not wait leaves the free IP to the waiting ADD
+	waiter := c.ipWaitQueue.add("kube-system", allocationClassHigh)
+	_, _, _, err := c.assignPodIP(context.Background(), datastore.IPAMKey{ContainerID: "container1"},
+		datastore.IPAMMetadata{K8SPodNamespace: "default"}, allocationClassNormal)
+	assert.ErrorIs(t, err, datastore.ErrNoAvailableIPs)
+
+	c.ipWaitQueue.remove(waiter)
+	ipv4Addr, _, _, err := c.assignPodIP(context.Background(), datastore.IPAMKey{ContainerID: "container1"},
+		datastore.IPAMMetadata{K8SPodNamespace: "default"}, allocationClassNormal)
+	assert.NoError(t, err)
+	assert.Equal(t, ipaddr01, ipv4Addr)
+}
+
+func TestAssignPodIPWaitTimeout(t *testing.T) {
+	c := &IPAMContext{
+		dataStore:      testDatastore(),
+		enableIPv4:     true,
+		ipWaitTimeout:  300 * time.Millisecond,
+		onDemandWakeup: make(chan struct{}, 1),
+	}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+
+	_, _, _, err := c.assignPodIP(context.Background(), datastore.IPAMKey{ContainerID: "container1"},
+		datastore.IPAMMetadata{K8SPodNamespace: "default"}, allocationClassNormal)
+	assert.ErrorIs(t, err, errIPWaitTimeout)
+	assert.ErrorIs(t, err, datastore.ErrNoAvailableIPs)
+	assert.Equal(t, 0, c.ipWaitQueue.len())
+}
+
+func TestGetIPWaitTimeout(t *testing.T) {
+	assert.Equal(t, time.Duration(0), getIPWaitTimeout())
+	t.Setenv(envIPWaitTimeout, "30")
+	assert.Equal(t, 30*time.Second, getIPWaitTimeout())
+	t.Setenv(envIPWaitTimeout, "-1")
+	assert.Equal(t, time.Duration(0), getIPWaitTimeout())
+}
@@ -18,8 +18,8 @@ import (
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
 	"strconv"
-	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -27,21 +27,25 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/client"
 
 	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/samber/lo"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/types"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/util/retry"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/eniconfig"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/faultinject"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/featuregate"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iplease"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/k8sapi"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkhelper"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
 	"github.com/aws/amazon-vpc-cni-k8s/utils"
@@ -104,6 +108,49 @@ const (
 	envWarmENITarget     = "WARM_ENI_TARGET"
 	defaultWarmENITarget = 1
 
+	// This environment variable specifies whether ipamd computes the warm IP target and the minimum IP target from the
+	// limits of the instance type and the number of pods on the node, when none of the warm targets is set (default false).
+	envAdaptiveWarmTargets = "ENABLE_ADAPTIVE_WARM_TARGETS"
+
+	// This environment variable specifies whether ipamd allocates IPs only for the pods waiting for one, batching the
+	// pods that arrive together into one EC2 call (default false). It requires WARM_ENI_TARGET=0 without WARM_IP_TARGET,
+	// MINIMUM_IP_TARGET or prefix delegation.
+	envOnDemandAllocation = "ENABLE_ON_DEMAND_IP_ALLOCATION"
+
+	// This environment variable specifies whether the pods of the high allocation class, the critical system pods and the
+	// pods annotated as such, get the free IPs ahead of the other pods and wait for one when there is none (default false).
+	envPriorityAllocation = "ENABLE_PRIORITY_IP_ALLOCATION"
+
+	// This environment variable specifies whether ipamd exports the contents of the datastore as metrics, the IPs of
+	// each ENI and subnet and the use of the prefixes (default false).
+	envDatastoreMetrics = "ENABLE_DATASTORE_METRICS"
+
+	// This environment variable specifies how many seconds the ADDs that find no free IP wait for ipamd to allocate one,
+	// before failing with an error the kubelet retries (default 0, only the ADDs of on-demand and priority allocation
+	// wait, for 10 seconds).
+	envIPWaitTimeout = "IP_WAIT_TIMEOUT_SECONDS"
+
+	// This environment variable specifies the number of IPs ipamd leases to the CNI plugin ahead of time, through a file
+	// the plugin claims them from without calling ipamd (default 0, disabled).
+	envIPLeaseTarget = "IP_LEASE_TARGET"
+
+	// This environment variable specifies the number of IPv6 prefixes ipamd assigns to the primary ENI in IPv6 mode, for
+	// the nodes that need more pod addresses than a single /80 prefix gives them (default 1).
+	envIPv6PrefixCount     = "IPV6_PREFIX_COUNT"
+	defaultIPv6PrefixCount = 1
+
+	// This environment variable specifies whether ipamd moves warm IPs from the ENIs with few pods to the ENIs with many
+	// pods that have room for them, so that lightly used ENIs drain (default false). It has no effect with prefix delegation.
+	envWarmIPRebalancing = "ENABLE_WARM_IP_REBALANCING"
+
+	// This environment variable specifies whether ipamd reconciles the ENIs and IPs less often while they do not change,
+	// and more often after errors or changes, with jitter across nodes (default false).
+	envAdaptiveReconcile = "ENABLE_ADAPTIVE_RECONCILE_INTERVAL"
+
+	// This environment variable specifies whether ipamd advertises the number of pod IPs the node can still assign as
+	// the vpc.amazonaws.com/pod-ip extended resource of the node (default false).
+	envPodIPResource = "ENABLE_POD_IP_RESOURCE"
+
 	// This environment variable is used to specify the maximum number of ENIs that will be allocated.
 	// When it is not set or less than 1, the default is to use the maximum available for the instance type.
 	//
@@ -118,6 +165,10 @@ const (
 	// This environment variable specifies whether IPAMD should allocate or deallocate ENIs on a non-schedulable node (default false).
 	envManageENIsNonSchedulable = "AWS_MANAGE_ENIS_NON_SCHEDULABLE"
 
+	// This environment variable specifies whether IPAMD should release warm IPs and detach empty ENIs as soon as the node
+	// is tainted for scale-down (default false).
+	envPreDetachOnCordon = "ENABLE_PRE_DETACH_ON_CORDON"
+
 	// This environment is used to specify whether we should use enhanced subnet selection or not when creating ENIs (default true).
 	envSubnetDiscovery = "ENABLE_SUBNET_DISCOVERY"
 
@@ -135,6 +186,36 @@ const (
 	envBackingStorePath     = "AWS_VPC_K8S_CNI_BACKING_STORE"
 	defaultBackingStorePath = "/var/run/aws-node/ipam.json"
 
+	// eniInventoryFileName is written next to the checkpoint file with the ENIs of the node and all their IPs and prefixes
+	eniInventoryFileName = "ipam-enis.json"
+
+	// envEnableIPAuditLog enables an append-only JSON lines log of every pod IP assign and unassign (default false).
+	envEnableIPAuditLog = "ENABLE_IP_AUDIT_LOG"
+
+	// Specify where the IP audit log is written. It is rotated at 100 MB and the last 10 files are kept.
+	envIPAuditLogPath     = "IP_AUDIT_LOG_FILE"
+	defaultIPAuditLogPath = "/host/var/log/aws-routed-eni/ipamd-audit.log"
+	ipAuditLogMaxSizeMB   = 100
+	ipAuditLogMaxBackups  = 10
+
+	// envDisableStartupConfigValidation is used to skip checking the configuration against EC2 with DryRun calls at startup.
+	envDisableStartupConfigValidation = "DISABLE_STARTUP_CONFIG_VALIDATION"
+
+	// envEnableStrictStartupConfigValidation is used to stop ipamd when the startup configuration checks fail, instead of
+	// only reporting the failures (default false).
+	envEnableStrictStartupConfigValidation = "ENABLE_STRICT_STARTUP_CONFIG_VALIDATION"
+
+	// envEnableNetworkHelper is used to program routes, rules and iptables through the privileged network helper
+	// container, so that ipamd can run without NET_ADMIN (default false).
+	envEnableNetworkHelper = "ENABLE_NETWORK_HELPER"
+
+	// envNetworkHelperSocket is the unix socket the network helper listens on.
+	envNetworkHelperSocket = "NETWORK_HELPER_SOCKET"
+
+	// envEnableConflistDriftRepair is used to restore the CNI conflist when it is modified outside of aws-node (default false).
+	// By default modifications are only reported, since chained plugins may rewrite the conflist on purpose.
+	envEnableConflistDriftRepair = "ENABLE_CONFLIST_DRIFT_REPAIR"
+
 	// envEnablePodENI is used to attach a Trunk ENI to every node. Required in order to give Branch ENIs to pods.
 	envEnablePodENI = "ENABLE_POD_ENI"
 
@@ -154,6 +235,10 @@ const (
 	//envEnableIPv6 - Env variable to enable/disable IPv6 mode
 	envEnableIPv6 = "ENABLE_IPv6"
 
+	// envEnableV4EgressNAT64 makes the pods of an IPv6 cluster reach IPv4 endpoints through NAT64 and DNS64 instead of
+	// SNAT to the node IPv4 address
+	envEnableV4EgressNAT64 = "ENABLE_V4_EGRESS_NAT64"
+
 	ipV4AddrFamily = "4"
 	ipV6AddrFamily = "6"
 
@@ -176,16 +261,12 @@ const (
 	// The empty string one helps close a trace at pod shutdown where it looks like the pod still has its IP when the IP has been released
 	envAnnotatePodIP = "ANNOTATE_POD_IP"
 
-	// aws error codes for insufficient IP address scenario
-	INSUFFICIENT_CIDR_BLOCKS    = "InsufficientCidrBlocks"
-	INSUFFICIENT_FREE_IP_SUBNET = "InsufficientFreeAddressesInSubnet"
-
 	// envEnableNetworkPolicy is used to enable IPAMD/CNI to send pod create events to network policy agent.
 	envNetworkPolicyMode     = "NETWORK_POLICY_ENFORCING_MODE"
 	defaultNetworkPolicyMode = "standard"
 )
 
-var log = logger.Get()
+var log = logger.GetComponent("ipamd")
 
 var (
 	prometheusRegistered = false
@@ -200,6 +281,7 @@ type IPAMContext struct {
 	enableIPv6                bool
 	useCustomNetworking       bool
 	manageENIsNonScheduleable bool
+	preDetachOnCordon         bool
 	useSubnetDiscovery        bool
 	networkClient             networkutils.NetworkAPIs
 	maxIPsPerENI              int
@@ -207,18 +289,28 @@ type IPAMContext struct {
 	maxPrefixesPerENI         int
 	unmanagedENI              int
 	numNetworkCards           int
+	efaOnlyENIs               map[string]bool // efaOnlyENIs is the set of EFA-only ENIs, which occupy an ENI slot but carry no IPs
 
 	warmENITarget        int
 	warmIPTarget         int
 	minimumIPTarget      int
 	warmPrefixTarget     int
+	adaptiveWarmTargets  bool
+	podDensity           podDensity
 	primaryIP            map[string]string // primaryIP is a map from ENI ID to primary IP of that ENI
 	lastNodeIPPoolAction time.Time
 	lastDecreaseIPPool   time.Time
 	// reconcileCooldownCache keeps timestamps of the last time an IP address was unassigned from an ENI,
 	// so that we don't reconcile and add it back too quickly if IMDS lags behind reality.
-	reconcileCooldownCache    ReconcileCooldownCache
-	terminating               int32 // Flag to warn that the pod is about to shut down.
+	reconcileCooldownCache ReconcileCooldownCache
+	terminating            int32 // Flag to warn that the pod is about to shut down.
+	degradation            int32 // degradationLevel set by MonitorResourceBudget
+	// ipPoolLock is held while the pool manager changes ENIs and IPs, so that shutdown can wait for in-flight EC2 calls
+	ipPoolLock                sync.Mutex
+	eniNetworks               map[string]eniNetwork // eniNetworks are the networks of the ENIs with a route table of their own, that MonitorENINetworks repairs
+	eniNetworksLock           sync.Mutex
+	eniSubnetCIDRs            map[string]string // eniSubnetCIDRs are the subnets of the ENIs, the label of the datastore metrics
+	eniSubnetCIDRsLock        sync.Mutex
 	disableENIProvisioning    bool
 	enablePodENI              bool
 	myNodeName                string
@@ -228,38 +320,102 @@ type IPAMContext struct {
 	enablePodIPAnnotation     bool
 	maxPods                   int // maximum number of pods that can be scheduled on the node
 	networkPolicyMode         string
+	cniAddSucceeded           int64 // cniAddSucceeded counts AddNetwork requests that were assigned an IP
+	cniAddFailed              int64 // cniAddFailed counts ADDs that the plugin failed to set up after assigning an IP
+	// cniAddSucceededCurrent and cniAddFailedCurrent only count the ADDs of the plugin of the same version as ipamd,
+	// and not those of the previous plugin that ipamd keeps accepting during a canary rollout
+	cniAddSucceededCurrent int64
+	cniAddFailedCurrent    int64
+
+	onDemandAllocation bool
+	onDemandRequests   int32         // onDemandRequests counts the ADDs waiting for the pool manager to allocate an IP
+	onDemandWakeup     chan struct{} // onDemandWakeup cuts short the sleep of the pool manager when ADDs wait for IPs
+	priorityAllocation bool
+	featureGate        *featuregate.FeatureGate
+	ipWaitQueue        ipWaitQueue   // ipWaitQueue orders the ADDs waiting for an IP
+	ipWaitTimeout      time.Duration // ipWaitTimeout is how long any ADD waits for an IP, 0 when only some of them wait
+	// onDemandBackoff grows after failed on-demand allocations, none is attempted before nextOnDemandAllocation
+	onDemandBackoff        time.Duration
+	nextOnDemandAllocation time.Time
+	// lastAllocationError holds the allocationError of the last pool allocation, that the ADDs timing out report
+	lastAllocationError atomic.Value
+
+	warmIPRebalancing   bool
+	lastWarmIPRebalance time.Time
+
+	adaptiveReconcile     bool
+	reconcileBackoff      time.Duration // reconcileBackoff is the reconcile interval before jitter
+	nextReconcileInterval time.Duration
+
+	ipv6PrefixCount int
+
+	enablePodIPResource bool
+
+	ipLeaseTarget int
+	ipLeases      *iplease.File
+	ipLeaseKeys   map[string]datastore.IPAMKey // ipLeaseKeys maps the offered IPs to the sandbox they are assigned to
+	ipLeaseClaims map[string]string            // ipLeaseClaims maps the leased IPs whose claim was not confirmed to the container that claimed them
+	ipLeaseSeq    int
+	ipLeaseLock   sync.Mutex
+
+	// iamPermissions is the result of the last check of the EC2 permissions the configuration needs
+	iamPermissions     []awsutils.EC2Permission
+	iamPermissionsLock sync.RWMutex
+
+	enablePodCarrierIP bool
+	carrierIPs         map[string]string // carrierIPs maps the pod IPs to the carrier IP associated with them
+	carrierIPLock      sync.Mutex
+
+	v4EgressSNATSource string
+	egressSNATIP       string // egressSNATIP is the IPv4 address egress is translated to, empty for the primary IP
+
+	ipamPoolID string // ipamPoolID is the IPAM pool the IPv4 addresses of the ENIs are allocated from, if any
+
+	startupReconcileMode string // startupReconcileMode is how much of the checkpoint is trusted on start
+
+	crashSnapshotDest *crashSnapshotDestination // crashSnapshotDest is where crash snapshots are written, nil if disabled
+
+	// routedExcludeSNATCIDRs are the private destinations of the route table excluded from SNAT, learned at
+	// routedSNATExclusionsRefreshed
+	routedExcludeSNATCIDRs        []string
+	routedSNATExclusionsRefreshed time.Time
+
+	// featureConflicts are the unsupported combinations of settings ipamd degraded from
+	featureConflicts []FeatureConflict
+
+	maintenanceMode string // maintenanceMode is set by the maintenance annotation of the node, empty outside of maintenance
+	maintenanceLock sync.RWMutex
+
+	unmanagedENITags  map[string]string // unmanagedENITags are the tags that mark ENIs as unmanaged, set by UNMANAGED_ENI_TAGS
+	unmanagedENIs     map[string]string // unmanagedENIs are the reasons ipamd does not manage the ENIs, by ENI ID
+	unmanagedENIsLock sync.RWMutex
 }
 
-// setUnmanagedENIs will rebuild the set of ENI IDs for ENIs tagged as "no_manage"
-func (c *IPAMContext) setUnmanagedENIs(tagMap map[string]awsutils.TagMap) {
-	if len(tagMap) == 0 {
+// setUnmanagedENIs will rebuild the set of ENI IDs for ENIs tagged as "no_manage", or otherwise not managed by ipamd
+func (c *IPAMContext) setUnmanagedENIs(result awsutils.DescribeAllENIsResult) {
+	if len(result.TagMap) == 0 {
 		return
 	}
 	var unmanagedENIlist []string
-	// if "no_manage" tag is present and is true - ENI is unmanaged
-	// if "no_manage" tag is present and is "not true" - ENI is managed
-	// if "instance_id" tag is present and is set to instanceID - ENI is managed since this was created by IPAMD
-	// if "no_manage" tag is not present or not IPAMD created ENI, check if we are in Manage Untagged Mode, default is true.
-	// if enableManageUntaggedMode is false, then consider all untagged ENIs as unmanaged.
-	for eniID, tags := range tagMap {
-		if _, found := tags[eniNoManageTagKey]; found {
-			if tags[eniNoManageTagKey] != "true" {
-				continue
-			}
-		} else if _, found := tags[eniNodeTagKey]; found && tags[eniNodeTagKey] == c.awsClient.GetInstanceID() {
-			continue
-		} else if c.enableManageUntaggedMode {
+	unmanagedENIs := make(map[string]string)
+	for eniID, tags := range result.TagMap {
+		reason := c.unmanagedReason(eniID, tags, result)
+		if reason == "" {
 			continue
 		}
 
 		if eniID == c.awsClient.GetPrimaryENI() {
 			log.Debugf("Ignoring primary ENI %s since it is always managed", eniID)
 		} else {
-			log.Debugf("Marking ENI %s as being unmanaged", eniID)
+			log.Debugf("Marking ENI %s as being unmanaged: %s", eniID, reason)
 			unmanagedENIlist = append(unmanagedENIlist, eniID)
+			unmanagedENIs[eniID] = reason
 		}
 	}
 	c.awsClient.SetUnmanagedENIs(unmanagedENIlist)
+	c.unmanagedENIsLock.Lock()
+	c.unmanagedENIs = unmanagedENIs
+	c.unmanagedENIsLock.Unlock()
 }
 
 // ReconcileCooldownCache keep track of recently freed CIDRs to avoid reading stale EC2 metadata
@@ -305,22 +461,14 @@ func prometheusRegister() {
 
 // containsInsufficientCIDRsOrSubnetIPs returns whether a CIDR cannot be carved in the subnet or subnet is running out of IP addresses
 func containsInsufficientCIDRsOrSubnetIPs(err error) bool {
-	var awsErr awserr.Error
 	// IP exhaustion can be due to Insufficient Cidr blocks or Insufficient Free Address in a Subnet
 	// In these 2 cases we will back off for 2 minutes before retrying
-	if errors.As(err, &awsErr) {
-		log.Debugf("Insufficient IP Addresses due to: %v\n", awsErr.Code())
-		return awsErr.Code() == INSUFFICIENT_CIDR_BLOCKS || awsErr.Code() == INSUFFICIENT_FREE_IP_SUBNET
-	}
-	return false
+	return errors.Is(err, awsutils.ErrInsufficientSubnetIPs)
 }
 
 // containsPrivateIPAddressLimitExceededError returns whether exceeds ENI's IP address limit
 func containsPrivateIPAddressLimitExceededError(err error) bool {
-	if aerr, ok := err.(awserr.Error); ok {
-		return aerr.Code() == "PrivateIpAddressLimitExceeded"
-	}
-	return false
+	return errors.Is(err, awsutils.ErrIPLimitExceeded)
 }
 
 // inInsufficientCidrCoolingPeriod checks whether IPAMD is in insufficientCidrErrorCooldown
@@ -330,23 +478,77 @@ func (c *IPAMContext) inInsufficientCidrCoolingPeriod() bool {
 
 // New retrieves IP address usage information from Instance MetaData service and Kubelet
 // then initializes IP address pool data store
-func New(k8sClient client.Client) (*IPAMContext, error) {
+func New(k8sClient client.Client, version string) (*IPAMContext, error) {
 	prometheusRegister()
+	c, err := newIPAMContext(k8sClient, disableLeakedENICleanup())
+	if err != nil {
+		return nil, err
+	}
+	// Leave a snapshot of the state behind for post-mortem analysis when the initialization fails or ipamd crashes
+	c.myNodeName = os.Getenv(envNodeName)
+	c.HandleCrashes(version)
+	defer utilruntime.HandleCrash()
+	if err := c.initialize(); err != nil {
+		c.WriteCrashSnapshot(version, fmt.Sprintf("initialization failure: %v", err), nil)
+		return nil, err
+	}
+	return c, nil
+}
+
+// initialize sets up the datastore and the ENIs of the node
+func (c *IPAMContext) initialize() error {
+	if useDatastoreMetrics() {
+		prometheus.MustRegister(datastoreCollector{c})
+	}
+
+	// Report when EC2 rejects the configured subnet, security groups or permissions, before pods are allocated IPs
+	if !utils.GetBoolAsStringEnvVar(envDisableStartupConfigValidation, false) {
+		if err := c.validateStartupConfig(context.Background()); err != nil {
+			return err
+		}
+	}
+
+	if utils.GetBoolAsStringEnvVar(envEnableNetworkHelper, false) {
+		socketPath := utils.GetEnv(envNetworkHelperSocket, networkhelper.DefaultSocketPath)
+		networkClient, err := networkhelper.NewClient(socketPath)
+		if err != nil {
+			return err
+		}
+		c.networkClient = networkClient
+		log.Infof("Using the network helper on %s for host network configuration", socketPath)
+	}
+	c.loadFeatureGates()
+
+	c.awsClient.InitCachedPrefixDelegation(c.enablePrefixDelegation)
+	checkpointer := faultinject.Default().Checkpointer(datastore.NewJSONFile(dsBackingStorePath()))
+	c.dataStore = datastore.NewDataStore(log, checkpointer, c.enablePrefixDelegation)
+	c.dataStore.SetENIInventory(datastore.NewJSONFile(eniInventoryPath()))
+	if utils.GetBoolAsStringEnvVar(envEnableIPAuditLog, false) {
+		c.dataStore.SetAuditLogger(datastore.NewJSONAuditLog(ipAuditLogPath(), ipAuditLogMaxSizeMB, ipAuditLogMaxBackups))
+	}
+
+	return c.nodeInit()
+}
+
+// newIPAMContext loads the configuration from the environment and EC2, and validates the combination of settings
+func newIPAMContext(k8sClient client.Client, disableLeakedENICleanup bool) (*IPAMContext, error) {
 	c := &IPAMContext{}
 	c.k8sClient = k8sClient
 	c.networkClient = networkutils.New()
 	c.useCustomNetworking = UseCustomNetworkCfg()
 	c.manageENIsNonScheduleable = ManageENIsOnNonSchedulableNode()
+	c.preDetachOnCordon = preDetachOnCordon()
 	c.useSubnetDiscovery = UseSubnetDiscovery()
 	c.enablePrefixDelegation = usePrefixDelegation()
 	c.enableIPv4 = isIPv4Enabled()
 	c.enableIPv6 = isIPv6Enabled()
 	c.disableENIProvisioning = disableENIProvisioning()
-	client, err := awsutils.New(c.useSubnetDiscovery, c.useCustomNetworking, disableLeakedENICleanup(), c.enableIPv4, c.enableIPv6)
+	client, err := awsutils.New(c.useSubnetDiscovery, c.useCustomNetworking, disableLeakedENICleanup, c.enableIPv4, c.enableIPv6)
 	if err != nil {
 		return nil, errors.Wrap(err, "ipamd: can not initialize with AWS SDK interface")
 	}
 	c.awsClient = client
+	c.ipamPoolID = client.IPAMPoolID()
 
 	c.primaryIP = make(map[string]string)
 	c.reconcileCooldownCache.cache = make(map[string]time.Time)
@@ -355,9 +557,26 @@ func New(k8sClient client.Client) (*IPAMContext, error) {
 	c.warmIPTarget = getWarmIPTarget()
 	c.minimumIPTarget = getMinimumIPTarget()
 	c.warmPrefixTarget = getWarmPrefixTarget()
+	overridden := c.applyWarmPoolOverrides(context.TODO(), os.Getenv(envNodeName))
+	// Adaptive warm targets only replace the defaults, and PD allocates whole prefixes anyway
+	c.adaptiveWarmTargets = useAdaptiveWarmTargets() && !overridden && !warmTargetsConfigured() && !c.enablePrefixDelegation
+	c.onDemandAllocation = useOnDemandAllocation()
+	c.onDemandWakeup = make(chan struct{}, 1)
+	c.priorityAllocation = usePriorityAllocation()
+	c.ipWaitTimeout = getIPWaitTimeout()
+	c.warmIPRebalancing = useWarmIPRebalancing()
+	c.adaptiveReconcile = useAdaptiveReconcile()
+	c.setReconcileBackoff(nodeIPPoolReconcileInterval)
+	c.ipLeaseTarget = getIPLeaseTarget()
+	c.ipv6PrefixCount = getIPv6PrefixCount()
+	c.enablePodIPResource = usePodIPResource()
 	c.enablePodENI = enablePodENI()
 	c.enableManageUntaggedMode = enableManageUntaggedMode()
+	c.unmanagedENITags = loadUnmanagedENITags()
 	c.enablePodIPAnnotation = enablePodIPAnnotation()
+	// The setting applies to the whole daemonset, only the nodes in a Wavelength Zone have carrier IPs
+	c.enablePodCarrierIP = enablePodCarrierIP() && c.awsClient.InWavelengthZone()
+	c.carrierIPs = make(map[string]string)
 	c.numNetworkCards = len(c.awsClient.GetNetworkCards())
 
 	c.networkPolicyMode, err = getNetworkPolicyMode()
@@ -375,15 +594,6 @@ func New(k8sClient client.Client) (*IPAMContext, error) {
 	if !c.isConfigValid() {
 		return nil, fmt.Errorf("ipamd: failed to validate configuration")
 	}
-
-	c.awsClient.InitCachedPrefixDelegation(c.enablePrefixDelegation)
-	c.myNodeName = os.Getenv(envNodeName)
-	checkpointer := datastore.NewJSONFile(dsBackingStorePath())
-	c.dataStore = datastore.NewDataStore(log, checkpointer, c.enablePrefixDelegation)
-
-	if err := c.nodeInit(); err != nil {
-		return nil, err
-	}
 	return c, nil
 }
 
@@ -407,6 +617,7 @@ func (c *IPAMContext) nodeInit() error {
 		if err != nil {
 			return err
 		}
+		c.refreshRoutedSNATExclusions(ctx)
 	}
 
 	primaryENIMac := c.awsClient.GetPrimaryENImac()
@@ -420,54 +631,27 @@ func (c *IPAMContext) nodeInit() error {
 		log.Debugf("Failed to clean up stale AWS chains: %v", err)
 	}
 
-	metadataResult, err := c.awsClient.DescribeAllENIs()
+	// Read the handoff marker before the checkpoint is rewritten on restore
+	handoff, err := c.setupENIsOnStart(c.consumeHandoffMarker())
 	if err != nil {
-		return errors.Wrap(err, "ipamd init: failed to retrieve attached ENIs info")
+		return err
 	}
-
-	log.Debugf("DescribeAllENIs success: ENIs: %d, tagged: %d", len(metadataResult.ENIMetadata), len(metadataResult.TagMap))
-	c.awsClient.SetMultiCardENIs(metadataResult.MultiCardENIIDs)
-	c.setUnmanagedENIs(metadataResult.TagMap)
-	enis := c.filterUnmanagedENIs(metadataResult.ENIMetadata)
-
-	for _, eni := range enis {
-		log.Debugf("Discovered ENI %s, trying to set it up", eni.ENIID)
-		isTrunkENI := eni.ENIID == metadataResult.TrunkENI
-		isEFAENI := metadataResult.EFAENIs[eni.ENIID]
-		if !isTrunkENI && !c.disableENIProvisioning {
-			if err := c.awsClient.TagENI(eni.ENIID, metadataResult.TagMap[eni.ENIID]); err != nil {
-				return errors.Wrapf(err, "ipamd init: failed to tag managed ENI %v", eni.ENIID)
-			}
+	if err := c.dataStore.ReadBackingStore(c.enableIPv6); err != nil {
+		switch {
+		case errors.Is(err, datastore.ErrMissingCheckpoint):
+			// A new or rebooted node has no pod with a veth, and rebuilds an empty state
+			log.Infof("Rebuilding the ipam state from the pods of the node: %v", err)
+		case errors.Is(err, datastore.ErrCorruptCheckpoint):
+			log.Errorf("Rebuilding the ipam state from the pods of the node: %v", err)
+			ipamdErrInc("corruptCheckpoint")
+		default:
+			return err
 		}
-
-		// Retry ENI sync
-		retry := 0
-		for {
-			retry++
-			if err = c.setupENI(eni.ENIID, eni, isTrunkENI, isEFAENI); err == nil {
-				log.Infof("ENI %s set up.", eni.ENIID)
-				break
-			}
-
-			if retry > maxRetryCheckENI {
-				log.Warnf("Reached max retry: Unable to discover attached IPs for ENI from metadata service (attempted %d/%d): %v", retry, maxRetryCheckENI, err)
-				ipamdErrInc("waitENIAttachedMaxRetryExceeded")
-				break
-			}
-
-			log.Warnf("Error trying to set up ENI %s: %v", eni.ENIID, err)
-			if strings.Contains(err.Error(), "setupENINetwork: failed to find the link which uses MAC address") {
-				// If we can't find the matching link for this MAC address, there is no point in retrying for this ENI.
-				log.Debug("Unable to match link for this ENI, going to the next one.")
-				break
-			}
-			log.Debugf("Unable to discover IPs for this ENI yet (attempt %d/%d)", retry, maxRetryCheckENI)
-			time.Sleep(eniAttachTime)
+		if err := c.recoverCheckpoint(ctx); err != nil {
+			return err
 		}
-	}
-
-	if err := c.dataStore.ReadBackingStore(c.enableIPv6); err != nil {
-		return err
+		// The rebuilt state is not the one the previous instance handed off
+		handoff = false
 	}
 
 	if c.enableIPv6 {
@@ -482,10 +666,14 @@ func (c *IPAMContext) nodeInit() error {
 		// networking in IPv6 mode yet, so we will skip the corresponding setup. This will save us from checking
 		// if IPv6 is enabled at multiple places. Once we start supporting these features in IPv6 mode, we can do away
 		// with this check and not change anything else in the below setup.
-		return nil
+		return c.setupEgressSNATIP(ctx)
 	}
 
-	if c.enablePrefixDelegation {
+	if handoff {
+		// The previous instance ran with the same prefix delegation mode, so there is nothing to clean up, and the
+		// checkpoint is recent enough to defer the first reconcile by one interval
+		c.lastNodeIPPoolAction = time.Now()
+	} else if c.enablePrefixDelegation {
 		// During upgrade or if prefix delgation knob is disabled to enabled then we
 		// might have secondary IPs attached to ENIs so doing a cleanup if not used before moving on
 		c.tryUnassignIPsFromENIs()
@@ -498,11 +686,21 @@ func (c *IPAMContext) nodeInit() error {
 	if err = c.configureIPRulesForPods(); err != nil {
 		return err
 	}
+	if c.enablePodCarrierIP {
+		c.restoreCarrierIPs(ctx)
+	}
+	if err = c.setupIPLeases(); err != nil {
+		return err
+	}
 	// Spawning updateCIDRsRulesOnChange go-routine
 	go wait.Forever(func() {
 		vpcV4CIDRs = c.updateCIDRsRulesOnChange(vpcV4CIDRs)
 	}, 30*time.Second)
 
+	if networkutils.HostToPodRulesEnabled() {
+		go wait.Forever(c.reconcileHostToPodRules, 30*time.Second)
+	}
+
 	// RefreshSGIDs populates the ENI cache with ENI -> security group ID mappings, and so it must be called:
 	// 1. after managed/unmanaged ENIs have been determined
 	// 2. before any new ENIs are attached
@@ -533,6 +731,9 @@ func (c *IPAMContext) nodeInit() error {
 		return errors.New("error while trying to determine max pods")
 	}
 	c.maxPods = int(maxPods)
+	if c.adaptiveWarmTargets {
+		c.updateAdaptiveWarmTargets()
+	}
 
 	if c.useCustomNetworking {
 		// When custom networking is enabled and a valid ENIConfig is found, IPAMD patches the CNINode
@@ -562,7 +763,7 @@ func (c *IPAMContext) nodeInit() error {
 
 	// On node init, check if datastore pool needs to be increased. If so, attach CIDRs from existing ENIs and attach new ENIs.
 	datastorePoolTooLow, _ := c.isDatastorePoolTooLow()
-	if !c.disableENIProvisioning && datastorePoolTooLow {
+	if !c.disableENIProvisioning && datastorePoolTooLow && c.updateMaintenanceMode(ctx) == "" {
 		if err := c.increaseDatastorePool(ctx); err != nil {
 			// Note that the only error currently returned by increaseDatastorePool is an error attaching CIDRs (other than insufficient IPs)
 			podENIErrInc("nodeInit")
@@ -618,9 +819,10 @@ func (c *IPAMContext) updateCIDRsRulesOnChange(oldVPCCIDRs []string) []string {
 		return oldVPCCIDRs
 	}
 
+	routedChanged := c.refreshRoutedSNATExclusions(context.TODO())
 	old := sets.NewString(oldVPCCIDRs...)
 	new := sets.NewString(newVPCCIDRs...)
-	if !old.Equal(new) {
+	if !old.Equal(new) || routedChanged {
 		primaryIP := c.awsClient.GetLocalIPv4()
 		err = c.networkClient.UpdateHostIptablesRules(newVPCCIDRs, c.awsClient.GetPrimaryENImac(), &primaryIP, c.enableIPv4,
 			c.enableIPv6)
@@ -631,6 +833,15 @@ func (c *IPAMContext) updateCIDRsRulesOnChange(oldVPCCIDRs []string) []string {
 	return newVPCCIDRs
 }
 
+// reconcileHostToPodRules restores the hairpin and reverse path filtering rules, in case they were removed since the
+// host network setup
+func (c *IPAMContext) reconcileHostToPodRules() {
+	primaryIP := c.awsClient.GetLocalIPv4()
+	if err := c.networkClient.ReconcileHostToPodRules(c.awsClient.GetPrimaryENImac(), &primaryIP); err != nil {
+		log.Warnf("unable to reconcile host-to-pod rules due to error: %v", err)
+	}
+}
+
 func (c *IPAMContext) updateIPStats(unmanaged int) {
 	prometheusmetrics.IpMax.Set(float64(c.maxIPsPerENI * (c.maxENI - unmanaged)))
 	prometheusmetrics.EnisMax.Set(float64(c.maxENI - unmanaged))
@@ -647,6 +858,10 @@ func (c *IPAMContext) StartNodeIPPoolManager() {
 		}
 		// Outside of Security Groups for Pods, no additional ENIs are attached in IPv6 mode.
 		// The prefix used for the primary ENI is more than enough for all pods.
+		for c.enablePodIPResource {
+			c.updatePodIPResource(context.Background())
+			time.Sleep(ipPoolMonitorInterval)
+		}
 		return
 	}
 
@@ -656,15 +871,51 @@ func (c *IPAMContext) StartNodeIPPoolManager() {
 	ctx := context.Background()
 	for {
 		if !c.disableENIProvisioning {
-			time.Sleep(sleepDuration)
+			c.waitForPoolUpdate(sleepDuration)
+			c.ipPoolLock.Lock()
 			c.updateIPPoolIfRequired(ctx)
+			c.ipPoolLock.Unlock()
+		}
+		if c.enablePodIPResource {
+			c.updatePodIPResource(ctx)
 		}
 		time.Sleep(sleepDuration)
-		c.nodeIPPoolReconcile(ctx, nodeIPPoolReconcileInterval)
+		if c.degradationLevel() >= degradationCritical {
+			log.Debug("Skipping the IP pool reconcile while ipamd is close to its resource limits")
+			continue
+		}
+		c.ipPoolLock.Lock()
+		c.nodeIPPoolReconcile(ctx, c.reconcileInterval())
+		c.ipPoolLock.Unlock()
+		if err := c.dataStore.WriteENIInventory(); err != nil {
+			log.Warnf("Failed to write the ENI inventory: %v", err)
+		}
 	}
 }
 
 func (c *IPAMContext) updateIPPoolIfRequired(ctx context.Context) {
+	// Once the node is going away, MonitorNodeTermination only releases ENIs and IPs
+	if c.dataStore.IsReadOnly() {
+		return
+	}
+	// Once the node is tainted for scale-down, only release ENIs and IPs, so that the instance terminates sooner
+	if c.preDetachOnCordon && c.isNodeScalingDown(ctx) {
+		c.drainNode()
+		return
+	}
+	// In maintenance mode, the pods keep their IPs and new pods only get the IPs already in the warm pool
+	switch c.updateMaintenanceMode(ctx) {
+	case maintenancePause:
+		return
+	case maintenanceDrain:
+		c.drainNode()
+		return
+	}
+
+	if c.adaptiveWarmTargets {
+		c.updateAdaptiveWarmTargets()
+	}
+
 	// When IPv4 Security Groups for Pods is configured, do not write to CNINode until there is room for a trunk ENI
 	if c.enablePodENI && c.enableIPv4 && c.dataStore.GetTrunkENI() == "" {
 		c.tryEnableSecurityGroupsForPods(ctx)
@@ -679,6 +930,7 @@ func (c *IPAMContext) updateIPPoolIfRequired(ctx context.Context) {
 	} else if c.isDatastorePoolTooHigh(stats) {
 		c.decreaseDatastorePool(decreaseIPPoolInterval)
 	}
+	c.tryRebalanceWarmIPs()
 	if c.shouldRemoveExtraENIs() {
 		c.tryFreeENI()
 	}
@@ -805,9 +1057,15 @@ func (c *IPAMContext) increaseDatastorePool(ctx context.Context) error {
 		log.Debugf("Recently we had InsufficientCidr error hence will wait for %v before retrying", insufficientCidrErrorCooldown)
 		return nil
 	}
+	if c.inOnDemandBackoff() {
+		log.Debugf("Recently failed to allocate IPs on demand, will not retry before %v", c.nextOnDemandAllocation)
+		return nil
+	}
 
 	increasedPool, err := c.tryAssignCidrs()
 	if err != nil {
+		c.recordAllocationError(err)
+		c.recordOnDemandAllocation(err)
 		if containsInsufficientCIDRsOrSubnetIPs(err) {
 			log.Errorf("Unable to attach IPs/Prefixes for the ENI, subnet doesn't seem to have enough IPs/Prefixes. Consider using new subnet or carve a reserved range using create-subnet-cidr-reservation")
 			c.lastInsufficientCidrError = time.Now()
@@ -817,11 +1075,16 @@ func (c *IPAMContext) increaseDatastorePool(ctx context.Context) error {
 		return err
 	}
 	if increasedPool {
+		c.recordAllocationError(nil)
+		c.recordOnDemandAllocation(nil)
 		c.updateLastNodeIPPoolAction()
 	} else {
 		// If we did not add any IPs, try to allocate an ENI.
 		if c.hasRoomForEni() {
-			if err = c.tryAllocateENI(ctx); err == nil {
+			err = c.tryAllocateENI(ctx)
+			c.recordAllocationError(err)
+			c.recordOnDemandAllocation(err)
+			if err == nil {
 				c.updateLastNodeIPPoolAction()
 			} else {
 				// Note that no error is returned if ENI allocation fails. This is because ENI allocation failure should not cause node to be "NotReady".
@@ -836,6 +1099,7 @@ func (c *IPAMContext) increaseDatastorePool(ctx context.Context) error {
 
 func (c *IPAMContext) updateLastNodeIPPoolAction() {
 	c.lastNodeIPPoolAction = time.Now()
+	c.resetReconcileBackoff()
 	stats := c.dataStore.GetIPStats(ipV4AddrFamily)
 	c.logPoolStats(stats)
 }
@@ -846,17 +1110,21 @@ func (c *IPAMContext) tryAllocateENI(ctx context.Context) error {
 
 	if c.useCustomNetworking {
 		eniCfg, err := eniconfig.MyENIConfig(ctx, c.k8sClient)
-		if err != nil {
+		switch {
+		case err == eniconfig.ErrNoENIConfig && c.useSubnetDiscovery:
+			// The ENI is created in a subnet tagged for the CNI in the zone and on the Outpost of the node
+			log.Infof("ipamd: no ENIConfig for this node, using a discovered subnet for custom networking")
+		case err != nil:
 			log.Errorf("Failed to get pod ENI config")
 			return err
+		default:
+			log.Infof("ipamd: using custom network config: %v, %s", eniCfg.SecurityGroups, eniCfg.Subnet)
+			for _, sgID := range eniCfg.SecurityGroups {
+				log.Debugf("Found security-group id: %s", sgID)
+				securityGroups = append(securityGroups, aws.String(sgID))
+			}
+			eniCfgSubnet = eniCfg.Subnet
 		}
-
-		log.Infof("ipamd: using custom network config: %v, %s", eniCfg.SecurityGroups, eniCfg.Subnet)
-		for _, sgID := range eniCfg.SecurityGroups {
-			log.Debugf("Found security-group id: %s", sgID)
-			securityGroups = append(securityGroups, aws.String(sgID))
-		}
-		eniCfgSubnet = eniCfg.Subnet
 	}
 
 	resourcesToAllocate := c.GetENIResourcesToAllocate()
@@ -967,7 +1235,7 @@ func (c *IPAMContext) assignIPv6Prefix(eniID string) (err error) {
 	log.Debugf("Assigning an IPv6Prefix for ENI: %s", eniID)
 	//Let's make an EC2 API call to get a list of IPv6 prefixes (if any) that are already attached to the
 	//current ENI. We will make this call only once during boot up/init and doing so will shield us from any
-	//IMDS out of sync issues. We only need one v6 prefix per ENI/Node.
+	//IMDS out of sync issues. We need IPV6_PREFIX_COUNT v6 prefixes per ENI/Node, one by default.
 	ec2v6Prefixes, err := c.awsClient.GetIPv6PrefixesFromEC2(eniID)
 	if err != nil {
 		log.Errorf("assignIPv6Prefix; err: %s", err)
@@ -975,28 +1243,24 @@ func (c *IPAMContext) assignIPv6Prefix(eniID string) (err error) {
 	}
 	log.Debugf("ENI %s has %v prefixe(s) attached", eniID, len(ec2v6Prefixes))
 
-	//Note: If we find more than one v6 prefix attached to the ENI, VPC CNI will not attempt to free it. VPC CNI
-	//will only attach a single v6 prefix and it will not attempt to free the additional Prefixes.
-	//We will add all the prefixes to our datastore. TODO - Should we instead pick one of them. If we do, how to track
-	//that across restarts?
-
-	//Check if we already have v6 Prefix(es) attached
-	if len(ec2v6Prefixes) == 0 {
-		//Allocate and attach a v6 Prefix to Primary ENI
-		log.Debugf("No IPv6 Prefix(es) found for ENI: %s", eniID)
-		strPrefixes, err := c.awsClient.AllocIPv6Prefixes(eniID)
+	prefixCount := max(c.ipv6PrefixCount, defaultIPv6PrefixCount)
+	//Check if we already have enough v6 Prefix(es) attached
+	if len(ec2v6Prefixes) < prefixCount {
+		//Allocate and attach the missing v6 Prefix(es) to Primary ENI
+		missing := prefixCount - len(ec2v6Prefixes)
+		log.Debugf("Found %d IPv6 Prefix(es) for ENI: %s, allocating %d", len(ec2v6Prefixes), eniID, missing)
+		strPrefixes, err := c.awsClient.AllocIPv6Prefixes(eniID, missing)
 		if err != nil {
 			return err
 		}
 		for _, v6Prefix := range strPrefixes {
 			ec2v6Prefixes = append(ec2v6Prefixes, &ec2.Ipv6PrefixSpecification{Ipv6Prefix: v6Prefix})
 		}
-		log.Debugf("Successfully allocated an IPv6Prefix for ENI: %s", eniID)
-	} else if len(ec2v6Prefixes) > 1 {
-		//Found more than one v6 prefix attached to the ENI. VPC CNI will only attach a single v6 prefix
-		//and it will not attempt to free any additional Prefixes that are already attached.
-		//Will use the first IPv6 Prefix attached for IP address allocation.
-		ec2v6Prefixes = []*ec2.Ipv6PrefixSpecification{ec2v6Prefixes[0]}
+		log.Debugf("Successfully allocated %d IPv6Prefix(es) for ENI: %s", len(strPrefixes), eniID)
+	} else if len(ec2v6Prefixes) > prefixCount {
+		//Found more v6 prefixes attached to the ENI than configured. VPC CNI will not attempt to free the
+		//additional Prefixes that are already attached, and will use the first ones for IP address allocation.
+		ec2v6Prefixes = ec2v6Prefixes[:prefixCount]
 	}
 	c.addENIv6prefixesToDataStore(ec2v6Prefixes, eniID)
 	return nil
@@ -1058,8 +1322,10 @@ func (c *IPAMContext) setupENI(eni string, eniMetadata awsutils.ENIMetadata, isT
 	// Store the addressable IP for the ENI
 	if c.enableIPv6 {
 		c.primaryIP[eni] = eniMetadata.PrimaryIPv6Address()
+		c.setENISubnet(eni, eniMetadata.SubnetIPv6CIDR)
 	} else {
 		c.primaryIP[eni] = eniMetadata.PrimaryIPv4Address()
+		c.setENISubnet(eni, eniMetadata.SubnetIPv4CIDR)
 	}
 
 	if c.enableIPv6 && eni == primaryENI {
@@ -1070,8 +1336,9 @@ func (c *IPAMContext) setupENI(eni string, eniMetadata awsutils.ENIMetadata, isT
 			return errors.Wrapf(err, "Failed to allocate IPv6 Prefixes to Primary ENI")
 		}
 	} else {
-		// For other ENIs, set up the network
-		if eni != primaryENI {
+		// For other ENIs, set up the network. A primary ENI that is not at device number 0 gets a route table of its own
+		// too, the main route table goes through the uplink of the host.
+		if eni != primaryENI || eniMetadata.DeviceNumber != 0 {
 			subnetCidr := eniMetadata.SubnetIPv4CIDR
 			if c.enableIPv6 {
 				subnetCidr = eniMetadata.SubnetIPv6CIDR
@@ -1086,6 +1353,12 @@ func (c *IPAMContext) setupENI(eni string, eniMetadata awsutils.ENIMetadata, isT
 				delete(c.primaryIP, eni)
 				return errors.Wrapf(err, "failed to set up ENI %s network", eni)
 			}
+			c.setENINetwork(eni, eniNetwork{
+				eniIP:        c.primaryIP[eni],
+				mac:          eniMetadata.MAC,
+				deviceNumber: eniMetadata.DeviceNumber,
+				subnetCIDR:   subnetCidr,
+			})
 		}
 		if !c.enableIPv6 {
 			log.Infof("Found ENIs having %d secondary IPs and %d Prefixes", len(eniMetadata.IPv4Addresses), len(eniMetadata.IPv4Prefixes))
@@ -1100,6 +1373,74 @@ func (c *IPAMContext) setupENI(eni string, eniMetadata awsutils.ENIMetadata, isT
 	return nil
 }
 
+// setupAttachedENIs describes the ENIs attached to the instance, and sets up the managed ones with their IPs and
+// prefixes
+func (c *IPAMContext) setupAttachedENIs() error {
+	metadataResult, err := c.awsClient.DescribeAllENIs()
+	if err != nil {
+		return errors.Wrap(err, "ipamd init: failed to retrieve attached ENIs info")
+	}
+
+	log.Debugf("DescribeAllENIs success: ENIs: %d, tagged: %d", len(metadataResult.ENIMetadata), len(metadataResult.TagMap))
+	c.awsClient.SetMultiCardENIs(metadataResult.MultiCardENIIDs)
+	c.efaOnlyENIs = metadataResult.EFAOnlyENIs
+	c.setUnmanagedENIs(metadataResult)
+	enis := c.filterUnmanagedENIs(metadataResult.ENIMetadata)
+
+	for _, eni := range enis {
+		log.Debugf("Discovered ENI %s, trying to set it up", eni.ENIID)
+		if c.startupReconcileMode == startupReconcileDeep {
+			eni = c.crossCheckENIWithEC2(eni)
+		}
+		isTrunkENI := eni.ENIID == metadataResult.TrunkENI
+		isEFAENI := metadataResult.EFAENIs[eni.ENIID]
+		if !isTrunkENI && !c.disableENIProvisioning {
+			if err := c.awsClient.TagENI(eni.ENIID, metadataResult.TagMap[eni.ENIID]); err != nil {
+				return errors.Wrapf(err, "ipamd init: failed to tag managed ENI %v", eni.ENIID)
+			}
+		}
+
+		// Retry ENI sync
+		retry := 0
+		for {
+			retry++
+			if err = c.setupENI(eni.ENIID, eni, isTrunkENI, isEFAENI); err == nil {
+				log.Infof("ENI %s set up.", eni.ENIID)
+				break
+			}
+
+			if retry > maxRetryCheckENI {
+				log.Warnf("Reached max retry: Unable to discover attached IPs for ENI from metadata service (attempted %d/%d): %v", retry, maxRetryCheckENI, err)
+				ipamdErrInc("waitENIAttachedMaxRetryExceeded")
+				break
+			}
+
+			log.Warnf("Error trying to set up ENI %s: %v", eni.ENIID, err)
+			if errors.Is(err, networkutils.ErrLinkNotFound) {
+				// If we can't find the matching link for this MAC address, there is no point in retrying for this ENI.
+				log.Debug("Unable to match link for this ENI, going to the next one.")
+				break
+			}
+			log.Debugf("Unable to discover IPs for this ENI yet (attempt %d/%d)", retry, maxRetryCheckENI)
+			time.Sleep(eniAttachTime)
+		}
+	}
+	return nil
+}
+
+// addIPv4CidrToStore adds an IP or a prefix of an ENI to the datastore, with the IPAM pool as its source when it was
+// allocated from the pool
+func (c *IPAMContext) addIPv4CidrToStore(eni string, cidr net.IPNet, isPrefix bool) error {
+	if c.ipamPoolID == "" || !c.awsClient.IsIPAMPoolCIDR(cidr.String()) {
+		return c.dataStore.AddIPv4CidrToStore(eni, cidr, isPrefix)
+	}
+	source := datastore.IPAMPoolIPv4Source
+	if isPrefix {
+		source = datastore.IPAMPoolIPv4PrefixSource
+	}
+	return c.dataStore.AddCidrToStore(eni, cidr, source)
+}
+
 func (c *IPAMContext) addENIsecondaryIPsToDataStore(ec2PrivateIpAddrs []*ec2.NetworkInterfacePrivateIpAddress, eni string) {
 	// Add all the secondary IPs
 	for _, ec2PrivateIpAddr := range ec2PrivateIpAddrs {
@@ -1107,7 +1448,7 @@ func (c *IPAMContext) addENIsecondaryIPsToDataStore(ec2PrivateIpAddrs []*ec2.Net
 			continue
 		}
 		cidr := net.IPNet{IP: net.ParseIP(aws.StringValue(ec2PrivateIpAddr.PrivateIpAddress)), Mask: net.IPv4Mask(255, 255, 255, 255)}
-		err := c.dataStore.AddIPv4CidrToStore(eni, cidr, false)
+		err := c.addIPv4CidrToStore(eni, cidr, false)
 		if err != nil && err.Error() != datastore.IPAlreadyInStoreError {
 			log.Warnf("Failed to increase IP pool, failed to add IP %s to data store", ec2PrivateIpAddr.PrivateIpAddress)
 			// continue to add next address
@@ -1128,7 +1469,7 @@ func (c *IPAMContext) addENIv4prefixesToDataStore(ec2PrefixAddrs []*ec2.Ipv4Pref
 			continue
 		}
 		cidr := *ipnet
-		err = c.dataStore.AddIPv4CidrToStore(eni, cidr, true)
+		err = c.addIPv4CidrToStore(eni, cidr, true)
 		if err != nil && err.Error() != datastore.IPAlreadyInStoreError {
 			log.Warnf("Failed to increase Prefix pool, failed to add Prefix %s to data store", ec2PrefixAddr.Ipv4Prefix)
 			// continue to add next address
@@ -1247,7 +1588,8 @@ func (c *IPAMContext) tryEnableSecurityGroupsForPods(ctx context.Context) {
 // recheck if we need the ENI for prefix target.
 func (c *IPAMContext) shouldRemoveExtraENIs() bool {
 	// When WARM_IP_TARGET is set, return true as verification is always done in getDeletableENI()
-	if c.warmIPTargetsDefined() {
+	// In on-demand mode, an ENI without pods is always extra
+	if c.onDemandAllocation || c.warmIPTargetsDefined() {
 		return true
 	}
 
@@ -1337,14 +1679,19 @@ func (c *IPAMContext) nodeIPPoolReconcile(ctx context.Context, interval time.Dur
 	if err != nil {
 		log.Errorf("IP pool reconcile: Failed to get attached ENI info: %v", err.Error())
 		ipamdErrInc("reconcileFailedGetENIs")
+		c.recordReconcile(false)
 		return
 	}
 	// We must always have at least the primary ENI of the instance
 	if allENIs == nil {
 		log.Error("IP pool reconcile: No ENI found at all in metadata, unable to reconcile")
 		ipamdErrInc("reconcileFailedGetENIs")
+		c.recordReconcile(false)
 		return
 	}
+	// The reconcile is stable when it fails nowhere and leaves the ENIs and IPs of the datastore as they were
+	stable := true
+	statsBefore := c.dataStore.GetIPStats(ipV4AddrFamily)
 	attachedENIs := c.filterUnmanagedENIs(allENIs)
 	currentENIs := c.dataStore.GetENIInfos().ENIs
 	trunkENI := c.dataStore.GetTrunkENI()
@@ -1366,6 +1713,7 @@ func (c *IPAMContext) nodeIPPoolReconcile(ctx context.Context, interval time.Dur
 		metadataResult, err := c.awsClient.DescribeAllENIs()
 		if err != nil {
 			log.Warnf("Failed to call EC2 to describe ENIs, aborting reconcile: %v", err)
+			c.recordReconcile(false)
 			return
 		}
 
@@ -1377,8 +1725,9 @@ func (c *IPAMContext) nodeIPPoolReconcile(ctx context.Context, interval time.Dur
 		// Just copy values of the EFA set
 		efaENIs = metadataResult.EFAENIs
 		eniTagMap = metadataResult.TagMap
-		c.setUnmanagedENIs(metadataResult.TagMap)
+		c.setUnmanagedENIs(metadataResult)
 		c.awsClient.SetMultiCardENIs(metadataResult.MultiCardENIIDs)
+		c.efaOnlyENIs = metadataResult.EFAOnlyENIs
 		attachedENIs = c.filterUnmanagedENIs(metadataResult.ENIMetadata)
 	}
 
@@ -1405,12 +1754,14 @@ func (c *IPAMContext) nodeIPPoolReconcile(ctx context.Context, interval time.Dur
 			if err := c.awsClient.TagENI(attachedENI.ENIID, eniTagMap[attachedENI.ENIID]); err != nil {
 				log.Errorf("IP pool reconcile: failed to tag managed ENI %v: %v", attachedENI.ENIID, err)
 				ipamdErrInc("eniReconcileAdd")
+				stable = false
 				continue
 			}
 		}
 
 		// Add new ENI
 		log.Debugf("Reconcile and add a new ENI %s", attachedENI)
+		stable = false
 		err = c.setupENI(attachedENI.ENIID, attachedENI, isTrunkENI, isEFAENI)
 		if err != nil {
 			log.Errorf("IP pool reconcile: Failed to set up ENI %s network: %v", attachedENI.ENIID, err)
@@ -1424,6 +1775,7 @@ func (c *IPAMContext) nodeIPPoolReconcile(ctx context.Context, interval time.Dur
 	// Sweep phase: since the marked ENI have been removed, the remaining ones needs to be sweeped
 	for eni := range currentENIs {
 		log.Infof("Reconcile and delete detached ENI %s", eni)
+		stable = false
 		// Force the delete, since aws local metadata has told us that this ENI is no longer
 		// attached, so any IPs assigned from this ENI will no longer work.
 		err = c.dataStore.RemoveENIFromDataStore(eni, true /* force */)
@@ -1438,7 +1790,9 @@ func (c *IPAMContext) nodeIPPoolReconcile(ctx context.Context, interval time.Dur
 	c.lastNodeIPPoolAction = time.Now()
 
 	log.Debug("Successfully Reconciled ENI/IP pool")
-	c.logPoolStats(c.dataStore.GetIPStats(ipV4AddrFamily))
+	statsAfter := c.dataStore.GetIPStats(ipV4AddrFamily)
+	c.logPoolStats(statsAfter)
+	c.recordReconcile(stable && statsAfter.TotalIPs == statsBefore.TotalIPs && statsAfter.TotalPrefixes == statsBefore.TotalPrefixes)
 }
 
 func (c *IPAMContext) eniIPPoolReconcile(ipPool []string, attachedENI awsutils.ENIMetadata, eni string) {
@@ -1584,7 +1938,7 @@ func (c *IPAMContext) verifyAndAddIPsToDatastore(eni string, attachedENIIPs []*e
 		}
 		log.Infof("Trying to add %s", strPrivateIPv4)
 		// Try to add the IP
-		err := c.dataStore.AddIPv4CidrToStore(eni, ipv4Addr, false)
+		err := c.addIPv4CidrToStore(eni, ipv4Addr, false)
 		if err != nil && err.Error() != datastore.IPAlreadyInStoreError {
 			log.Errorf("Failed to reconcile IP %s on ENI %s", strPrivateIPv4, eni)
 			ipamdErrInc("ipReconcileAdd")
@@ -1656,7 +2010,7 @@ func (c *IPAMContext) verifyAndAddPrefixesToDatastore(eni string, attachedENIPre
 			}
 		}
 
-		err = c.dataStore.AddIPv4CidrToStore(eni, *ipv4CidrPtr, true)
+		err = c.addIPv4CidrToStore(eni, *ipv4CidrPtr, true)
 		if err != nil && err.Error() != datastore.IPAlreadyInStoreError {
 			log.Errorf("Failed to reconcile Prefix %s on ENI %s", strPrivateIPv4Cidr, eni)
 			ipamdErrInc("prefixReconcileAdd")
@@ -1686,6 +2040,50 @@ func ManageENIsOnNonSchedulableNode() bool {
 	return parseBoolEnvVar(envManageENIsNonSchedulable, false)
 }
 
+func useAdaptiveWarmTargets() bool {
+	return parseBoolEnvVar(envAdaptiveWarmTargets, false)
+}
+
+func useOnDemandAllocation() bool {
+	return parseBoolEnvVar(envOnDemandAllocation, false)
+}
+
+func usePriorityAllocation() bool {
+	return parseBoolEnvVar(envPriorityAllocation, false)
+}
+
+func useDatastoreMetrics() bool {
+	return parseBoolEnvVar(envDatastoreMetrics, false)
+}
+
+func getIPWaitTimeout() time.Duration {
+	inputStr, found := os.LookupEnv(envIPWaitTimeout)
+	if !found {
+		return 0
+	}
+	if input, err := strconv.Atoi(inputStr); err == nil && input >= 0 {
+		return time.Duration(input) * time.Second
+	}
+	log.Warnf("Ignoring invalid %s %q", envIPWaitTimeout, inputStr)
+	return 0
+}
+
+func usePodIPResource() bool {
+	return parseBoolEnvVar(envPodIPResource, false)
+}
+
+func useWarmIPRebalancing() bool {
+	return parseBoolEnvVar(envWarmIPRebalancing, false)
+}
+
+func useAdaptiveReconcile() bool {
+	return parseBoolEnvVar(envAdaptiveReconcile, false)
+}
+
+func preDetachOnCordon() bool {
+	return parseBoolEnvVar(envPreDetachOnCordon, false)
+}
+
 // UseSubnetDiscovery returns whether we should use enhanced subnet selection or not when creating ENIs.
 func UseSubnetDiscovery() bool {
 	return parseBoolEnvVar(envSubnetDiscovery, true)
@@ -1709,6 +2107,17 @@ func dsBackingStorePath() string {
 	return defaultBackingStorePath
 }
 
+func eniInventoryPath() string {
+	return filepath.Join(filepath.Dir(dsBackingStorePath()), eniInventoryFileName)
+}
+
+func ipAuditLogPath() string {
+	if value := os.Getenv(envIPAuditLogPath); value != "" {
+		return value
+	}
+	return defaultIPAuditLogPath
+}
+
 func getWarmIPTarget() int {
 	inputStr, found := os.LookupEnv(envWarmIPTarget)
 	if !found {
@@ -1724,6 +2133,35 @@ func getWarmIPTarget() int {
 	return noWarmIPTarget
 }
 
+func getIPLeaseTarget() int {
+	inputStr, found := os.LookupEnv(envIPLeaseTarget)
+	if !found {
+		return 0
+	}
+
+	if input, err := strconv.Atoi(inputStr); err == nil {
+		if input >= 0 {
+			log.Debugf("Using IP_LEASE_TARGET %v", input)
+			return input
+		}
+	}
+	return 0
+}
+
+func getIPv6PrefixCount() int {
+	inputStr, found := os.LookupEnv(envIPv6PrefixCount)
+	if !found {
+		return defaultIPv6PrefixCount
+	}
+
+	if input, err := strconv.Atoi(inputStr); err == nil && input >= 1 {
+		log.Debugf("Using %s %v", envIPv6PrefixCount, input)
+		return input
+	}
+	log.Warnf("Invalid %s %q, using %d", envIPv6PrefixCount, inputStr, defaultIPv6PrefixCount)
+	return defaultIPv6PrefixCount
+}
+
 func getMinimumIPTarget() int {
 	inputStr, found := os.LookupEnv(envMinimumIPTarget)
 	if !found {
@@ -1777,6 +2215,10 @@ func isIPv6Enabled() bool {
 	return utils.GetBoolAsStringEnvVar(envEnableIPv6, false)
 }
 
+func enableV4EgressNAT64() bool {
+	return utils.GetBoolAsStringEnvVar(envEnableV4EgressNAT64, false)
+}
+
 func enableManageUntaggedMode() bool {
 	return utils.GetBoolAsStringEnvVar(envManageUntaggedENI, true)
 }
@@ -1785,7 +2227,8 @@ func enablePodIPAnnotation() bool {
 	return utils.GetBoolAsStringEnvVar(envAnnotatePodIP, false)
 }
 
-// filterUnmanagedENIs filters out ENIs marked with the "node.k8s.amazonaws.com/no_manage" tag
+// filterUnmanagedENIs filters out ENIs marked with the "node.k8s.amazonaws.com/no_manage" tag, as well as
+// EFA-only ENIs. Filtered ENIs on network card 0 are counted against the ENI limit.
 func (c *IPAMContext) filterUnmanagedENIs(enis []awsutils.ENIMetadata) []awsutils.ENIMetadata {
 	numFiltered := 0
 	ret := make([]awsutils.ENIMetadata, 0, len(enis))
@@ -1805,6 +2248,11 @@ func (c *IPAMContext) filterUnmanagedENIs(enis []awsutils.ENIMetadata) []awsutil
 		} else if c.awsClient.IsMultiCardENI(eni.ENIID) {
 			log.Debugf("Skipping ENI %s: since on non-zero network card", eni.ENIID)
 			continue
+		} else if c.efaOnlyENIs[eni.ENIID] {
+			// EFA-only ENIs cannot be used for pod IPs, but still count against the instance ENI limit
+			log.Debugf("Skipping ENI %s: since it is an EFA-only interface", eni.ENIID)
+			numFiltered++
+			continue
 		}
 		ret = append(ret, eni)
 	}
@@ -1816,6 +2264,9 @@ func (c *IPAMContext) filterUnmanagedENIs(enis []awsutils.ENIMetadata) []awsutil
 // datastoreTargetState determines the number of IPs `short` or `over` our WARM_IP_TARGET, accounting for the MINIMUM_IP_TARGET.
 // With prefix delegation, this function determines the number of Prefixes `short` or `over`
 func (c *IPAMContext) datastoreTargetState(stats *datastore.DataStoreStats) (short int, over int, enabled bool) {
+	if c.onDemandAllocation {
+		return c.onDemandTargetState(stats)
+	}
 	if !c.warmIPTargetsDefined() {
 		// there is no WARM_IP_TARGET defined and no MINIMUM_IP_TARGET, fallback to use all IP addresses on ENI
 		return 0, 0, false
@@ -1920,7 +2371,24 @@ func GetConfigForDebug() map[string]interface{} {
 		envWarmENITarget:            getWarmENITarget(),
 		envCustomNetworkCfg:         UseCustomNetworkCfg(),
 		envManageENIsNonSchedulable: ManageENIsOnNonSchedulableNode(),
+		envPreDetachOnCordon:        preDetachOnCordon(),
+		envAdaptiveWarmTargets:      useAdaptiveWarmTargets(),
+		envOnDemandAllocation:       useOnDemandAllocation(),
+		envPriorityAllocation:       usePriorityAllocation(),
+		envDatastoreMetrics:         useDatastoreMetrics(),
+		featuregate.EnvFeatureGates: os.Getenv(featuregate.EnvFeatureGates),
+		envIPWaitTimeout:            getIPWaitTimeout().String(),
+		envWarmIPRebalancing:        useWarmIPRebalancing(),
+		envAdaptiveReconcile:        useAdaptiveReconcile(),
+		envIPLeaseTarget:            getIPLeaseTarget(),
+		envIPv6PrefixCount:          getIPv6PrefixCount(),
+		envPodIPResource:            usePodIPResource(),
 		envSubnetDiscovery:          UseSubnetDiscovery(),
+		envUnmanagedENITags:         loadUnmanagedENITags(),
+		envV4EgressSNATSource:       v4EgressSNATSource(),
+		envExcludeSNATRouteTargets:  excludeSNATRouteTargets(),
+		envStartupReconcileMode:     startupReconcileMode(),
+		envCrashSnapshotDestination: os.Getenv(envCrashSnapshotDestination),
 	}
 }
 
@@ -2295,7 +2763,13 @@ func (c *IPAMContext) isConfigValid() bool {
 		c.enablePrefixDelegation = false
 	}
 
-	return true
+	// Degrade from the combinations that are not supported, once prefix delegation is settled
+	c.resolveFeatureConflicts()
+
+	if !c.validateStartupReconcileMode() || !c.validateCrashSnapshotDestination() {
+		return false
+	}
+	return c.validateV4EgressSNATSource()
 }
 
 func (c *IPAMContext) AddFeatureToCNINode(ctx context.Context, featureName rcv1alpha1.FeatureName, featureValue string) error {
@@ -882,6 +882,52 @@ func TestTryAddIPToENI(t *testing.T) {
 	mockContext.increaseDatastorePool(ctx)
 }
 
+func TestAssignIPv6Prefix(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	v6prefix02 := "2001:db8:0:1::/64"
+	v6prefix03 := "2001:db8:0:2::/64"
+	newContext := func(prefixCount int) *IPAMContext {
+		ds := testDatastorewithPrefix()
+		assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+		return &IPAMContext{awsClient: m.awsutils, dataStore: ds, enableIPv6: true, ipv6PrefixCount: prefixCount}
+	}
+
+	// Only the missing prefixes are allocated
+	mockContext := newContext(3)
+	m.awsutils.EXPECT().GetIPv6PrefixesFromEC2(primaryENIid).Return([]*ec2.Ipv6PrefixSpecification{
+		{Ipv6Prefix: aws.String(v6prefix01)},
+	}, nil)
+	m.awsutils.EXPECT().AllocIPv6Prefixes(primaryENIid, 2).Return([]*string{aws.String(v6prefix02), aws.String(v6prefix03)}, nil)
+	assert.NoError(t, mockContext.assignIPv6Prefix(primaryENIid))
+	assert.Len(t, mockContext.dataStore.GetENIInfos().ENIs[primaryENIid].IPv6Cidrs, 3)
+
+	// Enough prefixes are attached already, the first ones are used
+	mockContext = newContext(2)
+	m.awsutils.EXPECT().GetIPv6PrefixesFromEC2(primaryENIid).Return([]*ec2.Ipv6PrefixSpecification{
+		{Ipv6Prefix: aws.String(v6prefix01)}, {Ipv6Prefix: aws.String(v6prefix02)}, {Ipv6Prefix: aws.String(v6prefix03)},
+	}, nil)
+	assert.NoError(t, mockContext.assignIPv6Prefix(primaryENIid))
+	cidrs := mockContext.dataStore.GetENIInfos().ENIs[primaryENIid].IPv6Cidrs
+	assert.Len(t, cidrs, 2)
+	assert.NotContains(t, cidrs, v6prefix03)
+
+	m.awsutils.EXPECT().GetIPv6PrefixesFromEC2(primaryENIid).Return(nil, nil)
+	m.awsutils.EXPECT().AllocIPv6Prefixes(primaryENIid, 2).Return(nil, errors.New("PrivateIpAddressLimitExceeded"))
+	assert.Error(t, newContext(2).assignIPv6Prefix(primaryENIid))
+}
+
+func TestGetIPv6PrefixCount(t *testing.T) {
+	assert.Equal(t, defaultIPv6PrefixCount, getIPv6PrefixCount())
+	t.Setenv(envIPv6PrefixCount, "4")
+	assert.Equal(t, 4, getIPv6PrefixCount())
+	t.Setenv(envIPv6PrefixCount, "0")
+	assert.Equal(t, defaultIPv6PrefixCount, getIPv6PrefixCount())
+	t.Setenv(envIPv6PrefixCount, "many")
+	assert.Equal(t, defaultIPv6PrefixCount, getIPv6PrefixCount())
+}
+
 func TestNodeIPPoolReconcile(t *testing.T) {
 	m := setup(t)
 	defer m.ctrl.Finish()
@@ -1452,7 +1498,7 @@ func TestIPAMContext_filterUnmanagedENIs(t *testing.T) {
 			mockAWSUtils.EXPECT().GetPrimaryENI().Times(tt.expectedGetPrimaryENICalls).Return(eni1.ENIID)
 			mockAWSUtils.EXPECT().GetInstanceID().Times(tt.expectedGetInstanceIDCalls).Return(instanceID)
 
-			c.setUnmanagedENIs(tt.tagMap)
+			c.setUnmanagedENIs(awsutils.DescribeAllENIsResult{TagMap: tt.tagMap})
 
 			mockAWSUtils.EXPECT().IsUnmanagedENI(gomock.Any()).DoAndReturn(
 				func(eni string) (unmanaged bool) {
@@ -1543,7 +1589,7 @@ func TestIPAMContext_filterUnmanagedENIs_disableManageUntaggedMode(t *testing.T)
 					assert.Equal(t, tt.unmanagedenis, args)
 				}).AnyTimes()
 
-			c.setUnmanagedENIs(tt.tagMap)
+			c.setUnmanagedENIs(awsutils.DescribeAllENIsResult{TagMap: tt.tagMap})
 
 			mockAWSUtils.EXPECT().IsUnmanagedENI(gomock.Any()).DoAndReturn(
 				func(eni string) (unmanaged bool) {
@@ -1574,6 +1620,51 @@ func TestIPAMContext_filterUnmanagedENIs_disableManageUntaggedMode(t *testing.T)
 	}
 }
 
+func TestIPAMContext_setUnmanagedENIs_overrides(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	eni1, eni2, eni3 := getDummyENIMetadata()
+	mockAWSUtils := mock_awsutils.NewMockAPIs(ctrl)
+	c := &IPAMContext{awsClient: mockAWSUtils, enableManageUntaggedMode: false}
+
+	mockAWSUtils.EXPECT().GetPrimaryENI().Return(eni1.ENIID).AnyTimes()
+	mockAWSUtils.EXPECT().GetInstanceID().Return(instanceID).AnyTimes()
+	// The tagged ENI is excluded and the untagged one included, the primary ENI is always managed
+	mockAWSUtils.EXPECT().SetUnmanagedENIs([]string{eni2.ENIID})
+
+	c.setUnmanagedENIs(awsutils.DescribeAllENIsResult{
+		TagMap: map[string]awsutils.TagMap{
+			eni1.ENIID: {},
+			eni2.ENIID: {eniNodeTagKey: instanceID},
+			eni3.ENIID: {},
+		},
+		ExcludedENIs: map[string]bool{eni1.ENIID: true, eni2.ENIID: true},
+		IncludedENIs: map[string]bool{eni3.ENIID: true},
+	})
+}
+
+func TestIPAMContext_filterUnmanagedENIs_efaOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	eni1, eni2, eni3 := getDummyENIMetadata()
+	mockAWSUtils := mock_awsutils.NewMockAPIs(ctrl)
+	mockAWSUtils.EXPECT().IsUnmanagedENI(gomock.Any()).Return(false).AnyTimes()
+	mockAWSUtils.EXPECT().IsMultiCardENI(gomock.Any()).Return(false).AnyTimes()
+
+	c := &IPAMContext{
+		awsClient:   mockAWSUtils,
+		maxENI:      4,
+		efaOnlyENIs: map[string]bool{eni3.ENIID: true},
+	}
+
+	got := c.filterUnmanagedENIs([]awsutils.ENIMetadata{eni1, eni2, eni3})
+	assert.Equal(t, []awsutils.ENIMetadata{eni1, eni2}, got)
+	// The EFA-only ENI still occupies an ENI slot
+	assert.Equal(t, 1, c.unmanagedENI)
+}
+
 func TestDisablingENIProvisioning(t *testing.T) {
 	m := setup(t)
 	defer m.ctrl.Finish()
@@ -1913,6 +2004,54 @@ func TestIPAMContext_setupENI(t *testing.T) {
 	assert.Equal(t, 1, len(mockContext.primaryIP))
 }
 
+func TestIPAMContext_setupENIPrimaryNotAtDeviceZero(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	mockContext := &IPAMContext{
+		awsClient:     m.awsutils,
+		networkClient: m.network,
+		primaryIP:     make(map[string]string),
+		dataStore:     testDatastore(),
+	}
+	primary := true
+	testAddr1 := ipaddr01
+	primaryENIMetadata := awsutils.ENIMetadata{
+		ENIID:          primaryENIid,
+		MAC:            primaryMAC,
+		DeviceNumber:   1,
+		SubnetIPv4CIDR: primarySubnet,
+		IPv4Addresses:  []*ec2.NetworkInterfacePrivateIpAddress{{PrivateIpAddress: &testAddr1, Primary: &primary}},
+	}
+	// The primary ENI gets a route table of its own, the main one goes through the uplink at device number 0
+	m.awsutils.EXPECT().GetPrimaryENI().Return(primaryENIid)
+	m.network.EXPECT().SetupENINetwork(testAddr1, primaryMAC, 1, primarySubnet).Return(nil)
+	err := mockContext.setupENI(primaryENIMetadata.ENIID, primaryENIMetadata, false, false)
+	assert.NoError(t, err)
+	assert.Equal(t, eniNetwork{eniIP: testAddr1, mac: primaryMAC, deviceNumber: 1, subnetCIDR: primarySubnet},
+		mockContext.eniNetworks[primaryENIid])
+	eniInfos := mockContext.dataStore.GetENIInfos()
+	assert.True(t, eniInfos.ENIs[primaryENIid].IsPrimary)
+}
+
+func TestAddIPv4CidrToStoreFromIPAMPool(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	ds := testDatastore()
+	assert.NoError(t, ds.AddENI(secENIid, secDevice, false, false, false))
+	c := &IPAMContext{awsClient: m.awsutils, dataStore: ds, ipamPoolID: "ipam-pool-0123456789abcdef0"}
+
+	m.awsutils.EXPECT().IsIPAMPoolCIDR("10.0.0.5/32").Return(true)
+	m.awsutils.EXPECT().IsIPAMPoolCIDR("10.0.0.6/32").Return(false)
+	assert.NoError(t, c.addIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP("10.0.0.5"), Mask: net.CIDRMask(32, 32)}, false))
+	assert.NoError(t, c.addIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP("10.0.0.6"), Mask: net.CIDRMask(32, 32)}, false))
+
+	cidrs := ds.GetENIInfos().ENIs[secENIid].AvailableIPv4Cidrs
+	assert.Equal(t, "ipam-pool-ipv4", cidrs["10.0.0.5/32"].Source)
+	assert.Equal(t, "secondary-ipv4", cidrs["10.0.0.6/32"].Source)
+}
+
 func TestIPAMContext_setupENIwithPDenabled(t *testing.T) {
 	m := setup(t)
 	defer m.ctrl.Finish()
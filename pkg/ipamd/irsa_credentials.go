@@ -0,0 +1,95 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils/awssession"
+)
+
+const (
+	irsaCredentialsCheckInterval = time.Minute
+
+	// IRSACredentialsConditionType is the node condition that is True when only the IRSA credentials may be used and
+	// the IRSA web identity token is missing or expired
+	IRSACredentialsConditionType v1.NodeConditionType = "AWSVPCCNIIRSACredentialsUnavailable"
+
+	irsaCredentialsUnavailableReason = "IRSACredentialsUnavailable"
+	irsaCredentialsAvailableReason   = "IRSACredentialsAvailable"
+)
+
+// CheckIRSACredentials checks the IRSA web identity token and reports the result in the IRSACredentialsConditionType
+// node condition. It is only called when only the IRSA credentials may be used, where ipamd must not start without
+// them rather than fall back to the node instance role.
+func CheckIRSACredentials(ctx context.Context, k8sClient client.Client) error {
+	err := awssession.CheckIRSAToken(time.Now())
+	if err != nil {
+		log.Errorf("IRSA credentials unavailable: %v", err)
+	}
+	if conditionErr := setNodeCondition(ctx, k8sClient, irsaCredentialsCondition(err)); conditionErr != nil {
+		log.Warnf("Failed to update node condition %s: %v", IRSACredentialsConditionType, conditionErr)
+	}
+	return err
+}
+
+// MonitorIRSACredentials periodically checks the IRSA web identity token, and updates the IRSACredentialsConditionType
+// node condition when the token becomes unavailable or available again. The EC2 calls fail while the token is
+// unavailable, since there is no fallback to the node instance role.
+func (c *IPAMContext) MonitorIRSACredentials() {
+	ctx := context.Background()
+	// CheckIRSACredentials succeeded before ipamd started
+	available := true
+	for {
+		time.Sleep(irsaCredentialsCheckInterval)
+		err := awssession.CheckIRSAToken(time.Now())
+		if (err == nil) == available {
+			continue
+		}
+		available = err == nil
+		if err != nil {
+			log.Errorf("IRSA credentials unavailable, the EC2 calls fail until the token is available again: %v", err)
+		} else {
+			log.Infof("IRSA credentials available again")
+		}
+		if conditionErr := setNodeCondition(ctx, c.k8sClient, irsaCredentialsCondition(err)); conditionErr != nil {
+			log.Warnf("Failed to update node condition %s: %v", IRSACredentialsConditionType, conditionErr)
+			// Retry on the next check
+			available = !available
+		}
+	}
+}
+
+// irsaCredentialsCondition returns the node condition reporting the error of the IRSA web identity token check
+func irsaCredentialsCondition(err error) v1.NodeCondition {
+	if err == nil {
+		return v1.NodeCondition{
+			Type:    IRSACredentialsConditionType,
+			Status:  v1.ConditionFalse,
+			Reason:  irsaCredentialsAvailableReason,
+			Message: "The IRSA web identity token is available",
+		}
+	}
+	return v1.NodeCondition{
+		Type:    IRSACredentialsConditionType,
+		Status:  v1.ConditionTrue,
+		Reason:  irsaCredentialsUnavailableReason,
+		Message: fmt.Sprintf("aws-node only uses the IRSA credentials, which are unavailable: %v", err),
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCheckIRSACredentials(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	t.Setenv("MY_NODE_NAME", myNodeName)
+	assert.NoError(t, m.k8sClient.Create(ctx, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: myNodeName}}))
+
+	getCondition := func() *v1.NodeCondition {
+		var node v1.Node
+		assert.NoError(t, m.k8sClient.Get(ctx, types.NamespacedName{Name: myNodeName}, &node))
+		for i := range node.Status.Conditions {
+			if node.Status.Conditions[i].Type == IRSACredentialsConditionType {
+				return &node.Status.Conditions[i]
+			}
+		}
+		return nil
+	}
+
+	// The service account of aws-node is not configured for IRSA
+	t.Setenv("AWS_ROLE_ARN", "")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "")
+	assert.Error(t, CheckIRSACredentials(ctx, m.k8sClient))
+	condition := getCondition()
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionTrue, condition.Status)
+		assert.Equal(t, irsaCredentialsUnavailableReason, condition.Reason)
+		assert.Contains(t, condition.Message, "AWS_ROLE_ARN")
+	}
+
+	// A token that does not expire before the next check clears the condition
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	assert.NoError(t, os.WriteFile(tokenFile, []byte("eyJhbGciOiJSUzI1NiJ9.eyJleHAiOjQxMDI0NDQ4MDB9.sig"), 0600))
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/aws-node")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+	assert.NoError(t, CheckIRSACredentials(ctx, m.k8sClient))
+	condition = getCondition()
+	if assert.NotNil(t, condition) {
+		assert.Equal(t, v1.ConditionFalse, condition.Status)
+		assert.Equal(t, irsaCredentialsAvailableReason, condition.Reason)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+const (
+	// maintenanceAnnotation on the node puts ipamd in maintenance mode, with the value pause or drain
+	maintenanceAnnotation = "vpc.amazonaws.com/ipamd-maintenance"
+
+	// maintenancePause stops allocating IPs, prefixes and ENIs, and keeps the warm pool as it is
+	maintenancePause = "pause"
+	// maintenanceDrain stops allocating, and releases the warm IPs, prefixes and ENIs that no pod uses
+	maintenanceDrain = "drain"
+
+	maintenanceModeReason = "MaintenanceMode"
+)
+
+// MaintenanceMode is the maintenance mode of ipamd, as reported by the /v1/maintenance introspection endpoint
+type MaintenanceMode struct {
+	Mode string `json:"mode"`
+}
+
+// readMaintenanceMode returns the maintenance mode set by the annotation of the node, empty outside of maintenance
+func (c *IPAMContext) readMaintenanceMode(ctx context.Context) string {
+	var node corev1.Node
+	if err := c.k8sClient.Get(ctx, types.NamespacedName{Name: c.myNodeName}, &node); err != nil {
+		log.Errorf("Failed to get node while checking for maintenance mode: %v", err)
+		// Keep the last mode, so that a failing API server does not end the maintenance
+		return c.MaintenanceMode()
+	}
+	switch mode := node.Annotations[maintenanceAnnotation]; mode {
+	case "", maintenancePause, maintenanceDrain:
+		return mode
+	default:
+		log.Warnf("Ignoring unknown value %q of the %s annotation, expected %s or %s", mode, maintenanceAnnotation,
+			maintenancePause, maintenanceDrain)
+		return ""
+	}
+}
+
+// updateMaintenanceMode reads the maintenance mode of the node, and reports when it changes
+func (c *IPAMContext) updateMaintenanceMode(ctx context.Context) string {
+	mode := c.readMaintenanceMode(ctx)
+
+	c.maintenanceLock.Lock()
+	previous := c.maintenanceMode
+	c.maintenanceMode = mode
+	c.maintenanceLock.Unlock()
+	if mode == previous {
+		return mode
+	}
+
+	message := "Left maintenance mode, allocating IPs again"
+	if mode != "" {
+		message = fmt.Sprintf("Entered maintenance mode %s, not allocating IPs", mode)
+	}
+	log.Info(message)
+	if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+		eventRecorder.SendPodEvent(corev1.EventTypeNormal, maintenanceModeReason, "UpdateIPPool", message)
+	}
+	return mode
+}
+
+// MaintenanceMode returns the maintenance mode of ipamd, empty outside of maintenance
+func (c *IPAMContext) MaintenanceMode() string {
+	c.maintenanceLock.RLock()
+	defer c.maintenanceLock.RUnlock()
+	return c.maintenanceMode
+}
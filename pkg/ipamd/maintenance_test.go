@@ -0,0 +1,72 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestUpdateIPPoolInMaintenanceMode(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+
+	ds := datastore.NewDataStore(log, datastore.NullCheckpoint{}, false)
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	assert.NoError(t, ds.AddENI(secENIid, secDevice, false, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP(ipaddr11), Mask: net.CIDRMask(32, 32)}, false))
+	mockContext := &IPAMContext{
+		awsClient:    m.awsutils,
+		k8sClient:    m.k8sClient,
+		dataStore:    ds,
+		myNodeName:   myNodeName,
+		enableIPv4:   true,
+		warmIPTarget: 5,
+		maxIPsPerENI: 14,
+		maxENI:       4,
+	}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: myNodeName,
+		Annotations: map[string]string{maintenanceAnnotation: maintenancePause}}}
+	assert.NoError(t, m.k8sClient.Create(ctx, node))
+
+	// The pool is below the warm IP target, but nothing is allocated or released
+	mockContext.updateIPPoolIfRequired(ctx)
+	assert.Equal(t, maintenancePause, mockContext.MaintenanceMode())
+	if assert.Len(t, fakeRecorder.Events, 1) {
+		assert.Contains(t, <-fakeRecorder.Events, "Entered maintenance mode pause")
+	}
+
+	// The idle secondary ENI is detached along with its IP
+	node.Annotations[maintenanceAnnotation] = maintenanceDrain
+	assert.NoError(t, m.k8sClient.Update(ctx, node))
+	m.awsutils.EXPECT().FreeENI(secENIid).Return(nil)
+	mockContext.updateIPPoolIfRequired(ctx)
+	assert.Equal(t, maintenanceDrain, mockContext.MaintenanceMode())
+	assert.Equal(t, 0, ds.GetIPStats(ipV4AddrFamily).TotalIPs)
+
+	// An unknown value ends the maintenance
+	node.Annotations[maintenanceAnnotation] = "stop"
+	assert.NoError(t, m.k8sClient.Update(ctx, node))
+	assert.Equal(t, "", mockContext.updateMaintenanceMode(ctx))
+}
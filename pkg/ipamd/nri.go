@@ -0,0 +1,118 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/containerd/nri/pkg/stub"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+const (
+	// envNRISocketPath is the socket of the Node Resource Interface of containerd
+	envNRISocketPath     = "NRI_SOCKET_PATH"
+	defaultNRISocketPath = "/var/run/nri/nri.sock"
+
+	nriPluginName = "aws-vpc-cni"
+	// nriPluginIdx orders the plugin among the NRI plugins of the node, it only observes the sandboxes
+	nriPluginIdx = "50"
+
+	// nriReconnectInterval is how long to wait before registering again when the runtime closes the connection
+	nriReconnectInterval = 10 * time.Second
+)
+
+// nriPlugin follows the lifecycle of the pod sandboxes through containerd. The runtime only tells the NRI plugins
+// about a sandbox after its CNI ADD, so the plugin releases the IPs of the sandboxes that are gone without waiting for
+// a DEL, it does not reserve IPs ahead of the ADD.
+type nriPlugin struct {
+	c *IPAMContext
+}
+
+// MonitorNRI registers ipamd as a plugin of the Node Resource Interface of containerd, and registers again whenever
+// the runtime restarts
+func (c *IPAMContext) MonitorNRI() {
+	socketPath := utils.GetEnv(envNRISocketPath, defaultNRISocketPath)
+	for {
+		s, err := stub.New(&nriPlugin{c: c}, stub.WithPluginName(nriPluginName), stub.WithPluginIdx(nriPluginIdx),
+			stub.WithSocketPath(socketPath))
+		if err != nil {
+			log.Errorf("Failed to create the NRI plugin: %v", err)
+			return
+		}
+		if err := s.Run(context.Background()); err != nil {
+			log.Warnf("NRI plugin stopped, registering again in %s: %v", nriReconnectInterval, err)
+		}
+		time.Sleep(nriReconnectInterval)
+	}
+}
+
+// Synchronize releases the IPs of the sandboxes that the runtime removed while ipamd was not registered
+func (p *nriPlugin) Synchronize(_ context.Context, pods []*api.PodSandbox, _ []*api.Container) ([]*api.ContainerUpdate, error) {
+	sandboxes := make(map[string]bool, len(pods))
+	for _, pod := range pods {
+		sandboxes[pod.GetId()] = true
+	}
+	now := time.Now()
+	var gone []datastore.CheckpointEntry
+	for _, allocation := range p.c.dataStore.Snapshot().Allocations {
+		// A sandbox whose ADD is in flight is not known to the runtime yet, the IPs leased to the plugin have no
+		// sandbox until they are claimed, and those held for the release of their carrier IP have none
+		if allocation.NetworkName == ipLeaseNetworkName || allocation.NetworkName == carrierIPReleaseNetworkName ||
+			now.Sub(time.Unix(0, allocation.AllocationTimestamp)) < sandboxReconcileGracePeriod {
+			continue
+		}
+		if !sandboxes[allocation.ContainerID] {
+			gone = append(gone, allocation)
+		}
+	}
+	log.Infof("Registered as NRI plugin, %d sandboxes on the node", len(pods))
+	p.c.releaseRemovedSandboxes(gone)
+	return nil, nil
+}
+
+// RemovePodSandbox releases the IP of a sandbox whose CNI DEL did not reach ipamd
+func (p *nriPlugin) RemovePodSandbox(_ context.Context, pod *api.PodSandbox) error {
+	var gone []datastore.CheckpointEntry
+	for _, allocation := range p.c.dataStore.Snapshot().Allocations {
+		if allocation.ContainerID == pod.GetId() && allocation.NetworkName != ipLeaseNetworkName {
+			gone = append(gone, allocation)
+		}
+	}
+	p.c.releaseRemovedSandboxes(gone)
+	return nil
+}
+
+// releaseRemovedSandboxes releases the allocations of the sandboxes that the runtime removed
+func (c *IPAMContext) releaseRemovedSandboxes(allocations []datastore.CheckpointEntry) {
+	var released []datastore.CheckpointEntry
+	for _, allocation := range allocations {
+		if _, _, _, err := c.unassignPodIPAddress(allocation.IPAMKey, allocation.Metadata.K8SPodUID); err != nil {
+			log.Warnf("Failed to release the IP of removed sandbox %s: %v", allocation.IPAMKey, err)
+			continue
+		}
+		log.Infof("Released IP %s%s of pod %s/%s, the runtime removed its sandbox %s", allocation.IPv4, allocation.IPv6,
+			allocation.Metadata.K8SPodNamespace, allocation.Metadata.K8SPodName, allocation.ContainerID)
+		released = append(released, allocation)
+		prometheusmetrics.SandboxMismatchRepairs.WithLabelValues(mismatchAllocatedWithoutSandbox).Inc()
+	}
+	if len(released) > 0 {
+		c.dataStore.PruneStaleAllocations(released)
+	}
+}
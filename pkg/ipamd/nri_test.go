@@ -0,0 +1,97 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/containerd/nri/pkg/api"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestNRIPluginReleasesRemovedSandboxes(t *testing.T) {
+	ds := testDatastore()
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		assert.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(32, 32)}, false))
+	}
+	// The allocations are old enough to be checked by the synchronization
+	old := time.Now().Add(-time.Hour).UnixNano()
+	restored, err := ds.MergeSnapshot(datastore.CheckpointData{
+		Version: datastore.CheckpointFormatVersion,
+		Allocations: []datastore.CheckpointEntry{
+			{IPAMKey: datastore.IPAMKey{NetworkName: "aws-cni", ContainerID: "running", IfName: "eth0"}, IPv4: "10.0.0.1", AllocationTimestamp: old},
+			{IPAMKey: datastore.IPAMKey{NetworkName: "aws-cni", ContainerID: "gone", IfName: "eth0"}, IPv4: "10.0.0.2", AllocationTimestamp: old},
+		},
+	}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, restored)
+	_, _, err = ds.AssignPodIPv4Address(datastore.IPAMKey{NetworkName: "aws-cni", ContainerID: "adding", IfName: "eth0"},
+		datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "adding"})
+	assert.NoError(t, err)
+	p := &nriPlugin{c: &IPAMContext{dataStore: ds}}
+	sandboxes := func() []string {
+		var ids []string
+		for _, allocation := range ds.Snapshot().Allocations {
+			ids = append(ids, allocation.ContainerID)
+		}
+		return ids
+	}
+
+	// The sandbox whose ADD is in flight is not known to the runtime yet, and keeps its IP
+	_, err = p.Synchronize(context.Background(), []*api.PodSandbox{{Id: "running"}}, nil)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"running", "adding"}, sandboxes())
+
+	assert.NoError(t, p.RemovePodSandbox(context.Background(), &api.PodSandbox{Id: "running"}))
+	assert.ElementsMatch(t, []string{"adding"}, sandboxes())
+	// Removing a sandbox without an IP, of a host network pod or whose DEL was handled, is a no-op
+	assert.NoError(t, p.RemovePodSandbox(context.Background(), &api.PodSandbox{Id: "running"}))
+	assert.ElementsMatch(t, []string{"adding"}, sandboxes())
+}
+
+func TestNRIPluginHoldsCarrierIPs(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	c := carrierIPTestContext(t, m)
+	c.carrierIPs["10.0.0.5"] = "155.146.0.10"
+	p := &nriPlugin{c: c}
+
+	// The IP of the removed sandbox stays out of the pool until its carrier IP is released
+	releasing := make(chan struct{})
+	release := make(chan struct{})
+	m.awsutils.EXPECT().ReleaseCarrierIP(gomock.Any(), "10.0.0.5").DoAndReturn(func(context.Context, string) error {
+		close(releasing)
+		<-release
+		return nil
+	})
+	m.network.EXPECT().TeardownCarrierIPRules(net.ParseIP("10.0.0.5")).Return(nil)
+
+	assert.NoError(t, p.RemovePodSandbox(context.Background(), &api.PodSandbox{Id: "sandbox"}))
+	<-releasing
+	allocated := c.dataStore.AllocatedIPs()
+	assert.Len(t, allocated, 1)
+	assert.Equal(t, carrierIPReleaseKey("10.0.0.5"), allocated[0].IPAMKey)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,196 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/podsetup"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+const (
+	// onDemandWaitTimeout is how long an ADD waits for the pool manager to allocate its IP before failing, kubelet
+	// retries the sandbox afterwards
+	onDemandWaitTimeout = 10 * time.Second
+	// onDemandRetryInterval is how often a waiting ADD looks for a new IP in the datastore
+	onDemandRetryInterval = 250 * time.Millisecond
+	// onDemandBatchWindow is how long the pool manager waits once woken up, so that the ADDs of a burst of pods are
+	// allocated in one EC2 call
+	onDemandBatchWindow = 500 * time.Millisecond
+
+	// After a failed allocation, the next one waits from minOnDemandBackoff, doubling up to maxOnDemandBackoff
+	minOnDemandBackoff = time.Second
+	maxOnDemandBackoff = time.Minute
+)
+
+// errIPWaitTimeout is returned to the ADDs that waited for an IP until the wait timeout
+var errIPWaitTimeout = fmt.Errorf("%w: no IP allocated in time", datastore.ErrNoAvailableIPs)
+
+// allocationError is the class of the error of a failed pool allocation, empty after a successful one
+type allocationError struct {
+	class     string
+	retryable bool
+}
+
+// recordAllocationError keeps the class of the error of the last pool allocation
+func (c *IPAMContext) recordAllocationError(err error) {
+	if err == nil {
+		c.lastAllocationError.Store(allocationError{})
+		return
+	}
+	c.lastAllocationError.Store(allocationError{class: awsutils.ErrorClass(err), retryable: awsutils.IsRetryable(err)})
+}
+
+// lastAllocationErr returns the class of the error of the last pool allocation, ok is false when it succeeded
+func (c *IPAMContext) lastAllocationErr() (allocationError, bool) {
+	allocErr, _ := c.lastAllocationError.Load().(allocationError)
+	return allocErr, allocErr.class != ""
+}
+
+// assignPodIP assigns a free IP to the pod. The ADDs that may wait go to the wait queue when there is no free IP, or
+// when other ADDs already wait, and the others only take the IPs that the queue does not need.
+func (c *IPAMContext) assignPodIP(ctx context.Context, key datastore.IPAMKey, metadata datastore.IPAMMetadata, class string) (string, string, int, error) {
+	waits := c.waitsForIP(class)
+	if queued := c.ipWaitQueue.len(); queued == 0 || !waits && c.freeIPs() > queued {
+		ipv4Addr, ipv6Addr, deviceNumber, err := c.dataStore.AssignPodIPAddress(key, metadata, c.enableIPv4, c.enableIPv6)
+		if !waits || !errors.Is(err, datastore.ErrNoAvailableIPs) {
+			return ipv4Addr, ipv6Addr, deviceNumber, err
+		}
+	} else if !waits {
+		return "", "", -1, errors.Wrapf(datastore.ErrNoAvailableIPs, "the free IPs are kept for the %d ADDs waiting for one", queued)
+	}
+	allocateStart := time.Now()
+	defer func() { observePodSetupPhase(ctx, podsetup.PhaseEC2Allocate, time.Since(allocateStart).Seconds()) }()
+	return c.assignPodIPOnDemand(ctx, key, metadata, class)
+}
+
+// waitsForIP returns whether an ADD of the class waits for the pool manager to allocate an IP when there is none
+func (c *IPAMContext) waitsForIP(class string) bool {
+	return c.onDemandAllocation || c.ipWaitTimeout > 0 || class == allocationClassHigh
+}
+
+// freeIPs returns the number of IPs that can be assigned to pods right away
+func (c *IPAMContext) freeIPs() int {
+	family := ipV4AddrFamily
+	if !c.enableIPv4 {
+		family = ipV6AddrFamily
+	}
+	stats := c.dataStore.GetIPStats(family)
+	return stats.AvailableAddresses() - stats.CooldownIPs
+}
+
+// assignPodIPOnDemand waits in the wait queue for the pool manager to allocate an IP for the pod. The waiting ADDs are
+// counted, so that the pool manager allocates the IPs of all of them at once.
+func (c *IPAMContext) assignPodIPOnDemand(ctx context.Context, key datastore.IPAMKey, metadata datastore.IPAMMetadata, class string) (string, string, int, error) {
+	waiter := c.ipWaitQueue.add(metadata.K8SPodNamespace, class)
+	defer c.ipWaitQueue.remove(waiter)
+	atomic.AddInt32(&c.onDemandRequests, 1)
+	defer atomic.AddInt32(&c.onDemandRequests, -1)
+	prometheusmetrics.IPWaitRequests.WithLabelValues(class).Inc()
+	defer prometheusmetrics.IPWaitRequests.WithLabelValues(class).Dec()
+	defer func(start time.Time) {
+		prometheusmetrics.IPWaitDuration.WithLabelValues(class).Observe(time.Since(start).Seconds())
+	}(time.Now())
+
+	waitTimeout := onDemandWaitTimeout
+	if c.ipWaitTimeout > 0 {
+		waitTimeout = c.ipWaitTimeout
+	}
+	timeout := time.NewTimer(waitTimeout)
+	defer timeout.Stop()
+	for {
+		// Only the ADDs at the front of the queue take the free IPs
+		if c.ipWaitQueue.position(waiter) < c.freeIPs() {
+			ipv4Addr, ipv6Addr, deviceNumber, err := c.dataStore.AssignPodIPAddress(key, metadata, c.enableIPv4, c.enableIPv6)
+			if !errors.Is(err, datastore.ErrNoAvailableIPs) {
+				return ipv4Addr, ipv6Addr, deviceNumber, err
+			}
+		}
+		c.wakePoolManager()
+		select {
+		case <-ctx.Done():
+			return "", "", -1, ctx.Err()
+		case <-timeout.C:
+			return "", "", -1, errors.Wrapf(errIPWaitTimeout, "waited %v", waitTimeout)
+		case <-time.After(onDemandRetryInterval):
+		}
+	}
+}
+
+// wakePoolManager cuts short the sleep of the pool manager, without blocking when it is already woken up
+func (c *IPAMContext) wakePoolManager() {
+	select {
+	case c.onDemandWakeup <- struct{}{}:
+	default:
+	}
+}
+
+// waitForPoolUpdate sleeps until the next update of the pool. When ADDs may wait for IPs, the sleep ends early once
+// they do, after onDemandBatchWindow to let the rest of the burst arrive.
+func (c *IPAMContext) waitForPoolUpdate(d time.Duration) {
+	if !c.onDemandAllocation && !c.priorityAllocation && c.ipWaitTimeout == 0 {
+		time.Sleep(d)
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.onDemandWakeup:
+		time.Sleep(onDemandBatchWindow)
+	}
+}
+
+// onDemandTargetState returns the number of IPs short of the waiting ADDs, and the number of available IPs beyond them
+func (c *IPAMContext) onDemandTargetState(stats *datastore.DataStoreStats) (short int, over int, enabled bool) {
+	if stats == nil {
+		stats = c.dataStore.GetIPStats(ipV4AddrFamily)
+	}
+	available := stats.AvailableAddresses()
+	waiting := int(atomic.LoadInt32(&c.onDemandRequests))
+	return max(waiting-available, 0), max(available-waiting, 0), true
+}
+
+// inOnDemandBackoff returns whether a recent on-demand allocation failed and the next one has to wait
+func (c *IPAMContext) inOnDemandBackoff() bool {
+	return c.onDemandAllocation && time.Now().Before(c.nextOnDemandAllocation)
+}
+
+// recordOnDemandAllocation backs off exponentially after failed allocations in on-demand mode, so that a burst of
+// waiting pods does not keep calling EC2 while it throttles
+func (c *IPAMContext) recordOnDemandAllocation(err error) {
+	if !c.onDemandAllocation {
+		return
+	}
+	if err == nil {
+		c.onDemandBackoff = 0
+		return
+	}
+	c.onDemandBackoff *= 2
+	if c.onDemandBackoff < minOnDemandBackoff {
+		c.onDemandBackoff = minOnDemandBackoff
+	} else if c.onDemandBackoff > maxOnDemandBackoff {
+		c.onDemandBackoff = maxOnDemandBackoff
+	}
+	c.nextOnDemandAllocation = time.Now().Add(c.onDemandBackoff)
+	log.Warnf("Failed to allocate IPs on demand, retrying in %v: %v", c.onDemandBackoff, err)
+}
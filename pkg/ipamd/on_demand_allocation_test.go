@@ -0,0 +1,147 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestAssignPodIPOnDemand(t *testing.T) {
+	c := &IPAMContext{
+		dataStore:          testDatastore(),
+		enableIPv4:         true,
+		onDemandAllocation: true,
+		onDemandWakeup:     make(chan struct{}, 1),
+	}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+
+	// The pool manager sees the waiting ADD, and allocates its IP
+	go func() {
+		<-c.onDemandWakeup
+		for {
+			short, _, _ := c.datastoreTargetState(nil)
+			if short == 1 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr01), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}()
+
+	ipv4Addr, _, _, err := c.assignPodIPOnDemand(context.Background(), datastore.IPAMKey{ContainerID: "container1"}, datastore.IPAMMetadata{K8SPodName: "pod1"}, allocationClassNormal)
+	assert.NoError(t, err)
+	assert.Equal(t, ipaddr01, ipv4Addr)
+
+	// Nothing waits anymore, and the IP is assigned
+	short, over, enabled := c.datastoreTargetState(nil)
+	assert.Equal(t, 0, short)
+	assert.Equal(t, 0, over)
+	assert.True(t, enabled)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, _, err = c.assignPodIPOnDemand(ctx, datastore.IPAMKey{ContainerID: "container2"}, datastore.IPAMMetadata{K8SPodName: "pod2"}, allocationClassNormal)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestOnDemandTargetState(t *testing.T) {
+	c := &IPAMContext{
+		dataStore:          testDatastore(),
+		maxIPsPerENI:       10,
+		onDemandAllocation: true,
+	}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+	c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr01), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr02), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+
+	// Without waiting ADDs, all the available IPs are over
+	short, over, enabled := c.datastoreTargetState(nil)
+	assert.Equal(t, 0, short)
+	assert.Equal(t, 2, over)
+	assert.True(t, enabled)
+
+	// A burst of 5 ADDs needs 3 more IPs
+	c.onDemandRequests = 5
+	short, over, _ = c.datastoreTargetState(nil)
+	assert.Equal(t, 3, short)
+	assert.Equal(t, 0, over)
+	assert.Equal(t, 3, c.GetENIResourcesToAllocate())
+}
+
+func TestRecordOnDemandAllocation(t *testing.T) {
+	c := &IPAMContext{onDemandAllocation: true}
+	assert.False(t, c.inOnDemandBackoff())
+
+	throttled := errors.New("RequestLimitExceeded")
+	c.recordOnDemandAllocation(throttled)
+	assert.Equal(t, minOnDemandBackoff, c.onDemandBackoff)
+	assert.True(t, c.inOnDemandBackoff())
+	c.recordOnDemandAllocation(throttled)
+	assert.Equal(t, 2*minOnDemandBackoff, c.onDemandBackoff)
+	for i := 0; i < 10; i++ {
+		c.recordOnDemandAllocation(throttled)
+	}
+	assert.Equal(t, maxOnDemandBackoff, c.onDemandBackoff)
+
+	c.recordOnDemandAllocation(nil)
+	assert.Equal(t, time.Duration(0), c.onDemandBackoff)
+
+	// Outside of on-demand mode, failures are retried on the next pool update
+	c = &IPAMContext{}
+	c.recordOnDemandAllocation(throttled)
+	assert.False(t, c.inOnDemandBackoff())
+}
+
+func TestIPWaitTimeoutStatus(t *testing.T) {
+	c := &IPAMContext{}
+	s := &server{ipamContext: c}
+	timeoutErr := pkgerrors.Wrapf(errIPWaitTimeout, "waited %v", onDemandWaitTimeout)
+
+	// No allocation failed, the status has no details
+	st := s.ipWaitTimeoutStatus(timeoutErr)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Empty(t, st.Details())
+
+	c.recordAllocationError(pkgerrors.Wrap(awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil), "failed to allocate a private IP address"))
+	st = s.ipWaitTimeoutStatus(timeoutErr)
+	assert.Equal(t, codes.ResourceExhausted, st.Code())
+	assert.Equal(t, timeoutErr.Error(), st.Message())
+	if assert.Len(t, st.Details(), 1) {
+		info := st.Details()[0].(*errdetails.ErrorInfo)
+		assert.Equal(t, "throttled", info.Reason)
+		assert.Equal(t, allocationErrorDomain, info.Domain)
+		assert.Equal(t, "true", info.Metadata["retryable"])
+	}
+
+	c.recordAllocationError(pkgerrors.Wrap(awserr.New("InsufficientFreeAddressesInSubnet", "", nil), "failed to allocate a private IP address"))
+	allocErr, ok := c.lastAllocationErr()
+	assert.True(t, ok)
+	assert.Equal(t, allocationError{class: "insufficient_subnet_ips"}, allocErr)
+
+	// A successful allocation clears the error
+	c.recordAllocationError(nil)
+	assert.Empty(t, s.ipWaitTimeoutStatus(timeoutErr).Details())
+}
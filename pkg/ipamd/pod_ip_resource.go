@@ -0,0 +1,72 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/podwebhook"
+)
+
+// podIPCapacity returns the number of pods the node can give an IP to. While ipamd can allocate more IPs, it is the
+// maximum number of pods of the node, otherwise only the IPs already in the pool count, including the assigned ones.
+func (c *IPAMContext) podIPCapacity() int64 {
+	capacity := c.maxPods
+	if c.enableIPv6 {
+		// The prefix of the primary ENI has more addresses than pods fit on the node
+		return int64(capacity)
+	}
+
+	c.ipPoolLock.Lock()
+	canGrow := !c.disableENIProvisioning && !c.isTerminating() && !c.dataStore.IsReadOnly() &&
+		c.MaintenanceMode() == "" && !c.inInsufficientCidrCoolingPeriod()
+	c.ipPoolLock.Unlock()
+	if totalIPs := c.dataStore.GetIPStats(ipV4AddrFamily).TotalIPs; !canGrow && totalIPs < capacity {
+		capacity = totalIPs
+	}
+	return int64(capacity)
+}
+
+// updatePodIPResource sets the capacity of the pod IP resource of the node, the kubelet copies it to the allocatable
+// resources the scheduler checks. The pod webhook requests one for every pod that is not on the host network, so that
+// the scheduler stops binding pods to a node whose subnets ran out of IPs instead of leaving them in ContainerCreating.
+func (c *IPAMContext) updatePodIPResource(ctx context.Context) {
+	capacity := *resource.NewQuantity(c.podIPCapacity(), resource.DecimalSI)
+
+	var node corev1.Node
+	if err := c.k8sClient.Get(ctx, types.NamespacedName{Name: c.myNodeName}, &node); err != nil {
+		log.Errorf("Failed to get node while updating the %s resource: %v", podwebhook.PodIPResource, err)
+		return
+	}
+	if current, ok := node.Status.Capacity[podwebhook.PodIPResource]; ok && current.Equal(capacity) {
+		return
+	}
+
+	newNode := node.DeepCopy()
+	if newNode.Status.Capacity == nil {
+		newNode.Status.Capacity = corev1.ResourceList{}
+	}
+	newNode.Status.Capacity[podwebhook.PodIPResource] = capacity
+	if err := c.k8sClient.Status().Patch(ctx, newNode, client.MergeFrom(&node)); err != nil {
+		log.Errorf("Failed to set the %s resource of the node to %s: %v", podwebhook.PodIPResource, capacity.String(), err)
+		ipamdErrInc("updatePodIPResourceFailed")
+		return
+	}
+	log.Infof("Set the %s resource of the node to %s", podwebhook.PodIPResource, capacity.String())
+}
@@ -0,0 +1,74 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/podwebhook"
+)
+
+func TestUpdatePodIPResource(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	ds := datastore.NewDataStore(log, datastore.NullCheckpoint{}, false)
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	for _, ip := range []string{ipaddr01, ipaddr02} {
+		assert.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(32, 32)}, false))
+	}
+	mockContext := &IPAMContext{
+		k8sClient:  m.k8sClient,
+		dataStore:  ds,
+		myNodeName: myNodeName,
+		enableIPv4: true,
+		maxPods:    29,
+	}
+	assert.NoError(t, m.k8sClient.Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: myNodeName}}))
+	capacity := func() string {
+		var node corev1.Node
+		assert.NoError(t, m.k8sClient.Get(ctx, types.NamespacedName{Name: myNodeName}, &node))
+		quantity := node.Status.Capacity[podwebhook.PodIPResource]
+		return quantity.String()
+	}
+
+	// ipamd can still allocate IPs for all the pods of the node
+	mockContext.updatePodIPResource(ctx)
+	assert.Equal(t, "29", capacity())
+
+	// The subnet ran out of IPs, only the IPs in the pool are left
+	mockContext.lastInsufficientCidrError = time.Now()
+	mockContext.updatePodIPResource(ctx)
+	assert.Equal(t, "2", capacity())
+
+	// As in maintenance mode
+	mockContext.lastInsufficientCidrError = time.Time{}
+	mockContext.maintenanceMode = maintenancePause
+	mockContext.updatePodIPResource(ctx)
+	assert.Equal(t, "2", capacity())
+
+	mockContext.maintenanceMode = ""
+	mockContext.enableIPv4, mockContext.enableIPv6 = false, true
+	assert.Equal(t, int64(29), mockContext.podIPCapacity())
+}
@@ -0,0 +1,90 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/net/context"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/podsetup"
+	"github.com/aws/amazon-vpc-cni-k8s/rpc"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// podSetupReportPath is a variable so that tests can use a temporary directory
+var podSetupReportPath = podsetup.DefaultReportPath
+
+// ReportPodSetup records the durations of the phases of a pod network setup that the CNI plugin timed. The plugin of
+// this version leaves its reports in podSetupReportPath instead, this serves the plugin of the previous version during
+// an upgrade.
+func (s *server) ReportPodSetup(ctx context.Context, in *rpc.ReportPodSetupRequest) (*rpc.ReportPodSetupReply, error) {
+	log := requestLogger(ctx)
+	log.Debugf("ReportPodSetupRequest: %s", in)
+
+	if err := s.validateVersion(in.ClientVersion); err != nil {
+		log.Warnf("Rejecting ReportPodSetup request: %v", err)
+		return nil, err
+	}
+	report := podsetup.Report{
+		ContainerID:     in.ContainerID,
+		IfName:          in.IfName,
+		NetworkName:     in.NetworkName,
+		TraceID:         requestTraceID(ctx),
+		DurationSeconds: in.DurationSeconds,
+		Phases:          map[string]float64{},
+	}
+	for _, phase := range in.Phases {
+		report.Phases[phase.Name] += phase.DurationSeconds
+	}
+	recordPodSetup(report)
+	return &rpc.ReportPodSetupReply{Success: true}, nil
+}
+
+// drainPodSetupReports records the reports the plugin left since the last drain. It runs in the background of the
+// ADDs and DELs, so that the reports are picked up by the next request of the plugin without slowing it down.
+func (s *server) drainPodSetupReports() {
+	if !atomic.CompareAndSwapInt32(&s.drainingPodSetupReports, 0, 1) {
+		return
+	}
+	go func() {
+		defer atomic.StoreInt32(&s.drainingPodSetupReports, 0)
+		defer utilruntime.HandleCrash()
+		_, errs := podsetup.DrainReports(podSetupReportPath, recordPodSetup)
+		for _, err := range errs {
+			log.Debugf("Failed to record a pod setup report: %v", err)
+		}
+	}()
+}
+
+// recordPodSetup exports the durations of a pod setup, with its trace ID as exemplar
+func recordPodSetup(report podsetup.Report) {
+	prometheusmetrics.ObserveWithTraceID(prometheusmetrics.PodSetupDuration, report.DurationSeconds, report.TraceID)
+	for phase, seconds := range report.Phases {
+		// ec2_allocate is timed by ipamd
+		if !podsetup.IsPhase(phase) || phase == podsetup.PhaseEC2Allocate {
+			log.Debugf("Ignoring pod setup phase %q", phase)
+			continue
+		}
+		prometheusmetrics.ObserveWithTraceID(prometheusmetrics.PodSetupPhaseDuration.WithLabelValues(phase), seconds,
+			report.TraceID)
+	}
+}
+
+// observePodSetupPhase records the duration of a phase, with the trace ID of the request as exemplar
+func observePodSetupPhase(ctx context.Context, phase string, seconds float64) {
+	prometheusmetrics.ObserveWithTraceID(prometheusmetrics.PodSetupPhaseDuration.WithLabelValues(phase), seconds,
+		requestTraceID(ctx))
+}
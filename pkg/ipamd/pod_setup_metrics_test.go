@@ -0,0 +1,100 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/podsetup"
+	pb "github.com/aws/amazon-vpc-cni-k8s/rpc"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+func TestServer_ReportPodSetup(t *testing.T) {
+	prometheusmetrics.PodSetupPhaseDuration.Reset()
+	s := &server{version: "1.2.3"}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(logger.TraceIDMetadataKey, "0123456789abcdef"))
+
+	resp, err := s.ReportPodSetup(ctx, &pb.ReportPodSetupRequest{
+		ClientVersion:   "1.2.3",
+		ContainerID:     "container-1",
+		DurationSeconds: 0.5,
+		Phases: []*pb.PodSetupPhase{
+			{Name: podsetup.PhaseIpamdWait, DurationSeconds: 0.3},
+			{Name: podsetup.PhaseLinkSetup, DurationSeconds: 0.1},
+			// Not a phase of the plugin, and would add a label value
+			{Name: "unknown", DurationSeconds: 0.1},
+			// Timed by ipamd
+			{Name: podsetup.PhaseEC2Allocate, DurationSeconds: 0.1},
+		},
+	})
+	assert.NoError(t, err)
+	assert.True(t, resp.Success)
+
+	metric := &dto.Metric{}
+	assert.NoError(t, prometheusmetrics.PodSetupPhaseDuration.WithLabelValues(podsetup.PhaseIpamdWait).(prometheus.Metric).Write(metric))
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	var exemplarTraceIDs []string
+	for _, bucket := range metric.GetHistogram().GetBucket() {
+		if exemplar := bucket.GetExemplar(); exemplar != nil {
+			for _, label := range exemplar.GetLabel() {
+				exemplarTraceIDs = append(exemplarTraceIDs, label.GetValue())
+			}
+		}
+	}
+	assert.Equal(t, []string{"0123456789abcdef"}, exemplarTraceIDs)
+
+	// Only the phases of the plugin are recorded
+	assert.Equal(t, 2, testutil.CollectAndCount(prometheusmetrics.PodSetupPhaseDuration))
+}
+
+func TestServer_ReportPodSetupVersionCheck(t *testing.T) {
+	s := &server{version: "1.2.3"}
+	_, err := s.ReportPodSetup(context.Background(), &pb.ReportPodSetupRequest{ClientVersion: "1.2.2"})
+	assert.Error(t, err)
+}
+
+func TestServer_DrainPodSetupReports(t *testing.T) {
+	prometheusmetrics.PodSetupPhaseDuration.Reset()
+	podSetupReportPath = filepath.Join(t.TempDir(), "pod-setup-reports")
+	defer func() { podSetupReportPath = podsetup.DefaultReportPath }()
+	require.NoError(t, podsetup.WriteReport(podSetupReportPath, podsetup.Report{
+		ContainerID:     "container-1",
+		TraceID:         "0123456789abcdef",
+		DurationSeconds: 0.5,
+		Phases:          map[string]float64{podsetup.PhaseLinkSetup: 0.1},
+	}))
+
+	s := &server{}
+	s.drainPodSetupReports()
+	assert.Eventually(t, func() bool {
+		return testutil.CollectAndCount(prometheusmetrics.PodSetupPhaseDuration) == 1
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		entries, err := os.ReadDir(podSetupReportPath)
+		return err == nil && len(entries) == 0
+	}, time.Second, 10*time.Millisecond)
+}
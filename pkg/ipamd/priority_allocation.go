@@ -0,0 +1,71 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// allocationPriorityAnnotation on a pod sets its allocation class to high or normal
+	allocationPriorityAnnotation = "vpc.amazonaws.com/ip-allocation-priority"
+
+	// Pods of the high allocation class get the free IPs ahead of the normal ones, and wait for the pool manager to
+	// allocate one when there is none, even without on-demand allocation
+	allocationClassHigh   = "high"
+	allocationClassNormal = "normal"
+)
+
+// criticalPriorityClasses are the built-in priority classes of the system pods, which are of the high allocation class
+// unless their annotation says otherwise
+var criticalPriorityClasses = map[string]bool{
+	"system-node-critical":    true,
+	"system-cluster-critical": true,
+}
+
+// allocationClass returns the allocation class of a pod, normal when priority allocation is disabled or the pod cannot
+// be found
+func (c *IPAMContext) allocationClass(podName, namespace string) string {
+	if !c.priorityAllocation {
+		return allocationClassNormal
+	}
+	pod, err := c.GetPod(podName, namespace)
+	if err != nil {
+		log.Debugf("Using the normal allocation class for pod %s/%s: %v", namespace, podName, err)
+		return allocationClassNormal
+	}
+	return podAllocationClass(pod)
+}
+
+// podAllocationClass returns the allocation class set by the annotation of the pod. Without it, the pods of a critical
+// priority class and of a DaemonSet, which the node needs whatever runs on it, are of the high class.
+func podAllocationClass(pod *corev1.Pod) string {
+	switch class := pod.Annotations[allocationPriorityAnnotation]; class {
+	case allocationClassHigh, allocationClassNormal:
+		return class
+	case "":
+	default:
+		log.Warnf("Ignoring unknown value %q of the %s annotation of pod %s/%s, expected %s or %s", class,
+			allocationPriorityAnnotation, pod.Namespace, pod.Name, allocationClassHigh, allocationClassNormal)
+	}
+	if criticalPriorityClasses[pod.Spec.PriorityClassName] {
+		return allocationClassHigh
+	}
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return allocationClassHigh
+		}
+	}
+	return allocationClassNormal
+}
@@ -0,0 +1,99 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestPodAllocationClass(t *testing.T) {
+	pod := func(annotation, priorityClass, ownerKind string) *corev1.Pod {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "kube-system"}}
+		if annotation != "" {
+			pod.Annotations = map[string]string{allocationPriorityAnnotation: annotation}
+		}
+		if ownerKind != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: "owner"}}
+		}
+		pod.Spec.PriorityClassName = priorityClass
+		return pod
+	}
+
+	assert.Equal(t, allocationClassNormal, podAllocationClass(pod("", "", "ReplicaSet")))
+	assert.Equal(t, allocationClassHigh, podAllocationClass(pod("high", "", "ReplicaSet")))
+	assert.Equal(t, allocationClassHigh, podAllocationClass(pod("", "system-cluster-critical", "ReplicaSet")))
+	assert.Equal(t, allocationClassHigh, podAllocationClass(pod("", "", "DaemonSet")))
+	assert.Equal(t, allocationClassHigh, podAllocationClass(pod("urgent", "", "DaemonSet")))
+	// The annotation opts critical pods out
+	assert.Equal(t, allocationClassNormal, podAllocationClass(pod("normal", "system-node-critical", "DaemonSet")))
+}
+
+func TestAllocationClassDisabled(t *testing.T) {
+	c := &IPAMContext{}
+	assert.Equal(t, allocationClassNormal, c.allocationClass("coredns", "kube-system"))
+}
+
+func TestAssignPodIPOnDemandPriority(t *testing.T) {
+	c := &IPAMContext{
+		dataStore:          testDatastore(),
+		enableIPv4:         true,
+		priorityAllocation: true,
+		onDemandWakeup:     make(chan struct{}, 1),
+	}
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+	addIP := func(ip string) {
+		c.dataStore.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+
+	type result struct {
+		ip  string
+		err error
+	}
+	assign := func(container, class string) chan result {
+		done := make(chan result, 1)
+		go func() {
+			ip, _, _, err := c.assignPodIPOnDemand(context.Background(), datastore.IPAMKey{ContainerID: container},
+				datastore.IPAMMetadata{K8SPodName: container}, class)
+			done <- result{ip, err}
+		}()
+		return done
+	}
+
+	normal := assign("normal", allocationClassNormal)
+	high := assign("high", allocationClassHigh)
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&c.onDemandRequests) == 2 && c.ipWaitQueue.count(allocationClassHigh) == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// The first IP goes to the high priority ADD, however long the normal one waited
+	addIP(ipaddr01)
+	assert.Equal(t, result{ipaddr01, nil}, <-high)
+	select {
+	case r := <-normal:
+		t.Fatalf("normal ADD was assigned %v before the second IP", r)
+	default:
+	}
+	addIP(ipaddr02)
+	assert.Equal(t, result{ipaddr02, nil}, <-normal)
+}
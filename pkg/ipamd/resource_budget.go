@@ -0,0 +1,242 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"bufio"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+// degradationLevel is how much work ipamd sheds to stay within the memory and CPU limits of its cgroup
+type degradationLevel int32
+
+const (
+	// degradationNone runs everything
+	degradationNone degradationLevel = iota
+	// degradationShedding drops debug logs, the expensive introspection requests, warm IP rebalancing, the usage
+	// attribution export and the sandbox reconcile
+	degradationShedding
+	// degradationCritical also skips the IP pool reconcile, so that only the allocation path and the warm pool remain
+	degradationCritical
+)
+
+const (
+	// resourceBudgetInterval is how often the cgroup usage is checked
+	resourceBudgetInterval = 10 * time.Second
+
+	// Fractions of the cgroup memory limit above which ipamd sheds work. The working set leaves out the inactive page
+	// cache, the kernel reclaims it before the OOM killer runs.
+	memorySheddingFraction = 0.8
+	memoryCriticalFraction = 0.9
+
+	// cpuSheddingFraction is the fraction of CFS periods in which the cgroup was throttled above which ipamd sheds work
+	cpuSheddingFraction = 0.5
+
+	// unlimitedMemory is above any cgroup v1 memory limit that is actually set
+	unlimitedMemory = 1 << 62
+)
+
+// shedIntrospectionPaths are the introspection endpoints that copy the datastore or call the API server. The others
+// answer from a few fields, so that the health and the ADD stats stay available while ipamd sheds work.
+var shedIntrospectionPaths = map[string]bool{
+	"/v1/enis":               true,
+	"/v1/eni-configs":        true,
+	"/v1/datastore-snapshot": true,
+	"/v1/pod-addresses":      true,
+	"/v1/simulate-add":       true,
+}
+
+// cgroupRoot is a variable so that tests can use a temporary directory
+var cgroupRoot = "/sys/fs/cgroup"
+
+// cpuThrottling is the CFS counters of the cgroup at the last check
+type cpuThrottling struct {
+	periods   uint64
+	throttled uint64
+}
+
+// MonitorResourceBudget checks the memory and CPU usage of the cgroup of ipamd, and sheds non-essential work while it
+// runs close to its limits, so that it is not OOM-killed or starved in the middle of an allocation
+func (c *IPAMContext) MonitorResourceBudget() {
+	var last cpuThrottling
+	for {
+		level, current := c.measureDegradation(last)
+		last = current
+		c.setDegradationLevel(level)
+		time.Sleep(resourceBudgetInterval)
+	}
+}
+
+// measureDegradation returns the degradation level for the current cgroup usage, and the CFS counters to compare the
+// next check with
+func (c *IPAMContext) measureDegradation(last cpuThrottling) (degradationLevel, cpuThrottling) {
+	level := degradationNone
+	workingSet, limit, err := readMemoryUsage()
+	if err != nil {
+		log.Debugf("Failed to read the cgroup memory usage: %v", err)
+	} else if limit > 0 {
+		switch used := float64(workingSet) / float64(limit); {
+		case used >= memoryCriticalFraction:
+			level = degradationCritical
+		case used >= memorySheddingFraction:
+			level = degradationShedding
+		}
+	}
+
+	current, err := readCPUThrottling()
+	if err != nil {
+		log.Debugf("Failed to read the cgroup CPU throttling: %v", err)
+		return level, last
+	}
+	if periods := current.periods - last.periods; last.periods > 0 && periods > 0 {
+		throttled := float64(current.throttled-last.throttled) / float64(periods)
+		if throttled >= cpuSheddingFraction && level < degradationShedding {
+			level = degradationShedding
+		}
+	}
+	return level, current
+}
+
+func (c *IPAMContext) setDegradationLevel(level degradationLevel) {
+	previous := degradationLevel(atomic.SwapInt32(&c.degradation, int32(level)))
+	prometheusmetrics.Degraded.Set(float64(level))
+	if level == previous {
+		return
+	}
+	if level > previous {
+		log.Warnf("ipamd is close to its memory or CPU limit, degradation level %d -> %d", previous, level)
+	} else {
+		log.Infof("ipamd is back within its resource budget, degradation level %d -> %d", previous, level)
+	}
+	logger.ShedDebugLogs(level >= degradationShedding)
+	if level == degradationCritical {
+		// Give the memory freed by the dropped work back to the kernel now, rather than at the next GC cycles
+		debug.FreeOSMemory()
+	}
+}
+
+func (c *IPAMContext) degradationLevel() degradationLevel {
+	return degradationLevel(atomic.LoadInt32(&c.degradation))
+}
+
+// shedWhenDegraded rejects the requests to the shedIntrospectionPaths of h while ipamd sheds work
+func (c *IPAMContext) shedWhenDegraded(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if shedIntrospectionPaths[r.URL.Path] && c.degradationLevel() >= degradationShedding {
+			w.Header().Set("Retry-After", strconv.Itoa(int(resourceBudgetInterval.Seconds())))
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// readMemoryUsage returns the working set of the cgroup and its memory limit, 0 if it has none
+func readMemoryUsage() (workingSet, limit uint64, err error) {
+	// cgroup v2
+	if usage, err := readUintFile(filepath.Join(cgroupRoot, "memory.current")); err == nil {
+		max, err := os.ReadFile(filepath.Join(cgroupRoot, "memory.max"))
+		if err != nil {
+			return 0, 0, err
+		}
+		if s := strings.TrimSpace(string(max)); s != "max" {
+			if limit, err = strconv.ParseUint(s, 10, 64); err != nil {
+				return 0, 0, err
+			}
+		}
+		stat, err := readStatFile(filepath.Join(cgroupRoot, "memory.stat"))
+		if err != nil {
+			return 0, 0, err
+		}
+		return subtractFloor(usage, stat["inactive_file"]), limit, nil
+	}
+
+	// cgroup v1
+	usage, err := readUintFile(filepath.Join(cgroupRoot, "memory", "memory.usage_in_bytes"))
+	if err != nil {
+		return 0, 0, err
+	}
+	if limit, err = readUintFile(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes")); err != nil {
+		return 0, 0, err
+	}
+	if limit >= unlimitedMemory {
+		limit = 0
+	}
+	stat, err := readStatFile(filepath.Join(cgroupRoot, "memory", "memory.stat"))
+	if err != nil {
+		return 0, 0, err
+	}
+	return subtractFloor(usage, stat["total_inactive_file"]), limit, nil
+}
+
+// readCPUThrottling returns the CFS counters of the cgroup
+func readCPUThrottling() (cpuThrottling, error) {
+	stat, err := readStatFile(filepath.Join(cgroupRoot, "cpu.stat"))
+	if os.IsNotExist(errors.Cause(err)) {
+		stat, err = readStatFile(filepath.Join(cgroupRoot, "cpu", "cpu.stat"))
+	}
+	if err != nil {
+		return cpuThrottling{}, err
+	}
+	return cpuThrottling{periods: stat["nr_periods"], throttled: stat["nr_throttled"]}, nil
+}
+
+func readUintFile(path string) (uint64, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimSpace(string(content)), 10, 64)
+}
+
+// readStatFile reads a cgroup file of "key value" lines
+func readStatFile(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", path)
+	}
+	defer f.Close()
+
+	stat := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if value, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			stat[fields[0]] = value
+		}
+	}
+	return stat, scanner.Err()
+}
+
+func subtractFloor(a, b uint64) uint64 {
+	if b > a {
+		return 0
+	}
+	return a - b
+}
@@ -0,0 +1,108 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeCgroupFile(t *testing.T, name, content string) {
+	path := filepath.Join(cgroupRoot, name)
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestMeasureDegradationCgroupV2(t *testing.T) {
+	cgroupRoot = t.TempDir()
+	defer func() { cgroupRoot = "/sys/fs/cgroup" }()
+
+	c := &IPAMContext{}
+	writeCgroupFile(t, "memory.max", "1000\n")
+	writeCgroupFile(t, "memory.stat", "anon 500\ninactive_file 200\n")
+	writeCgroupFile(t, "cpu.stat", "usage_usec 100\nnr_periods 100\nnr_throttled 10\n")
+
+	// The inactive page cache does not count
+	writeCgroupFile(t, "memory.current", "900\n")
+	level, last := c.measureDegradation(cpuThrottling{})
+	assert.Equal(t, degradationNone, level)
+	assert.Equal(t, cpuThrottling{periods: 100, throttled: 10}, last)
+
+	writeCgroupFile(t, "memory.current", "1050\n")
+	level, _ = c.measureDegradation(last)
+	assert.Equal(t, degradationShedding, level)
+
+	writeCgroupFile(t, "memory.current", "1150\n")
+	level, _ = c.measureDegradation(last)
+	assert.Equal(t, degradationCritical, level)
+
+	// Throttled in more than half of the periods since the last check
+	writeCgroupFile(t, "memory.current", "900\n")
+	writeCgroupFile(t, "cpu.stat", "nr_periods 200\nnr_throttled 70\n")
+	level, _ = c.measureDegradation(last)
+	assert.Equal(t, degradationShedding, level)
+
+	// No memory limit
+	writeCgroupFile(t, "memory.max", "max\n")
+	writeCgroupFile(t, "memory.current", "1150\n")
+	level, _ = c.measureDegradation(cpuThrottling{})
+	assert.Equal(t, degradationNone, level)
+}
+
+func TestMeasureDegradationCgroupV1(t *testing.T) {
+	cgroupRoot = t.TempDir()
+	defer func() { cgroupRoot = "/sys/fs/cgroup" }()
+
+	c := &IPAMContext{}
+	writeCgroupFile(t, "memory/memory.usage_in_bytes", "950\n")
+	writeCgroupFile(t, "memory/memory.limit_in_bytes", "1000\n")
+	writeCgroupFile(t, "memory/memory.stat", "total_inactive_file 100\n")
+	writeCgroupFile(t, "cpu/cpu.stat", "nr_periods 100\nnr_throttled 0\n")
+	level, last := c.measureDegradation(cpuThrottling{})
+	assert.Equal(t, degradationShedding, level)
+	assert.Equal(t, cpuThrottling{periods: 100}, last)
+
+	writeCgroupFile(t, "memory/memory.limit_in_bytes", "9223372036854771712\n")
+	level, _ = c.measureDegradation(last)
+	assert.Equal(t, degradationNone, level)
+}
+
+func TestShedWhenDegraded(t *testing.T) {
+	c := &IPAMContext{}
+	handler := c.shedWhenDegraded(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/enis", nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	c.setDegradationLevel(degradationShedding)
+	defer c.setDegradationLevel(degradationNone)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/v1/enis", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Equal(t, "10", rr.Header().Get("Retry-After"))
+
+	// The cheap endpoints are still served
+	for _, path := range []string{"/", "/v1/cni-add-stats", "/v1/maintenance"} {
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, http.StatusOK, rr.Code, path)
+	}
+}
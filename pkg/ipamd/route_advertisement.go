@@ -0,0 +1,160 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/frr"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+const (
+	// envRouteAdvertisementConfig is the path of the FRR configuration, frr.DefaultPath by default
+	envRouteAdvertisementConfig = "ROUTE_ADVERTISEMENT_FRR_CONFIG"
+
+	// envRouteAdvertisementReloadCommand is run each time the configuration changes, for FRR to load it. Without it,
+	// FRR has to watch the file.
+	envRouteAdvertisementReloadCommand = "ROUTE_ADVERTISEMENT_RELOAD_COMMAND"
+
+	routeAdvertisementInterval = 30 * time.Second
+
+	routeAdvertisementReloadTimeout = 30 * time.Second
+)
+
+// routeAdvertiser keeps the FRR configuration in line with the pod CIDRs of the datastore
+type routeAdvertiser struct {
+	config frr.Config
+	path   string
+	reload []string
+	// reloadPending is set when the configuration changed and FRR did not load it yet
+	reloadPending bool
+}
+
+// MonitorRouteAdvertisement advertises the pod CIDRs of the node to BGP routers, when a route advertisement of the
+// CNIConfig matches the node. It returns right away otherwise.
+func (c *IPAMContext) MonitorRouteAdvertisement() {
+	config, ok := c.routeAdvertisement(context.TODO(), c.myNodeName)
+	if !ok {
+		return
+	}
+	a := &routeAdvertiser{
+		config: config,
+		path:   os.Getenv(envRouteAdvertisementConfig),
+		reload: strings.Fields(os.Getenv(envRouteAdvertisementReloadCommand)),
+	}
+	if a.path == "" {
+		a.path = frr.DefaultPath
+	}
+	for {
+		c.advertisePodCIDRs(a)
+		time.Sleep(routeAdvertisementInterval)
+	}
+}
+
+// advertisePodCIDRs writes the pod CIDRs of the datastore to the FRR configuration, and reloads FRR when they changed
+func (c *IPAMContext) advertisePodCIDRs(a *routeAdvertiser) {
+	a.config.Prefixes = c.podCIDRs()
+	changed, err := frr.WriteConfig(a.path, a.config)
+	if err != nil {
+		log.Warnf("Failed to write the route advertisement configuration: %v", err)
+		return
+	}
+	prometheusmetrics.AdvertisedPodPrefixes.Set(float64(len(a.config.Prefixes)))
+	if changed {
+		log.Infof("Advertising %d pod CIDRs to %d BGP peers", len(a.config.Prefixes), len(a.config.Peers))
+		a.reloadPending = len(a.reload) > 0
+	}
+	if !a.reloadPending {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), routeAdvertisementReloadTimeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, a.reload[0], a.reload[1:]...).CombinedOutput(); err != nil {
+		log.Warnf("Failed to reload FRR with %q, retrying in %v: %v: %s", strings.Join(a.reload, " "),
+			routeAdvertisementInterval, err, out)
+		return
+	}
+	a.reloadPending = false
+}
+
+// podCIDRs returns the secondary IPs and prefixes of the ENIs, sorted. The warm ones are advertised too, so that the
+// routes do not change with each pod.
+func (c *IPAMContext) podCIDRs() []string {
+	var cidrs []string
+	for _, eni := range c.dataStore.GetENIInfos().ENIs {
+		cidrInfos := eni.AvailableIPv4Cidrs
+		if c.enableIPv6 {
+			cidrInfos = eni.IPv6Cidrs
+		}
+		for _, cidrInfo := range cidrInfos {
+			cidrs = append(cidrs, cidrInfo.Cidr.String())
+		}
+	}
+	sort.Strings(cidrs)
+	return cidrs
+}
+
+// routeAdvertisement returns the BGP speaker of the first route advertisement of the CNIConfig that matches the labels
+// of the node
+func (c *IPAMContext) routeAdvertisement(ctx context.Context, nodeName string) (frr.Config, bool) {
+	cfg, ok := c.getCNIConfig(ctx)
+	if !ok || len(cfg.Spec.RouteAdvertisements) == 0 {
+		return frr.Config{}, false
+	}
+	nodeLabels, err := c.nodeSelectorLabels(ctx, nodeName)
+	if err != nil {
+		log.Warnf("Failed to get node %s, not advertising the pod CIDRs: %v", nodeName, err)
+		return frr.Config{}, false
+	}
+
+	for i, advertisement := range cfg.Spec.RouteAdvertisements {
+		selector, err := metav1.LabelSelectorAsSelector(&advertisement.NodeSelector)
+		if err != nil {
+			log.Warnf("Ignoring route advertisement %d of CNIConfig %s: %v", i, cfg.Name, err)
+			continue
+		}
+		if !selector.Matches(nodeLabels) {
+			continue
+		}
+		config := frr.Config{
+			ASN:      advertisement.ASN,
+			RouterID: c.awsClient.GetLocalIPv4().String(),
+			IPv6:     c.enableIPv6,
+		}
+		for _, peer := range advertisement.Peers {
+			config.Peers = append(config.Peers, frr.Peer{
+				Address:      peer.Address,
+				ASN:          peer.ASN,
+				BFD:          peer.BFD,
+				EBGPMultihop: peer.EBGPMultihop,
+			})
+		}
+		// The first matching advertisement applies even when invalid, the next ones are meant for other nodes
+		if err := config.Validate(); err != nil {
+			log.Errorf("Not advertising the pod CIDRs, route advertisement %d of CNIConfig %s is invalid: %v", i, cfg.Name, err)
+			return frr.Config{}, false
+		}
+		log.Infof("Using route advertisement %d (%s) of CNIConfig %s", i, selector.String(), cfg.Name)
+		return config, true
+	}
+	return frr.Config{}, false
+}
@@ -0,0 +1,108 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/frr"
+)
+
+func TestRouteAdvertisement(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	m.awsutils.EXPECT().GetInstanceType().Return("c6i.large").AnyTimes()
+	m.awsutils.EXPECT().GetLocalIPv4().Return(net.ParseIP("10.0.0.10")).AnyTimes()
+	c := &IPAMContext{awsClient: m.awsutils, k8sClient: m.k8sClient}
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: myNodeName, Labels: map[string]string{
+		"eks.amazonaws.com/nodegroup": "hybrid",
+	}}}
+	assert.NoError(t, m.k8sClient.Create(ctx, node))
+
+	// Without a CNIConfig, nothing is advertised
+	_, ok := c.routeAdvertisement(ctx, myNodeName)
+	assert.False(t, ok)
+
+	cfg := &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec: v1alpha1.CNIConfigSpec{RouteAdvertisements: []v1alpha1.RouteAdvertisement{
+			{
+				NodeSelector: metav1.LabelSelector{MatchLabels: map[string]string{"eks.amazonaws.com/nodegroup": "other"}},
+				ASN:          64513,
+				Peers:        []v1alpha1.BGPPeer{{Address: "192.168.0.2", ASN: 65000}},
+			},
+			{
+				NodeSelector: metav1.LabelSelector{MatchLabels: map[string]string{"eks.amazonaws.com/nodegroup": "hybrid"}},
+				ASN:          64512,
+				Peers:        []v1alpha1.BGPPeer{{Address: "192.168.0.1", ASN: 65000, BFD: true, EBGPMultihop: 4}},
+			},
+		}},
+	}
+	assert.NoError(t, m.k8sClient.Create(ctx, cfg))
+
+	config, ok := c.routeAdvertisement(ctx, myNodeName)
+	assert.True(t, ok)
+	assert.Equal(t, frr.Config{
+		ASN:      64512,
+		RouterID: "10.0.0.10",
+		Peers:    []frr.Peer{{Address: "192.168.0.1", ASN: 65000, BFD: true, EBGPMultihop: 4}},
+	}, config)
+
+	// An invalid advertisement is not replaced by a later one
+	cfg.Spec.RouteAdvertisements[1].Peers[0].Address = "router"
+	cfg.Spec.RouteAdvertisements = append(cfg.Spec.RouteAdvertisements, v1alpha1.RouteAdvertisement{ASN: 64514,
+		Peers: []v1alpha1.BGPPeer{{Address: "192.168.0.3", ASN: 65000}}})
+	assert.NoError(t, m.k8sClient.Update(ctx, cfg))
+	_, ok = c.routeAdvertisement(ctx, myNodeName)
+	assert.False(t, ok)
+}
+
+func TestAdvertisePodCIDRs(t *testing.T) {
+	ds := testDatastore()
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP("10.0.0.42"), Mask: net.CIDRMask(32, 32)}, false))
+	assert.NoError(t, ds.AddENI(secENIid, secDevice, false, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP("10.0.0.16"), Mask: net.CIDRMask(28, 32)}, true))
+	c := &IPAMContext{dataStore: ds}
+
+	a := &routeAdvertiser{
+		config: frr.Config{ASN: 64512, RouterID: "10.0.0.10", Peers: []frr.Peer{{Address: "192.168.0.1", ASN: 65000}}},
+		path:   filepath.Join(t.TempDir(), "bgpd.conf"),
+		reload: []string{"false"},
+	}
+	c.advertisePodCIDRs(a)
+	assert.Equal(t, []string{"10.0.0.16/28", "10.0.0.42/32"}, a.config.Prefixes)
+	data, err := os.ReadFile(a.path)
+	assert.NoError(t, err)
+	assert.Equal(t, a.config.Render(), string(data))
+
+	// The reload is retried until it succeeds, even though the configuration does not change anymore
+	assert.True(t, a.reloadPending)
+	a.reload = []string{"true"}
+	c.advertisePodCIDRs(a)
+	assert.False(t, a.reloadPending)
+	c.advertisePodCIDRs(a)
+	assert.False(t, a.reloadPending)
+}
@@ -0,0 +1,84 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+const (
+	// envExcludeSNATRouteTargets lists the types of route targets, by resource ID prefix, whose RFC1918 destinations in
+	// the route table of the subnet are excluded from SNAT, e.g. "tgw,pcx". The networks on the other side of a transit
+	// gateway or a peering connection then see the IP of the pods instead of the IP of the node. Empty by default, which
+	// only excludes AWS_VPC_K8S_CNI_EXCLUDE_SNAT_CIDRS.
+	envExcludeSNATRouteTargets = "AWS_VPC_K8S_CNI_EXCLUDE_SNAT_ROUTE_TARGETS"
+
+	// routedSNATExclusionsRefreshInterval is how often the route table is described again, it changes much less often
+	// than the VPC CIDRs are checked
+	routedSNATExclusionsRefreshInterval = 5 * time.Minute
+)
+
+var supportedSNATRouteTargets = []string{
+	awsutils.RouteTargetTransitGateway, awsutils.RouteTargetVPCPeering, awsutils.RouteTargetVirtualPrivateGateway,
+}
+
+func excludeSNATRouteTargets() []string {
+	var targets []string
+	for _, target := range strings.Split(os.Getenv(envExcludeSNATRouteTargets), ",") {
+		target = strings.ToLower(strings.TrimSpace(target))
+		if target == "" {
+			continue
+		}
+		if !sets.NewString(supportedSNATRouteTargets...).Has(target) {
+			log.Warnf("Ignoring route target %q of %s, supported targets: %s", target, envExcludeSNATRouteTargets,
+				strings.Join(supportedSNATRouteTargets, ", "))
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// refreshRoutedSNATExclusions learns the private destinations that the subnet routes to the configured targets, at most
+// once per refresh interval, and hands them to the network client. It returns true when they changed, the host
+// iptables rules then have to be updated. The previous CIDRs are kept when the route table can not be described.
+func (c *IPAMContext) refreshRoutedSNATExclusions(ctx context.Context) bool {
+	targets := excludeSNATRouteTargets()
+	if len(targets) == 0 || !c.enableIPv4 || c.networkClient.UseExternalSNAT() {
+		return false
+	}
+	if time.Since(c.routedSNATExclusionsRefreshed) < routedSNATExclusionsRefreshInterval {
+		return false
+	}
+	cidrs, err := c.awsClient.GetRoutedPrivateIPv4CIDRs(ctx, targets)
+	if err != nil {
+		log.Warnf("Unable to learn the CIDRs routed to %s to exclude from SNAT: %v", strings.Join(targets, ", "), err)
+		return false
+	}
+	c.routedSNATExclusionsRefreshed = time.Now()
+	if sets.NewString(cidrs...).Equal(sets.NewString(c.routedExcludeSNATCIDRs...)) {
+		return false
+	}
+	log.Infof("Excluding the CIDRs routed to %s from SNAT: %v", strings.Join(targets, ", "), cidrs)
+	c.routedExcludeSNATCIDRs = cidrs
+	c.networkClient.SetRoutedExcludeSNATCIDRs(cidrs)
+	return true
+}
@@ -0,0 +1,77 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+func TestExcludeSNATRouteTargets(t *testing.T) {
+	assert.Empty(t, excludeSNATRouteTargets())
+	t.Setenv(envExcludeSNATRouteTargets, "TGW, pcx,igw,")
+	assert.Equal(t, []string{awsutils.RouteTargetTransitGateway, awsutils.RouteTargetVPCPeering}, excludeSNATRouteTargets())
+}
+
+func TestUpdateCIDRsRulesOnRoutedSNATExclusionsChange(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.TODO()
+	c := &IPAMContext{awsClient: m.awsutils, networkClient: m.network, enableIPv4: true}
+
+	vpcCIDRs := []string{"10.0.0.0/16"}
+	primaryIP := net.ParseIP("10.0.0.10")
+	m.awsutils.EXPECT().GetVPCIPv4CIDRs().Return(vpcCIDRs, nil).AnyTimes()
+	m.awsutils.EXPECT().GetLocalIPv4().Return(primaryIP).AnyTimes()
+	m.awsutils.EXPECT().GetPrimaryENImac().Return("02:00:00:00:00:01").AnyTimes()
+	m.network.EXPECT().UseExternalSNAT().Return(false).AnyTimes()
+
+	// Nothing is learned without route targets
+	assert.Equal(t, vpcCIDRs, c.updateCIDRsRulesOnChange(vpcCIDRs))
+
+	t.Setenv(envExcludeSNATRouteTargets, "tgw,pcx")
+	targets := []string{awsutils.RouteTargetTransitGateway, awsutils.RouteTargetVPCPeering}
+	routed := []string{"10.1.0.0/16", "192.168.0.0/16"}
+	m.awsutils.EXPECT().GetRoutedPrivateIPv4CIDRs(ctx, targets).Return(routed, nil)
+	m.network.EXPECT().SetRoutedExcludeSNATCIDRs(routed)
+	m.network.EXPECT().UpdateHostIptablesRules(vpcCIDRs, "02:00:00:00:00:01", &primaryIP, true, false).Return(nil)
+	assert.Equal(t, vpcCIDRs, c.updateCIDRsRulesOnChange(vpcCIDRs))
+	assert.Equal(t, routed, c.routedExcludeSNATCIDRs)
+
+	// The route table is only described again after the refresh interval
+	assert.Equal(t, vpcCIDRs, c.updateCIDRsRulesOnChange(vpcCIDRs))
+
+	// Nothing is updated when the routes did not change, nor when they can not be described
+	c.routedSNATExclusionsRefreshed = time.Now().Add(-routedSNATExclusionsRefreshInterval)
+	m.awsutils.EXPECT().GetRoutedPrivateIPv4CIDRs(ctx, targets).Return([]string{"192.168.0.0/16", "10.1.0.0/16"}, nil)
+	assert.Equal(t, vpcCIDRs, c.updateCIDRsRulesOnChange(vpcCIDRs))
+	c.routedSNATExclusionsRefreshed = time.Now().Add(-routedSNATExclusionsRefreshInterval)
+	m.awsutils.EXPECT().GetRoutedPrivateIPv4CIDRs(ctx, targets).Return(nil, errors.New("UnauthorizedOperation"))
+	assert.Equal(t, vpcCIDRs, c.updateCIDRsRulesOnChange(vpcCIDRs))
+	assert.Equal(t, routed, c.routedExcludeSNATCIDRs)
+
+	// The routes that are gone are SNATed again
+	m.awsutils.EXPECT().GetRoutedPrivateIPv4CIDRs(ctx, targets).Return(nil, nil)
+	m.network.EXPECT().SetRoutedExcludeSNATCIDRs(gomock.Nil())
+	m.network.EXPECT().UpdateHostIptablesRules(vpcCIDRs, "02:00:00:00:00:01", &primaryIP, true, false).Return(nil)
+	assert.Equal(t, vpcCIDRs, c.updateCIDRsRulesOnChange(vpcCIDRs))
+}
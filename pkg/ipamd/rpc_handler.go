@@ -18,24 +18,30 @@ import (
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"golang.org/x/net/context"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health"
 	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
 	"github.com/aws/amazon-vpc-cni-k8s/rpc"
 	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
 	k8serror "k8s.io/apimachinery/pkg/api/errors"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 )
 
 const (
@@ -43,12 +49,27 @@ const (
 	grpcHealthServiceName = "grpc.health.v1.aws-node"
 
 	vpccniPodIPKey = "vpc.amazonaws.com/pod-ips"
+
+	// envPreviousPluginVersion is set by the aws-node entrypoint during a canary rollout of the CNI plugin, so that
+	// the previously installed plugin binary is still served if the canary is rolled back
+	envPreviousPluginVersion = "AWS_VPC_K8S_CNI_PREVIOUS_PLUGIN_VERSION"
+
+	// setupNSFailedReason is the DelNetwork reason sent by the CNI plugin when it fails to set up a pod after ADD
+	setupNSFailedReason = "SetupNSFailed"
+
+	// allocationErrorDomain is the domain of the error details of the ADDs that timed out waiting for an IP
+	allocationErrorDomain = "ipamd.vpc-cni.amazonaws.com"
 )
 
+var rpcLog = logger.GetComponent("rpc")
+
 // server controls RPC service responses.
 type server struct {
-	version     string
-	ipamContext *IPAMContext
+	version         string
+	previousVersion string
+	ipamContext     *IPAMContext
+
+	drainingPodSetupReports int32 // drainingPodSetupReports is 1 while the pod setup reports are drained
 }
 
 // PodENIData is used to parse the list of ENIs in the branch ENI pod annotation
@@ -62,18 +83,44 @@ type PodENIData struct {
 	SubnetV6CIDR string `json:"subnetV6Cidr"`
 }
 
+// requestTraceID returns the trace ID sent by the CNI plugin, empty if there is none
+func requestTraceID(ctx context.Context) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if traceIDs := md.Get(logger.TraceIDMetadataKey); len(traceIDs) > 0 {
+			return traceIDs[0]
+		}
+	}
+	return ""
+}
+
+// requestLogger returns the rpc logger, tagged with the trace ID sent by the CNI plugin if there is one
+func requestLogger(ctx context.Context) logger.Logger {
+	if traceID := requestTraceID(ctx); traceID != "" {
+		return rpcLog.WithFields(logger.Fields{logger.TraceIDKey: traceID})
+	}
+	return rpcLog
+}
+
 // AddNetwork processes CNI add network request and return an IP address for container
 func (s *server) AddNetwork(ctx context.Context, in *rpc.AddNetworkRequest) (*rpc.AddNetworkReply, error) {
+	log := requestLogger(ctx)
 	log.Infof("Received AddNetwork for NS %s, Sandbox %s, ifname %s",
 		in.Netns, in.ContainerID, in.IfName)
 	log.Debugf("AddNetworkRequest: %s", in)
 	prometheusmetrics.AddIPCnt.Inc()
+	// The plugin leaves the timing of the pod setups it finished for ipamd to pick up
+	s.drainPodSetupReports()
 
 	// Do this early, but after logging trace
 	if err := s.validateVersion(in.ClientVersion); err != nil {
 		log.Warnf("Rejecting AddNetwork request: %v", err)
 		return nil, err
 	}
+	// The next ipamd instance sets the pod up once the kubelet retries
+	if s.ipamContext.isTerminating() {
+		log.Warn("Rejecting AddNetwork request: ipamd is shutting down")
+		return nil, status.Error(codes.Unavailable, "ipamd is shutting down")
+	}
 
 	failureResponse := rpc.AddNetworkReply{Success: false}
 	var deviceNumber, vlanID, trunkENILinkIndex int
@@ -86,6 +133,10 @@ func (s *server) AddNetwork(ctx context.Context, in *rpc.AddNetworkRequest) (*rp
 			log.Warnf("Send AddNetworkReply: Failed to get pod: %v", err)
 			return &failureResponse, nil
 		}
+		if in.K8S_POD_UID != "" && string(pod.UID) != in.K8S_POD_UID {
+			log.Warnf("Send AddNetworkReply: pod UID %s does not match requested UID %s", pod.UID, in.K8S_POD_UID)
+			return &failureResponse, nil
+		}
 		limits := pod.Spec.Containers[0].Resources.Limits
 		for resName := range limits {
 			if strings.HasPrefix(string(resName), "vpc.amazonaws.com/pod-eni") {
@@ -100,7 +151,7 @@ func (s *server) AddNetwork(ctx context.Context, in *rpc.AddNetworkRequest) (*rp
 					log.Warn("Send AddNetworkReply: No trunk ENI Link Index found, cannot add a pod ENI")
 					return &failureResponse, nil
 				}
-				val, branch := pod.Annotations["vpc.amazonaws.com/pod-eni"]
+				val, branch := pod.Annotations[podENIAnnotation]
 				if branch {
 					// Parse JSON data
 					var podENIData []PodENIData
@@ -170,8 +221,15 @@ func (s *server) AddNetwork(ctx context.Context, in *rpc.AddNetworkRequest) (*rp
 		ipamMetadata := datastore.IPAMMetadata{
 			K8SPodNamespace: in.K8S_POD_NAMESPACE,
 			K8SPodName:      in.K8S_POD_NAME,
+			K8SPodUID:       in.K8S_POD_UID,
+		}
+		class := s.ipamContext.allocationClass(in.K8S_POD_NAME, in.K8S_POD_NAMESPACE)
+		ipv4Addr, ipv6Addr, deviceNumber, err = s.ipamContext.assignPodIP(ctx, ipamKey, ipamMetadata, class)
+		// The CNI plugin tells the kubelet to retry the sandbox later
+		if errors.Is(err, errIPWaitTimeout) {
+			log.Warnf("Send AddNetworkReply: %v", err)
+			return nil, s.ipWaitTimeoutStatus(err).Err()
 		}
-		ipv4Addr, ipv6Addr, deviceNumber, err = s.ipamContext.dataStore.AssignPodIPAddress(ipamKey, ipamMetadata, s.ipamContext.enableIPv4, s.ipamContext.enableIPv6)
 	}
 
 	var pbVPCV4cidrs, pbVPCV6cidrs []string
@@ -215,6 +273,15 @@ func (s *server) AddNetwork(ctx context.Context, in *rpc.AddNetworkRequest) (*rp
 			}
 		}
 	}
+
+	// Branch ENIs are in the subnets of the trunk, carrier IPs are only associated with the IPs of the node ENIs
+	if s.ipamContext.enablePodCarrierIP && err == nil && ipv4Addr != "" && vlanID == 0 {
+		err = s.ipamContext.setupCarrierIP(ctx, in.K8S_POD_NAME, in.K8S_POD_NAMESPACE, ipv4Addr, deviceNumber)
+		if err != nil {
+			log.Errorf("Failed to set up the carrier IP of the pod: %v", err)
+		}
+	}
+
 	resp := rpc.AddNetworkReply{
 		Success:           err == nil,
 		IPv4Addr:          ipv4Addr,
@@ -230,21 +297,55 @@ func (s *server) AddNetwork(ctx context.Context, in *rpc.AddNetworkRequest) (*rp
 		NetworkPolicyMode: s.ipamContext.networkPolicyMode,
 	}
 
+	if err == nil {
+		atomic.AddInt64(&s.ipamContext.cniAddSucceeded, 1)
+		if in.ClientVersion == s.version {
+			atomic.AddInt64(&s.ipamContext.cniAddSucceededCurrent, 1)
+		}
+	}
 	log.Infof("Send AddNetworkReply: IPv4Addr: %s, IPv6Addr: %s, DeviceNumber: %d, err: %v", ipv4Addr, ipv6Addr, deviceNumber, err)
 	return &resp, nil
 }
 
+// ipWaitTimeoutStatus tells the CNI plugin that no IP was allocated in time, with the class of the error of the last
+// failed pool allocation as details
+func (s *server) ipWaitTimeoutStatus(err error) *status.Status {
+	st := status.New(codes.ResourceExhausted, err.Error())
+	allocErr, ok := s.ipamContext.lastAllocationErr()
+	if !ok {
+		return st
+	}
+	detailed, detailsErr := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   allocErr.class,
+		Domain:   allocationErrorDomain,
+		Metadata: map[string]string{"retryable": strconv.FormatBool(allocErr.retryable)},
+	})
+	if detailsErr != nil {
+		log.Warnf("Failed to add the details of the allocation error: %v", detailsErr)
+		return st
+	}
+	return detailed
+}
+
 func (s *server) validateVersion(clientVersion string) error {
-	if s.version != clientVersion {
+	if s.version != clientVersion && (s.previousVersion == "" || s.previousVersion != clientVersion) {
 		return status.Errorf(codes.FailedPrecondition, "wrong client version %q (!= %q)", clientVersion, s.version)
 	}
 	return nil
 }
 
 func (s *server) DelNetwork(ctx context.Context, in *rpc.DelNetworkRequest) (*rpc.DelNetworkReply, error) {
+	log := requestLogger(ctx)
 	log.Infof("Received DelNetwork for Sandbox %s", in.ContainerID)
 	log.Debugf("DelNetworkRequest: %s", in)
 	prometheusmetrics.DelIPCnt.With(prometheus.Labels{"reason": in.Reason}).Inc()
+	s.drainPodSetupReports()
+	if in.Reason == setupNSFailedReason {
+		atomic.AddInt64(&s.ipamContext.cniAddFailed, 1)
+		if in.ClientVersion == s.version {
+			atomic.AddInt64(&s.ipamContext.cniAddFailedCurrent, 1)
+		}
+	}
 	var ipv4Addr, ipv6Addr, cidrStr string
 
 	// Do this early, but after logging trace
@@ -252,13 +353,15 @@ func (s *server) DelNetwork(ctx context.Context, in *rpc.DelNetworkRequest) (*rp
 		log.Warnf("Rejecting DelNetwork request: %v", err)
 		return nil, err
 	}
+	// The pod may have claimed a leased IP that ipamd did not confirm yet
+	s.ipamContext.cancelIPLeases(in.ContainerID)
 
 	ipamKey := datastore.IPAMKey{
 		ContainerID: in.ContainerID,
 		IfName:      in.IfName,
 		NetworkName: in.NetworkName,
 	}
-	eni, ip, deviceNumber, err := s.ipamContext.dataStore.UnassignPodIPAddress(ipamKey)
+	eni, ip, deviceNumber, err := s.ipamContext.unassignPodIPAddress(ipamKey, in.K8S_POD_UID)
 	if s.ipamContext.enableIPv4 {
 		ipv4Addr = ip
 		cidr := net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}
@@ -292,7 +395,12 @@ func (s *server) DelNetwork(ctx context.Context, in *rpc.DelNetworkRequest) (*rp
 			log.Warnf("Send DelNetworkReply: Failed to get pod spec: %v", err)
 			return &rpc.DelNetworkReply{Success: false}, err
 		}
-		val, branch := pod.Annotations["vpc.amazonaws.com/pod-eni"]
+		// A pod with the same name and namespace may have replaced the one being deleted; its branch ENI must be left alone
+		if in.K8S_POD_UID != "" && string(pod.UID) != in.K8S_POD_UID {
+			log.Warnf("Send DelNetworkReply: pod UID %s does not match requested UID %s", pod.UID, in.K8S_POD_UID)
+			return &rpc.DelNetworkReply{Success: true}, nil
+		}
+		val, branch := pod.Annotations[podENIAnnotation]
 		if branch {
 			// Parse JSON data
 			var podENIData []PodENIData
@@ -328,8 +436,15 @@ func (c *IPAMContext) RunRPCHandler(version string) error {
 		log.Errorf("Failed to listen gRPC port: %v", err)
 		return errors.Wrap(err, "ipamd: failed to listen to gRPC port")
 	}
-	grpcServer := grpc.NewServer()
-	rpc.RegisterCNIBackendServer(grpcServer, &server{version: version, ipamContext: c})
+	grpcServer := grpc.NewServer(grpc.UnaryInterceptor(handleRPCCrashes))
+	previousVersion := os.Getenv(envPreviousPluginVersion)
+	if previousVersion != "" {
+		log.Infof("Also accepting RPC requests from previous plugin version %s", previousVersion)
+	}
+	s := &server{version: version, previousVersion: previousVersion, ipamContext: c}
+	rpc.RegisterCNIBackendServer(grpcServer, s)
+	// The plugin spools its DELs while the listener is down, and queues them on it once it is up
+	s.drainDelSpool()
 	healthServer := health.NewServer()
 	// If ipamd can talk to the API server and to the EC2 API, the pod is healthy.
 	// No need to ever change this to HealthCheckResponse_NOT_SERVING since it's a local service only
@@ -339,16 +454,20 @@ func (c *IPAMContext) RunRPCHandler(version string) error {
 	// Register reflection service on gRPC server.
 	reflection.Register(grpcServer)
 	// Add shutdown hook
-	go c.shutdownListener()
+	shutdownDone := make(chan struct{})
+	go c.shutdownListener(grpcServer, version, shutdownDone)
 	if err := grpcServer.Serve(listener); err != nil {
 		log.Errorf("Failed to start server on gRPC port: %v", err)
 		return errors.Wrap(err, "ipamd: failed to start server on gPRC port")
 	}
+	// Serve returns as soon as the shutdown stops the server, wait for the handoff
+	<-shutdownDone
 	return nil
 }
 
-// shutdownListener - Listen to signals and set ipamd to be in status "terminating"
-func (c *IPAMContext) shutdownListener() {
+// shutdownListener - Listen to signals and shut ipamd down gracefully
+func (c *IPAMContext) shutdownListener(grpcServer *grpc.Server, version string, done chan<- struct{}) {
+	defer utilruntime.HandleCrash()
 	log.Info("Setting up shutdown hook.")
 	sig := make(chan os.Signal, 1)
 
@@ -360,5 +479,6 @@ func (c *IPAMContext) shutdownListener() {
 	<-sig
 	log.Info("Received shutdown signal, setting 'terminating' to true")
 	// We received an interrupt signal, shut down.
-	c.setTerminating()
+	c.gracefulShutdown(grpcServer, version)
+	close(done)
 }
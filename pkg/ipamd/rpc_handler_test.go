@@ -305,3 +305,25 @@ func TestServer_AddNetwork(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_validateVersion(t *testing.T) {
+	s := &server{version: "1.2.3"}
+	assert.NoError(t, s.validateVersion("1.2.3"))
+	assert.Error(t, s.validateVersion("1.2.2"))
+	assert.Error(t, s.validateVersion(""))
+
+	s.previousVersion = "1.2.2"
+	assert.NoError(t, s.validateVersion("1.2.3"))
+	assert.NoError(t, s.validateVersion("1.2.2"))
+	assert.Error(t, s.validateVersion("1.2.1"))
+}
+
+func TestServer_DelNetworkCountsFailedADDsOfPreviousPlugin(t *testing.T) {
+	s := &server{version: "1.2.3", ipamContext: &IPAMContext{}}
+
+	// The failed ADDs of another plugin version are counted, but not as ADDs of the current plugin
+	_, err := s.DelNetwork(context.Background(), &pb.DelNetworkRequest{ClientVersion: "1.2.2", Reason: setupNSFailedReason})
+	assert.Error(t, err)
+	assert.Equal(t, int64(1), s.ipamContext.cniAddFailed)
+	assert.Equal(t, int64(0), s.ipamContext.cniAddFailedCurrent)
+}
@@ -0,0 +1,181 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+const (
+	// envSandboxReconcileRepair releases the IPs of the sandboxes that are gone, and assigns the IPs of the pods that
+	// the datastore lost, instead of only reporting them
+	envSandboxReconcileRepair = "SANDBOX_RECONCILE_REPAIR"
+
+	// sandboxReconcileInterval is how often the datastore is checked against the pods of the node
+	sandboxReconcileInterval = 5 * time.Minute
+
+	// sandboxReconcileGracePeriod leaves out the allocations and pods younger than this, whose CNI ADD or DEL may not
+	// be complete, or not seen by the pod cache yet
+	sandboxReconcileGracePeriod = 2 * time.Minute
+)
+
+// The types of mismatches
+const (
+	// mismatchAllocatedWithoutPod is an allocation whose pod is not on the node anymore
+	mismatchAllocatedWithoutPod = "allocated_without_pod"
+	// mismatchAllocatedWithoutSandbox is an allocation whose pod has no host-side veth, the sandbox is gone
+	mismatchAllocatedWithoutSandbox = "allocated_without_sandbox"
+	// mismatchPodWithoutAllocation is a pod with an IP that is not assigned to it in the datastore
+	mismatchPodWithoutAllocation = "pod_without_allocation"
+)
+
+// sandboxMismatches are the mismatches found by a reconcile
+type sandboxMismatches struct {
+	withoutPod     []datastore.CheckpointEntry
+	withoutSandbox []datastore.CheckpointEntry
+	// withoutAllocation are the allocations that the pods should have
+	withoutAllocation []datastore.CheckpointEntry
+}
+
+// MonitorSandboxes checks the datastore against the pods of the node and their sandboxes, reports the mismatches as
+// metrics, and repairs them when enabled
+func (c *IPAMContext) MonitorSandboxes() {
+	repair := parseBoolEnvVar(envSandboxReconcileRepair, false)
+	for {
+		time.Sleep(sandboxReconcileInterval)
+		if c.degradationLevel() >= degradationShedding {
+			continue
+		}
+		mismatches, err := c.findSandboxMismatches(context.TODO(), time.Now())
+		if err != nil {
+			log.Warnf("Failed to reconcile the datastore with the pods of the node: %v", err)
+			continue
+		}
+		mismatches.export()
+		if repair {
+			c.repairSandboxMismatches(mismatches)
+		}
+	}
+}
+
+// findSandboxMismatches compares the allocations of the datastore with the pods of the node, and with the host-side
+// veths the plugin created for their sandboxes
+func (c *IPAMContext) findSandboxMismatches(ctx context.Context, now time.Time) (*sandboxMismatches, error) {
+	// The pods are listed after the snapshot, so that a pod created in between is not missing its allocation
+	snapshot := c.dataStore.Snapshot()
+	pods, err := c.nodePods(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := &sandboxMismatches{}
+	podUIDs := make(map[string]string, len(pods))
+	for _, pod := range pods {
+		podUIDs[pod.Namespace+"/"+pod.Name] = string(pod.UID)
+	}
+	assigned := make(map[string]bool, len(snapshot.Allocations))
+	var allocations []datastore.CheckpointEntry
+	for _, allocation := range snapshot.Allocations {
+		assigned[allocation.IPv4+allocation.IPv6] = true
+		// The IPs leased to the plugin have no pod until they are claimed, and allocations checkpointed by older
+		// versions have no pod name
+		if allocation.NetworkName == ipLeaseNetworkName || allocation.Metadata.K8SPodName == "" ||
+			now.Sub(time.Unix(0, allocation.AllocationTimestamp)) < sandboxReconcileGracePeriod {
+			continue
+		}
+		allocations = append(allocations, allocation)
+		uid, ok := podUIDs[allocation.Metadata.K8SPodNamespace+"/"+allocation.Metadata.K8SPodName]
+		if !ok || (allocation.Metadata.K8SPodUID != "" && uid != allocation.Metadata.K8SPodUID) {
+			mismatches.withoutPod = append(mismatches.withoutPod, allocation)
+		}
+	}
+	if mismatches.withoutSandbox, err = c.dataStore.AllocationsWithoutVeth(allocations); err != nil {
+		return nil, err
+	}
+
+	var settledPods []corev1.Pod
+	for _, pod := range pods {
+		if now.Sub(pod.CreationTimestamp.Time) >= sandboxReconcileGracePeriod {
+			settledPods = append(settledPods, pod)
+		}
+	}
+	for _, allocation := range c.allocationsOfPods(settledPods) {
+		if !assigned[allocation.IPv4+allocation.IPv6] {
+			mismatches.withoutAllocation = append(mismatches.withoutAllocation, allocation)
+		}
+	}
+	return mismatches, nil
+}
+
+func (m *sandboxMismatches) export() {
+	for mismatchType, allocations := range map[string][]datastore.CheckpointEntry{
+		mismatchAllocatedWithoutPod:     m.withoutPod,
+		mismatchAllocatedWithoutSandbox: m.withoutSandbox,
+		mismatchPodWithoutAllocation:    m.withoutAllocation,
+	} {
+		prometheusmetrics.SandboxMismatches.WithLabelValues(mismatchType).Set(float64(len(allocations)))
+		for _, allocation := range allocations {
+			log.Warnf("Sandbox mismatch %s: pod %s/%s, IP %s%s, sandbox %s", mismatchType, allocation.Metadata.K8SPodNamespace,
+				allocation.Metadata.K8SPodName, allocation.IPv4, allocation.IPv6, allocation.IPAMKey)
+		}
+	}
+}
+
+// repairSandboxMismatches releases the allocations whose pod and sandbox are both gone, and assigns the IPs of the pods
+// the datastore lost. The allocations with only one of the two gone are left to the CNI DEL.
+func (c *IPAMContext) repairSandboxMismatches(m *sandboxMismatches) {
+	withoutSandbox := make(map[datastore.IPAMKey]bool, len(m.withoutSandbox))
+	for _, allocation := range m.withoutSandbox {
+		withoutSandbox[allocation.IPAMKey] = true
+	}
+	var released []datastore.CheckpointEntry
+	for _, allocation := range m.withoutPod {
+		if !withoutSandbox[allocation.IPAMKey] {
+			continue
+		}
+		if _, _, _, err := c.unassignPodIPAddress(allocation.IPAMKey, allocation.Metadata.K8SPodUID); err != nil {
+			log.Warnf("Failed to release the IP of sandbox %s: %v", allocation.IPAMKey, err)
+			continue
+		}
+		log.Infof("Released IP %s%s of pod %s/%s, whose sandbox is gone", allocation.IPv4, allocation.IPv6,
+			allocation.Metadata.K8SPodNamespace, allocation.Metadata.K8SPodName)
+		released = append(released, allocation)
+		prometheusmetrics.SandboxMismatchRepairs.WithLabelValues(mismatchAllocatedWithoutPod).Inc()
+	}
+	if len(released) > 0 {
+		// The plugin could not remove the IP rules of the pods whose DEL never reached ipamd
+		c.dataStore.PruneStaleAllocations(released)
+	}
+
+	if len(m.withoutAllocation) == 0 {
+		return
+	}
+	restored, err := c.dataStore.MergeSnapshot(datastore.CheckpointData{
+		Version:     datastore.CheckpointFormatVersion,
+		Allocations: m.withoutAllocation,
+	}, c.enableIPv6)
+	if err != nil {
+		log.Warnf("Failed to assign the IPs of the pods missing from the datastore: %v", err)
+	}
+	if restored > 0 {
+		log.Infof("Assigned the IPs of %d pods missing from the datastore", restored)
+		prometheusmetrics.SandboxMismatchRepairs.WithLabelValues(mismatchPodWithoutAllocation).Add(float64(restored))
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestSandboxMismatches(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	ds := testDatastore()
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		assert.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ip), Mask: net.CIDRMask(32, 32)}, false))
+	}
+	assign := func(name string) string {
+		ip, _, err := ds.AssignPodIPv4Address(datastore.IPAMKey{NetworkName: "aws-cni", ContainerID: name, IfName: "eth0"},
+			datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: name, K8SPodUID: name + "-uid"})
+		assert.NoError(t, err)
+		return ip
+	}
+	assign("gone")
+	runningIP := assign("running")
+	// The IP of the lost pod was assigned before the datastore lost it
+	lostIP := assign("lost")
+	_, _, _, err := ds.UnassignPodIPAddress(datastore.IPAMKey{NetworkName: "aws-cni", ContainerID: "lost", IfName: "eth0"}, "")
+	assert.NoError(t, err)
+
+	pod := func(name, ip string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name + "-uid")},
+			Spec:       corev1.PodSpec{NodeName: "node-1"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIPs: []corev1.PodIP{{IP: ip}}},
+		}
+	}
+	assert.NoError(t, m.k8sClient.Create(ctx, pod("running", runningIP)))
+	assert.NoError(t, m.k8sClient.Create(ctx, pod("lost", lostIP)))
+
+	c := &IPAMContext{dataStore: ds, k8sClient: m.k8sClient, myNodeName: "node-1", enableIPv4: true}
+
+	// The allocations are too recent to be checked
+	mismatches, err := c.findSandboxMismatches(ctx, time.Now())
+	assert.NoError(t, err)
+	assert.Empty(t, mismatches.withoutPod)
+	assert.Empty(t, mismatches.withoutSandbox)
+
+	// No pod on this host has a veth, the sandboxes of all pods are gone
+	mismatches, err = c.findSandboxMismatches(ctx, time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	podNames := func(allocations []datastore.CheckpointEntry) []string {
+		var names []string
+		for _, allocation := range allocations {
+			names = append(names, allocation.Metadata.K8SPodName)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"gone"}, podNames(mismatches.withoutPod))
+	assert.ElementsMatch(t, []string{"gone", "running"}, podNames(mismatches.withoutSandbox))
+	assert.Equal(t, []string{"lost"}, podNames(mismatches.withoutAllocation))
+
+	// Only the allocation without pod nor sandbox is released
+	c.repairSandboxMismatches(mismatches)
+	allocated := map[string]datastore.IPAMKey{}
+	for _, allocation := range ds.AllocatedIPs() {
+		allocated[allocation.IP] = allocation.IPAMKey
+	}
+	assert.Equal(t, map[string]datastore.IPAMKey{
+		runningIP: {NetworkName: "aws-cni", ContainerID: "running", IfName: "eth0"},
+		lostIP:    datastore.RecoveredIPAMKey("lost-uid"),
+	}, allocated)
+}
+
+func TestRepairSandboxMismatchesHoldsCarrierIPs(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	c := carrierIPTestContext(t, m)
+	c.carrierIPs["10.0.0.5"] = "155.146.0.10"
+
+	// The IP of the pod without pod nor sandbox stays out of the pool until its carrier IP is released
+	releasing := make(chan struct{})
+	release := make(chan struct{})
+	m.awsutils.EXPECT().ReleaseCarrierIP(gomock.Any(), "10.0.0.5").DoAndReturn(func(context.Context, string) error {
+		close(releasing)
+		<-release
+		return nil
+	})
+	m.network.EXPECT().TeardownCarrierIPRules(net.ParseIP("10.0.0.5")).Return(nil)
+
+	gone := c.dataStore.Snapshot().Allocations
+	c.repairSandboxMismatches(&sandboxMismatches{withoutPod: gone, withoutSandbox: gone})
+	<-releasing
+	allocated := c.dataStore.AllocatedIPs()
+	assert.Len(t, allocated, 1)
+	assert.Equal(t, carrierIPReleaseKey("10.0.0.5"), allocated[0].IPAMKey)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return c.dataStore.GetIPStats(ipV4AddrFamily).AssignedIPs == 0
+	}, time.Second, time.Millisecond)
+}
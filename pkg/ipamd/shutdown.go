@@ -0,0 +1,181 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+)
+
+const (
+	// handoffFileName is written next to the checkpoint file when ipamd shuts down cleanly
+	handoffFileName = "ipamd-handoff.json"
+
+	// handoffMaxAge is how long a handoff marker is trusted. Past it, the node may have changed while no ipamd ran.
+	handoffMaxAge = 10 * time.Minute
+
+	// shutdownTimeout bounds the time spent waiting for in-flight requests and EC2 calls, to stay within the
+	// termination grace period of the aws-node pod
+	shutdownTimeout = 5 * time.Second
+)
+
+// handoffMarker records the state of ipamd when it shut down, so that the next instance can trust the checkpoint
+type handoffMarker struct {
+	Version          string    `json:"version"`
+	InstanceID       string    `json:"instanceID"`
+	IPv4Enabled      bool      `json:"ipv4Enabled"`
+	IPv6Enabled      bool      `json:"ipv6Enabled"`
+	PrefixDelegation bool      `json:"prefixDelegation"`
+	WrittenAt        time.Time `json:"writtenAt"`
+}
+
+func handoffPath() string {
+	return filepath.Join(filepath.Dir(dsBackingStorePath()), handoffFileName)
+}
+
+// gracefulShutdown stops accepting new pods, waits for in-flight CNI requests and EC2 calls, flushes the checkpoint
+// and writes the handoff marker
+func (c *IPAMContext) gracefulShutdown(grpcServer *grpc.Server, version string) {
+	// AddNetwork rejects new pods and the pool manager stops changing ENIs and IPs from now on
+	c.setTerminating()
+	deadline := time.Now().Add(shutdownTimeout)
+
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Until(deadline)):
+		log.Warn("Timed out waiting for in-flight CNI requests, stopping the gRPC server")
+		grpcServer.Stop()
+	}
+	// Pods set up from a lease are confirmed before the checkpoint is flushed
+	c.retireIPLeases()
+
+	// The lock is never released, so that the pool manager does not start another cycle
+	idle := make(chan struct{})
+	go func() {
+		c.ipPoolLock.Lock()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+	case <-time.After(time.Until(deadline)):
+		// The checkpoint may miss the IPs of the call in progress, the next instance reconciles them
+		log.Warn("Timed out waiting for in-flight EC2 calls, not writing the handoff marker")
+		c.flushCheckpoint()
+		return
+	}
+
+	if !c.flushCheckpoint() {
+		return
+	}
+	if err := c.writeHandoffMarker(version); err != nil {
+		log.Warnf("Failed to write the handoff marker: %v", err)
+		return
+	}
+	log.Infof("Shut down cleanly, wrote handoff marker %s", handoffPath())
+}
+
+// flushCheckpoint writes the datastore to the checkpoint file and the ENI inventory, and returns whether it succeeded
+func (c *IPAMContext) flushCheckpoint() bool {
+	if c.dataStore == nil {
+		return false
+	}
+	if err := c.dataStore.WriteBackingStore(); err != nil {
+		log.Warnf("Failed to flush the checkpoint: %v", err)
+		return false
+	}
+	if err := c.dataStore.WriteENIInventory(); err != nil {
+		log.Warnf("Failed to flush the ENI inventory: %v", err)
+		return false
+	}
+	return true
+}
+
+func (c *IPAMContext) newHandoffMarker(version string) handoffMarker {
+	return handoffMarker{
+		Version:          version,
+		InstanceID:       c.awsClient.GetInstanceID(),
+		IPv4Enabled:      c.enableIPv4,
+		IPv6Enabled:      c.enableIPv6,
+		PrefixDelegation: c.enablePrefixDelegation,
+	}
+}
+
+func (c *IPAMContext) writeHandoffMarker(version string) error {
+	marker := c.newHandoffMarker(version)
+	marker.WrittenAt = time.Now()
+	data, err := json.Marshal(marker)
+	if err != nil {
+		return err
+	}
+	tmpPath := handoffPath() + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, handoffPath())
+}
+
+// consumeHandoffMarker returns whether the previous ipamd shut down cleanly with the same configuration, so that its
+// checkpoint can be trusted without a full reconcile. The marker is removed, it is only valid for one start.
+func (c *IPAMContext) consumeHandoffMarker() bool {
+	data, err := os.ReadFile(handoffPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to read the handoff marker: %v", err)
+		}
+		return false
+	}
+	if err := os.Remove(handoffPath()); err != nil {
+		log.Warnf("Failed to remove the handoff marker: %v", err)
+	}
+
+	var marker handoffMarker
+	if err := json.Unmarshal(data, &marker); err != nil {
+		log.Warnf("Ignoring invalid handoff marker: %v", err)
+		return false
+	}
+	if err := c.validateHandoffMarker(marker); err != nil {
+		log.Infof("Ignoring handoff marker: %v", err)
+		return false
+	}
+	log.Infof("Previous ipamd %s shut down cleanly at %s, skipping the startup reconcile", marker.Version,
+		marker.WrittenAt.Format(time.RFC3339))
+	return true
+}
+
+func (c *IPAMContext) validateHandoffMarker(marker handoffMarker) error {
+	age := time.Since(marker.WrittenAt)
+	if age > handoffMaxAge || age < 0 {
+		return errors.Errorf("written %s ago", age.Round(time.Second))
+	}
+	expected := c.newHandoffMarker(marker.Version)
+	expected.WrittenAt = marker.WrittenAt
+	if marker != expected {
+		return errors.New("the configuration changed")
+	}
+	// A checkpoint written after the marker means something else changed the allocations
+	if info, err := os.Stat(dsBackingStorePath()); err != nil || info.ModTime().After(marker.WrittenAt) {
+		return errors.New("the checkpoint changed")
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	pb "github.com/aws/amazon-vpc-cni-k8s/rpc"
+)
+
+func TestGracefulShutdownHandoff(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	t.Setenv(envBackingStorePath, filepath.Join(t.TempDir(), "ipam.json"))
+	m.awsutils.EXPECT().GetInstanceID().Return(instanceID).AnyTimes()
+
+	newContext := func() *IPAMContext {
+		return &IPAMContext{
+			awsClient:  m.awsutils,
+			enableIPv4: true,
+			dataStore:  datastore.NewDataStore(log, datastore.NewJSONFile(dsBackingStorePath()), false),
+		}
+	}
+
+	c := newContext()
+	c.gracefulShutdown(grpc.NewServer(), "v1.2.3")
+	assert.True(t, c.isTerminating())
+	assert.FileExists(t, dsBackingStorePath())
+	assert.FileExists(t, handoffPath())
+
+	// The pool manager is blocked for good
+	assert.False(t, c.ipPoolLock.TryLock())
+
+	// The marker is valid for a single start
+	assert.True(t, newContext().consumeHandoffMarker())
+	assert.NoFileExists(t, handoffPath())
+	assert.False(t, newContext().consumeHandoffMarker())
+}
+
+func TestValidateHandoffMarker(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	t.Setenv(envBackingStorePath, filepath.Join(t.TempDir(), "ipam.json"))
+	m.awsutils.EXPECT().GetInstanceID().Return(instanceID).AnyTimes()
+
+	c := &IPAMContext{awsClient: m.awsutils, enableIPv4: true}
+	require.NoError(t, os.WriteFile(dsBackingStorePath(), []byte("{}"), 0644))
+	checkpointTime := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(dsBackingStorePath(), checkpointTime, checkpointTime))
+
+	valid := c.newHandoffMarker("v1.2.3")
+	valid.WrittenAt = checkpointTime
+	assert.NoError(t, c.validateHandoffMarker(valid))
+
+	stale := valid
+	stale.WrittenAt = time.Now().Add(-2 * handoffMaxAge)
+	assert.Error(t, c.validateHandoffMarker(stale))
+
+	otherInstance := valid
+	otherInstance.InstanceID = "i-00000000000000000"
+	assert.Error(t, c.validateHandoffMarker(otherInstance))
+
+	prefixDelegation := valid
+	prefixDelegation.PrefixDelegation = true
+	assert.Error(t, c.validateHandoffMarker(prefixDelegation))
+
+	// The checkpoint was written after the marker
+	beforeCheckpoint := valid
+	beforeCheckpoint.WrittenAt = checkpointTime.Add(-time.Second)
+	assert.Error(t, c.validateHandoffMarker(beforeCheckpoint))
+}
+
+func TestWarmStartENIs(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	// The previous ipamd recorded its ENIs with a warm IP each
+	inventory := datastore.NewTestCheckpoint(struct{}{})
+	previous := testDatastore()
+	previous.SetENIInventory(inventory)
+	require.NoError(t, previous.AddENI(primaryENIid, primaryDevice, true, false, false))
+	require.NoError(t, previous.AddENI(secENIid, secDevice, false, false, false))
+	require.NoError(t, previous.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr02), Mask: net.CIDRMask(32, 32)}, false))
+	require.NoError(t, previous.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP(ipaddr11), Mask: net.CIDRMask(32, 32)}, false))
+	require.NoError(t, previous.WriteENIInventory())
+
+	primaryENI := awsutils.ENIMetadata{
+		ENIID:          primaryENIid,
+		MAC:            primaryMAC,
+		DeviceNumber:   primaryDevice,
+		SubnetIPv4CIDR: primarySubnet,
+		IPv4Addresses: []*ec2.NetworkInterfacePrivateIpAddress{
+			{PrivateIpAddress: aws.String(ipaddr01), Primary: aws.Bool(true)},
+			// Released by the previous ipamd, IMDS does not know yet
+			{PrivateIpAddress: aws.String(ipaddr03), Primary: aws.Bool(false)},
+		},
+	}
+	secENI := awsutils.ENIMetadata{
+		ENIID:          secENIid,
+		MAC:            secMAC,
+		DeviceNumber:   secDevice,
+		SubnetIPv4CIDR: secSubnet,
+		IPv4Addresses:  []*ec2.NetworkInterfacePrivateIpAddress{{PrivateIpAddress: aws.String(ipaddr12), Primary: aws.Bool(true)}},
+	}
+	unmanagedENI := awsutils.ENIMetadata{ENIID: terENIid, MAC: terMAC, DeviceNumber: terDevice, SubnetIPv4CIDR: terSubnet}
+	m.awsutils.EXPECT().GetAttachedENIs().Return([]awsutils.ENIMetadata{primaryENI, secENI, unmanagedENI}, nil)
+	m.awsutils.EXPECT().GetPrimaryENI().Return(primaryENIid).AnyTimes()
+	m.network.EXPECT().SetupENINetwork(ipaddr12, secMAC, secDevice, secSubnet).Return(nil)
+
+	c := &IPAMContext{
+		awsClient:     m.awsutils,
+		networkClient: m.network,
+		enableIPv4:    true,
+		maxENI:        4,
+		primaryIP:     make(map[string]string),
+		dataStore:     datastore.NewDataStore(log, datastore.NullCheckpoint{}, false),
+	}
+	c.dataStore.SetENIInventory(inventory)
+	assert.True(t, c.warmStartENIs())
+	assert.Equal(t, 2, c.dataStore.GetENIs())
+	assert.Equal(t, 2, c.dataStore.GetIPStats(ipV4AddrFamily).TotalIPs)
+	primaryIPs, _, err := c.dataStore.GetENICIDRs(primaryENIid)
+	require.NoError(t, err)
+	assert.Contains(t, primaryIPs, ipaddr02)
+	assert.NotContains(t, primaryIPs, ipaddr03)
+	assert.Equal(t, ipaddr12, c.primaryIP[secENIid])
+	// The ENI missing from the ENI inventory is not used until the reconcile describes it
+	assert.Equal(t, 1, c.unmanagedENI)
+
+	// An ENI of the inventory that is gone means the ENIs have to be described
+	m.awsutils.EXPECT().GetAttachedENIs().Return([]awsutils.ENIMetadata{primaryENI}, nil)
+	c.dataStore = datastore.NewDataStore(log, datastore.NullCheckpoint{}, false)
+	c.dataStore.SetENIInventory(inventory)
+	assert.False(t, c.warmStartENIs())
+
+	// So does a node without an ENI inventory
+	c.dataStore = testDatastore()
+	assert.False(t, c.warmStartENIs())
+}
+
+func TestAddNetworkWhileTerminating(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	mockContext := &IPAMContext{
+		awsClient:     m.awsutils,
+		networkClient: m.network,
+		dataStore:     datastore.NewDataStore(log, datastore.NullCheckpoint{}, false),
+	}
+	mockContext.setTerminating()
+	rpcServer := server{
+		version:     "1.2.3",
+		ipamContext: mockContext,
+	}
+
+	_, err := rpcServer.AddNetwork(context.TODO(), &pb.AddNetworkRequest{
+		ClientVersion: "1.2.3",
+		Netns:         "netns",
+		NetworkName:   "net0",
+		ContainerID:   "cid",
+		IfName:        "eni",
+	})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
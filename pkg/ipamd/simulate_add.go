@@ -0,0 +1,180 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+// Outcomes of a simulated ADD
+const (
+	// simulatedAddAssign means that the pod would get a free IP of the datastore right away
+	simulatedAddAssign = "assign"
+	// simulatedAddBranchENI means that the pod would get the branch ENI the VPC resource controller annotated it with
+	simulatedAddBranchENI = "branch-eni"
+	// simulatedAddWait means that the ADD would wait for the pool manager to allocate an IP
+	simulatedAddWait = "wait"
+	// simulatedAddReject means that the ADD would fail
+	simulatedAddReject = "reject"
+)
+
+// SimulatedAdd is what an ADD of a pod would get under the current state of the datastore and the configuration
+type SimulatedAdd struct {
+	Outcome         string `json:"outcome"`
+	Reason          string `json:"reason,omitempty"`
+	AllocationClass string `json:"allocationClass,omitempty"`
+	IPv4Addr        string `json:"ipv4Addr,omitempty"`
+	IPv6Addr        string `json:"ipv6Addr,omitempty"`
+	ENI             string `json:"eni,omitempty"`
+	DeviceNumber    int    `json:"deviceNumber"`
+	SubnetCIDR      string `json:"subnetCidr,omitempty"`
+	Cidr            string `json:"cidr,omitempty"`
+	Source          string `json:"source,omitempty"`
+	BranchENIMAC    string `json:"branchEniMac,omitempty"`
+	VlanID          int    `json:"vlanId,omitempty"`
+}
+
+// simulateAdd reports what an ADD of the pod would get, without assigning anything. An empty podName simulates the ADD
+// of a pod that does not exist yet, of the normal allocation class and without a branch ENI. The datastore picks the
+// IP of a real ADD among the free ones of the ENIs in no particular order, so it may differ from the simulated one.
+func (c *IPAMContext) simulateAdd(podName, namespace string) SimulatedAdd {
+	if c.isTerminating() {
+		return SimulatedAdd{Outcome: simulatedAddReject, Reason: "ipamd is shutting down", DeviceNumber: -1}
+	}
+	if c.enablePodENI && podName != "" {
+		pod, err := c.GetPod(podName, namespace)
+		if err != nil {
+			return SimulatedAdd{Outcome: simulatedAddReject, Reason: fmt.Sprintf("failed to get the pod: %v", err), DeviceNumber: -1}
+		}
+		if requestsBranchENI(pod) {
+			return c.simulateBranchENIAdd(pod)
+		}
+	}
+
+	class := allocationClassNormal
+	if podName != "" {
+		class = c.allocationClass(podName, namespace)
+	}
+	sim := SimulatedAdd{AllocationClass: class, DeviceNumber: -1}
+	waits := c.waitsForIP(class)
+	waitTimeout := onDemandWaitTimeout
+	if c.ipWaitTimeout > 0 {
+		waitTimeout = c.ipWaitTimeout
+	}
+	if queued := c.ipWaitQueue.len(); queued > 0 && (waits || c.freeIPs() <= queued) {
+		if !waits {
+			sim.Outcome = simulatedAddReject
+			sim.Reason = fmt.Sprintf("the free IPs are kept for the %d ADDs waiting for one", queued)
+			return sim
+		}
+		sim.Outcome = simulatedAddWait
+		sim.Reason = fmt.Sprintf("%d ADDs already wait for an IP, the ADD would wait up to %v behind them", queued, waitTimeout)
+		return sim
+	}
+
+	address, err := c.dataStore.PreviewPodIPAddress(c.enableIPv4, c.enableIPv6)
+	if err != nil {
+		if waits && errors.Is(err, datastore.ErrNoAvailableIPs) {
+			sim.Outcome = simulatedAddWait
+			sim.Reason = fmt.Sprintf("no free IP, the ADD would wait up to %v for the pool manager to allocate one", waitTimeout)
+			return sim
+		}
+		sim.Outcome = simulatedAddReject
+		sim.Reason = err.Error()
+		return sim
+	}
+	sim.Outcome = simulatedAddAssign
+	if c.enableIPv4 {
+		sim.IPv4Addr = address.Address
+	} else {
+		sim.IPv6Addr = address.Address
+	}
+	sim.ENI = address.ENI
+	sim.DeviceNumber = address.DeviceNumber
+	sim.Cidr = address.Cidr
+	sim.Source = address.Source
+	sim.SubnetCIDR = c.eniSubnetCIDR(address.ENI)
+	return sim
+}
+
+// requestsBranchENI returns whether the pod asks for a branch ENI of the VPC resource controller
+func requestsBranchENI(pod *corev1.Pod) bool {
+	for resName := range pod.Spec.Containers[0].Resources.Limits {
+		if strings.HasPrefix(string(resName), "vpc.amazonaws.com/pod-eni") {
+			return true
+		}
+	}
+	return false
+}
+
+// simulateBranchENIAdd reports the branch ENI an ADD of the pod would set up, from the annotation of the pod
+func (c *IPAMContext) simulateBranchENIAdd(pod *corev1.Pod) SimulatedAdd {
+	sim := SimulatedAdd{DeviceNumber: -1}
+	if c.dataStore.GetTrunkENI() == "" {
+		sim.Outcome = simulatedAddReject
+		sim.Reason = "no trunk ENI found, cannot add a pod ENI"
+		return sim
+	}
+	val, ok := pod.Annotations[podENIAnnotation]
+	if !ok {
+		sim.Outcome = simulatedAddReject
+		sim.Reason = "the pod does not have a branch ENI yet"
+		return sim
+	}
+	var podENIData []PodENIData
+	if err := json.Unmarshal([]byte(val), &podENIData); err != nil || len(podENIData) < 1 {
+		sim.Outcome = simulatedAddReject
+		sim.Reason = fmt.Sprintf("failed to parse the %s annotation: %s", podENIAnnotation, val)
+		return sim
+	}
+	firstENI := podENIData[0]
+	sim.Outcome = simulatedAddBranchENI
+	sim.ENI = firstENI.ENIID
+	sim.BranchENIMAC = firstENI.IfAddress
+	sim.VlanID = firstENI.VlanID
+	if c.enableIPv6 {
+		sim.IPv6Addr = firstENI.IPV6Addr
+		sim.SubnetCIDR = firstENI.SubnetV6CIDR
+	} else {
+		sim.IPv4Addr = firstENI.PrivateIP
+		sim.SubnetCIDR = firstENI.SubnetCIDR
+	}
+	return sim
+}
+
+// eniSubnetCIDR returns the CIDR of the subnet of the attached ENI, empty when it can not be found
+func (c *IPAMContext) eniSubnetCIDR(eniID string) string {
+	enis, err := c.awsClient.GetAttachedENIs()
+	if err != nil {
+		log.Warnf("Failed to get the subnet of ENI %s: %v", eniID, err)
+		return ""
+	}
+	for _, eni := range enis {
+		if eni.ENIID != eniID {
+			continue
+		}
+		if c.enableIPv4 {
+			return eni.SubnetIPv4CIDR
+		}
+		return eni.SubnetIPv6CIDR
+	}
+	return ""
+}
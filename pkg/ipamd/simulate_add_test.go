@@ -0,0 +1,136 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestSimulateAdd(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	c := &IPAMContext{
+		awsClient:  m.awsutils,
+		k8sClient:  m.k8sClient,
+		dataStore:  testDatastore(),
+		enableIPv4: true,
+	}
+	c.dataStore.AddENI(secENIid, secDevice, false, false, false)
+
+	// Without free IPs, the ADD fails unless it waits for the pool manager
+	assert.Equal(t, SimulatedAdd{
+		Outcome:         simulatedAddReject,
+		Reason:          datastore.ErrNoAvailableIPs.Error(),
+		AllocationClass: allocationClassNormal,
+		DeviceNumber:    -1,
+	}, c.simulateAdd("", ""))
+	c.onDemandAllocation = true
+	sim := c.simulateAdd("", "")
+	assert.Equal(t, simulatedAddWait, sim.Outcome)
+	assert.Contains(t, sim.Reason, onDemandWaitTimeout.String())
+	c.onDemandAllocation = false
+
+	c.dataStore.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP(ipaddr01), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	m.awsutils.EXPECT().GetAttachedENIs().Return([]awsutils.ENIMetadata{
+		{ENIID: primaryENIid, SubnetIPv4CIDR: primarySubnet},
+		{ENIID: secENIid, SubnetIPv4CIDR: "10.10.20.0/24"},
+	}, nil)
+	assert.Equal(t, SimulatedAdd{
+		Outcome:         simulatedAddAssign,
+		AllocationClass: allocationClassNormal,
+		IPv4Addr:        ipaddr01,
+		ENI:             secENIid,
+		DeviceNumber:    secDevice,
+		SubnetCIDR:      "10.10.20.0/24",
+		Cidr:            ipaddr01 + "/32",
+		Source:          datastore.SecondaryIPv4Source.Name(),
+	}, c.simulateAdd("", ""))
+
+	// The free IP is kept for the ADD waiting for one
+	waiter := c.ipWaitQueue.add("default", allocationClassHigh)
+	sim = c.simulateAdd("", "")
+	assert.Equal(t, simulatedAddReject, sim.Outcome)
+	assert.Equal(t, "the free IPs are kept for the 1 ADDs waiting for one", sim.Reason)
+	c.ipWaitQueue.remove(waiter)
+
+	c.setTerminating()
+	assert.Equal(t, simulatedAddReject, c.simulateAdd("", "").Outcome)
+}
+
+func TestSimulateAddBranchENI(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	c := &IPAMContext{
+		k8sClient:    m.k8sClient,
+		dataStore:    testDatastore(),
+		enableIPv4:   true,
+		enablePodENI: true,
+	}
+	limits := corev1.ResourceList{"vpc.amazonaws.com/pod-eni": resource.MustParse("1")}
+	assert.NoError(t, m.k8sClient.Create(ctx, &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "branch",
+			Namespace: "default",
+			Annotations: map[string]string{podENIAnnotation: `[{"eniId":"eni-branch","ifAddress":"02:00:00:00:00:10",` +
+				`"privateIp":"10.10.20.30","vlanID":3,"subnetCidr":"10.10.20.0/24"}]`},
+		},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Resources: corev1.ResourceRequirements{Limits: limits}}}},
+	}))
+
+	// Branch ENIs need the trunk ENI
+	sim := c.simulateAdd("branch", "default")
+	assert.Equal(t, simulatedAddReject, sim.Outcome)
+
+	c.dataStore.AddENI("eni-trunk", 2, false, true, false)
+	assert.Equal(t, SimulatedAdd{
+		Outcome:      simulatedAddBranchENI,
+		IPv4Addr:     "10.10.20.30",
+		ENI:          "eni-branch",
+		DeviceNumber: -1,
+		SubnetCIDR:   "10.10.20.0/24",
+		BranchENIMAC: "02:00:00:00:00:10",
+		VlanID:       3,
+	}, c.simulateAdd("branch", "default"))
+
+	sim = c.simulateAdd("missing", "default")
+	assert.Equal(t, simulatedAddReject, sim.Outcome)
+	assert.Contains(t, sim.Reason, "failed to get the pod")
+}
+
+func TestSimulateAddV1RequestHandler(t *testing.T) {
+	c := &IPAMContext{dataStore: testDatastore(), enableIPv4: true}
+
+	rr := httptest.NewRecorder()
+	simulateAddV1RequestHandler(c)(rr, httptest.NewRequest("GET", "/v1/simulate-add?namespace=default&name=web", nil))
+	var sim SimulatedAdd
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &sim))
+	assert.Equal(t, simulatedAddReject, sim.Outcome)
+	assert.Equal(t, allocationClassNormal, sim.AllocationClass)
+}
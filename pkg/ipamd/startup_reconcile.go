@@ -0,0 +1,96 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const (
+	// envStartupReconcileMode selects how much of the state in the checkpoint ipamd trusts on start
+	envStartupReconcileMode = "STARTUP_RECONCILE_MODE"
+
+	// startupReconcileFast warm starts from the checkpoint whenever its ENIs are still attached, with or without a
+	// handoff marker
+	startupReconcileFast = "fast"
+	// startupReconcileNormal warm starts from the checkpoint only after a clean handoff
+	startupReconcileNormal = "normal"
+	// startupReconcileDeep ignores the handoff marker and sets the ENIs up from the IPs and prefixes EC2 reports
+	startupReconcileDeep = "deep"
+)
+
+func startupReconcileMode() string {
+	return utils.GetEnv(envStartupReconcileMode, startupReconcileNormal)
+}
+
+// validateStartupReconcileMode loads and checks the startup reconcile mode setting
+func (c *IPAMContext) validateStartupReconcileMode() bool {
+	c.startupReconcileMode = startupReconcileMode()
+	switch c.startupReconcileMode {
+	case startupReconcileFast, startupReconcileNormal, startupReconcileDeep:
+		return true
+	default:
+		log.Errorf("Invalid %s %q, supported modes: %s, %s, %s", envStartupReconcileMode, c.startupReconcileMode,
+			startupReconcileFast, startupReconcileNormal, startupReconcileDeep)
+		return false
+	}
+}
+
+// setupENIsOnStart sets up the ENIs of the node before the checkpoint is read, from the checkpoint itself when the mode
+// and handoff allow it. It returns whether the handoff is still trusted, the deep mode always runs the full cleanup and
+// reconcile.
+func (c *IPAMContext) setupENIsOnStart(handoff bool) (bool, error) {
+	switch c.startupReconcileMode {
+	case startupReconcileDeep:
+		if handoff {
+			log.Infof("Ignoring the handoff marker, %s is %s", envStartupReconcileMode, startupReconcileDeep)
+		}
+		return false, c.setupAttachedENIs()
+	case startupReconcileFast:
+		if c.warmStartENIs() {
+			return handoff, nil
+		}
+	default:
+		if handoff && c.warmStartENIs() {
+			return handoff, nil
+		}
+	}
+	return handoff, c.setupAttachedENIs()
+}
+
+// crossCheckENIWithEC2 replaces the IPs and prefixes of an ENI from IMDS, which can lag behind, with those EC2 reports.
+// The IMDS view is kept when EC2 can not be reached, the reconcile fixes it later.
+func (c *IPAMContext) crossCheckENIWithEC2(eni awsutils.ENIMetadata) awsutils.ENIMetadata {
+	if !c.enableIPv4 {
+		return eni
+	}
+	addrs, err := c.awsClient.GetIPv4sFromEC2(eni.ENIID)
+	if err != nil {
+		log.Warnf("Using the IPs of ENI %s from instance metadata, failed to get them from EC2: %v", eni.ENIID, err)
+		return eni
+	}
+	prefixes, err := c.awsClient.GetIPv4PrefixesFromEC2(eni.ENIID)
+	if err != nil {
+		log.Warnf("Using the IPs of ENI %s from instance metadata, failed to get its prefixes from EC2: %v", eni.ENIID, err)
+		return eni
+	}
+	if len(addrs) != len(eni.IPv4Addresses) || len(prefixes) != len(eni.IPv4Prefixes) {
+		log.Infof("ENI %s has %d IPs and %d prefixes in EC2, instance metadata lists %d IPs and %d prefixes", eni.ENIID,
+			len(addrs), len(prefixes), len(eni.IPv4Addresses), len(eni.IPv4Prefixes))
+	}
+	eni.IPv4Addresses = addrs
+	eni.IPv4Prefixes = prefixes
+	return eni
+}
@@ -0,0 +1,115 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestValidateStartupReconcileMode(t *testing.T) {
+	c := &IPAMContext{}
+	assert.True(t, c.validateStartupReconcileMode())
+	assert.Equal(t, startupReconcileNormal, c.startupReconcileMode)
+
+	t.Setenv(envStartupReconcileMode, startupReconcileDeep)
+	assert.True(t, c.validateStartupReconcileMode())
+	assert.Equal(t, startupReconcileDeep, c.startupReconcileMode)
+
+	t.Setenv(envStartupReconcileMode, "thorough")
+	assert.False(t, c.validateStartupReconcileMode())
+}
+
+func TestSetupENIsOnStart(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	inventory := datastore.NewTestCheckpoint(struct{}{})
+	previous := testDatastore()
+	previous.SetENIInventory(inventory)
+	require.NoError(t, previous.AddENI(primaryENIid, primaryDevice, true, false, false))
+	require.NoError(t, previous.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ipaddr02), Mask: net.CIDRMask(32, 32)}, false))
+	require.NoError(t, previous.WriteENIInventory())
+
+	primaryENI := awsutils.ENIMetadata{
+		ENIID:          primaryENIid,
+		MAC:            primaryMAC,
+		DeviceNumber:   primaryDevice,
+		SubnetIPv4CIDR: primarySubnet,
+		IPv4Addresses: []*ec2.NetworkInterfacePrivateIpAddress{
+			{PrivateIpAddress: aws.String(ipaddr01), Primary: aws.Bool(true)},
+			// Released already, IMDS does not know yet
+			{PrivateIpAddress: aws.String(ipaddr03), Primary: aws.Bool(false)},
+		},
+	}
+	m.awsutils.EXPECT().GetPrimaryENI().Return(primaryENIid).AnyTimes()
+	newContext := func(mode string) *IPAMContext {
+		c := &IPAMContext{
+			awsClient:              m.awsutils,
+			networkClient:          m.network,
+			enableIPv4:             true,
+			disableENIProvisioning: true,
+			maxENI:                 4,
+			primaryIP:              make(map[string]string),
+			startupReconcileMode:   mode,
+			dataStore:              datastore.NewDataStore(log, datastore.NullCheckpoint{}, false),
+		}
+		c.dataStore.SetENIInventory(inventory)
+		return c
+	}
+
+	// The fast mode warm starts from the ENI inventory without a handoff marker
+	m.awsutils.EXPECT().GetAttachedENIs().Return([]awsutils.ENIMetadata{primaryENI}, nil)
+	c := newContext(startupReconcileFast)
+	handoff, err := c.setupENIsOnStart(false)
+	require.NoError(t, err)
+	assert.False(t, handoff)
+	ips, _, err := c.dataStore.GetENICIDRs(primaryENIid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ipaddr02}, ips)
+
+	// The normal mode needs one
+	m.awsutils.EXPECT().DescribeAllENIs().Return(awsutils.DescribeAllENIsResult{}, errors.New("throttled"))
+	_, err = newContext(startupReconcileNormal).setupENIsOnStart(false)
+	assert.Error(t, err)
+
+	// The deep mode ignores the handoff marker and takes the IPs from EC2
+	m.awsutils.EXPECT().DescribeAllENIs().Return(awsutils.DescribeAllENIsResult{ENIMetadata: []awsutils.ENIMetadata{primaryENI}}, nil)
+	m.awsutils.EXPECT().SetMultiCardENIs(gomock.Any())
+	m.awsutils.EXPECT().IsUnmanagedENI(primaryENIid).Return(false)
+	m.awsutils.EXPECT().IsMultiCardENI(primaryENIid).Return(false)
+	m.awsutils.EXPECT().GetIPv4sFromEC2(primaryENIid).Return([]*ec2.NetworkInterfacePrivateIpAddress{
+		{PrivateIpAddress: aws.String(ipaddr01), Primary: aws.Bool(true)},
+		{PrivateIpAddress: aws.String(ipaddr02), Primary: aws.Bool(false)},
+	}, nil)
+	m.awsutils.EXPECT().GetIPv4PrefixesFromEC2(primaryENIid).Return(nil, nil)
+	c = newContext(startupReconcileDeep)
+	c.dataStore = testDatastore()
+	handoff, err = c.setupENIsOnStart(true)
+	require.NoError(t, err)
+	assert.False(t, handoff)
+	ips, _, err = c.dataStore.GetENICIDRs(primaryENIid)
+	require.NoError(t, err)
+	assert.Equal(t, []string{ipaddr02}, ips)
+}
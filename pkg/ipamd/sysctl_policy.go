@@ -0,0 +1,116 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"os"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+const (
+	sysctlReconcileInterval = 30 * time.Second
+
+	sysctlConflictReason = "SysctlConflict"
+)
+
+// sysctlMonitor reconciles the sysctls of the node interfaces with the policy
+type sysctlMonitor struct {
+	policy []sysctlpolicy.Setting
+	// reported are the conflicts found by the last reconciliation, so that a lasting conflict is reported only once
+	reported map[string]bool
+}
+
+// MonitorSysctls sets the sysctls of the node interfaces, the sysctl policy of the CNIConfig replacing the defaults,
+// and sets them back when they are changed on the host
+func (c *IPAMContext) MonitorSysctls() {
+	m := &sysctlMonitor{policy: c.sysctlPolicy(context.TODO(), os.Getenv(envNodeName))}
+	for {
+		c.reconcileSysctls(m)
+		time.Sleep(sysctlReconcileInterval)
+	}
+}
+
+// reconcileSysctls applies the policy and reports the new conflicts with the configuration of the host
+func (c *IPAMContext) reconcileSysctls(m *sysctlMonitor) {
+	conflicts, err := c.networkClient.ReconcileSysctls(c.awsClient.GetPrimaryENImac(), c.enableIPv6, m.policy)
+	if err != nil {
+		log.Warnf("Failed to reconcile sysctls: %v", err)
+		return
+	}
+	reported := map[string]bool{}
+	for _, conflict := range conflicts {
+		message := conflict.String()
+		reported[message] = true
+		if m.reported[message] {
+			continue
+		}
+		log.Warnf("Sysctl conflicts with the host configuration: %s", message)
+		if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+			eventRecorder.SendPodEvent(v1.EventTypeWarning, sysctlConflictReason, "ReconcileSysctls", message)
+		}
+	}
+	m.reported = reported
+}
+
+// sysctlPolicy returns the settings of the first sysctl policy of the CNIConfig that matches the labels of the node
+func (c *IPAMContext) sysctlPolicy(ctx context.Context, nodeName string) []sysctlpolicy.Setting {
+	cfg, ok := c.getCNIConfig(ctx)
+	if !ok || len(cfg.Spec.SysctlPolicies) == 0 {
+		return nil
+	}
+	nodeLabels, err := c.nodeSelectorLabels(ctx, nodeName)
+	if err != nil {
+		log.Warnf("Failed to get node %s, using the default sysctls: %v", nodeName, err)
+		return nil
+	}
+
+	for i, policy := range cfg.Spec.SysctlPolicies {
+		selector, err := metav1.LabelSelectorAsSelector(&policy.NodeSelector)
+		if err != nil {
+			log.Warnf("Ignoring sysctl policy %d of CNIConfig %s: %v", i, cfg.Name, err)
+			continue
+		}
+		if !selector.Matches(nodeLabels) {
+			continue
+		}
+		log.Infof("Using sysctl policy %d (%s) of CNIConfig %s", i, selector.String(), cfg.Name)
+		var settings []sysctlpolicy.Setting
+		for _, intf := range policy.Interfaces {
+			// Sorted, so that the sysctls of an interface are set in the same order every time
+			keys := make([]string, 0, len(intf.Sysctls))
+			for key := range intf.Sysctls {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				setting := sysctlpolicy.Setting{Interface: intf.Interface, Key: key, Value: intf.Sysctls[key]}
+				if err := sysctlpolicy.Validate(setting); err != nil {
+					log.Warnf("Ignoring sysctl %s of interface %s in sysctl policy %d: %v", key, intf.Interface, i, err)
+					continue
+				}
+				settings = append(settings, setting)
+			}
+		}
+		return settings
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestSysctlPolicy(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	m.awsutils.EXPECT().GetInstanceType().Return("c6i.large").AnyTimes()
+	c := &IPAMContext{awsClient: m.awsutils, k8sClient: m.k8sClient}
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: myNodeName, Labels: map[string]string{
+		"eks.amazonaws.com/nodegroup": "hardened",
+	}}}
+	assert.NoError(t, m.k8sClient.Create(ctx, node))
+
+	// Without a CNIConfig, the defaults apply
+	assert.Empty(t, c.sysctlPolicy(ctx, myNodeName))
+
+	assert.NoError(t, m.k8sClient.Create(ctx, &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec: v1alpha1.CNIConfigSpec{SysctlPolicies: []v1alpha1.SysctlPolicy{
+			{
+				NodeSelector: metav1.LabelSelector{MatchLabels: map[string]string{instanceFamilyLabel: "m5"}},
+				Interfaces:   []v1alpha1.InterfaceSysctls{{Interface: "all", Sysctls: map[string]string{"ipv4/rp_filter": "0"}}},
+			},
+			{
+				NodeSelector: metav1.LabelSelector{MatchLabels: map[string]string{"eks.amazonaws.com/nodegroup": "hardened"}},
+				Interfaces: []v1alpha1.InterfaceSysctls{
+					{Interface: sysctlpolicy.PrimaryInterface, Sysctls: map[string]string{
+						"ipv4/rp_filter":    "1",
+						"ipv4/log_martians": "1",
+						"core/somaxconn":    "1024",
+					}},
+				},
+			},
+		}},
+	}))
+
+	// The first matching policy applies, and invalid sysctls are ignored
+	assert.Equal(t, []sysctlpolicy.Setting{
+		{Interface: sysctlpolicy.PrimaryInterface, Key: "ipv4/log_martians", Value: "1"},
+		{Interface: sysctlpolicy.PrimaryInterface, Key: "ipv4/rp_filter", Value: "1"},
+	}, c.sysctlPolicy(ctx, myNodeName))
+}
+
+func TestReconcileSysctls(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+	c := &IPAMContext{awsClient: m.awsutils, networkClient: m.network}
+	policy := []sysctlpolicy.Setting{{Interface: "all", Key: "ipv4/rp_filter", Value: "1"}}
+	monitor := &sysctlMonitor{policy: policy}
+	conflict := sysctlpolicy.Conflict{Entry: "net/ipv4/conf/all/rp_filter", Expected: "1", Found: "0", Reason: "read-only file system"}
+
+	m.awsutils.EXPECT().GetPrimaryENImac().Return(primaryMAC).Times(3)
+	m.network.EXPECT().ReconcileSysctls(primaryMAC, false, policy).Return([]sysctlpolicy.Conflict{conflict}, nil).Times(2)
+	m.network.EXPECT().ReconcileSysctls(primaryMAC, false, policy).Return(nil, nil)
+
+	// A lasting conflict is reported once
+	c.reconcileSysctls(monitor)
+	c.reconcileSysctls(monitor)
+	assert.Len(t, fakeRecorder.Events, 1)
+	<-fakeRecorder.Events
+
+	c.reconcileSysctls(monitor)
+	assert.Empty(t, monitor.reported)
+}
@@ -0,0 +1,126 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+const (
+	// terminationNoticeInterval is how often instance metadata is checked for a termination notice. EC2 gives two
+	// minutes of notice before a Spot interruption.
+	terminationNoticeInterval = 5 * time.Second
+
+	// nodeDrainInterval is how often unused ENIs and IPs are released while the node drains
+	nodeDrainInterval = 10 * time.Second
+)
+
+// Taints placed on a node that is about to be removed by cluster-autoscaler or Karpenter. A cordon alone is not
+// included, nodes are also cordoned for maintenance and pods tolerating it are still scheduled to them.
+var scaleDownTaintKeys = map[string]bool{
+	"ToBeDeletedByClusterAutoscaler": true,
+	"karpenter.sh/disrupted":         true,
+	"karpenter.sh/disruption":        true,
+}
+
+// MonitorNodeTermination waits for a Spot interruption notice or an Auto Scaling termination, then stops allocating
+// IPs to new pods and keeps releasing the ENIs and IPs that are no longer used until the node is gone. A notice can be
+// withdrawn, for instance when an instance of a warm pool resumes from hibernation, and IPs are allocated again then.
+func (c *IPAMContext) MonitorNodeTermination() {
+	if !c.enableIPv4 {
+		// In IPv6 mode, all pods get their IP from the prefix on the primary ENI, there is nothing to release
+		return
+	}
+
+	ctx := context.Background()
+	var lastDrain time.Time
+	for {
+		if c.checkTerminationNotice(ctx) && !c.disableENIProvisioning && time.Since(lastDrain) >= nodeDrainInterval {
+			c.ipPoolLock.Lock()
+			c.drainNode()
+			c.ipPoolLock.Unlock()
+			lastDrain = time.Now()
+		}
+		time.Sleep(terminationNoticeInterval)
+	}
+}
+
+// checkTerminationNotice makes the data store read-only when a termination notice appears, and lets it allocate IPs
+// again when the notice is gone. It returns whether the node is going away.
+func (c *IPAMContext) checkTerminationNotice(ctx context.Context) bool {
+	readOnly := c.dataStore.IsReadOnly()
+	notice, err := c.awsClient.GetTerminationNotice(ctx)
+	if err != nil {
+		log.Debugf("Failed to check for a termination notice: %v", err)
+		return readOnly
+	}
+	if notice != "" && !readOnly {
+		log.Infof("Node is going away (%s), no longer allocating IPs to new pods", notice)
+		c.dataStore.SetReadOnly()
+	} else if notice == "" && readOnly {
+		log.Infof("Termination notice was withdrawn, allocating IPs to new pods again")
+		c.dataStore.ClearReadOnly()
+	}
+	return notice != ""
+}
+
+// isNodeScalingDown returns whether the node is tainted for removal by an autoscaler
+func (c *IPAMContext) isNodeScalingDown(ctx context.Context) bool {
+	var node corev1.Node
+	if err := c.k8sClient.Get(ctx, types.NamespacedName{Name: c.myNodeName}, &node); err != nil {
+		log.Errorf("Failed to get node while checking for scale-down: %v", err)
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if scaleDownTaintKeys[taint.Key] {
+			return true
+		}
+	}
+	return false
+}
+
+// drainNode detaches the ENIs without pods and frees the IPs and prefixes whose cooldown has passed. The caller holds
+// ipPoolLock.
+func (c *IPAMContext) drainNode() {
+	for eni := c.dataStore.RemoveIdleENIFromStore(); eni != ""; eni = c.dataStore.RemoveIdleENIFromStore() {
+		log.Infof("Detaching idle ENI %s of the draining node", eni)
+		if err := c.awsClient.FreeENI(eni); err != nil {
+			ipamdErrInc("drainNodeFreeENIFailed")
+			log.Errorf("Failed to free ENI %s, err: %v", eni, err)
+		}
+	}
+
+	for eniID := range c.dataStore.GetENIInfos().ENIs {
+		var deletedCidrs []datastore.CidrInfo
+		for _, toDelete := range c.dataStore.FindCooledDownCidrs(eniID) {
+			// Without force, the Cidr is kept if a pod got one of its IPs in the meantime
+			if err := c.dataStore.DelIPv4CidrFromStore(eniID, toDelete.Cidr, false /* force */); err != nil {
+				log.Warnf("Failed to delete Cidr %s on ENI %s from datastore: %s", toDelete.Cidr.String(), eniID, err)
+				continue
+			}
+			deletedCidrs = append(deletedCidrs, toDelete)
+		}
+		if len(deletedCidrs) > 0 {
+			log.Infof("Freeing %d unused IPs/prefixes of ENI %s on the draining node", len(deletedCidrs), eniID)
+			c.DeallocCidrs(eniID, deletedCidrs)
+		}
+	}
+	c.lastNodeIPPoolAction = time.Now()
+}
@@ -0,0 +1,116 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestDrainNode(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	mockContext := &IPAMContext{
+		awsClient:  m.awsutils,
+		enableIPv4: true,
+		dataStore:  datastore.NewDataStore(log, datastore.NullCheckpoint{}, false),
+	}
+	mockContext.reconcileCooldownCache.cache = make(map[string]time.Time)
+	ds := mockContext.dataStore
+	_ = ds.AddENI(primaryENIid, primaryDevice, true, false, false)
+	for _, ip := range []string{ipaddr01, ipaddr02} {
+		_ = ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	podIP, _, err := ds.AssignPodIPv4Address(datastore.IPAMKey{NetworkName: "net0", ContainerID: "sandbox", IfName: "eth0"},
+		datastore.IPAMMetadata{K8SPodNamespace: "default", K8SPodName: "sample-pod"})
+	assert.NoError(t, err)
+	freeIP := ipaddr01
+	if podIP == ipaddr01 {
+		freeIP = ipaddr02
+	}
+	_ = ds.AddENI(secENIid, secDevice, false, false, false)
+	_ = ds.AddIPv4CidrToStore(secENIid, net.IPNet{IP: net.ParseIP(ipaddr11), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	ds.SetReadOnly()
+
+	// The secondary ENI has no pods and is detached, the free IP of the primary ENI is released
+	m.awsutils.EXPECT().FreeENI(secENIid).Return(nil)
+	m.awsutils.EXPECT().DeallocIPAddresses(primaryENIid, []string{freeIP}).Return(nil)
+	m.awsutils.EXPECT().DeallocPrefixAddresses(primaryENIid, gomock.Len(0)).Return(nil)
+	mockContext.drainNode()
+
+	// Nothing is left to release
+	mockContext.drainNode()
+	assert.Equal(t, 1, ds.GetIPStats(ipV4AddrFamily).TotalIPs)
+}
+
+func TestCheckTerminationNotice(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	mockContext := &IPAMContext{
+		awsClient: m.awsutils,
+		dataStore: datastore.NewDataStore(log, datastore.NullCheckpoint{}, false),
+	}
+
+	m.awsutils.EXPECT().GetTerminationNotice(ctx).Return("", nil)
+	assert.False(t, mockContext.checkTerminationNotice(ctx))
+	assert.False(t, mockContext.dataStore.IsReadOnly())
+
+	m.awsutils.EXPECT().GetTerminationNotice(ctx).Return("auto scaling target lifecycle state Warmed:Hibernated", nil)
+	assert.True(t, mockContext.checkTerminationNotice(ctx))
+	assert.True(t, mockContext.dataStore.IsReadOnly())
+
+	// The node keeps draining while instance metadata cannot be read
+	m.awsutils.EXPECT().GetTerminationNotice(ctx).Return("", errors.New("imds unavailable"))
+	assert.True(t, mockContext.checkTerminationNotice(ctx))
+	assert.True(t, mockContext.dataStore.IsReadOnly())
+
+	// The instance resumed from the warm pool
+	m.awsutils.EXPECT().GetTerminationNotice(ctx).Return("", nil)
+	assert.False(t, mockContext.checkTerminationNotice(ctx))
+	assert.False(t, mockContext.dataStore.IsReadOnly())
+}
+
+func TestIsNodeScalingDown(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	mockContext := &IPAMContext{k8sClient: m.k8sClient, myNodeName: myNodeName}
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: myNodeName}}
+	assert.NoError(t, m.k8sClient.Create(ctx, node))
+	assert.False(t, mockContext.isNodeScalingDown(ctx))
+
+	node.Spec.Taints = []corev1.Taint{{Key: "ToBeDeletedByClusterAutoscaler", Effect: corev1.TaintEffectNoSchedule}}
+	assert.NoError(t, m.k8sClient.Update(ctx, node))
+	assert.True(t, mockContext.isNodeScalingDown(ctx))
+
+	// A cordoned node may only be under maintenance
+	node.Spec.Taints = []corev1.Taint{{Key: corev1.TaintNodeUnschedulable, Effect: corev1.TaintEffectNoSchedule}}
+	node.Spec.Unschedulable = true
+	assert.NoError(t, m.k8sClient.Update(ctx, node))
+	assert.False(t, mockContext.isNodeScalingDown(ctx))
+}
@@ -0,0 +1,92 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+// envUnmanagedENITags is a JSON object of the tags that mark ENIs as unmanaged, in addition to the no_manage tag. An
+// empty value matches any value of the tag.
+const envUnmanagedENITags = "UNMANAGED_ENI_TAGS"
+
+// loadUnmanagedENITags loads the tags that mark ENIs as unmanaged from environment variables
+func loadUnmanagedENITags() map[string]string {
+	value := os.Getenv(envUnmanagedENITags)
+	if value == "" {
+		return nil
+	}
+	var tags map[string]string
+	if err := json.Unmarshal([]byte(value), &tags); err != nil {
+		log.Warnf("Ignoring invalid %s %q: %v", envUnmanagedENITags, value, err)
+		return nil
+	}
+	return tags
+}
+
+// unmanagedReason returns why ipamd does not manage an ENI, or an empty string when it does
+func (c *IPAMContext) unmanagedReason(eniID string, tags awsutils.TagMap, result awsutils.DescribeAllENIsResult) string {
+	// EXCLUDED_ENIS and INCLUDED_ENIS take precedence over the tags
+	if result.ExcludedENIs[eniID] {
+		return "excluded by EXCLUDED_ENIS"
+	}
+	if result.IncludedENIs[eniID] {
+		return ""
+	}
+	// The tags are checked in order, so that the reason is the same on every reconcile
+	keys := make([]string, 0, len(c.unmanagedENITags))
+	for key := range c.unmanagedENITags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if value, found := tags[key]; found && (c.unmanagedENITags[key] == "" || value == c.unmanagedENITags[key]) {
+			return fmt.Sprintf("tagged %s=%s", key, value)
+		}
+	}
+	// if "no_manage" tag is present and is true - ENI is unmanaged
+	// if "no_manage" tag is present and is "not true" - ENI is managed
+	// if "instance_id" tag is present and is set to instanceID - ENI is managed since this was created by IPAMD
+	// if "no_manage" tag is not present or not IPAMD created ENI, check if we are in Manage Untagged Mode, default is true.
+	// if enableManageUntaggedMode is false, then consider all untagged ENIs as unmanaged.
+	if value, found := tags[eniNoManageTagKey]; found {
+		if value == "true" {
+			return fmt.Sprintf("tagged %s=true", eniNoManageTagKey)
+		}
+		return ""
+	}
+	if value, found := tags[eniNodeTagKey]; found && value == c.awsClient.GetInstanceID() {
+		return ""
+	}
+	if !c.enableManageUntaggedMode {
+		return fmt.Sprintf("untagged with %s=false", envManageUntaggedENI)
+	}
+	return ""
+}
+
+// UnmanagedENIs returns the reasons ipamd does not manage the ENIs, by ENI ID
+func (c *IPAMContext) UnmanagedENIs() map[string]string {
+	c.unmanagedENIsLock.RLock()
+	defer c.unmanagedENIsLock.RUnlock()
+	unmanagedENIs := make(map[string]string, len(c.unmanagedENIs))
+	for eniID, reason := range c.unmanagedENIs {
+		unmanagedENIs[eniID] = reason
+	}
+	return unmanagedENIs
+}
@@ -0,0 +1,76 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+func TestLoadUnmanagedENITags(t *testing.T) {
+	assert.Nil(t, loadUnmanagedENITags())
+	t.Setenv(envUnmanagedENITags, "not json")
+	assert.Nil(t, loadUnmanagedENITags())
+	t.Setenv(envUnmanagedENITags, `{"appliance": "", "team": "storage"}`)
+	assert.Equal(t, map[string]string{"appliance": "", "team": "storage"}, loadUnmanagedENITags())
+}
+
+func TestSetUnmanagedENIsWithTags(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	mockContext := &IPAMContext{
+		awsClient:                m.awsutils,
+		enableManageUntaggedMode: true,
+		unmanagedENITags:         map[string]string{"appliance": "", "team": "storage"},
+	}
+	m.awsutils.EXPECT().GetPrimaryENI().Return(primaryENIid).AnyTimes()
+	m.awsutils.EXPECT().GetInstanceID().Return(instanceID).AnyTimes()
+	m.awsutils.EXPECT().SetUnmanagedENIs(gomock.Any()).Do(func(eniIDs []string) {
+		sort.Strings(eniIDs)
+		assert.Equal(t, []string{"eni-appliance", "eni-excluded", "eni-storage"}, eniIDs)
+	})
+
+	mockContext.setUnmanagedENIs(awsutils.DescribeAllENIsResult{
+		TagMap: map[string]awsutils.TagMap{
+			primaryENIid:    {"appliance": "firewall"},
+			"eni-appliance": {"appliance": "firewall"},
+			"eni-storage":   {"team": "storage", eniNodeTagKey: instanceID},
+			"eni-web":       {"team": "web"},
+			"eni-excluded":  {},
+			"eni-included":  {"appliance": "firewall"},
+		},
+		ExcludedENIs: map[string]bool{"eni-excluded": true},
+		IncludedENIs: map[string]bool{"eni-included": true},
+	})
+	assert.Equal(t, map[string]string{
+		"eni-appliance": "tagged appliance=firewall",
+		"eni-storage":   "tagged team=storage",
+		"eni-excluded":  "excluded by EXCLUDED_ENIS",
+	}, mockContext.UnmanagedENIs())
+
+	rr := httptest.NewRecorder()
+	unmanagedENIsV1RequestHandler(mockContext)(rr, httptest.NewRequest("GET", "/v1/unmanaged-enis", nil))
+	var unmanagedENIs map[string]string
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &unmanagedENIs))
+	assert.Len(t, unmanagedENIs, 3)
+}
@@ -0,0 +1,221 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+const (
+	// envUsageAttributionCR also writes the usage of the node to a VPCResourceUsage named after the node
+	envUsageAttributionCR = "ENABLE_USAGE_ATTRIBUTION_CR"
+
+	// usageAttributionInterval is how often the usage by namespace is exported
+	usageAttributionInterval = time.Minute
+
+	// podENIAnnotation lists the branch ENIs of a pod with its own security groups
+	podENIAnnotation = "vpc.amazonaws.com/pod-eni"
+)
+
+// namespaceUsage is the VPC resources consumed by the pods of a namespace. The ENIs and prefixes are shares of the
+// resources the namespace uses with others.
+type namespaceUsage struct {
+	pods       map[string]bool
+	ips        int
+	enis       float64
+	prefixes   float64
+	branchENIs int
+	eips       int
+}
+
+// MonitorUsageAttribution exports the VPC resources consumed by each namespace on the node as metrics, and to a
+// VPCResourceUsage when enabled, so that they can be charged back to the tenants of the cluster
+func (c *IPAMContext) MonitorUsageAttribution() {
+	nodeName := os.Getenv(envNodeName)
+	writeCR := parseBoolEnvVar(envUsageAttributionCR, false)
+	for {
+		// The export is skipped while ipamd sheds work, the metrics keep their last values
+		if c.degradationLevel() < degradationShedding {
+			usage, err := c.vpcResourceUsage(context.TODO(), nodeName)
+			if err != nil {
+				log.Warnf("Failed to compute the VPC resource usage by namespace: %v", err)
+			} else {
+				exportUsageMetrics(usage)
+				if writeCR {
+					writeCR = c.writeVPCResourceUsage(context.TODO(), nodeName, usage)
+				}
+			}
+		}
+		time.Sleep(usageAttributionInterval)
+	}
+}
+
+// vpcResourceUsage attributes the IPs, ENIs and prefixes of the datastore, the carrier IPs and the branch ENIs of the
+// pods of the node to their namespaces
+func (c *IPAMContext) vpcResourceUsage(ctx context.Context, nodeName string) (map[string]*namespaceUsage, error) {
+	usage := map[string]*namespaceUsage{}
+	namespace := func(name string) *namespaceUsage {
+		u, ok := usage[name]
+		if !ok {
+			u = &namespaceUsage{pods: map[string]bool{}}
+			usage[name] = u
+		}
+		return u
+	}
+
+	ipNamespaces := map[string]string{}
+	for _, eni := range c.dataStore.GetENIInfos().ENIs {
+		eniIPs := map[string]int{}
+		eniAssigned := 0
+		for _, cidrs := range []map[string]*datastore.CidrInfo{eni.AvailableIPv4Cidrs, eni.IPv6Cidrs} {
+			for _, cidr := range cidrs {
+				cidrIPs := map[string]int{}
+				for _, addr := range cidr.IPAddresses {
+					if !addr.Assigned() {
+						continue
+					}
+					ns := addr.IPAMMetadata.K8SPodNamespace
+					u := namespace(ns)
+					u.ips++
+					u.pods[addr.IPAMMetadata.K8SPodName] = true
+					ipNamespaces[addr.Address] = ns
+					cidrIPs[ns]++
+				}
+				assigned := cidr.AssignedIPAddressesInCidr()
+				for ns, n := range cidrIPs {
+					if cidr.IsPrefix {
+						namespace(ns).prefixes += float64(n) / float64(assigned)
+					}
+					eniIPs[ns] += n
+				}
+				eniAssigned += assigned
+			}
+		}
+		// The primary ENI comes with the instance, the trunk ENI with Security Groups for Pods
+		if eni.IsPrimary || eni.IsTrunk {
+			continue
+		}
+		for ns, n := range eniIPs {
+			namespace(ns).enis += float64(n) / float64(eniAssigned)
+		}
+	}
+
+	c.carrierIPLock.Lock()
+	for ipv4Addr := range c.carrierIPs {
+		if ns, ok := ipNamespaces[ipv4Addr]; ok {
+			namespace(ns).eips++
+		}
+	}
+	c.carrierIPLock.Unlock()
+
+	var pods corev1.PodList
+	if err := c.k8sClient.List(ctx, &pods); err != nil {
+		return nil, err
+	}
+	for _, pod := range pods.Items {
+		if pod.Spec.NodeName != nodeName || pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		val, ok := pod.Annotations[podENIAnnotation]
+		if !ok {
+			continue
+		}
+		var podENIData []PodENIData
+		if err := json.Unmarshal([]byte(val), &podENIData); err != nil {
+			log.Debugf("Ignoring the invalid %s annotation of pod %s/%s: %v", podENIAnnotation, pod.Namespace, pod.Name, err)
+			continue
+		}
+		u := namespace(pod.Namespace)
+		u.branchENIs += len(podENIData)
+		u.pods[pod.Name] = true
+	}
+	return usage, nil
+}
+
+// exportUsageMetrics replaces the metrics of the usage by namespace, so that the namespaces without pods left are
+// removed
+func exportUsageMetrics(usage map[string]*namespaceUsage) {
+	prometheusmetrics.NamespaceVPCResources.Reset()
+	for ns, u := range usage {
+		prometheusmetrics.NamespaceVPCResources.WithLabelValues(ns, "pods").Set(float64(len(u.pods)))
+		prometheusmetrics.NamespaceVPCResources.WithLabelValues(ns, "ips").Set(float64(u.ips))
+		prometheusmetrics.NamespaceVPCResources.WithLabelValues(ns, "enis").Set(u.enis)
+		prometheusmetrics.NamespaceVPCResources.WithLabelValues(ns, "prefixes").Set(u.prefixes)
+		prometheusmetrics.NamespaceVPCResources.WithLabelValues(ns, "branch_enis").Set(float64(u.branchENIs))
+		prometheusmetrics.NamespaceVPCResources.WithLabelValues(ns, "eips").Set(float64(u.eips))
+	}
+}
+
+// vpcResourceUsageStatus returns the usage in the status of a VPCResourceUsage, sorted by namespace
+func vpcResourceUsageStatus(instanceID string, usage map[string]*namespaceUsage) v1alpha1.VPCResourceUsageStatus {
+	status := v1alpha1.VPCResourceUsageStatus{InstanceID: instanceID, UpdateTime: metav1.Now()}
+	for ns, u := range usage {
+		status.Namespaces = append(status.Namespaces, v1alpha1.NamespaceVPCResourceUsage{
+			Namespace:  ns,
+			Pods:       len(u.pods),
+			IPs:        u.ips,
+			ENIs:       *resource.NewMilliQuantity(int64(math.Round(u.enis*1000)), resource.DecimalSI),
+			Prefixes:   *resource.NewMilliQuantity(int64(math.Round(u.prefixes*1000)), resource.DecimalSI),
+			BranchENIs: u.branchENIs,
+			EIPs:       u.eips,
+		})
+	}
+	sort.Slice(status.Namespaces, func(i, j int) bool {
+		return status.Namespaces[i].Namespace < status.Namespaces[j].Namespace
+	})
+	return status
+}
+
+// writeVPCResourceUsage writes the usage to the VPCResourceUsage of the node, created owned by the node so that it is
+// deleted with it. It returns false when the CRD is not installed, and the usage should no longer be written.
+func (c *IPAMContext) writeVPCResourceUsage(ctx context.Context, nodeName string, usage map[string]*namespaceUsage) bool {
+	cr := &v1alpha1.VPCResourceUsage{
+		ObjectMeta: metav1.ObjectMeta{Name: nodeName},
+		Status:     vpcResourceUsageStatus(c.awsClient.GetInstanceID(), usage),
+	}
+	// A merge patch replaces the list of namespaces, without reading the VPCResourceUsages of all the nodes
+	err := c.k8sClient.Patch(ctx, cr, client.Merge)
+	if apierrors.IsNotFound(err) {
+		var node corev1.Node
+		if err = c.k8sClient.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err == nil {
+			cr.OwnerReferences = []metav1.OwnerReference{{APIVersion: "v1", Kind: "Node", Name: node.Name, UID: node.UID}}
+			err = c.k8sClient.Create(ctx, cr)
+		}
+	}
+	if meta.IsNoMatchError(err) {
+		log.Warnf("Not writing the VPC resource usage of the node, the VPCResourceUsage CRD is not installed")
+		return false
+	}
+	if err != nil {
+		log.Warnf("Failed to write the VPCResourceUsage of node %s: %v", nodeName, err)
+	}
+	return true
+}
@@ -0,0 +1,128 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/prometheusmetrics"
+)
+
+func usageTestContext(t *testing.T, m *testMocks) *IPAMContext {
+	ds := testDatastorewithPrefix()
+	assert.NoError(t, ds.AddENI(primaryENIid, primaryDevice, true, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore(primaryENIid, net.IPNet{IP: net.ParseIP("10.0.0.16"), Mask: net.CIDRMask(28, 32)}, true))
+	assign := func(i int, namespace string) string {
+		ip, _, err := ds.AssignPodIPv4Address(datastore.IPAMKey{NetworkName: "net0", ContainerID: fmt.Sprint(i), IfName: "eth0"},
+			datastore.IPAMMetadata{K8SPodNamespace: namespace, K8SPodName: fmt.Sprintf("pod-%d", i)})
+		assert.NoError(t, err)
+		return ip
+	}
+	// kube-system fills the primary ENI, the other namespaces share eni-1
+	for i := 0; i < 16; i++ {
+		assign(i, "kube-system")
+	}
+	assert.NoError(t, ds.AddENI("eni-1", 1, false, false, false))
+	assert.NoError(t, ds.AddIPv4CidrToStore("eni-1", net.IPNet{IP: net.ParseIP("10.0.1.16"), Mask: net.CIDRMask(28, 32)}, true))
+	assign(16, "batch")
+	assign(17, "batch")
+	assign(18, "batch")
+	edge := assign(19, "web")
+	return &IPAMContext{
+		awsClient:  m.awsutils,
+		k8sClient:  m.k8sClient,
+		dataStore:  ds,
+		enableIPv4: true,
+		carrierIPs: map[string]string{edge: "155.146.0.10"},
+	}
+}
+
+func TestVPCResourceUsage(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	c := usageTestContext(t, m)
+
+	branchPod := func(name, nodeName string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Namespace:   "web",
+				Annotations: map[string]string{podENIAnnotation: `[{"eniId":"eni-branch","vlanID":1}]`},
+			},
+			Spec: corev1.PodSpec{NodeName: nodeName},
+		}
+	}
+	assert.NoError(t, m.k8sClient.Create(ctx, branchPod("secure", "node-1")))
+	assert.NoError(t, m.k8sClient.Create(ctx, branchPod("elsewhere", "node-2")))
+
+	usage, err := c.vpcResourceUsage(ctx, "node-1")
+	assert.NoError(t, err)
+	assert.Len(t, usage, 3)
+	// The primary ENI and its prefix are only used by kube-system, but the primary ENI is not charged
+	assert.Equal(t, &namespaceUsage{pods: usage["kube-system"].pods, ips: 16, prefixes: 1}, usage["kube-system"])
+	assert.Len(t, usage["kube-system"].pods, 16)
+	assert.Equal(t, 3, usage["batch"].ips)
+	assert.Equal(t, 0.75, usage["batch"].enis)
+	assert.Equal(t, 0.75, usage["batch"].prefixes)
+	assert.Equal(t, 1, usage["web"].ips)
+	assert.Equal(t, 0.25, usage["web"].enis)
+	assert.Equal(t, 1, usage["web"].eips)
+	assert.Equal(t, 1, usage["web"].branchENIs)
+	assert.Len(t, usage["web"].pods, 2)
+
+	exportUsageMetrics(usage)
+	assert.Equal(t, 0.25, testutil.ToFloat64(prometheusmetrics.NamespaceVPCResources.WithLabelValues("web", "enis")))
+	exportUsageMetrics(map[string]*namespaceUsage{})
+	assert.Equal(t, 0, testutil.CollectAndCount(prometheusmetrics.NamespaceVPCResources))
+}
+
+func TestWriteVPCResourceUsage(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	c := usageTestContext(t, m)
+	m.awsutils.EXPECT().GetInstanceID().Return(instanceID).AnyTimes()
+	assert.NoError(t, m.k8sClient.Create(ctx, &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node-1", UID: "node-uid"}}))
+
+	usage, err := c.vpcResourceUsage(ctx, "node-1")
+	assert.NoError(t, err)
+	assert.True(t, c.writeVPCResourceUsage(ctx, "node-1", usage))
+
+	var cr v1alpha1.VPCResourceUsage
+	assert.NoError(t, m.k8sClient.Get(ctx, types.NamespacedName{Name: "node-1"}, &cr))
+	assert.Equal(t, types.UID("node-uid"), cr.OwnerReferences[0].UID)
+	assert.Equal(t, instanceID, cr.Status.InstanceID)
+	assert.Equal(t, []string{"batch", "kube-system", "web"}, []string{
+		cr.Status.Namespaces[0].Namespace, cr.Status.Namespaces[1].Namespace, cr.Status.Namespaces[2].Namespace})
+	assert.Equal(t, "750m", cr.Status.Namespaces[0].ENIs.String())
+
+	// The namespaces without pods left are removed
+	delete(usage, "batch")
+	assert.True(t, c.writeVPCResourceUsage(ctx, "node-1", usage))
+	assert.NoError(t, m.k8sClient.Get(ctx, types.NamespacedName{Name: "node-1"}, &cr))
+	assert.Len(t, cr.Status.Namespaces, 2)
+	assert.Equal(t, "kube-system", cr.Status.Namespaces[0].Namespace)
+}
@@ -0,0 +1,129 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	v1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/eniconfig"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+	"github.com/aws/amazon-vpc-cni-k8s/utils"
+)
+
+const invalidConfigurationReason = "InvalidConfiguration"
+
+// ValidateConfig checks the configuration in the environment, the ENIConfig of the node and the EC2 subnet, security
+// groups and permissions it needs. Nothing is changed on the node, so it can run before ipamd is started.
+func ValidateConfig(ctx context.Context, k8sClient client.Client) error {
+	c, err := newIPAMContext(k8sClient, true)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	// With subnet discovery, nodes without an ENIConfig use the subnets tagged for the CNI in their zone
+	if c.useCustomNetworking && !c.useSubnetDiscovery {
+		if _, err := eniconfig.MyENIConfig(ctx, k8sClient); err != nil {
+			errs = append(errs, fmt.Errorf("custom networking is enabled but no ENIConfig could be found for this node: %v", err))
+		}
+	}
+	errs = append(errs, c.validateZoneConfig()...)
+	errs = append(errs, c.validateEC2Config(ctx)...)
+	errs = append(errs, c.validateEgressConfig(ctx)...)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Errorf("invalid configuration:\n  %s", strings.Join(msgs, "\n  "))
+}
+
+// validateStartupConfig checks the configuration against the zone of the node and EC2 when ipamd starts. Each failure
+// is logged and raised as a warning event on the aws-node pod, ipamd only fails to start on them when
+// ENABLE_STRICT_STARTUP_CONFIG_VALIDATION is set, since a DryRun may be denied by a policy that the real call passes.
+func (c *IPAMContext) validateStartupConfig(ctx context.Context) error {
+	errs := append(c.validateZoneConfig(), c.validateEC2Config(ctx)...)
+	errs = append(errs, c.validateEgressConfig(ctx)...)
+	if len(errs) == 0 {
+		return nil
+	}
+	for _, err := range errs {
+		log.Warnf("Invalid configuration: %v", err)
+		if eventRecorder := eventrecorder.Get(); eventRecorder != nil {
+			eventRecorder.SendPodEvent(v1.EventTypeWarning, invalidConfigurationReason, "ValidateConfig", err.Error())
+		}
+	}
+	if utils.GetBoolAsStringEnvVar(envEnableStrictStartupConfigValidation, false) {
+		return fmt.Errorf("ipamd: failed to validate configuration against EC2")
+	}
+	return nil
+}
+
+// validateZoneConfig checks the configuration against the type of the zone of the node
+func (c *IPAMContext) validateZoneConfig() []error {
+	var errs []error
+	// There is no NAT gateway in a Wavelength Zone, the pods without a carrier IP of their own reach the carrier
+	// network through SNAT to the primary IP of the primary ENI, which carries the carrier IP of the node
+	if c.awsClient.InWavelengthZone() && c.networkClient.UseExternalSNAT() {
+		errs = append(errs, fmt.Errorf("AWS_VPC_K8S_CNI_EXTERNALSNAT is set in a Wavelength Zone, where pods without "+
+			"a carrier IP can only reach the carrier network through SNAT to the primary IP of the primary ENI"))
+	}
+	// Carrier IPs are associated with private IPs, not with the IPs of a prefix
+	if c.enablePodCarrierIP && (c.enablePrefixDelegation || !c.enableIPv4) {
+		errs = append(errs, fmt.Errorf("ENABLE_POD_CARRIER_IP needs IPv4 without ENABLE_PREFIX_DELEGATION, carrier "+
+			"IPs can only be associated with secondary IPs"))
+	}
+	return errs
+}
+
+// validateEC2Config checks the subnet, security groups and permissions that ipamd uses to allocate ENIs against EC2
+func (c *IPAMContext) validateEC2Config(ctx context.Context) []error {
+	subnetID, securityGroups, checkENIProvisioning := c.eniProvisioningConfig(ctx)
+	return c.awsClient.ValidateEC2Config(ctx, subnetID, securityGroups, checkENIProvisioning)
+}
+
+// validateEgressConfig checks that the VPC provides the NAT64 and DNS64 that the pods of an IPv6 cluster rely on to
+// reach IPv4 endpoints when IPv4 egress goes through NAT64
+func (c *IPAMContext) validateEgressConfig(ctx context.Context) []error {
+	if !c.enableIPv6 || !enableV4EgressNAT64() {
+		return nil
+	}
+	return c.awsClient.ValidateNAT64Config(ctx)
+}
+
+// eniProvisioningConfig returns the subnet and security groups of the ENIConfig of the node when custom networking is
+// enabled, and whether ipamd allocates ENIs. Empty values stand for the subnet and security groups of the primary ENI.
+func (c *IPAMContext) eniProvisioningConfig(ctx context.Context) (string, []*string, bool) {
+	if c.disableENIProvisioning {
+		return "", nil, false
+	}
+	if !c.useCustomNetworking {
+		return "", nil, true
+	}
+	eniCfg, err := eniconfig.MyENIConfig(ctx, c.k8sClient)
+	if err != nil {
+		// Without an ENIConfig, there is no subnet to allocate ENIs in yet
+		return "", nil, false
+	}
+	return eniCfg.Subnet, aws.StringSlice(eniCfg.SecurityGroups), true
+}
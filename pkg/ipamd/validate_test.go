@@ -0,0 +1,132 @@
+package ipamd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/eventrecorder"
+)
+
+func TestValidateEC2Config(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	_ = os.Setenv("MY_NODE_NAME", myNodeName)
+
+	mockContext := &IPAMContext{
+		awsClient: m.awsutils,
+		k8sClient: m.k8sClient,
+	}
+
+	// Without custom networking, the primary ENI subnet and security groups are checked
+	m.awsutils.EXPECT().ValidateEC2Config(ctx, "", nil, true).Return(nil)
+	assert.Empty(t, mockContext.validateEC2Config(ctx))
+
+	// With custom networking but no ENIConfig yet, ENI provisioning can not be checked
+	mockContext.useCustomNetworking = true
+	m.awsutils.EXPECT().ValidateEC2Config(ctx, "", nil, false).Return(nil)
+	assert.Empty(t, mockContext.validateEC2Config(ctx))
+
+	// With an ENIConfig, its subnet and security groups are checked
+	fakeNode := v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: myNodeName, Labels: map[string]string{"k8s.amazonaws.com/eniConfig": "az1"}},
+	}
+	assert.NoError(t, m.k8sClient.Create(ctx, &fakeNode))
+	fakeENIConfig := v1alpha1.ENIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "az1"},
+		Spec:       v1alpha1.ENIConfigSpec{Subnet: "subnet1", SecurityGroups: []string{"sg1-id"}},
+	}
+	assert.NoError(t, m.k8sClient.Create(ctx, &fakeENIConfig))
+	m.awsutils.EXPECT().ValidateEC2Config(ctx, "subnet1", aws.StringSlice([]string{"sg1-id"}), true).Return(nil)
+	assert.Empty(t, mockContext.validateEC2Config(ctx))
+
+	// ENI provisioning is not checked when it is disabled
+	mockContext.disableENIProvisioning = true
+	m.awsutils.EXPECT().ValidateEC2Config(ctx, "", nil, false).Return(nil)
+	assert.Empty(t, mockContext.validateEC2Config(ctx))
+}
+
+func TestValidateZoneConfig(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	mockContext := &IPAMContext{
+		awsClient:     m.awsutils,
+		networkClient: m.network,
+	}
+
+	m.awsutils.EXPECT().InWavelengthZone().Return(false)
+	assert.Empty(t, mockContext.validateZoneConfig())
+
+	// Pods without a carrier IP reach the carrier network through SNAT to the primary IP of the primary ENI
+	m.awsutils.EXPECT().InWavelengthZone().Return(true)
+	m.network.EXPECT().UseExternalSNAT().Return(false)
+	assert.Empty(t, mockContext.validateZoneConfig())
+
+	m.awsutils.EXPECT().InWavelengthZone().Return(true)
+	m.network.EXPECT().UseExternalSNAT().Return(true)
+	assert.Len(t, mockContext.validateZoneConfig(), 1)
+
+	// Carrier IPs are associated with secondary IPs
+	mockContext.enablePodCarrierIP = true
+	mockContext.enableIPv4 = true
+	m.awsutils.EXPECT().InWavelengthZone().Return(true)
+	m.network.EXPECT().UseExternalSNAT().Return(false)
+	assert.Empty(t, mockContext.validateZoneConfig())
+
+	mockContext.enablePrefixDelegation = true
+	m.awsutils.EXPECT().InWavelengthZone().Return(true)
+	m.network.EXPECT().UseExternalSNAT().Return(false)
+	assert.Len(t, mockContext.validateZoneConfig(), 1)
+}
+
+func TestValidateEgressConfig(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+
+	mockContext := &IPAMContext{awsClient: m.awsutils, enableIPv6: true}
+
+	// IPv4 egress through SNAT to the node IPv4 address needs nothing from the VPC
+	assert.Empty(t, mockContext.validateEgressConfig(ctx))
+
+	t.Setenv(envEnableV4EgressNAT64, "true")
+	m.awsutils.EXPECT().ValidateNAT64Config(ctx).Return([]error{errors.New("DNS64 is not enabled")})
+	assert.Len(t, mockContext.validateEgressConfig(ctx), 1)
+
+	// IPv4 clusters have no IPv4 egress to set up
+	mockContext.enableIPv6 = false
+	assert.Empty(t, mockContext.validateEgressConfig(ctx))
+}
+
+func TestValidateStartupConfig(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	fakeRecorder := eventrecorder.InitMockEventRecorder()
+
+	mockContext := &IPAMContext{awsClient: m.awsutils, networkClient: m.network}
+	expectInvalidConfig := func() {
+		m.awsutils.EXPECT().InWavelengthZone().Return(false)
+		m.awsutils.EXPECT().ValidateEC2Config(ctx, "", nil, true).Return([]error{errors.New("subnet does not exist")})
+	}
+
+	// Failures are reported, but ipamd still starts
+	expectInvalidConfig()
+	assert.NoError(t, mockContext.validateStartupConfig(ctx))
+	if assert.Len(t, fakeRecorder.Events, 1) {
+		assert.Contains(t, <-fakeRecorder.Events, invalidConfigurationReason)
+	}
+
+	t.Setenv(envEnableStrictStartupConfigValidation, "true")
+	expectInvalidConfig()
+	assert.Error(t, mockContext.validateStartupConfig(ctx))
+}
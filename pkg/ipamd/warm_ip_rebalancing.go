@@ -0,0 +1,74 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// warmIPRebalanceInterval is the minimum time between two rebalances of the warm IPs, so that the pool manager does not
+// move IPs back and forth while pods churn
+const warmIPRebalanceInterval = time.Minute
+
+// tryRebalanceWarmIPs moves warm IPs from the ENI with the fewest pods to the ENI with the most pods that has room for
+// them. The number of warm IPs does not change, but new pods land on the busy ENIs, so that the other ENIs drain and
+// can be detached, and free IP slots stay on them rather than on the busy ENIs.
+func (c *IPAMContext) tryRebalanceWarmIPs() {
+	if !c.warmIPRebalancing || time.Since(c.lastWarmIPRebalance) < warmIPRebalanceInterval ||
+		c.degradationLevel() >= degradationShedding {
+		return
+	}
+	donor, recipient, count := c.dataStore.GetWarmIPRebalance(c.maxIPsPerENI, c.useCustomNetworking)
+	if count == 0 {
+		return
+	}
+	c.lastWarmIPRebalance = time.Now()
+
+	// The IPs are added to the recipient first, so that the pool never has fewer warm IPs than its targets
+	output, err := c.awsClient.AllocIPAddresses(recipient, count)
+	if err != nil || output == nil {
+		log.Warnf("Failed to allocate %d IPs on ENI %s to rebalance warm IPs: %v", count, recipient, err)
+		ipamdErrInc("rebalanceWarmIPsAllocIPAddressesFailed")
+		return
+	}
+	var ec2ip4s []*ec2.NetworkInterfacePrivateIpAddress
+	for _, ec2Addr := range output.AssignedPrivateIpAddresses {
+		ec2ip4s = append(ec2ip4s, &ec2.NetworkInterfacePrivateIpAddress{PrivateIpAddress: ec2Addr.PrivateIpAddress})
+	}
+	c.addENIsecondaryIPsToDataStore(ec2ip4s, recipient)
+
+	var deletedIPs []string
+	for _, cidr := range c.dataStore.FindCooledDownCidrs(donor) {
+		if len(deletedIPs) == len(ec2ip4s) {
+			break
+		}
+		if cidr.IsPrefix {
+			continue
+		}
+		// Don't force the delete, since the IP might have been assigned to a pod in the meantime
+		if err := c.dataStore.DelIPv4CidrFromStore(donor, cidr.Cidr, false /* force */); err != nil {
+			log.Debugf("Not moving IP %s off ENI %s: %v", cidr.Cidr.IP, donor, err)
+			continue
+		}
+		deletedIPs = append(deletedIPs, cidr.Cidr.IP.String())
+		c.reconcileCooldownCache.Add(cidr.Cidr.IP.String())
+	}
+	if err := c.awsClient.DeallocIPAddresses(donor, deletedIPs); err != nil {
+		log.Warnf("Failed to free IPs %v from ENI %s while rebalancing warm IPs: %v", deletedIPs, donor, err)
+		return
+	}
+	log.Infof("Moved %d warm IPs from ENI %s to ENI %s", len(deletedIPs), donor, recipient)
+}
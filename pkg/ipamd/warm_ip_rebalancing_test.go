@@ -0,0 +1,70 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+)
+
+func TestTryRebalanceWarmIPs(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+
+	c := &IPAMContext{
+		awsClient:              m.awsutils,
+		dataStore:              testDatastore(),
+		maxIPsPerENI:           3,
+		warmIPRebalancing:      true,
+		reconcileCooldownCache: ReconcileCooldownCache{cache: make(map[string]time.Time)},
+	}
+	addIP := func(eniID, ip string) {
+		c.dataStore.AddIPv4CidrToStore(eniID, net.IPNet{IP: net.ParseIP(ip), Mask: net.IPv4Mask(255, 255, 255, 255)}, false)
+	}
+	// The busy ENI is full of pods before the idle ENI gets IPs
+	c.dataStore.AddENI(primaryENIid, primaryDevice, true, false, false)
+	addIP(primaryENIid, ipaddr01)
+	addIP(primaryENIid, ipaddr02)
+	for _, container := range []string{"container1", "container2"} {
+		_, _, err := c.dataStore.AssignPodIPv4Address(datastore.IPAMKey{ContainerID: container}, datastore.IPAMMetadata{})
+		assert.NoError(t, err)
+	}
+	c.dataStore.AddENI(secENIid, secDevice, false, false, false)
+	addIP(secENIid, ipaddr11)
+	addIP(secENIid, ipaddr12)
+
+	m.awsutils.EXPECT().AllocIPAddresses(primaryENIid, 1).Return(&ec2.AssignPrivateIpAddressesOutput{
+		AssignedPrivateIpAddresses: []*ec2.AssignedPrivateIpAddress{{PrivateIpAddress: aws.String(ipaddr03)}},
+	}, nil)
+	m.awsutils.EXPECT().DeallocIPAddresses(secENIid, gomock.Len(1)).Return(nil)
+	c.tryRebalanceWarmIPs()
+
+	// The number of IPs is the same, with one fewer on the idle ENI
+	stats := c.dataStore.GetIPStats(ipV4AddrFamily)
+	assert.Equal(t, 4, stats.TotalIPs)
+	cidrs, _, err := c.dataStore.GetENICIDRs(secENIid)
+	assert.NoError(t, err)
+	assert.Len(t, cidrs, 1)
+
+	// The next rebalance waits for warmIPRebalanceInterval
+	c.tryRebalanceWarmIPs()
+}
@@ -0,0 +1,106 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+)
+
+// instanceFamilyLabel is matched by the node selectors of the CNIConfig, without being set on the node. Its value is
+// the family of the instance type, like m5 for m5.large.
+const instanceFamilyLabel = "vpc.amazonaws.com/instance-family"
+
+// applyWarmPoolOverrides replaces the warm targets of the environment with those of the first warm pool override of
+// the CNIConfig that matches the labels of the node. It returns whether an override applies.
+func (c *IPAMContext) applyWarmPoolOverrides(ctx context.Context, nodeName string) bool {
+	cfg, ok := c.getCNIConfig(ctx)
+	if !ok || len(cfg.Spec.WarmPoolOverrides) == 0 {
+		return false
+	}
+	nodeLabels, err := c.nodeSelectorLabels(ctx, nodeName)
+	if err != nil {
+		log.Warnf("Failed to get node %s, using the warm targets of the environment: %v", nodeName, err)
+		return false
+	}
+
+	for i, override := range cfg.Spec.WarmPoolOverrides {
+		selector, err := metav1.LabelSelectorAsSelector(&override.NodeSelector)
+		if err != nil {
+			log.Warnf("Ignoring warm pool override %d of CNIConfig %s: %v", i, cfg.Name, err)
+			continue
+		}
+		if !selector.Matches(nodeLabels) {
+			continue
+		}
+		log.Infof("Using warm pool override %d (%s) of CNIConfig %s", i, selector.String(), cfg.Name)
+		overrideTarget(&c.warmENITarget, override.WarmENITarget, envWarmENITarget)
+		overrideTarget(&c.warmIPTarget, override.WarmIPTarget, envWarmIPTarget)
+		overrideTarget(&c.minimumIPTarget, override.MinimumIPTarget, envMinimumIPTarget)
+		overrideTarget(&c.warmPrefixTarget, override.WarmPrefixTarget, envWarmPrefixTarget)
+		return true
+	}
+	return false
+}
+
+// overrideTarget sets the target when the override has a valid value, negative values are ignored like in the
+// environment
+func overrideTarget(target *int, override *int, name string) {
+	if override == nil {
+		return
+	}
+	if *override < 0 {
+		log.Warnf("Ignoring negative %s override %d", name, *override)
+		return
+	}
+	log.Infof("Using %s %d", name, *override)
+	*target = *override
+}
+
+// getCNIConfig returns the CNIConfig that applies to the cluster, if any
+func (c *IPAMContext) getCNIConfig(ctx context.Context) (*v1alpha1.CNIConfig, bool) {
+	var cfg v1alpha1.CNIConfig
+	if err := c.k8sClient.Get(ctx, types.NamespacedName{Name: v1alpha1.CNIConfigName}, &cfg); err != nil {
+		// Without the CRD or the CNIConfig, the environment is all there is
+		if !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			log.Warnf("Failed to get CNIConfig %s, using the environment: %v", v1alpha1.CNIConfigName, err)
+		}
+		return nil, false
+	}
+	return &cfg, true
+}
+
+// nodeSelectorLabels returns the labels that the node selectors of the CNIConfig match, the labels of the node and
+// the instance family
+func (c *IPAMContext) nodeSelectorLabels(ctx context.Context, nodeName string) (labels.Set, error) {
+	var node corev1.Node
+	if err := c.k8sClient.Get(ctx, types.NamespacedName{Name: nodeName}, &node); err != nil {
+		return nil, err
+	}
+	nodeLabels := labels.Set{}
+	for key, value := range node.Labels {
+		nodeLabels[key] = value
+	}
+	nodeLabels[instanceFamilyLabel] = strings.Split(c.awsClient.GetInstanceType(), ".")[0]
+	return nodeLabels, nil
+}
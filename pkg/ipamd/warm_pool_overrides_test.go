@@ -0,0 +1,82 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+)
+
+func TestApplyWarmPoolOverrides(t *testing.T) {
+	m := setup(t)
+	defer m.ctrl.Finish()
+	ctx := context.Background()
+	m.awsutils.EXPECT().GetInstanceType().Return("m5.24xlarge").AnyTimes()
+
+	node := &corev1.Node{ObjectMeta: metav1.ObjectMeta{Name: myNodeName, Labels: map[string]string{
+		"eks.amazonaws.com/nodegroup": "large",
+		"topology.kubernetes.io/zone": "us-west-2a",
+	}}}
+	assert.NoError(t, m.k8sClient.Create(ctx, node))
+	newContext := func() *IPAMContext {
+		return &IPAMContext{
+			awsClient:     m.awsutils,
+			k8sClient:     m.k8sClient,
+			warmENITarget: 1,
+		}
+	}
+
+	// Without a CNIConfig, the targets of the environment are kept
+	c := newContext()
+	c.applyWarmPoolOverrides(ctx, myNodeName)
+	assert.Equal(t, 1, c.warmENITarget)
+	assert.Equal(t, noWarmIPTarget, c.warmIPTarget)
+
+	assert.NoError(t, m.k8sClient.Create(ctx, &v1alpha1.CNIConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: v1alpha1.CNIConfigName},
+		Spec: v1alpha1.CNIConfigSpec{WarmPoolOverrides: []v1alpha1.WarmPoolOverride{
+			{
+				NodeSelector: metav1.LabelSelector{MatchLabels: map[string]string{"eks.amazonaws.com/nodegroup": "small"}},
+				WarmIPTarget: aws.Int(1),
+			},
+			{
+				NodeSelector: metav1.LabelSelector{MatchLabels: map[string]string{
+					"topology.kubernetes.io/zone": "us-west-2a",
+					instanceFamilyLabel:           "m5",
+				}},
+				WarmIPTarget:    aws.Int(20),
+				MinimumIPTarget: aws.Int(50),
+				WarmENITarget:   aws.Int(-1),
+			},
+			{
+				NodeSelector: metav1.LabelSelector{},
+				WarmIPTarget: aws.Int(5),
+			},
+		}},
+	}))
+
+	// The first matching override applies, and invalid targets are ignored
+	c = newContext()
+	c.applyWarmPoolOverrides(ctx, myNodeName)
+	assert.Equal(t, 1, c.warmENITarget)
+	assert.Equal(t, 20, c.warmIPTarget)
+	assert.Equal(t, 50, c.minimumIPTarget)
+}
@@ -0,0 +1,91 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package ipamd
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+// warmStartENIs sets up the ENIs of the ENI inventory with their recorded IPs and prefixes, so that ADDs are served
+// before EC2 describes the ENIs. The first reconcile corrects whatever changed since. It returns false when the ENIs
+// must be described now.
+func (c *IPAMContext) warmStartENIs() bool {
+	// In IPv6 mode, the prefixes of the primary ENI are read from EC2 on start in any case
+	if !c.enableIPv4 {
+		return false
+	}
+	enis, err := c.dataStore.ReadENIInventory()
+	if err != nil {
+		log.Infof("Describing the ENIs, failed to read the ENI inventory: %v", err)
+		return false
+	}
+	if len(enis) == 0 {
+		log.Infof("Describing the ENIs, there is no ENI inventory")
+		return false
+	}
+	attachedENIs, err := c.awsClient.GetAttachedENIs()
+	if err != nil {
+		log.Warnf("Describing the ENIs, failed to get the attached ENIs: %v", err)
+		return false
+	}
+	attached := make(map[string]awsutils.ENIMetadata, len(attachedENIs))
+	for _, eni := range attachedENIs {
+		attached[eni.ENIID] = eni
+	}
+	for _, eni := range enis {
+		if _, ok := attached[eni.ID]; !ok {
+			log.Infof("Describing the ENIs, ENI %s of the inventory is no longer attached", eni.ID)
+			return false
+		}
+	}
+
+	restoredCidrs := 0
+	for _, eni := range enis {
+		// The IPs and prefixes come from the inventory, IMDS may still list some that were released
+		eniMetadata := attached[eni.ID]
+		eniMetadata.IPv4Addresses = primaryIPv4Address(eniMetadata.IPv4Addresses)
+		eniMetadata.IPv4Prefixes = nil
+		if err := c.setupENI(eni.ID, eniMetadata, eni.IsTrunk, eni.IsEFA); err != nil {
+			log.Warnf("Describing the ENIs, failed to set up ENI %s of the inventory: %v", eni.ID, err)
+			return false
+		}
+		n, err := c.dataStore.RestoreENICidrs(eni)
+		if err != nil {
+			log.Warnf("Describing the ENIs, failed to restore the IPs of ENI %s: %v", eni.ID, err)
+			return false
+		}
+		restoredCidrs += n
+	}
+
+	// The attached ENIs missing from the inventory are unmanaged, or were attached after the previous ipamd shut down.
+	// They count against the ENI limit until the reconcile describes them.
+	c.unmanagedENI = len(attachedENIs) - len(enis)
+	c.updateIPStats(c.unmanagedENI)
+	c.logPoolStats(c.dataStore.GetIPStats(ipV4AddrFamily))
+	log.Infof("Warm started %d ENIs with %d IPs and prefixes from the ENI inventory", len(enis), restoredCidrs)
+	return true
+}
+
+// primaryIPv4Address returns the primary IPv4 address of the ENI alone
+func primaryIPv4Address(addrs []*ec2.NetworkInterfacePrivateIpAddress) []*ec2.NetworkInterfacePrivateIpAddress {
+	for _, addr := range addrs {
+		if aws.BoolValue(addr.Primary) {
+			return []*ec2.NetworkInterfacePrivateIpAddress{addr}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,363 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package iplease shares IPs that ipamd reserved ahead of time with the CNI plugin through a memory-mapped file, so that
+// the plugin can set up a pod without a gRPC round trip to ipamd. The plugin claims a lease by writing the pod into its
+// slot, and ipamd confirms the claims asynchronously by assigning the IPs to the pods in its datastore.
+//
+// Both sides take an exclusive flock on the file around every change. A file that ipamd stopped using is retired, so
+// that a plugin still holding it does not claim leases that nobody confirms.
+package iplease
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"os"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// DefaultPath is the lease file. /var/run/aws-node is shared by the aws-node containers and the host.
+const DefaultPath = "/var/run/aws-node/ip-leases"
+
+const (
+	magic       = "AWSLEASE"
+	fileVersion = 1
+
+	// Header layout
+	headerSize    = 64
+	offMagic      = 0
+	offVersion    = 8
+	offSlots      = 12
+	offRetired    = 16
+	offPolicyLen  = 20
+	offPolicy     = 21
+	maxPolicySize = headerSize - offPolicy
+
+	// Slot layout
+	slotSize     = 1024
+	offState     = 0
+	offDevice    = 4
+	offIPv4      = 8
+	offClaimLen  = 12
+	offClaim     = 14
+	maxClaimSize = slotSize - offClaim
+)
+
+// Slot states
+const (
+	stateFree uint32 = iota
+	stateOffered
+	stateClaimed
+)
+
+// ErrNoLease is returned by Claim when no lease is offered
+var ErrNoLease = errors.New("iplease: no lease available")
+
+// Lease is an IP that ipamd reserved for the plugin
+type Lease struct {
+	IPv4Addr     string
+	DeviceNumber int
+}
+
+// Claim identifies the pod that claimed a lease, with the fields of the AddNetwork request
+type Claim struct {
+	ContainerID  string `json:"containerID"`
+	IfName       string `json:"ifName"`
+	NetworkName  string `json:"networkName"`
+	PodName      string `json:"podName"`
+	PodNamespace string `json:"podNamespace"`
+	PodUID       string `json:"podUID"`
+}
+
+// ClaimedLease is a lease together with the pod that claimed it
+type ClaimedLease struct {
+	Lease
+	Claim
+}
+
+// File is an open lease file
+type File struct {
+	file  *os.File
+	data  []byte
+	slots int
+}
+
+// Create replaces the lease file at path with an empty one of the given number of slots. Plugins read
+// networkPolicyMode from it, as they would from the AddNetwork reply.
+func Create(path string, slots int, networkPolicyMode string) (*File, error) {
+	if slots <= 0 {
+		return nil, errors.Errorf("iplease: invalid number of slots %d", slots)
+	}
+	if len(networkPolicyMode) > maxPolicySize {
+		return nil, errors.Errorf("iplease: network policy mode %q is too long", networkPolicyMode)
+	}
+	// The file is written next to path then renamed, so that a plugin never opens a partial header
+	tmpPath := path + ".tmp"
+	f, err := mapFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, headerSize+slots*slotSize)
+	if err != nil {
+		return nil, err
+	}
+	copy(f.data[offMagic:], magic)
+	binary.LittleEndian.PutUint32(f.data[offVersion:], fileVersion)
+	binary.LittleEndian.PutUint32(f.data[offSlots:], uint32(slots))
+	f.data[offPolicyLen] = byte(len(networkPolicyMode))
+	copy(f.data[offPolicy:], networkPolicyMode)
+	f.slots = slots
+	if err := os.Rename(tmpPath, path); err != nil {
+		f.Close()
+		return nil, errors.Wrapf(err, "iplease: failed to rename %s", tmpPath)
+	}
+	return f, nil
+}
+
+// Open opens an existing lease file, as written by Create
+func Open(path string) (*File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < headerSize {
+		return nil, errors.Errorf("iplease: %s is too short", path)
+	}
+	f, err := mapFile(path, os.O_RDWR, int(info.Size()))
+	if err != nil {
+		return nil, err
+	}
+	if string(f.data[offMagic:offMagic+len(magic)]) != magic || binary.LittleEndian.Uint32(f.data[offVersion:]) != fileVersion {
+		f.Close()
+		return nil, errors.Errorf("iplease: %s is not a lease file of version %d", path, fileVersion)
+	}
+	f.slots = int(binary.LittleEndian.Uint32(f.data[offSlots:]))
+	if headerSize+f.slots*slotSize != len(f.data) {
+		f.Close()
+		return nil, errors.Errorf("iplease: %s does not have the size of %d slots", path, f.slots)
+	}
+	return f, nil
+}
+
+func mapFile(path string, flag int, size int) (*File, error) {
+	file, err := os.OpenFile(path, flag, 0600)
+	if err != nil {
+		return nil, errors.Wrapf(err, "iplease: failed to open %s", path)
+	}
+	if flag&os.O_CREATE != 0 {
+		if err := file.Truncate(int64(size)); err != nil {
+			file.Close()
+			return nil, errors.Wrapf(err, "iplease: failed to size %s", path)
+		}
+	}
+	data, err := unix.Mmap(int(file.Fd()), 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, errors.Wrapf(err, "iplease: failed to map %s", path)
+	}
+	return &File{file: file, data: data}, nil
+}
+
+// Close unmaps and closes the file
+func (f *File) Close() error {
+	if err := unix.Munmap(f.data); err != nil {
+		f.file.Close()
+		return err
+	}
+	return f.file.Close()
+}
+
+// NetworkPolicyMode returns the network policy mode ipamd runs with
+func (f *File) NetworkPolicyMode() string {
+	return string(f.data[offPolicy : offPolicy+int(f.data[offPolicyLen])])
+}
+
+// Claim claims a lease for the pod. A pod that already claimed a lease gets it again, so that a retried ADD does not
+// take a second IP.
+func (f *File) Claim(claim Claim) (Lease, error) {
+	encoded, err := json.Marshal(claim)
+	if err != nil {
+		return Lease{}, err
+	}
+	if len(encoded) > maxClaimSize {
+		return Lease{}, errors.Errorf("iplease: claim of %d bytes does not fit in a slot", len(encoded))
+	}
+
+	var lease Lease
+	err = f.locked(func() error {
+		if f.retired() {
+			return ErrNoLease
+		}
+		offered := -1
+		for i := 0; i < f.slots; i++ {
+			switch f.state(i) {
+			case stateClaimed:
+				if previous, err := f.claim(i); err == nil && sameSandbox(previous, claim) {
+					lease = f.lease(i)
+					return nil
+				}
+			case stateOffered:
+				if offered < 0 {
+					offered = i
+				}
+			}
+		}
+		if offered < 0 {
+			return ErrNoLease
+		}
+		slot := f.slot(offered)
+		binary.LittleEndian.PutUint16(slot[offClaimLen:], uint16(len(encoded)))
+		copy(slot[offClaim:], encoded)
+		binary.LittleEndian.PutUint32(slot[offState:], stateClaimed)
+		lease = f.lease(offered)
+		return nil
+	})
+	return lease, err
+}
+
+// Offer puts leases in free slots, and returns how many were offered. The rest did not fit.
+func (f *File) Offer(leases []Lease) (int, error) {
+	offered := 0
+	err := f.locked(func() error {
+		for i := 0; i < f.slots && offered < len(leases); i++ {
+			if f.state(i) != stateFree {
+				continue
+			}
+			ip := net.ParseIP(leases[offered].IPv4Addr).To4()
+			if ip == nil {
+				return errors.Errorf("iplease: invalid IPv4 address %q", leases[offered].IPv4Addr)
+			}
+			slot := f.slot(i)
+			binary.LittleEndian.PutUint32(slot[offDevice:], uint32(int32(leases[offered].DeviceNumber)))
+			copy(slot[offIPv4:], ip)
+			binary.LittleEndian.PutUint16(slot[offClaimLen:], 0)
+			binary.LittleEndian.PutUint32(slot[offState:], stateOffered)
+			offered++
+		}
+		return nil
+	})
+	return offered, err
+}
+
+// Offered returns the number of leases that are offered and not claimed yet
+func (f *File) Offered() (int, error) {
+	offered := 0
+	err := f.locked(func() error {
+		for i := 0; i < f.slots; i++ {
+			if f.state(i) == stateOffered {
+				offered++
+			}
+		}
+		return nil
+	})
+	return offered, err
+}
+
+// TakeClaims frees the slots of the claimed leases, and returns them
+func (f *File) TakeClaims() ([]ClaimedLease, error) {
+	var claimed []ClaimedLease
+	err := f.locked(func() error {
+		claimed = f.takeUnsafe(stateClaimed)
+		return nil
+	})
+	return claimed, err
+}
+
+// Revoke frees the slots of the leases that are not claimed, and returns them
+func (f *File) Revoke() ([]Lease, error) {
+	var revoked []Lease
+	err := f.locked(func() error {
+		for _, lease := range f.takeUnsafe(stateOffered) {
+			revoked = append(revoked, lease.Lease)
+		}
+		return nil
+	})
+	return revoked, err
+}
+
+// Retire stops plugins from claiming leases in the file, then empties it. It returns the leases that were claimed, and
+// those that were only offered.
+func (f *File) Retire() ([]ClaimedLease, []Lease, error) {
+	var claimed []ClaimedLease
+	var revoked []Lease
+	err := f.locked(func() error {
+		binary.LittleEndian.PutUint32(f.data[offRetired:], 1)
+		claimed = f.takeUnsafe(stateClaimed)
+		for _, lease := range f.takeUnsafe(stateOffered) {
+			revoked = append(revoked, lease.Lease)
+		}
+		return nil
+	})
+	return claimed, revoked, err
+}
+
+func (f *File) locked(fn func() error) error {
+	fd := int(f.file.Fd())
+	if err := unix.Flock(fd, unix.LOCK_EX); err != nil {
+		return errors.Wrap(err, "iplease: failed to lock the lease file")
+	}
+	defer unix.Flock(fd, unix.LOCK_UN)
+	return fn()
+}
+
+func (f *File) takeUnsafe(state uint32) []ClaimedLease {
+	var taken []ClaimedLease
+	for i := 0; i < f.slots; i++ {
+		if f.state(i) != state {
+			continue
+		}
+		lease := ClaimedLease{Lease: f.lease(i)}
+		if state == stateClaimed {
+			// A claim that cannot be decoded still holds its IP, ipamd keeps it assigned to the lease
+			lease.Claim, _ = f.claim(i)
+		}
+		binary.LittleEndian.PutUint32(f.slot(i)[offState:], stateFree)
+		taken = append(taken, lease)
+	}
+	return taken
+}
+
+func (f *File) retired() bool {
+	return binary.LittleEndian.Uint32(f.data[offRetired:]) != 0
+}
+
+func (f *File) slot(i int) []byte {
+	start := headerSize + i*slotSize
+	return f.data[start : start+slotSize]
+}
+
+func (f *File) state(i int) uint32 {
+	return binary.LittleEndian.Uint32(f.slot(i)[offState:])
+}
+
+func (f *File) lease(i int) Lease {
+	slot := f.slot(i)
+	return Lease{
+		IPv4Addr:     net.IP(slot[offIPv4 : offIPv4+net.IPv4len]).String(),
+		DeviceNumber: int(int32(binary.LittleEndian.Uint32(slot[offDevice:]))),
+	}
+}
+
+func (f *File) claim(i int) (Claim, error) {
+	slot := f.slot(i)
+	length := int(binary.LittleEndian.Uint16(slot[offClaimLen:]))
+	var claim Claim
+	if length > maxClaimSize {
+		return claim, errors.Errorf("iplease: claim of slot %d is too long", i)
+	}
+	err := json.Unmarshal(slot[offClaim:offClaim+length], &claim)
+	return claim, err
+}
+
+func sameSandbox(a, b Claim) bool {
+	return a.ContainerID == b.ContainerID && a.IfName == b.IfName && a.NetworkName == b.NetworkName
+}
@@ -0,0 +1,105 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package iplease
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClaimAndConfirm(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip-leases")
+	ipamd, err := Create(path, 2, "strict")
+	require.NoError(t, err)
+	defer ipamd.Close()
+
+	offered, err := ipamd.Offer([]Lease{{"10.0.0.1", 0}, {"10.0.0.2", 1}, {"10.0.0.3", 1}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, offered)
+
+	plugin, err := Open(path)
+	require.NoError(t, err)
+	defer plugin.Close()
+	assert.Equal(t, "strict", plugin.NetworkPolicyMode())
+
+	pod1 := Claim{ContainerID: "container1", IfName: "eth0", NetworkName: "aws-cni", PodName: "pod1", PodNamespace: "default"}
+	lease, err := plugin.Claim(pod1)
+	require.NoError(t, err)
+	assert.Equal(t, Lease{"10.0.0.1", 0}, lease)
+
+	// A retried ADD gets the same lease
+	lease, err = plugin.Claim(pod1)
+	require.NoError(t, err)
+	assert.Equal(t, Lease{"10.0.0.1", 0}, lease)
+
+	lease, err = plugin.Claim(Claim{ContainerID: "container2", IfName: "eth0", NetworkName: "aws-cni"})
+	require.NoError(t, err)
+	assert.Equal(t, Lease{"10.0.0.2", 1}, lease)
+	_, err = plugin.Claim(Claim{ContainerID: "container3", IfName: "eth0", NetworkName: "aws-cni"})
+	assert.ErrorIs(t, err, ErrNoLease)
+
+	claimed, err := ipamd.TakeClaims()
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Equal(t, pod1, claimed[0].Claim)
+	assert.Equal(t, "10.0.0.1", claimed[0].IPv4Addr)
+
+	// The confirmed slots are free for new leases
+	offered, err = ipamd.Offer([]Lease{{"10.0.0.3", 1}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, offered)
+	count, err := ipamd.Offered()
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+func TestRetire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip-leases")
+	ipamd, err := Create(path, 3, "")
+	require.NoError(t, err)
+	defer ipamd.Close()
+	_, err = ipamd.Offer([]Lease{{"10.0.0.1", 0}, {"10.0.0.2", 0}})
+	require.NoError(t, err)
+
+	plugin, err := Open(path)
+	require.NoError(t, err)
+	defer plugin.Close()
+	_, err = plugin.Claim(Claim{ContainerID: "container1"})
+	require.NoError(t, err)
+
+	claimed, revoked, err := ipamd.Retire()
+	require.NoError(t, err)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, []Lease{{"10.0.0.2", 0}}, revoked)
+
+	// A plugin still holding a retired file gets nothing from it
+	_, err = plugin.Offer([]Lease{{"10.0.0.3", 0}})
+	require.NoError(t, err)
+	_, err = plugin.Claim(Claim{ContainerID: "container2"})
+	assert.ErrorIs(t, err, ErrNoLease)
+}
+
+func TestOpenInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ip-leases")
+	_, err := Open(path)
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, os.WriteFile(path, make([]byte, headerSize+slotSize), 0600))
+	_, err = Open(path)
+	assert.Error(t, err)
+}
@@ -45,12 +45,13 @@ func (ipt *MockIptables) Insert(table, chain string, pos int, rulespec ...string
 	if ipt.DataplaneState[table] == nil {
 		ipt.DataplaneState[table] = map[string][][]string{}
 	}
-	if len(ipt.DataplaneState[table][chain]) == pos-1 {
-		ipt.DataplaneState[table][chain] = append(ipt.DataplaneState[table][chain], rulespec)
-	} else {
-		ipt.DataplaneState[table][chain] = append(ipt.DataplaneState[table][chain][:pos], ipt.DataplaneState[table][chain][pos-1:]...)
-		ipt.DataplaneState[table][chain][pos] = rulespec
+	rules := ipt.DataplaneState[table][chain]
+	// The -N rule of a user chain is not a position
+	index := pos - 1
+	if len(rules) > 0 && slices.Contains(rules[0], "-N") {
+		index = pos
 	}
+	ipt.DataplaneState[table][chain] = slices.Insert(rules, index, rulespec)
 	return nil
 }
 
@@ -3,6 +3,7 @@ package k8sapi
 import (
 	"context"
 	"fmt"
+	"net"
 	"os"
 	"time"
 
@@ -19,6 +20,7 @@ import (
 	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/connrotation"
 	ctrl "sigs.k8s.io/controller-runtime"
 	cache "sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -31,6 +33,9 @@ const (
 
 var log = logger.Get()
 
+// apiServerDialer dials the connections of all the clients to the API server, so that they can be closed together
+var apiServerDialer = connrotation.NewDialer((&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}).DialContext)
+
 // Get cache filters for IPAMD
 func getIPAMDCacheFilters() map[client.Object]cache.ByObject {
 	if nodeName := os.Getenv("MY_NODE_NAME"); nodeName != "" {
@@ -87,7 +92,7 @@ func StartKubeClientCache(cache cache.Cache) {
 
 // CreateKubeClient creates a k8s client
 func CreateKubeClient(appName string) (client.Client, error) {
-	restCfg, err := getRestConfig()
+	restCfg, err := GetRestConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -115,6 +120,9 @@ func CreateKubeClient(appName string) (client.Client, error) {
 	k8sClient, err := client.New(restCfg, client.Options{
 		Cache: &client.CacheOptions{
 			Reader: cacheReader,
+			// The CNIConfig is read once at startup, and the read must not wait for a cache that can not sync when
+			// the CRD is not installed
+			DisableFor: []client.Object{&eniconfigscheme.CNIConfig{}},
 		},
 		Scheme: vpcCniScheme,
 	})
@@ -126,7 +134,7 @@ func CreateKubeClient(appName string) (client.Client, error) {
 
 func GetKubeClientSet() (kubernetes.Interface, error) {
 	// creates the in-cluster config
-	config, err := getRestConfig()
+	config, err := GetRestConfig()
 	if err != nil {
 		return nil, err
 	}
@@ -140,7 +148,7 @@ func GetKubeClientSet() (kubernetes.Interface, error) {
 }
 
 func CheckAPIServerConnectivity() error {
-	restCfg, err := getRestConfig()
+	restCfg, err := GetRestConfig()
 	if err != nil {
 		return err
 	}
@@ -168,7 +176,8 @@ func CheckAPIServerConnectivity() error {
 	})
 }
 
-func getRestConfig() (*rest.Config, error) {
+// GetRestConfig returns the configuration of the Kubernetes API client
+func GetRestConfig() (*rest.Config, error) {
 	restCfg, err := ctrl.GetConfig()
 	if err != nil {
 		return nil, err
@@ -177,9 +186,16 @@ func getRestConfig() (*rest.Config, error) {
 	if endpoint, ok := os.LookupEnv("CLUSTER_ENDPOINT"); ok {
 		restCfg.Host = endpoint
 	}
+	restCfg.Dial = apiServerDialer.DialContext
 	return restCfg, nil
 }
 
+// ResetAPIServerConnections closes the connections of all the clients to the API server, including the watches of
+// the caches. The clients dial again on their next request, which resolves the API server endpoint again.
+func ResetAPIServerConnections() {
+	apiServerDialer.CloseAll()
+}
+
 func GetNode(ctx context.Context, k8sClient client.Client) (corev1.Node, error) {
 	log.Infof("Get Node Info for: %s", os.Getenv("MY_NODE_NAME"))
 	var node corev1.Node
@@ -291,6 +291,21 @@ func (mr *MockNetLinkMockRecorder) RouteList(arg0, arg1 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RouteList", reflect.TypeOf((*MockNetLink)(nil).RouteList), arg0, arg1)
 }
 
+// RouteListFiltered mocks base method.
+func (m *MockNetLink) RouteListFiltered(arg0 int, arg1 *netlink.Route, arg2 uint64) ([]netlink.Route, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RouteListFiltered", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]netlink.Route)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RouteListFiltered indicates an expected call of RouteListFiltered.
+func (mr *MockNetLinkMockRecorder) RouteListFiltered(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RouteListFiltered", reflect.TypeOf((*MockNetLink)(nil).RouteListFiltered), arg0, arg1, arg2)
+}
+
 // RouteReplace mocks base method.
 func (m *MockNetLink) RouteReplace(arg0 *netlink.Route) error {
 	m.ctrl.T.Helper()
@@ -44,6 +44,8 @@ type NetLink interface {
 	LinkSetDown(link netlink.Link) error
 	// RouteList gets a list of routes in the system.
 	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+	// RouteListFiltered gets a list of routes in the system, filtered by the fields of the filter in the mask, in any table
+	RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
 	// RouteAdd will add a route to the route table
 	RouteAdd(route *netlink.Route) error
 	// RouteReplace will replace the route in the route table
@@ -114,6 +116,10 @@ func (*netLink) RouteList(link netlink.Link, family int) ([]netlink.Route, error
 	return netlink.RouteList(link, family)
 }
 
+func (*netLink) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	return netlink.RouteListFiltered(family, filter, filterMask)
+}
+
 func (*netLink) RouteAdd(route *netlink.Route) error {
 	return netlink.RouteAdd(route)
 }
@@ -0,0 +1,214 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkhelper
+
+import (
+	"io"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/retry"
+)
+
+const (
+	// The helper container starts at the same time as ipamd, so wait for it to listen
+	dialAttempts   = 20
+	dialMinBackoff = 500 * time.Millisecond
+	dialMaxBackoff = 5 * time.Second
+)
+
+// client implements networkutils.NetworkAPIs by calling the network helper
+type client struct {
+	socketPath string
+	config     Config
+
+	// routedExcludeSNATCIDRs are the CIDRs last sent to the helper with SetRoutedExcludeSNATCIDRs
+	routedLock             sync.Mutex
+	routedExcludeSNATCIDRs []string
+
+	lock      sync.Mutex
+	rpcClient *rpc.Client
+}
+
+// NewClient connects to the network helper listening on socketPath
+func NewClient(socketPath string) (networkutils.NetworkAPIs, error) {
+	c := &client{socketPath: socketPath}
+	err := retry.NWithBackoff(retry.NewSimpleBackoff(dialMinBackoff, dialMaxBackoff, 0.2, 2), dialAttempts, func() error {
+		return c.call("GetConfig", Empty{}, &c.config)
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to the network helper on %s", socketPath)
+	}
+	return c, nil
+}
+
+// call sends a request to the helper, reconnecting once if the helper was restarted since the last call
+func (c *client) call(method string, args interface{}, reply interface{}) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for attempt := 0; ; attempt++ {
+		if c.rpcClient == nil {
+			conn, err := net.Dial("unix", c.socketPath)
+			if err != nil {
+				return err
+			}
+			c.rpcClient = rpc.NewClient(conn)
+		}
+		err := c.rpcClient.Call(serviceName+"."+method, args, reply)
+		if attempt == 0 && (err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF) {
+			c.rpcClient.Close()
+			c.rpcClient = nil
+			continue
+		}
+		return err
+	}
+}
+
+func (c *client) SetupHostNetwork(vpcCIDRs []string, primaryMAC string, primaryAddr *net.IP, enablePodENI bool,
+	v4Enabled bool, v6Enabled bool) error {
+	return c.call("SetupHostNetwork", SetupHostNetworkArgs{
+		VPCCIDRs:     vpcCIDRs,
+		PrimaryMAC:   primaryMAC,
+		PrimaryAddr:  *primaryAddr,
+		EnablePodENI: enablePodENI,
+		V4Enabled:    v4Enabled,
+		V6Enabled:    v6Enabled,
+	}, &Empty{})
+}
+
+func (c *client) SetupENINetwork(eniIP string, mac string, deviceNumber int, subnetCIDR string) error {
+	return c.call("SetupENINetwork", SetupENINetworkArgs{
+		ENIIP:        eniIP,
+		MAC:          mac,
+		DeviceNumber: deviceNumber,
+		SubnetCIDR:   subnetCIDR,
+	}, &Empty{})
+}
+
+func (c *client) UpdateHostIptablesRules(vpcCIDRs []string, primaryMAC string, primaryAddr *net.IP, v4Enabled bool, v6Enabled bool) error {
+	return c.call("UpdateHostIptablesRules", UpdateHostIptablesRulesArgs{
+		VPCCIDRs:    vpcCIDRs,
+		PrimaryMAC:  primaryMAC,
+		PrimaryAddr: *primaryAddr,
+		V4Enabled:   v4Enabled,
+		V6Enabled:   v6Enabled,
+	}, &Empty{})
+}
+
+func (c *client) CleanUpStaleAWSChains(v4Enabled, v6Enabled bool) error {
+	return c.call("CleanUpStaleAWSChains", CleanUpStaleAWSChainsArgs{V4Enabled: v4Enabled, V6Enabled: v6Enabled}, &Empty{})
+}
+
+func (c *client) UseExternalSNAT() bool {
+	return c.config.UseExternalSNAT
+}
+
+func (c *client) GetExcludeSNATCIDRs() []string {
+	c.routedLock.Lock()
+	defer c.routedLock.Unlock()
+	cidrs := append([]string(nil), c.config.ExcludeSNATCIDRs...)
+	configured := sets.NewString(cidrs...)
+	for _, cidr := range c.routedExcludeSNATCIDRs {
+		if !configured.Has(cidr) {
+			cidrs = append(cidrs, cidr)
+		}
+	}
+	return cidrs
+}
+
+func (c *client) SetRoutedExcludeSNATCIDRs(cidrs []string) {
+	if err := c.call("SetRoutedExcludeSNATCIDRs", SetRoutedExcludeSNATCIDRsArgs{CIDRs: cidrs}, &Empty{}); err != nil {
+		log.Errorf("Failed to send the routed CIDRs excluded from SNAT to the network helper: %v", err)
+		return
+	}
+	c.routedLock.Lock()
+	defer c.routedLock.Unlock()
+	c.routedExcludeSNATCIDRs = cidrs
+}
+
+func (c *client) GetExternalServiceCIDRs() []string {
+	return c.config.ExternalServiceCIDRs
+}
+
+func (c *client) GetRuleList() ([]netlink.Rule, error) {
+	var rules []netlink.Rule
+	err := c.call("GetRuleList", Empty{}, &rules)
+	return rules, err
+}
+
+func (c *client) GetRuleListBySrc(ruleList []netlink.Rule, src net.IPNet) ([]netlink.Rule, error) {
+	var rules []netlink.Rule
+	err := c.call("GetRuleListBySrc", RuleListBySrcArgs{RuleList: ruleList, Src: src}, &rules)
+	return rules, err
+}
+
+func (c *client) UpdateRuleListBySrc(ruleList []netlink.Rule, src net.IPNet) error {
+	return c.call("UpdateRuleListBySrc", RuleListBySrcArgs{RuleList: ruleList, Src: src}, &Empty{})
+}
+
+func (c *client) UpdateExternalServiceIpRules(ruleList []netlink.Rule, externalIPs []string) error {
+	return c.call("UpdateExternalServiceIpRules", UpdateExternalServiceIpRulesArgs{RuleList: ruleList, ExternalIPs: externalIPs}, &Empty{})
+}
+
+func (c *client) GetLinkByMac(mac string, retryInterval time.Duration) (netlink.Link, error) {
+	var link Link
+	if err := c.call("GetLinkByMac", GetLinkByMacArgs{MAC: mac, RetryInterval: retryInterval}, &link); err != nil {
+		return nil, err
+	}
+	return &netlink.Device{LinkAttrs: netlink.LinkAttrs{
+		Index:        link.Index,
+		Name:         link.Name,
+		MTU:          link.MTU,
+		HardwareAddr: link.HardwareAddr,
+	}}, nil
+}
+
+func (c *client) SetupCarrierIPRules(podIP net.IP) error {
+	return c.call("SetupCarrierIPRules", CarrierIPRulesArgs{PodIP: podIP}, &Empty{})
+}
+
+func (c *client) TeardownCarrierIPRules(podIP net.IP) error {
+	return c.call("TeardownCarrierIPRules", CarrierIPRulesArgs{PodIP: podIP}, &Empty{})
+}
+
+func (c *client) ReconcileHostToPodRules(primaryMAC string, primaryAddr *net.IP) error {
+	return c.call("ReconcileHostToPodRules", ReconcileHostToPodRulesArgs{PrimaryMAC: primaryMAC, PrimaryAddr: *primaryAddr}, &Empty{})
+}
+
+func (c *client) ReconcileSysctls(primaryMAC string, v6Enabled bool, policy []sysctlpolicy.Setting) ([]sysctlpolicy.Conflict, error) {
+	var conflicts []sysctlpolicy.Conflict
+	err := c.call("ReconcileSysctls", ReconcileSysctlsArgs{PrimaryMAC: primaryMAC, V6Enabled: v6Enabled, Policy: policy}, &conflicts)
+	return conflicts, err
+}
+
+func (c *client) RepairENINetwork(eniIP string, mac string, deviceNumber int, subnetCIDR string, podIPs []string) (bool, error) {
+	var repaired bool
+	err := c.call("RepairENINetwork", RepairENINetworkArgs{
+		ENIIP:        eniIP,
+		MAC:          mac,
+		DeviceNumber: deviceNumber,
+		SubnetCIDR:   subnetCIDR,
+		PodIPs:       podIPs,
+	}, &repaired)
+	return repaired, err
+}
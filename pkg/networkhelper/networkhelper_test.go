@@ -0,0 +1,121 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkhelper
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+
+	mock_networkutils "github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
+)
+
+func startHelper(t *testing.T, allowedUID uint32, network *mock_networkutils.MockNetworkAPIs) string {
+	socketPath := filepath.Join(t.TempDir(), "network-helper.sock")
+	go func() {
+		_ = Serve(socketPath, allowedUID, network)
+	}()
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(socketPath)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	return socketPath
+}
+
+func TestClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	network := mock_networkutils.NewMockNetworkAPIs(ctrl)
+
+	network.EXPECT().UseExternalSNAT().Return(true)
+	network.EXPECT().GetExcludeSNATCIDRs().Return([]string{"10.1.0.0/16"})
+	network.EXPECT().GetExternalServiceCIDRs().Return(nil)
+	socketPath := startHelper(t, uint32(os.Getuid()), network)
+
+	c, err := NewClient(socketPath)
+	require.NoError(t, err)
+	assert.True(t, c.UseExternalSNAT())
+	assert.Equal(t, []string{"10.1.0.0/16"}, c.GetExcludeSNATCIDRs())
+	assert.Empty(t, c.GetExternalServiceCIDRs())
+
+	network.EXPECT().SetRoutedExcludeSNATCIDRs([]string{"10.1.0.0/16", "192.168.0.0/16"})
+	c.SetRoutedExcludeSNATCIDRs([]string{"10.1.0.0/16", "192.168.0.0/16"})
+	assert.Equal(t, []string{"10.1.0.0/16", "192.168.0.0/16"}, c.GetExcludeSNATCIDRs())
+
+	primaryIP := net.ParseIP("10.0.0.10").To4()
+	network.EXPECT().SetupHostNetwork([]string{"10.0.0.0/16"}, "02:00:00:00:00:01", &primaryIP, false, true, false).Return(nil)
+	assert.NoError(t, c.SetupHostNetwork([]string{"10.0.0.0/16"}, "02:00:00:00:00:01", &primaryIP, false, true, false))
+
+	network.EXPECT().SetupENINetwork("10.0.0.20", "02:00:00:00:00:02", 1, "10.0.0.0/24").Return(errors.New("link not found"))
+	err = c.SetupENINetwork("10.0.0.20", "02:00:00:00:00:02", 1, "10.0.0.0/24")
+	assert.EqualError(t, err, "link not found")
+
+	_, src, _ := net.ParseCIDR("10.0.0.20/32")
+	rules := []netlink.Rule{{Priority: 1024, Table: 2, Src: src}}
+	network.EXPECT().GetRuleList().Return(rules, nil)
+	gotRules, err := c.GetRuleList()
+	assert.NoError(t, err)
+	if assert.Len(t, gotRules, 1) {
+		assert.Equal(t, 1024, gotRules[0].Priority)
+		assert.Equal(t, 2, gotRules[0].Table)
+		assert.Equal(t, src.String(), gotRules[0].Src.String())
+	}
+
+	mac, _ := net.ParseMAC("02:00:00:00:00:02")
+	network.EXPECT().GetLinkByMac("02:00:00:00:00:02", 100*time.Millisecond).Return(
+		&netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 3, Name: "eth1", HardwareAddr: mac}}, nil)
+	link, err := c.GetLinkByMac("02:00:00:00:00:02", 100*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, link.Attrs().Index)
+	assert.Equal(t, "eth1", link.Attrs().Name)
+	assert.Equal(t, mac, link.Attrs().HardwareAddr)
+
+	policy := []sysctlpolicy.Setting{{Interface: "eth1", Key: "ipv4/rp_filter", Value: "1"}}
+	conflict := sysctlpolicy.Conflict{Entry: "net/ipv4/conf/eth1/rp_filter", Expected: "1", Found: "2", Reason: "changed on the host, set back"}
+	network.EXPECT().ReconcileSysctls("02:00:00:00:00:01", false, policy).Return([]sysctlpolicy.Conflict{conflict}, nil)
+	conflicts, err := c.ReconcileSysctls("02:00:00:00:00:01", false, policy)
+	assert.NoError(t, err)
+	assert.Equal(t, []sysctlpolicy.Conflict{conflict}, conflicts)
+
+	network.EXPECT().RepairENINetwork("10.0.0.20", "02:00:00:00:00:02", 1, "10.0.0.0/24", []string{"10.0.0.21"}).Return(true, nil)
+	repaired, err := c.RepairENINetwork("10.0.0.20", "02:00:00:00:00:02", 1, "10.0.0.0/24", []string{"10.0.0.21"})
+	assert.NoError(t, err)
+	assert.True(t, repaired)
+}
+
+func TestServeRejectsOtherUIDs(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of the socket requires root")
+	}
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	socketPath := startHelper(t, uint32(os.Getuid())+1, mock_networkutils.NewMockNetworkAPIs(ctrl))
+
+	conn, err := net.Dial("unix", socketPath)
+	require.NoError(t, err)
+	rpcClient := rpc.NewClient(conn)
+	defer rpcClient.Close()
+	var config Config
+	assert.Error(t, rpcClient.Call(serviceName+".GetConfig", Empty{}, &config))
+}
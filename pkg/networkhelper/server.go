@@ -0,0 +1,311 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package networkhelper runs the host network configuration of ipamd in a separate privileged process, so that ipamd
+// itself can run without NET_ADMIN. The helper serves networkutils.NetworkAPIs over a unix socket, and only accepts
+// connections from processes running as the configured UID.
+package networkhelper
+
+import (
+	"net"
+	"net/rpc"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+)
+
+const (
+	// DefaultSocketPath is the unix socket the network helper listens on. /var/run/aws-node is shared by the aws-node
+	// containers.
+	DefaultSocketPath = "/var/run/aws-node/network-helper.sock"
+
+	serviceName = "NetworkHelper"
+)
+
+var log = logger.GetComponent("networkhelper")
+
+// Empty is the reply of calls that only return an error
+type Empty struct{}
+
+// Config is the helper configuration that ipamd reads once at startup
+type Config struct {
+	UseExternalSNAT      bool
+	ExcludeSNATCIDRs     []string
+	ExternalServiceCIDRs []string
+}
+
+// SetupHostNetworkArgs are the arguments of NetworkAPIs.SetupHostNetwork
+type SetupHostNetworkArgs struct {
+	VPCCIDRs     []string
+	PrimaryMAC   string
+	PrimaryAddr  net.IP
+	EnablePodENI bool
+	V4Enabled    bool
+	V6Enabled    bool
+}
+
+// SetupENINetworkArgs are the arguments of NetworkAPIs.SetupENINetwork
+type SetupENINetworkArgs struct {
+	ENIIP        string
+	MAC          string
+	DeviceNumber int
+	SubnetCIDR   string
+}
+
+// UpdateHostIptablesRulesArgs are the arguments of NetworkAPIs.UpdateHostIptablesRules
+type UpdateHostIptablesRulesArgs struct {
+	VPCCIDRs    []string
+	PrimaryMAC  string
+	PrimaryAddr net.IP
+	V4Enabled   bool
+	V6Enabled   bool
+}
+
+// CleanUpStaleAWSChainsArgs are the arguments of NetworkAPIs.CleanUpStaleAWSChains
+type CleanUpStaleAWSChainsArgs struct {
+	V4Enabled bool
+	V6Enabled bool
+}
+
+// SetRoutedExcludeSNATCIDRsArgs are the arguments of NetworkAPIs.SetRoutedExcludeSNATCIDRs
+type SetRoutedExcludeSNATCIDRsArgs struct {
+	CIDRs []string
+}
+
+// RuleListBySrcArgs are the arguments of NetworkAPIs.GetRuleListBySrc and NetworkAPIs.UpdateRuleListBySrc
+type RuleListBySrcArgs struct {
+	RuleList []netlink.Rule
+	Src      net.IPNet
+}
+
+// UpdateExternalServiceIpRulesArgs are the arguments of NetworkAPIs.UpdateExternalServiceIpRules
+type UpdateExternalServiceIpRulesArgs struct {
+	RuleList    []netlink.Rule
+	ExternalIPs []string
+}
+
+// GetLinkByMacArgs are the arguments of NetworkAPIs.GetLinkByMac
+type GetLinkByMacArgs struct {
+	MAC           string
+	RetryInterval time.Duration
+}
+
+// CarrierIPRulesArgs are the arguments of NetworkAPIs.SetupCarrierIPRules and NetworkAPIs.TeardownCarrierIPRules
+type CarrierIPRulesArgs struct {
+	PodIP net.IP
+}
+
+// ReconcileHostToPodRulesArgs are the arguments of NetworkAPIs.ReconcileHostToPodRules
+type ReconcileHostToPodRulesArgs struct {
+	PrimaryMAC  string
+	PrimaryAddr net.IP
+}
+
+// ReconcileSysctlsArgs are the arguments of NetworkAPIs.ReconcileSysctls
+type ReconcileSysctlsArgs struct {
+	PrimaryMAC string
+	V6Enabled  bool
+	Policy     []sysctlpolicy.Setting
+}
+
+// RepairENINetworkArgs are the arguments of NetworkAPIs.RepairENINetwork
+type RepairENINetworkArgs struct {
+	ENIIP        string
+	MAC          string
+	DeviceNumber int
+	SubnetCIDR   string
+	PodIPs       []string
+}
+
+// Link is the part of a netlink.Link that ipamd uses
+type Link struct {
+	Index        int
+	Name         string
+	MTU          int
+	HardwareAddr net.HardwareAddr
+}
+
+// NetworkHelper is the RPC service exposing a networkutils.NetworkAPIs
+type NetworkHelper struct {
+	network networkutils.NetworkAPIs
+}
+
+// GetConfig returns the SNAT configuration of the helper
+func (h *NetworkHelper) GetConfig(_ Empty, reply *Config) error {
+	*reply = Config{
+		UseExternalSNAT:      h.network.UseExternalSNAT(),
+		ExcludeSNATCIDRs:     h.network.GetExcludeSNATCIDRs(),
+		ExternalServiceCIDRs: h.network.GetExternalServiceCIDRs(),
+	}
+	return nil
+}
+
+// SetupHostNetwork calls NetworkAPIs.SetupHostNetwork
+func (h *NetworkHelper) SetupHostNetwork(args SetupHostNetworkArgs, _ *Empty) error {
+	return h.network.SetupHostNetwork(args.VPCCIDRs, args.PrimaryMAC, &args.PrimaryAddr, args.EnablePodENI, args.V4Enabled, args.V6Enabled)
+}
+
+// SetupENINetwork calls NetworkAPIs.SetupENINetwork
+func (h *NetworkHelper) SetupENINetwork(args SetupENINetworkArgs, _ *Empty) error {
+	return h.network.SetupENINetwork(args.ENIIP, args.MAC, args.DeviceNumber, args.SubnetCIDR)
+}
+
+// UpdateHostIptablesRules calls NetworkAPIs.UpdateHostIptablesRules
+func (h *NetworkHelper) UpdateHostIptablesRules(args UpdateHostIptablesRulesArgs, _ *Empty) error {
+	return h.network.UpdateHostIptablesRules(args.VPCCIDRs, args.PrimaryMAC, &args.PrimaryAddr, args.V4Enabled, args.V6Enabled)
+}
+
+// CleanUpStaleAWSChains calls NetworkAPIs.CleanUpStaleAWSChains
+func (h *NetworkHelper) CleanUpStaleAWSChains(args CleanUpStaleAWSChainsArgs, _ *Empty) error {
+	return h.network.CleanUpStaleAWSChains(args.V4Enabled, args.V6Enabled)
+}
+
+// SetRoutedExcludeSNATCIDRs calls NetworkAPIs.SetRoutedExcludeSNATCIDRs
+func (h *NetworkHelper) SetRoutedExcludeSNATCIDRs(args SetRoutedExcludeSNATCIDRsArgs, _ *Empty) error {
+	h.network.SetRoutedExcludeSNATCIDRs(args.CIDRs)
+	return nil
+}
+
+// GetRuleList calls NetworkAPIs.GetRuleList
+func (h *NetworkHelper) GetRuleList(_ Empty, reply *[]netlink.Rule) error {
+	rules, err := h.network.GetRuleList()
+	*reply = rules
+	return err
+}
+
+// GetRuleListBySrc calls NetworkAPIs.GetRuleListBySrc
+func (h *NetworkHelper) GetRuleListBySrc(args RuleListBySrcArgs, reply *[]netlink.Rule) error {
+	rules, err := h.network.GetRuleListBySrc(args.RuleList, args.Src)
+	*reply = rules
+	return err
+}
+
+// UpdateRuleListBySrc calls NetworkAPIs.UpdateRuleListBySrc
+func (h *NetworkHelper) UpdateRuleListBySrc(args RuleListBySrcArgs, _ *Empty) error {
+	return h.network.UpdateRuleListBySrc(args.RuleList, args.Src)
+}
+
+// UpdateExternalServiceIpRules calls NetworkAPIs.UpdateExternalServiceIpRules
+func (h *NetworkHelper) UpdateExternalServiceIpRules(args UpdateExternalServiceIpRulesArgs, _ *Empty) error {
+	return h.network.UpdateExternalServiceIpRules(args.RuleList, args.ExternalIPs)
+}
+
+// GetLinkByMac calls NetworkAPIs.GetLinkByMac
+func (h *NetworkHelper) GetLinkByMac(args GetLinkByMacArgs, reply *Link) error {
+	link, err := h.network.GetLinkByMac(args.MAC, args.RetryInterval)
+	if err != nil {
+		return err
+	}
+	attrs := link.Attrs()
+	*reply = Link{Index: attrs.Index, Name: attrs.Name, MTU: attrs.MTU, HardwareAddr: attrs.HardwareAddr}
+	return nil
+}
+
+// SetupCarrierIPRules calls NetworkAPIs.SetupCarrierIPRules
+func (h *NetworkHelper) SetupCarrierIPRules(args CarrierIPRulesArgs, _ *Empty) error {
+	return h.network.SetupCarrierIPRules(args.PodIP)
+}
+
+// TeardownCarrierIPRules calls NetworkAPIs.TeardownCarrierIPRules
+func (h *NetworkHelper) TeardownCarrierIPRules(args CarrierIPRulesArgs, _ *Empty) error {
+	return h.network.TeardownCarrierIPRules(args.PodIP)
+}
+
+// ReconcileHostToPodRules calls NetworkAPIs.ReconcileHostToPodRules
+func (h *NetworkHelper) ReconcileHostToPodRules(args ReconcileHostToPodRulesArgs, _ *Empty) error {
+	return h.network.ReconcileHostToPodRules(args.PrimaryMAC, &args.PrimaryAddr)
+}
+
+// ReconcileSysctls calls NetworkAPIs.ReconcileSysctls
+func (h *NetworkHelper) ReconcileSysctls(args ReconcileSysctlsArgs, reply *[]sysctlpolicy.Conflict) error {
+	conflicts, err := h.network.ReconcileSysctls(args.PrimaryMAC, args.V6Enabled, args.Policy)
+	*reply = conflicts
+	return err
+}
+
+// RepairENINetwork calls NetworkAPIs.RepairENINetwork
+func (h *NetworkHelper) RepairENINetwork(args RepairENINetworkArgs, reply *bool) error {
+	repaired, err := h.network.RepairENINetwork(args.ENIIP, args.MAC, args.DeviceNumber, args.SubnetCIDR, args.PodIPs)
+	*reply = repaired
+	return err
+}
+
+// Serve listens on socketPath and serves network calls from processes running as allowedUID until the listener fails
+func Serve(socketPath string, allowedUID uint32, network networkutils.NetworkAPIs) error {
+	server := rpc.NewServer()
+	if err := server.RegisterName(serviceName, &NetworkHelper{network: network}); err != nil {
+		return errors.Wrap(err, "network helper: failed to register service")
+	}
+
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "network helper: failed to remove stale socket %s", socketPath)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return errors.Wrapf(err, "network helper: failed to listen on %s", socketPath)
+	}
+	defer listener.Close()
+	// Only the owner can connect, the peer credentials are checked on top of that
+	if err := os.Chown(socketPath, int(allowedUID), -1); err != nil {
+		return errors.Wrapf(err, "network helper: failed to set the owner of %s", socketPath)
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		return errors.Wrapf(err, "network helper: failed to set the mode of %s", socketPath)
+	}
+	log.Infof("Network helper listening on %s for UID %d", socketPath, allowedUID)
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return errors.Wrap(err, "network helper: failed to accept connection")
+		}
+		uid, err := PeerUID(conn.(*net.UnixConn))
+		if err != nil {
+			log.Warnf("Rejecting network helper connection: %v", err)
+			conn.Close()
+			continue
+		}
+		if uid != allowedUID {
+			log.Warnf("Rejecting network helper connection from UID %d", uid)
+			conn.Close()
+			continue
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// PeerUID returns the UID of the process on the other end of conn
+func PeerUID(conn *net.UnixConn) (uint32, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+	var cred *unix.Ucred
+	var credErr error
+	if err := rawConn.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	}); err != nil {
+		return 0, err
+	}
+	if credErr != nil {
+		return 0, errors.Wrap(credErr, "failed to read peer credentials")
+	}
+	return cred.Uid, nil
+}
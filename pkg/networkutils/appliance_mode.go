@@ -0,0 +1,119 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// envGWLBApplianceMode is the name of the environment variable that adapts the node to a VPC whose traffic is
+	// steered through Gateway Load Balancer appliances. The appliances only see both directions of a flow, and keep
+	// it, when its packets go through the same ENIs both ways, and the Gateway Load Balancer drops the packets larger
+	// than its MTU. The replies to the connections entering an ENI of the node leave through that ENI, including when
+	// they are forwarded to a pod on another ENI, and the MTU of the ENIs is capped to GWLBMaxMTU. Defaults to false.
+	envGWLBApplianceMode = "ENABLE_GWLB_APPLIANCE_MODE"
+
+	// GWLBMaxMTU is the largest packet a Gateway Load Balancer forwards, it does not fragment the larger ones
+	GWLBMaxMTU = 8500
+
+	// applianceConnmarkMask holds the device number of the secondary ENI a connection entered through. It is out of
+	// the default connmark of the primary ENI and of the marks of kube-proxy.
+	applianceConnmarkMask  = 0x0f00
+	applianceConnmarkShift = 8
+
+	applianceComment = "AWS, secondary ENI"
+)
+
+func gwlbApplianceModeEnabled() bool {
+	return getBoolEnvVar(envGWLBApplianceMode, false)
+}
+
+// applianceConnmark returns the connmark of the connections entering the ENI with the given device number
+func applianceConnmark(deviceNumber int) uint32 {
+	return uint32(deviceNumber) << applianceConnmarkShift
+}
+
+// buildApplianceRestoreRules copies the connmark of the secondary ENIs to the replies of the pods, so that they are
+// routed through the ENI the connection entered through
+func (n *linuxNetwork) buildApplianceRestoreRules() []iptablesRule {
+	var rules []iptablesRule
+	for _, intf := range []string{n.vethPrefix + "+", "vlan+"} {
+		rules = append(rules, iptablesRule{
+			name:        "connmark restore for secondary ENIs from " + intf,
+			shouldExist: n.gwlbApplianceMode,
+			table:       "mangle",
+			chain:       "PREROUTING",
+			rule: []string{
+				"-m", "comment", "--comment", applianceComment,
+				"-i", intf, "-j", "CONNMARK", "--restore-mark", "--mask", fmt.Sprintf("%#x", applianceConnmarkMask),
+			},
+		})
+	}
+	return rules
+}
+
+// setupApplianceENIRules marks the connections to the node entering the secondary ENI, NodePort and hostPort traffic to
+// its IP, and routes the marked replies through the route table of the ENI
+func (n *linuxNetwork) setupApplianceENIRules(eniIP string, eniMAC string, deviceNumber int) error {
+	// With IPv6, the pods only get IPs from the primary ENI
+	if !n.gwlbApplianceMode || net.ParseIP(eniIP).To4() == nil {
+		return nil
+	}
+	mark := applianceConnmark(deviceNumber)
+	if mark&^applianceConnmarkMask != 0 {
+		log.Warnf("Appliance mode: the replies to the connections entering ENI %d may leave through another ENI, "+
+			"only device numbers up to %d are marked", deviceNumber, applianceConnmarkMask>>applianceConnmarkShift)
+		return nil
+	}
+	link, err := linkByMac(eniMAC, n.netLink, retryLinkByMacInterval)
+	if err != nil {
+		return errors.Wrapf(err, "appliance mode: failed to find the link which uses MAC address %s", eniMAC)
+	}
+	ipt, err := n.newIptables(iptables.ProtocolIPv4)
+	if err != nil {
+		return errors.Wrap(err, "appliance mode: failed to create iptables")
+	}
+	err = n.updateIptablesRules([]iptablesRule{{
+		name:        "connmark for secondary ENI " + link.Attrs().Name,
+		shouldExist: true,
+		table:       "mangle",
+		chain:       "PREROUTING",
+		rule: []string{
+			"-m", "comment", "--comment", applianceComment,
+			"-i", link.Attrs().Name,
+			"-m", "addrtype", "--dst-type", "LOCAL", "--limit-iface-in",
+			"-j", "CONNMARK", "--set-mark", fmt.Sprintf("%#x/%#x", mark, applianceConnmarkMask),
+		},
+	}}, ipt)
+	if err != nil {
+		return err
+	}
+
+	rule := n.netLink.NewRule()
+	rule.Mark = int(mark)
+	rule.Mask = applianceConnmarkMask
+	rule.Table = deviceNumber + 1
+	rule.Priority = hostRulePriority
+	rule.Family = unix.AF_INET
+	if err := n.netLink.RuleAdd(rule); err != nil && !isRuleExistsError(err) {
+		return errors.Wrapf(err, "appliance mode: failed to add the rule of ENI %d", deviceNumber)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iptableswrapper"
+	mock_iptables "github.com/aws/amazon-vpc-cni-k8s/pkg/iptableswrapper/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/netlinkwrapper/mock_netlink"
+)
+
+func TestSetupHostNetworkApplianceMode(t *testing.T) {
+	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
+	defer ctrl.Finish()
+
+	ln := &linuxNetwork{
+		nodePortSupportEnabled: true,
+		gwlbApplianceMode:      true,
+		mainENIMark:            defaultConnmark,
+		mtu:                    testMTU,
+		vethPrefix:             eniPrefix,
+
+		netLink: mockNetLink,
+		ns:      mockNS,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	setupNetLinkMocks(ctrl, mockNetLink)
+
+	err := ln.SetupHostNetwork([]string{"10.10.0.0/16"}, loopback, &testEniIPNet, false, true, false)
+	assert.NoError(t, err)
+
+	prerouting := mockIptables.(*mock_iptables.MockIptables).DataplaneState["mangle"]["PREROUTING"]
+	for _, intf := range []string{"eni+", "vlan+"} {
+		assert.Contains(t, prerouting, []string{
+			"-m", "comment", "--comment", "AWS, secondary ENI", "-i", intf, "-j", "CONNMARK", "--restore-mark", "--mask", "0xf00",
+		})
+	}
+}
+
+func TestSetupApplianceENIRules(t *testing.T) {
+	ctrl, mockNetLink, _, _, mockIptables := setup(t)
+	defer ctrl.Finish()
+
+	ln := &linuxNetwork{
+		gwlbApplianceMode: true,
+		netLink:           mockNetLink,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	hwAddr, err := net.ParseMAC(testMAC2)
+	assert.NoError(t, err)
+	eth2 := mock_netlink.NewMockLink(ctrl)
+	eth2.EXPECT().Attrs().Return(&netlink.LinkAttrs{HardwareAddr: hwAddr, Name: "eth2"}).AnyTimes()
+	mockNetLink.EXPECT().LinkList().Return([]netlink.Link{eth2}, nil)
+	var rule netlink.Rule
+	mockNetLink.EXPECT().NewRule().Return(&rule)
+	mockNetLink.EXPECT().RuleAdd(&rule).Return(nil)
+
+	err = ln.setupApplianceENIRules(testEniIP, testMAC2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{
+		"-m", "comment", "--comment", "AWS, secondary ENI", "-i", "eth2",
+		"-m", "addrtype", "--dst-type", "LOCAL", "--limit-iface-in", "-j", "CONNMARK", "--set-mark", "0x200/0xf00",
+	}}, mockIptables.(*mock_iptables.MockIptables).DataplaneState["mangle"]["PREROUTING"])
+	assert.Equal(t, netlink.Rule{Mark: 0x200, Mask: 0xf00, Table: 3, Priority: hostRulePriority, Family: unix.AF_INET}, rule)
+
+	// The device numbers that do not fit in the mark are left alone, as are IPv6 ENIs
+	assert.NoError(t, ln.setupApplianceENIRules(testEniIP, testMAC2, 16))
+	assert.NoError(t, ln.setupApplianceENIRules(testEniIP6, testMAC2, 2))
+	ln.gwlbApplianceMode = false
+	assert.NoError(t, ln.setupApplianceENIRules(testEniIP, testMAC2, 2))
+}
+
+func TestGetEthernetMTUApplianceMode(t *testing.T) {
+	t.Setenv(envMTU, "9001")
+	assert.Equal(t, 9001, GetEthernetMTU())
+	t.Setenv(envGWLBApplianceMode, "true")
+	assert.Equal(t, GWLBMaxMTU, GetEthernetMTU())
+	t.Setenv(envMTU, "1500")
+	assert.Equal(t, 1500, GetEthernetMTU())
+}
@@ -0,0 +1,155 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// RepairENINetwork programs the network of a secondary ENI again when the host removed part of it, as happens when its
+// link goes down and up or a host network daemon flushes its route table, and adds back the missing rules of the pods
+// using the ENI. It returns whether anything was repaired.
+func (n *linuxNetwork) RepairENINetwork(eniIP string, mac string, deviceNumber int, subnetCIDR string, podIPs []string) (bool, error) {
+	if deviceNumber == 0 {
+		return false, errors.New("RepairENINetwork should never be called on the primary ENI")
+	}
+	link, err := linkByMac(mac, n.netLink, 0)
+	if err != nil {
+		return false, errors.Wrapf(err, "RepairENINetwork: failed to find the link which uses MAC address %s", mac)
+	}
+	family := unix.AF_INET
+	if strings.Contains(subnetCIDR, ":") {
+		family = unix.AF_INET6
+	}
+
+	repaired := false
+	drift, err := n.eniNetworkDrift(link, family, eniIP, deviceNumber, subnetCIDR)
+	if err != nil {
+		return false, err
+	}
+	if drift != "" {
+		log.Infof("Network of the ENI with MAC address %s changed on the host (%s), setting it up again", mac, drift)
+		err = setupENINetwork(eniIP, mac, deviceNumber, subnetCIDR, n.netLink, retryLinkByMacInterval, retryRouteAddInterval, n.mtu)
+		if err != nil {
+			return false, errors.Wrapf(err, "RepairENINetwork: failed to set up ENI %s", eniIP)
+		}
+		repaired = true
+	}
+
+	added, err := n.repairFromPodRules(family, deviceNumber+1, podIPs)
+	if err != nil {
+		return repaired, err
+	}
+	return repaired || added, nil
+}
+
+// eniNetworkDrift returns what setupENINetwork configured on the ENI and is missing, or "" when nothing is
+func (n *linuxNetwork) eniNetworkDrift(link netlink.Link, family int, eniIP string, deviceNumber int, subnetCIDR string) (string, error) {
+	if link.Attrs().Flags&net.FlagUp == 0 {
+		return "link is down", nil
+	}
+
+	addrs, err := n.netLink.AddrList(link, family)
+	if err != nil {
+		return "", errors.Wrap(err, "RepairENINetwork: failed to list IP address for ENI")
+	}
+	hasAddr := false
+	for _, addr := range addrs {
+		if addr.IP.Equal(net.ParseIP(eniIP)) {
+			hasAddr = true
+			break
+		}
+	}
+	if !hasAddr {
+		return fmt.Sprintf("address %s is missing", eniIP), nil
+	}
+
+	var gw net.IP
+	if family == unix.AF_INET6 {
+		gw = GetIPv6Gateway()
+	} else {
+		_, eniSubnetIPNet, err := net.ParseCIDR(subnetCIDR)
+		if err != nil {
+			return "", errors.Wrapf(err, "RepairENINetwork: invalid IP CIDR block %s", subnetCIDR)
+		}
+		gw = GetIPv4Gateway(eniSubnetIPNet)
+	}
+	tableNumber := deviceNumber + 1
+	routes, err := n.netLink.RouteListFiltered(family, &netlink.Route{LinkIndex: link.Attrs().Index, Table: tableNumber},
+		netlink.RT_FILTER_OIF|netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return "", errors.Wrapf(err, "RepairENINetwork: failed to list the routes of table %d", tableNumber)
+	}
+	hasGatewayRoute, hasDefaultRoute := false, false
+	for _, route := range routes {
+		if route.Dst == nil {
+			hasDefaultRoute = true
+			continue
+		}
+		if ones, _ := route.Dst.Mask.Size(); ones == 0 {
+			hasDefaultRoute = true
+		} else if route.Dst.IP.Equal(gw) {
+			hasGatewayRoute = true
+		}
+	}
+	if !hasGatewayRoute || !hasDefaultRoute {
+		return fmt.Sprintf("routes of table %d are missing", tableNumber), nil
+	}
+	return "", nil
+}
+
+// repairFromPodRules adds back the rules routing the traffic of the pods through the route table of their ENI
+func (n *linuxNetwork) repairFromPodRules(family int, tableNumber int, podIPs []string) (bool, error) {
+	if len(podIPs) == 0 {
+		return false, nil
+	}
+	rules, err := n.netLink.RuleList(family)
+	if err != nil {
+		return false, errors.Wrap(err, "RepairENINetwork: failed to list rules")
+	}
+	existing := make(map[string]bool, len(rules))
+	for _, rule := range rules {
+		if rule.Priority == FromPodRulePriority && rule.Table == tableNumber && rule.Src != nil {
+			existing[rule.Src.IP.String()] = true
+		}
+	}
+
+	added := false
+	for _, podIP := range podIPs {
+		ip := net.ParseIP(podIP)
+		if ip == nil || existing[ip.String()] {
+			continue
+		}
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		podRule := n.netLink.NewRule()
+		podRule.Src = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+		podRule.Table = tableNumber
+		podRule.Priority = FromPodRulePriority
+		if err := n.netLink.RuleAdd(podRule); err != nil && !isRuleExistsError(err) {
+			return added, errors.Wrapf(err, "RepairENINetwork: failed to add the rule of pod %s", podIP)
+		}
+		log.Infof("Added back the rule of pod %s to route table %d", podIP, tableNumber)
+		added = true
+	}
+	return added, nil
+}
@@ -0,0 +1,99 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestRepairENINetwork(t *testing.T) {
+	ctrl, mockNetLink, _, _, _ := setup(t)
+	defer ctrl.Finish()
+	ln := &linuxNetwork{netLink: mockNetLink, mtu: testMTU}
+
+	hwAddr, _ := net.ParseMAC(testMAC2)
+	eth1 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 3, Name: "eth1", HardwareAddr: hwAddr, Flags: net.FlagUp}}
+	eniAddr := netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(testEniIP), Mask: net.CIDRMask(16, 32)}}
+	tableNumber := testTable + 1
+	routes := []netlink.Route{
+		{LinkIndex: 3, Dst: &net.IPNet{IP: net.ParseIP("10.10.0.1"), Mask: net.CIDRMask(32, 32)}, Table: tableNumber},
+		{LinkIndex: 3, Gw: net.ParseIP("10.10.0.1"), Table: tableNumber},
+	}
+	podIP := "10.10.10.21"
+	podRule := netlink.NewRule()
+	podRule.Src = &net.IPNet{IP: net.ParseIP(podIP), Mask: net.CIDRMask(32, 32)}
+	podRule.Table = tableNumber
+	podRule.Priority = FromPodRulePriority
+	routeFilter := &netlink.Route{LinkIndex: 3, Table: tableNumber}
+	routeFilterMask := netlink.RT_FILTER_OIF | netlink.RT_FILTER_TABLE
+
+	// Nothing to repair
+	mockNetLink.EXPECT().LinkList().Return([]netlink.Link{eth1}, nil)
+	mockNetLink.EXPECT().AddrList(eth1, unix.AF_INET).Return([]netlink.Addr{eniAddr}, nil)
+	mockNetLink.EXPECT().RouteListFiltered(unix.AF_INET, routeFilter, routeFilterMask).Return(routes, nil)
+	mockNetLink.EXPECT().RuleList(unix.AF_INET).Return([]netlink.Rule{*podRule}, nil)
+	repaired, err := ln.RepairENINetwork(testEniIP, testMAC2, testTable, testEniSubnet, []string{podIP})
+	assert.NoError(t, err)
+	assert.False(t, repaired)
+
+	// The route table was flushed and the rule of the pod removed
+	mockNetLink.EXPECT().LinkList().Return([]netlink.Link{eth1}, nil).Times(2)
+	mockNetLink.EXPECT().AddrList(eth1, unix.AF_INET).Return([]netlink.Addr{eniAddr}, nil).Times(2)
+	mockNetLink.EXPECT().RouteListFiltered(unix.AF_INET, routeFilter, routeFilterMask).Return(nil, nil)
+	mockNetLink.EXPECT().LinkSetMTU(eth1, testMTU).Return(nil)
+	mockNetLink.EXPECT().LinkSetUp(eth1).Return(nil)
+	mockNetLink.EXPECT().AddrDel(eth1, gomock.Any()).Return(nil)
+	mockNetLink.EXPECT().AddrAdd(eth1, gomock.Any()).Return(nil)
+	mockNetLink.EXPECT().RouteDel(gomock.Any()).Return(nil).Times(3)
+	mockNetLink.EXPECT().RouteReplace(gomock.Any()).Return(nil).Times(2)
+	mockNetLink.EXPECT().RuleList(unix.AF_INET).Return(nil, nil)
+	mockNetLink.EXPECT().NewRule().Return(netlink.NewRule())
+	mockNetLink.EXPECT().RuleAdd(podRule).Return(nil)
+	repaired, err = ln.RepairENINetwork(testEniIP, testMAC2, testTable, testEniSubnet, []string{podIP})
+	assert.NoError(t, err)
+	assert.True(t, repaired)
+}
+
+func TestENINetworkDrift(t *testing.T) {
+	ctrl, mockNetLink, _, _, _ := setup(t)
+	defer ctrl.Finish()
+	ln := &linuxNetwork{netLink: mockNetLink}
+
+	eth1 := &netlink.Device{LinkAttrs: netlink.LinkAttrs{Index: 3, Name: "eth1"}}
+	drift, err := ln.eniNetworkDrift(eth1, unix.AF_INET, testEniIP, testTable, testEniSubnet)
+	assert.NoError(t, err)
+	assert.Equal(t, "link is down", drift)
+
+	eth1.Flags = net.FlagUp
+	mockNetLink.EXPECT().AddrList(eth1, unix.AF_INET).Return(nil, nil)
+	drift, err = ln.eniNetworkDrift(eth1, unix.AF_INET, testEniIP, testTable, testEniSubnet)
+	assert.NoError(t, err)
+	assert.Equal(t, "address 10.10.10.20 is missing", drift)
+
+	// The link route to the gateway is gone
+	eniAddr := netlink.Addr{IPNet: &net.IPNet{IP: net.ParseIP(testEniIP), Mask: net.CIDRMask(16, 32)}}
+	mockNetLink.EXPECT().AddrList(eth1, unix.AF_INET).Return([]netlink.Addr{eniAddr}, nil)
+	mockNetLink.EXPECT().RouteListFiltered(unix.AF_INET, gomock.Any(), gomock.Any()).Return([]netlink.Route{
+		{LinkIndex: 3, Dst: &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}, Gw: net.ParseIP("10.10.0.1")},
+	}, nil)
+	drift, err = ln.eniNetworkDrift(eth1, unix.AF_INET, testEniIP, testTable, testEniSubnet)
+	assert.NoError(t, err)
+	assert.Equal(t, "routes of table 11 are missing", drift)
+}
@@ -0,0 +1,120 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iptableswrapper"
+)
+
+const (
+	// envHairpinSNAT is the name of the environment variable that enables SNAT to the primary IP of the node for the
+	// traffic that a pod sends to a Service and that is load balanced to a pod on the same node, including the pod
+	// itself. Without SNAT, a pod reaching itself through a Service sees its own IP as source and drops the traffic,
+	// unless the service proxy masquerades hairpin traffic. Defaults to false.
+	envHairpinSNAT = "AWS_VPC_K8S_CNI_HAIRPIN_SNAT"
+
+	// envStrictRPFSupport is the name of the environment variable that keeps NodePort and hostPort traffic to the pods
+	// on secondary ENIs working when the primary ENI has strict reverse path filtering. The connmark of the traffic
+	// entering the primary ENI is copied to the packets, and the reverse path check takes the mark into account, so
+	// that it finds the route back through the primary ENI rather than through the ENI of the pod. Reverse path
+	// filtering of the primary ENI is then left to the host. Defaults to false.
+	envStrictRPFSupport = "AWS_VPC_CNI_STRICT_RPF_SUPPORT"
+
+	// hairpinMark marks the forwarded packets to SNAT for hairpin support. Unlike the connmark, it only lives as long
+	// as the packet, between the mangle FORWARD and nat POSTROUTING chains.
+	hairpinMark = 0x40
+
+	hairpinComment = "AWS, hairpin"
+)
+
+func hairpinSNATEnabled() bool {
+	return getBoolEnvVar(envHairpinSNAT, false)
+}
+
+func strictRPFSupportEnabled() bool {
+	return getBoolEnvVar(envStrictRPFSupport, false)
+}
+
+// HostToPodRulesEnabled returns whether hairpin SNAT or strict reverse path filtering support is enabled, and the
+// host-to-pod rules need reconciling
+func HostToPodRulesEnabled() bool {
+	return hairpinSNATEnabled() || strictRPFSupportEnabled()
+}
+
+// ReconcileHostToPodRules restores the hairpin and reverse path rules, which other agents flushing the mangle and nat
+// tables can remove after the host network setup. ReconcileSysctls sets src_valid_mark for the reverse path rule.
+func (n *linuxNetwork) ReconcileHostToPodRules(primaryMAC string, primaryAddr *net.IP) error {
+	if !n.hairpinSNAT && !n.strictRPFSupport {
+		return nil
+	}
+	primaryIntf, err := findPrimaryInterfaceName(primaryMAC)
+	if err != nil {
+		return errors.Wrap(err, "host-to-pod rules: failed to find the primary interface")
+	}
+	ipt, err := n.newIptables(iptables.ProtocolIPv4)
+	if err != nil {
+		return errors.Wrap(err, "host-to-pod rules: failed to create iptables")
+	}
+	return n.updateHostToPodRules(primaryIntf, primaryAddr, ipt)
+}
+
+func (n *linuxNetwork) updateHostToPodRules(primaryIntf string, primaryAddr *net.IP, ipt iptableswrapper.IPTablesIface) error {
+	return n.updateIptablesRules(n.buildHostToPodRules(primaryIntf, primaryAddr), ipt)
+}
+
+func (n *linuxNetwork) buildHostToPodRules(primaryIntf string, primaryAddr *net.IP) []iptablesRule {
+	vethIntfs := n.vethPrefix + "+"
+	return []iptablesRule{
+		{
+			name:        "hairpin mark",
+			shouldExist: n.hairpinSNAT,
+			table:       "mangle",
+			chain:       "FORWARD",
+			rule: []string{
+				"-i", vethIntfs, "-o", vethIntfs,
+				"-m", "conntrack", "--ctstate", "DNAT",
+				"-m", "comment", "--comment", hairpinComment,
+				"-j", "MARK", "--set-xmark", fmt.Sprintf("%#x/%#x", hairpinMark, hairpinMark),
+			},
+		},
+		{
+			name:        "hairpin SNAT",
+			shouldExist: n.hairpinSNAT,
+			table:       "nat",
+			chain:       "POSTROUTING",
+			rule: []string{
+				"-m", "mark", "--mark", fmt.Sprintf("%#x/%#x", hairpinMark, hairpinMark),
+				"-m", "comment", "--comment", hairpinComment,
+				"-j", "SNAT", "--to-source", primaryAddr.String(),
+			},
+		},
+		{
+			// Follows the rule setting the connmark of the traffic entering the primary ENI
+			name:        "connmark restore for primary ENI reverse path",
+			shouldExist: n.strictRPFSupport && n.nodePortSupportEnabled,
+			table:       "mangle",
+			chain:       "PREROUTING",
+			rule: []string{
+				"-m", "comment", "--comment", "AWS, primary ENI",
+				"-i", primaryIntf, "-j", "CONNMARK", "--restore-mark", "--mask", fmt.Sprintf("%#x", n.mainENIMark),
+			},
+		},
+	}
+}
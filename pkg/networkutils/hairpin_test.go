@@ -0,0 +1,145 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"testing"
+
+	"github.com/coreos/go-iptables/iptables"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/iptableswrapper"
+	mock_iptables "github.com/aws/amazon-vpc-cni-k8s/pkg/iptableswrapper/mocks"
+)
+
+var (
+	hairpinMarkRule = []string{
+		"-i", "eni+", "-o", "eni+", "-m", "conntrack", "--ctstate", "DNAT",
+		"-m", "comment", "--comment", "AWS, hairpin", "-j", "MARK", "--set-xmark", "0x40/0x40",
+	}
+	hairpinSNATRule = []string{
+		"-m", "mark", "--mark", "0x40/0x40", "-m", "comment", "--comment", "AWS, hairpin",
+		"-j", "SNAT", "--to-source", "10.10.10.20",
+	}
+	primaryENIRestoreMarkRule = []string{
+		"-m", "comment", "--comment", "AWS, primary ENI", "-i", "lo", "-j", "CONNMARK", "--restore-mark", "--mask", "0x80",
+	}
+)
+
+func TestSetupHostNetworkHostToPodRules(t *testing.T) {
+	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
+	defer ctrl.Finish()
+
+	ln := &linuxNetwork{
+		nodePortSupportEnabled: true,
+		hairpinSNAT:            true,
+		strictRPFSupport:       true,
+		mainENIMark:            defaultConnmark,
+		mtu:                    testMTU,
+		vethPrefix:             eniPrefix,
+
+		netLink: mockNetLink,
+		ns:      mockNS,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	setupNetLinkMocks(ctrl, mockNetLink)
+
+	err := ln.SetupHostNetwork([]string{"10.10.0.0/16"}, loopback, &testEniIPNet, false, true, false)
+	assert.NoError(t, err)
+
+	state := mockIptables.(*mock_iptables.MockIptables).DataplaneState
+	assert.Equal(t, [][]string{hairpinMarkRule}, state["mangle"]["FORWARD"])
+	assert.Contains(t, state["nat"]["POSTROUTING"], hairpinSNATRule)
+	// The mark is restored on the traffic entering the primary ENI only after it is set
+	prerouting := state["mangle"]["PREROUTING"]
+	assert.Equal(t, primaryENIRestoreMarkRule, prerouting[len(prerouting)-1])
+}
+
+func TestReconcileHostToPodRules(t *testing.T) {
+	ctrl, _, _, _, mockIptables := setup(t)
+	defer ctrl.Finish()
+
+	ln := &linuxNetwork{
+		nodePortSupportEnabled: true,
+		mainENIMark:            defaultConnmark,
+		vethPrefix:             eniPrefix,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	state := mockIptables.(*mock_iptables.MockIptables).DataplaneState
+
+	// Nothing to reconcile when both options are disabled
+	assert.NoError(t, ln.ReconcileHostToPodRules(loopback, &testEniIPNet))
+	assert.Empty(t, state)
+
+	ln.hairpinSNAT = true
+	ln.strictRPFSupport = true
+	assert.NoError(t, ln.ReconcileHostToPodRules(loopback, &testEniIPNet))
+	assert.Equal(t, [][]string{hairpinMarkRule}, state["mangle"]["FORWARD"])
+	assert.Equal(t, [][]string{hairpinSNATRule}, state["nat"]["POSTROUTING"])
+	assert.Equal(t, [][]string{primaryENIRestoreMarkRule}, state["mangle"]["PREROUTING"])
+
+	// Reconciling again leaves the rules as they are
+	assert.NoError(t, ln.ReconcileHostToPodRules(loopback, &testEniIPNet))
+	assert.Len(t, state["mangle"]["FORWARD"], 1)
+	assert.Len(t, state["nat"]["POSTROUTING"], 1)
+
+	// Strict reverse path filtering support needs the connmark of the NodePort support
+	ln.hairpinSNAT = false
+	ln.nodePortSupportEnabled = false
+	assert.NoError(t, ln.ReconcileHostToPodRules(loopback, &testEniIPNet))
+	assert.Empty(t, state["mangle"]["FORWARD"])
+	assert.Empty(t, state["nat"]["POSTROUTING"])
+	assert.Empty(t, state["mangle"]["PREROUTING"])
+}
+
+func TestSetupHostNetworkIptablesPosition(t *testing.T) {
+	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
+	defer ctrl.Finish()
+
+	ln := &linuxNetwork{
+		nodePortSupportEnabled: true,
+		strictRPFSupport:       true,
+		iptablesPosition:       2,
+		mainENIMark:            defaultConnmark,
+		mtu:                    testMTU,
+		vethPrefix:             eniPrefix,
+
+		netLink: mockNetLink,
+		ns:      mockNS,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	setupNetLinkMocks(ctrl, mockNetLink)
+	state := mockIptables.(*mock_iptables.MockIptables).DataplaneState
+	state["mangle"] = map[string][][]string{"PREROUTING": {{"-j", "FIRST"}, {"-j", "SECOND"}}}
+
+	err := ln.SetupHostNetwork([]string{"10.10.0.0/16"}, loopback, &testEniIPNet, false, true, false)
+	assert.NoError(t, err)
+
+	// The rules of the CNI are inserted in order from the second position on
+	prerouting := state["mangle"]["PREROUTING"]
+	if assert.Len(t, prerouting, 6) {
+		assert.Equal(t, []string{"-j", "FIRST"}, prerouting[0])
+		assert.Contains(t, prerouting[1], "--set-mark")
+		assert.Equal(t, primaryENIRestoreMarkRule, prerouting[4])
+		assert.Equal(t, []string{"-j", "SECOND"}, prerouting[5])
+	}
+	// The position is past the end of the chain
+	assert.Len(t, state["nat"]["POSTROUTING"], 1)
+}
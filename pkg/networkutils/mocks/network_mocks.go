@@ -23,6 +23,7 @@ import (
 	reflect "reflect"
 	time "time"
 
+	sysctlpolicy "github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
 	gomock "github.com/golang/mock/gomock"
 	netlink "github.com/vishvananda/netlink"
 )
@@ -137,6 +138,76 @@ func (mr *MockNetworkAPIsMockRecorder) GetRuleListBySrc(arg0, arg1 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRuleListBySrc", reflect.TypeOf((*MockNetworkAPIs)(nil).GetRuleListBySrc), arg0, arg1)
 }
 
+// ReconcileHostToPodRules mocks base method.
+func (m *MockNetworkAPIs) ReconcileHostToPodRules(arg0 string, arg1 *net.IP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileHostToPodRules", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReconcileHostToPodRules indicates an expected call of ReconcileHostToPodRules.
+func (mr *MockNetworkAPIsMockRecorder) ReconcileHostToPodRules(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileHostToPodRules", reflect.TypeOf((*MockNetworkAPIs)(nil).ReconcileHostToPodRules), arg0, arg1)
+}
+
+// ReconcileSysctls mocks base method.
+func (m *MockNetworkAPIs) ReconcileSysctls(arg0 string, arg1 bool, arg2 []sysctlpolicy.Setting) ([]sysctlpolicy.Conflict, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileSysctls", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]sysctlpolicy.Conflict)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReconcileSysctls indicates an expected call of ReconcileSysctls.
+func (mr *MockNetworkAPIsMockRecorder) ReconcileSysctls(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileSysctls", reflect.TypeOf((*MockNetworkAPIs)(nil).ReconcileSysctls), arg0, arg1, arg2)
+}
+
+// RepairENINetwork mocks base method.
+func (m *MockNetworkAPIs) RepairENINetwork(arg0, arg1 string, arg2 int, arg3 string, arg4 []string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RepairENINetwork", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RepairENINetwork indicates an expected call of RepairENINetwork.
+func (mr *MockNetworkAPIsMockRecorder) RepairENINetwork(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RepairENINetwork", reflect.TypeOf((*MockNetworkAPIs)(nil).RepairENINetwork), arg0, arg1, arg2, arg3, arg4)
+}
+
+// SetRoutedExcludeSNATCIDRs mocks base method.
+func (m *MockNetworkAPIs) SetRoutedExcludeSNATCIDRs(arg0 []string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetRoutedExcludeSNATCIDRs", arg0)
+}
+
+// SetRoutedExcludeSNATCIDRs indicates an expected call of SetRoutedExcludeSNATCIDRs.
+func (mr *MockNetworkAPIsMockRecorder) SetRoutedExcludeSNATCIDRs(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRoutedExcludeSNATCIDRs", reflect.TypeOf((*MockNetworkAPIs)(nil).SetRoutedExcludeSNATCIDRs), arg0)
+}
+
+// SetupCarrierIPRules mocks base method.
+func (m *MockNetworkAPIs) SetupCarrierIPRules(arg0 net.IP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetupCarrierIPRules", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetupCarrierIPRules indicates an expected call of SetupCarrierIPRules.
+func (mr *MockNetworkAPIsMockRecorder) SetupCarrierIPRules(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetupCarrierIPRules", reflect.TypeOf((*MockNetworkAPIs)(nil).SetupCarrierIPRules), arg0)
+}
+
 // SetupENINetwork mocks base method.
 func (m *MockNetworkAPIs) SetupENINetwork(arg0, arg1 string, arg2 int, arg3 string) error {
 	m.ctrl.T.Helper()
@@ -165,6 +236,20 @@ func (mr *MockNetworkAPIsMockRecorder) SetupHostNetwork(arg0, arg1, arg2, arg3,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetupHostNetwork", reflect.TypeOf((*MockNetworkAPIs)(nil).SetupHostNetwork), arg0, arg1, arg2, arg3, arg4, arg5)
 }
 
+// TeardownCarrierIPRules mocks base method.
+func (m *MockNetworkAPIs) TeardownCarrierIPRules(arg0 net.IP) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TeardownCarrierIPRules", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TeardownCarrierIPRules indicates an expected call of TeardownCarrierIPRules.
+func (mr *MockNetworkAPIsMockRecorder) TeardownCarrierIPRules(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TeardownCarrierIPRules", reflect.TypeOf((*MockNetworkAPIs)(nil).TeardownCarrierIPRules), arg0)
+}
+
 // UpdateExternalServiceIpRules mocks base method.
 func (m *MockNetworkAPIs) UpdateExternalServiceIpRules(arg0 []netlink.Rule, arg1 []string) error {
 	m.ctrl.T.Helper()
@@ -23,12 +23,14 @@ import (
 	"reflect"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/coreos/go-iptables/iptables"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/sgpp"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
 	"github.com/aws/amazon-vpc-cni-k8s/utils"
 
 	"k8s.io/apimachinery/pkg/util/sets"
@@ -46,6 +48,7 @@ import (
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/netlinkwrapper"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/nswrapper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper"
 )
 
 const (
@@ -120,6 +123,15 @@ const (
 	defaultMTU = 9001
 	minMTUv4   = 576
 
+	// envIptablesPosition is the environment variable to configure the position at which the rules of the CNI are
+	// inserted in the built-in iptables chains, PREROUTING, FORWARD and POSTROUTING. Other agents can then order their
+	// rules relative to them whichever starts first. Defaults to 0, the rules are appended.
+	envIptablesPosition = "AWS_VPC_K8S_CNI_IPTABLES_POSITION"
+
+	// envPrimaryENIDeviceNumber is the device number of the ENI that ipamd uses as the primary ENI. When it is not 0,
+	// the traffic marked to go through the primary ENI uses the route table of that ENI instead of the main one.
+	envPrimaryENIDeviceNumber = "PRIMARY_ENI_DEVICE_NUMBER"
+
 	// envVethPrefix is the environment variable to configure the prefix of the host side veth device names
 	envVethPrefix = "AWS_VPC_K8S_CNI_VETHPREFIX"
 
@@ -140,7 +152,10 @@ const (
 	retryLinkByMacInterval = 3 * time.Second
 )
 
-var log = logger.Get()
+var log = logger.GetComponent("networkutils")
+
+// ErrLinkNotFound is returned when no link of the node uses the MAC address of an ENI
+var ErrLinkNotFound = errors.New("no interface found which uses mac address")
 
 // NetworkAPIs defines the host level and the ENI level network related operations
 type NetworkAPIs interface {
@@ -154,12 +169,27 @@ type NetworkAPIs interface {
 	CleanUpStaleAWSChains(v4Enabled, v6Enabled bool) error
 	UseExternalSNAT() bool
 	GetExcludeSNATCIDRs() []string
+	// SetRoutedExcludeSNATCIDRs sets the CIDRs learned from the VPC route table that are excluded from SNAT on top of
+	// the configured ones, from the next update of the host iptables rules
+	SetRoutedExcludeSNATCIDRs(cidrs []string)
 	GetExternalServiceCIDRs() []string
 	GetRuleList() ([]netlink.Rule, error)
 	GetRuleListBySrc(ruleList []netlink.Rule, src net.IPNet) ([]netlink.Rule, error)
 	UpdateRuleListBySrc(ruleList []netlink.Rule, src net.IPNet) error
 	UpdateExternalServiceIpRules(ruleList []netlink.Rule, externalIPs []string) error
 	GetLinkByMac(mac string, retryInterval time.Duration) (netlink.Link, error)
+	// SetupCarrierIPRules excludes the traffic of a pod with a carrier IP from SNAT
+	SetupCarrierIPRules(podIP net.IP) error
+	// TeardownCarrierIPRules removes the rules added by SetupCarrierIPRules
+	TeardownCarrierIPRules(podIP net.IP) error
+	// ReconcileHostToPodRules restores the hairpin SNAT and strict reverse path filtering rules, if enabled
+	ReconcileHostToPodRules(primaryMAC string, primaryAddr *net.IP) error
+	// ReconcileSysctls sets the sysctls of the interfaces, the settings of the policy replacing the defaults, and
+	// returns the conflicts with the configuration of the host
+	ReconcileSysctls(primaryMAC string, v6Enabled bool, policy []sysctlpolicy.Setting) ([]sysctlpolicy.Conflict, error)
+	// RepairENINetwork sets up the network of a secondary ENI again if the host removed part of it, and adds back the
+	// missing rules of the pods using it
+	RepairENINetwork(eniIP string, mac string, deviceNumber int, subnetCIDR string, podIPs []string) (bool, error)
 }
 
 type linuxNetwork struct {
@@ -167,13 +197,21 @@ type linuxNetwork struct {
 	ipv6EgressEnabled      bool
 	excludeSNATCIDRs       []string
 	externalServiceCIDRs   []string
+	routedSNATLock         sync.RWMutex
+	routedExcludeSNATCIDRs []string
 	typeOfSNAT             snatType
 	nodePortSupportEnabled bool
 	mtu                    int
 	vethPrefix             string
 	podSGEnforcingMode     sgpp.EnforcingMode
+	hairpinSNAT            bool
+	strictRPFSupport       bool
+	gwlbApplianceMode      bool
+	iptablesPosition       int
+	primaryDeviceNumber    int
 
 	netLink     netlinkwrapper.NetLink
+	sysctls     *sysctlpolicy.Engine
 	ns          nswrapper.NS
 	newIptables func(IPProtocol iptables.Protocol) (iptableswrapper.IPTablesIface, error)
 	mainENIMark uint32
@@ -195,14 +233,20 @@ func New() NetworkAPIs {
 		excludeSNATCIDRs:       parseCIDRString(envExcludeSNATCIDRs),
 		externalServiceCIDRs:   parseCIDRString(envExternalServiceCIDRs),
 		typeOfSNAT:             typeOfSNAT(),
-		nodePortSupportEnabled: nodePortSupportEnabled(),
+		nodePortSupportEnabled: nodePortSupportEnabled() || gwlbApplianceModeEnabled(),
 		mainENIMark:            getConnmark(),
 		mtu:                    GetEthernetMTU(),
 		vethPrefix:             getVethPrefixName(),
 		podSGEnforcingMode:     sgpp.LoadEnforcingModeFromEnv(),
+		hairpinSNAT:            hairpinSNATEnabled(),
+		strictRPFSupport:       strictRPFSupportEnabled(),
+		gwlbApplianceMode:      gwlbApplianceModeEnabled(),
+		iptablesPosition:       getIptablesPosition(),
+		primaryDeviceNumber:    getPrimaryENIDeviceNumber(),
 
 		netLink: netlinkwrapper.NewNetLink(),
 		ns:      nswrapper.NewNS(),
+		sysctls: sysctlpolicy.NewEngine(procsyswrapper.NewProcSys()),
 		newIptables: func(IPProtocol iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
 			ipt, err := iptables.NewWithProtocol(IPProtocol)
 			return ipt, err
@@ -321,7 +365,7 @@ func (n *linuxNetwork) SetupHostNetwork(vpcv4CIDRs []string, primaryMAC string,
 	mainENIRule := n.netLink.NewRule()
 	mainENIRule.Mark = int(n.mainENIMark)
 	mainENIRule.Mask = int(n.mainENIMark)
-	mainENIRule.Table = mainRoutingTable
+	mainENIRule.Table = n.primaryENIRouteTable(v6Enabled)
 	mainENIRule.Priority = hostRulePriority
 	mainENIRule.Family = ipFamily
 	// If this is a restart, cleanup previous rule first
@@ -457,6 +501,10 @@ func (n *linuxNetwork) updateHostIptablesRules(vpcCIDRs []string, primaryMAC str
 		if err := n.updateIptablesRules(iptablesConnmarkRules, ipt); err != nil {
 			return err
 		}
+
+		if err := n.updateHostToPodRules(primaryIntf, primaryAddr, ipt); err != nil {
+			return err
+		}
 	}
 	return nil
 }
@@ -471,7 +519,7 @@ func (n *linuxNetwork) buildIptablesSNATRules(vpcCIDRs []string, primaryAddr *ne
 		log.Debugf("Adding %s CIDR to NAT chain", cidr)
 		allCIDRs = append(allCIDRs, snatCIDR{cidr: cidr, isExclusion: false})
 	}
-	for _, cidr := range n.excludeSNATCIDRs {
+	for _, cidr := range n.allExcludeSNATCIDRs() {
 		log.Debugf("Adding %s Excluded CIDR to NAT chain", cidr)
 		allCIDRs = append(allCIDRs, snatCIDR{cidr: cidr, isExclusion: true})
 	}
@@ -584,15 +632,18 @@ func (n *linuxNetwork) buildIptablesSNATRules(vpcCIDRs []string, primaryAddr *ne
 		},
 	})
 
+	iptableRules = append(iptableRules, n.buildApplianceRestoreRules()...)
+
 	log.Debugf("iptableRules: %v", iptableRules)
 	return iptableRules, nil
 }
 
 func (n *linuxNetwork) buildIptablesConnmarkRules(vpcCIDRs []string, ipt iptableswrapper.IPTablesIface) ([]iptablesRule, error) {
+	excludeSNATCIDRs := n.allExcludeSNATCIDRs()
 	var allCIDRs []string
 	allCIDRs = append(allCIDRs, vpcCIDRs...)
-	allCIDRs = append(allCIDRs, n.excludeSNATCIDRs...)
-	excludeCIDRs := sets.NewString(n.excludeSNATCIDRs...)
+	allCIDRs = append(allCIDRs, excludeSNATCIDRs...)
+	excludeCIDRs := sets.NewString(excludeSNATCIDRs...)
 
 	log.Debugf("Total CIDRs to exempt from connmark rules - %d", len(allCIDRs))
 
@@ -709,6 +760,16 @@ func (n *linuxNetwork) updateIptablesRules(iptableRules []iptablesRule, ipt ipta
 					log.Errorf("host network setup: failed to insert %v, %v", rule, err)
 					return errors.Wrapf(err, "host network setup: failed to add %v", rule)
 				}
+			} else if n.iptablesPosition > 0 && builtinChains.Has(rule.chain) {
+				pos, err := n.iptablesInsertPosition(rule.table, rule.chain, ipt)
+				if err != nil {
+					return err
+				}
+				err = ipt.Insert(rule.table, rule.chain, pos, rule.rule...)
+				if err != nil {
+					log.Errorf("host network setup: failed to insert %v at %d, %v", rule, pos, err)
+					return errors.Wrapf(err, "host network setup: failed to add %v", rule)
+				}
 			} else {
 				err = ipt.Append(rule.table, rule.chain, rule.rule...)
 				if err != nil {
@@ -727,6 +788,34 @@ func (n *linuxNetwork) updateIptablesRules(iptableRules []iptablesRule, ipt ipta
 	return nil
 }
 
+// builtinChains are the iptables chains the CNI shares with the other agents of the node
+var builtinChains = sets.NewString("PREROUTING", "FORWARD", "POSTROUTING")
+
+// iptablesInsertPosition returns where a missing rule goes in a built-in chain: after the rules of the CNI found from
+// the configured position on, so that the rules keep the order in which they are added, and at most at the end of the
+// chain
+func (n *linuxNetwork) iptablesInsertPosition(table, chain string, ipt iptableswrapper.IPTablesIface) (int, error) {
+	rules, err := ipt.List(table, chain)
+	if err != nil {
+		return 0, errors.Wrapf(err, "host network setup: failed to list iptables %s %s rules", table, chain)
+	}
+	pos, count := n.iptablesPosition, 0
+	for _, rule := range rules {
+		// Skip the policy of the chain
+		if !strings.HasPrefix(rule, "-A ") {
+			continue
+		}
+		count++
+		if count >= n.iptablesPosition && strings.Contains(rule, `--comment "AWS`) {
+			pos++
+		}
+	}
+	if pos > count+1 {
+		pos = count + 1
+	}
+	return pos, nil
+}
+
 func listCurrentIptablesRules(ipt iptableswrapper.IPTablesIface, table, chainPrefix string) ([]iptablesRule, error) {
 	var toClear []iptablesRule
 	log.Debugf("Setup Host Network: loading existing iptables %s rules with chain prefix %s", table, chainPrefix)
@@ -775,6 +864,10 @@ func computeStaleIptablesRules(ipt iptableswrapper.IPTablesIface, table, chainPr
 			log.Debugf("Setup Host Network: active chain found: %s", staleRule.chain)
 			continue
 		}
+		if isCarrierIPRule(staleRule.rule) {
+			log.Debugf("Setup Host Network: carrier IP rule found: %s", staleRule)
+			continue
+		}
 		keepRule := false
 		for _, newRule := range newRules {
 			if staleRule.chain == newRule.chain && reflect.DeepEqual(newRule.rule, staleRule.rule) {
@@ -844,14 +937,18 @@ func isRuleExistsError(err error) bool {
 // GetConfigForDebug returns the active values of the configuration env vars (for debugging purposes).
 func GetConfigForDebug() map[string]interface{} {
 	return map[string]interface{}{
-		envConnmark:             getConnmark(),
-		envExcludeSNATCIDRs:     parseCIDRString(envExcludeSNATCIDRs),
-		envExternalSNAT:         useExternalSNAT(),
-		envExternalServiceCIDRs: parseCIDRString(envExternalServiceCIDRs),
-		envMTU:                  GetEthernetMTU(),
-		envVethPrefix:           getVethPrefixName(),
-		envNodePortSupport:      nodePortSupportEnabled(),
-		envRandomizeSNAT:        typeOfSNAT(),
+		envConnmark:               getConnmark(),
+		envExcludeSNATCIDRs:       parseCIDRString(envExcludeSNATCIDRs),
+		envExternalSNAT:           useExternalSNAT(),
+		envExternalServiceCIDRs:   parseCIDRString(envExternalServiceCIDRs),
+		envMTU:                    GetEthernetMTU(),
+		envVethPrefix:             getVethPrefixName(),
+		envNodePortSupport:        nodePortSupportEnabled(),
+		envRandomizeSNAT:          typeOfSNAT(),
+		envHairpinSNAT:            hairpinSNATEnabled(),
+		envStrictRPFSupport:       strictRPFSupportEnabled(),
+		envGWLBApplianceMode:      gwlbApplianceModeEnabled(),
+		envPrimaryENIDeviceNumber: getPrimaryENIDeviceNumber(),
 	}
 }
 
@@ -880,7 +977,38 @@ func (n *linuxNetwork) GetExcludeSNATCIDRs() []string {
 	if useExternalSNAT() {
 		return nil
 	}
-	return parseCIDRString(envExcludeSNATCIDRs)
+	return mergeCIDRs(parseCIDRString(envExcludeSNATCIDRs), n.getRoutedExcludeSNATCIDRs())
+}
+
+// SetRoutedExcludeSNATCIDRs sets the CIDRs excluded from SNAT because the VPC routes them to private networks
+func (n *linuxNetwork) SetRoutedExcludeSNATCIDRs(cidrs []string) {
+	n.routedSNATLock.Lock()
+	defer n.routedSNATLock.Unlock()
+	n.routedExcludeSNATCIDRs = cidrs
+}
+
+func (n *linuxNetwork) getRoutedExcludeSNATCIDRs() []string {
+	n.routedSNATLock.RLock()
+	defer n.routedSNATLock.RUnlock()
+	return n.routedExcludeSNATCIDRs
+}
+
+// allExcludeSNATCIDRs returns the configured CIDRs excluded from SNAT followed by the learned ones
+func (n *linuxNetwork) allExcludeSNATCIDRs() []string {
+	return mergeCIDRs(n.excludeSNATCIDRs, n.getRoutedExcludeSNATCIDRs())
+}
+
+// mergeCIDRs appends the CIDRs of extra that are not already in cidrs
+func mergeCIDRs(cidrs []string, extra []string) []string {
+	existing := sets.NewString(cidrs...)
+	merged := append([]string(nil), cidrs...)
+	for _, cidr := range extra {
+		if !existing.Has(cidr) {
+			existing.Insert(cidr)
+			merged = append(merged, cidr)
+		}
+	}
+	return merged
 }
 
 // GetExternalServiceCIDRs return a list of CIDRs that should always be routed to via main routing table.
@@ -964,11 +1092,89 @@ func getConnmark() uint32 {
 	return defaultConnmark
 }
 
+func getPrimaryENIDeviceNumber() int {
+	deviceNumber, _, _ := utils.GetIntFromStringEnvVar(envPrimaryENIDeviceNumber, 0)
+	if deviceNumber < 0 {
+		return 0
+	}
+	return deviceNumber
+}
+
+// primaryENIRouteTable returns the route table of the primary ENI. When it is not at device number 0, it has a route
+// table of its own like the secondary ENIs, the main route table goes through the uplink of the host.
+func (n *linuxNetwork) primaryENIRouteTable(v6Enabled bool) int {
+	if n.primaryDeviceNumber == 0 || v6Enabled {
+		return mainRoutingTable
+	}
+	return n.primaryDeviceNumber + 1
+}
+
+func getIptablesPosition() int {
+	if value := os.Getenv(envIptablesPosition); value != "" {
+		pos, err := strconv.Atoi(value)
+		if err != nil || pos < 0 {
+			log.Errorf("Failed to parse %s %q; will append the iptables rules", envIptablesPosition, value)
+			return 0
+		}
+		return pos
+	}
+	return 0
+}
+
 // GetLinkByMac returns linux netlink based on interface MAC
 func (n *linuxNetwork) GetLinkByMac(mac string, retryInterval time.Duration) (netlink.Link, error) {
 	return linkByMac(mac, n.netLink, retryInterval)
 }
 
+// carrierIPComment marks the rules excluding the pods with a carrier IP from SNAT. They are added and removed pod by
+// pod, so the host network setup keeps them.
+const carrierIPComment = "AWS, carrier IP"
+
+// SetupCarrierIPRules excludes the non-VPC traffic of the pod from SNAT to the primary IP of the node, and from the
+// connmark that routes it through the primary ENI. The carrier gateway only translates the private IP associated with
+// the carrier IP, so the traffic has to leave through the ENI of the pod with the pod IP as source.
+func (n *linuxNetwork) SetupCarrierIPRules(podIP net.IP) error {
+	return n.updateCarrierIPRules(podIP, true)
+}
+
+// TeardownCarrierIPRules removes the rules added by SetupCarrierIPRules
+func (n *linuxNetwork) TeardownCarrierIPRules(podIP net.IP) error {
+	return n.updateCarrierIPRules(podIP, false)
+}
+
+func (n *linuxNetwork) updateCarrierIPRules(podIP net.IP, shouldExist bool) error {
+	// Without SNAT chains, the traffic of the pods already leaves through their ENI
+	if n.useExternalSNAT {
+		return nil
+	}
+	ipt, err := n.newIptables(iptables.ProtocolIPv4)
+	if err != nil {
+		return errors.Wrap(err, "carrier IP rules: failed to create iptables")
+	}
+	rule := []string{"-s", podIP.String() + "/32", "-m", "comment", "--comment", carrierIPComment, "-j", "RETURN"}
+	var iptableRules []iptablesRule
+	// Named after their chain, so that they are inserted before the SNAT and connmark rules
+	for _, chain := range []string{"AWS-SNAT-CHAIN-0", "AWS-CONNMARK-CHAIN-0"} {
+		iptableRules = append(iptableRules, iptablesRule{
+			name:        chain,
+			shouldExist: shouldExist,
+			table:       "nat",
+			chain:       chain,
+			rule:        rule,
+		})
+	}
+	return n.updateIptablesRules(iptableRules, ipt)
+}
+
+func isCarrierIPRule(rule []string) bool {
+	for _, arg := range rule {
+		if arg == carrierIPComment {
+			return true
+		}
+	}
+	return false
+}
+
 // linkByMac returns linux netlink based on interface MAC
 func linkByMac(mac string, netLink netlinkwrapper.NetLink, retryInterval time.Duration) (netlink.Link, error) {
 	// The adapter might not be immediately available, so we perform retries
@@ -997,7 +1203,7 @@ func linkByMac(mac string, netLink netlinkwrapper.NetLink, retryInterval time.Du
 			}
 		}
 
-		lastErr = errors.Errorf("no interface found which uses mac address %s (attempt %d/%d)", mac, attempt, maxAttemptsLinkByMac)
+		lastErr = fmt.Errorf("%w %s (attempt %d/%d)", ErrLinkNotFound, mac, attempt, maxAttemptsLinkByMac)
 		log.Debugf(lastErr.Error())
 	}
 }
@@ -1015,8 +1221,13 @@ func GetIPv4Gateway(eniSubnetCIDR *net.IPNet) net.IP {
 }
 
 // SetupENINetwork adds default route to route table (eni-<eni_table>), so it does not need to be called on the primary ENI
+// at device number 0
 func (n *linuxNetwork) SetupENINetwork(eniIP string, eniMAC string, deviceNumber int, eniSubnetCIDR string) error {
-	return setupENINetwork(eniIP, eniMAC, deviceNumber, eniSubnetCIDR, n.netLink, retryLinkByMacInterval, retryRouteAddInterval, n.mtu)
+	err := setupENINetwork(eniIP, eniMAC, deviceNumber, eniSubnetCIDR, n.netLink, retryLinkByMacInterval, retryRouteAddInterval, n.mtu)
+	if err != nil {
+		return err
+	}
+	return n.setupApplianceENIRules(eniIP, eniMAC, deviceNumber)
 }
 
 func setupENINetwork(eniIP string, eniMAC string, deviceNumber int, eniSubnetCIDR string, netLink netlinkwrapper.NetLink,
@@ -1295,6 +1506,9 @@ func (n *linuxNetwork) UpdateExternalServiceIpRules(ruleList []netlink.Rule, ext
 // GetEthernetMTU returns the MTU value to program for ENIs. Note that the value was already validated during container initialization.
 func GetEthernetMTU() int {
 	mtu, _, _ := utils.GetIntFromStringEnvVar(envMTU, defaultMTU)
+	if mtu > GWLBMaxMTU && gwlbApplianceModeEnabled() {
+		return GWLBMaxMTU
+	}
 	return mtu
 }
 
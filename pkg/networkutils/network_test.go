@@ -503,6 +503,89 @@ func TestSetupHostNetworkWithExcludeSNATCIDRs(t *testing.T) {
 		}, mockIptables.(*mock_iptables.MockIptables).DataplaneState)
 }
 
+func TestSetupHostNetworkPrimaryENIDeviceNumber(t *testing.T) {
+	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
+	defer ctrl.Finish()
+
+	ln := &linuxNetwork{
+		primaryDeviceNumber: 2,
+		mainENIMark:         defaultConnmark,
+		mtu:                 testMTU,
+		vethPrefix:          eniPrefix,
+
+		netLink: mockNetLink,
+		ns:      mockNS,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	mockPrimaryInterfaceLookup(ctrl, mockNetLink)
+	mockNetLink.EXPECT().LinkSetMTU(gomock.Any(), testMTU).Return(nil)
+	var mainENIRule netlink.Rule
+	mockNetLink.EXPECT().NewRule().Return(&mainENIRule)
+	mockNetLink.EXPECT().RuleDel(&mainENIRule)
+	mockNetLink.EXPECT().RuleAdd(&mainENIRule)
+
+	// The traffic marked for the primary ENI goes through its route table, the main one goes through the host uplink
+	err := ln.SetupHostNetwork([]string{"10.10.0.0/16"}, loopback, &testEniIPNet, false, true, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, mainENIRule.Table)
+	assert.Equal(t, int(defaultConnmark), mainENIRule.Mark)
+
+	assert.Equal(t, mainRoutingTable, ln.primaryENIRouteTable(true))
+	ln.primaryDeviceNumber = 0
+	assert.Equal(t, mainRoutingTable, ln.primaryENIRouteTable(false))
+}
+
+func TestUpdateHostIptablesRulesWithRoutedExcludeSNATCIDRs(t *testing.T) {
+	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
+	defer ctrl.Finish()
+	t.Setenv(envExcludeSNATCIDRs, "10.12.0.0/16")
+
+	ln := &linuxNetwork{
+		excludeSNATCIDRs: []string{"10.12.0.0/16"},
+		mainENIMark:      defaultConnmark,
+		mtu:              testMTU,
+		vethPrefix:       eniPrefix,
+
+		netLink: mockNetLink,
+		ns:      mockNS,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	setupNetLinkMocks(ctrl, mockNetLink)
+
+	// The learned CIDRs already configured are not duplicated
+	ln.SetRoutedExcludeSNATCIDRs([]string{"10.12.0.0/16", "192.168.0.0/16"})
+	assert.Equal(t, []string{"10.12.0.0/16", "192.168.0.0/16"}, ln.GetExcludeSNATCIDRs())
+
+	vpcCIDRs := []string{"10.10.0.0/16"}
+	err := ln.SetupHostNetwork(vpcCIDRs, loopback, &testEniIPNet, false, true, false)
+	assert.NoError(t, err)
+	nat := mockIptables.(*mock_iptables.MockIptables).DataplaneState["nat"]
+	assert.Equal(t, [][]string{
+		{"-N", "AWS-SNAT-CHAIN-0"},
+		{"-d", "192.168.0.0/16", "-m", "comment", "--comment", "AWS SNAT CHAIN EXCLUSION", "-j", "RETURN"},
+		{"-d", "10.12.0.0/16", "-m", "comment", "--comment", "AWS SNAT CHAIN EXCLUSION", "-j", "RETURN"},
+		{"-d", "10.10.0.0/16", "-m", "comment", "--comment", "AWS SNAT CHAIN", "-j", "RETURN"},
+		{"!", "-o", "vlan+", "-m", "comment", "--comment", "AWS, SNAT", "-m", "addrtype", "!", "--dst-type", "LOCAL", "-j", "SNAT", "--to-source", "10.10.10.20"},
+	}, nat["AWS-SNAT-CHAIN-0"])
+	assert.Contains(t, nat["AWS-CONNMARK-CHAIN-0"],
+		[]string{"-d", "192.168.0.0/16", "-m", "comment", "--comment", "AWS CONNMARK CHAIN, EXCLUDED CIDR", "-j", "RETURN"})
+
+	// The routes that are gone are SNATed again
+	ln.SetRoutedExcludeSNATCIDRs(nil)
+	err = ln.UpdateHostIptablesRules(vpcCIDRs, loopback, &testEniIPNet, true, false)
+	assert.NoError(t, err)
+	nat = mockIptables.(*mock_iptables.MockIptables).DataplaneState["nat"]
+	assert.NotContains(t, nat["AWS-SNAT-CHAIN-0"],
+		[]string{"-d", "192.168.0.0/16", "-m", "comment", "--comment", "AWS SNAT CHAIN EXCLUSION", "-j", "RETURN"})
+	assert.NotContains(t, nat["AWS-CONNMARK-CHAIN-0"],
+		[]string{"-d", "192.168.0.0/16", "-m", "comment", "--comment", "AWS CONNMARK CHAIN, EXCLUDED CIDR", "-j", "RETURN"})
+	assert.Equal(t, []string{"10.12.0.0/16"}, ln.GetExcludeSNATCIDRs())
+}
+
 func TestSetupHostNetworkCleansUpStaleSNATRules(t *testing.T) {
 	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
 	defer ctrl.Finish()
@@ -579,6 +662,54 @@ func TestSetupHostNetworkCleansUpStaleSNATRules(t *testing.T) {
 		}, mockIptables.(*mock_iptables.MockIptables).DataplaneState)
 }
 
+func TestCarrierIPRules(t *testing.T) {
+	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
+	defer ctrl.Finish()
+
+	ln := &linuxNetwork{
+		useExternalSNAT: false,
+		mainENIMark:     defaultConnmark,
+		mtu:             testMTU,
+		vethPrefix:      eniPrefix,
+
+		netLink: mockNetLink,
+		ns:      mockNS,
+		newIptables: func(iptables.Protocol) (iptableswrapper.IPTablesIface, error) {
+			return mockIptables, nil
+		},
+	}
+	setupNetLinkMocks(ctrl, mockNetLink)
+
+	vpcCIDRs := []string{"10.10.0.0/16"}
+	err := ln.SetupHostNetwork(vpcCIDRs, loopback, &testEniIPNet, false, true, false)
+	assert.NoError(t, err)
+	err = ln.SetupCarrierIPRules(net.ParseIP("10.10.0.5"))
+	assert.NoError(t, err)
+	// The updates of the host rules keep the rules of the pods
+	err = ln.UpdateHostIptablesRules(vpcCIDRs, loopback, &testEniIPNet, true, false)
+	assert.NoError(t, err)
+
+	carrierIPRule := []string{"-s", "10.10.0.5/32", "-m", "comment", "--comment", "AWS, carrier IP", "-j", "RETURN"}
+	state := mockIptables.(*mock_iptables.MockIptables).DataplaneState
+	assert.Equal(t, [][]string{
+		{"-N", "AWS-SNAT-CHAIN-0"},
+		carrierIPRule,
+		{"-d", "10.10.0.0/16", "-m", "comment", "--comment", "AWS SNAT CHAIN", "-j", "RETURN"},
+		{"!", "-o", "vlan+", "-m", "comment", "--comment", "AWS, SNAT", "-m", "addrtype", "!", "--dst-type", "LOCAL", "-j", "SNAT", "--to-source", "10.10.10.20"},
+	}, state["nat"]["AWS-SNAT-CHAIN-0"])
+	assert.Equal(t, [][]string{
+		{"-N", "AWS-CONNMARK-CHAIN-0"},
+		carrierIPRule,
+		{"-d", "10.10.0.0/16", "-m", "comment", "--comment", "AWS CONNMARK CHAIN, VPC CIDR", "-j", "RETURN"},
+		{"-m", "comment", "--comment", "AWS, CONNMARK", "-j", "CONNMARK", "--set-xmark", "0x80/0x80"},
+	}, state["nat"]["AWS-CONNMARK-CHAIN-0"])
+
+	err = ln.TeardownCarrierIPRules(net.ParseIP("10.10.0.5"))
+	assert.NoError(t, err)
+	assert.NotContains(t, state["nat"]["AWS-SNAT-CHAIN-0"], carrierIPRule)
+	assert.NotContains(t, state["nat"]["AWS-CONNMARK-CHAIN-0"], carrierIPRule)
+}
+
 func TestSetupHostNetworkWithDifferentVethPrefix(t *testing.T) {
 	ctrl, mockNetLink, _, mockNS, mockIptables := setup(t)
 	defer ctrl.Finish()
@@ -0,0 +1,106 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/pkg/errors"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/netlinkwrapper"
+)
+
+const (
+	// envPodRouteTables is the name of the environment variable that gives each IPv4 pod its own route table and rule
+	// instead of the route table shared by the pods of its ENI, at the cost of a rule per pod on the primary ENI too.
+	// Defaults to false.
+	envPodRouteTables = "ENABLE_POD_ROUTE_TABLES"
+)
+
+// PodRouteTablesEnabled returns whether each IPv4 pod gets its own route table
+func PodRouteTablesEnabled() bool {
+	return getBoolEnvVar(envPodRouteTables, false)
+}
+
+// PodRouteTable returns the route table of a pod in the per-pod route table mode. It is the IPv4 address of the pod,
+// so that it can be found again from the address alone, and VPC addresses are far above the tables of the ENIs and
+// the VLANs.
+func PodRouteTable(podIP net.IP) int {
+	return int(binary.BigEndian.Uint32(podIP.To4()))
+}
+
+// SetupPodRouteTable copies the default routes of the route table of an ENI, with the routes to their gateways, to the
+// route table of a pod
+func SetupPodRouteTable(netLink netlinkwrapper.NetLink, eniTable int, podTable int) error {
+	routes, err := netLink.RouteListFiltered(unix.AF_INET, &netlink.Route{Table: eniTable}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list the routes of table %d", eniTable)
+	}
+	found := false
+	for _, route := range routes {
+		if !isDefaultRoute(route) || route.Gw == nil {
+			continue
+		}
+		found = true
+		podRoutes := []netlink.Route{
+			{
+				LinkIndex: route.LinkIndex,
+				Dst:       &net.IPNet{IP: route.Gw, Mask: net.CIDRMask(32, 32)},
+				Scope:     netlink.SCOPE_LINK,
+				Table:     podTable,
+			},
+			{
+				LinkIndex: route.LinkIndex,
+				Dst:       &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+				Gw:        route.Gw,
+				Scope:     netlink.SCOPE_UNIVERSE,
+				Table:     podTable,
+			},
+		}
+		for i := range podRoutes {
+			if err := netLink.RouteReplace(&podRoutes[i]); err != nil {
+				return errors.Wrapf(err, "failed to add route %s to table %d", podRoutes[i].Dst, podTable)
+			}
+		}
+	}
+	if !found {
+		return errors.Errorf("no default route in table %d", eniTable)
+	}
+	return nil
+}
+
+// TeardownPodRouteTable removes the routes of the route table of a pod
+func TeardownPodRouteTable(netLink netlinkwrapper.NetLink, podTable int) error {
+	routes, err := netLink.RouteListFiltered(unix.AF_INET, &netlink.Route{Table: podTable}, netlink.RT_FILTER_TABLE)
+	if err != nil {
+		return errors.Wrapf(err, "failed to list the routes of table %d", podTable)
+	}
+	for i := range routes {
+		if err := netLink.RouteDel(&routes[i]); err != nil && !netlinkwrapper.IsNotExistsError(err) {
+			return errors.Wrapf(err, "failed to delete a route of table %d", podTable)
+		}
+	}
+	return nil
+}
+
+func isDefaultRoute(route netlink.Route) bool {
+	if route.Dst == nil {
+		return true
+	}
+	ones, _ := route.Dst.Mask.Size()
+	return ones == 0
+}
@@ -0,0 +1,74 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+func TestPodRouteTable(t *testing.T) {
+	assert.Equal(t, 0x0a0a0a15, PodRouteTable(net.ParseIP("10.10.10.21")))
+}
+
+func TestSetupPodRouteTable(t *testing.T) {
+	ctrl, mockNetLink, _, _, _ := setup(t)
+	defer ctrl.Finish()
+
+	podTable := PodRouteTable(net.ParseIP("10.10.10.21"))
+	gw := net.ParseIP("10.10.0.1")
+	mockNetLink.EXPECT().RouteListFiltered(unix.AF_INET, &netlink.Route{Table: testTable}, netlink.RT_FILTER_TABLE).Return([]netlink.Route{
+		{LinkIndex: 3, Dst: &net.IPNet{IP: gw, Mask: net.CIDRMask(32, 32)}, Scope: netlink.SCOPE_LINK, Table: testTable},
+		{LinkIndex: 3, Gw: gw, Table: testTable},
+	}, nil)
+	mockNetLink.EXPECT().RouteReplace(&netlink.Route{
+		LinkIndex: 3,
+		Dst:       &net.IPNet{IP: gw, Mask: net.CIDRMask(32, 32)},
+		Scope:     netlink.SCOPE_LINK,
+		Table:     podTable,
+	}).Return(nil)
+	mockNetLink.EXPECT().RouteReplace(&netlink.Route{
+		LinkIndex: 3,
+		Dst:       &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)},
+		Gw:        gw,
+		Scope:     netlink.SCOPE_UNIVERSE,
+		Table:     podTable,
+	}).Return(nil)
+	assert.NoError(t, SetupPodRouteTable(mockNetLink, testTable, podTable))
+
+	// The table of the ENI was flushed
+	mockNetLink.EXPECT().RouteListFiltered(unix.AF_INET, gomock.Any(), netlink.RT_FILTER_TABLE).Return(nil, nil)
+	assert.EqualError(t, SetupPodRouteTable(mockNetLink, testTable, podTable), "no default route in table 10")
+}
+
+func TestTeardownPodRouteTable(t *testing.T) {
+	ctrl, mockNetLink, _, _, _ := setup(t)
+	defer ctrl.Finish()
+
+	podTable := PodRouteTable(net.ParseIP("10.10.10.21"))
+	routes := []netlink.Route{
+		{LinkIndex: 3, Dst: &net.IPNet{IP: net.ParseIP("10.10.0.1"), Mask: net.CIDRMask(32, 32)}, Table: podTable},
+		{LinkIndex: 3, Gw: net.ParseIP("10.10.0.1"), Table: podTable},
+	}
+	mockNetLink.EXPECT().RouteListFiltered(unix.AF_INET, &netlink.Route{Table: podTable}, netlink.RT_FILTER_TABLE).Return(routes, nil)
+	mockNetLink.EXPECT().RouteDel(&routes[0]).Return(nil)
+	mockNetLink.EXPECT().RouteDel(&routes[1]).Return(errors.New("operation not permitted"))
+	assert.Error(t, TeardownPodRouteTable(mockNetLink, podTable))
+}
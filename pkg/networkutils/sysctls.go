@@ -0,0 +1,39 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
+)
+
+// ReconcileSysctls sets the default sysctls of the node, replaced by the settings of the policy, and returns the
+// conflicts with the configuration of the host
+func (n *linuxNetwork) ReconcileSysctls(primaryMAC string, v6Enabled bool, policy []sysctlpolicy.Setting) ([]sysctlpolicy.Conflict, error) {
+	primaryIntf, err := findPrimaryInterfaceName(primaryMAC)
+	if err != nil {
+		return nil, errors.Wrap(err, "sysctls: failed to find the primary interface")
+	}
+	return n.sysctls.Apply(primaryIntf, sysctlpolicy.Merge(n.defaultSysctls(v6Enabled), policy)), nil
+}
+
+func (n *linuxNetwork) defaultSysctls(v6Enabled bool) []sysctlpolicy.Setting {
+	return sysctlpolicy.Defaults(sysctlpolicy.Options{
+		IPv6Enabled:       v6Enabled,
+		IPv6EgressEnabled: n.ipv6EgressEnabled,
+		// The connmark restore rule of the strict reverse path filtering support is IPv4 only
+		StrictRPFSupport: !v6Enabled && n.strictRPFSupport && n.nodePortSupportEnabled,
+	})
+}
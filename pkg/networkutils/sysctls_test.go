@@ -0,0 +1,53 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package networkutils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	mock_procsyswrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper/mocks"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/sysctlpolicy"
+)
+
+func TestReconcileSysctls(t *testing.T) {
+	ctrl, _, _, _, _ := setup(t)
+	defer ctrl.Finish()
+	mockProcSys := mock_procsyswrapper.NewMockProcSys(ctrl)
+
+	ln := &linuxNetwork{
+		nodePortSupportEnabled: true,
+		strictRPFSupport:       true,
+		sysctls:                sysctlpolicy.NewEngine(mockProcSys),
+	}
+
+	// With strict reverse path filtering support, rp_filter of the primary ENI is left to the host
+	mockProcSys.EXPECT().Get("net/ipv4/conf/lo/src_valid_mark").Return("0\n", nil)
+	mockProcSys.EXPECT().Set("net/ipv4/conf/lo/src_valid_mark", "1").Return(nil)
+	mockProcSys.EXPECT().Get("net/ipv4/conf/eth1/rp_filter").Return("1\n", nil)
+	mockProcSys.EXPECT().Set("net/ipv4/conf/eth1/rp_filter", "2").Return(nil)
+	mockProcSys.EXPECT().Get("net/ipv4/conf/all/rp_filter").Return("0\n", nil)
+	conflicts, err := ln.ReconcileSysctls(loopback, false, []sysctlpolicy.Setting{{Interface: "eth1", Key: "ipv4/rp_filter", Value: "2"}})
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+
+	// The policy replaces the defaults
+	ln.strictRPFSupport = false
+	mockProcSys.EXPECT().Get("net/ipv4/conf/lo/rp_filter").Return("1\n", nil)
+	mockProcSys.EXPECT().Get("net/ipv4/conf/all/rp_filter").Return("0\n", nil)
+	conflicts, err = ln.ReconcileSysctls(loopback, false, []sysctlpolicy.Setting{{Interface: sysctlpolicy.PrimaryInterface, Key: "ipv4/rp_filter", Value: "1"}})
+	assert.NoError(t, err)
+	assert.Empty(t, conflicts)
+}
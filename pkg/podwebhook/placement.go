@@ -0,0 +1,112 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package podwebhook
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/eniconfig"
+)
+
+const (
+	// ENIConfigAnnotation requires the pod on the nodes using one of the comma separated ENIConfigs
+	ENIConfigAnnotation = "vpc.amazonaws.com/eni-config"
+	// SubnetAnnotation requires the pod on the nodes using an ENIConfig with one of the comma separated subnets
+	SubnetAnnotation = "vpc.amazonaws.com/subnet"
+)
+
+// addPlacementHints adds the nodes using the ENIConfigs required by the annotations of the pod to its node affinity.
+// When no ENIConfig meets the requirements, the pod is left alone and the returned warning says why.
+func (m *Mutator) addPlacementHints(ctx context.Context, pod *corev1.Pod) (string, error) {
+	eniConfigs, hasENIConfigs := annotationValues(pod, ENIConfigAnnotation)
+	subnets, hasSubnets := annotationValues(pod, SubnetAnnotation)
+	if !hasENIConfigs && !hasSubnets {
+		return "", nil
+	}
+
+	names := eniConfigs
+	if hasSubnets {
+		var list v1alpha1.ENIConfigList
+		if err := m.Client.List(ctx, &list); err != nil {
+			return "", errors.Wrap(err, "failed to list the ENIConfigs")
+		}
+		inSubnets := sets.New[string]()
+		for _, eniConfig := range list.Items {
+			if subnets.Has(eniConfig.Spec.Subnet) {
+				inSubnets.Insert(eniConfig.Name)
+			}
+		}
+		names = inSubnets
+		if hasENIConfigs {
+			names = eniConfigs.Intersection(inSubnets)
+		}
+	}
+	if names.Len() == 0 {
+		return fmt.Sprintf("no ENIConfig meets the %s and %s annotations, the pod has no placement hint",
+			ENIConfigAnnotation, SubnetAnnotation), nil
+	}
+
+	sorted := names.UnsortedList()
+	sort.Strings(sorted)
+	requireNodes(pod, eniconfig.NodeSelectorTerms(sorted))
+	return "", nil
+}
+
+// annotationValues returns the comma separated values of the annotation, and whether it is set
+func annotationValues(pod *corev1.Pod, annotation string) (sets.Set[string], bool) {
+	value, ok := pod.Annotations[annotation]
+	if !ok {
+		return nil, false
+	}
+	values := sets.New[string]()
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values.Insert(v)
+		}
+	}
+	return values, true
+}
+
+// requireNodes adds the terms to the required node affinity of the pod. The terms of a node selector are ORed, so each
+// existing term is combined with each new one to keep the requirements of both.
+func requireNodes(pod *corev1.Pod, terms []corev1.NodeSelectorTerm) {
+	if pod.Spec.Affinity == nil {
+		pod.Spec.Affinity = &corev1.Affinity{}
+	}
+	if pod.Spec.Affinity.NodeAffinity == nil {
+		pod.Spec.Affinity.NodeAffinity = &corev1.NodeAffinity{}
+	}
+	required := pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution
+	if required == nil || len(required.NodeSelectorTerms) == 0 {
+		pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution = &corev1.NodeSelector{NodeSelectorTerms: terms}
+		return
+	}
+
+	var combined []corev1.NodeSelectorTerm
+	for _, existing := range required.NodeSelectorTerms {
+		for _, term := range terms {
+			expressions := append(append([]corev1.NodeSelectorRequirement{}, existing.MatchExpressions...), term.MatchExpressions...)
+			combined = append(combined, corev1.NodeSelectorTerm{MatchExpressions: expressions, MatchFields: existing.MatchFields})
+		}
+	}
+	required.NodeSelectorTerms = combined
+}
@@ -0,0 +1,102 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package podwebhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/eniconfig"
+)
+
+func testENIConfig(name, subnet string) *v1alpha1.ENIConfig {
+	return &v1alpha1.ENIConfig{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: v1alpha1.ENIConfigSpec{Subnet: subnet}}
+}
+
+func TestAddPlacementHints(t *testing.T) {
+	m := setup(t,
+		testENIConfig("us-west-2a", "subnet-a"),
+		testENIConfig("us-west-2b", "subnet-b"),
+		testENIConfig("us-west-2b-large", "subnet-b"),
+	)
+	ctx := context.Background()
+
+	annotated := func(annotations map[string]string) *corev1.Pod {
+		pod := testPod()
+		pod.Annotations = annotations
+		return pod
+	}
+	required := func(pod *corev1.Pod) []corev1.NodeSelectorTerm {
+		return pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms
+	}
+
+	pod := testPod()
+	warning, err := m.addPlacementHints(ctx, pod)
+	require.NoError(t, err)
+	assert.Empty(t, warning)
+	assert.Nil(t, pod.Spec.Affinity)
+
+	pod = annotated(map[string]string{ENIConfigAnnotation: "us-west-2a"})
+	_, err = m.addPlacementHints(ctx, pod)
+	require.NoError(t, err)
+	assert.Equal(t, eniconfig.NodeSelectorTerms([]string{"us-west-2a"}), required(pod))
+
+	pod = annotated(map[string]string{SubnetAnnotation: "subnet-b"})
+	_, err = m.addPlacementHints(ctx, pod)
+	require.NoError(t, err)
+	assert.Equal(t, eniconfig.NodeSelectorTerms([]string{"us-west-2b", "us-west-2b-large"}), required(pod))
+
+	// Both annotations must be met
+	pod = annotated(map[string]string{ENIConfigAnnotation: "us-west-2a, us-west-2b", SubnetAnnotation: "subnet-b"})
+	_, err = m.addPlacementHints(ctx, pod)
+	require.NoError(t, err)
+	assert.Equal(t, eniconfig.NodeSelectorTerms([]string{"us-west-2b"}), required(pod))
+
+	pod = annotated(map[string]string{ENIConfigAnnotation: "us-west-2a", SubnetAnnotation: "subnet-b"})
+	warning, err = m.addPlacementHints(ctx, pod)
+	require.NoError(t, err)
+	assert.Contains(t, warning, "no ENIConfig meets")
+	assert.Nil(t, pod.Spec.Affinity)
+}
+
+func TestRequireNodes(t *testing.T) {
+	arm := corev1.NodeSelectorRequirement{Key: "kubernetes.io/arch", Operator: corev1.NodeSelectorOpIn, Values: []string{"arm64"}}
+	spot := corev1.NodeSelectorRequirement{Key: "capacity-type", Operator: corev1.NodeSelectorOpIn, Values: []string{"spot"}}
+	zoneA := corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"a"}}
+	zoneB := corev1.NodeSelectorRequirement{Key: "zone", Operator: corev1.NodeSelectorOpIn, Values: []string{"b"}}
+
+	pod := testPod()
+	pod.Spec.Affinity = &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: []corev1.NodeSelectorTerm{
+			{MatchExpressions: []corev1.NodeSelectorRequirement{arm}},
+			{MatchExpressions: []corev1.NodeSelectorRequirement{spot}},
+		}},
+	}}
+	requireNodes(pod, []corev1.NodeSelectorTerm{
+		{MatchExpressions: []corev1.NodeSelectorRequirement{zoneA}},
+		{MatchExpressions: []corev1.NodeSelectorRequirement{zoneB}},
+	})
+	assert.Equal(t, []corev1.NodeSelectorTerm{
+		{MatchExpressions: []corev1.NodeSelectorRequirement{arm, zoneA}},
+		{MatchExpressions: []corev1.NodeSelectorRequirement{arm, zoneB}},
+		{MatchExpressions: []corev1.NodeSelectorRequirement{spot, zoneA}},
+		{MatchExpressions: []corev1.NodeSelectorRequirement{spot, zoneB}},
+	}, pod.Spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms)
+}
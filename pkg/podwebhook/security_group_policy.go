@@ -0,0 +1,97 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package podwebhook
+
+import (
+	"context"
+
+	"github.com/aws/amazon-vpc-resource-controller-k8s/apis/vpcresources/v1beta1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// defaultServiceAccount is the service account of the pods that do not set one
+const defaultServiceAccount = "default"
+
+// matchesSecurityGroupPolicy returns whether a SecurityGroupPolicy of the namespace selects the pod, so that it gets a
+// branch ENI. As in the VPC resource controller, a policy with both selectors needs both to match.
+func (m *Mutator) matchesSecurityGroupPolicy(ctx context.Context, namespace string, pod *corev1.Pod) (bool, error) {
+	var policies v1beta1.SecurityGroupPolicyList
+	if err := m.Client.List(ctx, &policies, client.InNamespace(namespace)); err != nil {
+		return false, errors.Wrap(err, "failed to list the SecurityGroupPolicies")
+	}
+	if len(policies.Items) == 0 {
+		return false, nil
+	}
+
+	// The labels of the service account are only read when a policy selects service accounts
+	var saLabels labels.Set
+	for _, policy := range policies.Items {
+		podSelector, saSelector := policy.Spec.PodSelector, policy.Spec.ServiceAccountSelector
+		if podSelector == nil && saSelector == nil {
+			continue
+		}
+		if podSelector != nil {
+			matched, err := selectorMatches(podSelector, labels.Set(pod.Labels))
+			if err != nil || !matched {
+				continue
+			}
+		}
+		if saSelector != nil {
+			if saLabels == nil {
+				var err error
+				if saLabels, err = m.serviceAccountLabels(ctx, namespace, pod.Spec.ServiceAccountName); err != nil {
+					return false, err
+				}
+			}
+			matched, err := selectorMatches(saSelector, saLabels)
+			if err != nil || !matched {
+				continue
+			}
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// serviceAccountLabels returns the labels of the service account of the pod, empty when it does not exist yet
+func (m *Mutator) serviceAccountLabels(ctx context.Context, namespace, name string) (labels.Set, error) {
+	if name == "" {
+		name = defaultServiceAccount
+	}
+	var sa corev1.ServiceAccount
+	err := m.Client.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, &sa)
+	if apierrors.IsNotFound(err) {
+		return labels.Set{}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get service account %s/%s", namespace, name)
+	}
+	return labels.Set(sa.Labels), nil
+}
+
+// selectorMatches returns whether the selector of a policy matches the labels. An empty selector matches everything.
+func selectorMatches(selector *metav1.LabelSelector, set labels.Set) (bool, error) {
+	s, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		log.Warnf("Ignoring invalid selector of a SecurityGroupPolicy: %v", err)
+		return false, err
+	}
+	return s.Matches(set), nil
+}
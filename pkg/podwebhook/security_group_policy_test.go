@@ -0,0 +1,72 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package podwebhook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/amazon-vpc-resource-controller-k8s/apis/vpcresources/v1beta1"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPolicy(name string, podLabels, saLabels map[string]string) *v1beta1.SecurityGroupPolicy {
+	policy := &v1beta1.SecurityGroupPolicy{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		Spec:       v1beta1.SecurityGroupPolicySpec{SecurityGroups: v1beta1.GroupIds{Groups: []string{"sg-0123456789abcdef0"}}},
+	}
+	if podLabels != nil {
+		policy.Spec.PodSelector = &metav1.LabelSelector{MatchLabels: podLabels}
+	}
+	if saLabels != nil {
+		policy.Spec.ServiceAccountSelector = &metav1.LabelSelector{MatchLabels: saLabels}
+	}
+	return policy
+}
+
+func TestInjectPodENIResource(t *testing.T) {
+	m := setup(t,
+		testPolicy("by-pod", map[string]string{"app": "db"}, nil),
+		testPolicy("by-both", map[string]string{"app": "web"}, map[string]string{"tier": "frontend"}),
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "frontend", Labels: map[string]string{"tier": "frontend"}}},
+	)
+	m.InjectPodENIResource = true
+
+	podWithLabels := func(app, serviceAccount string) *corev1.Pod {
+		pod := testPod()
+		pod.Labels = map[string]string{"app": app}
+		pod.Spec.ServiceAccountName = serviceAccount
+		return pod
+	}
+	injected := func(pod *corev1.Pod) corev1.ResourceName {
+		resp := m.Handle(context.Background(), request(t, pod))
+		assert.True(t, resp.Allowed)
+		if assert.Len(t, resp.Patches, 2) {
+			for name := range resp.Patches[0].Value.(map[string]interface{}) {
+				return corev1.ResourceName(name)
+			}
+		}
+		return ""
+	}
+
+	// The pods with a branch ENI do not need an IP from ipamd
+	assert.Equal(t, PodENIResource, injected(podWithLabels("db", "")))
+	assert.Equal(t, PodENIResource, injected(podWithLabels("web", "frontend")))
+	// Both selectors of the policy must match
+	assert.Equal(t, PodIPResource, injected(podWithLabels("web", "")))
+	assert.Equal(t, PodIPResource, injected(podWithLabels("web", "missing")))
+	assert.Equal(t, PodIPResource, injected(podWithLabels("cache", "frontend")))
+}
@@ -0,0 +1,159 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package podwebhook mutates the pods on creation, before the scheduler places them
+package podwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+)
+
+const (
+	// Path is where the webhook server serves the mutation of the pods
+	Path = "/mutate-v1-pod"
+
+	// PodIPResource is the extended resource ipamd advertises on the node, counting the pods it can give an IP to
+	PodIPResource corev1.ResourceName = "vpc.amazonaws.com/pod-ip"
+	// PodENIResource is the extended resource of the branch ENIs, advertised by the VPC resource controller on the
+	// nodes with a trunk ENI
+	PodENIResource corev1.ResourceName = "vpc.amazonaws.com/pod-eni"
+
+	// fargateScheduler places the pods on Fargate, which does not run ipamd
+	fargateScheduler = "fargate-scheduler"
+	// osLabel selects the Windows nodes, which do not run ipamd
+	osLabel = "kubernetes.io/os"
+)
+
+var log = logger.GetComponent("podwebhook")
+
+// Mutator is the mutating admission webhook of the pods
+type Mutator struct {
+	Decoder *admission.Decoder
+	// Client reads the SecurityGroupPolicies, service accounts and ENIConfigs
+	Client client.Reader
+	// InjectPodIPResource requests one PodIPResource for every pod that needs an IP from ipamd, so that the scheduler
+	// only binds it to the nodes with IPs left
+	InjectPodIPResource bool
+	// InjectPodENIResource requests one PodENIResource for the pods matched by a SecurityGroupPolicy, as the webhook of
+	// the VPC resource controller does, for the pods created before it is available
+	InjectPodENIResource bool
+	// PlacementHints requires the pods with the ENIConfigAnnotation or SubnetAnnotation on the nodes using the
+	// ENIConfigs they name
+	PlacementHints bool
+}
+
+// Handle returns the patch of the pod of the request
+func (m *Mutator) Handle(ctx context.Context, req admission.Request) admission.Response {
+	pod := &corev1.Pod{}
+	if err := m.Decoder.Decode(req, pod); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	mutated := pod.DeepCopy()
+	var warnings []string
+	if needsPodIP(mutated) {
+		if m.InjectPodENIResource {
+			matched, err := m.matchesSecurityGroupPolicy(ctx, req.Namespace, mutated)
+			if err != nil {
+				// Let the webhook of the VPC resource controller decide
+				log.Warnf("Failed to match pod %s/%s against the SecurityGroupPolicies: %v", req.Namespace, podName(pod), err)
+			} else if matched {
+				injectResource(mutated, PodENIResource)
+			}
+		}
+		// The pods with a branch ENI get their IP from it rather than from ipamd
+		if m.InjectPodIPResource && !requestsResource(mutated, PodENIResource) {
+			injectResource(mutated, PodIPResource)
+		}
+		if m.PlacementHints {
+			warning, err := m.addPlacementHints(ctx, mutated)
+			if err != nil {
+				return admission.Errored(http.StatusInternalServerError, err)
+			}
+			if warning != "" {
+				warnings = append(warnings, warning)
+			}
+		}
+	}
+	if equality.Semantic.DeepEqual(pod, mutated) {
+		return admission.Allowed("").WithWarnings(warnings...)
+	}
+
+	marshaled, err := json.Marshal(mutated)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	log.Debugf("Mutating pod %s/%s", req.Namespace, podName(pod))
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled).WithWarnings(warnings...)
+}
+
+// needsPodIP returns whether the pod gets its IP from ipamd, as far as can be told before it is scheduled
+func needsPodIP(pod *corev1.Pod) bool {
+	if pod.Spec.HostNetwork || pod.Spec.SchedulerName == fargateScheduler {
+		return false
+	}
+	if pod.Spec.OS != nil && pod.Spec.OS.Name == corev1.Windows {
+		return false
+	}
+	return pod.Spec.NodeSelector[osLabel] != string(corev1.Windows)
+}
+
+// injectResource requests one of the extended resource in the first container, unless a container already requests
+// it. Extended resources cannot be overcommitted, so the limit is set as well.
+func injectResource(pod *corev1.Pod, name corev1.ResourceName) {
+	if len(pod.Spec.Containers) == 0 || requestsResource(pod, name) {
+		return
+	}
+	one := resource.MustParse("1")
+	container := &pod.Spec.Containers[0]
+	if container.Resources.Requests == nil {
+		container.Resources.Requests = corev1.ResourceList{}
+	}
+	if container.Resources.Limits == nil {
+		container.Resources.Limits = corev1.ResourceList{}
+	}
+	container.Resources.Requests[name] = one
+	container.Resources.Limits[name] = one
+}
+
+// requestsResource returns whether a container of the pod requests the extended resource
+func requestsResource(pod *corev1.Pod, name corev1.ResourceName) bool {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for _, container := range containers {
+			if _, ok := container.Resources.Limits[name]; ok {
+				return true
+			}
+			if _, ok := container.Resources.Requests[name]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// podName returns the name of the pod, or its generated name prefix before the API server sets the name
+func podName(pod *corev1.Pod) string {
+	if pod.Name != "" {
+		return pod.Name
+	}
+	return pod.GenerateName
+}
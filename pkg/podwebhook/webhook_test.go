@@ -0,0 +1,103 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package podwebhook
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/amazon-vpc-resource-controller-k8s/apis/vpcresources/v1beta1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	testclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
+)
+
+func setup(t *testing.T, objects ...client.Object) *Mutator {
+	scheme := runtime.NewScheme()
+	require.NoError(t, corev1.AddToScheme(scheme))
+	require.NoError(t, v1alpha1.AddToScheme(scheme))
+	require.NoError(t, v1beta1.AddToScheme(scheme))
+	return &Mutator{
+		Decoder:             admission.NewDecoder(scheme),
+		Client:              testclient.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build(),
+		InjectPodIPResource: true,
+	}
+}
+
+func request(t *testing.T, pod *corev1.Pod) admission.Request {
+	raw, err := json.Marshal(pod)
+	require.NoError(t, err)
+	return admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+		Operation: admissionv1.Create,
+		Namespace: "default",
+		Object:    runtime.RawExtension{Raw: raw},
+	}}
+}
+
+func testPod() *corev1.Pod {
+	pod := &corev1.Pod{Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "app"}, {Name: "sidecar"}}}}
+	pod.APIVersion, pod.Kind = "v1", "Pod"
+	pod.GenerateName = "app-"
+	return pod
+}
+
+func TestInjectPodIPResource(t *testing.T) {
+	m := setup(t)
+
+	resp := m.Handle(context.Background(), request(t, testPod()))
+	assert.True(t, resp.Allowed)
+	if assert.Len(t, resp.Patches, 2) {
+		paths := []string{resp.Patches[0].Path, resp.Patches[1].Path}
+		assert.ElementsMatch(t, []string{"/spec/containers/0/resources/requests", "/spec/containers/0/resources/limits"}, paths)
+		assert.Equal(t, map[string]interface{}{string(PodIPResource): "1"}, resp.Patches[0].Value)
+	}
+
+	// Disabled
+	m.InjectPodIPResource = false
+	resp = m.Handle(context.Background(), request(t, testPod()))
+	assert.True(t, resp.Allowed)
+	assert.Empty(t, resp.Patches)
+}
+
+func TestInjectPodIPResourceSkipped(t *testing.T) {
+	m := setup(t)
+
+	hostNetwork := testPod()
+	hostNetwork.Spec.HostNetwork = true
+	fargate := testPod()
+	fargate.Spec.SchedulerName = fargateScheduler
+	windows := testPod()
+	windows.Spec.NodeSelector = map[string]string{osLabel: "windows"}
+	windowsOS := testPod()
+	windowsOS.Spec.OS = &corev1.PodOS{Name: corev1.Windows}
+	requested := testPod()
+	requested.Spec.Containers[1].Resources.Limits = corev1.ResourceList{PodIPResource: resource.MustParse("1")}
+
+	for name, pod := range map[string]*corev1.Pod{
+		"host network": hostNetwork, "fargate": fargate, "windows": windows, "windows os": windowsOS, "requested": requested,
+	} {
+		resp := m.Handle(context.Background(), request(t, pod))
+		assert.True(t, resp.Allowed, name)
+		assert.Empty(t, resp.Patches, name)
+	}
+}
@@ -157,9 +157,10 @@ func (p *cloudWatchPublisher) Publish(metricDataPoints ...*cloudwatch.MetricDatu
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	// NOTE: Iteration is used to override the metric dimensions
+	// NOTE: Iteration is used to add the cluster dimension to the dimensions of the data points, such as the
+	// nodegroup and availability zone of the metrics that are broken down
 	for _, metricDatum := range metricDataPoints {
-		metricDatum.Dimensions = dimensions
+		metricDatum.Dimensions = append(append([]*cloudwatch.Dimension{}, dimensions...), metricDatum.Dimensions...)
 		p.localMetricData = append(p.localMetricData, metricDatum)
 	}
 }
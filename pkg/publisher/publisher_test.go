@@ -86,6 +86,25 @@ func TestCloudWatchPublisherWithMultipleDatum(t *testing.T) {
 	assert.Empty(t, cloudwatchPublisher.localMetricData)
 }
 
+func TestCloudWatchPublisherWithDatumDimensions(t *testing.T) {
+	cloudwatchPublisher := getCloudWatchPublisher(t)
+
+	zoneDimension := &cloudwatch.Dimension{Name: aws.String("AvailabilityZone"), Value: aws.String("us-west-2a")}
+	testCloudwatchMetricDatum := &cloudwatch.MetricDatum{
+		MetricName: aws.String("TEST_METRIC"),
+		Dimensions: []*cloudwatch.Dimension{zoneDimension},
+		Unit:       aws.String(cloudwatch.StandardUnitNone),
+		Value:      aws.Float64(1.0),
+	}
+
+	cloudwatchPublisher.Publish(testCloudwatchMetricDatum)
+	assert.Len(t, cloudwatchPublisher.localMetricData, 1)
+	assert.Equal(t, []*cloudwatch.Dimension{
+		{Name: aws.String(clusterIDDimension), Value: aws.String(testClusterID)},
+		zoneDimension,
+	}, cloudwatchPublisher.localMetricData[0].Dimensions)
+}
+
 func TestCloudWatchPublisherWithGreaterThanMaxDatapoints(t *testing.T) {
 	cloudwatchPublisher := getCloudWatchPublisher(t)
 
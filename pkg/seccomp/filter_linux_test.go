@@ -0,0 +1,381 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build linux && (amd64 || arm64)
+
+package seccomp
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"testing"
+	"unsafe"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/containernetworking/plugins/pkg/testutils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkhelper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/networkutils"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+	"github.com/aws/amazon-vpc-cni-k8s/utils/cp"
+)
+
+// The test binary re-executes itself under the seccomp filter of a component, and runs the code paths of that
+// component. Syscalls outside of the profile raise SIGSYS, which crashes the child with the stack of the call.
+const (
+	envComponent  = "SECCOMP_TEST_COMPONENT"
+	envWorkDir    = "SECCOMP_TEST_WORK_DIR"
+	envPrivileged = "SECCOMP_TEST_PRIVILEGED"
+	envTargetNS   = "SECCOMP_TEST_TARGET_NETNS"
+
+	// aws-node runs as this UID with only its capabilities, other components as root
+	unprivilegedUID = 65534
+)
+
+var capabilityNumbers = map[string]uintptr{
+	"NET_ADMIN": unix.CAP_NET_ADMIN,
+	"NET_RAW":   unix.CAP_NET_RAW,
+	"SYS_ADMIN": unix.CAP_SYS_ADMIN,
+}
+
+var exercises = map[string]func(workDir string, privileged bool) error{
+	"aws-node":         exerciseAWSNode,
+	"aws-vpc-cni-init": exerciseInit,
+	"aws-cni":          exerciseCNIPlugin,
+}
+
+func TestMain(m *testing.M) {
+	if name := os.Getenv(envComponent); name != "" {
+		os.Exit(runComponent(name))
+	}
+	os.Exit(m.Run())
+}
+
+func TestSyscallNumbers(t *testing.T) {
+	for _, component := range Components {
+		for _, name := range component.Syscalls {
+			_, ok := syscallNumbers[name]
+			assert.True(t, ok || slices.Contains(unavailableSyscalls, name), "add the number of %s to syscallNumbers", name)
+		}
+	}
+}
+
+func TestComponentsUnderProfile(t *testing.T) {
+	privileged := os.Getuid() == 0
+	if !privileged {
+		t.Log("Not running as root, only the unprivileged code paths are exercised")
+	}
+
+	// Copy the test binary where the unprivileged UID can run it
+	binDir, err := os.MkdirTemp("", "seccomp-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(binDir)
+	require.NoError(t, os.Chmod(binDir, 0755))
+	testBinary := filepath.Join(binDir, "seccomp.test")
+	require.NoError(t, cp.CopyFile(os.Args[0], testBinary))
+	require.NoError(t, os.Chmod(testBinary, 0755))
+
+	for _, component := range Components {
+		t.Run(component.Name, func(t *testing.T) {
+			require.Contains(t, exercises, component.Name)
+			workDir := filepath.Join(binDir, component.Name)
+			require.NoError(t, os.Mkdir(workDir, 0755))
+
+			cmd := exec.Command(testBinary)
+			cmd.Dir = workDir
+			cmd.Env = append(os.Environ(),
+				envComponent+"="+component.Name,
+				envWorkDir+"="+workDir,
+				"AWS_VPC_K8S_CNI_LOG_FILE="+filepath.Join(workDir, "test.log"),
+				fmt.Sprintf("%s=%t", envPrivileged, privileged))
+			if privileged {
+				// Run in a network namespace of its own, so that the host network is not modified
+				cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: syscall.CLONE_NEWNET}
+				if component.Name == "aws-node" {
+					require.NoError(t, os.Chown(workDir, unprivilegedUID, unprivilegedUID))
+					cmd.SysProcAttr.Credential = &syscall.Credential{Uid: unprivilegedUID, Gid: unprivilegedUID}
+					for _, capability := range component.Capabilities {
+						require.Contains(t, capabilityNumbers, capability)
+						cmd.SysProcAttr.AmbientCaps = append(cmd.SysProcAttr.AmbientCaps, capabilityNumbers[capability])
+					}
+				}
+				if component.Name == "aws-cni" {
+					targetNS, err := testutils.NewNS()
+					require.NoError(t, err)
+					defer func() {
+						targetNS.Close()
+						_ = testutils.UnmountNS(targetNS)
+					}()
+					cmd.Env = append(cmd.Env, envTargetNS+"="+targetNS.Path())
+				}
+			}
+			output, err := cmd.CombinedOutput()
+			assert.NoError(t, err, "%s failed under its seccomp profile:\n%s", component.Name, output)
+		})
+	}
+}
+
+func runComponent(name string) int {
+	var component Component
+	for _, c := range Components {
+		if c.Name == name {
+			component = c
+		}
+	}
+	if err := installFilter(component.Syscalls); err != nil {
+		fmt.Fprintf(os.Stderr, "failed to install the seccomp filter: %v\n", err)
+		return 2
+	}
+	if err := exercises[name](os.Getenv(envWorkDir), os.Getenv(envPrivileged) == "true"); err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// installFilter allows the syscalls on all threads of the process, and raises SIGSYS for the others
+func installFilter(syscalls []string) error {
+	stmt := func(code uint16, k uint32) unix.SockFilter {
+		return unix.SockFilter{Code: code, K: k}
+	}
+	jump := func(code uint16, k uint32, jt, jf uint8) unix.SockFilter {
+		return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+	}
+
+	// struct seccomp_data starts with the syscall number, followed by the architecture
+	filter := []unix.SockFilter{
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 4),
+		jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, auditArch, 1, 0),
+		stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		stmt(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 0),
+	}
+	for _, name := range syscalls {
+		nr, ok := syscallNumbers[name]
+		if !ok {
+			continue
+		}
+		filter = append(filter,
+			jump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+			stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW))
+	}
+	filter = append(filter, stmt(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_TRAP))
+
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+	prog := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+	if _, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, unix.SECCOMP_FILTER_FLAG_TSYNC,
+		uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// exerciseCommon runs the code paths that every component has: logging, file installation, HTTP and netlink
+func exerciseCommon(workDir string) error {
+	log := logger.Get()
+	log.Infof("Running under the seccomp profile")
+
+	if err := cp.CopyFile("/bin/true", filepath.Join(workDir, "true")); err != nil {
+		return fmt.Errorf("copy: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "10-aws.conflist.tmp"), []byte("{}"), 0644); err != nil {
+		return fmt.Errorf("write: %v", err)
+	}
+	if err := os.Rename(filepath.Join(workDir, "10-aws.conflist.tmp"), filepath.Join(workDir, "10-aws.conflist")); err != nil {
+		return fmt.Errorf("rename: %v", err)
+	}
+	if _, err := os.ReadDir(workDir); err != nil {
+		return fmt.Errorf("read dir: %v", err)
+	}
+
+	// The loopback interface of a new network namespace is down
+	if link, err := netlink.LinkByName("lo"); err == nil && link.Attrs().Flags&net.FlagUp == 0 {
+		if err := netlink.LinkSetUp(link); err != nil {
+			return fmt.Errorf("set loopback up: %v", err)
+		}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("listen: %v", err)
+	}
+	go func() {
+		_ = http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			_, _ = w.Write([]byte("ok"))
+		}))
+	}()
+	resp, err := http.Get("http://" + listener.Addr().String())
+	if err != nil {
+		return fmt.Errorf("http: %v", err)
+	}
+	_, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if _, err := netlink.LinkList(); err != nil {
+		return fmt.Errorf("list links: %v", err)
+	}
+	if _, err := netlink.RouteList(nil, netlink.FAMILY_ALL); err != nil {
+		return fmt.Errorf("list routes: %v", err)
+	}
+	if _, err := netlink.RuleList(netlink.FAMILY_ALL); err != nil {
+		return fmt.Errorf("list rules: %v", err)
+	}
+	return nil
+}
+
+// exerciseAWSNode runs ipamd code paths: the network helper socket, running binaries and programming routes and rules
+func exerciseAWSNode(workDir string, privileged bool) error {
+	if err := exerciseCommon(workDir); err != nil {
+		return err
+	}
+
+	socketPath := filepath.Join(workDir, "network-helper.sock")
+	go func() {
+		_ = networkhelper.Serve(socketPath, uint32(os.Getuid()), networkutils.New())
+	}()
+	helper, err := networkhelper.NewClient(socketPath)
+	if err != nil {
+		return fmt.Errorf("network helper: %v", err)
+	}
+	if _, err := helper.GetRuleList(); err != nil {
+		return fmt.Errorf("network helper: %v", err)
+	}
+
+	if err := exec.Command("/bin/true").Run(); err != nil {
+		return fmt.Errorf("exec: %v", err)
+	}
+	if !privileged {
+		return nil
+	}
+
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "eth1"}, PeerName: "eth1-peer"}
+	if err := netlink.LinkAdd(veth); err != nil {
+		return fmt.Errorf("add link: %v", err)
+	}
+	link, err := netlink.LinkByName("eth1")
+	if err != nil {
+		return fmt.Errorf("get link: %v", err)
+	}
+	if err := netlink.LinkSetUp(link); err != nil {
+		return fmt.Errorf("set link up: %v", err)
+	}
+	addr, _ := netlink.ParseAddr("10.0.0.10/24")
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		return fmt.Errorf("add address: %v", err)
+	}
+	_, dst, _ := net.ParseCIDR("10.1.0.0/16")
+	if err := netlink.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst, Table: 2}); err != nil {
+		return fmt.Errorf("add route: %v", err)
+	}
+	rule := netlink.NewRule()
+	rule.Src = dst
+	rule.Table = 2
+	rule.Priority = 1536
+	if err := netlink.RuleAdd(rule); err != nil {
+		return fmt.Errorf("add rule: %v", err)
+	}
+	if output, err := exec.Command("ip", "route", "show", "table", "2").CombinedOutput(); err != nil {
+		if _, lookErr := exec.LookPath("ip"); lookErr == nil {
+			return fmt.Errorf("ip route: %v: %s", err, output)
+		}
+	}
+	return nil
+}
+
+// exerciseInit runs aws-vpc-cni-init code paths: installing the plugins and setting sysctls
+func exerciseInit(workDir string, privileged bool) error {
+	if err := exerciseCommon(workDir); err != nil {
+		return err
+	}
+	binDir := filepath.Join(workDir, "bin")
+	if err := os.Mkdir(binDir, 0755); err != nil {
+		return err
+	}
+	if err := cp.InstallBinariesFromDir(workDir, binDir, map[string]bool{"test.log": true}); err != nil {
+		return fmt.Errorf("install binaries: %v", err)
+	}
+	// Relabeling fails without SELinux on the host, the call only has to get past the filter
+	if err := unix.Lsetxattr(binDir, "security.selinux", []byte("system_u:object_r:container_file_t:s0\x00"), 0); err != nil &&
+		err != unix.ENOTSUP && err != unix.EPERM && err != unix.EACCES {
+		return fmt.Errorf("relabel: %v", err)
+	}
+	if !privileged {
+		return nil
+	}
+	// The child has a network namespace of its own, so this does not change the host
+	if err := os.WriteFile("/proc/sys/net/ipv4/conf/lo/rp_filter", []byte("2"), 0644); err != nil {
+		return fmt.Errorf("sysctl: %v", err)
+	}
+	return nil
+}
+
+// exerciseCNIPlugin runs aws-cni code paths: creating the veth pair and configuring it in the pod network namespace
+func exerciseCNIPlugin(workDir string, privileged bool) error {
+	if err := exerciseCommon(workDir); err != nil {
+		return err
+	}
+	if !privileged {
+		return nil
+	}
+
+	targetNS, err := ns.GetNS(os.Getenv(envTargetNS))
+	if err != nil {
+		return fmt.Errorf("get netns: %v", err)
+	}
+	defer targetNS.Close()
+	veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "eni0123456789a"}, PeerName: "eth0"}
+	if err := netlink.LinkAdd(veth); err != nil {
+		return fmt.Errorf("add veth: %v", err)
+	}
+	peer, err := netlink.LinkByName("eth0")
+	if err != nil {
+		return fmt.Errorf("get peer: %v", err)
+	}
+	if err := netlink.LinkSetNsFd(peer, int(targetNS.Fd())); err != nil {
+		return fmt.Errorf("move peer: %v", err)
+	}
+	err = targetNS.Do(func(ns.NetNS) error {
+		link, err := netlink.LinkByName("eth0")
+		if err != nil {
+			return err
+		}
+		if err := netlink.LinkSetUp(link); err != nil {
+			return err
+		}
+		addr, _ := netlink.ParseAddr("10.0.0.20/32")
+		if err := netlink.AddrAdd(link, addr); err != nil {
+			return err
+		}
+		gw := net.ParseIP("169.254.1.1")
+		if err := netlink.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Dst: &net.IPNet{IP: gw, Mask: net.CIDRMask(32, 32)}, Scope: netlink.SCOPE_LINK}); err != nil {
+			return err
+		}
+		return netlink.RouteAdd(&netlink.Route{LinkIndex: link.Attrs().Index, Gw: gw})
+	})
+	if err != nil && !strings.Contains(err.Error(), "file exists") {
+		return fmt.Errorf("configure pod netns: %v", err)
+	}
+	return nil
+}
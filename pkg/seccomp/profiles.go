@@ -0,0 +1,145 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package seccomp defines the syscalls and capabilities that the VPC CNI components need. The seccomp profiles in
+// misc/seccomp are generated from it with `make generate-seccomp-profiles`.
+package seccomp
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// Component is a binary of the VPC CNI, with the syscalls and capabilities it needs
+type Component struct {
+	// Name is the file name of the generated profile, without the .json extension
+	Name string
+	// Capabilities is the minimal capability set of the container running the component
+	Capabilities []string
+	// Syscalls are the syscalls allowed by the profile. Syscalls that do not exist on an architecture are ignored by
+	// the container runtime.
+	Syscalls []string
+}
+
+// goRuntimeSyscalls are used by every Go binary: the runtime, logging to files, and the os and net packages
+var goRuntimeSyscalls = []string{
+	"arch_prctl", "brk", "clock_getres", "clock_gettime", "clock_nanosleep", "clone", "clone3", "close", "close_range",
+	"dup", "dup2", "dup3", "epoll_create", "epoll_create1", "epoll_ctl", "epoll_pwait", "epoll_pwait2", "epoll_wait",
+	"eventfd2", "exit", "exit_group", "fcntl", "fstat", "fstatfs", "futex", "getcwd", "getdents64", "getegid",
+	"geteuid", "getgid", "getgroups", "getpid", "getppid", "getrandom", "getrlimit", "getrusage", "gettid",
+	"gettimeofday", "getuid", "ioctl", "lseek", "madvise", "membarrier", "mincore", "mmap", "mprotect", "mremap",
+	"munmap", "nanosleep", "newfstatat", "openat", "pipe", "pipe2", "poll", "ppoll", "prctl", "pread64",
+	"prlimit64", "pselect6", "pwrite64", "read", "readlinkat", "readv", "restart_syscall", "rseq", "rt_sigaction",
+	"rt_sigprocmask", "rt_sigreturn", "sched_getaffinity", "sched_yield", "select", "set_robust_list",
+	"set_tid_address", "setitimer", "sigaltstack", "statfs", "statx", "sysinfo", "tgkill", "timer_create",
+	"timer_delete", "timer_settime", "uname", "write", "writev",
+}
+
+// fileSyscalls install binaries and configuration, write logs and the checkpoint file
+var fileSyscalls = []string{
+	"access", "chmod", "chown", "copy_file_range", "faccessat", "faccessat2", "fadvise64", "fallocate", "fchdir",
+	"fchmod", "fchmodat", "fchown", "fchownat", "fdatasync", "flock", "fsync", "ftruncate", "link", "linkat", "lstat",
+	"mkdir", "mkdirat", "open", "readlink", "rename", "renameat", "renameat2", "sendfile", "splice", "stat",
+	"symlink", "symlinkat", "umask", "unlink", "unlinkat", "utimensat",
+}
+
+// networkSyscalls talk to the API server, EC2 and IMDS, serve gRPC, metrics and introspection, and program the host
+// network through netlink
+var networkSyscalls = []string{
+	"accept", "accept4", "bind", "connect", "getpeername", "getsockname", "getsockopt", "listen", "recvfrom",
+	"recvmmsg", "recvmsg", "sendmmsg", "sendmsg", "sendto", "setsockopt", "shutdown", "socket", "socketpair",
+}
+
+// processSyscalls run iptables, ip6tables and the CNI plugins, and the dynamic loader of these binaries
+var processSyscalls = []string{
+	"capget", "chdir", "execve", "execveat", "getpgid", "getpgrp", "getsid", "kill", "pidfd_open",
+	"pidfd_send_signal", "setpgid", "setsid", "vfork", "wait4", "waitid",
+}
+
+// namespaceSyscalls enter the network namespace of pods
+var namespaceSyscalls = []string{
+	"setns", "unshare",
+}
+
+// selinuxSyscalls relabel the host directories of aws-node with ENABLE_SELINUX_RELABEL
+var selinuxSyscalls = []string{
+	"lsetxattr",
+}
+
+// Components are the VPC CNI binaries that profiles are generated for
+var Components = []Component{
+	{
+		// aws-vpc-cni and aws-k8s-agent run in the aws-node container, and run iptables
+		Name:         "aws-node",
+		Capabilities: []string{"NET_ADMIN", "NET_RAW"},
+		Syscalls:     merge(goRuntimeSyscalls, fileSyscalls, networkSyscalls, processSyscalls),
+	},
+	{
+		// aws-vpc-cni-init installs the plugins and sets sysctls. Writing to /proc/sys needs a privileged container,
+		// within it network sysctls only need NET_ADMIN.
+		Name:         "aws-vpc-cni-init",
+		Capabilities: []string{"NET_ADMIN"},
+		Syscalls:     merge(goRuntimeSyscalls, fileSyscalls, networkSyscalls, selinuxSyscalls),
+	},
+	{
+		// aws-cni and egress-cni are run by the container runtime on the host, outside of the aws-node pod, with the
+		// privileges of the runtime
+		Name:         "aws-cni",
+		Capabilities: []string{"NET_ADMIN", "NET_RAW", "SYS_ADMIN"},
+		Syscalls:     merge(goRuntimeSyscalls, fileSyscalls, networkSyscalls, processSyscalls, namespaceSyscalls),
+	},
+}
+
+// merge returns the sorted union of syscall lists
+func merge(lists ...[]string) []string {
+	set := map[string]struct{}{}
+	for _, list := range lists {
+		for _, syscall := range list {
+			set[syscall] = struct{}{}
+		}
+	}
+	merged := make([]string, 0, len(set))
+	for syscall := range set {
+		merged = append(merged, syscall)
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// profile is the seccomp profile format of the container runtime, used by localhost profiles in the pod spec
+type profile struct {
+	DefaultAction   string        `json:"defaultAction"`
+	DefaultErrnoRet int           `json:"defaultErrnoRet"`
+	Architectures   []string      `json:"architectures"`
+	Syscalls        []syscallRule `json:"syscalls"`
+}
+
+type syscallRule struct {
+	Names  []string `json:"names"`
+	Action string   `json:"action"`
+}
+
+// Profile returns the seccomp profile of the component. Syscalls outside of the profile fail with EPERM.
+func (c Component) Profile() ([]byte, error) {
+	p := profile{
+		DefaultAction:   "SCMP_ACT_ERRNO",
+		DefaultErrnoRet: 1,
+		Architectures:   []string{"SCMP_ARCH_X86_64", "SCMP_ARCH_AARCH64"},
+		Syscalls:        []syscallRule{{Names: c.Syscalls, Action: "SCMP_ACT_ALLOW"}},
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
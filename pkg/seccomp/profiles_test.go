@@ -0,0 +1,50 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package seccomp
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilesUpToDate(t *testing.T) {
+	for _, component := range Components {
+		t.Run(component.Name, func(t *testing.T) {
+			expected, err := component.Profile()
+			require.NoError(t, err)
+			actual, err := os.ReadFile(filepath.Join("..", "..", "misc", "seccomp", component.Name+".json"))
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), string(actual), "run make generate-seccomp-profiles")
+		})
+	}
+}
+
+func TestProfile(t *testing.T) {
+	var p profile
+	data, err := Components[0].Profile()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &p))
+	assert.Equal(t, "SCMP_ACT_ERRNO", p.DefaultAction)
+	if assert.Len(t, p.Syscalls, 1) {
+		assert.Equal(t, "SCMP_ACT_ALLOW", p.Syscalls[0].Action)
+		assert.True(t, sort.StringsAreSorted(p.Syscalls[0].Names))
+		assert.Contains(t, p.Syscalls[0].Names, "execve")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package seccomp
+
+import "golang.org/x/sys/unix"
+
+// auditArch is the architecture that the filter of the test allows
+const auditArch = unix.AUDIT_ARCH_AARCH64
+
+// syscallNumbers are the numbers of the profile syscalls that exist on arm64
+var syscallNumbers = map[string]uintptr{
+	"accept":            unix.SYS_ACCEPT,
+	"accept4":           unix.SYS_ACCEPT4,
+	"bind":              unix.SYS_BIND,
+	"brk":               unix.SYS_BRK,
+	"capget":            unix.SYS_CAPGET,
+	"chdir":             unix.SYS_CHDIR,
+	"clock_getres":      unix.SYS_CLOCK_GETRES,
+	"clock_gettime":     unix.SYS_CLOCK_GETTIME,
+	"clock_nanosleep":   unix.SYS_CLOCK_NANOSLEEP,
+	"clone":             unix.SYS_CLONE,
+	"clone3":            unix.SYS_CLONE3,
+	"close":             unix.SYS_CLOSE,
+	"close_range":       unix.SYS_CLOSE_RANGE,
+	"connect":           unix.SYS_CONNECT,
+	"copy_file_range":   unix.SYS_COPY_FILE_RANGE,
+	"dup":               unix.SYS_DUP,
+	"dup3":              unix.SYS_DUP3,
+	"epoll_create1":     unix.SYS_EPOLL_CREATE1,
+	"epoll_ctl":         unix.SYS_EPOLL_CTL,
+	"epoll_pwait":       unix.SYS_EPOLL_PWAIT,
+	"epoll_pwait2":      unix.SYS_EPOLL_PWAIT2,
+	"eventfd2":          unix.SYS_EVENTFD2,
+	"execve":            unix.SYS_EXECVE,
+	"execveat":          unix.SYS_EXECVEAT,
+	"exit":              unix.SYS_EXIT,
+	"exit_group":        unix.SYS_EXIT_GROUP,
+	"faccessat":         unix.SYS_FACCESSAT,
+	"faccessat2":        unix.SYS_FACCESSAT2,
+	"fadvise64":         unix.SYS_FADVISE64,
+	"fallocate":         unix.SYS_FALLOCATE,
+	"fchdir":            unix.SYS_FCHDIR,
+	"fchmod":            unix.SYS_FCHMOD,
+	"fchmodat":          unix.SYS_FCHMODAT,
+	"fchown":            unix.SYS_FCHOWN,
+	"fchownat":          unix.SYS_FCHOWNAT,
+	"fcntl":             unix.SYS_FCNTL,
+	"fdatasync":         unix.SYS_FDATASYNC,
+	"flock":             unix.SYS_FLOCK,
+	"fstat":             unix.SYS_FSTAT,
+	"fstatfs":           unix.SYS_FSTATFS,
+	"fsync":             unix.SYS_FSYNC,
+	"ftruncate":         unix.SYS_FTRUNCATE,
+	"futex":             unix.SYS_FUTEX,
+	"getcwd":            unix.SYS_GETCWD,
+	"getdents64":        unix.SYS_GETDENTS64,
+	"getegid":           unix.SYS_GETEGID,
+	"geteuid":           unix.SYS_GETEUID,
+	"getgid":            unix.SYS_GETGID,
+	"getgroups":         unix.SYS_GETGROUPS,
+	"getpeername":       unix.SYS_GETPEERNAME,
+	"getpgid":           unix.SYS_GETPGID,
+	"getpid":            unix.SYS_GETPID,
+	"getppid":           unix.SYS_GETPPID,
+	"getrandom":         unix.SYS_GETRANDOM,
+	"getrlimit":         unix.SYS_GETRLIMIT,
+	"getrusage":         unix.SYS_GETRUSAGE,
+	"getsid":            unix.SYS_GETSID,
+	"getsockname":       unix.SYS_GETSOCKNAME,
+	"getsockopt":        unix.SYS_GETSOCKOPT,
+	"gettid":            unix.SYS_GETTID,
+	"gettimeofday":      unix.SYS_GETTIMEOFDAY,
+	"getuid":            unix.SYS_GETUID,
+	"ioctl":             unix.SYS_IOCTL,
+	"kill":              unix.SYS_KILL,
+	"linkat":            unix.SYS_LINKAT,
+	"listen":            unix.SYS_LISTEN,
+	"lsetxattr":         unix.SYS_LSETXATTR,
+	"lseek":             unix.SYS_LSEEK,
+	"madvise":           unix.SYS_MADVISE,
+	"membarrier":        unix.SYS_MEMBARRIER,
+	"mincore":           unix.SYS_MINCORE,
+	"mkdirat":           unix.SYS_MKDIRAT,
+	"mmap":              unix.SYS_MMAP,
+	"mprotect":          unix.SYS_MPROTECT,
+	"mremap":            unix.SYS_MREMAP,
+	"munmap":            unix.SYS_MUNMAP,
+	"nanosleep":         unix.SYS_NANOSLEEP,
+	"newfstatat":        unix.SYS_FSTATAT,
+	"openat":            unix.SYS_OPENAT,
+	"pidfd_open":        unix.SYS_PIDFD_OPEN,
+	"pidfd_send_signal": unix.SYS_PIDFD_SEND_SIGNAL,
+	"pipe2":             unix.SYS_PIPE2,
+	"ppoll":             unix.SYS_PPOLL,
+	"prctl":             unix.SYS_PRCTL,
+	"pread64":           unix.SYS_PREAD64,
+	"prlimit64":         unix.SYS_PRLIMIT64,
+	"pselect6":          unix.SYS_PSELECT6,
+	"pwrite64":          unix.SYS_PWRITE64,
+	"read":              unix.SYS_READ,
+	"readlinkat":        unix.SYS_READLINKAT,
+	"readv":             unix.SYS_READV,
+	"recvfrom":          unix.SYS_RECVFROM,
+	"recvmmsg":          unix.SYS_RECVMMSG,
+	"recvmsg":           unix.SYS_RECVMSG,
+	"renameat":          unix.SYS_RENAMEAT,
+	"renameat2":         unix.SYS_RENAMEAT2,
+	"restart_syscall":   unix.SYS_RESTART_SYSCALL,
+	"rseq":              unix.SYS_RSEQ,
+	"rt_sigaction":      unix.SYS_RT_SIGACTION,
+	"rt_sigprocmask":    unix.SYS_RT_SIGPROCMASK,
+	"rt_sigreturn":      unix.SYS_RT_SIGRETURN,
+	"sched_getaffinity": unix.SYS_SCHED_GETAFFINITY,
+	"sched_yield":       unix.SYS_SCHED_YIELD,
+	"sendfile":          unix.SYS_SENDFILE,
+	"sendmmsg":          unix.SYS_SENDMMSG,
+	"sendmsg":           unix.SYS_SENDMSG,
+	"sendto":            unix.SYS_SENDTO,
+	"set_robust_list":   unix.SYS_SET_ROBUST_LIST,
+	"set_tid_address":   unix.SYS_SET_TID_ADDRESS,
+	"setitimer":         unix.SYS_SETITIMER,
+	"setns":             unix.SYS_SETNS,
+	"setpgid":           unix.SYS_SETPGID,
+	"setsid":            unix.SYS_SETSID,
+	"setsockopt":        unix.SYS_SETSOCKOPT,
+	"shutdown":          unix.SYS_SHUTDOWN,
+	"sigaltstack":       unix.SYS_SIGALTSTACK,
+	"socket":            unix.SYS_SOCKET,
+	"socketpair":        unix.SYS_SOCKETPAIR,
+	"splice":            unix.SYS_SPLICE,
+	"statfs":            unix.SYS_STATFS,
+	"statx":             unix.SYS_STATX,
+	"symlinkat":         unix.SYS_SYMLINKAT,
+	"sysinfo":           unix.SYS_SYSINFO,
+	"tgkill":            unix.SYS_TGKILL,
+	"timer_create":      unix.SYS_TIMER_CREATE,
+	"timer_delete":      unix.SYS_TIMER_DELETE,
+	"timer_settime":     unix.SYS_TIMER_SETTIME,
+	"umask":             unix.SYS_UMASK,
+	"uname":             unix.SYS_UNAME,
+	"unlinkat":          unix.SYS_UNLINKAT,
+	"unshare":           unix.SYS_UNSHARE,
+	"utimensat":         unix.SYS_UTIMENSAT,
+	"wait4":             unix.SYS_WAIT4,
+	"waitid":            unix.SYS_WAITID,
+	"write":             unix.SYS_WRITE,
+	"writev":            unix.SYS_WRITEV,
+}
+
+// unavailableSyscalls are profile syscalls that arm64 does not have, their *at or newer variants are used instead
+var unavailableSyscalls = []string{
+	"access", "arch_prctl", "chmod", "chown", "dup2", "epoll_create", "epoll_wait", "getpgrp", "link", "lstat", "mkdir",
+	"open", "pipe", "poll", "readlink", "rename", "select", "stat", "symlink", "unlink", "vfork",
+}
@@ -0,0 +1,210 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package sysctlpolicy applies and reconciles the sysctls that aws-node sets on the interfaces of the node
+package sysctlpolicy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+)
+
+const (
+	// PrimaryInterface stands for the primary ENI in settings, whose interface name depends on the instance
+	PrimaryInterface = "primary"
+	// AllInterfaces is the pseudo interface whose values combine with, or replace, those of every interface
+	AllInterfaces = "all"
+
+	rpFilterKey = "ipv4/rp_filter"
+)
+
+var log = logger.GetComponent("sysctlpolicy")
+
+// Setting is the value of a sysctl of an interface
+type Setting struct {
+	// Interface is PrimaryInterface, AllInterfaces, "default" or the name of an interface
+	Interface string
+	// Key is the path of the sysctl under the conf directory of the interface, prefixed with the address family,
+	// like ipv4/rp_filter or ipv6/accept_ra
+	Key string
+	// Value is the value to set, an empty value leaves the sysctl to the host
+	Value string
+}
+
+// Conflict is a sysctl whose value on the host does not match the policy
+type Conflict struct {
+	Entry    string
+	Expected string
+	Found    string
+	Reason   string
+}
+
+func (c Conflict) String() string {
+	return fmt.Sprintf("%s is %q instead of %q: %s", c.Entry, c.Found, c.Expected, c.Reason)
+}
+
+// Options are the features of the node that the default sysctls depend on
+type Options struct {
+	IPv6Enabled       bool
+	IPv6EgressEnabled bool
+	// StrictRPFSupport is whether the connmark of the traffic entering the primary ENI is restored on its packets, so
+	// that the reverse path check of NodePort traffic passes with strict reverse path filtering
+	StrictRPFSupport bool
+}
+
+// Defaults returns the sysctls aws-node sets. Reverse path filtering on the primary ENI is loose, as the replies to
+// NodePort traffic for the pods of secondary ENIs are routed through the primary ENI, unless the reverse path check
+// can use the connmark instead. IPv6 pods and IPv6 egress need forwarding on all interfaces, and router
+// advertisements are still accepted on the primary ENI for its default route.
+func Defaults(opts Options) []Setting {
+	var settings []Setting
+	if opts.StrictRPFSupport {
+		settings = append(settings, Setting{Interface: PrimaryInterface, Key: "ipv4/src_valid_mark", Value: "1"})
+	} else {
+		settings = append(settings, Setting{Interface: PrimaryInterface, Key: rpFilterKey, Value: "2"})
+	}
+	if opts.IPv6Enabled {
+		settings = append(settings, Setting{Interface: AllInterfaces, Key: "ipv6/disable_ipv6", Value: "0"})
+	}
+	if opts.IPv6Enabled || opts.IPv6EgressEnabled {
+		settings = append(settings,
+			Setting{Interface: AllInterfaces, Key: "ipv6/forwarding", Value: "1"},
+			Setting{Interface: PrimaryInterface, Key: "ipv6/accept_ra", Value: "2"})
+	}
+	return settings
+}
+
+// Merge returns the settings with the overrides replacing the settings of the same sysctl, and the other overrides
+// appended in order
+func Merge(settings, overrides []Setting) []Setting {
+	merged := append([]Setting{}, settings...)
+	for _, override := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].Interface == override.Interface && merged[i].Key == override.Key {
+				merged[i].Value = override.Value
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+// Validate returns an error if the setting does not name a sysctl of an interface
+func Validate(s Setting) error {
+	if s.Interface == "" || strings.ContainsAny(s.Interface, "/ ") || s.Interface == "." || s.Interface == ".." {
+		return fmt.Errorf("invalid interface %q", s.Interface)
+	}
+	family, name, found := strings.Cut(s.Key, "/")
+	if !found || (family != "ipv4" && family != "ipv6") || name == "" || strings.ContainsAny(name, "/ ") ||
+		name == "." || name == ".." {
+		return fmt.Errorf("invalid sysctl %q, expected ipv4/<name> or ipv6/<name>", s.Key)
+	}
+	if strings.ContainsAny(s.Value, "\n") {
+		return fmt.Errorf("invalid value %q for %s", s.Value, s.Key)
+	}
+	return nil
+}
+
+// Entry returns the path of the sysctl of an interface under /proc/sys
+func Entry(intf, key string) string {
+	family, name, _ := strings.Cut(key, "/")
+	return "net/" + family + "/conf/" + intf + "/" + name
+}
+
+// Engine sets sysctls and tells the changes made on the host from the initial values of the host
+type Engine struct {
+	procSys procsyswrapper.ProcSys
+	// applied is the value of each entry after the last Apply, the entries changed since then were changed on the host
+	applied map[string]string
+}
+
+// NewEngine returns an Engine setting sysctls through procSys
+func NewEngine(procSys procsyswrapper.ProcSys) *Engine {
+	return &Engine{procSys: procSys, applied: map[string]string{}}
+}
+
+// Apply sets the sysctls that do not have the value of their setting, primaryIntf standing for PrimaryInterface. It
+// returns the conflicts with the configuration of the host: values changed on the host since the last Apply, values
+// that can not be set, and reverse path filtering made stricter by the all interface.
+func (e *Engine) Apply(primaryIntf string, settings []Setting) []Conflict {
+	var conflicts []Conflict
+	for _, s := range settings {
+		if s.Value == "" {
+			continue
+		}
+		intf := s.Interface
+		if intf == PrimaryInterface {
+			intf = primaryIntf
+		}
+		if err := Validate(Setting{Interface: intf, Key: s.Key, Value: s.Value}); err != nil {
+			conflicts = append(conflicts, Conflict{Entry: s.Interface + "/" + s.Key, Expected: s.Value, Reason: err.Error()})
+			continue
+		}
+		entry := Entry(intf, s.Key)
+		found, err := e.get(entry)
+		if err != nil {
+			conflicts = append(conflicts, Conflict{Entry: entry, Expected: s.Value, Reason: err.Error()})
+			continue
+		}
+		if found != s.Value {
+			if err := e.procSys.Set(entry, s.Value); err != nil {
+				delete(e.applied, entry)
+				conflicts = append(conflicts, Conflict{Entry: entry, Expected: s.Value, Found: found, Reason: err.Error()})
+				continue
+			}
+			if e.applied[entry] == s.Value {
+				conflicts = append(conflicts, Conflict{Entry: entry, Expected: s.Value, Found: found,
+					Reason: "changed on the host, set back"})
+			}
+			log.Infof("Updated %s from %s to %s", entry, found, s.Value)
+		}
+		e.applied[entry] = s.Value
+
+		if s.Key == rpFilterKey && intf != AllInterfaces {
+			if conflict, ok := e.checkRPFilter(entry, s.Value); ok {
+				conflicts = append(conflicts, conflict)
+			}
+		}
+	}
+	return conflicts
+}
+
+// checkRPFilter reports an rp_filter of an interface that the all interface overrides, the kernel uses the highest of
+// the two values
+func (e *Engine) checkRPFilter(entry, value string) (Conflict, bool) {
+	allEntry := Entry(AllInterfaces, rpFilterKey)
+	allValue, err := e.get(allEntry)
+	if err != nil {
+		return Conflict{}, false
+	}
+	expected, err1 := strconv.Atoi(value)
+	all, err2 := strconv.Atoi(allValue)
+	if err1 != nil || err2 != nil || all <= expected {
+		return Conflict{}, false
+	}
+	return Conflict{Entry: entry, Expected: value, Found: allValue,
+		Reason: fmt.Sprintf("%s is %s and takes precedence", allEntry, allValue)}, true
+}
+
+func (e *Engine) get(entry string) (string, error) {
+	value, err := e.procSys.Get(entry)
+	return strings.TrimSpace(value), err
+}
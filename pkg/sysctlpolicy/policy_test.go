@@ -0,0 +1,91 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package sysctlpolicy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	mock_procsyswrapper "github.com/aws/amazon-vpc-cni-k8s/pkg/procsyswrapper/mocks"
+)
+
+func TestDefaults(t *testing.T) {
+	assert.Equal(t, []Setting{{PrimaryInterface, "ipv4/rp_filter", "2"}}, Defaults(Options{}))
+	assert.Equal(t, []Setting{
+		{PrimaryInterface, "ipv4/src_valid_mark", "1"},
+		{AllInterfaces, "ipv6/forwarding", "1"},
+		{PrimaryInterface, "ipv6/accept_ra", "2"},
+	}, Defaults(Options{IPv6EgressEnabled: true, StrictRPFSupport: true}))
+	assert.Equal(t, []Setting{
+		{PrimaryInterface, "ipv4/rp_filter", "2"},
+		{AllInterfaces, "ipv6/disable_ipv6", "0"},
+		{AllInterfaces, "ipv6/forwarding", "1"},
+		{PrimaryInterface, "ipv6/accept_ra", "2"},
+	}, Defaults(Options{IPv6Enabled: true}))
+}
+
+func TestMerge(t *testing.T) {
+	merged := Merge(Defaults(Options{}), []Setting{
+		{PrimaryInterface, "ipv4/rp_filter", ""},
+		{"eth1", "ipv4/rp_filter", "1"},
+	})
+	assert.Equal(t, []Setting{{PrimaryInterface, "ipv4/rp_filter", ""}, {"eth1", "ipv4/rp_filter", "1"}}, merged)
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate(Setting{"eth0", "ipv4/rp_filter", "1"}))
+	assert.NoError(t, Validate(Setting{AllInterfaces, "ipv6/accept_ra", "2"}))
+	assert.Error(t, Validate(Setting{"", "ipv4/rp_filter", "1"}))
+	assert.Error(t, Validate(Setting{"../eth0", "ipv4/rp_filter", "1"}))
+	assert.Error(t, Validate(Setting{"eth0", "rp_filter", "1"}))
+	assert.Error(t, Validate(Setting{"eth0", "core/somaxconn", "1"}))
+	assert.Error(t, Validate(Setting{"eth0", "ipv4/../../tcp_early_demux", "1"}))
+	assert.Error(t, Validate(Setting{"eth0", "ipv4/rp_filter", "1\n2"}))
+}
+
+func TestApply(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	procSys := mock_procsyswrapper.NewMockProcSys(ctrl)
+	e := NewEngine(procSys)
+	settings := []Setting{{PrimaryInterface, "ipv4/rp_filter", "2"}, {AllInterfaces, "ipv6/forwarding", "1"}}
+
+	// Initial values of the host are set without conflicts
+	procSys.EXPECT().Get("net/ipv4/conf/eth0/rp_filter").Return("1\n", nil)
+	procSys.EXPECT().Set("net/ipv4/conf/eth0/rp_filter", "2").Return(nil)
+	procSys.EXPECT().Get("net/ipv4/conf/all/rp_filter").Return("0\n", nil)
+	procSys.EXPECT().Get("net/ipv6/conf/all/forwarding").Return("1\n", nil)
+	assert.Empty(t, e.Apply("eth0", settings))
+
+	// The host changes a value aws-node set
+	procSys.EXPECT().Get("net/ipv4/conf/eth0/rp_filter").Return("1\n", nil)
+	procSys.EXPECT().Set("net/ipv4/conf/eth0/rp_filter", "2").Return(nil)
+	procSys.EXPECT().Get("net/ipv4/conf/all/rp_filter").Return("0\n", nil)
+	procSys.EXPECT().Get("net/ipv6/conf/all/forwarding").Return("0\n", nil)
+	procSys.EXPECT().Set("net/ipv6/conf/all/forwarding", "1").Return(errors.New("read-only file system"))
+	assert.Equal(t, []Conflict{
+		{Entry: "net/ipv4/conf/eth0/rp_filter", Expected: "2", Found: "1", Reason: "changed on the host, set back"},
+		{Entry: "net/ipv6/conf/all/forwarding", Expected: "1", Found: "0", Reason: "read-only file system"},
+	}, e.Apply("eth0", settings))
+
+	// The all interface makes the reverse path filtering of the interface stricter
+	settings = []Setting{{"eth1", "ipv4/rp_filter", "0"}, {PrimaryInterface, "ipv4/rp_filter", ""}}
+	procSys.EXPECT().Get("net/ipv4/conf/eth1/rp_filter").Return("0\n", nil)
+	procSys.EXPECT().Get("net/ipv4/conf/all/rp_filter").Return("1\n", nil)
+	assert.Equal(t, []Conflict{{Entry: "net/ipv4/conf/eth1/rp_filter", Expected: "0", Found: "1",
+		Reason: "net/ipv4/conf/all/rp_filter is 1 and takes precedence"}}, e.Apply("eth0", settings))
+}
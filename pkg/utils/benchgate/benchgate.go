@@ -0,0 +1,139 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package benchgate fails a test when benchmarks get slower, or allocate more, than the baseline stored next to them
+package benchgate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+const (
+	// envBenchmarkGate is "true" to compare the benchmarks with their baseline, or "update" to store a new baseline
+	envBenchmarkGate = "BENCHMARK_GATE"
+
+	// envBenchmarkGateTolerance overrides the fraction by which a benchmark may exceed its baseline
+	envBenchmarkGateTolerance = "BENCHMARK_GATE_TOLERANCE"
+
+	defaultTolerance = 0.5
+
+	// runs is the number of times each benchmark runs, the fastest run is kept to filter out noise
+	runs = 3
+)
+
+// Benchmark is a named benchmark function, as passed to testing.B.Run
+type Benchmark struct {
+	Name string
+	F    func(b *testing.B)
+}
+
+// Result is the cost of one operation of a benchmark
+type Result struct {
+	NsPerOp     int64 `json:"nsPerOp"`
+	AllocsPerOp int64 `json:"allocsPerOp"`
+}
+
+// Check runs the benchmarks and compares them with the baseline file, or stores them as the new baseline. It skips the
+// test unless BENCHMARK_GATE is set, since benchmarks are slow and their baseline depends on the machine.
+func Check(t *testing.T, baselinePath string, benchmarks []Benchmark) {
+	mode := os.Getenv(envBenchmarkGate)
+	if mode == "" {
+		t.Skipf("set %s=true to compare the benchmarks with %s, or %s=update to update it", envBenchmarkGate, baselinePath, envBenchmarkGate)
+	}
+
+	results := make(map[string]Result, len(benchmarks))
+	for _, benchmark := range benchmarks {
+		results[benchmark.Name] = run(benchmark.F)
+		t.Logf("%s: %d ns/op, %d allocs/op", benchmark.Name, results[benchmark.Name].NsPerOp, results[benchmark.Name].AllocsPerOp)
+	}
+
+	if mode == "update" {
+		content, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			t.Fatalf("failed to marshal the benchmark results: %v", err)
+		}
+		if err := os.WriteFile(baselinePath, append(content, '\n'), 0644); err != nil {
+			t.Fatalf("failed to write the benchmark baseline: %v", err)
+		}
+		return
+	}
+
+	baseline, err := load(baselinePath)
+	if err != nil {
+		t.Fatalf("failed to load the benchmark baseline: %v", err)
+	}
+	tolerance := defaultTolerance
+	if value, ok := os.LookupEnv(envBenchmarkGateTolerance); ok {
+		if tolerance, err = strconv.ParseFloat(value, 64); err != nil {
+			t.Fatalf("invalid %s %q: %v", envBenchmarkGateTolerance, value, err)
+		}
+	}
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		expected, found := baseline[name]
+		if !found {
+			t.Errorf("%s has no baseline, run the test with %s=update", name, envBenchmarkGate)
+			continue
+		}
+		if err := Compare(expected, results[name], tolerance); err != nil {
+			t.Errorf("%s regressed: %v", name, err)
+		}
+	}
+}
+
+// Compare returns an error if the result exceeds the baseline by more than the tolerance, a fraction of the baseline
+func Compare(baseline, result Result, tolerance float64) error {
+	if float64(result.NsPerOp) > float64(baseline.NsPerOp)*(1+tolerance) {
+		return fmt.Errorf("%d ns/op, baseline %d ns/op", result.NsPerOp, baseline.NsPerOp)
+	}
+	// A single allocation more is not a regression of benchmarks that allocate little
+	if float64(result.AllocsPerOp) > float64(baseline.AllocsPerOp)*(1+tolerance)+1 {
+		return fmt.Errorf("%d allocs/op, baseline %d allocs/op", result.AllocsPerOp, baseline.AllocsPerOp)
+	}
+	return nil
+}
+
+func run(f func(b *testing.B)) Result {
+	var best Result
+	for i := 0; i < runs; i++ {
+		r := testing.Benchmark(f)
+		if i == 0 || r.NsPerOp() < best.NsPerOp {
+			best.NsPerOp = r.NsPerOp()
+		}
+		if i == 0 || r.AllocsPerOp() < best.AllocsPerOp {
+			best.AllocsPerOp = r.AllocsPerOp()
+		}
+	}
+	return best
+}
+
+func load(path string) (map[string]Result, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var baseline map[string]Result
+	if err := json.Unmarshal(content, &baseline); err != nil {
+		return nil, err
+	}
+	return baseline, nil
+}
@@ -0,0 +1,54 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package benchgate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	baseline := Result{NsPerOp: 1000, AllocsPerOp: 10}
+	assert.NoError(t, Compare(baseline, Result{NsPerOp: 1400, AllocsPerOp: 15}, 0.5))
+	assert.NoError(t, Compare(baseline, Result{NsPerOp: 500, AllocsPerOp: 2}, 0.5))
+	assert.Error(t, Compare(baseline, Result{NsPerOp: 1600, AllocsPerOp: 10}, 0.5))
+	assert.Error(t, Compare(baseline, Result{NsPerOp: 1000, AllocsPerOp: 17}, 0.5))
+	assert.NoError(t, Compare(Result{NsPerOp: 1000}, Result{NsPerOp: 1000, AllocsPerOp: 1}, 0))
+}
+
+func TestCheckUpdate(t *testing.T) {
+	baselinePath := filepath.Join(t.TempDir(), "baseline.json")
+	t.Setenv(envBenchmarkGate, "update")
+	Check(t, baselinePath, []Benchmark{{Name: "Noop", F: func(b *testing.B) {}}})
+
+	baseline, err := load(baselinePath)
+	require.NoError(t, err)
+	assert.Contains(t, baseline, "Noop")
+
+	t.Setenv(envBenchmarkGate, "true")
+	Check(t, baselinePath, []Benchmark{{Name: "Noop", F: func(b *testing.B) {}}})
+}
+
+func TestCheckSkipped(t *testing.T) {
+	os.Unsetenv(envBenchmarkGate)
+	ran := false
+	t.Run("gate", func(t *testing.T) {
+		Check(t, "missing.json", []Benchmark{{Name: "Noop", F: func(b *testing.B) { ran = true }}})
+	})
+	assert.False(t, ran)
+}
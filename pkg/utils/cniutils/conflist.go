@@ -0,0 +1,62 @@
+package cniutils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// ConflistChecksumKey is the top level conflist field holding the checksum of the rest of the conflist
+const ConflistChecksumKey = "awsVpcCniChecksum"
+
+// conflistChecksum returns the checksum of conflist without its checksum field. The conflist is re-encoded first,
+// so that formatting and key order do not change the checksum.
+func conflistChecksum(conflist map[string]interface{}) (string, error) {
+	withoutChecksum := make(map[string]interface{}, len(conflist))
+	for k, v := range conflist {
+		if k != ConflistChecksumKey {
+			withoutChecksum[k] = v
+		}
+	}
+	canonical, err := json.Marshal(withoutChecksum)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AddConflistChecksum returns conflist with its checksum embedded
+func AddConflistChecksum(conflist []byte) ([]byte, error) {
+	var data map[string]interface{}
+	if err := json.Unmarshal(conflist, &data); err != nil {
+		return nil, fmt.Errorf("failed to parse conflist: %v", err)
+	}
+	checksum, err := conflistChecksum(data)
+	if err != nil {
+		return nil, err
+	}
+	data[ConflistChecksumKey] = checksum
+	return json.MarshalIndent(data, "", "  ")
+}
+
+// VerifyConflistChecksum returns an error if conflist has no checksum, or was modified after its checksum was embedded
+func VerifyConflistChecksum(conflist []byte) error {
+	var data map[string]interface{}
+	if err := json.Unmarshal(conflist, &data); err != nil {
+		return fmt.Errorf("failed to parse conflist: %v", err)
+	}
+	embedded, ok := data[ConflistChecksumKey].(string)
+	if !ok {
+		return fmt.Errorf("conflist has no %s field", ConflistChecksumKey)
+	}
+	checksum, err := conflistChecksum(data)
+	if err != nil {
+		return err
+	}
+	if checksum != embedded {
+		return fmt.Errorf("conflist checksum %s does not match embedded checksum %s", checksum, embedded)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package cniutils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConflistChecksum(t *testing.T) {
+	conflist := `{"cniVersion":"0.4.0","name":"aws-cni","plugins":[{"name":"aws-cni","type":"aws-cni","mtu":"9001"}]}`
+
+	// A conflist without a checksum fails verification
+	assert.Error(t, VerifyConflistChecksum([]byte(conflist)))
+
+	withChecksum, err := AddConflistChecksum([]byte(conflist))
+	assert.NoError(t, err)
+	assert.Contains(t, string(withChecksum), ConflistChecksumKey)
+	assert.NoError(t, VerifyConflistChecksum(withChecksum))
+
+	// Embedding a checksum again does not change it
+	again, err := AddConflistChecksum(withChecksum)
+	assert.NoError(t, err)
+	assert.Equal(t, string(withChecksum), string(again))
+
+	// Formatting changes are not drift
+	assert.NoError(t, VerifyConflistChecksum([]byte(strings.ReplaceAll(string(withChecksum), "\n", ""))))
+
+	// Content changes are drift
+	assert.Error(t, VerifyConflistChecksum([]byte(strings.Replace(string(withChecksum), `"9001"`, `"1500"`, 1))))
+
+	_, err = AddConflistChecksum([]byte("not json"))
+	assert.Error(t, err)
+}
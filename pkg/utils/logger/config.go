@@ -15,6 +15,7 @@ package logger
 
 import (
 	"os"
+	"strings"
 )
 
 const (
@@ -22,22 +23,55 @@ const (
 	defaultLogLevel    = "Debug"
 	envLogLevel        = "AWS_VPC_K8S_CNI_LOGLEVEL"
 	envLogFilePath     = "AWS_VPC_K8S_CNI_LOG_FILE"
+	// envComponentLogLevels overrides the log level per component, e.g. "rpc=debug,awsutils=warn"
+	envComponentLogLevels = "AWS_VPC_K8S_CNI_COMPONENT_LOGLEVELS"
+	// envLogSampling enables sampling of repeated log messages
+	envLogSampling = "AWS_VPC_K8S_CNI_LOG_SAMPLING"
+	// envLogDedup enables the suppression of repeated warnings and errors, with a summary of their count
+	envLogDedup = "AWS_VPC_K8S_CNI_LOG_DEDUP"
 )
 
 // Configuration stores the config for the logger
 type Configuration struct {
 	LogLevel    string
 	LogLocation string
+	// ComponentLogLevels maps a component name, as passed to GetComponent, to the log level it uses instead of LogLevel
+	ComponentLogLevels map[string]string
+	// Sampling limits how often an identical message is logged per second
+	Sampling bool
+	// Dedup logs identical warnings and errors once per interval, followed by the number of repeats
+	Dedup bool
+	// MaxSizeMB, MaxBackups and MaxAgeDays control rotation of file logs. Zero means the default, and
+	// LogRotationUnlimited keeps all the backups or keeps them regardless of their age.
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
 }
 
 // LoadLogConfig returns the log configuration
 func LoadLogConfig() *Configuration {
 	return &Configuration{
-		LogLevel:    GetLogLevel(),
-		LogLocation: GetLogLocation(),
+		LogLevel:           GetLogLevel(),
+		LogLocation:        GetLogLocation(),
+		ComponentLogLevels: GetComponentLogLevels(),
+		Sampling:           strings.ToLower(os.Getenv(envLogSampling)) == "true",
+		Dedup:              strings.ToLower(os.Getenv(envLogDedup)) == "true",
 	}
 }
 
+// GetComponentLogLevels returns the per-component log levels
+func GetComponentLogLevels() map[string]string {
+	componentLogLevels := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv(envComponentLogLevels), ",") {
+		component, level, found := strings.Cut(strings.TrimSpace(entry), "=")
+		if !found || component == "" || level == "" {
+			continue
+		}
+		componentLogLevels[component] = level
+	}
+	return componentLogLevels
+}
+
 // GetLogLocation returns the log file path
 func GetLogLocation() string {
 	logFilePath := os.Getenv(envLogFilePath)
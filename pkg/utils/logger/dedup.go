@@ -0,0 +1,155 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package logger
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// logDedupInterval is how long the repeats of a warning or error are suppressed after it is logged, a summary line
+	// then gives their count
+	logDedupInterval = time.Minute
+	// maxLogDedupMessages bounds the distinct messages tracked, the messages past it are logged as they come
+	maxLogDedupMessages = 1000
+)
+
+// volatileFields match the parts of a message that change on every repeat of the same failure, the request IDs of the
+// AWS APIs, other UUIDs and timestamps
+var volatileFields = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)(request[ _-]?id)(\s*[:=]\s*|\s+)[\w-]+`), "${1}${2}*"},
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "*"},
+	{regexp.MustCompile(`\b\d{4}-\d{2}-\d{2}[T ]\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?`), "*"},
+}
+
+type dedupKey struct {
+	level   zapcore.Level
+	message string
+}
+
+// newDedupKey returns the key of a message, without its volatile fields so that its repeats are suppressed too
+func newDedupKey(level zapcore.Level, message string) dedupKey {
+	for _, field := range volatileFields {
+		message = field.pattern.ReplaceAllString(message, field.replacement)
+	}
+	return dedupKey{level: level, message: message}
+}
+
+// dedupEntry tracks a message logged in the current interval, and the core to write its summary to
+type dedupEntry struct {
+	entry      zapcore.Entry
+	core       zapcore.Core
+	suppressed int
+}
+
+// dedupState is shared by a dedupCore and the cores derived from it with With
+type dedupState struct {
+	lock     sync.Mutex
+	interval time.Duration
+	entries  map[dedupKey]*dedupEntry
+}
+
+// dedupCore logs the first of identical warnings and errors, and the number of repeats once the interval is over.
+// Entries below the warn level are written as they come.
+type dedupCore struct {
+	zapcore.Core
+	state *dedupState
+}
+
+func newDedupCore(core zapcore.Core, interval time.Duration) *dedupCore {
+	return &dedupCore{
+		Core:  core,
+		state: &dedupState{interval: interval, entries: make(map[dedupKey]*dedupEntry)},
+	}
+}
+
+func (c *dedupCore) With(fields []zapcore.Field) zapcore.Core {
+	return &dedupCore{Core: c.Core.With(fields), state: c.state}
+}
+
+func (c *dedupCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *dedupCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Level < zapcore.WarnLevel {
+		return c.Core.Write(ent, fields)
+	}
+	key := newDedupKey(ent.Level, ent.Message)
+	c.state.lock.Lock()
+	tracked, ok := c.state.entries[key]
+	if ok && ent.Time.Sub(tracked.entry.Time) < c.state.interval {
+		tracked.suppressed++
+		c.state.lock.Unlock()
+		return nil
+	}
+	if ok || len(c.state.entries) < maxLogDedupMessages {
+		c.state.entries[key] = &dedupEntry{entry: ent, core: c.Core}
+	}
+	c.state.lock.Unlock()
+
+	// The repeats of the previous interval are summed up before the message starts a new one
+	if ok && tracked.suppressed > 0 {
+		tracked.writeSummary(c.state.interval)
+	}
+	return c.Core.Write(ent, fields)
+}
+
+// flush writes the summaries of the messages whose interval is over at now, and stops tracking them
+func (s *dedupState) flush(now time.Time) {
+	var done []*dedupEntry
+	s.lock.Lock()
+	for key, tracked := range s.entries {
+		if now.Sub(tracked.entry.Time) >= s.interval {
+			done = append(done, tracked)
+			delete(s.entries, key)
+		}
+	}
+	s.lock.Unlock()
+
+	for _, tracked := range done {
+		if tracked.suppressed > 0 {
+			tracked.writeSummary(s.interval)
+		}
+	}
+}
+
+// run flushes the summaries periodically, so that they are written when the message is not logged again
+func (s *dedupState) run() {
+	ticker := time.NewTicker(s.interval / 4)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.flush(now)
+	}
+}
+
+func (e *dedupEntry) writeSummary(interval time.Duration) {
+	summary := e.entry
+	summary.Time = time.Now()
+	summary.Message = fmt.Sprintf("Repeated %d more times in %s: %s", e.suppressed, interval, e.entry.Message)
+	summary.Stack = ""
+	_ = e.core.Write(summary, []zapcore.Field{zap.Int("suppressed", e.suppressed)})
+}
@@ -14,6 +14,18 @@
 // Package logger is the CNI Logger interface, using zap
 package logger
 
+import (
+	"crypto/rand"
+	"encoding/hex"
+)
+
+const (
+	// TraceIDKey is the log field holding the ID that correlates the entries of a single CNI request across components
+	TraceIDKey = "traceID"
+	// TraceIDMetadataKey is the gRPC metadata key used to pass the trace ID from the CNI plugin to ipamd
+	TraceIDMetadataKey = "x-trace-id"
+)
+
 // Log is global variable so that log functions can be directly accessed
 var log Logger
 
@@ -55,6 +67,31 @@ func Get() Logger {
 	return log
 }
 
+// GetComponent returns the default logger for a component, e.g. "rpc" or "awsutils". Entries are tagged with
+// the component name, and use the component's log level if one is configured.
+func GetComponent(component string) Logger {
+	baseLog := Get()
+	if sl, ok := baseLog.(*structuredLogger); ok {
+		return sl.component(component)
+	}
+	return baseLog.WithFields(Fields{"component": component})
+}
+
+// ShedDebugLogs stops or resumes writing debug entries, whatever the configured log levels, so that a daemon running
+// short of memory or CPU does not spend it on verbose logs
+func ShedDebugLogs(shed bool) {
+	debugLogsShed.Store(shed)
+}
+
+// NewTraceID returns a random ID to correlate the log entries of a single request
+func NewTraceID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
 // New logger initializes logger
 func New(inputLogConfig *Configuration) Logger {
 	log = inputLogConfig.newZapLogger()
@@ -15,10 +15,15 @@ package logger
 
 import (
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
@@ -78,13 +83,13 @@ func TestLogLevelReturnsDefaultLevelWhenEnvSetToInvalidValue(t *testing.T) {
 func TestGetPluginLogFilePathEmpty(t *testing.T) {
 	expectedWriter := zapcore.Lock(os.Stderr)
 	inputPluginLogFile := ""
-	assert.Equal(t, expectedWriter, getPluginLogFilePath(inputPluginLogFile))
+	assert.Equal(t, expectedWriter, getPluginLogFilePath(inputPluginLogFile, 0, 0, 0))
 }
 
 func TestGetPluginLogFilePathStdout(t *testing.T) {
 	expectedWriter := zapcore.Lock(os.Stdout)
 	inputPluginLogFile := "stdout"
-	assert.Equal(t, expectedWriter, getPluginLogFilePath(inputPluginLogFile))
+	assert.Equal(t, expectedWriter, getPluginLogFilePath(inputPluginLogFile, 0, 0, 0))
 }
 
 func TestGetPluginLogFilePath(t *testing.T) {
@@ -96,5 +101,190 @@ func TestGetPluginLogFilePath(t *testing.T) {
 		MaxAge:     30,
 		Compress:   true,
 	}
-	assert.Equal(t, zapcore.AddSync(expectedLumberJackLogger), getPluginLogFilePath(inputPluginLogFile))
+	assert.Equal(t, zapcore.AddSync(expectedLumberJackLogger), getPluginLogFilePath(inputPluginLogFile, 0, 0, 0))
+}
+
+func TestGetPluginLogFilePathWithRotation(t *testing.T) {
+	inputPluginLogFile := "/var/log/aws-routed-eni/plugin.log"
+	expectedLumberJackLogger := &lumberjack.Logger{
+		Filename:   "/var/log/aws-routed-eni/plugin.log",
+		MaxSize:    10,
+		MaxBackups: 2,
+		MaxAge:     7,
+		Compress:   true,
+	}
+	assert.Equal(t, zapcore.AddSync(expectedLumberJackLogger), getPluginLogFilePath(inputPluginLogFile, 10, 2, 7))
+}
+
+func TestGetPluginLogFilePathUnlimitedRotation(t *testing.T) {
+	inputPluginLogFile := "/var/log/aws-routed-eni/plugin.log"
+	expectedLumberJackLogger := &lumberjack.Logger{
+		Filename: "/var/log/aws-routed-eni/plugin.log",
+		MaxSize:  100,
+		Compress: true,
+	}
+	assert.Equal(t, zapcore.AddSync(expectedLumberJackLogger),
+		getPluginLogFilePath(inputPluginLogFile, LogRotationUnlimited, LogRotationUnlimited, LogRotationUnlimited))
+}
+
+func TestGetComponentLogLevels(t *testing.T) {
+	_ = os.Setenv(envComponentLogLevels, "rpc=info, awsutils=warn,invalid,=debug")
+	defer os.Unsetenv(envComponentLogLevels)
+
+	assert.Equal(t, map[string]string{"rpc": "info", "awsutils": "warn"}, GetComponentLogLevels())
+}
+
+func TestComponentLogLevels(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	logConfig := &Configuration{
+		LogLevel:           "info",
+		LogLocation:        logFile,
+		ComponentLogLevels: map[string]string{"rpc": "debug", "awsutils": "error"},
+	}
+	baseLog := logConfig.newZapLogger()
+	baseLog.Debug("base debug")
+	baseLog.Info("base info")
+	rpcLog := baseLog.component("rpc")
+	rpcLog.Debug("rpc debug")
+	awsutilsLog := baseLog.component("awsutils")
+	awsutilsLog.Warn("awsutils warn")
+	awsutilsLog.Error("awsutils error")
+	baseLog.component("ipamd").Info("ipamd info")
+
+	content, err := os.ReadFile(logFile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "base debug")
+	assert.Contains(t, string(content), "base info")
+	assert.Contains(t, string(content), `"component":"rpc"`)
+	assert.Contains(t, string(content), "rpc debug")
+	assert.NotContains(t, string(content), "awsutils warn")
+	assert.Contains(t, string(content), "awsutils error")
+	assert.Contains(t, string(content), `"component":"ipamd"`)
+}
+
+func TestLogSampling(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	logConfig := &Configuration{
+		LogLevel:    "info",
+		LogLocation: logFile,
+		Sampling:    true,
+	}
+	log := logConfig.newZapLogger()
+	for i := 0; i < logSamplingInitial+logSamplingThereafter; i++ {
+		log.Info("repeated message")
+	}
+
+	content, err := os.ReadFile(logFile)
+	assert.NoError(t, err)
+	assert.Equal(t, logSamplingInitial+1, strings.Count(string(content), "repeated message"))
+}
+
+func TestShedDebugLogs(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	logConfig := &Configuration{
+		LogLevel:    "debug",
+		LogLocation: logFile,
+	}
+	log := logConfig.newZapLogger()
+	ShedDebugLogs(true)
+	log.Debug("shed debug")
+	log.Info("shed info")
+	ShedDebugLogs(false)
+	log.Debug("resumed debug")
+
+	content, err := os.ReadFile(logFile)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(content), "shed debug")
+	assert.Contains(t, string(content), "shed info")
+	assert.Contains(t, string(content), "resumed debug")
+}
+
+func TestLogDedup(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "test.log")
+	logConfig := &Configuration{
+		LogLevel:    "info",
+		LogLocation: logFile,
+		Dedup:       true,
+	}
+	log := logConfig.newZapLogger()
+	for i := 0; i < 5; i++ {
+		log.Errorf("repeated error")
+		log.Info("repeated info")
+	}
+
+	content, err := os.ReadFile(logFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(string(content), "repeated error"))
+	assert.Equal(t, 5, strings.Count(string(content), "repeated info"))
+}
+
+func TestLogDedupSummary(t *testing.T) {
+	observed, logs := observer.New(zapcore.InfoLevel)
+	core := newDedupCore(observed, time.Minute)
+	start := time.Now()
+	write := func(level zapcore.Level, message string, at time.Time) {
+		ent := zapcore.Entry{Level: level, Message: message, Time: at}
+		if ce := core.Check(ent, nil); ce != nil {
+			ce.Write()
+		}
+	}
+
+	write(zapcore.WarnLevel, "throttled", start)
+	write(zapcore.WarnLevel, "throttled", start.Add(time.Second))
+	write(zapcore.WarnLevel, "throttled", start.Add(2*time.Second))
+	write(zapcore.ErrorLevel, "throttled", start.Add(2*time.Second))
+	assert.Equal(t, []string{"throttled", "throttled"}, messages(logs.TakeAll()))
+
+	// The repeats are summed up once the interval is over
+	core.state.flush(start.Add(time.Minute))
+	summaries := logs.TakeAll()
+	require.Len(t, summaries, 1)
+	assert.Equal(t, "Repeated 2 more times in 1m0s: throttled", summaries[0].Message)
+	assert.Equal(t, zapcore.WarnLevel, summaries[0].Level)
+	assert.Equal(t, int64(2), summaries[0].ContextMap()["suppressed"])
+
+	// Or when the message comes again after the interval, before it is flushed
+	write(zapcore.ErrorLevel, "throttled", start.Add(3*time.Second))
+	write(zapcore.ErrorLevel, "throttled", start.Add(2*time.Minute))
+	assert.Equal(t, []string{"Repeated 1 more times in 1m0s: throttled", "throttled"}, messages(logs.TakeAll()))
+}
+
+func TestLogDedupVolatileFields(t *testing.T) {
+	observed, logs := observer.New(zapcore.InfoLevel)
+	core := newDedupCore(observed, time.Minute)
+	start := time.Now()
+	write := func(message string, at time.Time) {
+		ent := zapcore.Entry{Level: zapcore.WarnLevel, Message: message, Time: at}
+		if ce := core.Check(ent, nil); ce != nil {
+			ce.Write()
+		}
+	}
+
+	// Two throttles that only differ by their request ID are the same message
+	first := "Failed to allocate a secondary IP: RequestLimitExceeded: Request limit exceeded.\n\tstatus code: 503, request id: 6b1f2e0c-4d1a-4f6e-9a0b-1c2d3e4f5a6b"
+	second := "Failed to allocate a secondary IP: RequestLimitExceeded: Request limit exceeded.\n\tstatus code: 503, request id: 0a9b8c7d-6e5f-4a3b-2c1d-0e9f8a7b6c5d"
+	write(first, start)
+	write(second, start.Add(time.Second))
+	assert.Equal(t, []string{first}, messages(logs.TakeAll()))
+	core.state.flush(start.Add(time.Minute))
+	assert.Equal(t, []string{"Repeated 1 more times in 1m0s: " + first}, messages(logs.TakeAll()))
+
+	// So are the other request ID formats, UUIDs and timestamps
+	for _, pair := range [][2]string{
+		{"api error Throttling: Rate exceeded, RequestID: ABCD1234", "api error Throttling: Rate exceeded, RequestID: EFGH5678"},
+		{"pod sandbox 3f1a2b3c-0000-1111-2222-333344445555 not found", "pod sandbox 9e8d7c6b-aaaa-bbbb-cccc-ddddeeeeffff not found"},
+		{"token expired at 2026-10-15T06:21:07Z", "token expired at 2026-10-15T06:22:09.5Z"},
+	} {
+		assert.Equal(t, newDedupKey(zapcore.WarnLevel, pair[0]), newDedupKey(zapcore.WarnLevel, pair[1]), pair[0])
+	}
+	// Other differences are kept
+	assert.NotEqual(t, newDedupKey(zapcore.WarnLevel, "failed to attach eni-1"), newDedupKey(zapcore.WarnLevel, "failed to attach eni-2"))
+}
+
+func messages(entries []observer.LoggedEntry) []string {
+	var msgs []string
+	for _, entry := range entries {
+		msgs = append(msgs, entry.Message)
+	}
+	return msgs
 }
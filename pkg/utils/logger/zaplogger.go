@@ -17,14 +17,47 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+const (
+	// With sampling enabled, the first logSamplingInitial entries with the same level and message are logged
+	// every second, then only every logSamplingThereafter-th one
+	logSamplingInitial    = 100
+	logSamplingThereafter = 100
+
+	// Defaults for rotation of file logs
+	defaultLogMaxSizeMB  = 100
+	defaultLogMaxBackups = 5
+	defaultLogMaxAgeDays = 30
+)
+
+// LogRotationUnlimited removes the limit on the number or the age of rotated log files
+const LogRotationUnlimited = -1
+
+// debugLogsShed drops debug entries of all loggers while set, see ShedDebugLogs
+var debugLogsShed atomic.Bool
+
+// levelEnabler enables the entries at or above its level, except debug entries while they are shed
+type levelEnabler zapcore.Level
+
+func (l levelEnabler) Enabled(level zapcore.Level) bool {
+	if level < zapcore.InfoLevel && debugLogsShed.Load() {
+		return false
+	}
+	return zapcore.Level(l).Enabled(level)
+}
+
 type structuredLogger struct {
 	zapLogger *zap.SugaredLogger
+	// root logs at the lowest configured level, component loggers are derived from it
+	root            *zap.Logger
+	componentLevels map[string]zapcore.Level
 }
 
 // getZapLevel converts log level string to zapcore.Level
@@ -94,7 +127,17 @@ func (logf *structuredLogger) WithFields(fields Fields) Logger {
 		f = append(f, v)
 	}
 	newLogger := logf.zapLogger.With(f...)
-	return &structuredLogger{newLogger}
+	return &structuredLogger{zapLogger: newLogger, root: logf.root, componentLevels: logf.componentLevels}
+}
+
+// component returns a logger tagged with the component name, at the component's level if one is configured
+func (logf *structuredLogger) component(name string) Logger {
+	level, ok := logf.componentLevels[name]
+	if !ok || logf.root == nil {
+		return logf.WithFields(Fields{"component": name})
+	}
+	componentLogger := logf.root.WithOptions(zap.IncreaseLevel(level)).Sugar().With("component", name)
+	return &structuredLogger{zapLogger: componentLogger, root: logf.root, componentLevels: logf.componentLevels}
 }
 
 func getEncoder() zapcore.Encoder {
@@ -108,26 +151,49 @@ func (logConfig *Configuration) newZapLogger() *structuredLogger {
 
 	logLevel := getZapLevel(logConfig.LogLevel)
 
-	writer := getPluginLogFilePath(logConfig.LogLocation)
+	// The core has to accept the most verbose of all levels, loggers then raise it to their own level
+	minLevel := logLevel
+	componentLevels := make(map[string]zapcore.Level, len(logConfig.ComponentLogLevels))
+	for component, componentLogLevel := range logConfig.ComponentLogLevels {
+		componentLevels[component] = getZapLevel(componentLogLevel)
+		if componentLevels[component] < minLevel {
+			minLevel = componentLevels[component]
+		}
+	}
+
+	writer := getPluginLogFilePath(logConfig.LogLocation, logConfig.MaxSizeMB, logConfig.MaxBackups, logConfig.MaxAgeDays)
 
-	cores = append(cores, zapcore.NewCore(getEncoder(), writer, logLevel))
+	cores = append(cores, zapcore.NewCore(getEncoder(), writer, levelEnabler(minLevel)))
 
-	combinedCore := zapcore.NewTee(cores...)
+	var combinedCore zapcore.Core = zapcore.NewTee(cores...)
+	if logConfig.Dedup {
+		// Under the sampler, which makes its decisions in Check
+		dedup := newDedupCore(combinedCore, logDedupInterval)
+		go dedup.state.run()
+		combinedCore = dedup
+	}
+	if logConfig.Sampling {
+		combinedCore = zapcore.NewSamplerWithOptions(combinedCore, time.Second, logSamplingInitial, logSamplingThereafter)
+	}
 
-	logger := zap.New(combinedCore,
+	root := zap.New(combinedCore,
 		zap.AddCaller(),
 		zap.AddCallerSkip(2),
 	)
+	logger := root.WithOptions(zap.IncreaseLevel(logLevel))
 	defer logger.Sync()
 	sugar := logger.Sugar()
 
 	return &structuredLogger{
-		zapLogger: sugar,
+		zapLogger:       sugar,
+		root:            root,
+		componentLevels: componentLevels,
 	}
 }
 
-// getPluginLogFilePath returns the writer
-func getPluginLogFilePath(logFilePath string) zapcore.WriteSyncer {
+// getPluginLogFilePath returns the writer. Files are rotated once they reach maxSizeMB, keeping at most maxBackups
+// rotated files for maxAgeDays; zero values use the defaults.
+func getPluginLogFilePath(logFilePath string, maxSizeMB, maxBackups, maxAgeDays int) zapcore.WriteSyncer {
 	var writer zapcore.WriteSyncer
 
 	// When path is explicitly empty, write to stderr
@@ -136,23 +202,39 @@ func getPluginLogFilePath(logFilePath string) zapcore.WriteSyncer {
 	} else if strings.ToLower(logFilePath) == "stdout" {
 		writer = zapcore.Lock(os.Stdout)
 	} else {
-		writer = getLogWriter(logFilePath)
+		writer = getLogWriter(logFilePath, maxSizeMB, maxBackups, maxAgeDays)
 	}
 	return writer
 }
 
 // getLogWriter is for lumberjack
-func getLogWriter(logFilePath string) zapcore.WriteSyncer {
+func getLogWriter(logFilePath string, maxSizeMB, maxBackups, maxAgeDays int) zapcore.WriteSyncer {
+	if maxSizeMB <= 0 {
+		maxSizeMB = defaultLogMaxSizeMB
+	}
+	// lumberjack keeps all the backups and ignores their age when the limits are zero
+	maxBackups = rotationLimit(maxBackups, defaultLogMaxBackups)
+	maxAgeDays = rotationLimit(maxAgeDays, defaultLogMaxAgeDays)
 	lumberJackLogger := &lumberjack.Logger{
 		Filename:   logFilePath,
-		MaxSize:    100,
-		MaxBackups: 5,
-		MaxAge:     30,
+		MaxSize:    maxSizeMB,
+		MaxBackups: maxBackups,
+		MaxAge:     maxAgeDays,
 		Compress:   true,
 	}
 	return zapcore.AddSync(lumberJackLogger)
 }
 
+func rotationLimit(limit, defaultLimit int) int {
+	switch {
+	case limit == LogRotationUnlimited:
+		return 0
+	case limit <= 0:
+		return defaultLimit
+	}
+	return limit
+}
+
 // DefaultLogger creates and returns a new default logger.
 func DefaultLogger() Logger {
 	productionConfig := zap.NewProductionConfig()
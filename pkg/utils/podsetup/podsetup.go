@@ -0,0 +1,86 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package podsetup names the phases of the network setup of a pod, which the CNI plugin times and ipamd exports as
+// metrics
+package podsetup
+
+import (
+	"time"
+)
+
+const (
+	// PhaseIpamdWait is the time the CNI plugin waits for ipamd to assign an IP, from the AddNetwork call or the IP
+	// lease file
+	PhaseIpamdWait = "ipamd_wait"
+	// PhaseEC2Allocate is the part of PhaseIpamdWait spent waiting for IPs to be allocated from EC2, in on-demand mode
+	PhaseEC2Allocate = "ec2_allocate"
+	// PhaseLinkSetup is the creation of the veth pair, and of the VLAN for branch ENI pods
+	PhaseLinkSetup = "link_setup"
+	// PhaseRouteRuleProgramming is the programming of the routes and rules of the pod
+	PhaseRouteRuleProgramming = "route_rule_programming"
+	// PhasePolicyHandoff is the time the network policy agent takes to enforce the policies of the pod in strict mode
+	PhasePolicyHandoff = "policy_handoff"
+)
+
+// Phases lists the phases in the order of the pod setup
+var Phases = []string{PhaseIpamdWait, PhaseEC2Allocate, PhaseLinkSetup, PhaseRouteRuleProgramming, PhasePolicyHandoff}
+
+// IsPhase returns whether name is one of the phases, so that the reports of the CNI plugin cannot add labels
+func IsPhase(name string) bool {
+	for _, phase := range Phases {
+		if phase == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Timer records the durations of the phases of a pod setup. The methods of a nil Timer do nothing, so that the
+// callers that do not time the setup pass nil.
+type Timer struct {
+	start     time.Time
+	durations map[string]time.Duration
+}
+
+// NewTimer starts timing a pod setup
+func NewTimer() *Timer {
+	return &Timer{
+		start:     time.Now(),
+		durations: map[string]time.Duration{},
+	}
+}
+
+// Observe adds the time since start to the phase
+func (t *Timer) Observe(phase string, start time.Time) {
+	if t == nil {
+		return
+	}
+	t.durations[phase] += time.Since(start)
+}
+
+// Durations returns the durations of the phases that were observed
+func (t *Timer) Durations() map[string]time.Duration {
+	if t == nil {
+		return nil
+	}
+	return t.durations
+}
+
+// Elapsed returns the time since the setup started
+func (t *Timer) Elapsed() time.Duration {
+	if t == nil {
+		return 0
+	}
+	return time.Since(t.start)
+}
@@ -0,0 +1,74 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package podsetup
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTimer(t *testing.T) {
+	timer := NewTimer()
+	start := time.Now().Add(-time.Second)
+	timer.Observe(PhaseLinkSetup, start)
+	timer.Observe(PhaseLinkSetup, start)
+
+	durations := timer.Durations()
+	assert.Len(t, durations, 1)
+	assert.GreaterOrEqual(t, durations[PhaseLinkSetup], 2*time.Second)
+	assert.Greater(t, timer.Elapsed(), time.Duration(0))
+}
+
+func TestNilTimer(t *testing.T) {
+	var timer *Timer
+	timer.Observe(PhaseLinkSetup, time.Now())
+	assert.Nil(t, timer.Durations())
+	assert.Equal(t, time.Duration(0), timer.Elapsed())
+}
+
+func TestIsPhase(t *testing.T) {
+	assert.True(t, IsPhase(PhasePolicyHandoff))
+	assert.False(t, IsPhase("total"))
+}
+
+func TestReports(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "reports")
+	timer := NewTimer()
+	timer.Observe(PhaseLinkSetup, time.Now().Add(-time.Second))
+
+	// A retried ADD replaces its report
+	require.NoError(t, WriteReport(dir, NewReport("container1", "eth0", "aws-cni", "trace1", timer)))
+	require.NoError(t, WriteReport(dir, NewReport("container1", "eth0", "aws-cni", "trace2", timer)))
+	require.NoError(t, WriteReport(dir, NewReport("container2", "eth0", "aws-cni", "trace3", timer)))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.json"), []byte("{"), 0600))
+
+	reports := map[string]Report{}
+	drained, errs := DrainReports(dir, func(report Report) {
+		reports[report.ContainerID] = report
+	})
+	assert.Equal(t, 2, drained)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "trace2", reports["container1"].TraceID)
+	assert.GreaterOrEqual(t, reports["container2"].Phases[PhaseLinkSetup], 1.0)
+
+	// The reports, including the invalid one, are drained once
+	drained, errs = DrainReports(dir, func(Report) {})
+	assert.Equal(t, 0, drained)
+	assert.Empty(t, errs)
+}
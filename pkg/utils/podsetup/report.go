@@ -0,0 +1,145 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package podsetup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultReportPath is the directory where the CNI plugin leaves its reports for ipamd, so that the ADD does not wait
+// for ipamd once the pod is set up. /var/run/aws-node is shared by the aws-node containers and the host.
+const DefaultReportPath = "/var/run/aws-node/pod-setup-reports"
+
+const (
+	reportSuffix    = ".json"
+	reportTmpPrefix = ".tmp-"
+	// staleReportTmpAge is the age after which a file that was never renamed is left by a plugin that died
+	staleReportTmpAge = time.Minute
+)
+
+// Report is the timing of a pod setup, written by the CNI plugin and read by ipamd
+type Report struct {
+	ContainerID     string             `json:"containerID"`
+	IfName          string             `json:"ifName"`
+	NetworkName     string             `json:"networkName"`
+	TraceID         string             `json:"traceID"`
+	DurationSeconds float64            `json:"durationSeconds"`
+	Phases          map[string]float64 `json:"phases"`
+}
+
+// NewReport returns the report of the setup timed by t
+func NewReport(containerID, ifName, networkName, traceID string, t *Timer) Report {
+	report := Report{
+		ContainerID:     containerID,
+		IfName:          ifName,
+		NetworkName:     networkName,
+		TraceID:         traceID,
+		DurationSeconds: t.Elapsed().Seconds(),
+		Phases:          map[string]float64{},
+	}
+	for phase, duration := range t.Durations() {
+		report.Phases[phase] = duration.Seconds()
+	}
+	return report
+}
+
+func (r Report) fileName() string {
+	sum := sha256.Sum256([]byte(r.NetworkName + "/" + r.ContainerID + "/" + r.IfName))
+	return hex.EncodeToString(sum[:16]) + reportSuffix
+}
+
+// WriteReport leaves a report in dir. The file is written next to its final name then renamed, so that ipamd never
+// reads a partial report. A retried ADD replaces the report of the previous attempt.
+func WriteReport(dir string, report Report) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.Wrapf(err, "podsetup: failed to create %s", dir)
+	}
+	data, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, report.fileName())
+	tmp, err := os.CreateTemp(dir, reportTmpPrefix)
+	if err != nil {
+		return errors.Wrapf(err, "podsetup: failed to create a file in %s", dir)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return errors.Wrapf(err, "podsetup: failed to write %s", path)
+	}
+	return nil
+}
+
+// DrainReports calls record for each report in dir and removes it. A report is removed before it is recorded, so that
+// two drains never record it twice. It returns the number of reports recorded and the errors of the others.
+func DrainReports(dir string, record func(Report)) (int, []error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, []error{errors.Wrapf(err, "podsetup: failed to read %s", dir)}
+	}
+	drained := 0
+	var errs []error
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if strings.HasPrefix(entry.Name(), reportTmpPrefix) {
+			// Left by a plugin that died while writing, unless it is still being written
+			if info, err := entry.Info(); err == nil && time.Since(info.ModTime()) > staleReportTmpAge {
+				os.Remove(path)
+			}
+			continue
+		}
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), reportSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, errors.Wrapf(err, "podsetup: failed to read %s", path))
+			}
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			if !os.IsNotExist(err) {
+				errs = append(errs, errors.Wrapf(err, "podsetup: failed to remove %s", path))
+			}
+			continue
+		}
+		var report Report
+		if err := json.Unmarshal(data, &report); err != nil {
+			errs = append(errs, errors.Wrapf(err, "podsetup: dropping invalid report %s", path))
+			continue
+		}
+		record(report)
+		drained++
+	}
+	return drained, errs
+}
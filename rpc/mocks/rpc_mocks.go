@@ -90,6 +90,26 @@ func (mr *MockCNIBackendClientMockRecorder) DelNetwork(arg0, arg1 interface{}, a
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DelNetwork", reflect.TypeOf((*MockCNIBackendClient)(nil).DelNetwork), varargs...)
 }
 
+// ReportPodSetup mocks base method.
+func (m *MockCNIBackendClient) ReportPodSetup(arg0 context.Context, arg1 *rpc.ReportPodSetupRequest, arg2 ...grpc.CallOption) (*rpc.ReportPodSetupReply, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReportPodSetup", varargs...)
+	ret0, _ := ret[0].(*rpc.ReportPodSetupReply)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReportPodSetup indicates an expected call of ReportPodSetup.
+func (mr *MockCNIBackendClientMockRecorder) ReportPodSetup(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReportPodSetup", reflect.TypeOf((*MockCNIBackendClient)(nil).ReportPodSetup), varargs...)
+}
+
 // MockNPBackendClient is a mock of NPBackendClient interface.
 type MockNPBackendClient struct {
 	ctrl     *gomock.Controller
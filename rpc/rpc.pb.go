@@ -33,10 +33,11 @@ type AddNetworkRequest struct {
 	K8S_POD_NAME               string `protobuf:"bytes,1,opt,name=K8S_POD_NAME,json=K8SPODNAME,proto3" json:"K8S_POD_NAME,omitempty"`
 	K8S_POD_NAMESPACE          string `protobuf:"bytes,2,opt,name=K8S_POD_NAMESPACE,json=K8SPODNAMESPACE,proto3" json:"K8S_POD_NAMESPACE,omitempty"`
 	K8S_POD_INFRA_CONTAINER_ID string `protobuf:"bytes,3,opt,name=K8S_POD_INFRA_CONTAINER_ID,json=K8SPODINFRACONTAINERID,proto3" json:"K8S_POD_INFRA_CONTAINER_ID,omitempty"`
+	K8S_POD_UID                string `protobuf:"bytes,9,opt,name=K8S_POD_UID,json=K8SPODUID,proto3" json:"K8S_POD_UID,omitempty"`
 	ContainerID                string `protobuf:"bytes,7,opt,name=ContainerID,proto3" json:"ContainerID,omitempty"`
 	IfName                     string `protobuf:"bytes,5,opt,name=IfName,proto3" json:"IfName,omitempty"`
 	NetworkName                string `protobuf:"bytes,6,opt,name=NetworkName,proto3" json:"NetworkName,omitempty"`
-	Netns                      string `protobuf:"bytes,4,opt,name=Netns,proto3" json:"Netns,omitempty"` // next field: 9
+	Netns                      string `protobuf:"bytes,4,opt,name=Netns,proto3" json:"Netns,omitempty"` // next field: 10
 }
 
 func (x *AddNetworkRequest) Reset() {
@@ -99,6 +100,13 @@ func (x *AddNetworkRequest) GetK8S_POD_INFRA_CONTAINER_ID() string {
 	return ""
 }
 
+func (x *AddNetworkRequest) GetK8S_POD_UID() string {
+	if x != nil {
+		return x.K8S_POD_UID
+	}
+	return ""
+}
+
 func (x *AddNetworkRequest) GetContainerID() string {
 	if x != nil {
 		return x.ContainerID
@@ -272,10 +280,11 @@ type DelNetworkRequest struct {
 	K8S_POD_NAME               string `protobuf:"bytes,1,opt,name=K8S_POD_NAME,json=K8SPODNAME,proto3" json:"K8S_POD_NAME,omitempty"`
 	K8S_POD_NAMESPACE          string `protobuf:"bytes,2,opt,name=K8S_POD_NAMESPACE,json=K8SPODNAMESPACE,proto3" json:"K8S_POD_NAMESPACE,omitempty"`
 	K8S_POD_INFRA_CONTAINER_ID string `protobuf:"bytes,3,opt,name=K8S_POD_INFRA_CONTAINER_ID,json=K8SPODINFRACONTAINERID,proto3" json:"K8S_POD_INFRA_CONTAINER_ID,omitempty"`
+	K8S_POD_UID                string `protobuf:"bytes,10,opt,name=K8S_POD_UID,json=K8SPODUID,proto3" json:"K8S_POD_UID,omitempty"`
 	Reason                     string `protobuf:"bytes,5,opt,name=Reason,proto3" json:"Reason,omitempty"`
 	ContainerID                string `protobuf:"bytes,8,opt,name=ContainerID,proto3" json:"ContainerID,omitempty"`
 	IfName                     string `protobuf:"bytes,6,opt,name=IfName,proto3" json:"IfName,omitempty"`
-	NetworkName                string `protobuf:"bytes,7,opt,name=NetworkName,proto3" json:"NetworkName,omitempty"` // next field: 10
+	NetworkName                string `protobuf:"bytes,7,opt,name=NetworkName,proto3" json:"NetworkName,omitempty"` // next field: 11
 }
 
 func (x *DelNetworkRequest) Reset() {
@@ -338,6 +347,13 @@ func (x *DelNetworkRequest) GetK8S_POD_INFRA_CONTAINER_ID() string {
 	return ""
 }
 
+func (x *DelNetworkRequest) GetK8S_POD_UID() string {
+	if x != nil {
+		return x.K8S_POD_UID
+	}
+	return ""
+}
+
 func (x *DelNetworkRequest) GetReason() string {
 	if x != nil {
 		return x.Reason
@@ -446,6 +462,196 @@ func (x *DelNetworkReply) GetPodVlanId() int32 {
 	return 0
 }
 
+// The durations of the phases of a pod network setup, reported by the CNI plugin once the setup is done
+type ReportPodSetupRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ClientVersion   string           `protobuf:"bytes,1,opt,name=ClientVersion,proto3" json:"ClientVersion,omitempty"`
+	ContainerID     string           `protobuf:"bytes,2,opt,name=ContainerID,proto3" json:"ContainerID,omitempty"`
+	IfName          string           `protobuf:"bytes,3,opt,name=IfName,proto3" json:"IfName,omitempty"`
+	NetworkName     string           `protobuf:"bytes,4,opt,name=NetworkName,proto3" json:"NetworkName,omitempty"`
+	DurationSeconds float64          `protobuf:"fixed64,5,opt,name=DurationSeconds,proto3" json:"DurationSeconds,omitempty"`
+	Phases          []*PodSetupPhase `protobuf:"bytes,6,rep,name=Phases,proto3" json:"Phases,omitempty"` // next field: 7
+}
+
+func (x *ReportPodSetupRequest) Reset() {
+	*x = ReportPodSetupRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rpc_proto_msgTypes[4]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReportPodSetupRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportPodSetupRequest) ProtoMessage() {}
+
+func (x *ReportPodSetupRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_proto_msgTypes[4]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportPodSetupRequest.ProtoReflect.Descriptor instead.
+func (*ReportPodSetupRequest) Descriptor() ([]byte, []int) {
+	return file_rpc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ReportPodSetupRequest) GetClientVersion() string {
+	if x != nil {
+		return x.ClientVersion
+	}
+	return ""
+}
+
+func (x *ReportPodSetupRequest) GetContainerID() string {
+	if x != nil {
+		return x.ContainerID
+	}
+	return ""
+}
+
+func (x *ReportPodSetupRequest) GetIfName() string {
+	if x != nil {
+		return x.IfName
+	}
+	return ""
+}
+
+func (x *ReportPodSetupRequest) GetNetworkName() string {
+	if x != nil {
+		return x.NetworkName
+	}
+	return ""
+}
+
+func (x *ReportPodSetupRequest) GetDurationSeconds() float64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+func (x *ReportPodSetupRequest) GetPhases() []*PodSetupPhase {
+	if x != nil {
+		return x.Phases
+	}
+	return nil
+}
+
+type PodSetupPhase struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name            string  `protobuf:"bytes,1,opt,name=Name,proto3" json:"Name,omitempty"`
+	DurationSeconds float64 `protobuf:"fixed64,2,opt,name=DurationSeconds,proto3" json:"DurationSeconds,omitempty"`
+}
+
+func (x *PodSetupPhase) Reset() {
+	*x = PodSetupPhase{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rpc_proto_msgTypes[5]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PodSetupPhase) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PodSetupPhase) ProtoMessage() {}
+
+func (x *PodSetupPhase) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_proto_msgTypes[5]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PodSetupPhase.ProtoReflect.Descriptor instead.
+func (*PodSetupPhase) Descriptor() ([]byte, []int) {
+	return file_rpc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *PodSetupPhase) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PodSetupPhase) GetDurationSeconds() float64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+type ReportPodSetupReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Success bool `protobuf:"varint,1,opt,name=Success,proto3" json:"Success,omitempty"`
+}
+
+func (x *ReportPodSetupReply) Reset() {
+	*x = ReportPodSetupReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_rpc_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ReportPodSetupReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReportPodSetupReply) ProtoMessage() {}
+
+func (x *ReportPodSetupReply) ProtoReflect() protoreflect.Message {
+	mi := &file_rpc_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReportPodSetupReply.ProtoReflect.Descriptor instead.
+func (*ReportPodSetupReply) Descriptor() ([]byte, []int) {
+	return file_rpc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ReportPodSetupReply) GetSuccess() bool {
+	if x != nil {
+		return x.Success
+	}
+	return false
+}
+
 type EnforceNpRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -458,7 +664,7 @@ type EnforceNpRequest struct {
 func (x *EnforceNpRequest) Reset() {
 	*x = EnforceNpRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_rpc_proto_msgTypes[4]
+		mi := &file_rpc_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -471,7 +677,7 @@ func (x *EnforceNpRequest) String() string {
 func (*EnforceNpRequest) ProtoMessage() {}
 
 func (x *EnforceNpRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_rpc_proto_msgTypes[4]
+	mi := &file_rpc_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -484,7 +690,7 @@ func (x *EnforceNpRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EnforceNpRequest.ProtoReflect.Descriptor instead.
 func (*EnforceNpRequest) Descriptor() ([]byte, []int) {
-	return file_rpc_proto_rawDescGZIP(), []int{4}
+	return file_rpc_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *EnforceNpRequest) GetK8S_POD_NAME() string {
@@ -512,7 +718,7 @@ type EnforceNpReply struct {
 func (x *EnforceNpReply) Reset() {
 	*x = EnforceNpReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_rpc_proto_msgTypes[5]
+		mi := &file_rpc_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -525,7 +731,7 @@ func (x *EnforceNpReply) String() string {
 func (*EnforceNpReply) ProtoMessage() {}
 
 func (x *EnforceNpReply) ProtoReflect() protoreflect.Message {
-	mi := &file_rpc_proto_msgTypes[5]
+	mi := &file_rpc_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -538,7 +744,7 @@ func (x *EnforceNpReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EnforceNpReply.ProtoReflect.Descriptor instead.
 func (*EnforceNpReply) Descriptor() ([]byte, []int) {
-	return file_rpc_proto_rawDescGZIP(), []int{5}
+	return file_rpc_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *EnforceNpReply) GetSuccess() bool {
@@ -552,7 +758,7 @@ var File_rpc_proto protoreflect.FileDescriptor
 
 var file_rpc_proto_rawDesc = []byte{
 	0x0a, 0x09, 0x72, 0x70, 0x63, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x03, 0x72, 0x70, 0x63,
-	0x22, 0xb5, 0x02, 0x0a, 0x11, 0x41, 0x64, 0x64, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x52,
+	0x22, 0xd5, 0x02, 0x0a, 0x11, 0x41, 0x64, 0x64, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x52,
 	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x24, 0x0a, 0x0d, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74,
 	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x43,
 	0x6c, 0x69, 0x65, 0x6e, 0x74, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x20, 0x0a, 0x0c,
@@ -564,7 +770,9 @@ var file_rpc_proto_rawDesc = []byte{
 	0x53, 0x5f, 0x50, 0x4f, 0x44, 0x5f, 0x49, 0x4e, 0x46, 0x52, 0x41, 0x5f, 0x43, 0x4f, 0x4e, 0x54,
 	0x41, 0x49, 0x4e, 0x45, 0x52, 0x5f, 0x49, 0x44, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x16,
 	0x4b, 0x38, 0x53, 0x50, 0x4f, 0x44, 0x49, 0x4e, 0x46, 0x52, 0x41, 0x43, 0x4f, 0x4e, 0x54, 0x41,
-	0x49, 0x4e, 0x45, 0x52, 0x49, 0x44, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69,
+	0x49, 0x4e, 0x45, 0x52, 0x49, 0x44, 0x12, 0x1e, 0x0a, 0x0b, 0x4b, 0x38, 0x53, 0x5f, 0x50, 0x4f,
+	0x44, 0x5f, 0x55, 0x49, 0x44, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x4b, 0x38, 0x53,
+	0x50, 0x4f, 0x44, 0x55, 0x49, 0x44, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69,
 	0x6e, 0x65, 0x72, 0x49, 0x44, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x6f, 0x6e,
 	0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49, 0x44, 0x12, 0x16, 0x0a, 0x06, 0x49, 0x66, 0x4e, 0x61,
 	0x6d, 0x65, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x49, 0x66, 0x4e, 0x61, 0x6d, 0x65,
@@ -598,7 +806,7 @@ var file_rpc_proto_rawDesc = []byte{
 	0x66, 0x49, 0x6e, 0x64, 0x65, 0x78, 0x12, 0x2c, 0x0a, 0x11, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72,
 	0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x4d, 0x6f, 0x64, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28,
 	0x09, 0x52, 0x11, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79,
-	0x4d, 0x6f, 0x64, 0x65, 0x22, 0xb7, 0x02, 0x0a, 0x11, 0x44, 0x65, 0x6c, 0x4e, 0x65, 0x74, 0x77,
+	0x4d, 0x6f, 0x64, 0x65, 0x22, 0xd7, 0x02, 0x0a, 0x11, 0x44, 0x65, 0x6c, 0x4e, 0x65, 0x74, 0x77,
 	0x6f, 0x72, 0x6b, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x24, 0x0a, 0x0d, 0x43, 0x6c,
 	0x69, 0x65, 0x6e, 0x74, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28,
 	0x09, 0x52, 0x0d, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e,
@@ -610,7 +818,9 @@ var file_rpc_proto_rawDesc = []byte{
 	0x0a, 0x1a, 0x4b, 0x38, 0x53, 0x5f, 0x50, 0x4f, 0x44, 0x5f, 0x49, 0x4e, 0x46, 0x52, 0x41, 0x5f,
 	0x43, 0x4f, 0x4e, 0x54, 0x41, 0x49, 0x4e, 0x45, 0x52, 0x5f, 0x49, 0x44, 0x18, 0x03, 0x20, 0x01,
 	0x28, 0x09, 0x52, 0x16, 0x4b, 0x38, 0x53, 0x50, 0x4f, 0x44, 0x49, 0x4e, 0x46, 0x52, 0x41, 0x43,
-	0x4f, 0x4e, 0x54, 0x41, 0x49, 0x4e, 0x45, 0x52, 0x49, 0x44, 0x12, 0x16, 0x0a, 0x06, 0x52, 0x65,
+	0x4f, 0x4e, 0x54, 0x41, 0x49, 0x4e, 0x45, 0x52, 0x49, 0x44, 0x12, 0x1e, 0x0a, 0x0b, 0x4b, 0x38,
+	0x53, 0x5f, 0x50, 0x4f, 0x44, 0x5f, 0x55, 0x49, 0x44, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x09, 0x4b, 0x38, 0x53, 0x50, 0x4f, 0x44, 0x55, 0x49, 0x44, 0x12, 0x16, 0x0a, 0x06, 0x52, 0x65,
 	0x61, 0x73, 0x6f, 0x6e, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x52, 0x65, 0x61, 0x73,
 	0x6f, 0x6e, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49,
 	0x44, 0x18, 0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69, 0x6e,
@@ -628,33 +838,60 @@ var file_rpc_proto_rawDesc = []byte{
 	0x6d, 0x62, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x05, 0x52, 0x0c, 0x44, 0x65, 0x76, 0x69,
 	0x63, 0x65, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x12, 0x1c, 0x0a, 0x09, 0x50, 0x6f, 0x64, 0x56,
 	0x6c, 0x61, 0x6e, 0x49, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x05, 0x52, 0x09, 0x50, 0x6f, 0x64,
-	0x56, 0x6c, 0x61, 0x6e, 0x49, 0x64, 0x22, 0x60, 0x0a, 0x10, 0x45, 0x6e, 0x66, 0x6f, 0x72, 0x63,
-	0x65, 0x4e, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x20, 0x0a, 0x0c, 0x4b, 0x38,
-	0x53, 0x5f, 0x50, 0x4f, 0x44, 0x5f, 0x4e, 0x41, 0x4d, 0x45, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x0a, 0x4b, 0x38, 0x53, 0x50, 0x4f, 0x44, 0x4e, 0x41, 0x4d, 0x45, 0x12, 0x2a, 0x0a, 0x11,
-	0x4b, 0x38, 0x53, 0x5f, 0x50, 0x4f, 0x44, 0x5f, 0x4e, 0x41, 0x4d, 0x45, 0x53, 0x50, 0x41, 0x43,
-	0x45, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x4b, 0x38, 0x53, 0x50, 0x4f, 0x44, 0x4e,
-	0x41, 0x4d, 0x45, 0x53, 0x50, 0x41, 0x43, 0x45, 0x22, 0x2a, 0x0a, 0x0e, 0x45, 0x6e, 0x66, 0x6f,
-	0x72, 0x63, 0x65, 0x4e, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x53, 0x75,
-	0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x53, 0x75, 0x63,
-	0x63, 0x65, 0x73, 0x73, 0x32, 0x88, 0x01, 0x0a, 0x0a, 0x43, 0x4e, 0x49, 0x42, 0x61, 0x63, 0x6b,
-	0x65, 0x6e, 0x64, 0x12, 0x3c, 0x0a, 0x0a, 0x41, 0x64, 0x64, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72,
-	0x6b, 0x12, 0x16, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x64, 0x64, 0x4e, 0x65, 0x74, 0x77, 0x6f,
+	0x56, 0x6c, 0x61, 0x6e, 0x49, 0x64, 0x22, 0xef, 0x01, 0x0a, 0x15, 0x52, 0x65, 0x70, 0x6f, 0x72,
+	0x74, 0x50, 0x6f, 0x64, 0x53, 0x65, 0x74, 0x75, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x24, 0x0a, 0x0d, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0d, 0x43, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x56,
+	0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x20, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x61, 0x69,
+	0x6e, 0x65, 0x72, 0x49, 0x44, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x43, 0x6f, 0x6e,
+	0x74, 0x61, 0x69, 0x6e, 0x65, 0x72, 0x49, 0x44, 0x12, 0x16, 0x0a, 0x06, 0x49, 0x66, 0x4e, 0x61,
+	0x6d, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x49, 0x66, 0x4e, 0x61, 0x6d, 0x65,
+	0x12, 0x20, 0x0a, 0x0b, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x4e, 0x61, 0x6d, 0x65, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x4e, 0x61,
+	0x6d, 0x65, 0x12, 0x28, 0x0a, 0x0f, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65,
+	0x63, 0x6f, 0x6e, 0x64, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0f, 0x44, 0x75, 0x72,
+	0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x12, 0x2a, 0x0a, 0x06,
+	0x50, 0x68, 0x61, 0x73, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x72,
+	0x70, 0x63, 0x2e, 0x50, 0x6f, 0x64, 0x53, 0x65, 0x74, 0x75, 0x70, 0x50, 0x68, 0x61, 0x73, 0x65,
+	0x52, 0x06, 0x50, 0x68, 0x61, 0x73, 0x65, 0x73, 0x22, 0x4d, 0x0a, 0x0d, 0x50, 0x6f, 0x64, 0x53,
+	0x65, 0x74, 0x75, 0x70, 0x50, 0x68, 0x61, 0x73, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x4e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x4e, 0x61, 0x6d, 0x65, 0x12, 0x28, 0x0a,
+	0x0f, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x0f, 0x44, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e,
+	0x53, 0x65, 0x63, 0x6f, 0x6e, 0x64, 0x73, 0x22, 0x2f, 0x0a, 0x13, 0x52, 0x65, 0x70, 0x6f, 0x72,
+	0x74, 0x50, 0x6f, 0x64, 0x53, 0x65, 0x74, 0x75, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x18,
+	0x0a, 0x07, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x07, 0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x22, 0x60, 0x0a, 0x10, 0x45, 0x6e, 0x66, 0x6f,
+	0x72, 0x63, 0x65, 0x4e, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x20, 0x0a, 0x0c,
+	0x4b, 0x38, 0x53, 0x5f, 0x50, 0x4f, 0x44, 0x5f, 0x4e, 0x41, 0x4d, 0x45, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0a, 0x4b, 0x38, 0x53, 0x50, 0x4f, 0x44, 0x4e, 0x41, 0x4d, 0x45, 0x12, 0x2a,
+	0x0a, 0x11, 0x4b, 0x38, 0x53, 0x5f, 0x50, 0x4f, 0x44, 0x5f, 0x4e, 0x41, 0x4d, 0x45, 0x53, 0x50,
+	0x41, 0x43, 0x45, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x4b, 0x38, 0x53, 0x50, 0x4f,
+	0x44, 0x4e, 0x41, 0x4d, 0x45, 0x53, 0x50, 0x41, 0x43, 0x45, 0x22, 0x2a, 0x0a, 0x0e, 0x45, 0x6e,
+	0x66, 0x6f, 0x72, 0x63, 0x65, 0x4e, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x18, 0x0a, 0x07,
+	0x53, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x53,
+	0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x32, 0xd2, 0x01, 0x0a, 0x0a, 0x43, 0x4e, 0x49, 0x42, 0x61,
+	0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12, 0x3c, 0x0a, 0x0a, 0x41, 0x64, 0x64, 0x4e, 0x65, 0x74, 0x77,
+	0x6f, 0x72, 0x6b, 0x12, 0x16, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x41, 0x64, 0x64, 0x4e, 0x65, 0x74,
+	0x77, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x72, 0x70,
+	0x63, 0x2e, 0x41, 0x64, 0x64, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x22, 0x00, 0x12, 0x3c, 0x0a, 0x0a, 0x44, 0x65, 0x6c, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72,
+	0x6b, 0x12, 0x16, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x65, 0x6c, 0x4e, 0x65, 0x74, 0x77, 0x6f,
 	0x72, 0x6b, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x72, 0x70, 0x63, 0x2e,
-	0x41, 0x64, 0x64, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
-	0x00, 0x12, 0x3c, 0x0a, 0x0a, 0x44, 0x65, 0x6c, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x12,
-	0x16, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x65, 0x6c, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x14, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x44, 0x65,
-	0x6c, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x32,
-	0x4b, 0x0a, 0x09, 0x4e, 0x50, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12, 0x3e, 0x0a, 0x0e,
-	0x45, 0x6e, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x4e, 0x70, 0x54, 0x6f, 0x50, 0x6f, 0x64, 0x12, 0x15,
-	0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6e, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x4e, 0x70, 0x52, 0x65,
-	0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6e, 0x66, 0x6f,
-	0x72, 0x63, 0x65, 0x4e, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x2b, 0x5a, 0x29,
-	0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x77, 0x73, 0x2f, 0x61,
-	0x6d, 0x61, 0x7a, 0x6f, 0x6e, 0x2d, 0x76, 0x70, 0x63, 0x2d, 0x63, 0x6e, 0x69, 0x2d, 0x6b, 0x38,
-	0x73, 0x2f, 0x72, 0x70, 0x63, 0x3b, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x33,
+	0x44, 0x65, 0x6c, 0x4e, 0x65, 0x74, 0x77, 0x6f, 0x72, 0x6b, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
+	0x00, 0x12, 0x48, 0x0a, 0x0e, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x50, 0x6f, 0x64, 0x53, 0x65,
+	0x74, 0x75, 0x70, 0x12, 0x1a, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74,
+	0x50, 0x6f, 0x64, 0x53, 0x65, 0x74, 0x75, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x18, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x52, 0x65, 0x70, 0x6f, 0x72, 0x74, 0x50, 0x6f, 0x64, 0x53,
+	0x65, 0x74, 0x75, 0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x32, 0x4b, 0x0a, 0x09, 0x4e,
+	0x50, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12, 0x3e, 0x0a, 0x0e, 0x45, 0x6e, 0x66, 0x6f,
+	0x72, 0x63, 0x65, 0x4e, 0x70, 0x54, 0x6f, 0x50, 0x6f, 0x64, 0x12, 0x15, 0x2e, 0x72, 0x70, 0x63,
+	0x2e, 0x45, 0x6e, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x4e, 0x70, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x1a, 0x13, 0x2e, 0x72, 0x70, 0x63, 0x2e, 0x45, 0x6e, 0x66, 0x6f, 0x72, 0x63, 0x65, 0x4e,
+	0x70, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x42, 0x2b, 0x5a, 0x29, 0x67, 0x69, 0x74, 0x68,
+	0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x61, 0x77, 0x73, 0x2f, 0x61, 0x6d, 0x61, 0x7a, 0x6f,
+	0x6e, 0x2d, 0x76, 0x70, 0x63, 0x2d, 0x63, 0x6e, 0x69, 0x2d, 0x6b, 0x38, 0x73, 0x2f, 0x72, 0x70,
+	0x63, 0x3b, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -669,27 +906,33 @@ func file_rpc_proto_rawDescGZIP() []byte {
 	return file_rpc_proto_rawDescData
 }
 
-var file_rpc_proto_msgTypes = make([]protoimpl.MessageInfo, 6)
+var file_rpc_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_rpc_proto_goTypes = []interface{}{
-	(*AddNetworkRequest)(nil), // 0: rpc.AddNetworkRequest
-	(*AddNetworkReply)(nil),   // 1: rpc.AddNetworkReply
-	(*DelNetworkRequest)(nil), // 2: rpc.DelNetworkRequest
-	(*DelNetworkReply)(nil),   // 3: rpc.DelNetworkReply
-	(*EnforceNpRequest)(nil),  // 4: rpc.EnforceNpRequest
-	(*EnforceNpReply)(nil),    // 5: rpc.EnforceNpReply
+	(*AddNetworkRequest)(nil),     // 0: rpc.AddNetworkRequest
+	(*AddNetworkReply)(nil),       // 1: rpc.AddNetworkReply
+	(*DelNetworkRequest)(nil),     // 2: rpc.DelNetworkRequest
+	(*DelNetworkReply)(nil),       // 3: rpc.DelNetworkReply
+	(*ReportPodSetupRequest)(nil), // 4: rpc.ReportPodSetupRequest
+	(*PodSetupPhase)(nil),         // 5: rpc.PodSetupPhase
+	(*ReportPodSetupReply)(nil),   // 6: rpc.ReportPodSetupReply
+	(*EnforceNpRequest)(nil),      // 7: rpc.EnforceNpRequest
+	(*EnforceNpReply)(nil),        // 8: rpc.EnforceNpReply
 }
 var file_rpc_proto_depIdxs = []int32{
-	0, // 0: rpc.CNIBackend.AddNetwork:input_type -> rpc.AddNetworkRequest
-	2, // 1: rpc.CNIBackend.DelNetwork:input_type -> rpc.DelNetworkRequest
-	4, // 2: rpc.NPBackend.EnforceNpToPod:input_type -> rpc.EnforceNpRequest
-	1, // 3: rpc.CNIBackend.AddNetwork:output_type -> rpc.AddNetworkReply
-	3, // 4: rpc.CNIBackend.DelNetwork:output_type -> rpc.DelNetworkReply
-	5, // 5: rpc.NPBackend.EnforceNpToPod:output_type -> rpc.EnforceNpReply
-	3, // [3:6] is the sub-list for method output_type
-	0, // [0:3] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	5, // 0: rpc.ReportPodSetupRequest.Phases:type_name -> rpc.PodSetupPhase
+	0, // 1: rpc.CNIBackend.AddNetwork:input_type -> rpc.AddNetworkRequest
+	2, // 2: rpc.CNIBackend.DelNetwork:input_type -> rpc.DelNetworkRequest
+	4, // 3: rpc.CNIBackend.ReportPodSetup:input_type -> rpc.ReportPodSetupRequest
+	7, // 4: rpc.NPBackend.EnforceNpToPod:input_type -> rpc.EnforceNpRequest
+	1, // 5: rpc.CNIBackend.AddNetwork:output_type -> rpc.AddNetworkReply
+	3, // 6: rpc.CNIBackend.DelNetwork:output_type -> rpc.DelNetworkReply
+	6, // 7: rpc.CNIBackend.ReportPodSetup:output_type -> rpc.ReportPodSetupReply
+	8, // 8: rpc.NPBackend.EnforceNpToPod:output_type -> rpc.EnforceNpReply
+	5, // [5:9] is the sub-list for method output_type
+	1, // [1:5] is the sub-list for method input_type
+	1, // [1:1] is the sub-list for extension type_name
+	1, // [1:1] is the sub-list for extension extendee
+	0, // [0:1] is the sub-list for field type_name
 }
 
 func init() { file_rpc_proto_init() }
@@ -747,7 +990,7 @@ func file_rpc_proto_init() {
 			}
 		}
 		file_rpc_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*EnforceNpRequest); i {
+			switch v := v.(*ReportPodSetupRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -759,6 +1002,42 @@ func file_rpc_proto_init() {
 			}
 		}
 		file_rpc_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PodSetupPhase); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rpc_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ReportPodSetupReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rpc_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*EnforceNpRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_rpc_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*EnforceNpReply); i {
 			case 0:
 				return &v.state
@@ -777,7 +1056,7 @@ func file_rpc_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_rpc_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   6,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   2,
 		},
@@ -805,6 +1084,7 @@ const _ = grpc.SupportPackageIsVersion6
 type CNIBackendClient interface {
 	AddNetwork(ctx context.Context, in *AddNetworkRequest, opts ...grpc.CallOption) (*AddNetworkReply, error)
 	DelNetwork(ctx context.Context, in *DelNetworkRequest, opts ...grpc.CallOption) (*DelNetworkReply, error)
+	ReportPodSetup(ctx context.Context, in *ReportPodSetupRequest, opts ...grpc.CallOption) (*ReportPodSetupReply, error)
 }
 
 type cNIBackendClient struct {
@@ -833,10 +1113,20 @@ func (c *cNIBackendClient) DelNetwork(ctx context.Context, in *DelNetworkRequest
 	return out, nil
 }
 
+func (c *cNIBackendClient) ReportPodSetup(ctx context.Context, in *ReportPodSetupRequest, opts ...grpc.CallOption) (*ReportPodSetupReply, error) {
+	out := new(ReportPodSetupReply)
+	err := c.cc.Invoke(ctx, "/rpc.CNIBackend/ReportPodSetup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // CNIBackendServer is the server API for CNIBackend service.
 type CNIBackendServer interface {
 	AddNetwork(context.Context, *AddNetworkRequest) (*AddNetworkReply, error)
 	DelNetwork(context.Context, *DelNetworkRequest) (*DelNetworkReply, error)
+	ReportPodSetup(context.Context, *ReportPodSetupRequest) (*ReportPodSetupReply, error)
 }
 
 // UnimplementedCNIBackendServer can be embedded to have forward compatible implementations.
@@ -849,6 +1139,9 @@ func (*UnimplementedCNIBackendServer) AddNetwork(context.Context, *AddNetworkReq
 func (*UnimplementedCNIBackendServer) DelNetwork(context.Context, *DelNetworkRequest) (*DelNetworkReply, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method DelNetwork not implemented")
 }
+func (*UnimplementedCNIBackendServer) ReportPodSetup(context.Context, *ReportPodSetupRequest) (*ReportPodSetupReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReportPodSetup not implemented")
+}
 
 func RegisterCNIBackendServer(s *grpc.Server, srv CNIBackendServer) {
 	s.RegisterService(&_CNIBackend_serviceDesc, srv)
@@ -890,6 +1183,24 @@ func _CNIBackend_DelNetwork_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CNIBackend_ReportPodSetup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportPodSetupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CNIBackendServer).ReportPodSetup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/rpc.CNIBackend/ReportPodSetup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CNIBackendServer).ReportPodSetup(ctx, req.(*ReportPodSetupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 var _CNIBackend_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "rpc.CNIBackend",
 	HandlerType: (*CNIBackendServer)(nil),
@@ -902,6 +1213,10 @@ var _CNIBackend_serviceDesc = grpc.ServiceDesc{
 			MethodName: "DelNetwork",
 			Handler:    _CNIBackend_DelNetwork_Handler,
 		},
+		{
+			MethodName: "ReportPodSetup",
+			Handler:    _CNIBackend_ReportPodSetup_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "rpc.proto",
@@ -0,0 +1,42 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// This program generates the seccomp profiles in misc/seccomp
+// It can be invoked by running `go run`
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/seccomp"
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/utils/logger"
+)
+
+const profileDir = "misc/seccomp"
+
+var log = logger.DefaultLogger()
+
+func main() {
+	for _, component := range seccomp.Components {
+		data, err := component.Profile()
+		if err != nil {
+			log.Fatalf("Failed to generate the %s profile: %v", component.Name, err)
+		}
+		path := filepath.Join(profileDir, component.Name+".json")
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			log.Fatalf("Failed to write %s: %v", path, err)
+		}
+		log.Infof("Generated %s", path)
+	}
+}
@@ -4,12 +4,18 @@
 # Prerequisite: cluster with at least three Linux nodes must already exist.
 # It is up to the caller to ensure that tests are valid to run against cluster, i.e. IPv6 tests require IPv6 cluster.
 # Set appropriate optional args for running test suite
+# Set NODE_ARCH to arm64 to run the suite against the Graviton nodes of a mixed-architecture cluster.
+# Set TEST_NAMESPACE to run the test workloads in a namespace of their own, when other suites run against the cluster.
+# Set ARTIFACTS_DIR to save the logs, iptables rules and ENIs of the nodes of the failed specs there.
 
 set -e
 
 SCRIPT_DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )"
 GINKGO_TEST_BUILD="$SCRIPT_DIR/../test/build"
 : "${SKIP_MAKE_TEST_BINARIES:=}"
+: "${NODE_ARCH:=}"
+: "${TEST_NAMESPACE:=}"
+: "${ARTIFACTS_DIR:=}"
 
 source "$SCRIPT_DIR"/lib/cluster.sh
 source "$SCRIPT_DIR"/lib/canary.sh
@@ -33,16 +39,33 @@ function load_test_parameters(){
     EXTRA_OPTIONS+=" --target-manifest-file $TARGET_MANIFEST_FILE"
   fi
 
+  if [[ ! -z $TEST_NAMESPACE ]]; then
+    EXTRA_OPTIONS+=" --test-namespace $TEST_NAMESPACE"
+  fi
+
+  if [[ ! -z $ARTIFACTS_DIR ]]; then
+    EXTRA_OPTIONS+=" --artifacts-dir $ARTIFACTS_DIR"
+  fi
+
 }
 
 function run_ginkgo_test() {
+  # The suites run on the Linux nodes, or on the nodes of the architecture if NODE_ARCH is set
+  local ng_name_label_key="kubernetes.io/os"
+  local ng_name_label_val="linux"
+  if [[ ! -z $NODE_ARCH ]]; then
+    ng_name_label_key="kubernetes.io/arch"
+    ng_name_label_val="$NODE_ARCH"
+    EXTRA_OPTIONS+=" --instance-type $NODE_ARCH"
+  fi
+
   (CGO_ENABLED=0 ginkgo $EXTRA_GINKGO_FLAGS -v --timeout 60m --no-color --fail-on-pending $GINKGO_TEST_BUILD/$SUITE_NAME.test -- \
     --cluster-kubeconfig="$KUBE_CONFIG_PATH" \
     --cluster-name="$CLUSTER_NAME" \
     --aws-region="$REGION" \
     --aws-vpc-id="$VPC_ID" \
-    --ng-name-label-key="kubernetes.io/os" \
-    --ng-name-label-val="linux" \
+    --ng-name-label-key="$ng_name_label_key" \
+    --ng-name-label-val="$ng_name_label_val" \
     $ENDPOINT_OPTION $EXTRA_OPTIONS
   )
 }
@@ -0,0 +1,30 @@
+#!/usr/bin/env bash
+
+# Runs the component tests in test/component against LocalStack. ipamd allocates and frees ENIs and IPs through the
+# emulated EC2 API and reads them back through a fake instance metadata service, without an EKS cluster.
+# Set LOCALSTACK_ENDPOINT to use a LocalStack that is already running.
+
+set -Euo pipefail
+
+DIR=$(cd "$(dirname "$0")"; pwd)
+
+: "${LOCALSTACK_IMAGE:=localstack/localstack:3}"
+: "${LOCALSTACK_CONTAINER:=vpc-cni-localstack}"
+
+if [[ -z "${LOCALSTACK_ENDPOINT:-}" ]]; then
+    LOCALSTACK_ENDPOINT=http://localhost:4566
+    echo "Starting $LOCALSTACK_IMAGE"
+    docker run -d --rm --name "$LOCALSTACK_CONTAINER" -p 4566:4566 -e SERVICES=ec2 "$LOCALSTACK_IMAGE" >/dev/null
+    trap 'docker rm -f "$LOCALSTACK_CONTAINER" >/dev/null' EXIT
+
+    for _ in $(seq 1 60); do
+        if curl -sf "$LOCALSTACK_ENDPOINT/_localstack/health" | grep -q '"ec2": "\(available\|running\)"'; then
+            break
+        fi
+        sleep 2
+    done
+fi
+export LOCALSTACK_ENDPOINT
+
+cd "$DIR"/..
+go test -v -count=1 -tags component ./test/component/...
@@ -0,0 +1,69 @@
+#!/usr/bin/env bash
+
+# Runs the ginkgo integration suites in parallel, one lane per cluster in CLUSTER_NAMES. The suites of a lane run one
+# after the other, since most of them change the aws-node DaemonSet of their cluster. Each suite runs its workloads in
+# a namespace of its own and creates its subnets in a VPC fixture of its own, so that clusters may share a VPC.
+# The VPC fixtures left by interrupted runs are deleted by the suites of later runs, once older than --fixture-max-age.
+#
+# Prerequisite: the clusters exist, and the test binaries are built with `make build-test-binaries`.
+# Set SUITES to the space separated names of the suites to run, all the suites in test/build by default.
+
+set -uo pipefail
+
+SCRIPT_DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )"
+GINKGO_TEST_BUILD="$SCRIPT_DIR/../test/build"
+
+: "${CLUSTER_NAMES:?set CLUSTER_NAMES to the comma separated names of the test clusters}"
+: "${REGION:=us-west-2}"
+: "${SUITES:=$(cd "$GINKGO_TEST_BUILD" && ls *.test | sed 's/\.test$//' | tr '\n' ' ')}"
+: "${REPORT_DIR:=$SCRIPT_DIR/../test/build/reports}"
+
+export REGION
+
+IFS=',' read -r -a clusters <<< "$CLUSTER_NAMES"
+read -r -a suites <<< "$SUITES"
+mkdir -p "$REPORT_DIR"
+
+function run_lane() {
+  local cluster=$1
+  shift
+  local kubeconfig="$REPORT_DIR/$cluster.kubeconfig"
+  aws eks update-kubeconfig --name "$cluster" --region "$REGION" --kubeconfig "$kubeconfig" >/dev/null || return 1
+
+  local failed=0
+  for suite in "$@"; do
+    echo "Running $suite against $cluster, logs in $REPORT_DIR/$suite.log"
+    if ! CLUSTER_NAME="$cluster" KUBE_CONFIG_PATH="$kubeconfig" SUITE_NAME="$suite" TEST_NAMESPACE="cni-automation-$suite" \
+        ARTIFACTS_DIR="$REPORT_DIR/$suite-artifacts" "$SCRIPT_DIR"/run-ginkgo-integration-suite.sh >"$REPORT_DIR/$suite.log" 2>&1; then
+      echo "$suite failed against $cluster, artifacts of the failed specs in $REPORT_DIR/$suite-artifacts"
+      failed=1
+    fi
+  done
+  return $failed
+}
+
+# Deal the suites to the lanes round-robin
+declare -a lanes
+for i in "${!suites[@]}"; do
+  lane=$((i % ${#clusters[@]}))
+  lanes[$lane]="${lanes[$lane]:-} ${suites[$i]}"
+done
+
+pids=()
+for lane in "${!clusters[@]}"; do
+  [[ -z "${lanes[$lane]:-}" ]] && continue
+  # shellcheck disable=SC2086
+  run_lane "${clusters[$lane]}" ${lanes[$lane]} &
+  pids+=($!)
+done
+
+status=0
+for pid in "${pids[@]}"; do
+  wait "$pid" || status=1
+done
+
+if [[ $status -ne 0 ]]; then
+  echo "some suites failed, see the logs in $REPORT_DIR"
+  exit 1
+fi
+echo "all suites ran successfully in $(($SECONDS / 60)) minutes and $(($SECONDS % 60)) seconds"
@@ -2,6 +2,7 @@
 
 # The script runs amazon-vpc-cni static canary tests
 # The tests in this suite are designed to exercise AZ failure scenarios.
+# Set RUN_POD_CHURN_SOAK to true to also churn deployments with the soak suite for SOAK_DURATION, in whole hours (2h by default).
 
 set -e
 
@@ -9,6 +10,8 @@ SCRIPT_DIR="$( cd "$( dirname "${BASH_SOURCE[0]}" )" >/dev/null 2>&1 && pwd )"
 GINKGO_TEST_BUILD="$SCRIPT_DIR/../test/build"
 # TEST_IMAGE_REGISTRY is the registry in test-infra-* accounts where e2e test images are stored
 TEST_IMAGE_REGISTRY=${TEST_IMAGE_REGISTRY:-"617930562442.dkr.ecr.us-west-2.amazonaws.com"}
+: "${RUN_POD_CHURN_SOAK:=false}"
+: "${SOAK_DURATION:=2h}"
 
 # If $ENDPOINT is set, as in it is for beta clusters then $ENDPOINT_OPTION,
 # defined in lib/cluster.sh will add --eks-endpoint=$ENDPOINT to the ginkgo
@@ -33,8 +36,28 @@ function run_ginkgo_test() {
       $ENDPOINT_OPTION)
 }
 
+function run_pod_churn_soak() {
+  echo "Churning deployments for $SOAK_DURATION"
+
+  # The suite timeout leaves an hour for the setup and the checks after the churn
+  (CGO_ENABLED=0 ginkgo $EXTRA_GINKGO_FLAGS --no-color -v --timeout "$(( ${SOAK_DURATION%h} + 1 ))h" --fail-on-pending $GINKGO_TEST_BUILD/soak.test -- \
+      --cluster-kubeconfig="$KUBE_CONFIG_PATH" \
+      --cluster-name="$CLUSTER_NAME" \
+      --aws-region="$REGION" \
+      --aws-vpc-id="$VPC_ID" \
+      --ng-name-label-key="kubernetes.io/os" \
+      --ng-name-label-val="linux" \
+      --test-image-registry=$TEST_IMAGE_REGISTRY \
+      --soak-duration="$SOAK_DURATION" \
+      $ENDPOINT_OPTION)
+}
+
 load_cluster_details
 
 run_ginkgo_test "SOAK_TEST"
 
+if [[ "$RUN_POD_CHURN_SOAK" == true ]]; then
+  run_pod_churn_soak
+fi
+
 echo "all tests ran successfully in $(($SECONDS / 60)) minutes and $(($SECONDS % 60)) seconds"
@@ -0,0 +1,227 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package component runs ipamd's ENI and IP lifecycle against an EC2 emulator such as LocalStack, with an instance
+// metadata service that serves the state of the emulated instance
+package component
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+)
+
+// IMDS serves the instance metadata of an instance from the EC2 API, so that the ENIs and IPs ipamd allocates through
+// the EC2 API show up in instance metadata like on a real instance
+type IMDS struct {
+	EC2        ec2iface.EC2API
+	InstanceID string
+	Region     string
+}
+
+// ServeHTTP implements IMDSv2 token requests and the metadata paths read by awsutils
+func (m *IMDS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPut && r.URL.Path == "/latest/api/token" {
+		w.Header().Set("X-Aws-Ec2-Metadata-Token-Ttl-Seconds", r.Header.Get("X-Aws-Ec2-Metadata-Token-Ttl-Seconds"))
+		fmt.Fprint(w, "token")
+		return
+	}
+	if r.URL.Path == "/latest/dynamic/instance-identity/document" {
+		m.serveIdentityDocument(w)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/latest/meta-data/")
+	if path == r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+	value, found, err := m.metadata(strings.TrimSuffix(path, "/"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	fmt.Fprint(w, value)
+}
+
+func (m *IMDS) serveIdentityDocument(w http.ResponseWriter) {
+	instance, err := m.instance()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"instanceId":       m.InstanceID,
+		"instanceType":     aws.StringValue(instance.InstanceType),
+		"availabilityZone": aws.StringValue(instance.Placement.AvailabilityZone),
+		"privateIp":        aws.StringValue(instance.PrivateIpAddress),
+		"region":           m.Region,
+	})
+}
+
+func (m *IMDS) metadata(path string) (string, bool, error) {
+	instance, err := m.instance()
+	if err != nil {
+		return "", false, err
+	}
+	enis, err := m.enis()
+	if err != nil {
+		return "", false, err
+	}
+
+	switch path {
+	case "instance-id":
+		return m.InstanceID, true, nil
+	case "instance-type":
+		return aws.StringValue(instance.InstanceType), true, nil
+	case "placement/availability-zone":
+		return aws.StringValue(instance.Placement.AvailabilityZone), true, nil
+	case "local-ipv4":
+		return aws.StringValue(instance.PrivateIpAddress), true, nil
+	case "mac":
+		for _, eni := range enis {
+			if aws.Int64Value(eni.Attachment.DeviceIndex) == 0 {
+				return macAddress(eni), true, nil
+			}
+		}
+		return "", false, nil
+	case "network/interfaces/macs":
+		var macs []string
+		for _, eni := range enis {
+			macs = append(macs, macAddress(eni)+"/")
+		}
+		return strings.Join(macs, "\n"), true, nil
+	}
+
+	mac, key, ok := strings.Cut(strings.TrimPrefix(path, "network/interfaces/macs/"), "/")
+	if !ok {
+		return "", false, nil
+	}
+	for _, eni := range enis {
+		if macAddress(eni) == mac {
+			return m.eniMetadata(eni, key)
+		}
+	}
+	return "", false, nil
+}
+
+func (m *IMDS) eniMetadata(eni *ec2.NetworkInterface, key string) (string, bool, error) {
+	switch key {
+	case "interface-id":
+		return aws.StringValue(eni.NetworkInterfaceId), true, nil
+	case "device-number":
+		return strconv.FormatInt(aws.Int64Value(eni.Attachment.DeviceIndex), 10), true, nil
+	case "subnet-id":
+		return aws.StringValue(eni.SubnetId), true, nil
+	case "vpc-id":
+		return aws.StringValue(eni.VpcId), true, nil
+	case "security-group-ids":
+		var groups []string
+		for _, group := range eni.Groups {
+			groups = append(groups, aws.StringValue(group.GroupId))
+		}
+		return strings.Join(groups, "\n"), true, nil
+	case "local-ipv4s":
+		// The primary IP comes first
+		var ips []string
+		for _, ip := range eni.PrivateIpAddresses {
+			if aws.BoolValue(ip.Primary) {
+				ips = append([]string{aws.StringValue(ip.PrivateIpAddress)}, ips...)
+			} else {
+				ips = append(ips, aws.StringValue(ip.PrivateIpAddress))
+			}
+		}
+		return strings.Join(ips, "\n"), true, nil
+	case "ipv4-prefix":
+		if len(eni.Ipv4Prefixes) == 0 {
+			return "", false, nil
+		}
+		var prefixes []string
+		for _, prefix := range eni.Ipv4Prefixes {
+			prefixes = append(prefixes, aws.StringValue(prefix.Ipv4Prefix))
+		}
+		return strings.Join(prefixes, "\n"), true, nil
+	case "subnet-ipv4-cidr-block":
+		output, err := m.EC2.DescribeSubnets(&ec2.DescribeSubnetsInput{SubnetIds: []*string{eni.SubnetId}})
+		if err != nil || len(output.Subnets) == 0 {
+			return "", false, err
+		}
+		return aws.StringValue(output.Subnets[0].CidrBlock), true, nil
+	case "vpc-ipv4-cidr-blocks":
+		output, err := m.EC2.DescribeVpcs(&ec2.DescribeVpcsInput{VpcIds: []*string{eni.VpcId}})
+		if err != nil || len(output.Vpcs) == 0 {
+			return "", false, err
+		}
+		var cidrs []string
+		for _, association := range output.Vpcs[0].CidrBlockAssociationSet {
+			cidrs = append(cidrs, aws.StringValue(association.CidrBlock))
+		}
+		return strings.Join(cidrs, "\n"), true, nil
+	}
+	// IPv6 addresses and prefixes are not emulated
+	return "", false, nil
+}
+
+func (m *IMDS) instance() (*ec2.Instance, error) {
+	output, err := m.EC2.DescribeInstances(&ec2.DescribeInstancesInput{InstanceIds: []*string{aws.String(m.InstanceID)}})
+	if err != nil {
+		return nil, err
+	}
+	if len(output.Reservations) == 0 || len(output.Reservations[0].Instances) == 0 {
+		return nil, fmt.Errorf("instance %s not found", m.InstanceID)
+	}
+	return output.Reservations[0].Instances[0], nil
+}
+
+// enis returns the ENIs attached to the instance, by device number
+func (m *IMDS) enis() ([]*ec2.NetworkInterface, error) {
+	output, err := m.EC2.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("attachment.instance-id"), Values: []*string{aws.String(m.InstanceID)}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var enis []*ec2.NetworkInterface
+	for _, eni := range output.NetworkInterfaces {
+		if eni.Attachment != nil {
+			enis = append(enis, eni)
+		}
+	}
+	sort.Slice(enis, func(i, j int) bool {
+		return aws.Int64Value(enis[i].Attachment.DeviceIndex) < aws.Int64Value(enis[j].Attachment.DeviceIndex)
+	})
+	return enis, nil
+}
+
+// macAddress returns the MAC address of the ENI, or a stable one derived from its ID if the emulator sets none
+func macAddress(eni *ec2.NetworkInterface) string {
+	if mac := aws.StringValue(eni.MacAddress); mac != "" {
+		return mac
+	}
+	sum := sha256.Sum256([]byte(aws.StringValue(eni.NetworkInterfaceId)))
+	// Locally administered, unicast
+	sum[0] = sum[0]&0xfe | 0x02
+	return net.HardwareAddr(sum[:6]).String()
+}
@@ -0,0 +1,116 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package component
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/ec2metadata"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeEC2 serves the calls made by IMDS from fixed state
+type fakeEC2 struct {
+	ec2iface.EC2API
+	instance *ec2.Instance
+	enis     []*ec2.NetworkInterface
+}
+
+func (f *fakeEC2) DescribeInstances(*ec2.DescribeInstancesInput) (*ec2.DescribeInstancesOutput, error) {
+	return &ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: []*ec2.Instance{f.instance}}}}, nil
+}
+
+func (f *fakeEC2) DescribeNetworkInterfaces(*ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: f.enis}, nil
+}
+
+func (f *fakeEC2) DescribeSubnets(*ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	return &ec2.DescribeSubnetsOutput{Subnets: []*ec2.Subnet{{CidrBlock: aws.String("10.0.0.0/24")}}}, nil
+}
+
+func (f *fakeEC2) DescribeVpcs(*ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error) {
+	return &ec2.DescribeVpcsOutput{Vpcs: []*ec2.Vpc{{
+		CidrBlockAssociationSet: []*ec2.VpcCidrBlockAssociation{{CidrBlock: aws.String("10.0.0.0/16")}},
+	}}}, nil
+}
+
+func TestIMDS(t *testing.T) {
+	eni := func(id string, device int64, ips ...string) *ec2.NetworkInterface {
+		eni := &ec2.NetworkInterface{
+			NetworkInterfaceId: aws.String(id),
+			Attachment:         &ec2.NetworkInterfaceAttachment{DeviceIndex: aws.Int64(device)},
+			SubnetId:           aws.String("subnet-1"),
+			VpcId:              aws.String("vpc-1"),
+			Groups:             []*ec2.GroupIdentifier{{GroupId: aws.String("sg-1")}, {GroupId: aws.String("sg-2")}},
+		}
+		for i, ip := range ips {
+			eni.PrivateIpAddresses = append(eni.PrivateIpAddresses,
+				&ec2.NetworkInterfacePrivateIpAddress{PrivateIpAddress: aws.String(ip), Primary: aws.Bool(i == len(ips)-1)})
+		}
+		return eni
+	}
+	primary := eni("eni-1", 0, "10.0.0.10")
+	primary.MacAddress = aws.String("02:00:00:00:00:01")
+	secondary := eni("eni-2", 1, "10.0.0.21", "10.0.0.20")
+	imds := &IMDS{
+		EC2: &fakeEC2{
+			instance: &ec2.Instance{
+				InstanceType:     aws.String("t3.medium"),
+				Placement:        &ec2.Placement{AvailabilityZone: aws.String("us-west-2a")},
+				PrivateIpAddress: aws.String("10.0.0.10"),
+			},
+			enis: []*ec2.NetworkInterface{secondary, primary},
+		},
+		InstanceID: "i-1",
+		Region:     "us-west-2",
+	}
+	server := httptest.NewServer(imds)
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(aws.NewConfig().WithEndpoint(server.URL).WithRegion("us-west-2")))
+	client := ec2metadata.New(sess)
+	get := func(path string) string {
+		value, err := client.GetMetadata(path)
+		require.NoError(t, err, path)
+		return value
+	}
+
+	region, err := client.Region()
+	require.NoError(t, err)
+	assert.Equal(t, "us-west-2", region)
+	assert.Equal(t, "i-1", get("instance-id"))
+	assert.Equal(t, "t3.medium", get("instance-type"))
+	assert.Equal(t, "us-west-2a", get("placement/availability-zone"))
+	assert.Equal(t, "02:00:00:00:00:01", get("mac"))
+
+	// The ENIs are listed by device number, the secondary ENI has a MAC address derived from its ID
+	secondaryMAC := macAddress(secondary)
+	assert.Equal(t, "02:00:00:00:00:01/\n"+secondaryMAC+"/", get("network/interfaces/macs"))
+	prefix := "network/interfaces/macs/" + secondaryMAC + "/"
+	assert.Equal(t, "eni-2", get(prefix+"interface-id"))
+	assert.Equal(t, "1", get(prefix+"device-number"))
+	assert.Equal(t, "sg-1\nsg-2", get(prefix+"security-group-ids"))
+	assert.Equal(t, "10.0.0.20\n10.0.0.21", get(prefix+"local-ipv4s"))
+	assert.Equal(t, "10.0.0.0/24", get(prefix+"subnet-ipv4-cidr-block"))
+	assert.Equal(t, "10.0.0.0/16", get(prefix+"vpc-ipv4-cidr-blocks"))
+
+	_, err = client.GetMetadata(prefix + "ipv4-prefix")
+	assert.Error(t, err)
+}
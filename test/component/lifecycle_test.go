@@ -0,0 +1,134 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+//go:build component
+
+package component
+
+import (
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+)
+
+const (
+	defaultEndpoint = "http://localhost:4566"
+	region          = "us-west-2"
+)
+
+// newEmulatedInstance creates a VPC, a subnet, a security group and an instance in the EC2 emulator, and serves the
+// instance metadata of the instance to the AWS SDK of this process
+func newEmulatedInstance(t *testing.T) *ec2.EC2 {
+	endpoint := os.Getenv("LOCALSTACK_ENDPOINT")
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_REGION", region)
+	t.Setenv("AWS_EC2_ENDPOINT", endpoint)
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithEndpoint(endpoint).
+		WithRegion(region).
+		WithCredentials(credentials.NewStaticCredentials("test", "test", ""))))
+	svc := ec2.New(sess)
+
+	vpc, err := svc.CreateVpc(&ec2.CreateVpcInput{CidrBlock: aws.String("10.0.0.0/16")})
+	require.NoError(t, err)
+	t.Cleanup(func() { svc.DeleteVpc(&ec2.DeleteVpcInput{VpcId: vpc.Vpc.VpcId}) })
+	subnet, err := svc.CreateSubnet(&ec2.CreateSubnetInput{
+		VpcId:            vpc.Vpc.VpcId,
+		CidrBlock:        aws.String("10.0.0.0/24"),
+		AvailabilityZone: aws.String(region + "a"),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { svc.DeleteSubnet(&ec2.DeleteSubnetInput{SubnetId: subnet.Subnet.SubnetId}) })
+	sg, err := svc.CreateSecurityGroup(&ec2.CreateSecurityGroupInput{
+		GroupName:   aws.String(t.Name()),
+		Description: aws.String("aws-node component test"),
+		VpcId:       vpc.Vpc.VpcId,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { svc.DeleteSecurityGroup(&ec2.DeleteSecurityGroupInput{GroupId: sg.GroupId}) })
+
+	// The emulator only runs instances of the images it knows about
+	images, err := svc.DescribeImages(&ec2.DescribeImagesInput{})
+	require.NoError(t, err)
+	require.NotEmpty(t, images.Images, "the EC2 emulator has no images")
+	reservation, err := svc.RunInstances(&ec2.RunInstancesInput{
+		ImageId:          images.Images[0].ImageId,
+		InstanceType:     aws.String("t3.medium"),
+		SubnetId:         subnet.Subnet.SubnetId,
+		SecurityGroupIds: []*string{sg.GroupId},
+		MinCount:         aws.Int64(1),
+		MaxCount:         aws.Int64(1),
+	})
+	require.NoError(t, err)
+	instanceID := reservation.Instances[0].InstanceId
+	t.Cleanup(func() { svc.TerminateInstances(&ec2.TerminateInstancesInput{InstanceIds: []*string{instanceID}}) })
+
+	imds := httptest.NewServer(&IMDS{EC2: svc, InstanceID: aws.StringValue(instanceID), Region: region})
+	t.Cleanup(imds.Close)
+	t.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", imds.URL)
+	return svc
+}
+
+// TestENILifecycle allocates and frees ENIs and IPs the way ipamd does on a node
+func TestENILifecycle(t *testing.T) {
+	svc := newEmulatedInstance(t)
+
+	cache, err := awsutils.New(false, false, true, true, false)
+	require.NoError(t, err)
+	enis, err := cache.GetAttachedENIs()
+	require.NoError(t, err)
+	require.Len(t, enis, 1)
+	primaryENI := cache.GetPrimaryENI()
+	assert.Equal(t, primaryENI, enis[0].ENIID)
+
+	// A new ENI shows up in the instance metadata with its IPs
+	eniID, err := cache.AllocENI(false, nil, "", 3)
+	require.NoError(t, err)
+	eni, err := cache.WaitForENIAndIPsAttached(eniID, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 1, eni.DeviceNumber)
+	assert.Len(t, eni.IPv4Addresses, 4)
+
+	// Secondary IPs are added and removed
+	output, err := cache.AllocIPAddresses(eniID, 2)
+	require.NoError(t, err)
+	require.Len(t, output.AssignedPrivateIpAddresses, 2)
+	eni, err = cache.WaitForENIAndIPsAttached(eniID, 5)
+	require.NoError(t, err)
+	assert.Len(t, eni.IPv4Addresses, 6)
+	require.NoError(t, cache.DeallocIPAddresses(eniID, []string{aws.StringValue(output.AssignedPrivateIpAddresses[0].PrivateIpAddress)}))
+
+	result, err := cache.DescribeAllENIs()
+	require.NoError(t, err)
+	assert.Len(t, result.ENIMetadata, 2)
+	assert.NotEmpty(t, result.TagMap[eniID], "the ENI is tagged with its node")
+
+	// The ENI is gone once freed
+	require.NoError(t, cache.FreeENI(eniID))
+	_, err = svc.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{NetworkInterfaceIds: []*string{aws.String(eniID)}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,202 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+// Package artifacts collects the state of the CNI on the nodes of a failed spec, so that flakes can be diagnosed
+// without running the spec again
+package artifacts
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+)
+
+const (
+	awsNodeLabelKey = "k8s-app"
+	// The logs are read from the aws-node container, which mounts the log directory of the host
+	hostLogDir = "/host/var/log/aws-routed-eni"
+	// maxLogLines bounds the size of the logs of a node, which the earlier specs of the suite also wrote to
+	maxLogLines          = "5000"
+	introspectionAddress = "localhost:61679"
+)
+
+// The introspection endpoints that are saved, from the host network of the node
+var introspectionPaths = []string{
+	"/v1/enis",
+	"/v1/eni-configs",
+	"/v1/ipamd-env-settings",
+	"/v1/networkutils-env-settings",
+	"/v1/cni-add-stats",
+}
+
+var unsafePathChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// CollectOnFailure saves the artifacts of the nodes of the current spec under the --artifacts-dir flag, if the spec
+// failed. Suites call it from a JustAfterEach, so that the pods of the spec are not deleted yet.
+func CollectOnFailure(f *framework.Framework) {
+	if f == nil || f.Options.ArtifactsDir == "" || !CurrentSpecReport().Failed() {
+		return
+	}
+	dir := filepath.Join(f.Options.ArtifactsDir, unsafePathChars.ReplaceAllString(CurrentSpecReport().FullText(), "_"))
+	By(fmt.Sprintf("collecting the artifacts of the failed spec in %s", dir))
+	if err := Collect(f, dir); err != nil {
+		GinkgoWriter.Printf("failed to collect the artifacts: %v\n", err)
+	}
+}
+
+// Collect saves the ipamd logs, introspection snapshots, iptables rules and ENIs of the nodes that run the pods of
+// the test namespace, or of all the test nodes if there are none, in a directory per node
+func Collect(f *framework.Framework, dir string) error {
+	nodes, err := affectedNodes(f)
+	if err != nil {
+		return err
+	}
+	awsNodePods, err := f.K8sResourceManagers.PodManager().
+		GetPodsWithLabelSelector(awsNodeLabelKey, utils.AwsNodeName)
+	if err != nil {
+		return fmt.Errorf("failed to list the aws-node pods: %v", err)
+	}
+
+	for _, node := range nodes {
+		nodeDir := filepath.Join(dir, node.Name)
+		if err := os.MkdirAll(nodeDir, 0755); err != nil {
+			return err
+		}
+		for _, pod := range awsNodePods.Items {
+			if pod.Spec.NodeName == node.Name {
+				collectFromAWSNode(f, pod, nodeDir)
+			}
+		}
+		collectIntrospection(f, node, nodeDir)
+		collectENIs(f, node, nodeDir)
+	}
+	return nil
+}
+
+func affectedNodes(f *framework.Framework) ([]corev1.Node, error) {
+	nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the test nodes: %v", err)
+	}
+	podList, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelectorMap(map[string]string{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods: %v", err)
+	}
+	testNodes := map[string]bool{}
+	for _, pod := range podList.Items {
+		if pod.Namespace == utils.DefaultTestNamespace {
+			testNodes[pod.Spec.NodeName] = true
+		}
+	}
+
+	var nodes []corev1.Node
+	for _, node := range nodeList.Items {
+		if testNodes[node.Name] {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		return nodeList.Items, nil
+	}
+	return nodes, nil
+}
+
+func collectFromAWSNode(f *framework.Framework, pod corev1.Pod, nodeDir string) {
+	commands := map[string][]string{
+		"ipamd.log":          {"tail", "-n", maxLogLines, hostLogDir + "/ipamd.log"},
+		"plugin.log":         {"tail", "-n", maxLogLines, hostLogDir + "/plugin.log"},
+		"iptables-save.txt":  {"iptables-save", "-c"},
+		"ip6tables-save.txt": {"ip6tables-save", "-c"},
+	}
+	for file, command := range commands {
+		stdout, stderr, err := f.K8sResourceManagers.PodManager().PodExec(pod.Namespace, pod.Name, command)
+		if err != nil {
+			stdout += fmt.Sprintf("\n%s failed: %v\n%s", strings.Join(command, " "), err, stderr)
+		}
+		writeArtifact(filepath.Join(nodeDir, file), stdout)
+	}
+}
+
+// collectIntrospection reads the introspection endpoints from a host network pod on the node, since the aws-node
+// image has no HTTP client and ipamd only listens on localhost
+func collectIntrospection(f *framework.Framework, node corev1.Node, nodeDir string) {
+	var script []string
+	for _, path := range introspectionPaths {
+		script = append(script, fmt.Sprintf("echo '### %s'; curl -s http://%s%s; echo", path, introspectionAddress, path))
+	}
+	container := manifest.NewCurlContainer().
+		Command([]string{"sh", "-c", strings.Join(script, "; ")}).
+		Build()
+	pod := manifest.NewDefaultPodBuilder().
+		Name(fmt.Sprintf("collect-introspection-%s", unsafePathChars.ReplaceAllString(node.Name, "-"))).
+		Namespace(utils.AwsNodeNamespace).
+		Container(container).
+		NodeName(node.Name).
+		HostNetwork(true).
+		Build()
+
+	completedPod, err := f.K8sResourceManagers.PodManager().CreateAndWaitTillPodCompleted(pod)
+	if err != nil {
+		writeArtifact(filepath.Join(nodeDir, "introspection.txt"), fmt.Sprintf("failed to run the introspection pod: %v", err))
+	} else {
+		logs, err := f.K8sResourceManagers.PodManager().PodLogs(completedPod.Namespace, completedPod.Name)
+		if err != nil {
+			logs += fmt.Sprintf("\nfailed to read the logs of the introspection pod: %v", err)
+		}
+		writeArtifact(filepath.Join(nodeDir, "introspection.txt"), logs)
+	}
+	if err := f.K8sResourceManagers.PodManager().DeleteAndWaitTillPodDeleted(pod); err != nil {
+		GinkgoWriter.Printf("failed to delete the introspection pod on %s: %v\n", node.Name, err)
+	}
+}
+
+func collectENIs(f *framework.Framework, node corev1.Node, nodeDir string) {
+	file := filepath.Join(nodeDir, "describe-network-interfaces.json")
+	instance, err := f.CloudServices.EC2().DescribeInstance(k8sUtils.GetInstanceIDFromNode(node))
+	if err != nil {
+		writeArtifact(file, fmt.Sprintf("failed to describe the instance of %s: %v", node.Name, err))
+		return
+	}
+	var eniIDs []string
+	for _, eni := range instance.NetworkInterfaces {
+		eniIDs = append(eniIDs, *eni.NetworkInterfaceId)
+	}
+	output, err := f.CloudServices.EC2().DescribeNetworkInterface(eniIDs)
+	if err != nil {
+		writeArtifact(file, fmt.Sprintf("failed to describe the ENIs %v: %v", eniIDs, err))
+		return
+	}
+	content, err := json.MarshalIndent(output.NetworkInterfaces, "", "  ")
+	if err != nil {
+		writeArtifact(file, fmt.Sprintf("failed to encode the ENIs: %v", err))
+		return
+	}
+	writeArtifact(file, string(content))
+}
+
+func writeArtifact(path string, content string) {
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		GinkgoWriter.Printf("failed to write %s: %v\n", path, err)
+	}
+}
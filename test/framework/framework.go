@@ -50,6 +50,7 @@ type Framework struct {
 func New(options Options) *Framework {
 	err := options.Validate()
 	Expect(err).ToNot(HaveOccurred())
+	utils.DefaultTestNamespace = options.TestNamespace
 
 	// Create config for clients that need to access subresources
 	config, err := clientcmd.BuildConfigFromFlags("", options.KubeConfig)
@@ -98,14 +99,29 @@ func New(options Options) *Framework {
 
 	cloudConfig := aws.CloudConfig{Region: options.AWSRegion, VpcID: options.AWSVPCID,
 		EKSEndpoint: options.EKSEndpoint}
+	cloudServices := aws.NewCloud(cloudConfig)
+
+	if options.IPFamily == "" {
+		options.IPFamily = discoverIPFamily(cloudServices, options.ClusterName)
+	}
 
 	return &Framework{
 		Options:             options,
 		K8sClient:           k8sClient,
-		CloudServices:       aws.NewCloud(cloudConfig),
+		CloudServices:       cloudServices,
 		K8sResourceManagers: k8s.NewResourceManager(k8sClient, clientset, k8sSchema, config),
 		InstallationManager: controller.NewDefaultInstallationManager(
 			helm.NewDefaultReleaseManager(options.KubeConfig)),
 		Logger: utils.NewGinkgoLogger(),
 	}
 }
+
+// discoverIPFamily returns the IP family of the EKS cluster, or IPv4 for clusters that are not EKS clusters
+func discoverIPFamily(cloudServices aws.Cloud, clusterName string) string {
+	cluster, err := cloudServices.EKS().DescribeCluster(clusterName)
+	if err != nil || cluster.Cluster.KubernetesNetworkConfig == nil {
+		log.Printf("failed to read the IP family of cluster %s, assuming %s: %v", clusterName, IPFamilyIPv4, err)
+		return IPFamilyIPv4
+	}
+	return *cluster.Cluster.KubernetesNetworkConfig.IpFamily
+}
@@ -15,9 +15,12 @@ package framework
 
 import (
 	"flag"
+	"time"
 
 	"github.com/pkg/errors"
 	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 )
 
 var GlobalOptions Options
@@ -49,8 +52,17 @@ type Options struct {
 	NgK8SVersion       string
 	TestImageRegistry  string
 	PublishCWMetrics   bool
+	IPFamily           string
+	TestNamespace      string
+	FixtureMaxAge      time.Duration
+	ArtifactsDir       string
 }
 
+const (
+	IPFamilyIPv4 = "ipv4"
+	IPFamilyIPv6 = "ipv6"
+)
+
 func (options *Options) BindFlags() {
 	flag.StringVar(&options.KubeConfig, "cluster-kubeconfig", "", "Path to kubeconfig containing embedded authinfo (required)")
 	flag.StringVar(&options.ClusterName, "cluster-name", "", `Kubernetes cluster name (required)`)
@@ -65,7 +77,7 @@ func (options *Options) BindFlags() {
 	flag.StringVar(&options.TargetManifest, "target-manifest-file", "", "Target CNI manifest, can be local file path or remote Url")
 	flag.StringVar(&options.CalicoVersion, "calico-version", "v3.26.1", "calico version to be tested")
 	flag.StringVar(&options.ContainerRuntime, "container-runtime", "", "Optionally can specify it as 'containerd' for the test nodes")
-	flag.StringVar(&options.InstanceType, "instance-type", "amd64", "Optionally specify instance type as arm64 for the test nodes")
+	flag.StringVar(&options.InstanceType, "instance-type", "amd64", "Optionally specify the architecture of the test nodes as arm64, for Graviton instances")
 	flag.BoolVar(&options.InstallCalico, "install-calico", true, "Install Calico operator before running tests")
 	flag.StringVar(&options.PublicSubnets, "public-subnets", "", "Comma separated list of public subnets (optional, if specified you must specify all of public/private-subnets, public-route-table-id,  and availability-zones)")
 	flag.StringVar(&options.PrivateSubnets, "private-subnets", "", "Comma separated list of private subnets (optional, if specified you must specify all of public/private-subnets, public-route-table-id,  and availability-zones)")
@@ -74,6 +86,10 @@ func (options *Options) BindFlags() {
 	flag.StringVar(&options.NgK8SVersion, "ng-kubernetes-version", "1.25", `Kubernetes version for self-managed node groups (optional, default is "1.25")`)
 	flag.StringVar(&options.TestImageRegistry, "test-image-registry", "617930562442.dkr.ecr.us-west-2.amazonaws.com", `AWS registry where the e2e test images are stored`)
 	flag.BoolVar(&options.PublishCWMetrics, "publish-cw-metrics", false, "Option to publish cloudwatch metrics from the test.")
+	flag.StringVar(&options.IPFamily, "ip-family", "", `IP family of the cluster, "ipv4" or "ipv6" (optional, read from the EKS cluster by default)`)
+	flag.StringVar(&options.TestNamespace, "test-namespace", utils.DefaultTestNamespace, "Namespace of the test workloads, which must be unique to each suite running in parallel against the cluster")
+	flag.StringVar(&options.ArtifactsDir, "artifacts-dir", "artifacts", "Directory where the logs, iptables rules and ENIs of the nodes of failed specs are saved, nothing is saved if empty")
+	flag.DurationVar(&options.FixtureMaxAge, "fixture-max-age", 3*time.Hour, "Age after which the VPC fixtures left by earlier runs are deleted")
 }
 
 func (options *Options) Validate() error {
@@ -92,5 +108,19 @@ func (options *Options) Validate() error {
 	if len(options.TestImageRegistry) == 0 {
 		return errors.Errorf("%s must be set!", "test-image-registry")
 	}
+	if options.InstanceType != utils.NodeArchAMD64 && options.InstanceType != utils.NodeArchARM64 {
+		return errors.Errorf("%s must be %s or %s", "instance-type", utils.NodeArchAMD64, utils.NodeArchARM64)
+	}
+	if len(options.TestNamespace) == 0 {
+		return errors.Errorf("%s must be set!", "test-namespace")
+	}
+	if options.IPFamily != "" && options.IPFamily != IPFamilyIPv4 && options.IPFamily != IPFamilyIPv6 {
+		return errors.Errorf("%s must be %s or %s", "ip-family", IPFamilyIPv4, IPFamilyIPv6)
+	}
 	return nil
 }
+
+// IsIPv6 returns whether pods get IPv6 addresses in the cluster under test
+func (options *Options) IsIPv6() bool {
+	return options.IPFamily == IPFamilyIPv6
+}
@@ -58,6 +58,8 @@ type TrafficTest struct {
 	ValidateClientPods func(list v1.PodList) error
 	// Boolean that indicates if IPv6 mode is enabled
 	IsV6Enabled bool
+	// If set, the client pods run on this node, for instance to test traffic between pods on the same node
+	ClientNodeName string
 }
 
 // Tests traffic by creating multiple server pods using a deployment and multiple client pods
@@ -202,14 +204,16 @@ func (t *TrafficTest) startTrafficClient(serverAddList string, metricServerIP st
 		}).
 		Build()
 
-	clientJob := manifest.NewDefaultJobBuilder().
+	clientJobBuilder := manifest.NewDefaultJobBuilder().
 		Name("traffic-client-regular-pods").
 		Parallelism(t.ClientCount).
 		Container(trafficClientContainer).
-		PodLabels(t.ClientPodLabelKey, t.ClientPodLabelVal).
-		Build()
+		PodLabels(t.ClientPodLabelKey, t.ClientPodLabelVal)
+	if t.ClientNodeName != "" {
+		clientJobBuilder.NodeName(t.ClientNodeName)
+	}
 
-	return t.Framework.K8sResourceManagers.JobManager().CreateAndWaitTillJobCompleted(clientJob)
+	return t.Framework.K8sResourceManagers.JobManager().CreateAndWaitTillJobCompleted(clientJobBuilder.Build())
 }
 
 func (t *TrafficTest) startMetricServerPod() (*v1.Pod, error) {
@@ -36,7 +36,14 @@ type EC2 interface {
 	TerminateInstance(instanceIDs []string) error
 	DisAssociateVPCCIDRBlock(associationID string) error
 	DescribeSubnet(subnetID string) (*ec2.DescribeSubnetsOutput, error)
+	DescribeSubnetsWithTagKey(vpcID string, tagKey string) (*ec2.DescribeSubnetsOutput, error)
+	DescribeNetworkInterfacesInSubnet(subnetID string) (*ec2.DescribeNetworkInterfacesOutput, error)
+	DescribeNetworkInterfacesWithTag(tagKey string, tagValue string) (*ec2.DescribeNetworkInterfacesOutput, error)
+	DescribeBranchNetworkInterfaces(vpcID string, securityGroupID string) (*ec2.DescribeNetworkInterfacesOutput, error)
+	DeleteNetworkInterface(interfaceID string) error
 	CreateSubnet(cidrBlock string, vpcID string, az string) (*ec2.CreateSubnetOutput, error)
+	AssociateVPCIPv6CIDRBlock(vpcID string) (*ec2.AssociateVpcCidrBlockOutput, error)
+	CreateDualStackSubnet(cidrBlock string, ipv6CidrBlock string, vpcID string, az string) (*ec2.CreateSubnetOutput, error)
 	DeleteSubnet(subnetID string) error
 	DescribeRouteTables(subnetID string) (*ec2.DescribeRouteTablesOutput, error)
 	DescribeRouteTablesWithVPCID(vpcID string) (*ec2.DescribeRouteTablesOutput, error)
@@ -288,6 +295,34 @@ func (d *defaultEC2) CreateSubnet(cidrBlock string, vpcID string, az string) (*e
 	return d.EC2API.CreateSubnet(createSubnetInput)
 }
 
+// AssociateVPCIPv6CIDRBlock associates an Amazon provided /56 IPv6 CIDR block with the VPC
+func (d *defaultEC2) AssociateVPCIPv6CIDRBlock(vpcID string) (*ec2.AssociateVpcCidrBlockOutput, error) {
+	associateVPCCidrBlockInput := &ec2.AssociateVpcCidrBlockInput{
+		AmazonProvidedIpv6CidrBlock: aws.Bool(true),
+		VpcId:                       aws.String(vpcID),
+	}
+	return d.EC2API.AssociateVpcCidrBlock(associateVPCCidrBlockInput)
+}
+
+// CreateDualStackSubnet creates a subnet with an IPv4 and an IPv6 CIDR block, and IPv6 addresses assigned to new ENIs
+func (d *defaultEC2) CreateDualStackSubnet(cidrBlock string, ipv6CidrBlock string, vpcID string, az string) (*ec2.CreateSubnetOutput, error) {
+	createSubnetInput := &ec2.CreateSubnetInput{
+		AvailabilityZone: aws.String(az),
+		CidrBlock:        aws.String(cidrBlock),
+		Ipv6CidrBlock:    aws.String(ipv6CidrBlock),
+		VpcId:            aws.String(vpcID),
+	}
+	output, err := d.EC2API.CreateSubnet(createSubnetInput)
+	if err != nil {
+		return nil, err
+	}
+	_, err = d.EC2API.ModifySubnetAttribute(&ec2.ModifySubnetAttributeInput{
+		AssignIpv6AddressOnCreation: &ec2.AttributeBooleanValue{Value: aws.Bool(true)},
+		SubnetId:                    output.Subnet.SubnetId,
+	})
+	return output, err
+}
+
 func (d *defaultEC2) DescribeSubnet(subnetID string) (*ec2.DescribeSubnetsOutput, error) {
 	describeSubnetInput := &ec2.DescribeSubnetsInput{
 		SubnetIds: aws.StringSlice([]string{subnetID}),
@@ -295,6 +330,75 @@ func (d *defaultEC2) DescribeSubnet(subnetID string) (*ec2.DescribeSubnetsOutput
 	return d.EC2API.DescribeSubnets(describeSubnetInput)
 }
 
+// DescribeSubnetsWithTagKey returns the subnets of the VPC that have a tag with the key, whatever its value
+func (d *defaultEC2) DescribeSubnetsWithTagKey(vpcID string, tagKey string) (*ec2.DescribeSubnetsOutput, error) {
+	describeSubnetInput := &ec2.DescribeSubnetsInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: aws.StringSlice([]string{vpcID}),
+			},
+			{
+				Name:   aws.String("tag-key"),
+				Values: aws.StringSlice([]string{tagKey}),
+			},
+		},
+	}
+	return d.EC2API.DescribeSubnets(describeSubnetInput)
+}
+
+func (d *defaultEC2) DescribeNetworkInterfacesInSubnet(subnetID string) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	describeNetworkInterfaceInput := &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("subnet-id"),
+				Values: aws.StringSlice([]string{subnetID}),
+			},
+		},
+	}
+	return d.EC2API.DescribeNetworkInterfaces(describeNetworkInterfaceInput)
+}
+
+func (d *defaultEC2) DescribeNetworkInterfacesWithTag(tagKey string, tagValue string) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	describeNetworkInterfaceInput := &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:" + tagKey),
+				Values: aws.StringSlice([]string{tagValue}),
+			},
+		},
+	}
+	return d.EC2API.DescribeNetworkInterfaces(describeNetworkInterfaceInput)
+}
+
+func (d *defaultEC2) DescribeBranchNetworkInterfaces(vpcID string, securityGroupID string) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	describeNetworkInterfaceInput := &ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("vpc-id"),
+				Values: aws.StringSlice([]string{vpcID}),
+			},
+			{
+				Name:   aws.String("group-id"),
+				Values: aws.StringSlice([]string{securityGroupID}),
+			},
+			{
+				Name:   aws.String("interface-type"),
+				Values: aws.StringSlice([]string{"branch"}),
+			},
+		},
+	}
+	return d.EC2API.DescribeNetworkInterfaces(describeNetworkInterfaceInput)
+}
+
+func (d *defaultEC2) DeleteNetworkInterface(interfaceID string) error {
+	deleteNetworkInterfaceInput := &ec2.DeleteNetworkInterfaceInput{
+		NetworkInterfaceId: aws.String(interfaceID),
+	}
+	_, err := d.EC2API.DeleteNetworkInterface(deleteNetworkInterfaceInput)
+	return err
+}
+
 func (d *defaultEC2) DescribeRouteTablesWithVPCID(vpcID string) (*ec2.DescribeRouteTablesOutput, error) {
 	describeRouteTableInput := &ec2.DescribeRouteTablesInput{
 		Filters: []*ec2.Filter{
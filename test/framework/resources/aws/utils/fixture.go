@@ -0,0 +1,274 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/apparentlymart/go-cidr/cidr"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+)
+
+const (
+	// The resources of a VPC fixture are tagged, so that the fixtures left by an interrupted run can be found and
+	// deleted by the next one
+	FixtureTagKey                = "vpc-cni-test/fixture"
+	FixtureCreatedAtTagKey       = "vpc-cni-test/created-at"
+	FixtureCIDRAssociationTagKey = "vpc-cni-test/cidr-association"
+
+	// The secondary CIDRs of the fixtures are /16 blocks of the shared address space, which AWS allows as secondary
+	// CIDR of any VPC
+	fixtureCIDRPool      = "100.64.0.0/10"
+	fixtureCIDRPrefixLen = 16
+	// maxFixtureCIDRAttempts bounds the retries when a suite running in parallel associates the same CIDR first
+	maxFixtureCIDRAttempts = 5
+)
+
+type VPCFixtureProperties struct {
+	// Name identifies the fixture in the tags of its resources
+	Name string
+	// A subnet is created in each availability zone
+	AvailabilityZones []string
+	// SubnetPrefixLen is the prefix length of the subnets, /24 by default
+	SubnetPrefixLen int
+	// RouteTableID is associated with the subnets, if set
+	RouteTableID string
+	// CIDR is associated with the VPC if set, instead of a free /16 of 100.64.0.0/10
+	CIDR *net.IPNet
+}
+
+// VPCFixture is a secondary CIDR of the cluster VPC, with subnets that belong to a single suite, so that suites running
+// in parallel do not share subnets or CIDRs
+type VPCFixture struct {
+	Name              string
+	CIDR              *net.IPNet
+	CIDRAssociationID string
+	// SubnetIDs are the subnets of the fixture by availability zone
+	SubnetIDs map[string]string
+}
+
+// CreateVPCFixture associates a secondary CIDR with the cluster VPC and creates the subnets of the fixture. The
+// fixtures older than the --fixture-max-age flag are deleted first. The caller must call DeleteVPCFixture, even if
+// creating the fixture failed, to delete what was created.
+func CreateVPCFixture(f *framework.Framework, properties VPCFixtureProperties) (*VPCFixture, error) {
+	if err := DeleteOrphanedVPCFixtures(f, f.Options.FixtureMaxAge); err != nil {
+		f.Logger.Error(err, "failed to delete the orphaned VPC fixtures")
+	}
+	if properties.SubnetPrefixLen == 0 {
+		properties.SubnetPrefixLen = 24
+	}
+
+	fixture := &VPCFixture{
+		Name:      properties.Name,
+		SubnetIDs: map[string]string{},
+	}
+	if err := fixture.associateCIDR(f, properties.CIDR); err != nil {
+		return fixture, err
+	}
+	ones, _ := fixture.CIDR.Mask.Size()
+	if properties.SubnetPrefixLen < ones {
+		return fixture, fmt.Errorf("subnet prefix length /%d is shorter than the fixture CIDR %s",
+			properties.SubnetPrefixLen, fixture.CIDR)
+	}
+
+	tags := []*ec2.Tag{
+		{Key: aws.String("Name"), Value: aws.String(fmt.Sprintf("vpc-cni-test-%s", properties.Name))},
+		{Key: aws.String(FixtureTagKey), Value: aws.String(properties.Name)},
+		{Key: aws.String(FixtureCreatedAtTagKey), Value: aws.String(time.Now().UTC().Format(time.RFC3339))},
+		{Key: aws.String(FixtureCIDRAssociationTagKey), Value: aws.String(fixture.CIDRAssociationID)},
+	}
+	for i, az := range properties.AvailabilityZones {
+		subnetCidr, err := cidr.Subnet(fixture.CIDR, properties.SubnetPrefixLen-ones, i)
+		if err != nil {
+			return fixture, err
+		}
+		createSubnetOutput, err := f.CloudServices.EC2().CreateSubnet(subnetCidr.String(), f.Options.AWSVPCID, az)
+		if err != nil {
+			return fixture, fmt.Errorf("failed to create subnet %s in %s: %v", subnetCidr, az, err)
+		}
+		subnetID := *createSubnetOutput.Subnet.SubnetId
+		fixture.SubnetIDs[az] = subnetID
+
+		if _, err := f.CloudServices.EC2().CreateTags([]string{subnetID}, tags); err != nil {
+			return fixture, fmt.Errorf("failed to tag subnet %s: %v", subnetID, err)
+		}
+		if properties.RouteTableID != "" {
+			err = f.CloudServices.EC2().AssociateRouteTableToSubnet(properties.RouteTableID, subnetID)
+			if err != nil {
+				return fixture, fmt.Errorf("failed to associate route table with subnet %s: %v", subnetID, err)
+			}
+		}
+	}
+	return fixture, nil
+}
+
+// associateCIDR associates the CIDR with the VPC, or the first /16 of the pool that does not overlap the CIDRs of the
+// VPC. Another suite may associate the same /16 first, then the next free one is tried.
+func (fixture *VPCFixture) associateCIDR(f *framework.Framework, cidrRange *net.IPNet) error {
+	_, pool, _ := net.ParseCIDR(fixtureCIDRPool)
+	poolOnes, _ := pool.Mask.Size()
+
+	var err error
+	for attempt := 0; attempt < maxFixtureCIDRAttempts; attempt++ {
+		candidate := cidrRange
+		if candidate == nil {
+			var vpcCIDRs []*net.IPNet
+			vpcCIDRs, err = associatedVPCCIDRs(f)
+			if err != nil {
+				return err
+			}
+			candidate = freeCIDR(pool, fixtureCIDRPrefixLen-poolOnes, vpcCIDRs)
+			if candidate == nil {
+				return fmt.Errorf("no free /%d left in %s", fixtureCIDRPrefixLen, fixtureCIDRPool)
+			}
+		}
+
+		var association *ec2.AssociateVpcCidrBlockOutput
+		association, err = f.CloudServices.EC2().AssociateVPCCIDRBlock(f.Options.AWSVPCID, candidate.String())
+		if err == nil {
+			fixture.CIDR = candidate
+			fixture.CIDRAssociationID = *association.CidrBlockAssociation.AssociationId
+			return nil
+		}
+		if cidrRange != nil {
+			break
+		}
+	}
+	return fmt.Errorf("failed to associate a CIDR with VPC %s: %v", f.Options.AWSVPCID, err)
+}
+
+func associatedVPCCIDRs(f *framework.Framework) ([]*net.IPNet, error) {
+	describeVPCOutput, err := f.CloudServices.EC2().DescribeVPC(f.Options.AWSVPCID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe VPC %s: %v", f.Options.AWSVPCID, err)
+	}
+	var vpcCIDRs []*net.IPNet
+	for _, vpc := range describeVPCOutput.Vpcs {
+		for _, association := range vpc.CidrBlockAssociationSet {
+			state := aws.StringValue(association.CidrBlockState.State)
+			if state == ec2.VpcCidrBlockStateCodeDisassociated || state == ec2.VpcCidrBlockStateCodeFailed {
+				continue
+			}
+			if _, vpcCIDR, err := net.ParseCIDR(aws.StringValue(association.CidrBlock)); err == nil {
+				vpcCIDRs = append(vpcCIDRs, vpcCIDR)
+			}
+		}
+	}
+	return vpcCIDRs, nil
+}
+
+// freeCIDR returns the first subnet of the pool that does not overlap the used CIDRs
+func freeCIDR(pool *net.IPNet, newBits int, used []*net.IPNet) *net.IPNet {
+	for i := 0; i < 1<<newBits; i++ {
+		candidate, err := cidr.Subnet(pool, newBits, i)
+		if err != nil {
+			return nil
+		}
+		overlaps := false
+		for _, usedCIDR := range used {
+			if candidate.Contains(usedCIDR.IP) || usedCIDR.Contains(candidate.IP) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			return candidate
+		}
+	}
+	return nil
+}
+
+// DeleteVPCFixture deletes the ENIs left in the subnets of the fixture, the subnets and the secondary CIDR
+func DeleteVPCFixture(f *framework.Framework, fixture *VPCFixture) error {
+	if fixture == nil {
+		return nil
+	}
+	var errs []error
+	for _, subnetID := range fixture.SubnetIDs {
+		errs = append(errs, deleteFixtureSubnet(f, subnetID))
+	}
+	if fixture.CIDRAssociationID != "" {
+		err := f.CloudServices.EC2().DisAssociateVPCCIDRBlock(fixture.CIDRAssociationID)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to disassociate CIDR %s: %v", fixture.CIDR, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deleteFixtureSubnet deletes the subnet, after the ENIs that ipamd did not delete before its node went away
+func deleteFixtureSubnet(f *framework.Framework, subnetID string) error {
+	describeNetworkInterfacesOutput, err := f.CloudServices.EC2().DescribeNetworkInterfacesInSubnet(subnetID)
+	if err != nil {
+		return fmt.Errorf("failed to describe the ENIs of subnet %s: %v", subnetID, err)
+	}
+	for _, eni := range describeNetworkInterfacesOutput.NetworkInterfaces {
+		if aws.StringValue(eni.Status) != ec2.NetworkInterfaceStatusAvailable {
+			continue
+		}
+		if err := f.CloudServices.EC2().DeleteNetworkInterface(*eni.NetworkInterfaceId); err != nil {
+			return fmt.Errorf("failed to delete ENI %s of subnet %s: %v", *eni.NetworkInterfaceId, subnetID, err)
+		}
+	}
+	if err := f.CloudServices.EC2().DeleteSubnet(subnetID); err != nil {
+		return fmt.Errorf("failed to delete subnet %s: %v", subnetID, err)
+	}
+	return nil
+}
+
+// DeleteOrphanedVPCFixtures deletes the VPC fixtures created more than maxAge ago, which a run that was interrupted
+// before its teardown left behind. Younger fixtures may belong to suites still running in parallel.
+func DeleteOrphanedVPCFixtures(f *framework.Framework, maxAge time.Duration) error {
+	describeSubnetsOutput, err := f.CloudServices.EC2().DescribeSubnetsWithTagKey(f.Options.AWSVPCID, FixtureTagKey)
+	if err != nil {
+		return fmt.Errorf("failed to describe the subnets of the VPC fixtures: %v", err)
+	}
+
+	orphans := map[string]*VPCFixture{}
+	for _, subnet := range describeSubnetsOutput.Subnets {
+		tags := map[string]string{}
+		for _, tag := range subnet.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+		createdAt, err := time.Parse(time.RFC3339, tags[FixtureCreatedAtTagKey])
+		if err != nil || time.Since(createdAt) < maxAge {
+			continue
+		}
+		associationID := tags[FixtureCIDRAssociationTagKey]
+		fixture, ok := orphans[associationID]
+		if !ok {
+			fixture = &VPCFixture{
+				Name:              tags[FixtureTagKey],
+				CIDRAssociationID: associationID,
+				SubnetIDs:         map[string]string{},
+			}
+			orphans[associationID] = fixture
+		}
+		fixture.SubnetIDs[aws.StringValue(subnet.AvailabilityZone)] = aws.StringValue(subnet.SubnetId)
+	}
+
+	var errs []error
+	for _, fixture := range orphans {
+		f.Logger.Info("deleting VPC fixture left by an earlier run", "fixture", fixture.Name,
+			"subnets", fixture.SubnetIDs)
+		errs = append(errs, DeleteVPCFixture(f, fixture))
+	}
+	return errors.Join(errs...)
+}
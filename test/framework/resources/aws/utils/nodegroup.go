@@ -24,6 +24,9 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/eks"
+	"k8s.io/apimachinery/pkg/util/wait"
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/vpc"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
@@ -36,8 +39,26 @@ const (
 	CONTAINERD                 = "containerd"
 	CreateNodeGroupCFNTemplate = "/testdata/amazon-eks-nodegroup.yaml"
 	NodeImageIdSSMParam        = "/aws/service/eks/optimized-ami/%s/amazon-linux-2/recommended/image_id"
+	ARM64NodeImageIdSSMParam   = "/aws/service/eks/optimized-ami/%s/amazon-linux-2-arm64/recommended/image_id"
+
+	CreateWindowsNodeGroupCFNTemplate = "/testdata/amazon-eks-windows-nodegroup.yaml"
+	WindowsNodeImageIdSSMParam        = "/aws/service/ami-windows-latest/Windows_Server-2019-English-Core-EKS_Optimized-%s/image_id"
+
+	// The amazon-vpc-cni ConfigMap enables the Windows IPAM of the VPC resource controller
+	VPCCNIConfigMapName   = "amazon-vpc-cni"
+	EnableWindowsIPAMKey  = "enable-windows-ipam"
+	windowsKubeProxyGroup = "eks:kube-proxy-windows"
+
+	// instanceReplacementTimeout bounds the time the auto scaling group takes to launch and register new nodes
+	instanceReplacementTimeout = time.Minute * 15
 )
 
+// DefaultInstanceTypes are the instance types of the nodegroups created by the tests, by node architecture
+var DefaultInstanceTypes = map[string]string{
+	utils.NodeArchAMD64: "m5.large",
+	utils.NodeArchARM64: "m6g.large",
+}
+
 type NodeGroupProperties struct {
 	// Required to verify the node is up and ready
 	NgLabelKey string
@@ -49,7 +70,8 @@ type NodeGroupProperties struct {
 	// will be set on Kubelet extra arguments
 	IsCustomNetworkingEnabled bool
 	// Subnet where the node group will be created
-	Subnet       []string
+	Subnet []string
+	// optional: the default instance type of the architecture of the test nodes is used if not set
 	InstanceType string
 	KeyPairName  string
 
@@ -57,6 +79,9 @@ type NodeGroupProperties struct {
 	ContainerRuntime string
 
 	NodeImageId string
+
+	// optional: create Windows nodes, the Windows IPAM must be enabled for pods to get IPs
+	IsWindows bool
 }
 
 type ClusterVPCConfig struct {
@@ -74,7 +99,23 @@ type AWSAuthMapRole struct {
 
 // Create self managed node group stack
 func CreateAndWaitTillSelfManagedNGReady(f *framework.Framework, properties NodeGroupProperties) error {
+	if properties.InstanceType == "" {
+		properties.InstanceType = DefaultInstanceTypes[f.Options.InstanceType]
+	}
+	isARM64, err := isARM64InstanceType(f, properties.InstanceType)
+	if err != nil {
+		return err
+	}
+
 	templatePath := utils.GetProjectRoot() + CreateNodeGroupCFNTemplate
+	nodeImageIdSSMParam := NodeImageIdSSMParam
+	if isARM64 {
+		nodeImageIdSSMParam = ARM64NodeImageIdSSMParam
+	}
+	if properties.IsWindows {
+		templatePath = utils.GetProjectRoot() + CreateWindowsNodeGroupCFNTemplate
+		nodeImageIdSSMParam = WindowsNodeImageIdSSMParam
+	}
 	templateBytes, err := os.ReadFile(templatePath)
 	if err != nil {
 		return fmt.Errorf("failed to read from %s, %v", templatePath, err)
@@ -86,21 +127,27 @@ func CreateAndWaitTillSelfManagedNGReady(f *framework.Framework, properties Node
 		return fmt.Errorf("failed to describe cluster %s: %v", f.Options.ClusterName, err)
 	}
 
-	var bootstrapArgs = fmt.Sprintf("--apiserver-endpoint %s --b64-cluster-ca %s",
-		*describeClusterOutput.Cluster.Endpoint, *describeClusterOutput.Cluster.CertificateAuthority.Data)
+	var bootstrapArgs string
 	var kubeletExtraArgs = fmt.Sprintf("--node-labels=%s=%s", properties.NgLabelKey, properties.NgLabelVal)
+	if properties.IsWindows {
+		bootstrapArgs = windowsBootstrapArgs(describeClusterOutput, properties, kubeletExtraArgs)
+	} else {
+		bootstrapArgs = fmt.Sprintf("--apiserver-endpoint %s --b64-cluster-ca %s",
+			*describeClusterOutput.Cluster.Endpoint, *describeClusterOutput.Cluster.CertificateAuthority.Data)
+
+		if properties.IsCustomNetworkingEnabled {
+			limit, _ := vpc.GetInstance(properties.InstanceType)
+			maxPods := (limit.ENILimit-1)*(limit.IPv4Limit-1) + 2
+
+			bootstrapArgs += " --use-max-pods false"
+			kubeletExtraArgs += fmt.Sprintf(" --max-pods=%d", maxPods)
+		}
 
-	if properties.IsCustomNetworkingEnabled {
-		limit, _ := vpc.GetInstance(properties.InstanceType)
-		maxPods := (limit.ENILimit-1)*(limit.IPv4Limit-1) + 2
-
-		bootstrapArgs += " --use-max-pods false"
-		kubeletExtraArgs += fmt.Sprintf(" --max-pods=%d", maxPods)
-	}
-
-	containerRuntime := properties.ContainerRuntime
-	if containerRuntime != "" {
-		bootstrapArgs += fmt.Sprintf(" --container-runtime %s", containerRuntime)
+		containerRuntime := properties.ContainerRuntime
+		if containerRuntime != "" {
+			bootstrapArgs += fmt.Sprintf(" --container-runtime %s", containerRuntime)
+		}
+		bootstrapArgs = fmt.Sprintf("%s --kubelet-extra-args '%s'", bootstrapArgs, kubeletExtraArgs)
 	}
 
 	asgSizeString := strconv.Itoa(properties.AsgSize)
@@ -128,7 +175,7 @@ func CreateAndWaitTillSelfManagedNGReady(f *framework.Framework, properties Node
 		},
 		{
 			ParameterKey:   aws.String("NodeImageIdSSMParam"),
-			ParameterValue: aws.String(fmt.Sprintf(NodeImageIdSSMParam, f.Options.NgK8SVersion)),
+			ParameterValue: aws.String(fmt.Sprintf(nodeImageIdSSMParam, f.Options.NgK8SVersion)),
 		},
 		{
 			ParameterKey:   aws.String("NodeAutoScalingGroupMinSize"),
@@ -148,7 +195,7 @@ func CreateAndWaitTillSelfManagedNGReady(f *framework.Framework, properties Node
 		},
 		{
 			ParameterKey:   aws.String("BootstrapArguments"),
-			ParameterValue: aws.String(fmt.Sprintf("%s --kubelet-extra-args '%s'", bootstrapArgs, kubeletExtraArgs)),
+			ParameterValue: aws.String(bootstrapArgs),
 		},
 		{
 			ParameterKey:   aws.String("KeyName"),
@@ -192,9 +239,13 @@ func CreateAndWaitTillSelfManagedNGReady(f *framework.Framework, properties Node
 	}
 
 	updatedAWSAuth := awsAuth.DeepCopy()
+	groups := []string{"system:bootstrappers", "system:nodes"}
+	if properties.IsWindows {
+		groups = append(groups, windowsKubeProxyGroup)
+	}
 	authMapRole := []AWSAuthMapRole{
 		{
-			Groups:   []string{"system:bootstrappers", "system:nodes"},
+			Groups:   groups,
 			RoleArn:  nodeInstanceRole,
 			UserName: "system:node:{{EC2PrivateDNSName}}",
 		},
@@ -219,6 +270,56 @@ func CreateAndWaitTillSelfManagedNGReady(f *framework.Framework, properties Node
 	return nil
 }
 
+// isARM64InstanceType returns whether the instance type is a Graviton instance type, which needs an arm64 AMI
+func isARM64InstanceType(f *framework.Framework, instanceType string) (bool, error) {
+	instanceTypeInfos, err := f.CloudServices.EC2().DescribeInstanceType(instanceType)
+	if err != nil {
+		return false, fmt.Errorf("failed to describe instance type %s: %v", instanceType, err)
+	}
+	if len(instanceTypeInfos) == 0 {
+		return false, fmt.Errorf("instance type %s not found", instanceType)
+	}
+	for _, arch := range instanceTypeInfos[0].ProcessorInfo.SupportedArchitectures {
+		if *arch == ec2.ArchitectureTypeArm64 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// windowsBootstrapArgs returns the arguments of Start-EKSBootstrap.ps1, the bootstrap script of the Windows AMI
+func windowsBootstrapArgs(describeClusterOutput *eks.DescribeClusterOutput, properties NodeGroupProperties,
+	kubeletExtraArgs string) string {
+	bootstrapArgs := fmt.Sprintf("-APIServerEndpoint %s -Base64ClusterCA %s",
+		*describeClusterOutput.Cluster.Endpoint, *describeClusterOutput.Cluster.CertificateAuthority.Data)
+	if properties.ContainerRuntime != "" {
+		bootstrapArgs += fmt.Sprintf(" -ContainerRuntime %s", properties.ContainerRuntime)
+	}
+	return fmt.Sprintf("%s -KubeletExtraArgs '%s'", bootstrapArgs, kubeletExtraArgs)
+}
+
+// EnableWindowsIPAM enables or disables the IPAM of Windows pods in the VPC resource controller, which is needed for
+// pods on Windows nodes to get IPs
+func EnableWindowsIPAM(f *framework.Framework, enable bool) error {
+	configMap, err := f.K8sResourceManagers.ConfigMapManager().
+		GetConfigMap(utils.AwsNodeNamespace, VPCCNIConfigMapName)
+	if err != nil {
+		return fmt.Errorf("failed to find %s configmap: %v", VPCCNIConfigMapName, err)
+	}
+
+	updatedConfigMap := configMap.DeepCopy()
+	if updatedConfigMap.Data == nil {
+		updatedConfigMap.Data = map[string]string{}
+	}
+	updatedConfigMap.Data[EnableWindowsIPAMKey] = strconv.FormatBool(enable)
+
+	err = f.K8sResourceManagers.ConfigMapManager().UpdateConfigMap(configMap, updatedConfigMap)
+	if err != nil {
+		return fmt.Errorf("failed to update %s configmap: %v", VPCCNIConfigMapName, err)
+	}
+	return nil
+}
+
 func DeleteAndWaitTillSelfManagedNGStackDeleted(f *framework.Framework, properties NodeGroupProperties) error {
 	err := f.CloudServices.CloudFormation().WaitTillStackDeleted(properties.NodeGroupName)
 	if err != nil {
@@ -297,23 +398,68 @@ func GetClusterVPCConfig(f *framework.Framework) (*ClusterVPCConfig, error) {
 	return clusterConfig, nil
 }
 
+// TerminateInstances terminates the test nodes and waits until the node group replaced them with as many ready nodes
 func TerminateInstances(f *framework.Framework) error {
+	return terminateInstances(f, true)
+}
+
+// TerminateInstancesAndWaitTillRegistered terminates the test nodes and waits until the node group replaced them with
+// as many registered nodes, for the specs that expect the replacements not to become ready
+func TerminateInstancesAndWaitTillRegistered(f *framework.Framework) error {
+	return terminateInstances(f, false)
+}
+
+func terminateInstances(f *framework.Framework, waitTillReady bool) error {
 	nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
 	if err != nil {
 		return fmt.Errorf("failed to get list of nodes created: %v", err)
 	}
 
 	var instanceIDs []string
+	terminated := map[string]bool{}
 	for _, node := range nodeList.Items {
 		instanceIDs = append(instanceIDs, k8sUtils.GetInstanceIDFromNode(node))
+		terminated[node.Name] = true
 	}
 
 	err = f.CloudServices.EC2().TerminateInstance(instanceIDs)
 	if err != nil {
 		return fmt.Errorf("failed to terminate instances: %v", err)
 	}
+	return waitTillNodesReplaced(f, terminated, waitTillReady)
+}
 
-	// Wait for instances to be replaced
-	time.Sleep(time.Minute * 8)
+// waitTillNodesReplaced waits until none of the terminated nodes is left and as many new nodes registered
+func waitTillNodesReplaced(f *framework.Framework, terminated map[string]bool, waitTillReady bool) error {
+	start := time.Now()
+	var pending string
+	err := wait.PollImmediate(utils.PollIntervalLong, instanceReplacementTimeout, func() (bool, error) {
+		nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
+		if err != nil {
+			f.Logger.Error(err, "failed to list the nodes")
+			return false, nil
+		}
+		var old, notReady []string
+		for _, node := range nodeList.Items {
+			if terminated[node.Name] {
+				old = append(old, node.Name)
+			} else if waitTillReady && !k8sUtils.IsNodeReady(node) {
+				notReady = append(notReady, node.Name)
+			}
+		}
+		replacements := len(nodeList.Items) - len(old)
+		pending = fmt.Sprintf("%d of %d replacements registered, terminated nodes left %v, replacements not ready %v",
+			replacements, len(terminated), old, notReady)
+		if len(old) > 0 || replacements < len(terminated) || len(notReady) > 0 {
+			f.Logger.Info("waiting for the terminated nodes to be replaced",
+				"elapsed", time.Since(start).Round(time.Second), "pending", pending)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out after %v waiting for the terminated nodes to be replaced: %s",
+			instanceReplacementTimeout, pending)
+	}
 	return nil
 }
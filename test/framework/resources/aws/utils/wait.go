@@ -0,0 +1,81 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+)
+
+// WaitTillInstanceENIs describes the instance until the condition returns no error, and logs the error of each poll
+// as the progress of the wait. The error of the last poll is returned on timeout.
+func WaitTillInstanceENIs(f *framework.Framework, instanceID string, description string, timeout time.Duration,
+	condition func(enis []*ec2.InstanceNetworkInterface) error) error {
+	start := time.Now()
+	var lastErr error
+	err := wait.PollImmediate(utils.PollIntervalMedium, timeout, func() (bool, error) {
+		instance, err := f.CloudServices.EC2().DescribeInstance(instanceID)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to describe instance %s: %v", instanceID, err)
+		} else {
+			lastErr = condition(instance.NetworkInterfaces)
+		}
+		if lastErr != nil {
+			f.Logger.Info("waiting for "+description, "instance", instanceID,
+				"elapsed", time.Since(start).Round(time.Second), "pending", lastErr.Error())
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out after %v waiting for %s on instance %s: %v", timeout, description, instanceID, lastErr)
+	}
+	return nil
+}
+
+// WaitTillBranchENIsDeleted waits until the VPC resource controller deleted the branch ENIs with the security group,
+// which it does once the ENIs of the deleted pods are out of their cooldown
+func WaitTillBranchENIsDeleted(f *framework.Framework, securityGroupID string, timeout time.Duration) error {
+	start := time.Now()
+	var pending []string
+	err := wait.PollImmediate(utils.PollIntervalMedium, timeout, func() (bool, error) {
+		output, err := f.CloudServices.EC2().DescribeBranchNetworkInterfaces(f.Options.AWSVPCID, securityGroupID)
+		if err != nil {
+			f.Logger.Error(err, "failed to describe the branch ENIs", "securityGroup", securityGroupID)
+			return false, nil
+		}
+		pending = nil
+		for _, eni := range output.NetworkInterfaces {
+			pending = append(pending, aws.StringValue(eni.NetworkInterfaceId))
+		}
+		if len(pending) > 0 {
+			f.Logger.Info("waiting for the branch ENIs to be deleted", "securityGroup", securityGroupID,
+				"elapsed", time.Since(start).Round(time.Second), "enis", pending)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out after %v waiting for the branch ENIs %v of security group %s to be deleted",
+			timeout, pending, securityGroupID)
+	}
+	return nil
+}
@@ -68,6 +68,16 @@ func NewNetCatAlpineContainer(testImageRegistry string) *Container {
 	}
 }
 
+// NewAgnhostContainer returns an agnhost container, which runs on Windows nodes. For instance, the arguments
+// "netexec --http-port=80" start an HTTP server, and "connect <host>:<port> --protocol=tcp" tests a connection.
+func NewAgnhostContainer() *Container {
+	return &Container{
+		name:            "agnhost",
+		image:           utils.AgnhostImage,
+		imagePullPolicy: v1.PullIfNotPresent,
+	}
+}
+
 func NewBaseContainer() *Container {
 	return &Container{}
 }
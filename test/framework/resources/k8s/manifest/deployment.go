@@ -57,6 +57,21 @@ func NewDefaultDeploymentBuilder() *DeploymentBuilder {
 	}
 }
 
+// NewWindowsDeploymentBuilder returns a builder of deployments of agnhost HTTP servers on Windows nodes
+func NewWindowsDeploymentBuilder() *DeploymentBuilder {
+	return &DeploymentBuilder{
+		namespace: utils.DefaultTestNamespace,
+		name:      "deployment-test",
+		replicas:  10,
+		container: NewAgnhostContainer().
+			Args([]string{"netexec", "--http-port=80"}).
+			Build(),
+		labels:                 map[string]string{"role": "test"},
+		nodeSelector:           map[string]string{utils.NodeOSLabelKey: utils.NodeOSWindows},
+		terminationGracePeriod: 1,
+	}
+}
+
 func NewCalicoStarDeploymentBuilder() *DeploymentBuilder {
 	return &DeploymentBuilder{
 		labels:       map[string]string{},
@@ -46,6 +46,11 @@ func NewDefaultPodBuilder() *PodBuilder {
 	}
 }
 
+// NewWindowsPodBuilder returns a builder of pods scheduled on Windows nodes
+func NewWindowsPodBuilder() *PodBuilder {
+	return NewDefaultPodBuilder().NodeSelector(utils.NodeOSLabelKey, utils.NodeOSWindows)
+}
+
 func (p *PodBuilder) Name(name string) *PodBuilder {
 	p.name = name
 	return p
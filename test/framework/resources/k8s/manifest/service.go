@@ -30,6 +30,7 @@ type ServiceBuilder struct {
 	selector    map[string]string
 	annotation  map[string]string
 	serviceType v1.ServiceType
+	ipFamilies  []v1.IPFamily
 }
 
 func NewHTTPService() *ServiceBuilder {
@@ -82,6 +83,12 @@ func (s *ServiceBuilder) Annotations(annotations map[string]string) *ServiceBuil
 	return s
 }
 
+// IPFamilies sets the IP families of the service, the cluster default is used if none are set
+func (s *ServiceBuilder) IPFamilies(ipFamilies ...v1.IPFamily) *ServiceBuilder {
+	s.ipFamilies = ipFamilies
+	return s
+}
+
 func (s *ServiceBuilder) Build() *v1.Service {
 	return &v1.Service{
 		ObjectMeta: metaV1.ObjectMeta{
@@ -92,13 +99,14 @@ func (s *ServiceBuilder) Build() *v1.Service {
 		Spec: v1.ServiceSpec{
 			Ports: []v1.ServicePort{{
 				Name:       "",
-				Protocol:   v1.ProtocolTCP,
+				Protocol:   s.protocol,
 				Port:       s.port,
 				TargetPort: intstr.IntOrString{IntVal: s.port},
 				NodePort:   s.nodePort,
 			}},
-			Selector: s.selector,
-			Type:     s.serviceType,
+			Selector:   s.selector,
+			Type:       s.serviceType,
+			IPFamilies: s.ipFamilies,
 		},
 	}
 }
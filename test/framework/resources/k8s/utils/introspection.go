@@ -0,0 +1,131 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+)
+
+const introspectionENIsURL = "http://localhost:61679/v1/enis"
+
+// IntrospectionClient reads the ipamd introspection API of a node from a host network pod, since ipamd only listens
+// on localhost and the aws-node image has no HTTP client. The pod is kept until Close, so that polling the API does
+// not start a pod for each poll.
+type IntrospectionClient struct {
+	f        *framework.Framework
+	nodeName string
+	pod      *v1.Pod
+}
+
+// NewIntrospectionClient starts the host network pod on the node
+func NewIntrospectionClient(f *framework.Framework, nodeName string) (*IntrospectionClient, error) {
+	container := manifest.NewCurlContainer().
+		Command([]string{"sleep", "infinity"}).
+		Build()
+	pod := manifest.NewDefaultPodBuilder().
+		Name(fmt.Sprintf("ipamd-introspection-%s", rand.String(8))).
+		Namespace(utils.AwsNodeNamespace).
+		Container(container).
+		NodeName(nodeName).
+		HostNetwork(true).
+		Build()
+
+	pod, err := f.K8sResourceManagers.PodManager().CreateAndWaitTillRunning(pod)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start the introspection pod on node %s: %v", nodeName, err)
+	}
+	return &IntrospectionClient{f: f, nodeName: nodeName, pod: pod}, nil
+}
+
+// ENIInfos returns the ENIs and IPs of the ipamd datastore of the node
+func (c *IntrospectionClient) ENIInfos() (*datastore.ENIInfos, error) {
+	stdout, stderr, err := c.f.K8sResourceManagers.PodManager().
+		PodExec(c.pod.Namespace, c.pod.Name, []string{"curl", "-sf", introspectionENIsURL})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s on node %s: %v: %s", introspectionENIsURL, c.nodeName, err, stderr)
+	}
+	eniInfos := &datastore.ENIInfos{}
+	if err := json.Unmarshal([]byte(stdout), eniInfos); err != nil {
+		return nil, fmt.Errorf("failed to decode the ENIs of node %s: %v", c.nodeName, err)
+	}
+	return eniInfos, nil
+}
+
+// WaitTill reads the ipamd datastore until the condition returns no error, and logs the error of each poll as the
+// progress of the wait. The error of the last poll is returned on timeout.
+func (c *IntrospectionClient) WaitTill(description string, timeout time.Duration,
+	condition func(eniInfos *datastore.ENIInfos) error) error {
+	start := time.Now()
+	var lastErr error
+	err := wait.PollImmediate(utils.PollIntervalMedium, timeout, func() (bool, error) {
+		eniInfos, err := c.ENIInfos()
+		if err != nil {
+			// ipamd does not serve the API while aws-node restarts
+			lastErr = err
+		} else {
+			lastErr = condition(eniInfos)
+		}
+		if lastErr != nil {
+			c.f.Logger.Info("waiting for "+description, "node", c.nodeName,
+				"elapsed", time.Since(start).Round(time.Second), "pending", lastErr.Error())
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out after %v waiting for %s on node %s: %v", timeout, description, c.nodeName, lastErr)
+	}
+	return nil
+}
+
+// Close deletes the host network pod
+func (c *IntrospectionClient) Close() error {
+	return c.f.K8sResourceManagers.PodManager().DeleteAndWaitTillPodDeleted(c.pod)
+}
+
+// WaitTillUnusedENIsReleased waits until ipamd of the node detached the secondary ENIs that have no pods, which it does
+// once the warm targets allow it and the ENIs and their IPs are out of their cooldown
+func WaitTillUnusedENIsReleased(f *framework.Framework, nodeName string, timeout time.Duration) error {
+	client, err := NewIntrospectionClient(f, nodeName)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	return client.WaitTill("the unused ENIs to be released", timeout, func(eniInfos *datastore.ENIInfos) error {
+		var unused []string
+		for _, eni := range eniInfos.ENIs {
+			if !eni.IsPrimary && !eni.IsTrunk && !eni.IsEFA && eni.AssignedIPv4Addresses() == 0 {
+				unused = append(unused, eni.ID)
+			}
+		}
+		if len(unused) > 0 {
+			sort.Strings(unused)
+			return fmt.Errorf("ENIs %v have no pods", unused)
+		}
+		return nil
+	})
+}
@@ -23,3 +23,13 @@ func GetInstanceIDFromNode(node v1.Node) string {
 	id := strings.Split(node.Spec.ProviderID, "/")
 	return id[len(id)-1]
 }
+
+// IsNodeReady returns true if the node reports the Ready condition
+func IsNodeReady(node v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,76 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+)
+
+// WaitTillPodsDeleted waits until no pod with the label is left. The kubelet removes a pod only after the CNI DEL of
+// its sandbox, so the host networking of the pods is torn down once this returns.
+func WaitTillPodsDeleted(f *framework.Framework, labelKey string, labelVal string, timeout time.Duration) error {
+	start := time.Now()
+	var pending []string
+	err := wait.PollImmediate(utils.PollIntervalShort, timeout, func() (bool, error) {
+		podList, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelector(labelKey, labelVal)
+		if err != nil {
+			f.Logger.Error(err, "failed to list the pods", labelKey, labelVal)
+			return false, nil
+		}
+		pending = nil
+		for _, pod := range podList.Items {
+			pending = append(pending, pod.Name)
+		}
+		if len(pending) > 0 {
+			f.Logger.Info("waiting for the pods to be deleted", labelKey, labelVal,
+				"elapsed", time.Since(start).Round(time.Second), "pods", pending)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out after %v waiting for the pods %v with label %s=%s to be deleted",
+			timeout, pending, labelKey, labelVal)
+	}
+	return nil
+}
+
+// PodNetworkLatency returns the time from the scheduling of the pod to the setup of its sandbox, which includes the
+// CNI ADD. Clusters before 1.29 do not report the sandbox setup, then the time until the pod is ready is used.
+func PodNetworkLatency(pod v1.Pod) (time.Duration, bool) {
+	conditions := map[v1.PodConditionType]time.Time{}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Status == v1.ConditionTrue {
+			conditions[condition.Type] = condition.LastTransitionTime.Time
+		}
+	}
+	scheduled, ok := conditions[v1.PodScheduled]
+	if !ok {
+		return 0, false
+	}
+	if ready, ok := conditions[v1.PodReadyToStartContainers]; ok {
+		return ready.Sub(scheduled), true
+	}
+	if ready, ok := conditions[v1.PodReady]; ok {
+		return ready.Sub(scheduled), true
+	}
+	return 0, false
+}
@@ -15,23 +15,43 @@ package utils
 
 import "time"
 
+// DefaultTestNamespace is the namespace of the test workloads. The framework changes it to the --test-namespace flag,
+// so that suites running in parallel against the same cluster do not delete each other's pods.
+var DefaultTestNamespace = "cni-automation"
+
 const (
-	DefaultTestNamespace = "cni-automation"
 	AwsNodeNamespace     = "kube-system"
 	AwsNodeName          = "aws-node"
 	AWSInitContainerName = "aws-vpc-cni-init"
 	MultusNodeName       = "kube-multus-ds"
 	MultusContainerName  = "kube-multus"
 
+	// The test images are multi-arch, so that the suites run on amd64 and arm64 nodes.
 	// See https://gallery.ecr.aws/eks/aws-vpc-cni-test-helper
 	TestAgentImage = "networking-e2e-test-images/aws-vpc-cni-test-helper:20231212"
 	BusyBoxImage   = "networking-e2e-test-images/busybox:latest"
 	NginxImage     = "networking-e2e-test-images/nginx:1.25.2"
 	NetCatImage    = "networking-e2e-test-images/netcat-openbsd:v1.0"
 
+	// The agnhost image runs on Windows and Linux nodes, see
+	// https://github.com/kubernetes/kubernetes/tree/master/test/images/agnhost
+	AgnhostImage = "registry.k8s.io/e2e-test-images/agnhost:2.47"
+
+	NodeArchLabelKey = "kubernetes.io/arch"
+	NodeArchAMD64    = "amd64"
+	NodeArchARM64    = "arm64"
+
+	NodeOSLabelKey = "kubernetes.io/os"
+	NodeOSLinux    = "linux"
+	NodeOSWindows  = "windows"
+
 	PollIntervalShort  = time.Second * 2
 	PollIntervalMedium = time.Second * 5
 	PollIntervalLong   = time.Second * 20
 
 	DefaultDeploymentReadyTimeout = time.Second * 300
+	// ipamd and the VPC resource controller attach ENIs within seconds, but release the ENIs of deleted pods only after
+	// a cooldown of about a minute
+	DefaultENIWaitTimeout   = time.Minute * 5
+	DefaultPodDeleteTimeout = time.Minute * 2
 )
@@ -0,0 +1,58 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package utils
+
+import (
+	"fmt"
+	"net"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// AnyCIDR returns the CIDR matching all addresses of the IP family, to open security groups
+func AnyCIDR(isIPv6 bool) string {
+	if isIPv6 {
+		return "::/0"
+	}
+	return "0.0.0.0/0"
+}
+
+// GetPodIP returns the IP of the pod in the IP family, since dual-stack pods have one IP per family
+func GetPodIP(pod v1.Pod, isIPv6 bool) string {
+	for _, podIP := range pod.Status.PodIPs {
+		ip := net.ParseIP(podIP.IP)
+		if ip != nil && (ip.To4() == nil) == isIPv6 {
+			return podIP.IP
+		}
+	}
+	return pod.Status.PodIP
+}
+
+// GetIPv6SubnetCIDR returns the index-th /64 of the /56 IPv6 CIDR block of a VPC
+func GetIPv6SubnetCIDR(vpcCIDR string, index int) (string, error) {
+	_, ipNet, err := net.ParseCIDR(vpcCIDR)
+	if err != nil {
+		return "", err
+	}
+	if ones, _ := ipNet.Mask.Size(); ones != 56 || ipNet.IP.To4() != nil {
+		return "", fmt.Errorf("%s is not a /56 IPv6 CIDR block", vpcCIDR)
+	}
+	if index < 0 || index > 255 {
+		return "", fmt.Errorf("subnet index %d is out of range", index)
+	}
+	ip := make(net.IP, net.IPv6len)
+	copy(ip, ipNet.IP)
+	ip[7] = byte(index)
+	return (&net.IPNet{IP: ip, Mask: net.CIDRMask(64, 128)}).String(), nil
+}
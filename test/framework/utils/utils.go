@@ -16,7 +16,9 @@ package utils
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	appsV1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -51,3 +53,13 @@ func GetProjectRoot() string {
 	}
 	return projectRoot
 }
+
+// Percentile returns the p-th percentile of the latencies, p being between 0 and 1
+func Percentile(latencies []time.Duration, p float64) time.Duration {
+	if len(latencies) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[int(p*float64(len(sorted)-1))]
+}
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 	. "github.com/onsi/ginkgo/v2"
@@ -209,6 +210,10 @@ var _ = BeforeSuite(func() {
 	assignPodsMetadataForTests()
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	By("Remove All Star Resources")
 	f.K8sResourceManagers.NamespaceManager().DeleteAndWaitTillNamespaceDeleted(uiNamespace)
@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 
@@ -60,12 +61,7 @@ var _ = BeforeSuite(func() {
 	f = framework.New(framework.GlobalOptions)
 
 	By("checking cluster v4 or v6")
-	clusterOutput, err := f.CloudServices.EKS().DescribeCluster(f.Options.ClusterName)
-	Expect(err).NotTo(HaveOccurred())
-	isIPv4Cluster = false
-	if *clusterOutput.Cluster.KubernetesNetworkConfig.IpFamily == "ipv4" {
-		isIPv4Cluster = true
-	}
+	isIPv4Cluster = !f.Options.IsIPv6()
 	By("creating test namespace")
 	f.K8sResourceManagers.NamespaceManager().
 		CreateNamespace(utils.DefaultTestNamespace)
@@ -122,6 +118,10 @@ var _ = BeforeSuite(func() {
 	}
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	By("deleting test namespace")
 	f.K8sResourceManagers.NamespaceManager().
@@ -1,9 +1,8 @@
 package cni_upgrade_downgrade
 
 import (
-	"time"
-
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/integration/common"
 	. "github.com/onsi/ginkgo/v2"
@@ -61,8 +60,9 @@ var _ = Describe("test host networking", func() {
 				DeleteAndWaitTillDeploymentIsDeleted(deployment)
 			Expect(err).ToNot(HaveOccurred())
 
-			By("waiting to allow CNI to tear down networking for terminated pods")
-			time.Sleep(time.Second * 60)
+			By("waiting for the kubelet to tear down the networking of the terminated pods")
+			err = k8sUtils.WaitTillPodsDeleted(f, podLabelKey, podLabelVal, utils.DefaultPodDeleteTimeout)
+			Expect(err).ToNot(HaveOccurred())
 
 			By("validating host networking is teared down correctly")
 			common.ValidateHostNetworking(common.NetworkingTearDownSucceeds, podInput, primaryNode.Name, f)
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 	"github.com/pkg/errors"
@@ -101,6 +102,10 @@ var _ = BeforeSuite(func() {
 		"aws-node", map[string]string{"WARM_IP_TARGET": "3", "WARM_ENI_TARGET": "0"})
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	By("deleting test namespace")
 	f.K8sResourceManagers.NamespaceManager().
@@ -0,0 +1,153 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/integration/common"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	applianceLabelKey       = "gwlb-appliance"
+	applianceServerLabelVal = "server"
+	applianceBackendLabel   = "gwlb-appliance-backend"
+
+	gwlbMaxMTU = "8500"
+)
+
+// Verifies that with GWLB appliance mode, the pods get an MTU that Gateway Load Balancers forward, and that the replies
+// to NodePort traffic forwarded to a pod on a secondary ENI leave through the ENI the traffic entered, whichever ENI
+// of the node it was sent to
+var _ = Describe("test GWLB appliance mode", func() {
+	var err error
+	var deployment *appsV1.Deployment
+	var service *v1.Service
+	var clientPod *v1.Pod
+	var targetPod v1.Pod
+
+	BeforeEach(func() {
+		if f.Options.IsIPv6() {
+			Skip("GWLB appliance mode routes are IPv4 only")
+		}
+
+		k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+			utils.AwsNodeName, map[string]string{"ENABLE_GWLB_APPLIANCE_MODE": "true"})
+
+		serverContainer := manifest.NewBusyBoxContainerBuilder(f.Options.TestImageRegistry).
+			Command([]string{"sh", "-c", "echo ok > /tmp/index.html && httpd -f -p 80 -h /tmp"}).
+			Build()
+		// Launch enough pods so that some of them use the IPs of a secondary ENI
+		deployment = manifest.NewBusyBoxDeploymentBuilder(f.Options.TestImageRegistry).
+			Name("gwlb-appliance-server").
+			Container(serverContainer).
+			Replicas(maxIPPerInterface*2).
+			PodLabel(applianceLabelKey, applianceServerLabelVal).
+			NodeName(primaryNode.Name).
+			Build()
+
+		By("creating a deployment of http servers on the primary node")
+		deployment, err = f.K8sResourceManagers.DeploymentManager().
+			CreateAndWaitTillDeploymentIsReady(deployment, utils.DefaultDeploymentReadyTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		interfaceTypeToPodList := common.GetPodsOnPrimaryAndSecondaryInterface(primaryNode, applianceLabelKey,
+			applianceServerLabelVal, f)
+		Expect(len(interfaceTypeToPodList.PodsOnSecondaryENI)).Should(BeNumerically(">", 0))
+
+		By("selecting a pod on a secondary ENI as the only backend of the service")
+		targetPod = interfaceTypeToPodList.PodsOnSecondaryENI[0]
+		targetPod.Labels[applianceBackendLabel] = "true"
+		err = f.K8sClient.Update(context.Background(), &targetPod)
+		Expect(err).ToNot(HaveOccurred())
+
+		service = manifest.NewHTTPService().
+			Name("gwlb-appliance-service").
+			ServiceType(v1.ServiceTypeNodePort).
+			Selector(applianceBackendLabel, "true").
+			Build()
+		service, err = f.K8sResourceManagers.ServiceManager().CreateService(context.Background(), service)
+		Expect(err).ToNot(HaveOccurred())
+
+		clientPod = manifest.NewDefaultPodBuilder().
+			Name("gwlb-appliance-client").
+			Container(manifest.NewBusyBoxContainerBuilder(f.Options.TestImageRegistry).Build()).
+			NodeName(secondaryNode.Name).
+			HostNetwork(true).
+			Build()
+		clientPod, err = f.K8sResourceManagers.PodManager().CreateAndWaitTillRunning(clientPod)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("sleeping for some time to allow service to become ready")
+		time.Sleep(utils.PollIntervalLong)
+	})
+
+	AfterEach(func() {
+		if f.Options.IsIPv6() {
+			return
+		}
+		if clientPod != nil {
+			err = f.K8sResourceManagers.PodManager().DeleteAndWaitTillPodDeleted(clientPod)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		if service != nil {
+			err = f.K8sResourceManagers.ServiceManager().DeleteAndWaitTillServiceDeleted(context.Background(), service)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		if deployment != nil {
+			err = f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployment)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+			utils.AwsNodeName, map[string]struct{}{"ENABLE_GWLB_APPLIANCE_MODE": {}})
+	})
+
+	It("pods should get the MTU of Gateway Load Balancers", func() {
+		stdout, stderr, err := f.K8sResourceManagers.PodManager().PodExec(targetPod.Namespace, targetPod.Name,
+			[]string{"cat", "/sys/class/net/eth0/mtu"})
+		Expect(err).ToNot(HaveOccurred(), stderr)
+		Expect(strings.TrimSpace(stdout)).To(Equal(gwlbMaxMTU))
+	})
+
+	It("pod on a secondary ENI should be reachable through the node port of each ENI of the node", func() {
+		instance, err := f.CloudServices.EC2().DescribeInstance(k8sUtils.GetInstanceIDFromNode(primaryNode))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(instance.NetworkInterfaces)).Should(BeNumerically(">", 1))
+
+		for _, eni := range instance.NetworkInterfaces {
+			By(fmt.Sprintf("connecting to the node port on ENI %s, device index %d",
+				*eni.NetworkInterfaceId, *eni.Attachment.DeviceIndex))
+			url := fmt.Sprintf("http://%s:%d", *eni.PrivateIpAddress, service.Spec.Ports[0].NodePort)
+			// Connections are retried a few times, each goes through a fresh conntrack entry
+			for i := 0; i < 5; i++ {
+				stdout, stderr, err := f.K8sResourceManagers.PodManager().PodExec(clientPod.Namespace, clientPod.Name,
+					[]string{"wget", "-q", "-O", "-", "-T", "5", url})
+				Expect(err).ToNot(HaveOccurred(), stderr)
+				Expect(stdout).To(ContainSubstring("ok"))
+			}
+		}
+	})
+})
@@ -0,0 +1,190 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/integration/common"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	hairpinLabelKey       = "hairpin"
+	hairpinServerLabelVal = "server"
+	// Added to the backend pod rather than replacing the deployment label, so that it stays in its replica set
+	hairpinBackendLabelKey = "hairpin-backend"
+
+	// Saves the reverse path filtering of all the interfaces of the node, to restore it after the test
+	saveRPFilterCmd    = "grep . /proc/sys/net/ipv4/conf/*/rp_filter > /tmp/rp_filter"
+	strictRPFilterCmd  = "for f in /proc/sys/net/ipv4/conf/*/rp_filter; do echo 1 > $f; done"
+	restoreRPFilterCmd = "while IFS=: read f v; do echo $v > $f; done < /tmp/rp_filter"
+)
+
+// Verifies that the traffic to pods on secondary ENIs hairpinning through a Service, or sent to a NodePort of the node,
+// keeps working with strict reverse path filtering
+var _ = Describe("test hairpin and host-to-pod traffic with strict rp_filter", func() {
+	var err error
+	var deployment *appsV1.Deployment
+	var service *v1.Service
+	var rpFilterPod *v1.Pod
+	var clientPod *v1.Pod
+	var targetPod v1.Pod
+
+	BeforeEach(func() {
+		if f.Options.IsIPv6() {
+			Skip("hairpin SNAT and strict rp_filter support are IPv4 only")
+		}
+
+		k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+			utils.AwsNodeName, map[string]string{
+				"AWS_VPC_K8S_CNI_HAIRPIN_SNAT":   "true",
+				"AWS_VPC_CNI_STRICT_RPF_SUPPORT": "true",
+			})
+
+		// aws-node loosens rp_filter of the primary ENI when it starts, so it is tightened after the restart
+		privileged := true
+		rpFilterContainer := manifest.NewBusyBoxContainerBuilder(f.Options.TestImageRegistry).
+			Name("rp-filter").
+			Build()
+		rpFilterContainer.SecurityContext = &v1.SecurityContext{Privileged: &privileged}
+		rpFilterPod = manifest.NewDefaultPodBuilder().
+			Name("rp-filter").
+			Container(rpFilterContainer).
+			NodeName(primaryNode.Name).
+			HostNetwork(true).
+			Build()
+
+		By("setting strict rp_filter on the primary node")
+		rpFilterPod, err = f.K8sResourceManagers.PodManager().CreateAndWaitTillRunning(rpFilterPod)
+		Expect(err).ToNot(HaveOccurred())
+		_, stderr, err := f.K8sResourceManagers.PodManager().PodExec(rpFilterPod.Namespace, rpFilterPod.Name,
+			[]string{"sh", "-c", saveRPFilterCmd + " && " + strictRPFilterCmd})
+		Expect(err).ToNot(HaveOccurred(), stderr)
+
+		serverContainer := manifest.NewBusyBoxContainerBuilder(f.Options.TestImageRegistry).
+			Command([]string{"sh", "-c", "echo ok > /tmp/index.html && httpd -f -p 80 -h /tmp"}).
+			Build()
+		// Launch enough pods so that some of them use the IPs of a secondary ENI
+		deployment = manifest.NewBusyBoxDeploymentBuilder(f.Options.TestImageRegistry).
+			Name("hairpin-server").
+			Container(serverContainer).
+			Replicas(maxIPPerInterface*2).
+			PodLabel(hairpinLabelKey, hairpinServerLabelVal).
+			NodeName(primaryNode.Name).
+			Build()
+
+		By("creating a deployment of http servers on the primary node")
+		deployment, err = f.K8sResourceManagers.DeploymentManager().
+			CreateAndWaitTillDeploymentIsReady(deployment, utils.DefaultDeploymentReadyTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		interfaceTypeToPodList := common.GetPodsOnPrimaryAndSecondaryInterface(primaryNode, hairpinLabelKey,
+			hairpinServerLabelVal, f)
+		Expect(len(interfaceTypeToPodList.PodsOnSecondaryENI)).Should(BeNumerically(">", 0))
+
+		By("selecting a pod on a secondary ENI as the only backend of the service")
+		targetPod = interfaceTypeToPodList.PodsOnSecondaryENI[0]
+		targetPod.Labels[hairpinBackendLabelKey] = "true"
+		err = f.K8sClient.Update(context.Background(), &targetPod)
+		Expect(err).ToNot(HaveOccurred())
+
+		service = manifest.NewHTTPService().
+			Name("hairpin-service").
+			ServiceType(v1.ServiceTypeNodePort).
+			Selector(hairpinBackendLabelKey, "true").
+			Build()
+		service, err = f.K8sResourceManagers.ServiceManager().CreateService(context.Background(), service)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("sleeping for some time to allow service to become ready")
+		time.Sleep(utils.PollIntervalLong)
+	})
+
+	AfterEach(func() {
+		if f.Options.IsIPv6() {
+			return
+		}
+		if clientPod != nil {
+			err = f.K8sResourceManagers.PodManager().DeleteAndWaitTillPodDeleted(clientPod)
+			Expect(err).ToNot(HaveOccurred())
+			clientPod = nil
+		}
+		if service != nil {
+			err = f.K8sResourceManagers.ServiceManager().DeleteAndWaitTillServiceDeleted(context.Background(), service)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		if deployment != nil {
+			err = f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployment)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		if rpFilterPod != nil {
+			By("restoring rp_filter on the primary node")
+			_, stderr, err := f.K8sResourceManagers.PodManager().PodExec(rpFilterPod.Namespace, rpFilterPod.Name,
+				[]string{"sh", "-c", restoreRPFilterCmd})
+			Expect(err).ToNot(HaveOccurred(), stderr)
+			err = f.K8sResourceManagers.PodManager().DeleteAndWaitTillPodDeleted(rpFilterPod)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+			utils.AwsNodeName, map[string]struct{}{
+				"AWS_VPC_K8S_CNI_HAIRPIN_SNAT":   {},
+				"AWS_VPC_CNI_STRICT_RPF_SUPPORT": {},
+			})
+	})
+
+	It("pod on a secondary ENI should reach itself through its service", func() {
+		url := fmt.Sprintf("http://%s:%d", service.Spec.ClusterIP, service.Spec.Ports[0].Port)
+		stdout, stderr, err := f.K8sResourceManagers.PodManager().PodExec(targetPod.Namespace, targetPod.Name,
+			[]string{"wget", "-q", "-O", "-", "-T", "5", url})
+		Expect(err).ToNot(HaveOccurred(), stderr)
+		Expect(stdout).To(ContainSubstring("ok"))
+	})
+
+	It("pod on a secondary ENI should be reachable through the node port of the node", func() {
+		clientPod = manifest.NewDefaultPodBuilder().
+			Name("hairpin-client").
+			Container(manifest.NewBusyBoxContainerBuilder(f.Options.TestImageRegistry).Build()).
+			NodeName(secondaryNode.Name).
+			HostNetwork(true).
+			Build()
+		clientPod, err = f.K8sResourceManagers.PodManager().CreateAndWaitTillRunning(clientPod)
+		Expect(err).ToNot(HaveOccurred())
+
+		var nodeIP string
+		for _, addr := range primaryNode.Status.Addresses {
+			if addr.Type == v1.NodeInternalIP {
+				nodeIP = addr.Address
+			}
+		}
+		url := fmt.Sprintf("http://%s:%d", nodeIP, service.Spec.Ports[0].NodePort)
+		// Connections are retried a few times, each goes through a fresh conntrack entry
+		for i := 0; i < 5; i++ {
+			stdout, stderr, err := f.K8sResourceManagers.PodManager().PodExec(clientPod.Namespace, clientPod.Name,
+				[]string{"wget", "-q", "-O", "-", "-T", "5", url})
+			Expect(err).ToNot(HaveOccurred(), stderr)
+			Expect(stdout).To(ContainSubstring("ok"))
+		}
+	})
+})
@@ -102,8 +102,9 @@ var _ = Describe("test host networking", func() {
 				DeleteAndWaitTillDeploymentIsDeleted(deployment)
 			Expect(err).ToNot(HaveOccurred())
 
-			By("waiting to allow CNI to tear down networking for terminated pods")
-			time.Sleep(time.Second * 60)
+			By("waiting for the kubelet to tear down the networking of the terminated pods")
+			err = k8sUtils.WaitTillPodsDeleted(f, podLabelKey, podLabelVal, utils.DefaultPodDeleteTimeout)
+			Expect(err).ToNot(HaveOccurred())
 
 			By("validating host networking is teared down correctly")
 			common.ValidateHostNetworking(common.NetworkingTearDownSucceeds, input, primaryNode.Name, f)
@@ -222,8 +223,9 @@ func mtuValidationTest(usePodMTU bool, mtuVal int) {
 		DeleteAndWaitTillDeploymentIsDeleted(deployment)
 	Expect(err).ToNot(HaveOccurred())
 
-	By("waiting to allow CNI to tear down networking for terminated pods")
-	time.Sleep(time.Second * 60)
+	By("waiting for the kubelet to tear down the networking of the terminated pods")
+	err = k8sUtils.WaitTillPodsDeleted(f, podLabelKey, podLabelVal, utils.DefaultPodDeleteTimeout)
+	Expect(err).ToNot(HaveOccurred())
 
 	By("validating host networking is teared down correctly")
 	common.ValidateHostNetworking(common.NetworkingTearDownSucceeds, input, primaryNode.Name, f)
@@ -0,0 +1,266 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package cni
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	ipReuseLabelKey     = "role"
+	ipReuseServerName   = "ip-reuse-server"
+	ipReuseIntruderName = "ip-reuse-intruder"
+	ipReuseHTTPPort     = 8080
+	ipReuseUDPPort      = 8081
+	ipReuseReplicas     = 3
+	// The intruders take more IPs than the servers freed, so that they also take the freed IPs when the node has warm IPs
+	ipReuseIntruders = 6
+	ipReuseRounds    = 5
+	ipReuseCooldown  = 5 * time.Second
+)
+
+// Pod IPs are handed to new pods once they are out of their cooldown, while clients may still have connections to the
+// service of the deleted pods. Stale conntrack entries of the service VIP would then send the traffic of these clients
+// to the new pods. The clients keep connections to the services of the servers while the servers are replaced and
+// pods of another workload take their IPs, none of the responses may come from these pods.
+var _ = Describe("test connections across pod IP reuse", func() {
+	var (
+		err         error
+		servers     *appsV1.Deployment
+		tcpService  *v1.Service
+		udpService  *v1.Service
+		clients     []*v1.Pod
+		intruders   []*appsV1.Deployment
+		netexecArgs = []string{"netexec", fmt.Sprintf("--http-port=%d", ipReuseHTTPPort),
+			fmt.Sprintf("--udp-port=%d", ipReuseUDPPort)}
+	)
+
+	BeforeEach(func() {
+		// A short cooldown makes the IPs of the deleted servers available to the intruders within the round
+		k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+			utils.AwsNodeName, map[string]string{
+				"IP_COOLDOWN_PERIOD": fmt.Sprintf("%d", int(ipReuseCooldown.Seconds())),
+			})
+
+		By("creating the server deployment on the primary node")
+		servers = manifest.NewDefaultDeploymentBuilder().
+			Name(ipReuseServerName).
+			Container(manifest.NewAgnhostContainer().Args(netexecArgs).Build()).
+			Replicas(ipReuseReplicas).
+			PodLabel(ipReuseLabelKey, ipReuseServerName).
+			NodeName(primaryNode.Name).
+			Build()
+		servers, err = f.K8sResourceManagers.DeploymentManager().
+			CreateAndWaitTillDeploymentIsReady(servers, utils.DefaultDeploymentReadyTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("creating the TCP and UDP services of the servers")
+		tcpService, err = f.K8sResourceManagers.ServiceManager().CreateService(context.Background(),
+			manifest.NewHTTPService().
+				Name("ip-reuse-tcp").
+				Port(ipReuseHTTPPort).
+				Selector(ipReuseLabelKey, ipReuseServerName).
+				Build())
+		Expect(err).ToNot(HaveOccurred())
+		udpService, err = f.K8sResourceManagers.ServiceManager().CreateService(context.Background(),
+			manifest.NewHTTPService().
+				Name("ip-reuse-udp").
+				Port(ipReuseUDPPort).
+				Protocol(v1.ProtocolUDP).
+				Selector(ipReuseLabelKey, ipReuseServerName).
+				Build())
+		Expect(err).ToNot(HaveOccurred())
+
+		// The clients reach the services by name, so that they do not need brackets around IPv6 addresses. curl keeps
+		// its connection alive across the requests, and nc sends all the datagrams from the same socket. nc is
+		// restarted when an ICMP error of a deleted server ends it.
+		By("starting the long-lived clients on the secondary node")
+		tcpClient := manifest.NewCurlContainer().
+			Command([]string{"curl"}).
+			Args([]string{"-s", "--max-time", "2", "--rate", "5/s", "-w", "\n",
+				fmt.Sprintf("http://%s.%s:%d/hostname?[1-100000]", tcpService.Name, tcpService.Namespace,
+					ipReuseHTTPPort)}).
+			Build()
+		udpClient := manifest.NewNetCatAlpineContainer(f.Options.TestImageRegistry).
+			Command([]string{"sh", "-c"}).
+			Args([]string{fmt.Sprintf("while true; do while true; do echo hostname; sleep 0.2; done | "+
+				"nc -u %s.%s %d; echo; sleep 1; done", udpService.Name, udpService.Namespace, ipReuseUDPPort)}).
+			Build()
+		clients = nil
+		for name, container := range map[string]v1.Container{
+			"ip-reuse-tcp-client": tcpClient,
+			"ip-reuse-udp-client": udpClient,
+		} {
+			client, err := f.K8sResourceManagers.PodManager().CreateAndWaitTillRunning(
+				manifest.NewDefaultPodBuilder().
+					Name(name).
+					Container(container).
+					NodeName(secondaryNode.Name).
+					Build())
+			Expect(err).ToNot(HaveOccurred())
+			clients = append(clients, client)
+		}
+	})
+
+	AfterEach(func() {
+		for _, client := range clients {
+			err = f.K8sResourceManagers.PodManager().DeleteAndWaitTillPodDeleted(client)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		for _, intruder := range intruders {
+			err = f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(intruder)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		intruders = nil
+		for _, service := range []*v1.Service{tcpService, udpService} {
+			err = f.K8sResourceManagers.ServiceManager().DeleteAndWaitTillServiceDeleted(context.Background(), service)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		err = f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(servers)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("should not send the traffic of existing connections to the pods that reuse the IPs of deleted servers", func() {
+		var reused []string
+		for round := 0; round < ipReuseRounds; round++ {
+			By(fmt.Sprintf("round %d: waiting for the clients to get responses from the servers", round))
+			waitTillClientsReachServers()
+
+			By(fmt.Sprintf("round %d: replacing the server pods", round))
+			pods, err := f.K8sResourceManagers.PodManager().
+				GetPodsWithLabelSelector(ipReuseLabelKey, ipReuseServerName)
+			Expect(err).ToNot(HaveOccurred())
+			var freedIPs []string
+			for i := range pods.Items {
+				freedIPs = append(freedIPs, pods.Items[i].Status.PodIP)
+				// The pod is gone once the kubelet ran the CNI DEL, which starts the cooldown of its IP
+				err = f.K8sResourceManagers.PodManager().DeleteAndWaitTillPodDeleted(&pods.Items[i])
+				Expect(err).ToNot(HaveOccurred())
+			}
+			_, err = f.K8sResourceManagers.DeploymentManager().
+				WaitTillDeploymentReady(servers, utils.DefaultDeploymentReadyTimeout)
+			Expect(err).ToNot(HaveOccurred())
+
+			By(fmt.Sprintf("round %d: waiting for the IPs of the deleted servers to be out of their cooldown", round))
+			waitTillIPsOutOfCooldown(freedIPs)
+
+			By(fmt.Sprintf("round %d: creating pods that take the IPs of the deleted servers", round))
+			intruder := manifest.NewDefaultDeploymentBuilder().
+				Name(fmt.Sprintf("%s-%d", ipReuseIntruderName, round)).
+				Container(manifest.NewAgnhostContainer().Args(netexecArgs).Build()).
+				Replicas(ipReuseIntruders).
+				PodLabel(ipReuseLabelKey, ipReuseIntruderName).
+				NodeName(primaryNode.Name).
+				Build()
+			intruder, err = f.K8sResourceManagers.DeploymentManager().
+				CreateAndWaitTillDeploymentIsReady(intruder, utils.DefaultDeploymentReadyTimeout)
+			Expect(err).ToNot(HaveOccurred())
+			intruders = append(intruders, intruder)
+
+			intruderPods, err := f.K8sResourceManagers.PodManager().
+				GetPodsWithLabelSelector(ipReuseLabelKey, ipReuseIntruderName)
+			Expect(err).ToNot(HaveOccurred())
+			for _, pod := range intruderPods.Items {
+				for _, ip := range freedIPs {
+					if pod.Status.PodIP == ip {
+						reused = append(reused, ip)
+					}
+				}
+			}
+			GinkgoWriter.Printf("round %d: IPs %v of the deleted servers are reused by the intruders\n", round, reused)
+
+			// Give the stale flows time to reach the intruders
+			time.Sleep(utils.PollIntervalMedium)
+
+			By(fmt.Sprintf("round %d: deleting the pods that took the IPs", round))
+			err = f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(intruder)
+			Expect(err).ToNot(HaveOccurred())
+			intruders = intruders[:len(intruders)-1]
+		}
+
+		By("verifying that the IPs of deleted servers were reused")
+		Expect(reused).ToNot(BeEmpty(), "no IP of a deleted server was reused in %d rounds", ipReuseRounds)
+
+		By("verifying that the clients still reach the servers")
+		waitTillClientsReachServers()
+
+		By("verifying that no client got a response from the pods that reused the IPs")
+		for _, client := range clients {
+			logs, err := f.K8sResourceManagers.PodManager().PodLogs(client.Namespace, client.Name)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(logs).ToNot(ContainSubstring(ipReuseIntruderName), "client %s", client.Name)
+		}
+	})
+})
+
+// waitTillClientsReachServers waits until each client got new responses from the servers, the agnhost servers respond
+// with the name of their pod
+func waitTillClientsReachServers() {
+	for _, name := range []string{"ip-reuse-tcp-client", "ip-reuse-udp-client"} {
+		logs, err := f.K8sResourceManagers.PodManager().PodLogs(utils.DefaultTestNamespace, name)
+		Expect(err).ToNot(HaveOccurred())
+		seen := strings.Count(logs, ipReuseServerName)
+
+		Eventually(func() (int, error) {
+			logs, err := f.K8sResourceManagers.PodManager().PodLogs(utils.DefaultTestNamespace, name)
+			return strings.Count(logs, ipReuseServerName), err
+		}).WithTimeout(time.Minute).WithPolling(utils.PollIntervalShort).Should(BeNumerically(">", seen),
+			"responses of the servers to client %s", name)
+	}
+}
+
+// waitTillIPsOutOfCooldown waits until ipamd of the primary node can assign the IPs again. ipamd drops the free IPs
+// from the datastore when it looks for an IP to assign, so an IP that is not in the datastore is free or released.
+func waitTillIPsOutOfCooldown(ips []string) {
+	client, err := k8sUtils.NewIntrospectionClient(f, primaryNode.Name)
+	Expect(err).ToNot(HaveOccurred())
+	defer client.Close()
+
+	err = client.WaitTill("the IPs to be out of their cooldown", utils.DefaultENIWaitTimeout,
+		func(eniInfos *datastore.ENIInfos) error {
+			var cooling []string
+			for _, eni := range eniInfos.ENIs {
+				for _, cidrs := range []map[string]*datastore.CidrInfo{eni.AvailableIPv4Cidrs, eni.IPv6Cidrs} {
+					for _, cidr := range cidrs {
+						for _, ip := range ips {
+							addr, ok := cidr.IPAddresses[ip]
+							if ok && !addr.Assigned() && time.Since(addr.UnassignedTime) < ipReuseCooldown {
+								cooling = append(cooling, ip)
+							}
+						}
+					}
+				}
+			}
+			if len(cooling) > 0 {
+				sort.Strings(cooling)
+				return fmt.Errorf("IPs %v are in their cooldown", cooling)
+			}
+			return nil
+		})
+	Expect(err).ToNot(HaveOccurred())
+}
@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 
@@ -99,6 +100,11 @@ var _ = BeforeSuite(func() {
 	for _, cidrBlockAssociationSet := range describeVPCOutput.Vpcs[0].CidrBlockAssociationSet {
 		vpcCIDRs = append(vpcCIDRs, *cidrBlockAssociationSet.CidrBlock)
 	}
+	if f.Options.IsIPv6() {
+		for _, ipv6CidrBlockAssociation := range describeVPCOutput.Vpcs[0].Ipv6CidrBlockAssociationSet {
+			vpcCIDRs = append(vpcCIDRs, *ipv6CidrBlockAssociation.Ipv6CidrBlock)
+		}
+	}
 
 	// Set the WARM_ENI_TARGET to 0 to prevent all pods being scheduled on secondary ENI
 	k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, "aws-node", "kube-system",
@@ -108,6 +114,10 @@ var _ = BeforeSuite(func() {
 		})
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	By("deleting test namespace")
 	f.K8sResourceManagers.NamespaceManager().
@@ -72,12 +72,12 @@ var _ = Describe("test pod networking", func() {
 	JustBeforeEach(func() {
 		By("authorizing security group ingress on instance security group")
 		err = f.CloudServices.EC2().
-			AuthorizeSecurityGroupIngress(instanceSecurityGroupID, protocol, serverPort, serverPort, "0.0.0.0/0", false)
+			AuthorizeSecurityGroupIngress(instanceSecurityGroupID, protocol, serverPort, serverPort, utils.AnyCIDR(f.Options.IsIPv6()), false)
 		Expect(err).ToNot(HaveOccurred())
 
 		By("authorizing security group egress on instance security group")
 		err = f.CloudServices.EC2().
-			AuthorizeSecurityGroupEgress(instanceSecurityGroupID, protocol, serverPort, serverPort, "0.0.0.0/0")
+			AuthorizeSecurityGroupEgress(instanceSecurityGroupID, protocol, serverPort, serverPort, utils.AnyCIDR(f.Options.IsIPv6()))
 		Expect(err).ToNot(HaveOccurred())
 
 		serverContainer := manifest.
@@ -105,11 +105,14 @@ var _ = Describe("test pod networking", func() {
 			common.GetPodsOnPrimaryAndSecondaryInterface(primaryNode, "node", "primary", f)
 
 		// At least two Pods should be placed on the Primary and Secondary Interface
-		// on the Primary and Secondary Node in order to test all possible scenarios
+		// on the Primary and Secondary Node in order to test all possible scenarios.
+		// With IPv6, all Pods get IPs from the prefix of the Primary Interface
 		Expect(len(interfaceToPodListOnPrimaryNode.PodsOnPrimaryENI)).
 			Should(BeNumerically(">", 1))
-		Expect(len(interfaceToPodListOnPrimaryNode.PodsOnSecondaryENI)).
-			Should(BeNumerically(">", 1))
+		if !f.Options.IsIPv6() {
+			Expect(len(interfaceToPodListOnPrimaryNode.PodsOnSecondaryENI)).
+				Should(BeNumerically(">", 1))
+		}
 
 		By("creating server deployment on secondary node")
 		secondaryNodeDeployment = manifest.
@@ -132,19 +135,21 @@ var _ = Describe("test pod networking", func() {
 		// Same reason as mentioned above
 		Expect(len(interfaceToPodListOnSecondaryNode.PodsOnPrimaryENI)).
 			Should(BeNumerically(">", 1))
-		Expect(len(interfaceToPodListOnSecondaryNode.PodsOnSecondaryENI)).
-			Should(BeNumerically(">", 1))
+		if !f.Options.IsIPv6() {
+			Expect(len(interfaceToPodListOnSecondaryNode.PodsOnSecondaryENI)).
+				Should(BeNumerically(">", 1))
+		}
 	})
 
 	JustAfterEach(func() {
 		By("revoking security group ingress on instance security group")
 		err = f.CloudServices.EC2().
-			RevokeSecurityGroupIngress(instanceSecurityGroupID, protocol, serverPort, serverPort, "0.0.0.0/0", false)
+			RevokeSecurityGroupIngress(instanceSecurityGroupID, protocol, serverPort, serverPort, utils.AnyCIDR(f.Options.IsIPv6()), false)
 		Expect(err).ToNot(HaveOccurred())
 
 		By("revoking security group egress on instance security group")
 		err = f.CloudServices.EC2().
-			RevokeSecurityGroupEgress(instanceSecurityGroupID, protocol, serverPort, serverPort, "0.0.0.0/0")
+			RevokeSecurityGroupEgress(instanceSecurityGroupID, protocol, serverPort, serverPort, utils.AnyCIDR(f.Options.IsIPv6()))
 		Expect(err).ToNot(HaveOccurred())
 
 		By("deleting the primary node server deployment")
@@ -176,7 +181,7 @@ var _ = Describe("test pod networking", func() {
 			testerExpectedStdErr = ""
 
 			testConnectionCommandFunc = func(receiverPod coreV1.Pod, port int) []string {
-				return []string{"ping", "-c", strconv.Itoa(packetCount), receiverPod.Status.PodIP}
+				return []string{"ping", "-c", strconv.Itoa(packetCount), podIP(receiverPod)}
 			}
 		})
 
@@ -203,13 +208,13 @@ var _ = Describe("test pod networking", func() {
 			// The nc flag "-u" for UDP traffic, "-v" for verbose output and "-wn" for timing out
 			// in n seconds
 			testConnectionCommandFunc = func(receiverPod coreV1.Pod, port int) []string {
-				return []string{"nc", "-u", "-v", "-w2", receiverPod.Status.PodIP, strconv.Itoa(port)}
+				return []string{"nc", "-u", "-v", "-w2", podIP(receiverPod), strconv.Itoa(port)}
 			}
 
 			// Create a negative test case with the wrong port number. This is to reinforce the
 			// positive test case work by verifying negative cases do throw error
 			testFailedConnectionCommandFunc = func(receiverPod coreV1.Pod, port int) []string {
-				return []string{"nc", "-u", "-v", "-w2", receiverPod.Status.PodIP, strconv.Itoa(port + 1)}
+				return []string{"nc", "-u", "-v", "-w2", podIP(receiverPod), strconv.Itoa(port + 1)}
 			}
 		})
 
@@ -242,13 +247,13 @@ var _ = Describe("test pod networking", func() {
 
 			// The nc flag "-v" for verbose output and "-wn" for timing out in n seconds
 			testConnectionCommandFunc = func(receiverPod coreV1.Pod, port int) []string {
-				return []string{"nc", "-v", "-w2", receiverPod.Status.PodIP, strconv.Itoa(port)}
+				return []string{"nc", "-v", "-w2", podIP(receiverPod), strconv.Itoa(port)}
 			}
 
 			// Create a negative test case with the wrong port number. This is to reinforce the
 			// positive test case work by verifying negative cases do throw error
 			testFailedConnectionCommandFunc = func(receiverPod coreV1.Pod, port int) []string {
-				return []string{"nc", "-v", "-w2", receiverPod.Status.PodIP, strconv.Itoa(port + 1)}
+				return []string{"nc", "-v", "-w2", podIP(receiverPod), strconv.Itoa(port + 1)}
 			}
 		})
 
@@ -271,8 +276,8 @@ func VerifyConnectivityFailsForNegativeCase(senderPod coreV1.Pod, receiverPod co
 	testerCommand := getTestCommandFunc(receiverPod, port)
 
 	fmt.Fprintf(GinkgoWriter, "verifying connectivity fails from pod %s on node %s with IP %s to pod"+
-		" %s on node %s with IP %s\n", senderPod.Name, senderPod.Spec.NodeName, senderPod.Status.PodIP,
-		receiverPod.Name, receiverPod.Spec.NodeName, receiverPod.Status.PodIP)
+		" %s on node %s with IP %s\n", senderPod.Name, senderPod.Spec.NodeName, podIP(senderPod),
+		receiverPod.Name, receiverPod.Spec.NodeName, podIP(receiverPod))
 
 	_, _, err := f.K8sResourceManagers.PodManager().
 		PodExec(senderPod.Namespace, senderPod.Name, testerCommand)
@@ -293,6 +298,17 @@ func CheckConnectivityForMultiplePodPlacement(interfaceToPodListOnPrimaryNode co
 		interfaceToPodListOnPrimaryNode.PodsOnPrimaryENI[1],
 		testerExpectedStdOut, testerExpectedStdErr, port, getTestCommandFunc)
 
+	By("checking connection on different node, primary to primary")
+	testConnectivity(
+		interfaceToPodListOnPrimaryNode.PodsOnPrimaryENI[0],
+		interfaceToPodListOnSecondaryNode.PodsOnPrimaryENI[0],
+		testerExpectedStdOut, testerExpectedStdErr, port, getTestCommandFunc)
+
+	if f.Options.IsIPv6() {
+		// There are no Pods on Secondary Interfaces with IPv6
+		return
+	}
+
 	By("checking connection on same node, primary to secondary")
 	testConnectivity(
 		interfaceToPodListOnPrimaryNode.PodsOnPrimaryENI[0],
@@ -305,12 +321,6 @@ func CheckConnectivityForMultiplePodPlacement(interfaceToPodListOnPrimaryNode co
 		interfaceToPodListOnPrimaryNode.PodsOnSecondaryENI[1],
 		testerExpectedStdOut, testerExpectedStdErr, port, getTestCommandFunc)
 
-	By("checking connection on different node, primary to primary")
-	testConnectivity(
-		interfaceToPodListOnPrimaryNode.PodsOnPrimaryENI[0],
-		interfaceToPodListOnSecondaryNode.PodsOnPrimaryENI[0],
-		testerExpectedStdOut, testerExpectedStdErr, port, getTestCommandFunc)
-
 	By("checking connection on different node, primary to secondary")
 	testConnectivity(
 		interfaceToPodListOnPrimaryNode.PodsOnPrimaryENI[0],
@@ -331,8 +341,8 @@ func testConnectivity(senderPod coreV1.Pod, receiverPod coreV1.Pod, expectedStdo
 	testerCommand := getTestCommandFunc(receiverPod, port)
 
 	fmt.Fprintf(GinkgoWriter, "verifying connectivity from pod %s on node %s with IP %s to pod"+
-		" %s on node %s with IP %s\n", senderPod.Name, senderPod.Spec.NodeName, senderPod.Status.PodIP,
-		receiverPod.Name, receiverPod.Spec.NodeName, receiverPod.Status.PodIP)
+		" %s on node %s with IP %s\n", senderPod.Name, senderPod.Spec.NodeName, podIP(senderPod),
+		receiverPod.Name, receiverPod.Spec.NodeName, podIP(receiverPod))
 
 	stdOut, stdErr, err := f.K8sResourceManagers.PodManager().
 		PodExec(senderPod.Namespace, senderPod.Name, testerCommand)
@@ -343,3 +353,8 @@ func testConnectivity(senderPod coreV1.Pod, receiverPod coreV1.Pod, expectedStdo
 	Expect(stdErr).To(ContainSubstring(expectedStderr))
 	Expect(stdOut).To(ContainSubstring(expectedStdout))
 }
+
+// podIP returns the IP of the Pod in the IP family of the cluster
+func podIP(pod coreV1.Pod) string {
+	return utils.GetPodIP(pod, f.Options.IsIPv6())
+}
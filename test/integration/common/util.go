@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net"
 	"os"
 	"os/exec"
 
@@ -17,6 +18,7 @@ import (
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/agent"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 )
 
 type TestType int
@@ -138,26 +140,49 @@ func GetPodsOnPrimaryAndSecondaryInterface(node coreV1.Node,
 
 	ipToPod := map[string]coreV1.Pod{}
 	for _, pod := range podList.Items {
-		ipToPod[pod.Status.PodIP] = pod
+		ipToPod[utils.GetPodIP(pod, f.Options.IsIPv6())] = pod
 	}
 
 	for _, nwInterface := range instance.NetworkInterfaces {
 		isPrimary := IsPrimaryENI(nwInterface, instance.PrivateIpAddress)
-		for _, ip := range nwInterface.PrivateIpAddresses {
-			if pod, found := ipToPod[*ip.PrivateIpAddress]; found {
-				if isPrimary {
-					interfaceToPodList.PodsOnPrimaryENI =
-						append(interfaceToPodList.PodsOnPrimaryENI, pod)
-				} else {
-					interfaceToPodList.PodsOnSecondaryENI =
-						append(interfaceToPodList.PodsOnSecondaryENI, pod)
+		var pods []coreV1.Pod
+		if f.Options.IsIPv6() {
+			pods = podsOnIPv6Interface(nwInterface, ipToPod)
+		} else {
+			for _, ip := range nwInterface.PrivateIpAddresses {
+				if pod, found := ipToPod[*ip.PrivateIpAddress]; found {
+					pods = append(pods, pod)
 				}
 			}
 		}
+		if isPrimary {
+			interfaceToPodList.PodsOnPrimaryENI = append(interfaceToPodList.PodsOnPrimaryENI, pods...)
+		} else {
+			interfaceToPodList.PodsOnSecondaryENI = append(interfaceToPodList.PodsOnSecondaryENI, pods...)
+		}
 	}
 	return interfaceToPodList
 }
 
+// podsOnIPv6Interface returns the pods with an IPv6 address from the prefixes or addresses of the interface
+func podsOnIPv6Interface(nwInterface *ec2.InstanceNetworkInterface, ipToPod map[string]coreV1.Pod) []coreV1.Pod {
+	var pods []coreV1.Pod
+	for podIP, pod := range ipToPod {
+		ip := net.ParseIP(podIP)
+		for _, prefix := range nwInterface.Ipv6Prefixes {
+			if _, ipNet, err := net.ParseCIDR(*prefix.Ipv6Prefix); err == nil && ipNet.Contains(ip) {
+				pods = append(pods, pod)
+			}
+		}
+		for _, address := range nwInterface.Ipv6Addresses {
+			if ip.Equal(net.ParseIP(*address.Ipv6Address)) {
+				pods = append(pods, pod)
+			}
+		}
+	}
+	return pods
+}
+
 func GetTrafficTestConfig(f *framework.Framework, protocol string, serverDeploymentBuilder *manifest.DeploymentBuilder, clientCount int, serverCount int) agent.TrafficTest {
 	return agent.TrafficTest{
 		Framework:                      f,
@@ -170,6 +195,7 @@ func GetTrafficTestConfig(f *framework.Framework, protocol string, serverDeploym
 		ServerPodLabelVal:              serverPodLabelVal,
 		ClientPodLabelKey:              labelKey,
 		ClientPodLabelVal:              clientPodLabelVal,
+		IsV6Enabled:                    f.Options.IsIPv6(),
 	}
 }
 
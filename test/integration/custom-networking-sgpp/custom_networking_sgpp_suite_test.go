@@ -21,6 +21,7 @@ import (
 
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
@@ -29,7 +30,6 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	corev1 "k8s.io/api/core/v1"
 
-	"github.com/apparentlymart/go-cidr/cidr"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 )
@@ -44,12 +44,11 @@ var (
 	// VPC Configuration with the details of public subnet and availability zone present in the cluster's subnets
 	clusterVPCConfig *awsUtils.ClusterVPCConfig
 	// The CIDR Range that will be associated with the VPC to create new subnet for Custom Networking
-	cidrRangeString        string
-	cidrRange              *net.IPNet
-	cidrBlockAssociationID string
+	cidrRangeString string
+	cidrRange       *net.IPNet
+	vpcFixture      *awsUtils.VPCFixture
 	// Security Group that will be used in ENIConfig
-	customNetworkingSGID         string
-	customNetworkingSubnetIDList []string
+	customNetworkingSGID string
 	// List of ENIConfig per Availability Zone
 	eniConfigList        []*v1alpha1.ENIConfig
 	eniConfigBuilderList []*manifest.ENIConfigBuilder
@@ -71,14 +70,16 @@ var (
 
 // Parse test specific variable from flag
 func init() {
-	flag.StringVar(&cidrRangeString, "custom-networking-cidr-range", "100.64.0.0/16", "custom networking cidr range to be associated with the VPC")
+	flag.StringVar(&cidrRangeString, "custom-networking-cidr-range", "", "custom networking cidr range to be associated with the VPC, a free /16 of 100.64.0.0/10 by default")
 }
 
 var _ = BeforeSuite(func() {
 	f = framework.New(framework.GlobalOptions)
 
-	_, cidrRange, err = net.ParseCIDR(cidrRangeString)
-	Expect(err).ToNot(HaveOccurred())
+	if cidrRangeString != "" {
+		_, cidrRange, err = net.ParseCIDR(cidrRangeString)
+		Expect(err).ToNot(HaveOccurred())
+	}
 
 	By("getting the cluster VPC Config")
 	clusterVPCConfig, err = awsUtils.GetClusterVPCConfig(f)
@@ -94,7 +95,7 @@ var _ = BeforeSuite(func() {
 	// TODO: Ideally, we would clone the Custom Networking SG from the cluster SG. Unfortunately, the EC2 API does not support this.
 	By("creating security group to be used by custom networking")
 	createSecurityGroupOutput, err := f.CloudServices.EC2().
-		CreateSecurityGroup("custom-networking-test", "custom networking", f.Options.AWSVPCID)
+		CreateSecurityGroup("custom-networking-sgpp-test", "custom networking", f.Options.AWSVPCID)
 	Expect(err).ToNot(HaveOccurred())
 	customNetworkingSGID = *createSecurityGroupOutput.GroupId
 
@@ -102,27 +103,18 @@ var _ = BeforeSuite(func() {
 	f.CloudServices.EC2().AuthorizeSecurityGroupEgress(customNetworkingSGID, "-1", -1, -1, v4Zero)
 	f.CloudServices.EC2().AuthorizeSecurityGroupIngress(customNetworkingSGID, "-1", -1, -1, v4Zero, false)
 
-	By("associating cidr range to the VPC")
-	association, err := f.CloudServices.EC2().AssociateVPCCIDRBlock(f.Options.AWSVPCID, cidrRange.String())
+	By("creating the VPC fixture with a subnet in each availability zone")
+	vpcFixture, err = awsUtils.CreateVPCFixture(f, awsUtils.VPCFixtureProperties{
+		Name:              "custom-networking-sgpp",
+		AvailabilityZones: clusterVPCConfig.AvailZones,
+		RouteTableID:      clusterVPCConfig.PublicRouteTableID,
+		CIDR:              cidrRange,
+	})
 	Expect(err).ToNot(HaveOccurred())
-	cidrBlockAssociationID = *association.CidrBlockAssociation.AssociationId
-
-	for i, az := range clusterVPCConfig.AvailZones {
-		By(fmt.Sprintf("creating the subnet in %s", az))
-
-		subnetCidr, err := cidr.Subnet(cidrRange, 8, 5*i)
-		Expect(err).ToNot(HaveOccurred())
-
-		createSubnetOutput, err := f.CloudServices.EC2().
-			CreateSubnet(subnetCidr.String(), f.Options.AWSVPCID, az)
-		Expect(err).ToNot(HaveOccurred())
-
-		subnetID := *createSubnetOutput.Subnet.SubnetId
-
-		By("associating the route table with the newly created subnet")
-		err = f.CloudServices.EC2().AssociateRouteTableToSubnet(clusterVPCConfig.PublicRouteTableID, subnetID)
-		Expect(err).ToNot(HaveOccurred())
+	cidrRange = vpcFixture.CIDR
 
+	for _, az := range clusterVPCConfig.AvailZones {
+		subnetID := vpcFixture.SubnetIDs[az]
 		eniConfigBuilder := manifest.NewENIConfigBuilder().
 			Name(az).
 			SubnetID(subnetID).
@@ -131,7 +123,6 @@ var _ = BeforeSuite(func() {
 		Expect(err).ToNot(HaveOccurred())
 
 		// For updating/deleting later
-		customNetworkingSubnetIDList = append(customNetworkingSubnetIDList, subnetID)
 		eniConfigBuilderList = append(eniConfigBuilderList, eniConfigBuilder)
 		eniConfigList = append(eniConfigList, eniConfig.DeepCopy())
 
@@ -143,7 +134,7 @@ var _ = BeforeSuite(func() {
 	// Security Groups for Pods setup
 	// Note that Custom Networking only supports IPv4 clusters, so IPv4 setup can be assumed.
 	By("creating a new security group for use in Security Group Policy")
-	podEniSGName := "pod-eni-automation-v4"
+	podEniSGName := "custom-networking-sgpp-pod-eni"
 	securityGroupOutput, err := f.CloudServices.EC2().CreateSecurityGroup(podEniSGName,
 		"test created by vpc cni automation test suite", f.Options.AWSVPCID)
 	Expect(err).ToNot(HaveOccurred())
@@ -183,6 +174,10 @@ var _ = BeforeSuite(func() {
 	targetNode = nodeList.Items[0]
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	var errs prometheus.MultiError
 	for _, eniConfig := range eniConfigList {
@@ -207,13 +202,8 @@ var _ = AfterSuite(func() {
 	By("deleting pod ENI security group")
 	errs.Append(f.CloudServices.EC2().DeleteSecurityGroup(podEniSGID))
 
-	for _, subnet := range customNetworkingSubnetIDList {
-		By(fmt.Sprintf("deleting the subnet %s", subnet))
-		errs.Append(f.CloudServices.EC2().DeleteSubnet(subnet))
-	}
-
-	By("disassociating the CIDR range to the VPC")
-	errs.Append(f.CloudServices.EC2().DisAssociateVPCCIDRBlock(cidrBlockAssociationID))
+	By("deleting the subnets and the CIDR range of the VPC fixture")
+	errs.Append(awsUtils.DeleteVPCFixture(f, vpcFixture))
 
 	Expect(errs.MaybeUnwrap()).ToNot(HaveOccurred())
 })
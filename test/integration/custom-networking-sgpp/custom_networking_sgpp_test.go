@@ -16,11 +16,12 @@ package custom_networking_sgpp
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/agent/pkg/input"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/agent"
+	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 
 	"github.com/aws/amazon-vpc-resource-controller-k8s/apis/vpcresources/v1beta1"
@@ -88,8 +89,9 @@ var _ = Describe("Custom Networking + Security Groups for Pods Test", func() {
 		By("Deleting Security Group Policy")
 		f.K8sResourceManagers.CustomResourceManager().DeleteResource(securityGroupPolicy)
 
-		By("waiting for the branch ENI to be cooled down")
-		time.Sleep(time.Second * 60)
+		By("waiting for the branch ENIs to be cooled down and deleted")
+		err := awsUtils.WaitTillBranchENIsDeleted(f, podEniSGID, utils.DefaultENIWaitTimeout)
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	Context("when testing traffic between branch ENI pods and regular pods", func() {
@@ -239,8 +241,9 @@ var _ = Describe("Custom Networking + Security Groups for Pods Test", func() {
 				DeleteAndWaitTillDeploymentIsDeleted(deployment)
 			Expect(err).ToNot(HaveOccurred())
 
-			By("waiting to allow CNI to tear down networking for terminated pods")
-			time.Sleep(time.Second * 60)
+			By("waiting for the kubelet to tear down the networking of the terminated pods")
+			err = k8sUtils.WaitTillPodsDeleted(f, labelKey, busyboxPodLabelVal, utils.DefaultPodDeleteTimeout)
+			Expect(err).ToNot(HaveOccurred())
 
 			By("validating host networking is teared down correctly")
 			ValidateHostNetworking(NetworkingTearDownSucceeds, input)
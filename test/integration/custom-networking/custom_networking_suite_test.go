@@ -15,13 +15,12 @@ package custom_networking
 
 import (
 	"flag"
-	"fmt"
 	"net"
 	"testing"
 
-	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/aws/amazon-vpc-cni-k8s/pkg/apis/crd/v1alpha1"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
@@ -46,16 +45,15 @@ var (
 	clusterVPCConfig *awsUtils.ClusterVPCConfig
 	// The CIDR Range that will be associated with the VPC to create new
 	// subnet for custom networking
-	cidrRangeString        string
-	cidrRange              *net.IPNet
-	cidrBlockAssociationID string
+	cidrRangeString string
+	cidrRange       *net.IPNet
+	vpcFixture      *awsUtils.VPCFixture
 	// Security Group that will be used in ENIConfig
-	customNetworkingSGID         string
-	customNetworkingSGOpenPort   = 8080
-	customNetworkingSubnetIDList []string
-	corednsSGOpenPort            = 53
-	primaryENISGID               string
-	primaryENISGList             []string
+	customNetworkingSGID       string
+	customNetworkingSGOpenPort = 8080
+	corednsSGOpenPort          = 53
+	primaryENISGID             string
+	primaryENISGList           []string
 	// List of ENIConfig per Availability Zone
 	eniConfigList        []*v1alpha1.ENIConfig
 	eniConfigBuilderList []*manifest.ENIConfigBuilder
@@ -63,15 +61,17 @@ var (
 
 // Parse test specific variable from flag
 func init() {
-	flag.StringVar(&cidrRangeString, "custom-networking-cidr-range", "100.64.0.0/16", "custom networking cidr range to be associated with the VPC")
+	flag.StringVar(&cidrRangeString, "custom-networking-cidr-range", "", "custom networking cidr range to be associated with the VPC, a free /16 of 100.64.0.0/10 by default")
 }
 
 var _ = BeforeSuite(func() {
 	f = framework.New(framework.GlobalOptions)
 
 	var err error
-	_, cidrRange, err = net.ParseCIDR(cidrRangeString)
-	Expect(err).ToNot(HaveOccurred())
+	if cidrRangeString != "" {
+		_, cidrRange, err = net.ParseCIDR(cidrRangeString)
+		Expect(err).ToNot(HaveOccurred())
+	}
 
 	By("creating test namespace")
 	f.K8sResourceManagers.NamespaceManager().CreateNamespace(utils.DefaultTestNamespace)
@@ -138,27 +138,18 @@ var _ = BeforeSuite(func() {
 			-1, -1, customNetworkingSGID, true)
 	}
 
-	By("associating cidr range to the VPC")
-	association, err := f.CloudServices.EC2().AssociateVPCCIDRBlock(f.Options.AWSVPCID, cidrRange.String())
+	By("creating the VPC fixture with a subnet in each availability zone")
+	vpcFixture, err = awsUtils.CreateVPCFixture(f, awsUtils.VPCFixtureProperties{
+		Name:              "custom-networking",
+		AvailabilityZones: clusterVPCConfig.AvailZones,
+		RouteTableID:      clusterVPCConfig.PublicRouteTableID,
+		CIDR:              cidrRange,
+	})
 	Expect(err).ToNot(HaveOccurred())
-	cidrBlockAssociationID = *association.CidrBlockAssociation.AssociationId
-
-	for i, az := range clusterVPCConfig.AvailZones {
-		By(fmt.Sprintf("creating the subnet in %s", az))
-
-		subnetCidr, err := cidr.Subnet(cidrRange, 8, 5*i)
-		Expect(err).ToNot(HaveOccurred())
-
-		createSubnetOutput, err := f.CloudServices.EC2().
-			CreateSubnet(subnetCidr.String(), f.Options.AWSVPCID, az)
-		Expect(err).ToNot(HaveOccurred())
-
-		subnetID := *createSubnetOutput.Subnet.SubnetId
-
-		By("associating the route table with the newly created subnet")
-		err = f.CloudServices.EC2().AssociateRouteTableToSubnet(clusterVPCConfig.PublicRouteTableID, subnetID)
-		Expect(err).ToNot(HaveOccurred())
+	cidrRange = vpcFixture.CIDR
 
+	for _, az := range clusterVPCConfig.AvailZones {
+		subnetID := vpcFixture.SubnetIDs[az]
 		eniConfigBuilder := manifest.NewENIConfigBuilder().
 			Name(az).
 			SubnetID(subnetID).
@@ -167,7 +158,6 @@ var _ = BeforeSuite(func() {
 		Expect(err).ToNot(HaveOccurred())
 
 		// For updating/deleting later
-		customNetworkingSubnetIDList = append(customNetworkingSubnetIDList, subnetID)
 		eniConfigBuilderList = append(eniConfigBuilderList, eniConfigBuilder)
 		eniConfigList = append(eniConfigList, eniConfig.DeepCopy())
 
@@ -189,6 +179,10 @@ var _ = BeforeSuite(func() {
 	Expect(err).ToNot(HaveOccurred())
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	By("deleting test namespace")
 	f.K8sResourceManagers.NamespaceManager().
@@ -220,13 +214,8 @@ var _ = AfterSuite(func() {
 	By("deleting security group")
 	errs.Append(f.CloudServices.EC2().DeleteSecurityGroup(customNetworkingSGID))
 
-	for _, subnet := range customNetworkingSubnetIDList {
-		By(fmt.Sprintf("deleting the subnet %s", subnet))
-		errs.Append(f.CloudServices.EC2().DeleteSubnet(subnet))
-	}
-
-	By("disassociating the CIDR range to the VPC")
-	errs.Append(f.CloudServices.EC2().DisAssociateVPCCIDRBlock(cidrBlockAssociationID))
+	By("deleting the subnets and the CIDR range of the VPC fixture")
+	errs.Append(awsUtils.DeleteVPCFixture(f, vpcFixture))
 
 	Expect(errs.MaybeUnwrap()).ToNot(HaveOccurred())
 })
@@ -147,7 +147,7 @@ var _ = Describe("Custom Networking Test", func() {
 
 		It("deployment should not become ready", func() {
 			By("terminating instances")
-			err := awsUtils.TerminateInstances(f)
+			err := awsUtils.TerminateInstancesAndWaitTillRegistered(f)
 			Expect(err).ToNot(HaveOccurred())
 
 			// Nodes should be stuck in NotReady state since no ENIs could be attached and no pod
@@ -18,10 +18,9 @@ import (
 	"fmt"
 	"net"
 	"testing"
-	"time"
 
-	"github.com/apparentlymart/go-cidr/cidr"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
@@ -38,23 +37,27 @@ func TestCustomNetworking(t *testing.T) {
 }
 
 var (
-	f                      *framework.Framework
-	clusterVPCConfig       *awsUtils.ClusterVPCConfig
-	cidrRangeString        string
-	cidrRange              *net.IPNet
-	cidrBlockAssociationID string
-	createdSubnet          string
-	primaryInstance        *ec2.Instance
+	f                *framework.Framework
+	clusterVPCConfig *awsUtils.ClusterVPCConfig
+	cidrRangeString  string
+	vpcFixture       *awsUtils.VPCFixture
+	createdSubnet    string
+	primaryInstance  *ec2.Instance
 )
 
 // Parse test specific variable from flag
 func init() {
-	flag.StringVar(&cidrRangeString, "secondary-cidr-range", "100.64.0.0/16", "second cidr range to be associated with the VPC")
+	flag.StringVar(&cidrRangeString, "secondary-cidr-range", "", "second cidr range to be associated with the VPC, a free /16 of 100.64.0.0/10 by default")
 }
 
 var _ = BeforeSuite(func() {
 	f = framework.New(framework.GlobalOptions)
 
+	if f.Options.IsIPv6() {
+		// With IPv6, the pods get IPs from the prefix of the primary ENI, and no secondary ENI is attached
+		Skip("subnet selection for secondary ENIs only applies to IPv4")
+	}
+
 	nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(f.Options.NgNameLabelKey,
 		f.Options.NgNameLabelVal)
 	Expect(err).ToNot(HaveOccurred())
@@ -77,8 +80,11 @@ var _ = BeforeSuite(func() {
 	primaryInstance, err = f.CloudServices.EC2().DescribeInstance(instanceID)
 	Expect(err).ToNot(HaveOccurred())
 
-	_, cidrRange, err = net.ParseCIDR(cidrRangeString)
-	Expect(err).ToNot(HaveOccurred())
+	var cidrRange *net.IPNet
+	if cidrRangeString != "" {
+		_, cidrRange, err = net.ParseCIDR(cidrRangeString)
+		Expect(err).ToNot(HaveOccurred())
+	}
 
 	By("creating test namespace")
 	f.K8sResourceManagers.NamespaceManager().CreateNamespace(utils.DefaultTestNamespace)
@@ -87,52 +93,50 @@ var _ = BeforeSuite(func() {
 	clusterVPCConfig, err = awsUtils.GetClusterVPCConfig(f)
 	Expect(err).ToNot(HaveOccurred())
 
-	By("associating cidr range to the VPC")
-	association, err := f.CloudServices.EC2().AssociateVPCCIDRBlock(f.Options.AWSVPCID, cidrRange.String())
-	Expect(err).ToNot(HaveOccurred())
-	cidrBlockAssociationID = *association.CidrBlockAssociation.AssociationId
-
-	By(fmt.Sprintf("creating the subnet in %s", *primaryInstance.Placement.AvailabilityZone))
-
+	By(fmt.Sprintf("creating the VPC fixture in %s", *primaryInstance.Placement.AvailabilityZone))
 	// Subnet must be greater than /19
-	subnetCidr, err := cidr.Subnet(cidrRange, 2, 0)
-	Expect(err).ToNot(HaveOccurred())
-
-	createSubnetOutput, err := f.CloudServices.EC2().
-		CreateSubnet(subnetCidr.String(), f.Options.AWSVPCID, *primaryInstance.Placement.AvailabilityZone)
-	Expect(err).ToNot(HaveOccurred())
-
-	subnetID := *createSubnetOutput.Subnet.SubnetId
-
-	By("associating the route table with the newly created subnet")
-	err = f.CloudServices.EC2().AssociateRouteTableToSubnet(clusterVPCConfig.PublicRouteTableID, subnetID)
+	vpcFixture, err = awsUtils.CreateVPCFixture(f, awsUtils.VPCFixtureProperties{
+		Name:              "eni-subnet-discovery",
+		AvailabilityZones: []string{*primaryInstance.Placement.AvailabilityZone},
+		SubnetPrefixLen:   18,
+		RouteTableID:      clusterVPCConfig.PublicRouteTableID,
+		CIDR:              cidrRange,
+	})
 	Expect(err).ToNot(HaveOccurred())
+	subnetID := vpcFixture.SubnetIDs[*primaryInstance.Placement.AvailabilityZone]
+	cidrRangeString = vpcFixture.CIDR.String()
 
 	By("try detaching all ENIs by setting WARM_ENI_TARGET to 0")
 	k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
 		utils.AwsNodeName, map[string]string{"WARM_ENI_TARGET": "0"})
 
-	By("sleeping to allow CNI Plugin to delete unused ENIs")
-	time.Sleep(time.Second * 90)
+	By("waiting for ipamd to delete the unused ENIs")
+	err = k8sUtils.WaitTillUnusedENIsReleased(f, primaryNode.Name, utils.DefaultENIWaitTimeout)
+	Expect(err).ToNot(HaveOccurred())
 
 	createdSubnet = subnetID
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
+	if f.Options.IsIPv6() {
+		return
+	}
+
 	By("deleting test namespace")
 	f.K8sResourceManagers.NamespaceManager().
 		DeleteAndWaitTillNamespaceDeleted(utils.DefaultTestNamespace)
 
 	var errs prometheus.MultiError
 
-	By("sleeping to allow CNI Plugin to delete unused ENIs")
-	time.Sleep(time.Second * 90)
-
-	By(fmt.Sprintf("deleting the subnet %s", createdSubnet))
-	errs.Append(f.CloudServices.EC2().DeleteSubnet(createdSubnet))
+	By("waiting for ipamd to delete the unused ENIs")
+	errs.Append(k8sUtils.WaitTillUnusedENIsReleased(f, *primaryInstance.PrivateDnsName, utils.DefaultENIWaitTimeout))
 
-	By("disassociating the CIDR range to the VPC")
-	errs.Append(f.CloudServices.EC2().DisAssociateVPCCIDRBlock(cidrBlockAssociationID))
+	By(fmt.Sprintf("deleting the subnet %s and the CIDR range of the VPC fixture", createdSubnet))
+	errs.Append(awsUtils.DeleteVPCFixture(f, vpcFixture))
 
 	Expect(errs.MaybeUnwrap()).ToNot(HaveOccurred())
 
@@ -77,8 +77,12 @@ var _ = Describe("ENI Subnet Selection Test", func() {
 			err := f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployment)
 			Expect(err).ToNot(HaveOccurred())
 
-			By("sleeping to allow CNI Plugin to delete unused ENIs")
-			time.Sleep(time.Second * 90)
+			err = k8sUtils.WaitTillPodsDeleted(f, podLabelKey, podLabelVal, utils.DefaultPodDeleteTimeout)
+			Expect(err).ToNot(HaveOccurred())
+
+			By("waiting for ipamd to delete the unused ENIs")
+			err = k8sUtils.WaitTillUnusedENIsReleased(f, *primaryInstance.PrivateDnsName, utils.DefaultENIWaitTimeout)
+			Expect(err).ToNot(HaveOccurred())
 
 			newEniSubnetIds = nil
 		})
@@ -121,7 +125,7 @@ var _ = Describe("ENI Subnet Selection Test", func() {
 						)
 					Expect(err).ToNot(HaveOccurred())
 				})
-				It(fmt.Sprintf("should have subnet in CIDR range %s", cidrRangeString), func() {
+				It("should have subnet in the CIDR range of the VPC fixture", func() {
 					checkSecondaryENISubnets(true)
 				})
 
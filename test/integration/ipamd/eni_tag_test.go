@@ -16,8 +16,10 @@ package ipamd
 import (
 	"encoding/json"
 	"fmt"
-	"time"
 
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 
@@ -46,8 +48,9 @@ var _ = Describe("test tags are created on Secondary ENI", func() {
 		k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
 			utils.AwsNodeName, map[string]string{"WARM_ENI_TARGET": "0"})
 
-		By("sleeping to allow CNI Plugin delete unused ENIs")
-		time.Sleep(time.Second * 90)
+		By("waiting for ipamd to delete the unused ENIs")
+		err := k8sUtils.WaitTillUnusedENIsReleased(f, *primaryInstance.PrivateDnsName, utils.DefaultENIWaitTimeout)
+		Expect(err).ToNot(HaveOccurred())
 
 		By("getting the list of ENIs before setting ADDITIONAL_ENI_TAGS")
 		instance, err := f.CloudServices.EC2().DescribeInstance(*primaryInstance.InstanceId)
@@ -62,19 +65,22 @@ var _ = Describe("test tags are created on Secondary ENI", func() {
 		k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
 			utils.AwsNodeName, environmentVariables)
 
-		By("sleeping to allow CNI Plugin to create new ENI with additional tags")
-		time.Sleep(time.Second * 90)
-
-		By("getting the list of current ENIs by describing the instance")
-		instance, err = f.CloudServices.EC2().DescribeInstance(*primaryInstance.InstanceId)
+		By("waiting for ipamd to create a new ENI with additional tags")
+		err = awsUtils.WaitTillInstanceENIs(f, *primaryInstance.InstanceId, "a new ENI", utils.DefaultENIWaitTimeout,
+			func(enis []*ec2.InstanceNetworkInterface) error {
+				newENIs = nil
+				for _, nwInterface := range enis {
+					if _, ok := existingENIs[*nwInterface.NetworkInterfaceId]; !ok {
+						newENIs = append(newENIs, *nwInterface.NetworkInterfaceId)
+					}
+				}
+				if len(newENIs) == 0 {
+					return fmt.Errorf("no ENI attached besides %d existing ones", len(existingENIs))
+				}
+				return nil
+			})
 		Expect(err).ToNot(HaveOccurred())
 
-		for _, nwInterface := range instance.NetworkInterfaces {
-			if _, ok := existingENIs[*nwInterface.NetworkInterfaceId]; !ok {
-				newENIs = append(newENIs, *nwInterface.NetworkInterfaceId)
-			}
-		}
-
 		By("verifying at least one new Secondary ENI is created")
 		Expect(len(newENIs)).Should(BeNumerically(">", 0))
 	})
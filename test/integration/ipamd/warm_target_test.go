@@ -29,6 +29,12 @@ import (
 // IMPORTANT: Only support nodes that can have 16+ Secondary IPV4s across at least 3 ENI
 var _ = Describe("test warm target variables", func() {
 
+	BeforeEach(func() {
+		if f.Options.IsIPv6() {
+			Skip("warm targets only apply to IPv4")
+		}
+	})
+
 	Context("when warm ENI target is used", func() {
 		var warmENITarget int
 		var maxENI int
@@ -169,3 +175,40 @@ var _ = Describe("test warm target variables", func() {
 		})
 	})
 })
+
+// With IPv6, ipamd assigns a single /80 prefix to the primary ENI, whatever the warm targets
+var _ = Describe("test warm target variables with IPv6", func() {
+	BeforeEach(func() {
+		if !f.Options.IsIPv6() {
+			Skip("the cluster is not an IPv6 cluster")
+		}
+	})
+
+	Context("when WARM_ENI_TARGET = 3 and WARM_IP_TARGET = 16", func() {
+		JustBeforeEach(func() {
+			k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f,
+				utils.AwsNodeName, utils.AwsNodeNamespace, utils.AwsNodeName,
+				map[string]string{
+					"WARM_ENI_TARGET": "3",
+					"WARM_IP_TARGET":  "16",
+				})
+		})
+
+		JustAfterEach(func() {
+			k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f,
+				utils.AwsNodeName, utils.AwsNodeNamespace, utils.AwsNodeName,
+				map[string]struct{}{"WARM_ENI_TARGET": {}, "WARM_IP_TARGET": {}})
+		})
+
+		It("instance should have only the primary ENI with one IPv6 prefix", func() {
+			Consistently(func(g Gomega) {
+				primaryInstance, err = f.CloudServices.
+					EC2().DescribeInstance(*primaryInstance.InstanceId)
+				g.Expect(err).ToNot(HaveOccurred())
+
+				g.Expect(primaryInstance.NetworkInterfaces).Should(HaveLen(1))
+				g.Expect(primaryInstance.NetworkInterfaces[0].Ipv6Prefixes).Should(HaveLen(1))
+			}).WithTimeout(2 * time.Minute).WithPolling(10 * time.Second).Should(Succeed())
+		})
+	})
+})
@@ -29,6 +29,12 @@ import (
 // IMPORTANT: Only support nodes that can have 16+ Secondary IPV4s across at least 3 ENI
 var _ = Describe("test warm target variables", func() {
 
+	BeforeEach(func() {
+		if f.Options.IsIPv6() {
+			Skip("warm targets only apply to IPv4")
+		}
+	})
+
 	Context("when warm and min IP target is set with PD enabled", func() {
 		var warmIPTarget, minIPTarget int
 
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 
 	. "github.com/onsi/ginkgo/v2"
@@ -36,3 +37,7 @@ var _ = BeforeSuite(func() {
 	By("verifying that atleast 1 node is present for the test")
 	Expect(len(nodes.Items)).Should(BeNumerically(">", 0))
 })
+
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
@@ -0,0 +1,228 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pod_eni
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/ipamd/datastore"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/agent"
+	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+
+	vpcControllerFW "github.com/aws/amazon-vpc-resource-controller-k8s/test/framework/manifest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+	metaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	enforcingModeEnv    = "POD_SECURITY_GROUP_ENFORCING_MODE"
+	prefixDelegationEnv = "ENABLE_PREFIX_DELEGATION"
+	// Port that the traffic server listens on, which the security group of the branch ENIs does not open
+	closedPort = 2271
+)
+
+// The same scenarios run for each enforcing mode and prefix delegation setting, since the plugin sets up the branch
+// ENI pods differently in each mode and the regular pods they talk to get IPs from prefixes or secondary IPs. The
+// address family is the one of the cluster, IPv6 clusters always use prefix delegation.
+var _ = Describe("Security Group for Pods matrix", func() {
+	var (
+		labelKey           = "app"
+		serverPodLabelVal  = "matrix-server-pod"
+		clientPodLabelVal  = "matrix-client-pod"
+		busyboxPodLabelVal = "matrix-busybox-pod"
+		// A node other than the target node, for the traffic that leaves the node of the branch ENI pods
+		otherNode *v1.Node
+	)
+
+	BeforeEach(func() {
+		nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
+		Expect(err).ToNot(HaveOccurred())
+		otherNode = nil
+		for i := range nodeList.Items {
+			if nodeList.Items[i].Name != targetNode.Name {
+				otherNode = &nodeList.Items[i]
+				break
+			}
+		}
+	})
+
+	AfterEach(func() {
+		By("deleting test namespace")
+		f.K8sResourceManagers.NamespaceManager().
+			DeleteAndWaitTillNamespaceDeleted(utils.DefaultTestNamespace)
+
+		By("waiting for the branch ENIs to be cooled down and deleted")
+		err := awsUtils.WaitTillBranchENIsDeleted(f, securityGroupId, utils.DefaultENIWaitTimeout)
+		Expect(err).ToNot(HaveOccurred())
+
+		By("restoring the enforcing mode and prefix delegation on aws-node DaemonSet")
+		envVars := map[string]struct{}{enforcingModeEnv: {}}
+		if isIPv4Cluster {
+			envVars[prefixDelegationEnv] = struct{}{}
+		}
+		k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+			utils.AwsNodeName, envVars)
+	})
+
+	// testTraffic returns the success rate of connections from regular pods on the client node to branch ENI pods on
+	// the target node
+	testTraffic := func(port int, clientNodeName string) float64 {
+		trafficTester := agent.TrafficTest{
+			Framework: f,
+			TrafficServerDeploymentBuilder: manifest.NewDefaultDeploymentBuilder().
+				Name("traffic-server").
+				NodeName(targetNode.Name),
+			ServerPort:         port,
+			ServerProtocol:     "tcp",
+			ClientCount:        2,
+			ServerCount:        3,
+			ServerPodLabelKey:  labelKey,
+			ServerPodLabelVal:  serverPodLabelVal,
+			ClientPodLabelKey:  labelKey,
+			ClientPodLabelVal:  clientPodLabelVal,
+			ValidateServerPods: ValidatePodsHaveBranchENI,
+			IsV6Enabled:        !isIPv4Cluster,
+			ClientNodeName:     clientNodeName,
+		}
+		successRate, err := trafficTester.TestTraffic()
+		Expect(err).ToNot(HaveOccurred())
+		return successRate
+	}
+
+	DescribeTable("should enforce the security groups of branch ENI pods",
+		func(enforcingMode string, prefixDelegation bool) {
+			if !isIPv4Cluster && !prefixDelegation {
+				Skip("IPv6 clusters always use prefix delegation")
+			}
+
+			By(fmt.Sprintf("setting %s to %s and %s to %t", enforcingModeEnv, enforcingMode,
+				prefixDelegationEnv, prefixDelegation))
+			envVars := map[string]string{enforcingModeEnv: enforcingMode}
+			if isIPv4Cluster {
+				envVars[prefixDelegationEnv] = strconv.FormatBool(prefixDelegation)
+			}
+			k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+				utils.AwsNodeName, envVars)
+			// After updating daemonset pod, we must wait until conflist is updated so that container-runtime calls CNI ADD with the new enforcing mode.
+			time.Sleep(utils.PollIntervalMedium)
+
+			if isIPv4Cluster && prefixDelegation {
+				By("waiting for ipamd to allocate a prefix")
+				waitTillPrefixAllocated()
+			}
+
+			By("creating test namespace")
+			f.K8sResourceManagers.NamespaceManager().CreateNamespace(utils.DefaultTestNamespace)
+
+			By("creating the Security Group Policy for the server and busybox pods")
+			securityGroupPolicy, err := vpcControllerFW.NewSGPBuilder().
+				Namespace(utils.DefaultTestNamespace).
+				Name("matrix-sgp").
+				SecurityGroup([]string{securityGroupId}).
+				PodMatchExpression(labelKey, metaV1.LabelSelectorOpIn, serverPodLabelVal, busyboxPodLabelVal).
+				Build()
+			Expect(err).ToNot(HaveOccurred())
+			err = f.K8sResourceManagers.CustomResourceManager().CreateResource(securityGroupPolicy)
+			Expect(err).ToNot(HaveOccurred())
+
+			if otherNode != nil {
+				By("testing traffic from another node to the open port of branch ENI pods")
+				Expect(testTraffic(openPort, otherNode.Name)).Should(BeNumerically(">=", float64(99)))
+
+				By("testing traffic from another node to the closed port of branch ENI pods")
+				Expect(testTraffic(closedPort, otherNode.Name)).Should(Equal(float64(0)))
+			}
+
+			// In strict mode all the traffic of branch ENI pods goes through their branch ENI, in standard mode the
+			// traffic between pods on the same node stays on the node and bypasses the security groups
+			By("testing traffic from the same node to the closed port of branch ENI pods")
+			if enforcingMode == "strict" {
+				Expect(testTraffic(closedPort, targetNode.Name)).Should(Equal(float64(0)))
+			} else {
+				Expect(testTraffic(closedPort, targetNode.Name)).Should(BeNumerically(">=", float64(99)))
+			}
+
+			// The tester only knows the host networking of strict mode, which routes by the vlan of the branch ENI
+			if enforcingMode == "strict" {
+				validateMatrixHostNetworking(labelKey, busyboxPodLabelVal)
+			}
+		},
+		Entry("strict mode with secondary IPs", "strict", false),
+		Entry("strict mode with prefix delegation", "strict", true),
+		Entry("standard mode with secondary IPs", "standard", false),
+		Entry("standard mode with prefix delegation", "standard", true),
+	)
+})
+
+// waitTillPrefixAllocated waits until the datastore of the target node has a /28 prefix, so that the regular pods get
+// their IPs from prefixes. The secondary IPs allocated before prefix delegation was enabled stay until they are freed.
+func waitTillPrefixAllocated() {
+	client, err := k8sUtils.NewIntrospectionClient(f, targetNode.Name)
+	Expect(err).ToNot(HaveOccurred())
+	defer client.Close()
+
+	err = client.WaitTill("a prefix to be allocated", utils.DefaultENIWaitTimeout,
+		func(eniInfos *datastore.ENIInfos) error {
+			for _, eni := range eniInfos.ENIs {
+				for _, cidr := range eni.AvailableIPv4Cidrs {
+					if cidr.IsPrefix {
+						return nil
+					}
+				}
+			}
+			return fmt.Errorf("no ENI has a prefix")
+		})
+	Expect(err).ToNot(HaveOccurred())
+}
+
+func validateMatrixHostNetworking(labelKey string, labelVal string) {
+	deployment := manifest.NewBusyBoxDeploymentBuilder(f.Options.TestImageRegistry).
+		Replicas(3).
+		PodLabel(labelKey, labelVal).
+		NodeName(targetNode.Name).
+		Build()
+
+	By("creating a deployment to launch pods using Branch ENI")
+	deployment, err := f.K8sResourceManagers.DeploymentManager().
+		CreateAndWaitTillDeploymentIsReady(deployment, utils.DefaultDeploymentReadyTimeout)
+	Expect(err).ToNot(HaveOccurred())
+
+	podList, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelector(labelKey, labelVal)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(ValidatePodsHaveBranchENI(podList)).To(Succeed())
+
+	input, err := GetPodNetworkingValidationInput(podList).Serialize()
+	Expect(err).NotTo(HaveOccurred())
+
+	By("validating host networking setup is setup correctly")
+	ValidateHostNetworking(NetworkingSetupSucceeds, input)
+
+	By("deleting the deployment to test teardown")
+	err = f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployment)
+	Expect(err).ToNot(HaveOccurred())
+
+	By("waiting for the kubelet to tear down the networking of the terminated pods")
+	err = k8sUtils.WaitTillPodsDeleted(f, labelKey, labelVal, utils.DefaultPodDeleteTimeout)
+	Expect(err).ToNot(HaveOccurred())
+
+	By("validating host networking is teared down correctly")
+	ValidateHostNetworking(NetworkingTearDownSucceeds, input)
+}
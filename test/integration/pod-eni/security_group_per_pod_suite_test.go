@@ -18,6 +18,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
@@ -60,9 +61,7 @@ var _ = BeforeSuite(func() {
 	f = framework.New(framework.GlobalOptions)
 
 	By("checking if cluster address family is IPv4 or IPv6")
-	clusterOutput, err := f.CloudServices.EKS().DescribeCluster(f.Options.ClusterName)
-	Expect(err).NotTo(HaveOccurred())
-	if *clusterOutput.Cluster.KubernetesNetworkConfig.IpFamily == "ipv4" {
+	if !f.Options.IsIPv6() {
 		isIPv4Cluster = true
 		fmt.Fprint(GinkgoWriter, "cluster is IPv4\n")
 	} else {
@@ -125,6 +124,10 @@ var _ = BeforeSuite(func() {
 	targetNode = nodeList.Items[0]
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	By("disabling pod-eni on aws-node DaemonSet")
 	k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName,
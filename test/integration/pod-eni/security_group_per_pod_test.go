@@ -20,6 +20,7 @@ import (
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/agent/pkg/input"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/agent"
+	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
 	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
@@ -84,8 +85,9 @@ var _ = Describe("Security Group for Pods Test", func() {
 		By("Deleting Security Group Policy")
 		f.K8sResourceManagers.CustomResourceManager().DeleteResource(securityGroupPolicy)
 
-		By("waiting for the branch ENI to be cooled down")
-		time.Sleep(time.Second * 60)
+		By("waiting for the branch ENIs to be cooled down and deleted")
+		err := awsUtils.WaitTillBranchENIsDeleted(f, securityGroupId, utils.DefaultENIWaitTimeout)
+		Expect(err).ToNot(HaveOccurred())
 	})
 
 	Context("when testing traffic between branch ENI pods and regular pods", func() {
@@ -322,8 +324,9 @@ var _ = Describe("Security Group for Pods Test", func() {
 				DeleteAndWaitTillDeploymentIsDeleted(deployment)
 			Expect(err).ToNot(HaveOccurred())
 
-			By("waiting to allow CNI to tear down networking for terminated pods")
-			time.Sleep(time.Second * 60)
+			By("waiting for the kubelet to tear down the networking of the terminated pods")
+			err = k8sUtils.WaitTillPodsDeleted(f, labelKey, busyboxPodLabelVal, utils.DefaultPodDeleteTimeout)
+			Expect(err).ToNot(HaveOccurred())
 
 			By("validating host networking is teared down correctly")
 			ValidateHostNetworking(NetworkingTearDownSucceeds, input)
@@ -0,0 +1,148 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pod_network_latency
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
+	awsUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+	"github.com/aws/amazon-vpc-resource-controller-k8s/pkg/aws/vpc"
+)
+
+// latencyBudget bounds the 50th, 95th and 99th percentiles of the pod network setup latency, it is set from a flag
+// value like "5s,15s,30s"
+type latencyBudget struct {
+	p50, p95, p99 time.Duration
+}
+
+func (b *latencyBudget) String() string {
+	return fmt.Sprintf("%v,%v,%v", b.p50, b.p95, b.p99)
+}
+
+func (b *latencyBudget) Set(value string) error {
+	parts := strings.Split(value, ",")
+	if len(parts) != 3 {
+		return fmt.Errorf("expected the budgets of p50, p95 and p99 separated by commas, got %q", value)
+	}
+	var durations [3]time.Duration
+	for i, part := range parts {
+		d, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		durations[i] = d
+	}
+	b.p50, b.p95, b.p99 = durations[0], durations[1], durations[2]
+	return nil
+}
+
+var (
+	f     *framework.Framework
+	nodes []corev1.Node
+	// Security group of the branch ENIs of the Security Groups for Pods mode
+	securityGroupID string
+	// Number of branch ENIs of the nodes, which bounds the number of pods of the Security Groups for Pods mode
+	totalBranchInterface int
+
+	// The budgets are flags, so that they can be tightened as the releases get faster
+	podCount               int
+	secondaryIPBudget      = latencyBudget{p50: 10 * time.Second, p95: 30 * time.Second, p99: 45 * time.Second}
+	prefixDelegationBudget = latencyBudget{p50: 5 * time.Second, p95: 15 * time.Second, p99: 30 * time.Second}
+	podENIBudget           = latencyBudget{p50: 20 * time.Second, p95: 60 * time.Second, p99: 90 * time.Second}
+)
+
+func init() {
+	flag.IntVar(&podCount, "latency-pods", 200, "Number of pods launched in each mode, bounded by the free pod capacity of the nodes")
+	flag.Var(&secondaryIPBudget, "secondary-ip-latency-budget", "Budgets of the p50, p95 and p99 pod network setup latency with secondary IPs")
+	flag.Var(&prefixDelegationBudget, "prefix-delegation-latency-budget", "Budgets of the p50, p95 and p99 pod network setup latency with prefix delegation")
+	flag.Var(&podENIBudget, "pod-eni-latency-budget", "Budgets of the p50, p95 and p99 pod network setup latency of pods with a branch ENI")
+}
+
+func TestPodNetworkLatency(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CNI Pod Network Latency Suite")
+}
+
+var _ = BeforeSuite(func() {
+	f = framework.New(framework.GlobalOptions)
+
+	By("creating test namespace")
+	f.K8sResourceManagers.NamespaceManager().CreateNamespace(utils.DefaultTestNamespace)
+
+	By("creating the security group of the branch ENIs")
+	securityGroupOutput, err := f.CloudServices.EC2().CreateSecurityGroup("pod-network-latency-automation",
+		"test created by vpc cni automation test suite", f.Options.AWSVPCID)
+	Expect(err).ToNot(HaveOccurred())
+	securityGroupID = *securityGroupOutput.GroupId
+
+	By("enabling pod eni on aws-node DaemonSet")
+	k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName,
+		utils.AwsNodeNamespace, utils.AwsNodeName, map[string]string{
+			"ENABLE_POD_ENI": "true",
+		})
+
+	// The nodes get a trunk ENI when they start with pod eni enabled
+	By("terminating instances")
+	err = awsUtils.TerminateInstances(f)
+	Expect(err).ToNot(HaveOccurred())
+
+	nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(len(nodeList.Items)).Should(BeNumerically(">", 0))
+	nodes = nodeList.Items
+
+	for _, node := range nodes {
+		if limits, ok := vpc.Limits[node.Labels[corev1.LabelInstanceTypeStable]]; ok {
+			totalBranchInterface += limits.BranchInterface
+		}
+	}
+})
+
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
+var _ = AfterSuite(func() {
+	By("deleting test namespace")
+	f.K8sResourceManagers.NamespaceManager().
+		DeleteAndWaitTillNamespaceDeleted(utils.DefaultTestNamespace)
+
+	By("disabling pod-eni on aws-node DaemonSet")
+	k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName,
+		utils.AwsNodeNamespace, utils.AwsNodeName, map[string]struct{}{
+			"ENABLE_POD_ENI": {},
+		})
+
+	By("terminating instances")
+	err := awsUtils.TerminateInstances(f)
+	Expect(err).ToNot(HaveOccurred())
+
+	By("deleting the security group")
+	err = awsUtils.WaitTillBranchENIsDeleted(f, securityGroupID, utils.DefaultENIWaitTimeout)
+	Expect(err).ToNot(HaveOccurred())
+	err = f.CloudServices.EC2().DeleteSecurityGroup(securityGroupID)
+	Expect(err).ToNot(HaveOccurred())
+})
@@ -0,0 +1,200 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package pod_network_latency
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	vpcControllerFW "github.com/aws/amazon-vpc-resource-controller-k8s/test/framework/manifest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+)
+
+const (
+	latencyLabelKey     = "pod-network-latency"
+	prefixDelegationEnv = "ENABLE_PREFIX_DELEGATION"
+	// The results of each mode are saved in this directory under the --artifacts-dir flag
+	resultsDir = "pod-network-latency"
+)
+
+// latencyResult is saved as JSON for each mode, so that the latencies of releases can be compared
+type latencyResult struct {
+	Mode         string    `json:"mode"`
+	IPFamily     string    `json:"ipFamily"`
+	CNIImage     string    `json:"cniImage"`
+	InstanceType string    `json:"instanceType"`
+	Pods         int       `json:"pods"`
+	Time         time.Time `json:"time"`
+	P50Seconds   float64   `json:"p50Seconds"`
+	P95Seconds   float64   `json:"p95Seconds"`
+	P99Seconds   float64   `json:"p99Seconds"`
+	MaxSeconds   float64   `json:"maxSeconds"`
+	// The budgets the percentiles were checked against
+	P50BudgetSeconds float64 `json:"p50BudgetSeconds"`
+	P95BudgetSeconds float64 `json:"p95BudgetSeconds"`
+	P99BudgetSeconds float64 `json:"p99BudgetSeconds"`
+}
+
+var _ = Describe("Pod network setup latency", func() {
+	var deployment *v1.Deployment
+
+	AfterEach(func() {
+		if deployment != nil {
+			By("deleting the pods")
+			err := f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployment)
+			Expect(err).ToNot(HaveOccurred())
+			err = k8sUtils.WaitTillPodsDeleted(f, latencyLabelKey, deployment.Name, utils.DefaultPodDeleteTimeout)
+			Expect(err).ToNot(HaveOccurred())
+			deployment = nil
+		}
+
+		if !f.Options.IsIPv6() {
+			k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+				utils.AwsNodeName, map[string]struct{}{prefixDelegationEnv: {}})
+		}
+	})
+
+	DescribeTable("should set up the network of the pods within the budgets",
+		func(mode string, prefixDelegation bool, podENI bool, budget *latencyBudget) {
+			// IPv6 pods always get their IPs from prefixes
+			if f.Options.IsIPv6() && !prefixDelegation {
+				Skip("IPv6 clusters always use prefix delegation")
+			}
+			if !f.Options.IsIPv6() {
+				By(fmt.Sprintf("setting %s to %t", prefixDelegationEnv, prefixDelegation))
+				k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+					utils.AwsNodeName, map[string]string{prefixDelegationEnv: fmt.Sprintf("%t", prefixDelegation)})
+			}
+
+			pods := min(podCount, freePodCapacity())
+			if podENI {
+				By("creating the Security Group Policy of the pods")
+				sgp, err := vpcControllerFW.NewSGPBuilder().
+					Namespace(utils.DefaultTestNamespace).
+					Name(mode).
+					SecurityGroup([]string{securityGroupID}).
+					PodMatchLabel(latencyLabelKey, mode).
+					Build()
+				Expect(err).ToNot(HaveOccurred())
+				err = f.K8sResourceManagers.CustomResourceManager().CreateResource(sgp)
+				Expect(err).ToNot(HaveOccurred())
+				defer f.K8sResourceManagers.CustomResourceManager().DeleteResource(sgp)
+
+				pods = min(pods, totalBranchInterface)
+			}
+
+			By(fmt.Sprintf("launching %d pods", pods))
+			builder := manifest.NewBusyBoxDeploymentBuilder(f.Options.TestImageRegistry).
+				Name(mode).
+				Replicas(pods).
+				PodLabel(latencyLabelKey, mode)
+			if f.Options.NgNameLabelVal != "" {
+				builder.NodeSelector(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
+			}
+			var err error
+			deployment, err = f.K8sResourceManagers.DeploymentManager().
+				CreateAndWaitTillDeploymentIsReady(builder.Build(), utils.DefaultDeploymentReadyTimeout)
+			Expect(err).ToNot(HaveOccurred())
+
+			podList, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelector(latencyLabelKey, mode)
+			Expect(err).ToNot(HaveOccurred())
+			var latencies []time.Duration
+			for _, pod := range podList.Items {
+				if latency, ok := k8sUtils.PodNetworkLatency(pod); ok {
+					latencies = append(latencies, latency)
+				}
+			}
+			Expect(latencies).ToNot(BeEmpty())
+
+			result := newLatencyResult(mode, latencies, budget)
+			AddReportEntry("pod network setup latency", result)
+			saveLatencyResult(result)
+
+			By("verifying the percentiles of the pod network setup latency")
+			Expect(utils.Percentile(latencies, 0.50)).To(BeNumerically("<=", budget.p50), "p50 of %s", mode)
+			Expect(utils.Percentile(latencies, 0.95)).To(BeNumerically("<=", budget.p95), "p95 of %s", mode)
+			Expect(utils.Percentile(latencies, 0.99)).To(BeNumerically("<=", budget.p99), "p99 of %s", mode)
+		},
+		Entry("with secondary IPs", "secondary-ip", false, false, &secondaryIPBudget),
+		Entry("with prefix delegation", "prefix-delegation", true, false, &prefixDelegationBudget),
+		Entry("with Security Groups for Pods", "pod-eni", false, true, &podENIBudget),
+	)
+})
+
+// freePodCapacity returns the number of pods that the test nodes can still run
+func freePodCapacity() int {
+	podList, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelectorMap(map[string]string{})
+	Expect(err).ToNot(HaveOccurred())
+	podsByNode := map[string]int{}
+	for _, pod := range podList.Items {
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			podsByNode[pod.Spec.NodeName]++
+		}
+	}
+
+	free := 0
+	for _, node := range nodes {
+		free += max(int(node.Status.Allocatable.Pods().Value())-podsByNode[node.Name], 0)
+	}
+	return free
+}
+
+func newLatencyResult(mode string, latencies []time.Duration, budget *latencyBudget) latencyResult {
+	ds, err := f.K8sResourceManagers.DaemonSetManager().GetDaemonSet(utils.AwsNodeNamespace, utils.AwsNodeName)
+	Expect(err).ToNot(HaveOccurred())
+
+	ipFamily := "ipv4"
+	if f.Options.IsIPv6() {
+		ipFamily = "ipv6"
+	}
+	return latencyResult{
+		Mode:             mode,
+		IPFamily:         ipFamily,
+		CNIImage:         ds.Spec.Template.Spec.Containers[0].Image,
+		InstanceType:     nodes[0].Labels[corev1.LabelInstanceTypeStable],
+		Pods:             len(latencies),
+		Time:             time.Now().UTC(),
+		P50Seconds:       utils.Percentile(latencies, 0.50).Seconds(),
+		P95Seconds:       utils.Percentile(latencies, 0.95).Seconds(),
+		P99Seconds:       utils.Percentile(latencies, 0.99).Seconds(),
+		MaxSeconds:       utils.Percentile(latencies, 1).Seconds(),
+		P50BudgetSeconds: budget.p50.Seconds(),
+		P95BudgetSeconds: budget.p95.Seconds(),
+		P99BudgetSeconds: budget.p99.Seconds(),
+	}
+}
+
+// saveLatencyResult writes the result before the budgets are checked, so that it is published even if they are not met
+func saveLatencyResult(result latencyResult) {
+	GinkgoWriter.Printf("%s: %d pods, p50 %.1fs, p95 %.1fs, p99 %.1fs\n", result.Mode, result.Pods,
+		result.P50Seconds, result.P95Seconds, result.P99Seconds)
+	if f.Options.ArtifactsDir == "" {
+		return
+	}
+	dir := filepath.Join(f.Options.ArtifactsDir, resultsDir)
+	Expect(os.MkdirAll(dir, 0755)).To(Succeed())
+	data, err := json.MarshalIndent(result, "", "  ")
+	Expect(err).ToNot(HaveOccurred())
+	Expect(os.WriteFile(filepath.Join(dir, result.Mode+".json"), data, 0644)).To(Succeed())
+}
@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
 	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
 	testUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
 	"github.com/aws/aws-sdk-go/service/ec2"
@@ -96,8 +97,7 @@ var _ = BeforeSuite(func() {
 		Subnet: []string{
 			privateSubnetId,
 		},
-		InstanceType: "m5.large",
-		KeyPairName:  DEFAULT_KEY_PAIR,
+		KeyPairName: DEFAULT_KEY_PAIR,
 	}
 
 	err = utils.CreateAndWaitTillSelfManagedNGReady(f, props)
@@ -138,6 +138,10 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 })
 
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
 var _ = AfterSuite(func() {
 	//using default key pair created by test
 	if DEFAULT_KEY_PAIR == "test-key-pair" {
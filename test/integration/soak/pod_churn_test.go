@@ -0,0 +1,169 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package soak
+
+import (
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/aws/amazon-vpc-cni-k8s/pkg/awsutils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+)
+
+const churnLabelKey = "soak-churn"
+
+// nodeAddresses is the number of ENIs and IPs of a node
+type nodeAddresses struct {
+	enis int
+	ips  int
+}
+
+var _ = Describe("[SOAK] Pod churn", func() {
+	It("does not leak ENIs or IPs, assign duplicate IPs or slow down pod network setup", func() {
+		By("recording the ENIs and IPs of the nodes before the churn")
+		baseline := map[string]nodeAddresses{}
+		for _, node := range nodes {
+			baseline[node.Name] = getNodeAddresses(node)
+		}
+
+		var (
+			deployments []*v1.Deployment
+			latencies   []time.Duration
+			restarts    = awsNodeRestarts()
+			start       = time.Now()
+		)
+		for round := 0; time.Since(start) < soakDuration; round++ {
+			roundStart := time.Now()
+
+			builder := manifest.NewBusyBoxDeploymentBuilder(f.Options.TestImageRegistry).
+				Name(fmt.Sprintf("churn-%d", round)).
+				Replicas(churnReplicas).
+				PodLabel(churnLabelKey, fmt.Sprintf("churn-%d", round))
+			if f.Options.NgNameLabelVal != "" {
+				builder.NodeSelector(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
+			}
+			deployment := builder.Build()
+			deployment, err := f.K8sResourceManagers.DeploymentManager().
+				CreateAndWaitTillDeploymentIsReady(deployment, utils.DefaultDeploymentReadyTimeout)
+			Expect(err).ToNot(HaveOccurred())
+			deployments = append(deployments, deployment)
+
+			pods, err := f.K8sResourceManagers.PodManager().
+				GetPodsWithLabelSelector(churnLabelKey, deployment.Name)
+			Expect(err).ToNot(HaveOccurred())
+			for _, pod := range pods.Items {
+				if latency, ok := k8sUtils.PodNetworkLatency(pod); ok {
+					latencies = append(latencies, latency)
+				}
+			}
+
+			By(fmt.Sprintf("round %d: verifying that no two pods have the same IP", round))
+			Expect(duplicatePodIPs()).To(BeEmpty())
+
+			if len(deployments) > maxChurnDeployments {
+				err = f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployments[0])
+				Expect(err).ToNot(HaveOccurred())
+				deployments = deployments[1:]
+			}
+
+			GinkgoWriter.Printf("round %d after %v: %d pods set up, p99 network setup latency %v\n",
+				round, time.Since(start).Round(time.Second), len(latencies), utils.Percentile(latencies, 0.99))
+			time.Sleep(churnInterval - time.Since(roundStart))
+		}
+
+		By("verifying the 99th percentile of the pod network setup latency")
+		Expect(utils.Percentile(latencies, 0.99)).To(BeNumerically("<=", maxPodNetworkLatency))
+
+		By("verifying that aws-node did not restart")
+		Expect(awsNodeRestarts()).To(Equal(restarts))
+
+		By("deleting the remaining deployments")
+		for _, deployment := range deployments {
+			err := f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployment)
+			Expect(err).ToNot(HaveOccurred())
+		}
+
+		By("verifying that the nodes are back to the ENIs and IPs they had before the churn")
+		for _, node := range nodes {
+			Eventually(func() nodeAddresses {
+				return getNodeAddresses(node)
+			}).WithTimeout(6*time.Minute).WithPolling(10*time.Second).Should(Equal(baseline[node.Name]),
+				"ENIs and IPs of node %s", node.Name)
+		}
+
+		By("verifying that no detached ENI of the nodes is left")
+		for _, node := range nodes {
+			output, err := f.CloudServices.EC2().
+				DescribeNetworkInterfacesWithTag(awsutils.ENINodeTagKey, k8sUtils.GetInstanceIDFromNode(node))
+			Expect(err).ToNot(HaveOccurred())
+			for _, eni := range output.NetworkInterfaces {
+				Expect(*eni.Status).ToNot(Equal(ec2.NetworkInterfaceStatusAvailable), "ENI %s of node %s is detached",
+					*eni.NetworkInterfaceId, node.Name)
+			}
+		}
+	})
+})
+
+func getNodeAddresses(node corev1.Node) nodeAddresses {
+	instance, err := f.CloudServices.EC2().DescribeInstance(k8sUtils.GetInstanceIDFromNode(node))
+	Expect(err).ToNot(HaveOccurred())
+	addresses := nodeAddresses{enis: len(instance.NetworkInterfaces)}
+	for _, eni := range instance.NetworkInterfaces {
+		addresses.ips += len(eni.PrivateIpAddresses) + len(eni.Ipv6Addresses)
+	}
+	return addresses
+}
+
+// duplicatePodIPs returns the pods by IP of the IPs assigned to more than one running pod of the cluster. The pods being
+// deleted are left out, since their IP may already be released to a new pod.
+func duplicatePodIPs() map[string][]string {
+	pods, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelectorMap(map[string]string{})
+	Expect(err).ToNot(HaveOccurred())
+
+	podsByIP := map[string][]string{}
+	for _, pod := range pods.Items {
+		if pod.Spec.HostNetwork || pod.DeletionTimestamp != nil || pod.Status.Phase != corev1.PodRunning ||
+			pod.Status.PodIP == "" {
+			continue
+		}
+		podsByIP[pod.Status.PodIP] = append(podsByIP[pod.Status.PodIP], pod.Namespace+"/"+pod.Name)
+	}
+	for ip, pods := range podsByIP {
+		if len(pods) < 2 {
+			delete(podsByIP, ip)
+		}
+	}
+	return podsByIP
+}
+
+func awsNodeRestarts() map[string]int32 {
+	pods, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelector("k8s-app", utils.AwsNodeName)
+	Expect(err).ToNot(HaveOccurred())
+	restarts := map[string]int32{}
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			restarts[pod.Name] += status.RestartCount
+		}
+	}
+	return restarts
+}
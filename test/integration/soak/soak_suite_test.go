@@ -0,0 +1,86 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package soak
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+)
+
+var (
+	f     *framework.Framework
+	nodes []corev1.Node
+
+	// The churn is configured with flags, so that the same suite runs for minutes in CI and for hours before releases
+	soakDuration         time.Duration
+	churnInterval        time.Duration
+	churnReplicas        int
+	maxChurnDeployments  int
+	maxPodNetworkLatency time.Duration
+)
+
+func init() {
+	flag.DurationVar(&soakDuration, "soak-duration", 2*time.Hour, "How long the deployments are churned")
+	flag.DurationVar(&churnInterval, "churn-interval", 30*time.Second, "Interval between the creation of two deployments")
+	flag.IntVar(&churnReplicas, "churn-replicas", 10, "Number of pods of each deployment")
+	flag.IntVar(&maxChurnDeployments, "max-churn-deployments", 5, "Number of deployments kept, the oldest one is deleted when a new one is created")
+	flag.DurationVar(&maxPodNetworkLatency, "max-pod-network-latency", 30*time.Second, "Bound of the 99th percentile of the time from pod scheduling to pod network setup")
+}
+
+func TestPodChurnSoak(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "CNI Pod Churn Soak Test Suite")
+}
+
+var _ = BeforeSuite(func() {
+	f = framework.New(framework.GlobalOptions)
+
+	By("creating test namespace")
+	f.K8sResourceManagers.NamespaceManager().CreateNamespace(utils.DefaultTestNamespace)
+
+	nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(f.Options.NgNameLabelKey, f.Options.NgNameLabelVal)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(len(nodeList.Items)).Should(BeNumerically(">", 0))
+	nodes = nodeList.Items
+
+	// Without warm ENIs, the nodes release the ENIs and IPs of the deleted pods, so that leaks show in the ENI and
+	// IP counts at the end of the churn
+	By("setting WARM_IP_TARGET to 3 and WARM_ENI_TARGET to 0")
+	k8sUtils.AddEnvVarToDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+		utils.AwsNodeName, map[string]string{"WARM_IP_TARGET": "3", "WARM_ENI_TARGET": "0"})
+})
+
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
+var _ = AfterSuite(func() {
+	By("deleting test namespace")
+	f.K8sResourceManagers.NamespaceManager().
+		DeleteAndWaitTillNamespaceDeleted(utils.DefaultTestNamespace)
+
+	By("restoring the warm targets")
+	k8sUtils.RemoveVarFromDaemonSetAndWaitTillUpdated(f, utils.AwsNodeName, utils.AwsNodeNamespace,
+		utils.AwsNodeName, map[string]struct{}{"WARM_IP_TARGET": {}, "WARM_ENI_TARGET": {}})
+})
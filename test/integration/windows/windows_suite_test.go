@@ -0,0 +1,104 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package windows
+
+import (
+	"testing"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/artifacts"
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/aws/utils"
+	testUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	v1 "k8s.io/api/core/v1"
+)
+
+var (
+	f     *framework.Framework
+	props utils.NodeGroupProperties
+	// The Windows node the test pods are scheduled on
+	windowsNode v1.Node
+)
+
+// Change this if you want to use your own Key Pair
+const DEFAULT_KEY_PAIR = "test-key-pair"
+
+func TestWindows(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Windows Suite")
+}
+
+var _ = BeforeSuite(func() {
+	f = framework.New(framework.GlobalOptions)
+
+	By("creating test namespace")
+	f.K8sResourceManagers.NamespaceManager().
+		CreateNamespace(testUtils.DefaultTestNamespace)
+
+	By("enabling the Windows IPAM")
+	err := utils.EnableWindowsIPAM(f, true)
+	Expect(err).ToNot(HaveOccurred())
+
+	By("getting the cluster VPC config")
+	vpcConfig, err := utils.GetClusterVPCConfig(f)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(len(vpcConfig.PublicSubnetList)).To(BeNumerically(">", 0))
+
+	By("creating the key pair if it doesn't exist")
+	keyPairOutput, _ := f.CloudServices.EC2().DescribeKey(DEFAULT_KEY_PAIR)
+	if keyPairOutput == nil || len(keyPairOutput.KeyPairs) == 0 {
+		_, err := f.CloudServices.EC2().CreateKey(DEFAULT_KEY_PAIR)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	By("deploying a self managed Windows nodegroup of size 1")
+	props = utils.NodeGroupProperties{
+		NgLabelKey:    "test-label-key",
+		NgLabelVal:    "windows-test-ng",
+		AsgSize:       1,
+		NodeGroupName: "windows-test-ng",
+		Subnet:        vpcConfig.PublicSubnetList[:1],
+		InstanceType:  "m5.large",
+		KeyPairName:   DEFAULT_KEY_PAIR,
+		IsWindows:     true,
+	}
+	err = utils.CreateAndWaitTillSelfManagedNGReady(f, props)
+	Expect(err).NotTo(HaveOccurred())
+
+	nodeList, err := f.K8sResourceManagers.NodeManager().GetNodes(props.NgLabelKey, props.NgLabelVal)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(nodeList.Items).ToNot(BeEmpty())
+	windowsNode = nodeList.Items[0]
+	Expect(windowsNode.Labels[testUtils.NodeOSLabelKey]).To(Equal(testUtils.NodeOSWindows))
+})
+
+var _ = JustAfterEach(func() {
+	artifacts.CollectOnFailure(f)
+})
+
+var _ = AfterSuite(func() {
+	By("deleting test namespace")
+	f.K8sResourceManagers.NamespaceManager().
+		DeleteAndWaitTillNamespaceDeleted(testUtils.DefaultTestNamespace)
+
+	By("deleting the Windows nodegroup")
+	err := utils.DeleteAndWaitTillSelfManagedNGStackDeleted(f, props)
+	Expect(err).NotTo(HaveOccurred())
+
+	By("disabling the Windows IPAM")
+	err = utils.EnableWindowsIPAM(f, false)
+	Expect(err).NotTo(HaveOccurred())
+})
@@ -0,0 +1,82 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package windows
+
+import (
+	"fmt"
+
+	"github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/manifest"
+	k8sUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/resources/k8s/utils"
+	testUtils "github.com/aws/amazon-vpc-cni-k8s/test/framework/utils"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	appsV1 "k8s.io/api/apps/v1"
+)
+
+// Windows pods get secondary IPs of the primary ENI of the node, assigned by the VPC resource controller
+var _ = Describe("test Windows pod networking", func() {
+	var deployment *appsV1.Deployment
+
+	BeforeEach(func() {
+		By("creating a deployment of HTTP servers on the Windows node")
+		deployment = manifest.NewWindowsDeploymentBuilder().
+			Name("windows-server").
+			Replicas(3).
+			PodLabel("app", "windows-server").
+			NodeName(windowsNode.Name).
+			Build()
+
+		var err error
+		deployment, err = f.K8sResourceManagers.DeploymentManager().
+			CreateAndWaitTillDeploymentIsReady(deployment, testUtils.DefaultDeploymentReadyTimeout)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		By("deleting the deployment")
+		err := f.K8sResourceManagers.DeploymentManager().DeleteAndWaitTillDeploymentIsDeleted(deployment)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	It("pods should get IPs from the primary ENI and reach each other", func() {
+		pods, err := f.K8sResourceManagers.PodManager().GetPodsWithLabelSelector("app", "windows-server")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(len(pods.Items)).To(BeNumerically(">", 1))
+
+		By("verifying the pod IPs are secondary IPs of the primary ENI")
+		instance, err := f.CloudServices.EC2().DescribeInstance(k8sUtils.GetInstanceIDFromNode(windowsNode))
+		Expect(err).ToNot(HaveOccurred())
+		secondaryIPs := map[string]bool{}
+		for _, nwInterface := range instance.NetworkInterfaces {
+			if *nwInterface.Attachment.DeviceIndex != 0 {
+				continue
+			}
+			for _, ip := range nwInterface.PrivateIpAddresses {
+				if !*ip.Primary {
+					secondaryIPs[*ip.PrivateIpAddress] = true
+				}
+			}
+		}
+		for _, pod := range pods.Items {
+			Expect(secondaryIPs).To(HaveKey(pod.Status.PodIP), "pod %s", pod.Name)
+		}
+
+		By("verifying the pods can reach each other")
+		sender, receiver := pods.Items[0], pods.Items[1]
+		stdout, stderr, err := f.K8sResourceManagers.PodManager().PodExec(sender.Namespace, sender.Name,
+			[]string{"/agnhost", "connect", fmt.Sprintf("%s:80", receiver.Status.PodIP), "--timeout=5s"})
+		Expect(err).ToNot(HaveOccurred(), "stdout: %s, stderr: %s", stdout, stderr)
+	})
+})
@@ -22,7 +22,7 @@ func GetMetaData(key string) (string, error) {
 	ec2Metadata = ec2metadatasvc.New(awsSession)
 	requestedData, err := ec2Metadata.GetMetadata(key)
 	if err != nil {
-		return "", fmt.Errorf("get instance metadata: failed to retrieve %s - %s", key, err)
+		return "", fmt.Errorf("get instance metadata: failed to retrieve %s - %w", key, err)
 	}
 	return requestedData, nil
 }
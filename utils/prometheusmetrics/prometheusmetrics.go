@@ -95,6 +95,13 @@ var (
 		},
 		[]string{"api", "error"},
 	)
+	AwsAPIErrClass = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "awscni_aws_api_error_class_total",
+			Help: "The number of AWS API errors by API and class: throttled, transient, unauthorized, not_found, insufficient_subnet_ips, ip_limit_exceeded, eni_limit_exceeded or other",
+		},
+		[]string{"api", "class"},
+	)
 	AwsUtilsErr = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "awscni_aws_utils_error_count",
@@ -116,6 +123,28 @@ var (
 		},
 		[]string{"fn"},
 	)
+	Ec2APICallDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "awscni_ec2_api_call_duration_seconds",
+			Help:    "The duration of the EC2 API calls, retries included, by operation and result: success, throttled or error",
+			Buckets: ec2APICallBuckets,
+		},
+		[]string{"api", "result"},
+	)
+	Ec2APIInflightCalls = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "awscni_ec2_api_inflight_calls",
+			Help: "The number of EC2 API calls in flight, by operation",
+		},
+		[]string{"api"},
+	)
+	Ec2APIRetryBackoffCalls = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "awscni_ec2_api_retry_backoff_calls",
+			Help: "The number of EC2 API calls waiting out the backoff before a retry, by operation",
+		},
+		[]string{"api"},
+	)
 	Enis = prometheus.NewGauge(
 		prometheus.GaugeOpts{
 			Name: "awscni_eni_allocated",
@@ -172,16 +201,115 @@ var (
 		},
 		[]string{"eni"},
 	)
+	Degraded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "awscni_ipamd_degraded",
+			Help: "The degradation level of ipamd, 0 when it runs within its resource budget, 1 when it sheds non-essential work and 2 when it also skips optional reconciles",
+		},
+	)
+	PodSetupDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Name:    "awscni_pod_setup_duration_seconds",
+			Help:    "The duration of the network setup of pods by the CNI plugin, from the ADD request to the result",
+			Buckets: podSetupBuckets,
+		},
+	)
+	PodSetupPhaseDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "awscni_pod_setup_phase_duration_seconds",
+			Help:    "The duration of the phases of the network setup of pods: ipamd_wait, ec2_allocate (part of ipamd_wait), link_setup, route_rule_programming and policy_handoff",
+			Buckets: podSetupBuckets,
+		},
+		[]string{"phase"},
+	)
+	IPWaitDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "awscni_ip_wait_duration_seconds",
+			Help:    "The time the ADDs that found no free IP waited for ipamd to allocate one, by allocation class",
+			Buckets: podSetupBuckets,
+		},
+		[]string{"class"},
+	)
+	IPWaitRequests = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "awscni_ip_wait_requests",
+			Help: "The number of ADDs waiting for ipamd to allocate an IP, by allocation class",
+		},
+		[]string{"class"},
+	)
+	NamespaceVPCResources = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "awscni_namespace_vpc_resources",
+			Help: "The VPC resources consumed by the pods of a namespace on the node, the shared ENIs and prefixes split by assigned IPs",
+		},
+		[]string{"namespace", "resource"},
+	)
+	FeatureEnabled = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "awscni_feature_enabled",
+			Help: "Whether a feature gate of ipamd is enabled, by feature and stage",
+		},
+		[]string{"feature", "stage"},
+	)
+	SandboxMismatches = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "awscni_sandbox_mismatches",
+			Help: "The mismatches between the datastore, the host-side veths of the pods and the pods of the node found by the last reconcile, by type",
+		},
+		[]string{"type"},
+	)
+	SandboxMismatchRepairs = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "awscni_sandbox_mismatch_repairs_total",
+			Help: "The number of mismatches between the datastore and the pods of the node repaired, by type",
+		},
+		[]string{"type"},
+	)
+	AdvertisedPodPrefixes = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "awscni_advertised_pod_prefixes",
+			Help: "The number of pod IP prefixes in the BGP configuration written for FRR",
+		},
+	)
 )
 
+// podSetupBuckets range from the few milliseconds of programming routes to the seconds of an EC2 allocation
+var podSetupBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// ec2APICallBuckets range from a fast EC2 call to a call retried through the backoffs of throttling
+var ec2APICallBuckets = []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+
+// traceIDExemplarLabel is the exemplar label of the trace ID of a CNI request, the default of the Grafana data links
+const traceIDExemplarLabel = "trace_id"
+
+// ObserveWithTraceID observes the value, with the trace ID of the CNI request as exemplar if there is one, so that
+// dashboards link the outliers to the logs of the request
+func ObserveWithTraceID(observer prometheus.Observer, value float64, traceID string) {
+	if exemplarObserver, ok := observer.(prometheus.ExemplarObserver); ok && traceID != "" {
+		exemplarObserver.ObserveWithExemplar(value, prometheus.Labels{traceIDExemplarLabel: traceID})
+		return
+	}
+	observer.Observe(value)
+}
+
 // ServeMetrics sets up ipamd metrics and introspection endpoints
-func ServeMetrics(metricsPort int) {
-	log.Infof("Serving metrics on port %d", metricsPort)
-	server := SetupMetricsServer(metricsPort)
+func ServeMetrics(metricsPort int, config ServerSecurityConfig) {
+	log.Infof("Serving metrics on port %d, TLS: %v", metricsPort, config.TLSEnabled())
+	server, err := SetupMetricsServer(metricsPort, config)
+	if err != nil {
+		log.Errorf("Failed to set up the metrics server: %v", err)
+		return
+	}
 	for {
 		once := sync.Once{}
 		_ = retry.WithBackoff(retry.NewSimpleBackoff(time.Second, time.Minute, 0.2, 2), func() error {
-			err := server.ListenAndServe()
+			var err error
+			if config.TLSEnabled() {
+				// The certificate is set by the TLS configuration of the server
+				err = server.ListenAndServeTLS("", "")
+			} else {
+				err = server.ListenAndServe()
+			}
 			once.Do(func() {
 				log.Warnf("Error running http API: %v", err)
 			})
@@ -190,16 +318,24 @@ func ServeMetrics(metricsPort int) {
 	}
 }
 
-func SetupMetricsServer(metricsPort int) *http.Server {
+func SetupMetricsServer(metricsPort int, config ServerSecurityConfig) (*http.Server, error) {
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
 	serveMux := http.NewServeMux()
-	serveMux.Handle("/metrics", promhttp.Handler())
+	// OpenMetrics is negotiated with the scrapers that support it, it is the only format that carries exemplars
+	handler := promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}))
+	serveMux.Handle("/metrics", config.authenticate(handler))
 	server := &http.Server{
 		Addr:         ":" + strconv.Itoa(metricsPort),
 		Handler:      serveMux,
+		TLSConfig:    tlsConfig,
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 5 * time.Second,
 	}
-	return server
+	return server, nil
 }
 
 func PrometheusRegister() {
@@ -213,9 +349,13 @@ func PrometheusRegister() {
 	prometheus.MustRegister(PodENIErr)
 	prometheus.MustRegister(AwsAPILatency)
 	prometheus.MustRegister(AwsAPIErr)
+	prometheus.MustRegister(AwsAPIErrClass)
 	prometheus.MustRegister(AwsUtilsErr)
 	prometheus.MustRegister(Ec2ApiReq)
 	prometheus.MustRegister(Ec2ApiErr)
+	prometheus.MustRegister(Ec2APICallDuration)
+	prometheus.MustRegister(Ec2APIInflightCalls)
+	prometheus.MustRegister(Ec2APIRetryBackoffCalls)
 	prometheus.MustRegister(Enis)
 	prometheus.MustRegister(TotalIPs)
 	prometheus.MustRegister(AssignedIPs)
@@ -225,6 +365,16 @@ func PrometheusRegister() {
 	prometheus.MustRegister(IpsPerCidr)
 	prometheus.MustRegister(NoAvailableIPAddrs)
 	prometheus.MustRegister(EniIPsInUse)
+	prometheus.MustRegister(Degraded)
+	prometheus.MustRegister(PodSetupDuration)
+	prometheus.MustRegister(PodSetupPhaseDuration)
+	prometheus.MustRegister(IPWaitDuration)
+	prometheus.MustRegister(IPWaitRequests)
+	prometheus.MustRegister(NamespaceVPCResources)
+	prometheus.MustRegister(FeatureEnabled)
+	prometheus.MustRegister(SandboxMismatches)
+	prometheus.MustRegister(SandboxMismatchRepairs)
+	prometheus.MustRegister(AdvertisedPodPrefixes)
 
 }
 
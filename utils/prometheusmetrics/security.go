@@ -0,0 +1,138 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//      http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package prometheusmetrics
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// Environment variables to serve the metrics endpoint over TLS, with the certificate and key files of the server
+	envMetricsTLSCertFile = "METRICS_TLS_CERT_FILE"
+	envMetricsTLSKeyFile  = "METRICS_TLS_KEY_FILE"
+
+	// Environment variable to require client certificates signed by the CAs of the file
+	envMetricsTLSClientCAFile = "METRICS_TLS_CLIENT_CA_FILE"
+
+	// Environment variable to require the bearer token of the file in the Authorization header of the scrapes
+	envMetricsBearerTokenFile = "METRICS_BEARER_TOKEN_FILE"
+)
+
+// ServerSecurityConfig is the TLS and authentication configuration of the metrics endpoint. The zero value serves the
+// metrics over plaintext HTTP without authentication.
+type ServerSecurityConfig struct {
+	// CertFile and KeyFile are the certificate and key of the server, the endpoint is served over TLS when they are set
+	CertFile string
+	KeyFile  string
+	// ClientCAFile requires client certificates signed by one of its CAs
+	ClientCAFile string
+	// BearerTokenFile requires its token in the Authorization header. It is read on every request, so that the token
+	// can be rotated without restarting.
+	BearerTokenFile string
+}
+
+// GetServerSecurityConfig reads the configuration of the metrics endpoint from the environment
+func GetServerSecurityConfig() (ServerSecurityConfig, error) {
+	config := ServerSecurityConfig{
+		CertFile:        os.Getenv(envMetricsTLSCertFile),
+		KeyFile:         os.Getenv(envMetricsTLSKeyFile),
+		ClientCAFile:    os.Getenv(envMetricsTLSClientCAFile),
+		BearerTokenFile: os.Getenv(envMetricsBearerTokenFile),
+	}
+	return config, config.validate()
+}
+
+// TLSEnabled returns whether the endpoint is served over TLS
+func (c ServerSecurityConfig) TLSEnabled() bool {
+	return c.CertFile != ""
+}
+
+func (c ServerSecurityConfig) validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.Errorf("%s and %s must be set together", envMetricsTLSCertFile, envMetricsTLSKeyFile)
+	}
+	// Client certificates and tokens must not be sent over plaintext HTTP
+	if !c.TLSEnabled() && c.ClientCAFile != "" {
+		return errors.Errorf("%s requires %s and %s", envMetricsTLSClientCAFile, envMetricsTLSCertFile, envMetricsTLSKeyFile)
+	}
+	if !c.TLSEnabled() && c.BearerTokenFile != "" {
+		return errors.Errorf("%s requires %s and %s", envMetricsBearerTokenFile, envMetricsTLSCertFile, envMetricsTLSKeyFile)
+	}
+	return nil
+}
+
+// tlsConfig returns the TLS configuration of the server, nil if TLS is not enabled. The certificate is read on every
+// handshake, so that it can be rotated without restarting.
+func (c ServerSecurityConfig) tlsConfig() (*tls.Config, error) {
+	if !c.TLSEnabled() {
+		return nil, nil
+	}
+	// Fail early on a missing or invalid certificate rather than on the first scrape
+	if _, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile); err != nil {
+		return nil, errors.Wrap(err, "failed to load the metrics server certificate")
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		},
+	}
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read the metrics client CA file")
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no certificate found in the metrics client CA file %s", c.ClientCAFile)
+		}
+		config.ClientCAs = clientCAs
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// authenticate wraps the handler with the bearer token check, if a token is configured
+func (c ServerSecurityConfig) authenticate(handler http.Handler) http.Handler {
+	if c.BearerTokenFile == "" {
+		return handler
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, err := os.ReadFile(c.BearerTokenFile)
+		if err != nil {
+			log.Errorf("Failed to read the metrics bearer token file: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		expected := strings.TrimSpace(string(token))
+		provided, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if expected == "" || !found || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,179 @@
+// Copyright Amazon.com Inc. or its affiliates. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License"). You may
+// not use this file except in compliance with the License. A copy of the
+// License is located at
+//
+//     http://aws.amazon.com/apache2.0/
+//
+// or in the "license" file accompanying this file. This file is distributed
+// on an "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either
+// express or implied. See the License for the specific language governing
+// permissions and limitations under the License.
+
+package prometheusmetrics
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	stdlog "log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServerSecurityConfigValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ServerSecurityConfig
+		wantErr bool
+	}{
+		{"plaintext", ServerSecurityConfig{}, false},
+		{"tls", ServerSecurityConfig{CertFile: "tls.crt", KeyFile: "tls.key"}, false},
+		{"mtls and token", ServerSecurityConfig{CertFile: "tls.crt", KeyFile: "tls.key", ClientCAFile: "ca.crt", BearerTokenFile: "token"}, false},
+		{"cert without key", ServerSecurityConfig{CertFile: "tls.crt"}, true},
+		{"client CA without tls", ServerSecurityConfig{ClientCAFile: "ca.crt"}, true},
+		{"token without tls", ServerSecurityConfig{BearerTokenFile: "token"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.validate()
+			if tt.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBearerTokenAuthentication(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("secret\n"), 0600))
+	config := ServerSecurityConfig{BearerTokenFile: tokenFile}
+	handler := config.authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for authorization, status := range map[string]int{
+		"":              http.StatusUnauthorized,
+		"Bearer wrong":  http.StatusUnauthorized,
+		"Basic secret":  http.StatusUnauthorized,
+		"Bearer secret": http.StatusOK,
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, status, w.Code, authorization)
+	}
+
+	// The token is rotated without restarting
+	require.NoError(t, os.WriteFile(tokenFile, []byte("rotated"), 0600))
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca, caKey := newTestCertificate(t, nil, nil, true)
+	writeTestCertificate(t, dir, "ca", ca, caKey)
+	server, serverKey := newTestCertificate(t, ca, caKey, false)
+	writeTestCertificate(t, dir, "server", server, serverKey)
+	client, clientKey := newTestCertificate(t, ca, caKey, false)
+
+	config := ServerSecurityConfig{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		ClientCAFile: filepath.Join(dir, "ca.crt"),
+	}
+	tlsConfig, err := config.tlsConfig()
+	require.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ts := &http.Server{
+		Handler:  http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		ErrorLog: stdlog.New(io.Discard, "", 0),
+	}
+	go ts.Serve(tls.NewListener(listener, tlsConfig))
+	defer ts.Close()
+	url := "https://" + listener.Addr().String()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	withoutCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	_, err = withoutCert.Get(url)
+	assert.Error(t, err)
+
+	withCert := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs: roots,
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{client.Raw},
+			PrivateKey:  clientKey,
+		}},
+	}}}
+	resp, err := withCert.Get(url)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTLSConfigMissingCertificate(t *testing.T) {
+	config := ServerSecurityConfig{CertFile: "missing.crt", KeyFile: "missing.key"}
+	_, err := config.tlsConfig()
+	assert.Error(t, err)
+}
+
+// newTestCertificate creates a CA if parent is nil, else a certificate for 127.0.0.1 signed by parent
+func newTestCertificate(t *testing.T, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, isCA bool) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	if isCA {
+		template.KeyUsage = x509.KeyUsageCertSign
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+func writeTestCertificate(t *testing.T, dir string, name string, cert *x509.Certificate, key *ecdsa.PrivateKey) {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}